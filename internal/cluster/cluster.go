@@ -0,0 +1,143 @@
+// 集群模式, 多个副本通过 redis 共享缓存和会话等运行时状态
+//
+// redis 不可用时所有操作退化为未命中或不执行, 各副本继续独立运行;
+// 出现异常后熔断一段时间, 期间直接跳过 redis 请求, 避免每个请求都等待连接超时, 冷却之后放行一个探测请求
+package cluster
+
+import (
+	"context"
+	"log"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/breaker"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/redis"
+)
+
+const (
+	// redisPoolSize 保留的 redis 空闲连接数
+	redisPoolSize = 16
+
+	// redisCooldown redis 出现异常之后跳过请求的时间, 之后放行一个探测请求
+	redisCooldown = time.Second * 10
+)
+
+var (
+	// client redis 客户端, 首次使用时初始化
+	client *redis.Client
+	// clientOnce 并发控制
+	clientOnce sync.Once
+	// unhealthy redis 当前是否不可用, 只在状态变化时打印日志
+	unhealthy atomic.Bool
+	// redisBreaker redis 熔断器, 出现一次异常即熔断
+	redisBreaker = breaker.New(1, redisCooldown)
+)
+
+// Enabled 判断是否启用了集群模式
+func Enabled() bool {
+	return config.C != nil && config.C.Cluster != nil && config.C.Cluster.Enable
+}
+
+// Node 获取当前副本的名称
+func Node() string {
+	return config.C.Cluster.Node
+}
+
+// Key 拼接带前缀的 key, 如: Key("cache", "xxx") => go-emby2alist:cache:xxx
+func Key(parts ...string) string {
+	return config.C.Cluster.Prefix + strings.Join(parts, ":")
+}
+
+// Get 获取字符串类型的值, 不存在或 redis 不可用时返回 false
+func Get(key string) (string, bool) {
+	if !redisBreaker.Allow() {
+		return "", false
+	}
+	v, err := redisClient().Get(context.Background(), key)
+	if err == redis.ErrNil {
+		report(nil)
+		return "", false
+	}
+	if report(err) {
+		return "", false
+	}
+	return v, true
+}
+
+// Set 设置字符串类型的值, ttl 小于等于 0 时不过期
+func Set(key, value string, ttl time.Duration) {
+	if !redisBreaker.Allow() {
+		return
+	}
+	report(redisClient().Set(context.Background(), key, value, ttl))
+}
+
+// Del 删除 key
+func Del(keys ...string) {
+	if !redisBreaker.Allow() {
+		return
+	}
+	report(redisClient().Del(context.Background(), keys...))
+}
+
+// HSet 设置哈希表中字段的值, 同时刷新整个哈希表的过期时间
+func HSet(key, field, value string, ttl time.Duration) {
+	if !redisBreaker.Allow() {
+		return
+	}
+	if report(redisClient().HSet(context.Background(), key, field, value)) {
+		return
+	}
+	report(redisClient().PExpire(context.Background(), key, ttl))
+}
+
+// HDel 删除哈希表中的字段
+func HDel(key string, fields ...string) {
+	if !redisBreaker.Allow() {
+		return
+	}
+	report(redisClient().HDel(context.Background(), key, fields...))
+}
+
+// HGetAll 获取哈希表中所有的字段和值, redis 不可用时返回 false
+func HGetAll(key string) (map[string]string, bool) {
+	if !redisBreaker.Allow() {
+		return nil, false
+	}
+	m, err := redisClient().HGetAll(context.Background(), key)
+	if report(err) {
+		return nil, false
+	}
+	return m, true
+}
+
+// redisClient 获取 redis 客户端
+func redisClient() *redis.Client {
+	clientOnce.Do(func() {
+		cfg := config.C.Cluster.Redis
+		client = redis.New(cfg.Addr, cfg.Password, cfg.DB, cfg.TimeoutDuration(), redisPoolSize)
+	})
+	return client
+}
+
+// report 记录 redis 的可用状态, 出现异常时返回 true
+//
+// 同时更新熔断器的状态, 每次通过熔断器放行的请求都需要调用
+func report(err error) bool {
+	if err == nil {
+		redisBreaker.Success()
+		if unhealthy.CompareAndSwap(true, false) {
+			log.Printf(colors.ToGreen("[%s] redis 已恢复, 重新共享集群状态"), Node())
+		}
+		return false
+	}
+	redisBreaker.Failure()
+	if unhealthy.CompareAndSwap(false, true) {
+		log.Printf(colors.ToRed("[%s] redis 不可用, 暂时独立运行: %v"), Node(), err)
+	}
+	return true
+}
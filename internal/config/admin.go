@@ -0,0 +1,12 @@
+package config
+
+// Admin 管理接口配置
+type Admin struct {
+	// Token 访问管理接口 (/admin/*) 的密钥, 为空时不启用管理接口
+	Token string `yaml:"token"`
+}
+
+// Init 配置初始化
+func (a *Admin) Init() error {
+	return nil
+}
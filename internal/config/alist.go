@@ -2,6 +2,8 @@ package config
 
 import (
 	"errors"
+	"fmt"
+	"time"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
 )
@@ -11,6 +13,35 @@ type Alist struct {
 	Token string `yaml:"token"`
 	// Host alist 访问地址（如果 alist 使用本地代理模式, 则这个地址必须配置公网可访问地址）
 	Host string `yaml:"host"`
+	// Mirrors 指向同一个 alist 的备用访问地址 (如内网地址和公网域名), 与 host 一起按顺序使用第一个可用的地址
+	Mirrors []string `yaml:"mirrors"`
+	// MirrorTimeout 配置了备用地址时, 单个地址的请求超时时间, 超时之后切换到下一个地址
+	MirrorTimeout string `yaml:"mirror-timeout"`
+	// Breaker alist 熔断配置
+	Breaker *Breaker `yaml:"breaker"`
+	// RateLimit alist 资源请求的限速配置
+	RateLimit *RateLimit `yaml:"rate-limit"`
+	// Accounts 多租户模式, 为指定的 emby 用户使用独立的 alist 账号解析直链
+	Accounts []*AlistAccount `yaml:"accounts"`
+
+	// userAccounts emby 用户 => 账号名称
+	userAccounts map[string]string
+	// accounts 账号名称 => 账号
+	accounts map[string]*AlistAccount
+	// mirrorTimeout 配置初始化转换之后的标准时间对象
+	mirrorTimeout time.Duration
+}
+
+// AlistAccount 独立的 alist 账号
+type AlistAccount struct {
+	// Name 账号名称, 用于日志和区分转码播放列表
+	Name string `yaml:"name"`
+	// Host 账号所在的 alist 访问地址, 不配置时使用 alist.host
+	Host string `yaml:"host"`
+	// Token 账号的 alist api key
+	Token string `yaml:"token"`
+	// Users 使用该账号的 emby 用户, 可以配置用户 id 或用户名
+	Users []string `yaml:"users"`
 }
 
 func (a *Alist) Init() error {
@@ -20,5 +51,160 @@ func (a *Alist) Init() error {
 	if strs.AnyEmpty(a.Host) {
 		return errors.New("alist.host 配置不能为空")
 	}
+	for i, mirror := range a.Mirrors {
+		if strs.AnyEmpty(mirror) {
+			return fmt.Errorf("alist.mirrors[%d] 配置不能为空", i)
+		}
+	}
+	a.mirrorTimeout = time.Second * 5
+	if strs.AllNotEmpty(a.MirrorTimeout) {
+		timeout, err := parseDuration(a.MirrorTimeout)
+		if err != nil {
+			return fmt.Errorf("alist.mirror-timeout 配置错误: %v", err)
+		}
+		a.mirrorTimeout = timeout
+	}
+	if a.Breaker == nil {
+		a.Breaker = new(Breaker)
+	}
+	if err := a.Breaker.Init(); err != nil {
+		return fmt.Errorf("alist.breaker 配置错误: %v", err)
+	}
+	if a.RateLimit == nil {
+		a.RateLimit = new(RateLimit)
+	}
+	if err := a.RateLimit.Init(); err != nil {
+		return fmt.Errorf("alist.rate-limit 配置错误: %v", err)
+	}
+
+	a.userAccounts = make(map[string]string)
+	a.accounts = make(map[string]*AlistAccount)
+	for i, account := range a.Accounts {
+		if account == nil || strs.AnyEmpty(account.Name, account.Token) {
+			return fmt.Errorf("alist.accounts[%d] 配置错误: name 和 token 不能为空", i)
+		}
+		if _, ok := a.accounts[account.Name]; ok {
+			return fmt.Errorf("alist.accounts[%d] 配置错误: 重复的账号名称: %s", i, account.Name)
+		}
+		if strs.AnyEmpty(account.Host) {
+			account.Host = a.Host
+		}
+		if len(account.Users) == 0 {
+			return fmt.Errorf("alist.accounts[%d] 配置错误: users 不能为空", i)
+		}
+		for _, user := range account.Users {
+			if owner, ok := a.userAccounts[user]; ok {
+				return fmt.Errorf("alist.accounts[%d] 配置错误: 用户 %s 已经关联了账号 %s", i, user, owner)
+			}
+			a.userAccounts[user] = account.Name
+		}
+		a.accounts[account.Name] = account
+	}
 	return nil
 }
+
+// AccountOf 按顺序匹配 emby 用户 (id 或用户名) 关联的 alist 账号名称
+//
+// 未匹配到时返回空, 表示使用默认账号
+func (a *Alist) AccountOf(users ...string) string {
+	for _, user := range users {
+		if name, ok := a.userAccounts[user]; ok && strs.AllNotEmpty(user) {
+			return name
+		}
+	}
+	return ""
+}
+
+// Credential 获取账号的 alist 访问地址和 api key, 账号不存在时返回默认配置
+func (a *Alist) Credential(account string) (host, token string) {
+	if acc, ok := a.accounts[account]; ok {
+		return acc.Host, acc.Token
+	}
+	return a.Host, a.Token
+}
+
+// HostsOf 获取访问地址及其备用地址, 按优先级排列
+//
+// 备用地址只对 alist.host 生效, 使用相同访问地址的账号共享备用地址
+func (a *Alist) HostsOf(host string) []string {
+	if host != a.Host || len(a.Mirrors) == 0 {
+		return []string{host}
+	}
+	return append([]string{a.Host}, a.Mirrors...)
+}
+
+// MirrorTimeoutDuration 获取配置了备用地址时单个地址的请求超时时间
+func (a *Alist) MirrorTimeoutDuration() time.Duration {
+	return a.mirrorTimeout
+}
+
+// Breaker 熔断配置
+type Breaker struct {
+	// Threshold 连续失败多少次后熔断, 配置为 0 表示不启用
+	Threshold int `yaml:"threshold"`
+	// Cooldown 熔断之后多久放行一次探测请求
+	Cooldown string `yaml:"cooldown"`
+
+	// cooldown 配置初始化转换之后的标准时间对象
+	cooldown time.Duration
+}
+
+// Init 配置初始化
+func (b *Breaker) Init() error {
+	if b.Threshold < 0 {
+		return fmt.Errorf("threshold 不能小于 0: %d", b.Threshold)
+	}
+	b.cooldown = time.Second * 30
+	if strs.AllNotEmpty(b.Cooldown) {
+		cooldown, err := parseDuration(b.Cooldown)
+		if err != nil {
+			return fmt.Errorf("cooldown 配置错误: %v", err)
+		}
+		b.cooldown = cooldown
+	}
+	return nil
+}
+
+// CooldownDuration 获取熔断冷却时间
+func (b *Breaker) CooldownDuration() time.Duration {
+	return b.cooldown
+}
+
+// RateLimit alist 资源请求的限速配置
+//
+// 短时间内大量请求直链和转码资源可能触发 alist 或网盘的风控, 超出限制的请求排队等待
+type RateLimit struct {
+	// QPS 所有资源请求每秒最多发出的个数, 0 表示不限制
+	QPS int `yaml:"qps"`
+	// Concurrency 每种清晰度 (原画单独计算) 同时进行的资源请求个数, 0 表示不限制
+	Concurrency int `yaml:"concurrency"`
+	// Timeout 排队等待的超时时间
+	Timeout string `yaml:"timeout"`
+
+	// timeout 配置初始化转换之后的标准时间对象
+	timeout time.Duration
+}
+
+// Init 配置初始化
+func (rl *RateLimit) Init() error {
+	if rl.QPS < 0 {
+		return fmt.Errorf("qps 不能小于 0: %d", rl.QPS)
+	}
+	if rl.Concurrency < 0 {
+		return fmt.Errorf("concurrency 不能小于 0: %d", rl.Concurrency)
+	}
+	rl.timeout = time.Second * 10
+	if strs.AllNotEmpty(rl.Timeout) {
+		timeout, err := parseDuration(rl.Timeout)
+		if err != nil {
+			return fmt.Errorf("timeout 配置错误: %v", err)
+		}
+		rl.timeout = timeout
+	}
+	return nil
+}
+
+// TimeoutDuration 获取排队等待的超时时间
+func (rl *RateLimit) TimeoutDuration() time.Duration {
+	return rl.timeout
+}
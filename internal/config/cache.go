@@ -3,46 +3,148 @@ package config
 import (
 	"fmt"
 	"log"
+	"regexp"
 	"strconv"
+	"strings"
 	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/crons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
 )
 
 // durationMap 字符串配置映射成 time.Duration
 var durationMap = map[string]time.Duration{
-	"d": time.Hour * 24,
-	"h": time.Hour,
-	"m": time.Minute,
-	"s": time.Second,
+	"d":  time.Hour * 24,
+	"h":  time.Hour,
+	"m":  time.Minute,
+	"s":  time.Second,
+	"ms": time.Millisecond,
+}
+
+// parseDuration 将形如 500ms, 10m, 1d 的配置字符串转换为 time.Duration
+func parseDuration(str string) (time.Duration, error) {
+	str = strings.TrimSpace(str)
+	if len(str) < 2 {
+		return 0, fmt.Errorf("时间格式错误: %s", str)
+	}
+	timeFlag, numStr := str[len(str)-1:], str[:len(str)-1]
+	if strings.HasSuffix(str, "ms") {
+		timeFlag, numStr = "ms", str[:len(str)-2]
+	}
+	duration, ok := durationMap[timeFlag]
+	if !ok {
+		return 0, fmt.Errorf("不支持的时间单位: %s, 支持的时间单位: ms, s, m, h, d", timeFlag)
+	}
+	base, err := strconv.Atoi(numStr)
+	if err != nil {
+		return 0, err
+	}
+	if base < 1 {
+		return 0, fmt.Errorf("时间值需大于 0: %d", base)
+	}
+	return time.Duration(base) * duration, nil
 }
 
 type Cache struct {
-	Enable  bool          `yaml:"enable"`  // 是否启用缓存
-	Expired string        `yaml:"expired"` // 缓存过期时间
-	expired time.Duration // 配置初始化转换之后的标准时间对象
+	Enable       bool                   `yaml:"enable"`        // 是否启用缓存
+	Expired      string                 `yaml:"expired"`       // 缓存过期时间
+	Jitter       int                    `yaml:"jitter"`        // 过期时间随机提前的最大百分比, 避免同时写入的缓存集中过期
+	MaxBodySize  string                 `yaml:"max-body-size"` // 允许缓存的最大响应体大小, 超出的响应直接透传, 为空表示不限制
+	LibraryWatch *LibraryWatch          `yaml:"library-watch"` // 媒体库变更监听配置
+	Infuse       *InfuseCache           `yaml:"infuse"`        // Infuse 同步媒体库的加速配置
+	HomeLists    *HomeListsCache        `yaml:"home-lists"`    // 首页继续观看和下一集列表的缓存配置
+	Watchdog     *MemWatchdog           `yaml:"watchdog"`      // 内存看门狗配置
+	Spaces       map[string]*CacheSpace `yaml:"spaces"`        // 各个缓存空间的单独配置, key 为缓存空间名称
+	CleanupCron  string                 `yaml:"cleanup-cron"`  // 集中维护 (全量清洗, 磁盘缓存清理, 存储压缩) 的触发时间, 为空表示按间隔持续维护
+	expired      time.Duration          // 配置初始化转换之后的标准时间对象
+	maxBodySize  int64                  // 配置初始化转换之后的字节数
+	cleanup      *crons.Schedule        // 配置初始化解析之后的 cron 表达式
 }
 
 func (c *Cache) ExpiredDuration() time.Duration {
 	return c.expired
 }
 
+// CleanupSchedule 获取集中维护的触发时间, 未配置时返回 nil
+func (c *Cache) CleanupSchedule() *crons.Schedule {
+	return c.cleanup
+}
+
+// MaxBodySizeBytes 获取允许缓存的最大响应体字节数, 0 表示不限制
+func (c *Cache) MaxBodySizeBytes() int64 {
+	return c.maxBodySize
+}
+
 func (c *Cache) Init() error {
 	if len(c.Expired) == 0 {
 		// 缓存默认过期时间一天
 		c.expired = time.Hour * 24
 	} else {
-		timeFlag := c.Expired[len(c.Expired)-1:]
-		duration, ok := durationMap[timeFlag]
-		if !ok {
-			return fmt.Errorf("cache.expired 配置错误: %s, 支持的时间单位: s, m, h, d", timeFlag)
-		}
-		base, err := strconv.Atoi(c.Expired[:len(c.Expired)-1])
+		expired, err := parseDuration(c.Expired)
 		if err != nil {
 			return fmt.Errorf("cache.expired 配置错误: %v", err)
 		}
-		if base < 1 {
-			return fmt.Errorf("cache.exipred 配置错误: %d, 值需大于 0", base)
+		c.expired = expired
+	}
+
+	if c.Jitter < 0 || c.Jitter > 50 {
+		return fmt.Errorf("cache.jitter 配置错误: %d, 允许配置范围: [0, 50]", c.Jitter)
+	}
+
+	c.maxBodySize = 0
+	if strs.AllNotEmpty(c.MaxBodySize) {
+		size, err := parseSize(c.MaxBodySize)
+		if err != nil {
+			return fmt.Errorf("cache.max-body-size 配置错误: %v", err)
+		}
+		c.maxBodySize = size
+	}
+
+	c.cleanup = nil
+	if strs.AllNotEmpty(c.CleanupCron) {
+		schedule, err := crons.Parse(c.CleanupCron)
+		if err != nil {
+			return fmt.Errorf("cache.cleanup-cron 配置错误: %v", err)
+		}
+		c.cleanup = schedule
+	}
+
+	if c.LibraryWatch == nil {
+		c.LibraryWatch = new(LibraryWatch)
+	}
+	if err := c.LibraryWatch.Init(); err != nil {
+		return fmt.Errorf("cache.library-watch 配置错误: %v", err)
+	}
+
+	if c.Infuse == nil {
+		c.Infuse = new(InfuseCache)
+	}
+	if err := c.Infuse.Init(); err != nil {
+		return fmt.Errorf("cache.infuse 配置错误: %v", err)
+	}
+
+	if c.HomeLists == nil {
+		c.HomeLists = new(HomeListsCache)
+	}
+	if err := c.HomeLists.Init(); err != nil {
+		return fmt.Errorf("cache.home-lists 配置错误: %v", err)
+	}
+
+	if c.Watchdog == nil {
+		c.Watchdog = new(MemWatchdog)
+	}
+	if err := c.Watchdog.Init(); err != nil {
+		return fmt.Errorf("cache.watchdog 配置错误: %v", err)
+	}
+
+	for name, space := range c.Spaces {
+		if space == nil {
+			space = new(CacheSpace)
+			c.Spaces[name] = space
+		}
+		if err := space.Init(); err != nil {
+			return fmt.Errorf("cache.spaces.%s 配置错误: %v", name, err)
 		}
-		c.expired = time.Duration(base) * duration
 	}
 
 	if c.Enable {
@@ -51,3 +153,185 @@ func (c *Cache) Init() error {
 
 	return nil
 }
+
+// SpaceMaxEntries 获取缓存空间最多保留的缓存个数, 0 表示不限制
+func (c *Cache) SpaceMaxEntries(space string) int {
+	if s, ok := c.Spaces[space]; ok && s != nil {
+		return s.MaxEntries
+	}
+	return 0
+}
+
+// CacheSpace 缓存空间的单独配置
+type CacheSpace struct {
+	// MaxEntries 缓存空间最多保留的缓存个数, 超出时淘汰最久未访问的缓存, 0 表示不限制
+	MaxEntries int `yaml:"max-entries"`
+}
+
+// Init 配置初始化
+func (cs *CacheSpace) Init() error {
+	if cs.MaxEntries < 0 {
+		return fmt.Errorf("max-entries 配置错误: %d, 不能小于 0", cs.MaxEntries)
+	}
+	return nil
+}
+
+// LibraryWatch 媒体库变更监听配置
+//
+// 媒体库发生变化时更新缓存版本, 缓存 key 中携带版本号, 使缓存在媒体库变化时立即失效
+type LibraryWatch struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Interval 轮询 emby 媒体库扫描任务的间隔
+	Interval string `yaml:"interval"`
+
+	// interval 配置初始化转换之后的标准时间对象
+	interval time.Duration
+}
+
+// Init 配置初始化
+func (lw *LibraryWatch) Init() error {
+	lw.interval = time.Minute * 5
+	if strs.AllNotEmpty(lw.Interval) {
+		interval, err := parseDuration(lw.Interval)
+		if err != nil {
+			return fmt.Errorf("interval 配置错误: %v", err)
+		}
+		lw.interval = interval
+	}
+	return nil
+}
+
+// IntervalDuration 获取轮询间隔
+func (lw *LibraryWatch) IntervalDuration() time.Duration {
+	return lw.interval
+}
+
+// infuseUARegex 匹配 Infuse 客户端的 User-Agent
+var infuseUARegex = regexp.MustCompile(`(?i)infuse`)
+
+// InfuseCache Infuse 同步媒体库的加速配置
+//
+// Infuse 同步媒体库时会发起大量的 Items/Images 请求, 启用后这些请求直接代理回源并使用较长的缓存时间
+type InfuseCache struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Expired Infuse 请求的缓存时间
+	Expired string `yaml:"expired"`
+
+	// expired 配置初始化转换之后的标准时间对象
+	expired time.Duration
+}
+
+// Init 配置初始化
+func (ic *InfuseCache) Init() error {
+	ic.expired = time.Hour * 6
+	if strs.AllNotEmpty(ic.Expired) {
+		expired, err := parseDuration(ic.Expired)
+		if err != nil {
+			return fmt.Errorf("expired 配置错误: %v", err)
+		}
+		ic.expired = expired
+	}
+	return nil
+}
+
+// ExpiredDuration 获取 Infuse 请求的缓存时间
+func (ic *InfuseCache) ExpiredDuration() time.Duration {
+	return ic.expired
+}
+
+// Match 判断是否启用了加速, 并且请求来自 Infuse 客户端
+func (ic *InfuseCache) Match(userAgent string) bool {
+	return ic.Enable && infuseUARegex.MatchString(userAgent)
+}
+
+// HomeListsCache 首页继续观看 (Items/Resume) 和下一集 (Shows/NextUp) 列表的缓存配置
+//
+// 客户端每次打开首页都会请求这两个接口, 启用后按用户短时间缓存响应, 代理的停止播放上报会使该用户的缓存失效
+type HomeListsCache struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Expired 列表的缓存时间
+	Expired string `yaml:"expired"`
+
+	// expired 配置初始化转换之后的标准时间对象
+	expired time.Duration
+}
+
+// Init 配置初始化
+func (hc *HomeListsCache) Init() error {
+	hc.expired = time.Second * 30
+	if strs.AllNotEmpty(hc.Expired) {
+		expired, err := parseDuration(hc.Expired)
+		if err != nil {
+			return fmt.Errorf("expired 配置错误: %v", err)
+		}
+		hc.expired = expired
+	}
+	return nil
+}
+
+// ExpiredDuration 获取列表的缓存时间
+func (hc *HomeListsCache) ExpiredDuration() time.Duration {
+	return hc.expired
+}
+
+// MemWatchdog 内存看门狗配置
+//
+// 定期检查进程的内存占用, 超出阈值时优先淘汰体积最大的缓存, 避免容器触发内存上限被杀死
+type MemWatchdog struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Limit 内存上限, 如: 512MB, 一般配置为容器的内存限制
+	Limit string `yaml:"limit"`
+	// Threshold 内存占用达到上限的百分之多少时开始淘汰缓存
+	Threshold int `yaml:"threshold"`
+	// Interval 检查内存占用的间隔
+	Interval string `yaml:"interval"`
+
+	// limit 配置初始化转换之后的字节数
+	limit int64
+	// interval 配置初始化转换之后的标准时间对象
+	interval time.Duration
+}
+
+// Init 配置初始化
+func (mw *MemWatchdog) Init() error {
+	if mw.Threshold == 0 {
+		mw.Threshold = 80
+	}
+	if mw.Threshold < 10 || mw.Threshold > 100 {
+		return fmt.Errorf("threshold 配置错误: %d, 允许配置范围: [10, 100]", mw.Threshold)
+	}
+	mw.interval = time.Second * 10
+	if strs.AllNotEmpty(mw.Interval) {
+		interval, err := parseDuration(mw.Interval)
+		if err != nil {
+			return fmt.Errorf("interval 配置错误: %v", err)
+		}
+		mw.interval = interval
+	}
+	if !mw.Enable {
+		return nil
+	}
+	if strs.AnyEmpty(mw.Limit) {
+		return fmt.Errorf("启用时 limit 不能为空")
+	}
+	limit, err := parseSize(mw.Limit)
+	if err != nil {
+		return fmt.Errorf("limit 配置错误: %v", err)
+	}
+	mw.limit = limit
+	return nil
+}
+
+// ThresholdBytes 获取开始淘汰缓存的内存占用 (Byte)
+func (mw *MemWatchdog) ThresholdBytes() int64 {
+	return mw.limit * int64(mw.Threshold) / 100
+}
+
+// IntervalDuration 获取检查内存占用的间隔
+func (mw *MemWatchdog) IntervalDuration() time.Duration {
+	return mw.interval
+}
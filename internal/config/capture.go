@@ -0,0 +1,72 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// Capture 请求录制配置, 将指定路由的请求和响应 (已脱敏) 记录到内存中, 通过管理接口导出为 HAR/JSONL 文件
+type Capture struct {
+	// Enable 启动时是否开启录制, 运行时可以通过管理接口切换
+	Enable bool `yaml:"enable"`
+	// Routes 需要录制的路由, 匹配请求 RequestURI 的正则表达式, 为空时录制所有请求
+	Routes []string `yaml:"routes"`
+	// MaxEntries 最多保留多少条记录, 超出时淘汰最早的记录
+	MaxEntries int `yaml:"max-entries"`
+	// MaxBodySize 请求体和响应体最多记录多少字节, 超出的部分会被截断
+	MaxBodySize string `yaml:"max-body-size"`
+
+	// routes 编译之后的路由正则表达式
+	routes []*regexp.Regexp
+	// maxBodySize 配置初始化转换之后的字节数
+	maxBodySize int64
+}
+
+// Init 配置初始化
+func (cc *Capture) Init() error {
+	cc.routes = make([]*regexp.Regexp, 0, len(cc.Routes))
+	for _, r := range cc.Routes {
+		reg, err := regexp.Compile(r)
+		if err != nil {
+			return fmt.Errorf("routes 正则表达式编译失败: %s, err: %v", r, err)
+		}
+		cc.routes = append(cc.routes, reg)
+	}
+
+	if cc.MaxEntries == 0 {
+		cc.MaxEntries = 200
+	}
+	if cc.MaxEntries < 0 {
+		return fmt.Errorf("max-entries 配置错误: %d", cc.MaxEntries)
+	}
+
+	if strs.AnyEmpty(cc.MaxBodySize) {
+		cc.MaxBodySize = "64KB"
+	}
+	size, err := parseSize(cc.MaxBodySize)
+	if err != nil {
+		return fmt.Errorf("max-body-size 配置错误: %v", err)
+	}
+	cc.maxBodySize = size
+	return nil
+}
+
+// Match 判断请求是否需要录制
+func (cc *Capture) Match(uri string) bool {
+	if len(cc.routes) == 0 {
+		return true
+	}
+	for _, reg := range cc.routes {
+		if reg.MatchString(uri) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxBodySizeBytes 获取请求体和响应体的最大记录字节数
+func (cc *Capture) MaxBodySizeBytes() int64 {
+	return cc.maxBodySize
+}
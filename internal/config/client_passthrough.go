@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// versionConstraintRegex 版本约束的格式, 如: >=4.8.0, <4.8.3, 4.8.1
+var versionConstraintRegex = regexp.MustCompile(`^(>=|<=|!=|==|=|>|<)?\s*v?(\d+(\.\d+)*([-.+][0-9A-Za-z.-]+)?)$`)
+
+// ClientPassthrough 客户端直通配置
+//
+// 新版本的客户端偶尔会因为改写之后的 PlaybackInfo 等响应无法播放,
+// 为匹配的客户端版本关闭所有的改写逻辑, 请求原样转发到源服务器, 等待兼容修复发布之后再移除规则
+type ClientPassthrough struct {
+	// Rules 直通规则, 满足任意一条即直通
+	Rules []*ClientPassthroughRule `yaml:"rules"`
+}
+
+// ClientPassthroughRule 客户端直通规则
+type ClientPassthroughRule struct {
+	// Client 客户端名称 (X-Emby-Client), 完整匹配, 不区分大小写
+	Client string `yaml:"client"`
+	// Versions 客户端版本范围, 多个约束使用逗号分隔, 需要同时满足; 为空时匹配该客户端的所有版本
+	Versions string `yaml:"versions"`
+	// Reason 直通原因, 用于输出日志
+	Reason string `yaml:"reason"`
+
+	// constraints 解析之后的版本约束
+	constraints []VersionConstraint
+}
+
+// VersionConstraint 版本约束
+type VersionConstraint struct {
+	// Op 比较运算符: >=, <=, >, <, =, !=
+	Op string
+	// Version 参与比较的版本号
+	Version string
+}
+
+// Init 配置初始化
+func (cp *ClientPassthrough) Init() error {
+	for i, rule := range cp.Rules {
+		if rule == nil {
+			return fmt.Errorf("client-passthrough.rules[%d] 配置不能为空", i)
+		}
+		if err := rule.init(); err != nil {
+			return fmt.Errorf("client-passthrough.rules[%d] 配置错误: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// init 初始化规则, 解析版本范围
+func (r *ClientPassthroughRule) init() error {
+	r.Client = strings.TrimSpace(r.Client)
+	if strs.AnyEmpty(r.Client) {
+		return fmt.Errorf("client 不能为空")
+	}
+
+	r.constraints = make([]VersionConstraint, 0)
+	for _, raw := range strings.Split(r.Versions, ",") {
+		if raw = strings.TrimSpace(raw); raw == "" {
+			continue
+		}
+		matches := versionConstraintRegex.FindStringSubmatch(raw)
+		if matches == nil {
+			return fmt.Errorf("versions 格式错误: %s, 示例: >=4.8.0, <4.8.3", raw)
+		}
+		op := matches[1]
+		switch op {
+		case "", "==":
+			op = "="
+		}
+		r.constraints = append(r.constraints, VersionConstraint{Op: op, Version: matches[2]})
+	}
+	return nil
+}
+
+// Match 判断客户端名称是否与规则一致
+func (r *ClientPassthroughRule) Match(client string) bool {
+	return strings.EqualFold(strings.TrimSpace(client), r.Client)
+}
+
+// Constraints 获取规则的版本约束, 为空时表示匹配所有版本
+func (r *ClientPassthroughRule) Constraints() []VersionConstraint {
+	return r.constraints
+}
@@ -0,0 +1,74 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// Cluster 集群模式配置
+//
+// 多个副本部署在负载均衡之后时, 通过 redis 共享缓存和会话注册表, 使所有副本的行为保持一致
+type Cluster struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Node 当前副本的名称, 用于日志区分, 为空时使用主机名
+	Node string `yaml:"node"`
+	// Redis redis 连接配置
+	Redis *ClusterRedis `yaml:"redis"`
+	// Prefix 所有 key 的前缀, 多个集群共用一个 redis 时需要区分
+	Prefix string `yaml:"prefix"`
+}
+
+// ClusterRedis redis 连接配置
+type ClusterRedis struct {
+	// Addr redis 地址, 如: 127.0.0.1:6379
+	Addr string `yaml:"addr"`
+	// Password redis 密码
+	Password string `yaml:"password"`
+	// DB 使用的数据库编号
+	DB int `yaml:"db"`
+	// Timeout 单个命令的超时时间
+	Timeout string `yaml:"timeout"`
+
+	// timeout 配置初始化转换之后的标准时间对象
+	timeout time.Duration
+}
+
+// Init 配置初始化
+func (c *Cluster) Init() error {
+	if c.Redis == nil {
+		c.Redis = new(ClusterRedis)
+	}
+	if strs.AnyEmpty(c.Prefix) {
+		c.Prefix = "go-emby2alist:"
+	}
+	if strs.AnyEmpty(c.Node) {
+		c.Node, _ = os.Hostname()
+	}
+	if !c.Enable {
+		return nil
+	}
+	if strs.AnyEmpty(c.Redis.Addr) {
+		return fmt.Errorf("cluster.redis.addr 不能为空")
+	}
+	if c.Redis.DB < 0 {
+		return fmt.Errorf("cluster.redis.db 不能小于 0: %d", c.Redis.DB)
+	}
+	c.Redis.timeout = time.Second * 2
+	if strs.AllNotEmpty(c.Redis.Timeout) {
+		timeout, err := parseDuration(c.Redis.Timeout)
+		if err != nil {
+			return fmt.Errorf("cluster.redis.timeout 配置错误: %v", err)
+		}
+		c.Redis.timeout = timeout
+	}
+	return nil
+}
+
+// TimeoutDuration 获取单个命令的超时时间
+func (cr *ClusterRedis) TimeoutDuration() time.Duration {
+	return cr.timeout
+}
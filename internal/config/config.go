@@ -18,12 +18,72 @@ type Config struct {
 	VideoPreview *VideoPreview `yaml:"video-preview"`
 	// Path 路径相关配置
 	Path *Path `yaml:"path"`
+	// Rewrite 请求重写配置
+	Rewrite *Rewrite `yaml:"rewrite"`
+	// Routes 自定义路由配置
+	Routes *Routes `yaml:"routes"`
+	// Resolve 直链解析配置
+	Resolve *Resolve `yaml:"resolve"`
+	// Geo 根据客户端地区选择播放链接
+	Geo *Geo `yaml:"geo"`
+	// Probe 客户端带宽测速配置
+	Probe *Probe `yaml:"probe"`
+	// Warmup 继续观看列表的定时预解析配置
+	Warmup *Warmup `yaml:"warmup"`
+	// WatchedSync 网盘播放记录同步配置
+	WatchedSync *WatchedSync `yaml:"watched-sync"`
+	// ItemTags 根据 item 标签调整代理行为的配置
+	ItemTags *ItemTags `yaml:"item-tags"`
+	// StreamLimit 用户并发串流数限制
+	StreamLimit *StreamLimit `yaml:"stream-limit"`
+	// Throttle 代理串流的带宽限制
+	Throttle *Throttle `yaml:"throttle"`
+	// LegacyClient 旧设备兼容配置
+	LegacyClient *LegacyClient `yaml:"legacy-client"`
+	// ClientPassthrough 客户端直通配置
+	ClientPassthrough *ClientPassthrough `yaml:"client-passthrough"`
+	// PlaybackFallback 直链播放失败时的降级配置
+	PlaybackFallback *PlaybackFallback `yaml:"playback-fallback"`
+	// MaxResolution 用户的最大分辨率/码率限制
+	MaxResolution *MaxResolution `yaml:"max-resolution"`
+	// Language 用户的音轨/字幕语言偏好
+	Language *Language `yaml:"language"`
 	// Cache 缓存相关配置
 	Cache *Cache `yaml:"cache"`
+	// Trickplay 进度条预览图缓存配置
+	Trickplay *Trickplay `yaml:"trickplay"`
+	// DiskCache 磁盘缓存清理配置
+	DiskCache *DiskCache `yaml:"disk-cache"`
+	// Feed 最近添加的媒体订阅源配置
+	Feed *Feed `yaml:"feed"`
+	// Webdav 只读的 WebDAV 服务配置
+	Webdav *Webdav `yaml:"webdav"`
+	// Startup 启动配置
+	Startup *Startup `yaml:"startup"`
+	// Server 本程序 http/https 服务的防护配置
+	Server *Server `yaml:"server"`
 	// Ssl ssl 相关配置
 	Ssl *Ssl `yaml:"ssl"`
 	// Log 日志相关配置
 	Log *Log `yaml:"log"`
+	// Notify 异常通知配置
+	Notify *Notify `yaml:"notify"`
+	// Hooks 事件钩子配置
+	Hooks *Hooks `yaml:"hooks"`
+	// Admin 管理接口配置
+	Admin *Admin `yaml:"admin"`
+	// Sentry 异常上报配置
+	Sentry *Sentry `yaml:"sentry"`
+	// Shadow 请求影子配置
+	Shadow *Shadow `yaml:"shadow"`
+	// Network 出站网络配置
+	Network *Network `yaml:"network"`
+	// Cluster 集群模式配置
+	Cluster *Cluster `yaml:"cluster"`
+	// Update 版本检查和自动更新配置
+	Update *Update `yaml:"update"`
+	// Ffprobe ffprobe 程序管理配置
+	Ffprobe *Ffprobe `yaml:"ffprobe"`
 }
 
 // C 全局唯一配置对象
@@ -47,7 +107,26 @@ func ReadFromFile(path string) error {
 	if err = initBasePath(path); err != nil {
 		return fmt.Errorf("初始化 BasePath 失败: %v", err)
 	}
+	return parse(bytes)
+}
+
+// ReadFromBytes 从 yaml 字节中读取配置, 用于将程序嵌入到其他服务中
+//
+// basePath 为缓存等数据文件的存放目录, 为空时使用当前工作目录
+func ReadFromBytes(bytes []byte, basePath string) error {
+	if basePath == "" {
+		basePath = "."
+	}
+	absPath, err := filepath.Abs(basePath)
+	if err != nil {
+		return fmt.Errorf("初始化 BasePath 失败: %v", err)
+	}
+	BasePath = absPath
+	return parse(bytes)
+}
 
+// parse 解析配置内容, 并初始化所有的配置项
+func parse(bytes []byte) error {
 	C = new(Config)
 	if err := yaml.Unmarshal(bytes, C); err != nil {
 		return fmt.Errorf("解析配置文件失败: %v", err)
@@ -71,6 +150,7 @@ func ReadFromFile(path string) error {
 		}
 	}
 
+	refreshSecrets(C)
 	return nil
 }
 
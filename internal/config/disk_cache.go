@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// DiskCache 磁盘缓存清理配置, 对所有写入磁盘的缓存 (如 trickplay 预览图) 生效
+//
+// 除了各个缓存自身的过期时间之外, 还会在磁盘剩余空间不足时从最早的缓存文件开始淘汰,
+// 避免缓存写满宿主机磁盘
+type DiskCache struct {
+	// MinFree 缓存所在磁盘的最低剩余空间, 如: 2GB, 为空表示不限制
+	MinFree string `yaml:"min-free"`
+	// Interval 清理间隔
+	Interval string `yaml:"interval"`
+
+	// minFree 配置初始化转换之后的字节数
+	minFree int64
+	// interval 配置初始化转换之后的标准时间对象
+	interval time.Duration
+}
+
+// Init 配置初始化
+func (dc *DiskCache) Init() error {
+	if strs.AllNotEmpty(dc.MinFree) {
+		minFree, err := parseSize(dc.MinFree)
+		if err != nil {
+			return fmt.Errorf("disk-cache.min-free 配置错误: %v", err)
+		}
+		dc.minFree = minFree
+	}
+
+	dc.interval = time.Minute * 10
+	if strs.AllNotEmpty(dc.Interval) {
+		interval, err := parseDuration(dc.Interval)
+		if err != nil {
+			return fmt.Errorf("disk-cache.interval 配置错误: %v", err)
+		}
+		dc.interval = interval
+	}
+	return nil
+}
+
+// MinFreeBytes 获取缓存所在磁盘的最低剩余空间, 0 表示不限制
+func (dc *DiskCache) MinFreeBytes() int64 {
+	return dc.minFree
+}
+
+// IntervalDuration 获取清理间隔
+func (dc *DiskCache) IntervalDuration() time.Duration {
+	return dc.interval
+}
@@ -3,7 +3,10 @@ package config
 import (
 	"errors"
 	"fmt"
+	"net"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
 )
@@ -11,13 +14,28 @@ import (
 type PeStrategy string
 
 const (
-	StrategyOrigin PeStrategy = "origin" // 回源
-	StrategyReject PeStrategy = "reject" // 拒绝请求
+	StrategyOrigin PeStrategy = "origin"      // 回源
+	StrategyReject PeStrategy = "reject"      // 拒绝请求
+	StrategyStale  PeStrategy = "stale-cache" // 返回最近一次成功的响应, 没有可用响应时回源
 )
 
 // validPeStrategy 用于校验用户配置的策略是否合法
 var validPeStrategy = map[PeStrategy]struct{}{
-	StrategyOrigin: {}, StrategyReject: {},
+	StrategyOrigin: {}, StrategyReject: {}, StrategyStale: {},
+}
+
+// DiscStrategy 光盘原盘 (ISO/BDMV) 资源的播放策略
+type DiscStrategy string
+
+const (
+	DiscDirect DiscStrategy = "direct" // 与普通资源一致, 重定向到直链
+	DiscOrigin DiscStrategy = "origin" // 保留 emby 转码, 由源服务器串流
+	DiscM2ts   DiscStrategy = "m2ts"   // 重定向到原盘中最大的 m2ts 文件直链
+)
+
+// validDiscStrategy 用于校验用户配置的原盘播放策略是否合法
+var validDiscStrategy = map[DiscStrategy]struct{}{
+	DiscDirect: {}, DiscOrigin: {}, DiscM2ts: {},
 }
 
 // Emby 相关配置
@@ -36,8 +54,32 @@ type Emby struct {
 	ProxyErrorStrategy PeStrategy `yaml:"proxy-error-strategy"`
 	// ImagesQuality 图片质量
 	ImagesQuality int `yaml:"images-quality"`
+	// ImagesRules 按照用户或客户端覆盖图片质量和最大宽度, 自上而下匹配第一个规则
+	ImagesRules []*ImagesRule `yaml:"images-rules"`
+	// ImagesPrefetch 首页图片预取配置
+	ImagesPrefetch *ImagesPrefetch `yaml:"images-prefetch"`
+	// RemoteImages 远程图片代理配置
+	RemoteImages *RemoteImages `yaml:"remote-images"`
+	// LocaleSort 按名称排序的 Items 列表的本地化重排序配置
+	LocaleSort *LocaleSort `yaml:"locale-sort"`
+	// JsonPatch 只改写响应中少量字符串字段时, 直接替换原始响应的字节, 不完整解析和序列化整个 json
+	JsonPatch bool `yaml:"json-patch"`
+	// DryRun PlaybackInfo 演练模式, 原样返回源服务器的响应, 只在日志中输出改写结果
+	DryRun bool `yaml:"dry-run"`
+	// DiscStrategy 光盘原盘 (ISO/BDMV) 资源的播放策略
+	DiscStrategy DiscStrategy `yaml:"disc-strategy"`
 	// Strm strm 配置
 	Strm *Strm `yaml:"strm"`
+	// ReportReplay 播放状态上报失败重放配置
+	ReportReplay *ReportReplay `yaml:"report-replay"`
+	// StaleCache 过期响应兜底配置, proxy-error-strategy 为 stale-cache 时生效
+	StaleCache *StaleCache `yaml:"stale-cache"`
+	// Kodi Emby for Kodi 兼容配置
+	Kodi *Kodi `yaml:"kodi"`
+	// SubtitleBurnIn 特效字幕烧录配置
+	SubtitleBurnIn *SubtitleBurnIn `yaml:"subtitle-burn-in"`
+	// Wake 源服务器休眠时的唤醒配置
+	Wake *EmbyWake `yaml:"wake"`
 }
 
 func (e *Emby) Init() error {
@@ -67,6 +109,40 @@ func (e *Emby) Init() error {
 	if e.ImagesQuality < 0 || e.ImagesQuality > 100 {
 		return fmt.Errorf("emby.images-quality 配置错误: %d, 允许配置范围: [1, 100]", e.ImagesQuality)
 	}
+	for i, rule := range e.ImagesRules {
+		if rule == nil {
+			return fmt.Errorf("emby.images-rules[%d] 配置不能为空", i)
+		}
+		if err := rule.Init(); err != nil {
+			return fmt.Errorf("emby.images-rules[%d] 配置错误: %v", i, err)
+		}
+	}
+	if e.ImagesPrefetch == nil {
+		e.ImagesPrefetch = new(ImagesPrefetch)
+	}
+	if err := e.ImagesPrefetch.Init(); err != nil {
+		return fmt.Errorf("emby.images-prefetch 配置错误: %v", err)
+	}
+	if e.RemoteImages == nil {
+		e.RemoteImages = new(RemoteImages)
+	}
+	if err := e.RemoteImages.Init(); err != nil {
+		return fmt.Errorf("emby.remote-images 配置错误: %v", err)
+	}
+	if e.LocaleSort == nil {
+		e.LocaleSort = new(LocaleSort)
+	}
+	if err := e.LocaleSort.Init(); err != nil {
+		return fmt.Errorf("emby.locale-sort 配置错误: %v", err)
+	}
+
+	e.DiscStrategy = DiscStrategy(strings.ToLower(strings.TrimSpace(string(e.DiscStrategy))))
+	if strs.AnyEmpty(string(e.DiscStrategy)) {
+		e.DiscStrategy = DiscDirect
+	}
+	if _, ok := validDiscStrategy[e.DiscStrategy]; !ok {
+		return fmt.Errorf("emby.disc-strategy 配置错误: %s", e.DiscStrategy)
+	}
 
 	if e.Strm == nil {
 		e.Strm = new(Strm)
@@ -75,9 +151,104 @@ func (e *Emby) Init() error {
 		return fmt.Errorf("emby.strm 配置错误: %v", err)
 	}
 
+	if e.ReportReplay == nil {
+		e.ReportReplay = new(ReportReplay)
+	}
+	if err := e.ReportReplay.Init(); err != nil {
+		return fmt.Errorf("emby.report-replay 配置错误: %v", err)
+	}
+
+	if e.StaleCache == nil {
+		e.StaleCache = new(StaleCache)
+	}
+	if err := e.StaleCache.Init(); err != nil {
+		return fmt.Errorf("emby.stale-cache 配置错误: %v", err)
+	}
+
+	if e.Kodi == nil {
+		e.Kodi = new(Kodi)
+	}
+
+	if e.SubtitleBurnIn == nil {
+		e.SubtitleBurnIn = new(SubtitleBurnIn)
+	}
+	if err := e.SubtitleBurnIn.Init(); err != nil {
+		return fmt.Errorf("emby.subtitle-burn-in 配置错误: %v", err)
+	}
+
+	if e.Wake == nil {
+		e.Wake = new(EmbyWake)
+	}
+	if err := e.Wake.Init(); err != nil {
+		return fmt.Errorf("emby.wake 配置错误: %v", err)
+	}
+
+	return nil
+}
+
+// Kodi Emby for Kodi 兼容配置
+//
+// Kodi 客户端的 Items 响应始终原样透传, 不添加转码版本等改写内容
+type Kodi struct {
+	// DirectPath 是否将响应中的媒体路径改写为本程序的直链地址,
+	// 供 Kodi 的原生模式 (路径替换) 直接播放
+	DirectPath bool `yaml:"direct-path"`
+}
+
+// SubtitleBurnIn 特效字幕烧录配置
+//
+// 部分客户端完全无法渲染 ASS 等特效字幕, 匹配的客户端播放带有这类字幕的资源时,
+// PlaybackInfo 原样代理到源服务器, 保留 emby 根据客户端能力给出的烧录字幕转码配置
+type SubtitleBurnIn struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Clients 需要烧录字幕的客户端名称关键字 (不区分大小写)
+	Clients []string `yaml:"clients"`
+	// Codecs 需要烧录的字幕格式, 默认 ass, ssa
+	Codecs []string `yaml:"codecs"`
+}
+
+// Init 配置初始化
+func (sb *SubtitleBurnIn) Init() error {
+	clients := make([]string, 0, len(sb.Clients))
+	for _, client := range sb.Clients {
+		if client = strings.ToLower(strings.TrimSpace(client)); client != "" {
+			clients = append(clients, client)
+		}
+	}
+	sb.Clients = clients
+	if sb.Enable && len(sb.Clients) == 0 {
+		return fmt.Errorf("clients 配置不能为空")
+	}
+
+	if len(sb.Codecs) == 0 {
+		sb.Codecs = []string{"ass", "ssa"}
+	}
+	for i, codec := range sb.Codecs {
+		sb.Codecs[i] = strings.ToLower(strings.TrimSpace(codec))
+	}
 	return nil
 }
 
+// Match 判断客户端是否需要烧录字幕
+func (sb *SubtitleBurnIn) Match(client string) bool {
+	if !sb.Enable {
+		return false
+	}
+	client = strings.ToLower(client)
+	for _, keyword := range sb.Clients {
+		if strings.Contains(client, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// CodecValid 判断字幕格式是否需要烧录
+func (sb *SubtitleBurnIn) CodecValid(codec string) bool {
+	return slices.Contains(sb.Codecs, strings.ToLower(codec))
+}
+
 // Strm strm 配置
 type Strm struct {
 	// PathMap 远程路径映射
@@ -110,3 +281,163 @@ func (s *Strm) MapPath(path string) string {
 	}
 	return path
 }
+
+// ReportReplay 播放状态上报失败重放配置
+//
+// emby 短暂不可用时, 客户端的播放进度、停止播放上报会丢失, 导致观看状态不准确,
+// 启用后将上报失败的请求保存到磁盘, 待 emby 恢复后按顺序重放
+type ReportReplay struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// MaxSize 最多保存多少个上报请求, 超出时丢弃最早的请求
+	MaxSize int `yaml:"max-size"`
+	// MaxAge 上报请求的最长保存时间, 超出时间的请求不再重放
+	MaxAge string `yaml:"max-age"`
+	// Interval 尝试重放的间隔
+	Interval string `yaml:"interval"`
+
+	// maxAge 配置初始化转换之后的标准时间对象
+	maxAge time.Duration
+	// interval 配置初始化转换之后的标准时间对象
+	interval time.Duration
+}
+
+// Init 配置初始化
+func (rr *ReportReplay) Init() error {
+	if rr.MaxSize < 0 {
+		return fmt.Errorf("max-size 不能小于 0: %d", rr.MaxSize)
+	}
+	if rr.MaxSize == 0 {
+		rr.MaxSize = 500
+	}
+
+	rr.maxAge = time.Hour * 24 * 7
+	if strs.AllNotEmpty(rr.MaxAge) {
+		maxAge, err := parseDuration(rr.MaxAge)
+		if err != nil {
+			return fmt.Errorf("max-age 配置错误: %v", err)
+		}
+		rr.maxAge = maxAge
+	}
+
+	rr.interval = time.Second * 30
+	if strs.AllNotEmpty(rr.Interval) {
+		interval, err := parseDuration(rr.Interval)
+		if err != nil {
+			return fmt.Errorf("interval 配置错误: %v", err)
+		}
+		rr.interval = interval
+	}
+	return nil
+}
+
+// MaxAgeDuration 获取上报请求的最长保存时间
+func (rr *ReportReplay) MaxAgeDuration() time.Duration {
+	return rr.maxAge
+}
+
+// IntervalDuration 获取尝试重放的间隔
+func (rr *ReportReplay) IntervalDuration() time.Duration {
+	return rr.interval
+}
+
+// StaleCache 过期响应兜底配置
+//
+// 记录只读接口 (GET) 最近一次成功的 json 响应, emby 不可用时返回记录的响应, 使客户端可以继续浏览媒体库
+type StaleCache struct {
+	// MaxSize 最多记录多少个响应, 超出时丢弃最早的记录
+	MaxSize int `yaml:"max-size"`
+	// MaxAge 响应记录的最长保存时间, 超出时间的记录不再返回
+	MaxAge string `yaml:"max-age"`
+
+	// maxAge 配置初始化转换之后的标准时间对象
+	maxAge time.Duration
+}
+
+// Init 配置初始化
+func (sc *StaleCache) Init() error {
+	if sc.MaxSize < 0 {
+		return fmt.Errorf("max-size 不能小于 0: %d", sc.MaxSize)
+	}
+	if sc.MaxSize == 0 {
+		sc.MaxSize = 2000
+	}
+
+	sc.maxAge = time.Hour * 24
+	if strs.AllNotEmpty(sc.MaxAge) {
+		maxAge, err := parseDuration(sc.MaxAge)
+		if err != nil {
+			return fmt.Errorf("max-age 配置错误: %v", err)
+		}
+		sc.maxAge = maxAge
+	}
+	return nil
+}
+
+// MaxAgeDuration 获取响应记录的最长保存时间
+func (sc *StaleCache) MaxAgeDuration() time.Duration {
+	return sc.maxAge
+}
+
+// EmbyWake 源服务器休眠时的唤醒配置
+//
+// 请求到达时如果源服务器不可达, 发送网络唤醒 (WoL) 数据包或者请求唤醒 webhook,
+// 并在等待时间窗口内等待源服务器恢复, 避免休眠期间的第一个请求直接失败
+type EmbyWake struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Mac 源服务器网卡的 MAC 地址, 配置后发送 WoL 数据包
+	Mac string `yaml:"mac"`
+	// Broadcast WoL 数据包的广播地址, 默认 255.255.255.255:9
+	Broadcast string `yaml:"broadcast"`
+	// Webhook 唤醒 webhook 地址, 配置后以 POST 请求触发
+	Webhook string `yaml:"webhook"`
+	// Window 发送唤醒信号后等待源服务器可用的最长时间, 默认 60s
+	Window string `yaml:"window"`
+
+	// mac 解析之后的 MAC 地址
+	mac net.HardwareAddr
+	// window 配置初始化转换之后的标准时间对象
+	window time.Duration
+}
+
+// Init 配置初始化
+func (ew *EmbyWake) Init() error {
+	if strs.AnyEmpty(ew.Broadcast) {
+		ew.Broadcast = "255.255.255.255:9"
+	}
+	if _, _, err := net.SplitHostPort(ew.Broadcast); err != nil {
+		return fmt.Errorf("broadcast 配置错误: %v", err)
+	}
+
+	if strs.AllNotEmpty(ew.Mac) {
+		mac, err := net.ParseMAC(ew.Mac)
+		if err != nil {
+			return fmt.Errorf("mac 配置错误: %v", err)
+		}
+		ew.mac = mac
+	}
+	if ew.Enable && ew.mac == nil && strs.AnyEmpty(ew.Webhook) {
+		return errors.New("启用时 mac 和 webhook 至少需要配置一个")
+	}
+
+	ew.window = time.Second * 60
+	if strs.AllNotEmpty(ew.Window) {
+		window, err := parseDuration(ew.Window)
+		if err != nil {
+			return fmt.Errorf("window 配置错误: %v", err)
+		}
+		ew.window = window
+	}
+	return nil
+}
+
+// HardwareAddr 获取源服务器网卡的 MAC 地址, 未配置时返回 nil
+func (ew *EmbyWake) HardwareAddr() net.HardwareAddr {
+	return ew.mac
+}
+
+// WindowDuration 获取等待源服务器可用的最长时间
+func (ew *EmbyWake) WindowDuration() time.Duration {
+	return ew.window
+}
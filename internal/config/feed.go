@@ -0,0 +1,86 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/idcodec"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// Feed 最近添加的媒体订阅源配置
+//
+// 启用后可以通过 /feeds/recent.json 或 /feeds/recent.rss 获取最近添加的媒体,
+// 订阅源中的链接指向本程序的直链接口, 外部程序无需 emby 的鉴权信息
+type Feed struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Token 访问订阅源的密钥, 通过 query 参数 token 传递
+	Token string `yaml:"token"`
+	// Limit 订阅源中最多返回的媒体个数
+	Limit int `yaml:"limit"`
+	// ItemTypes 订阅源包含的媒体类型, 多个类型使用英文逗号分隔
+	ItemTypes string `yaml:"item-types"`
+	// Obfuscation 订阅源和导出链接中的 item id 混淆配置
+	Obfuscation *IdObfuscation `yaml:"obfuscation"`
+}
+
+// IdObfuscation item id 混淆配置
+//
+// 启用后订阅源和导出文件中的链接不再包含原始的 emby item id, 直链接口也不再接受原始 id
+type IdObfuscation struct {
+	// Codec 使用的混淆器, 为空表示不混淆, 内置: aes
+	Codec string `yaml:"codec"`
+	// Key 混淆密钥, 修改后之前分享的链接全部失效
+	Key string `yaml:"key"`
+
+	// codec 初始化之后的混淆器
+	codec idcodec.Codec
+}
+
+// Init 配置初始化
+func (ido *IdObfuscation) Init() error {
+	ido.Codec = strings.ToLower(strings.TrimSpace(ido.Codec))
+	if strs.AnyEmpty(ido.Codec) {
+		return nil
+	}
+	codec, err := idcodec.New(ido.Codec, ido.Key)
+	if err != nil {
+		return fmt.Errorf("codec 初始化失败: %v", err)
+	}
+	ido.codec = codec
+	return nil
+}
+
+// IdCodec 获取混淆器, 未启用混淆时返回 nil
+func (ido *IdObfuscation) IdCodec() idcodec.Codec {
+	return ido.codec
+}
+
+// Init 配置初始化
+func (f *Feed) Init() error {
+	if f.Limit == 0 {
+		f.Limit = 30
+	}
+	if f.Limit < 0 || f.Limit > 200 {
+		return fmt.Errorf("feed.limit 配置错误: %d, 允许配置范围: [1, 200]", f.Limit)
+	}
+
+	f.ItemTypes = strings.ReplaceAll(f.ItemTypes, " ", "")
+	if strs.AnyEmpty(f.ItemTypes) {
+		f.ItemTypes = "Movie,Episode"
+	}
+
+	if f.Enable && strs.AnyEmpty(f.Token) {
+		return errors.New("feed.token 不能为空")
+	}
+
+	if f.Obfuscation == nil {
+		f.Obfuscation = new(IdObfuscation)
+	}
+	if err := f.Obfuscation.Init(); err != nil {
+		return fmt.Errorf("feed.obfuscation 配置错误: %v", err)
+	}
+	return nil
+}
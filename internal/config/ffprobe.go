@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// FfprobeDir 自动下载的 ffprobe 存放目录, 位于配置文件所在目录下
+const FfprobeDir = "bin"
+
+// sha256Regex 校验 sha256 格式
+var sha256Regex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// Ffprobe ffprobe 程序管理配置, 部分功能需要使用 ffprobe 探测媒体信息
+type Ffprobe struct {
+	// Path 手动指定 ffprobe 程序路径, 配置后不再查找和下载
+	Path string `yaml:"path"`
+	// Download 本地找不到 ffprobe 时, 是否按照 sources 自动下载当前平台的静态版本
+	Download bool `yaml:"download"`
+	// Sources 各个平台的下载地址, key 为 系统/架构, 如: linux/amd64, linux/arm64, windows/amd64
+	Sources map[string]*FfprobeSource `yaml:"sources"`
+}
+
+// FfprobeSource 单个平台的 ffprobe 下载配置
+type FfprobeSource struct {
+	// Url 下载地址, 支持 ffprobe 程序本身以及包含 ffprobe 的 .tar.gz, .zip 压缩包
+	Url string `yaml:"url"`
+	// Sha256 下载文件的 sha256 校验和, 校验失败时不使用
+	Sha256 string `yaml:"sha256"`
+}
+
+// Init 配置初始化
+func (f *Ffprobe) Init() error {
+	if strs.AllNotEmpty(f.Path) && !filepath.IsAbs(f.Path) && strings.ContainsAny(f.Path, `/\`) {
+		f.Path = filepath.Join(BasePath, f.Path)
+	}
+	for platform, src := range f.Sources {
+		if parts := strings.Split(platform, "/"); len(parts) != 2 || strs.AnyEmpty(parts...) {
+			return fmt.Errorf("ffprobe.sources 平台配置错误: %s, 格式: 系统/架构, 如: linux/amd64", platform)
+		}
+		if src == nil {
+			return fmt.Errorf("ffprobe.sources.%s 配置不能为空", platform)
+		}
+		if u, err := url.Parse(src.Url); err != nil || strs.AnyEmpty(u.Scheme, u.Host) {
+			return fmt.Errorf("ffprobe.sources.%s.url 配置错误: %s", platform, src.Url)
+		}
+		src.Sha256 = strings.ToLower(strings.TrimSpace(src.Sha256))
+		if !sha256Regex.MatchString(src.Sha256) {
+			return fmt.Errorf("ffprobe.sources.%s.sha256 配置错误: %s", platform, src.Sha256)
+		}
+	}
+	return nil
+}
+
+// Source 获取当前平台的下载配置
+func (f *Ffprobe) Source() (*FfprobeSource, bool) {
+	src, ok := f.Sources[runtime.GOOS+"/"+runtime.GOARCH]
+	return src, ok
+}
+
+// Dir 自动下载的 ffprobe 存放目录
+func (f *Ffprobe) Dir() string {
+	return filepath.Join(BasePath, FfprobeDir)
+}
@@ -0,0 +1,128 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// GeoAction 地区规则匹配之后的链接选择方式
+type GeoAction string
+
+const (
+	GeoRedirect GeoAction = "redirect" // 按照 resolve.chain 重定向到网盘直链
+	GeoProxy    GeoAction = "proxy"    // 使用 alist 本地代理链接, 由服务器中转
+	GeoCdn      GeoAction = "cdn"      // 重定向到 CDN 前缀拼接的 alist 代理链接
+)
+
+// GeoLan 局域网和本机地址对应的地区代码
+const GeoLan = "LAN"
+
+// Geo 根据客户端 ip 所在的国家/地区和 ASN 选择播放链接
+type Geo struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Database ip 数据库文件, 每行格式为: 网段,国家代码[,ASN], 相对路径基于配置文件所在目录
+	Database string `yaml:"database"`
+	// Rules 地区规则, 自上而下匹配第一条满足条件的规则, 都不满足时使用 redirect
+	Rules []*GeoRule `yaml:"rules"`
+}
+
+// GeoRule 地区规则
+type GeoRule struct {
+	// Countries 国家/地区代码, 如: CN, LAN 表示局域网, * 表示所有
+	Countries []string `yaml:"countries"`
+	// Asns 自治系统编号, 如: AS4134, 与 Countries 同时配置时需要同时满足
+	Asns []string `yaml:"asns"`
+	// Action 链接选择方式: redirect, proxy, cdn
+	Action GeoAction `yaml:"action"`
+	// CdnPrefix action 为 cdn 时使用的 CDN 地址前缀, 需要回源到 alist
+	CdnPrefix string `yaml:"cdn-prefix"`
+}
+
+// Init 配置初始化
+func (g *Geo) Init() error {
+	if !g.Enable {
+		return nil
+	}
+	if strs.AnyEmpty(g.Database) {
+		return errors.New("geo.database 配置不能为空")
+	}
+	if stat, err := os.Stat(g.DatabasePath()); err != nil || stat.IsDir() {
+		return fmt.Errorf("geo.database 配置错误, 检测不到数据库文件: %s", g.DatabasePath())
+	}
+
+	for i, rule := range g.Rules {
+		if rule == nil || (len(rule.Countries) == 0 && len(rule.Asns) == 0) {
+			return fmt.Errorf("geo.rules[%d] 配置错误: countries 和 asns 不能同时为空", i)
+		}
+		for j, country := range rule.Countries {
+			rule.Countries[j] = strings.ToUpper(strings.TrimSpace(country))
+		}
+		for j, asn := range rule.Asns {
+			rule.Asns[j] = NormalizeAsn(asn)
+		}
+		rule.Action = GeoAction(strings.ToLower(strings.TrimSpace(string(rule.Action))))
+		switch rule.Action {
+		case GeoRedirect, GeoProxy:
+		case GeoCdn:
+			if strs.AnyEmpty(rule.CdnPrefix) {
+				return fmt.Errorf("geo.rules[%d] 配置错误: action 为 cdn 时 cdn-prefix 不能为空", i)
+			}
+			rule.CdnPrefix = strings.TrimSuffix(rule.CdnPrefix, "/")
+		default:
+			return fmt.Errorf("geo.rules[%d] 配置错误, 不支持的 action: %s", i, rule.Action)
+		}
+	}
+	return nil
+}
+
+// DatabasePath 获取 ip 数据库文件的绝对路径
+func (g *Geo) DatabasePath() string {
+	if filepath.IsAbs(g.Database) {
+		return g.Database
+	}
+	return filepath.Join(BasePath, g.Database)
+}
+
+// Match 获取国家/地区和 ASN 匹配的第一条规则, 匹配不到时返回 nil
+func (g *Geo) Match(country, asn string) *GeoRule {
+	for _, rule := range g.Rules {
+		if rule.match(country, asn) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// match 判断规则是否匹配
+func (r *GeoRule) match(country, asn string) bool {
+	countryOk := len(r.Countries) == 0
+	for _, c := range r.Countries {
+		if c == "*" || c == country {
+			countryOk = true
+			break
+		}
+	}
+	asnOk := len(r.Asns) == 0
+	for _, a := range r.Asns {
+		if strs.AllNotEmpty(asn) && a == asn {
+			asnOk = true
+			break
+		}
+	}
+	return countryOk && asnOk
+}
+
+// NormalizeAsn 将 ASN 统一转换为 AS 开头的大写格式, 如: 4134 => AS4134
+func NormalizeAsn(asn string) string {
+	asn = strings.ToUpper(strings.TrimSpace(asn))
+	if asn == "" || strings.HasPrefix(asn, "AS") {
+		return asn
+	}
+	return "AS" + asn
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"fmt"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// Hooks 事件钩子配置, 程序处理请求过程中的关键事件会推送到配置的 webhook 地址
+type Hooks struct {
+	// Webhooks 接收事件的 webhook 列表
+	Webhooks []*Webhook `yaml:"webhooks"`
+}
+
+// Webhook 接收事件的 webhook
+type Webhook struct {
+	// Url webhook 地址, 以 POST json 的方式推送事件
+	Url string `yaml:"url"`
+	// Events 订阅的事件, 不配置表示订阅所有事件
+	Events []string `yaml:"events"`
+	// Secret 签名密钥, 配置后推送时会携带请求体的 HMAC-SHA256 签名
+	Secret string `yaml:"secret"`
+
+	// eventMap 依据 Events 初始化该 map, 便于后续快速判断
+	eventMap map[string]struct{}
+}
+
+// Init 配置初始化
+func (h *Hooks) Init() error {
+	for i, wh := range h.Webhooks {
+		if wh == nil || strs.AnyEmpty(wh.Url) {
+			return fmt.Errorf("hooks.webhooks[%d] 配置错误: url 不能为空", i)
+		}
+		wh.eventMap = make(map[string]struct{})
+		for _, event := range wh.Events {
+			wh.eventMap[event] = struct{}{}
+		}
+	}
+	return nil
+}
+
+// Subscribed 判断 webhook 是否订阅了指定事件
+func (wh *Webhook) Subscribed(event string) bool {
+	if len(wh.eventMap) == 0 {
+		return true
+	}
+	_, ok := wh.eventMap[event]
+	return ok
+}
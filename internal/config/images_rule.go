@@ -0,0 +1,229 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// ImagesNetwork 图片规则生效的客户端网络
+type ImagesNetwork string
+
+const (
+	ImagesNetworkAny    ImagesNetwork = ""       // 不限制
+	ImagesNetworkLan    ImagesNetwork = "lan"    // 局域网 (包括本机) 客户端
+	ImagesNetworkRemote ImagesNetwork = "remote" // 外网客户端
+)
+
+// ImagesRule 按照用户或客户端覆盖图片质量和最大宽度
+type ImagesRule struct {
+	// Name 规则名称, 用于日志输出
+	Name string `yaml:"name"`
+	// Users 生效的用户名
+	Users []string `yaml:"users"`
+	// Clients 生效的客户端, 客户端名称包含其中任意一个关键字即匹配 (不区分大小写)
+	//
+	// Users 和 Clients 都不配置时, 对所有用户和客户端生效, 都配置时满足其中一个即可
+	Clients []string `yaml:"clients"`
+	// Network 生效的客户端网络: lan, remote, 留空不限制
+	Network ImagesNetwork `yaml:"network"`
+	// Quality 图片质量, 范围: [1, 100], 不配置时使用 emby.images-quality
+	Quality int `yaml:"quality"`
+	// MaxWidth 图片的最大宽度 (像素), 客户端请求的尺寸超出时按照该宽度等比缩放, 不配置时不限制
+	MaxWidth int `yaml:"max-width"`
+
+	// userMap 依据 Users 初始化该 map, 便于后续快速判断
+	userMap map[string]struct{}
+}
+
+// Init 配置初始化
+func (ir *ImagesRule) Init() error {
+	ir.userMap = make(map[string]struct{})
+	for _, user := range ir.Users {
+		ir.userMap[user] = struct{}{}
+	}
+	clients := make([]string, 0, len(ir.Clients))
+	for _, client := range ir.Clients {
+		if client = strings.ToLower(strings.TrimSpace(client)); client != "" {
+			clients = append(clients, client)
+		}
+	}
+	ir.Clients = clients
+
+	ir.Network = ImagesNetwork(strings.ToLower(strings.TrimSpace(string(ir.Network))))
+	switch ir.Network {
+	case ImagesNetworkAny, ImagesNetworkLan, ImagesNetworkRemote:
+	default:
+		return fmt.Errorf("network 配置错误: %s, 可选值: lan, remote", ir.Network)
+	}
+	if ir.Quality < 0 || ir.Quality > 100 {
+		return fmt.Errorf("quality 配置错误: %d, 允许配置范围: [1, 100]", ir.Quality)
+	}
+	if ir.MaxWidth < 0 {
+		return fmt.Errorf("max-width 配置错误: %d", ir.MaxWidth)
+	}
+	if ir.Quality == 0 && ir.MaxWidth == 0 {
+		return fmt.Errorf("quality 和 max-width 至少需要配置一个")
+	}
+	return nil
+}
+
+// NeedUser 判断规则是否需要依据用户名进行匹配
+func (ir *ImagesRule) NeedUser() bool {
+	return len(ir.userMap) > 0
+}
+
+// Match 判断请求是否匹配规则, 不需要用户名时不会调用 user
+func (ir *ImagesRule) Match(user func() string, client string, lan bool) bool {
+	if (ir.Network == ImagesNetworkLan && !lan) || (ir.Network == ImagesNetworkRemote && lan) {
+		return false
+	}
+	if len(ir.userMap) == 0 && len(ir.Clients) == 0 {
+		return true
+	}
+	client = strings.ToLower(client)
+	for _, keyword := range ir.Clients {
+		if strings.Contains(client, keyword) {
+			return true
+		}
+	}
+	if ir.NeedUser() {
+		_, ok := ir.userMap[user()]
+		return ok
+	}
+	return false
+}
+
+// ImagesPrefetch 首页图片预取配置
+//
+// 客户端加载首页 (请求用户的媒体库视图) 时, 在后台预取继续观看和最近添加列表中 item 的背景图和 logo,
+// 缓存到内存中, 减少首页加载时集中请求源服务器的图片; 需要开启 cache.enable
+type ImagesPrefetch struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Limit 每个列表最多预取多少个 item
+	Limit int `yaml:"limit"`
+	// MaxWidth 预取图片的宽度 (像素), 匹配的 images-rules 配置了更小的 max-width 时以规则为准
+	MaxWidth int `yaml:"max-width"`
+	// Interval 同一个用户两次预取的最小间隔
+	Interval string `yaml:"interval"`
+	// Expired 预取图片的缓存时间
+	Expired string `yaml:"expired"`
+
+	// interval 配置初始化转换之后的标准时间对象
+	interval time.Duration
+	// expired 配置初始化转换之后的标准时间对象
+	expired time.Duration
+}
+
+// Init 配置初始化
+func (ip *ImagesPrefetch) Init() error {
+	if ip.Limit == 0 {
+		ip.Limit = 20
+	}
+	if ip.Limit < 0 {
+		return fmt.Errorf("limit 配置错误: %d", ip.Limit)
+	}
+	if ip.MaxWidth == 0 {
+		ip.MaxWidth = 1920
+	}
+	if ip.MaxWidth < 0 {
+		return fmt.Errorf("max-width 配置错误: %d", ip.MaxWidth)
+	}
+
+	ip.interval = time.Minute * 10
+	if strs.AllNotEmpty(ip.Interval) {
+		interval, err := parseDuration(ip.Interval)
+		if err != nil {
+			return fmt.Errorf("interval 配置错误: %v", err)
+		}
+		ip.interval = interval
+	}
+	ip.expired = time.Hour * 24
+	if strs.AllNotEmpty(ip.Expired) {
+		expired, err := parseDuration(ip.Expired)
+		if err != nil {
+			return fmt.Errorf("expired 配置错误: %v", err)
+		}
+		if expired <= 0 {
+			return fmt.Errorf("expired 配置错误: %s", ip.Expired)
+		}
+		ip.expired = expired
+	}
+	return nil
+}
+
+// IntervalDuration 获取同一个用户两次预取的最小间隔
+func (ip *ImagesPrefetch) IntervalDuration() time.Duration {
+	return ip.interval
+}
+
+// ExpiredDuration 获取预取图片的缓存时间
+func (ip *ImagesPrefetch) ExpiredDuration() time.Duration {
+	return ip.expired
+}
+
+// RemoteImages 远程图片代理配置
+//
+// 部分 item 的图片直接指向远程图片提供商 (如 TMDb) 的地址, 不经过图片处理流程,
+// 启用后由本程序代理请求这些图片并进行缓存, 使无法访问图片提供商的客户端也能正常显示图片
+type RemoteImages struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Hosts 允许代理的图片域名, 支持通配符, 如: *.tmdb.org
+	Hosts []string `yaml:"hosts"`
+	// Expired 远程图片的缓存时间
+	Expired string `yaml:"expired"`
+
+	// expired 配置初始化转换之后的标准时间对象
+	expired time.Duration
+}
+
+// Init 配置初始化
+func (ri *RemoteImages) Init() error {
+	if len(ri.Hosts) == 0 {
+		ri.Hosts = []string{"image.tmdb.org"}
+	}
+	for i, host := range ri.Hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if strs.AnyEmpty(host) {
+			return fmt.Errorf("hosts[%d] 不能为空", i)
+		}
+		if _, err := path.Match(host, ""); err != nil {
+			return fmt.Errorf("hosts[%d] 配置错误: %s", i, host)
+		}
+		ri.Hosts[i] = host
+	}
+
+	ri.expired = time.Hour * 24 * 7
+	if strs.AllNotEmpty(ri.Expired) {
+		expired, err := parseDuration(ri.Expired)
+		if err != nil {
+			return fmt.Errorf("expired 配置错误: %v", err)
+		}
+		if expired <= 0 {
+			return fmt.Errorf("expired 配置错误: %s", ri.Expired)
+		}
+		ri.expired = expired
+	}
+	return nil
+}
+
+// MatchHost 判断域名是否允许代理
+func (ri *RemoteImages) MatchHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range ri.Hosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpiredDuration 获取远程图片的缓存时间
+func (ri *RemoteImages) ExpiredDuration() time.Duration {
+	return ri.expired
+}
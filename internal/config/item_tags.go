@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// ItemTags 根据 emby 中 item (以及所属剧集) 的标签, 为单个 item 调整代理行为
+type ItemTags struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// NoPreview 带有这些标签的 item 不生成转码资源, 默认: no-preview
+	NoPreview []string `yaml:"no-preview"`
+	// ForceOrigin 带有这些标签的 item 不改写 PlaybackInfo, 串流请求全部回源, 默认: force-origin
+	ForceOrigin []string `yaml:"force-origin"`
+	// CacheTtl item 标签的缓存时间, 默认 5m
+	CacheTtl string `yaml:"cache-ttl"`
+
+	// cacheTtl 配置初始化转换之后的标准时间对象
+	cacheTtl time.Duration
+}
+
+// Init 配置初始化
+func (it *ItemTags) Init() error {
+	if len(it.NoPreview) == 0 {
+		it.NoPreview = []string{"no-preview"}
+	}
+	if len(it.ForceOrigin) == 0 {
+		it.ForceOrigin = []string{"force-origin"}
+	}
+	it.cacheTtl = time.Minute * 5
+	if strs.AllNotEmpty(it.CacheTtl) {
+		ttl, err := parseDuration(it.CacheTtl)
+		if err != nil {
+			return fmt.Errorf("item-tags.cache-ttl 配置错误: %v", err)
+		}
+		it.cacheTtl = ttl
+	}
+	return nil
+}
+
+// CacheTtlDuration 获取 item 标签的缓存时间
+func (it *ItemTags) CacheTtlDuration() time.Duration {
+	return it.cacheTtl
+}
+
+// IsNoPreview 判断标签中是否包含不生成转码资源的标签
+func (it *ItemTags) IsNoPreview(tags []string) bool {
+	return containsTag(tags, it.NoPreview)
+}
+
+// IsForceOrigin 判断标签中是否包含强制回源的标签
+func (it *ItemTags) IsForceOrigin(tags []string) bool {
+	return containsTag(tags, it.ForceOrigin)
+}
+
+// containsTag 判断 tags 中是否存在 targets 中的任意一个标签, 忽略大小写
+func containsTag(tags, targets []string) bool {
+	for _, tag := range tags {
+		for _, target := range targets {
+			if strings.EqualFold(strings.TrimSpace(tag), strings.TrimSpace(target)) {
+				return true
+			}
+		}
+	}
+	return false
+}
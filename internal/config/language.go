@@ -0,0 +1,68 @@
+package config
+
+import (
+	"strings"
+)
+
+// Language 用户的音轨/字幕语言偏好配置
+//
+// 客户端请求指定 MediaSourceId 的 PlaybackInfo 信息并且没有指定音轨/字幕时,
+// 按照请求用户的语言偏好设置默认音轨 (DefaultAudioStreamIndex) 和默认字幕 (DefaultSubtitleStreamIndex)
+type Language struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Default 所有用户默认的语言偏好
+	Default *LanguageProfile `yaml:"default"`
+	// Users 指定用户 (用户名) 的语言偏好, 未配置的用户使用 Default
+	Users map[string]*LanguageProfile `yaml:"users"`
+}
+
+// LanguageProfile 语言偏好
+type LanguageProfile struct {
+	// Audio 偏好的音轨语言, 按优先级排列, 如: chi, jpn
+	Audio []string `yaml:"audio"`
+	// Subtitle 偏好的字幕语言, 按优先级排列
+	Subtitle []string `yaml:"subtitle"`
+	// ForcedOnly 是否只默认启用强制字幕, 没有匹配的强制字幕时关闭字幕
+	ForcedOnly bool `yaml:"forced-only"`
+}
+
+// Init 配置初始化
+func (l *Language) Init() error {
+	if l.Default == nil {
+		l.Default = new(LanguageProfile)
+	}
+	l.Default.normalize()
+	for user, profile := range l.Users {
+		if profile == nil {
+			l.Users[user] = l.Default
+			continue
+		}
+		profile.normalize()
+	}
+	return nil
+}
+
+// Profile 获取指定用户的语言偏好
+func (l *Language) Profile(user string) *LanguageProfile {
+	if profile, ok := l.Users[user]; ok {
+		return profile
+	}
+	return l.Default
+}
+
+// normalize 统一语言代码为小写, 并移除空白配置
+func (lp *LanguageProfile) normalize() {
+	normalize := func(langs []string) []string {
+		res := make([]string, 0, len(langs))
+		for _, lang := range langs {
+			lang = strings.ToLower(strings.TrimSpace(lang))
+			if lang != "" {
+				res = append(res, lang)
+			}
+		}
+		return res
+	}
+	lp.Audio = normalize(lp.Audio)
+	lp.Subtitle = normalize(lp.Subtitle)
+}
@@ -0,0 +1,71 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// LegacyClient 旧设备兼容配置
+//
+// 部分老旧的 DLNA 播放器、电视固件无法处理携带大量参数的长地址,
+// 启用后为匹配的客户端将串流地址和 ts 切片地址替换为短链接 (/s/{token})
+type LegacyClient struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Clients 旧设备的客户端名称或 User-Agent, 包含其中任意一个关键字即匹配 (不区分大小写)
+	Clients []string `yaml:"clients"`
+	// Expired 短链接的有效期
+	Expired string `yaml:"expired"`
+
+	// expired 配置初始化转换之后的标准时间对象
+	expired time.Duration
+}
+
+// Init 配置初始化
+func (lc *LegacyClient) Init() error {
+	clients := make([]string, 0, len(lc.Clients))
+	for _, client := range lc.Clients {
+		if client = strings.ToLower(strings.TrimSpace(client)); client != "" {
+			clients = append(clients, client)
+		}
+	}
+	lc.Clients = clients
+	if lc.Enable && len(lc.Clients) == 0 {
+		return fmt.Errorf("legacy-client.clients 配置不能为空")
+	}
+
+	lc.expired = time.Hour * 12
+	if strs.AllNotEmpty(lc.Expired) {
+		expired, err := parseDuration(lc.Expired)
+		if err != nil {
+			return fmt.Errorf("legacy-client.expired 配置错误: %v", err)
+		}
+		if expired <= 0 {
+			return fmt.Errorf("legacy-client.expired 配置错误: %s", lc.Expired)
+		}
+		lc.expired = expired
+	}
+	return nil
+}
+
+// Match 判断客户端名称或 User-Agent 是否属于旧设备
+func (lc *LegacyClient) Match(client, userAgent string) bool {
+	if !lc.Enable {
+		return false
+	}
+	client, userAgent = strings.ToLower(client), strings.ToLower(userAgent)
+	for _, keyword := range lc.Clients {
+		if strings.Contains(client, keyword) || strings.Contains(userAgent, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// ExpiredDuration 获取短链接的有效期
+func (lc *LegacyClient) ExpiredDuration() time.Duration {
+	return lc.expired
+}
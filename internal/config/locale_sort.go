@@ -0,0 +1,70 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+
+	"golang.org/x/text/language"
+)
+
+// LocaleSort 按名称排序的 Items 列表的本地化重排序配置
+//
+// 部分客户端中中文标题按照名称排序时顺序错乱, 开启后由本程序获取完整列表,
+// 按照 locale 的排序规则 (中文为拼音顺序) 重新排序之后再分页返回
+type LocaleSort struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Locale 排序使用的语言, 如: zh, zh-Hant, ja, 默认 zh (拼音顺序)
+	Locale string `yaml:"locale"`
+	// Libraries 生效的媒体库, 可以配置媒体库 id 或名称, 为空时对所有媒体库生效
+	Libraries []string `yaml:"libraries"`
+	// Expired 完整列表的缓存时间, 客户端翻页时复用, 默认 5m
+	Expired string `yaml:"expired"`
+
+	// tag 解析之后的语言
+	tag language.Tag
+	// expired 配置初始化转换之后的标准时间对象
+	expired time.Duration
+}
+
+// Init 配置初始化
+func (ls *LocaleSort) Init() error {
+	ls.Locale = strings.TrimSpace(ls.Locale)
+	if strs.AnyEmpty(ls.Locale) {
+		ls.Locale = "zh"
+	}
+	tag, err := language.Parse(ls.Locale)
+	if err != nil {
+		return fmt.Errorf("locale 配置错误: %s", ls.Locale)
+	}
+	ls.tag = tag
+
+	for i, lib := range ls.Libraries {
+		if ls.Libraries[i] = strings.TrimSpace(lib); strs.AnyEmpty(ls.Libraries[i]) {
+			return fmt.Errorf("libraries[%d] 不能为空", i)
+		}
+	}
+
+	ls.expired = time.Minute * 5
+	if strs.AllNotEmpty(ls.Expired) {
+		expired, err := parseDuration(ls.Expired)
+		if err != nil || expired <= 0 {
+			return fmt.Errorf("expired 配置错误: %s", ls.Expired)
+		}
+		ls.expired = expired
+	}
+	return nil
+}
+
+// Tag 获取排序使用的语言
+func (ls *LocaleSort) Tag() language.Tag {
+	return ls.tag
+}
+
+// ExpiredDuration 获取完整列表的缓存时间
+func (ls *LocaleSort) ExpiredDuration() time.Duration {
+	return ls.expired
+}
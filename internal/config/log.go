@@ -1,11 +1,70 @@
 package config
 
+import (
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
 // Log 日志配置
 type Log struct {
-	DisableColor bool `yaml:"disable-color"` // 是否禁用彩色日志输出
+	DisableColor  bool     `yaml:"disable-color"`  // 是否禁用彩色日志输出
+	SlowThreshold string   `yaml:"slow-threshold"` // 慢请求阈值, 处理耗时超过该值的请求会输出警告日志
+	Level         string   `yaml:"level"`          // 日志级别, 可选值: debug, info
+	Capture       *Capture `yaml:"capture"`        // 请求录制配置
+	DumpDir       string   `yaml:"dump-dir"`       // 诊断信息 (SIGUSR1) 的输出目录, 留空时输出到日志中
+
+	// slowThreshold 配置初始化转换之后的标准时间对象, 零值表示不启用
+	slowThreshold time.Duration
+	// level 配置初始化转换之后的日志级别
+	level logs.Level
 }
 
 // Init 配置初始化
 func (lc *Log) Init() error {
+	if strs.AllNotEmpty(lc.SlowThreshold) {
+		threshold, err := parseDuration(lc.SlowThreshold)
+		if err != nil {
+			return fmt.Errorf("log.slow-threshold 配置错误: %v", err)
+		}
+		lc.slowThreshold = threshold
+	}
+
+	lc.level = logs.LevelDebug
+	if strs.AllNotEmpty(lc.Level) {
+		level, err := logs.ParseLevel(lc.Level)
+		if err != nil {
+			return fmt.Errorf("log.level 配置错误: %v", err)
+		}
+		lc.level = level
+	}
+
+	if lc.Capture == nil {
+		lc.Capture = new(Capture)
+	}
+	if err := lc.Capture.Init(); err != nil {
+		return fmt.Errorf("log.capture 配置错误: %v", err)
+	}
 	return nil
 }
+
+// DumpPath 获取诊断信息的输出目录, 相对路径基于配置文件所在目录, 返回空串表示输出到日志中
+func (lc *Log) DumpPath() string {
+	if strs.AnyEmpty(lc.DumpDir) || filepath.IsAbs(lc.DumpDir) {
+		return lc.DumpDir
+	}
+	return filepath.Join(BasePath, lc.DumpDir)
+}
+
+// LogLevel 获取启动时使用的日志级别
+func (lc *Log) LogLevel() logs.Level {
+	return lc.level
+}
+
+// SlowThresholdDuration 获取慢请求阈值, 返回零值表示不启用
+func (lc *Log) SlowThresholdDuration() time.Duration {
+	return lc.slowThreshold
+}
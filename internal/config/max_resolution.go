@@ -0,0 +1,57 @@
+package config
+
+import (
+	"fmt"
+)
+
+// MaxResolution 用户的最大分辨率/码率限制
+//
+// 受限用户请求 PlaybackInfo 时, 超出限制的原画资源和转码资源都会被隐藏, 只返回满足限制的资源
+type MaxResolution struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Users 指定用户 (用户名) 的限制, 未配置的用户不受限制
+	Users map[string]*ResolutionLimit `yaml:"users"`
+}
+
+// ResolutionLimit 分辨率/码率限制, 配置为 0 表示不限制该项
+type ResolutionLimit struct {
+	// Height 最大的视频高度, 如: 1080
+	Height int `yaml:"height"`
+	// Bitrate 最大的码率 (bps), 如: 8000000
+	Bitrate int64 `yaml:"bitrate"`
+}
+
+// Init 配置初始化
+func (mr *MaxResolution) Init() error {
+	for user, limit := range mr.Users {
+		if limit == nil {
+			delete(mr.Users, user)
+			continue
+		}
+		if limit.Height < 0 || limit.Bitrate < 0 {
+			return fmt.Errorf("max-resolution.users 配置错误, 用户 %s 的限制不能小于 0", user)
+		}
+		if limit.Height == 0 && limit.Bitrate == 0 {
+			delete(mr.Users, user)
+		}
+	}
+	return nil
+}
+
+// Limit 获取指定用户的限制, 用户不受限制时返回 false
+func (mr *MaxResolution) Limit(user string) (*ResolutionLimit, bool) {
+	if !mr.Enable {
+		return nil, false
+	}
+	limit, ok := mr.Users[user]
+	return limit, ok
+}
+
+// Exceed 判断资源是否超出限制, 未知的高度或码率 (0) 不参与判断
+func (rl *ResolutionLimit) Exceed(height int, bitrate int64) bool {
+	if rl.Height > 0 && height > rl.Height {
+		return true
+	}
+	return rl.Bitrate > 0 && bitrate > rl.Bitrate
+}
@@ -0,0 +1,312 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// IpPreference 出站连接的 ip 协议偏好
+type IpPreference string
+
+const (
+	IpPreferenceAuto IpPreference = "auto" // 双栈并发连接 (Happy Eyeballs)
+	IpPreferenceV4   IpPreference = "ipv4" // 优先使用 ipv4
+	IpPreferenceV6   IpPreference = "ipv6" // 优先使用 ipv6
+)
+
+// validIpPreference 用于校验用户配置的 ip 协议偏好是否合法
+var validIpPreference = map[IpPreference]struct{}{
+	IpPreferenceAuto: {}, IpPreferenceV4: {}, IpPreferenceV6: {},
+}
+
+// Network 出站网络配置
+type Network struct {
+	// IpPreference 出站连接的 ip 协议偏好
+	IpPreference IpPreference `yaml:"ip-preference"`
+	// Proxy 出站代理配置
+	Proxy *Proxy `yaml:"proxy"`
+	// Dns 自定义 dns 配置
+	Dns *Dns `yaml:"dns"`
+	// Retry 上游请求失败重试配置
+	Retry *Retry `yaml:"retry"`
+	// ConnLimit 上游主机并发连接数限制
+	ConnLimit *ConnLimit `yaml:"conn-limit"`
+	// Headers 按照上游主机改写出站请求头的规则, 自上而下依次匹配, 所有匹配的规则都会生效
+	Headers []*HeaderRule `yaml:"headers"`
+}
+
+// Proxy 出站代理配置
+type Proxy struct {
+	// Url 代理地址, 支持 http, https, socks5, socks5h 协议, 为空时不使用代理
+	Url string `yaml:"url"`
+	// Hosts 需要走代理的域名, 支持通配符, 如: *.aliyundrive.net, 为空时不代理任何请求
+	Hosts []string `yaml:"hosts"`
+	// All 是否所有外部请求都走代理, emby 地址仍然需要在 Hosts 中显式列出才走代理
+	All bool `yaml:"all"`
+	// Exclude 不走代理的域名, 支持通配符, 优先级高于 Hosts
+	Exclude []string `yaml:"exclude"`
+
+	// proxyUrl 解析后的代理地址
+	proxyUrl *url.URL
+}
+
+// Init 配置初始化
+func (n *Network) Init() error {
+	n.IpPreference = IpPreference(strings.ToLower(strings.TrimSpace(string(n.IpPreference))))
+	if strs.AnyEmpty(string(n.IpPreference)) {
+		n.IpPreference = IpPreferenceAuto
+	}
+	if _, ok := validIpPreference[n.IpPreference]; !ok {
+		return fmt.Errorf("network.ip-preference 配置错误: %s", n.IpPreference)
+	}
+
+	if n.Proxy == nil {
+		n.Proxy = new(Proxy)
+	}
+	if err := n.Proxy.Init(); err != nil {
+		return fmt.Errorf("network.proxy 配置错误: %v", err)
+	}
+	if n.Dns == nil {
+		n.Dns = new(Dns)
+	}
+	if err := n.Dns.Init(); err != nil {
+		return fmt.Errorf("network.dns 配置错误: %v", err)
+	}
+	if n.Retry == nil {
+		n.Retry = new(Retry)
+	}
+	if err := n.Retry.Init(); err != nil {
+		return fmt.Errorf("network.retry 配置错误: %v", err)
+	}
+	if n.ConnLimit == nil {
+		n.ConnLimit = new(ConnLimit)
+	}
+	if err := n.ConnLimit.Init(); err != nil {
+		return fmt.Errorf("network.conn-limit 配置错误: %v", err)
+	}
+	for i, rule := range n.Headers {
+		if rule == nil {
+			return fmt.Errorf("network.headers[%d] 配置不能为空", i)
+		}
+		if err := rule.Init(); err != nil {
+			return fmt.Errorf("network.headers[%d] 配置错误: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// Init 配置初始化
+func (p *Proxy) Init() error {
+	if strs.AnyEmpty(p.Url) {
+		return nil
+	}
+	u, err := url.Parse(p.Url)
+	if err != nil {
+		return fmt.Errorf("解析代理地址失败: %v", err)
+	}
+	switch u.Scheme {
+	case "http", "https", "socks5", "socks5h":
+	default:
+		return fmt.Errorf("不支持的代理协议: %s", u.Scheme)
+	}
+	if strs.AnyEmpty(u.Host) {
+		return fmt.Errorf("代理地址缺少主机: %s", p.Url)
+	}
+	p.proxyUrl = u
+
+	for i, host := range p.Hosts {
+		p.Hosts[i] = strings.ToLower(strings.TrimSpace(host))
+	}
+	for i, host := range p.Exclude {
+		p.Exclude[i] = strings.ToLower(strings.TrimSpace(host))
+	}
+	return nil
+}
+
+// Enabled 是否启用了出站代理
+func (p *Proxy) Enabled() bool {
+	return p != nil && p.proxyUrl != nil
+}
+
+// ProxyUrl 获取解析后的代理地址
+func (p *Proxy) ProxyUrl() *url.URL {
+	return p.proxyUrl
+}
+
+// Dns 自定义 dns 配置
+//
+// 同时配置了 Doh 和 Servers 时, 优先使用 Doh 解析, 解析失败再使用 Servers
+type Dns struct {
+	// Servers 普通 dns 服务器地址, 如: 223.5.5.5, 1.1.1.1:53
+	Servers []string `yaml:"servers"`
+	// Doh DNS over HTTPS 查询地址, 如: https://1.1.1.1/dns-query
+	Doh string `yaml:"doh"`
+}
+
+// Init 配置初始化
+func (d *Dns) Init() error {
+	for i, server := range d.Servers {
+		server = strings.TrimSpace(server)
+		if _, _, err := net.SplitHostPort(server); err != nil {
+			server = net.JoinHostPort(server, "53")
+		}
+		host, _, err := net.SplitHostPort(server)
+		if err != nil || net.ParseIP(host) == nil {
+			return fmt.Errorf("非法的 dns 服务器地址: %s", d.Servers[i])
+		}
+		d.Servers[i] = server
+	}
+
+	if strs.AnyEmpty(d.Doh) {
+		return nil
+	}
+	u, err := url.Parse(d.Doh)
+	if err != nil || u.Scheme != "https" || strs.AnyEmpty(u.Host) {
+		return fmt.Errorf("非法的 doh 地址: %s", d.Doh)
+	}
+	return nil
+}
+
+// Enabled 是否配置了自定义 dns
+func (d *Dns) Enabled() bool {
+	return d != nil && (len(d.Servers) > 0 || strs.AllNotEmpty(d.Doh))
+}
+
+// Retry 上游请求失败重试配置
+//
+// 只有出现网络异常的幂等请求 (GET, HEAD, OPTIONS 或显式标记为幂等的请求) 才会重试
+type Retry struct {
+	// Enable 是否启用重试
+	Enable bool `yaml:"enable"`
+	// Count 最大重试次数
+	Count int `yaml:"count"`
+	// Interval 两次重试之间的间隔
+	Interval string `yaml:"interval"`
+
+	// interval 配置初始化转换之后的标准时间对象
+	interval time.Duration
+}
+
+// Init 配置初始化
+func (r *Retry) Init() error {
+	if r.Count <= 0 {
+		r.Count = 2
+	}
+	r.interval = time.Millisecond * 500
+	if strs.AllNotEmpty(r.Interval) {
+		interval, err := parseDuration(r.Interval)
+		if err != nil {
+			return fmt.Errorf("interval 配置错误: %v", err)
+		}
+		r.interval = interval
+	}
+	return nil
+}
+
+// MaxRetries 获取最大重试次数, 未启用重试时返回 0
+func (r *Retry) MaxRetries() int {
+	if r == nil || !r.Enable {
+		return 0
+	}
+	return r.Count
+}
+
+// IntervalDuration 获取两次重试之间的间隔
+func (r *Retry) IntervalDuration() time.Duration {
+	return r.interval
+}
+
+// ConnLimit 上游主机并发连接数限制
+//
+// 超出限制的请求会排队等待, 避免单个缓慢的主机占满所有连接
+type ConnLimit struct {
+	// Default 每个上游主机默认的最大并发连接数, 0 表示不限制
+	Default int `yaml:"default"`
+	// Hosts 指定主机的最大并发连接数, 支持通配符, 如: *.aliyundrive.net: 4
+	Hosts map[string]int `yaml:"hosts"`
+	// Timeout 排队等待的超时时间
+	Timeout string `yaml:"timeout"`
+
+	// timeout 配置初始化转换之后的标准时间对象
+	timeout time.Duration
+}
+
+// Init 配置初始化
+func (c *ConnLimit) Init() error {
+	if c.Default < 0 {
+		return fmt.Errorf("default 不能小于 0")
+	}
+	hosts := make(map[string]int, len(c.Hosts))
+	for host, limit := range c.Hosts {
+		if limit < 0 {
+			return fmt.Errorf("主机 %s 的连接数不能小于 0", host)
+		}
+		hosts[strings.ToLower(strings.TrimSpace(host))] = limit
+	}
+	c.Hosts = hosts
+
+	c.timeout = time.Second * 30
+	if strs.AllNotEmpty(c.Timeout) {
+		timeout, err := parseDuration(c.Timeout)
+		if err != nil {
+			return fmt.Errorf("timeout 配置错误: %v", err)
+		}
+		c.timeout = timeout
+	}
+	return nil
+}
+
+// TimeoutDuration 获取排队等待的超时时间
+func (c *ConnLimit) TimeoutDuration() time.Duration {
+	return c.timeout
+}
+
+// HeaderRule 出站请求头改写规则
+//
+// 部分网盘 cdn 需要特定的 User-Agent 或 Referer, 否则会限速或拒绝请求
+type HeaderRule struct {
+	// Hosts 生效的上游主机, 支持通配符, 如: *.aliyundrive.net
+	Hosts []string `yaml:"hosts"`
+	// Set 设置请求头, 覆盖原有的值
+	Set map[string]string `yaml:"set"`
+	// Del 删除请求头
+	Del []string `yaml:"del"`
+}
+
+// Init 配置初始化
+func (hr *HeaderRule) Init() error {
+	if len(hr.Hosts) == 0 {
+		return fmt.Errorf("hosts 不能为空")
+	}
+	for i, host := range hr.Hosts {
+		host = strings.ToLower(strings.TrimSpace(host))
+		if strs.AnyEmpty(host) {
+			return fmt.Errorf("hosts[%d] 不能为空", i)
+		}
+		if _, err := path.Match(host, ""); err != nil {
+			return fmt.Errorf("hosts[%d] 配置错误: %s", i, host)
+		}
+		hr.Hosts[i] = host
+	}
+	if len(hr.Set) == 0 && len(hr.Del) == 0 {
+		return fmt.Errorf("set 和 del 不能同时为空")
+	}
+	return nil
+}
+
+// Match 判断上游主机是否匹配规则
+func (hr *HeaderRule) Match(host string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range hr.Hosts {
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
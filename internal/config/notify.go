@@ -0,0 +1,71 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// Notify 异常通知配置
+type Notify struct {
+	// Enable 是否启用异常通知
+	Enable bool `yaml:"enable"`
+	// Webhook 通用 webhook 地址, 以 POST json 的方式推送通知
+	Webhook string `yaml:"webhook"`
+	// Telegram telegram 机器人推送配置
+	Telegram *Telegram `yaml:"telegram"`
+	// Threshold 同一类异常连续出现多少次之后才进行通知
+	Threshold int `yaml:"threshold"`
+	// Interval 同一类异常两次通知之间的最小间隔
+	Interval string `yaml:"interval"`
+
+	// interval 配置初始化转换之后的标准时间对象
+	interval time.Duration
+}
+
+// Telegram 机器人推送配置
+type Telegram struct {
+	// BotToken 机器人 token
+	BotToken string `yaml:"bot-token"`
+	// ChatId 接收通知的会话 id
+	ChatId string `yaml:"chat-id"`
+}
+
+// Init 配置初始化
+func (n *Notify) Init() error {
+	if n.Telegram == nil {
+		n.Telegram = new(Telegram)
+	}
+	if n.Threshold <= 0 {
+		n.Threshold = 3
+	}
+
+	n.interval = time.Minute * 10
+	if strs.AllNotEmpty(n.Interval) {
+		interval, err := parseDuration(n.Interval)
+		if err != nil {
+			return fmt.Errorf("notify.interval 配置错误: %v", err)
+		}
+		n.interval = interval
+	}
+
+	if !n.Enable {
+		return nil
+	}
+	if strs.AnyEmpty(n.Webhook) && !n.Telegram.Valid() {
+		return errors.New("notify 已启用, 但 webhook 和 telegram 均未配置")
+	}
+	return nil
+}
+
+// IntervalDuration 获取两次通知之间的最小间隔
+func (n *Notify) IntervalDuration() time.Duration {
+	return n.interval
+}
+
+// Valid 判断 telegram 配置是否完整
+func (t *Telegram) Valid() bool {
+	return strs.AllNotEmpty(t.BotToken, t.ChatId)
+}
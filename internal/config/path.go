@@ -2,35 +2,249 @@ package config
 
 import (
 	"fmt"
+	"os"
+	"sort"
 	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// PathProfileEnv 指定路径配置组名称的环境变量
+const PathProfileEnv = "GO_EMBY2ALIST_PATH_PROFILE"
+
+// PathProfileName 通过命令行参数指定的路径配置组名称, 优先于环境变量和配置文件
+var PathProfileName string
+
+// PathNormalize 路径的 Unicode 规范化形式
+type PathNormalize string
+
+const (
+	PathNormalizeNone PathNormalize = ""    // 不做处理
+	PathNormalizeNFC  PathNormalize = "nfc" // 组合形式, alist 和大部分 Linux/Windows 存储使用
+	PathNormalizeNFD  PathNormalize = "nfd" // 分解形式, macOS 创建的文件名使用
 )
 
 type Path struct {
 	// Emby2Alist Emby 的路径前缀映射到 Alist 的路径前缀, 两个路径使用 : 符号隔开
 	Emby2Alist []string `yaml:"emby2alist"`
+	// Cache 路径映射结果的持久化缓存配置
+	Cache *PathCache `yaml:"cache"`
+	// Normalize 映射之前将 emby 路径转换为指定的 Unicode 规范化形式, 如: nfc
+	Normalize PathNormalize `yaml:"normalize"`
+	// IgnoreCase 匹配路径前缀以及在 alist 中查找文件时是否忽略大小写
+	IgnoreCase bool `yaml:"ignore-case"`
+	// BindMounts 去除 mount-path 之前对 emby 路径进行的前缀替换, 两个路径使用 : 符号隔开
+	BindMounts []string `yaml:"bind-mounts"`
+	// ResolveSymlinks 是否解析 emby 路径中的软链接, 需要本程序能够访问到 emby 的媒体目录
+	ResolveSymlinks bool `yaml:"resolve-symlinks"`
+	// FuzzyMatch 路径在 alist 中不存在时, 是否在父目录中按照文件大小 (以及时长) 查找重命名后的文件
+	FuzzyMatch bool `yaml:"fuzzy-match"`
+	// Profile 使用的路径配置组名称, 可以被环境变量或命令行参数覆盖
+	Profile string `yaml:"profile"`
+	// Profiles 路径配置组, 同一份配置文件部署在挂载路径不同的多个环境时使用
+	Profiles map[string]*PathProfile `yaml:"profiles"`
 
+	// mountPath 当前配置组覆盖的 emby 挂载路径
+	mountPath string
 	// emby2AlistMap 根据 Emby2Alist 转换成路径 map
 	emby2AlistMap map[string]string
+	// bindMounts 根据 BindMounts 转换成的前缀替换规则, 按照前缀长度倒序排列
+	bindMounts [][2]string
 }
 
 func (p *Path) Init() error {
+	if err := p.applyProfile(); err != nil {
+		return err
+	}
+
+	p.Normalize = PathNormalize(strings.ToLower(string(p.Normalize)))
+	switch p.Normalize {
+	case PathNormalizeNone, PathNormalizeNFC, PathNormalizeNFD:
+	default:
+		return fmt.Errorf("path.normalize 配置错误, 可选值: nfc, nfd, 实际: %s", p.Normalize)
+	}
+
 	p.emby2AlistMap = make(map[string]string)
 	for _, e2a := range p.Emby2Alist {
-		arr := strings.Split(e2a, ":")
-		if len(arr) != 2 {
+		from, to, ok := splitMapping(e2a)
+		if !ok {
 			return fmt.Errorf("path.emby2alist 配置错误, %s 无法根据 ':' 进行分割", e2a)
 		}
-		p.emby2AlistMap[arr[0]] = arr[1]
+		p.emby2AlistMap[p.NormalizePath(urls.TransferSlash(from))] = to
+	}
+
+	p.bindMounts = make([][2]string, 0, len(p.BindMounts))
+	for _, bm := range p.BindMounts {
+		from, to, ok := splitMapping(bm)
+		if !ok || strs.AnyEmpty(from, to) {
+			return fmt.Errorf("path.bind-mounts 配置错误, %s 无法根据 ':' 进行分割", bm)
+		}
+		p.bindMounts = append(p.bindMounts, [2]string{urls.TransferSlash(from), urls.TransferSlash(to)})
+	}
+	// 优先匹配更长的前缀, 避免嵌套的挂载目录被外层规则覆盖
+	sort.SliceStable(p.bindMounts, func(i, j int) bool { return len(p.bindMounts[i][0]) > len(p.bindMounts[j][0]) })
+
+	if p.Cache == nil {
+		p.Cache = new(PathCache)
+	}
+	if err := p.Cache.Init(); err != nil {
+		return fmt.Errorf("path.cache 配置错误: %v", err)
+	}
+	return nil
+}
+
+// applyProfile 使用当前配置组中的路径配置覆盖默认配置
+//
+// 配置组名称的优先级: 命令行参数 > 环境变量 > path.profile
+func (p *Path) applyProfile() error {
+	name := PathProfileName
+	if strs.AnyEmpty(name) {
+		name = os.Getenv(PathProfileEnv)
+	}
+	if strs.AnyEmpty(name) {
+		name = p.Profile
+	}
+	p.Profile = strings.TrimSpace(name)
+	if strs.AnyEmpty(p.Profile) {
+		return nil
+	}
+
+	pf, ok := p.Profiles[p.Profile]
+	if !ok || pf == nil {
+		return fmt.Errorf("path.profiles 中不存在配置组: %s", p.Profile)
+	}
+	p.mountPath = pf.MountPath
+	if pf.Emby2Alist != nil {
+		p.Emby2Alist = pf.Emby2Alist
+	}
+	if pf.BindMounts != nil {
+		p.BindMounts = pf.BindMounts
 	}
 	return nil
 }
 
+// MountPath 获取生效的 emby 挂载路径, 当前配置组没有覆盖挂载路径时返回 embyMount
+func (p *Path) MountPath(embyMount string) string {
+	if strs.AllNotEmpty(p.mountPath) {
+		return p.mountPath
+	}
+	return embyMount
+}
+
 // MapEmby2Alist 将 emby 路径映射成 alist 路径
 func (p *Path) MapEmby2Alist(embyPath string) (string, bool) {
 	for ep, ap := range p.emby2AlistMap {
-		if strings.HasPrefix(embyPath, ep) {
-			return strings.ReplaceAll(embyPath, ep, ap), true
+		if rest, ok := p.TrimPrefix(embyPath, ep); ok {
+			return ap + rest, true
 		}
 	}
 	return "", false
 }
+
+// MapBindMount 按照 bind-mounts 替换 emby 路径的前缀, 没有匹配的规则时原样返回
+func (p *Path) MapBindMount(embyPath string) (string, bool) {
+	for _, bm := range p.bindMounts {
+		if rest, ok := p.TrimPrefix(embyPath, bm[0]); ok && (rest == "" || strings.HasPrefix(rest, "/") || strings.HasSuffix(bm[0], "/")) {
+			return bm[1] + rest, true
+		}
+	}
+	return embyPath, false
+}
+
+// splitMapping 根据 ':' 分割路径映射配置, 兼容 Windows 盘符, 如: D:\Media:/电影
+func splitMapping(mapping string) (string, string, bool) {
+	offset := 0
+	if urls.IsWinDrivePath(mapping) {
+		offset = 2
+	}
+	idx := strings.Index(mapping[offset:], ":")
+	if idx == -1 {
+		return "", "", false
+	}
+	from, to := mapping[:offset+idx], mapping[offset+idx+1:]
+	if strings.Contains(to, ":") && !urls.IsWinDrivePath(to) {
+		return "", "", false
+	}
+	return from, to, true
+}
+
+// NormalizePath 将路径转换为配置的 Unicode 规范化形式
+func (p *Path) NormalizePath(s string) string {
+	switch p.Normalize {
+	case PathNormalizeNFC:
+		return norm.NFC.String(s)
+	case PathNormalizeNFD:
+		return norm.NFD.String(s)
+	}
+	return s
+}
+
+// NameEqual 判断两个文件名是否一致
+//
+// 比较时统一转换为组合形式, 开启 ignore-case 时忽略大小写
+func (p *Path) NameEqual(a, b string) bool {
+	if a == b {
+		return true
+	}
+	a, b = norm.NFC.String(a), norm.NFC.String(b)
+	if p.IgnoreCase {
+		return strings.EqualFold(a, b)
+	}
+	return a == b
+}
+
+// TrimPrefix 去除路径前缀, 开启 ignore-case 时忽略大小写, 返回路径是否以 prefix 开头
+func (p *Path) TrimPrefix(s, prefix string) (string, bool) {
+	if strings.HasPrefix(s, prefix) {
+		return s[len(prefix):], true
+	}
+	if p.IgnoreCase && len(s) >= len(prefix) && strings.EqualFold(s[:len(prefix)], prefix) {
+		return s[len(prefix):], true
+	}
+	return s, false
+}
+
+// PathProfile 路径配置组, 配置的项覆盖默认配置, 未配置的项使用默认配置
+type PathProfile struct {
+	// MountPath 覆盖 emby.mount-path
+	MountPath string `yaml:"mount-path"`
+	// Emby2Alist 覆盖 path.emby2alist
+	Emby2Alist []string `yaml:"emby2alist"`
+	// BindMounts 覆盖 path.bind-mounts
+	BindMounts []string `yaml:"bind-mounts"`
+}
+
+// PathCache 路径映射结果的持久化缓存配置
+//
+// 记录 emby 路径最终在 alist 中请求成功的路径, 下次播放时优先使用, 避免重复遍历 alist 根目录
+type PathCache struct {
+	// Enable 是否启用缓存
+	Enable bool `yaml:"enable"`
+	// Ttl 缓存的有效期, 默认 7d
+	Ttl string `yaml:"ttl"`
+
+	// ttl 配置初始化转换之后的标准时间对象
+	ttl time.Duration
+}
+
+// Init 配置初始化
+func (pc *PathCache) Init() error {
+	pc.ttl = time.Hour * 24 * 7
+	if strs.AllNotEmpty(pc.Ttl) {
+		ttl, err := parseDuration(pc.Ttl)
+		if err != nil {
+			return fmt.Errorf("ttl 配置错误: %v", err)
+		}
+		pc.ttl = ttl
+	}
+	return nil
+}
+
+// TtlDuration 获取缓存的有效期
+func (pc *PathCache) TtlDuration() time.Duration {
+	return pc.ttl
+}
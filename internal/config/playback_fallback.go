@@ -0,0 +1,43 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// PlaybackFallback 直链播放失败时的降级配置
+//
+// 客户端上报直链资源播放失败后, 在冷却时间内该客户端再次播放同一个资源时
+// 优先使用转码资源, 请求原画时由源服务器串流, 不再重定向到网盘直链
+type PlaybackFallback struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Cooldown 资源降级的持续时间, 默认 30m
+	Cooldown string `yaml:"cooldown"`
+
+	// cooldown 配置初始化转换之后的标准时间对象
+	cooldown time.Duration
+}
+
+// Init 配置初始化
+func (pf *PlaybackFallback) Init() error {
+	pf.cooldown = time.Minute * 30
+	if strs.AllNotEmpty(pf.Cooldown) {
+		cooldown, err := parseDuration(pf.Cooldown)
+		if err != nil {
+			return fmt.Errorf("playback-fallback.cooldown 配置错误: %v", err)
+		}
+		if cooldown <= 0 {
+			return fmt.Errorf("playback-fallback.cooldown 配置错误: %s", pf.Cooldown)
+		}
+		pf.cooldown = cooldown
+	}
+	return nil
+}
+
+// CooldownDuration 获取资源降级的持续时间
+func (pf *PlaybackFallback) CooldownDuration() time.Duration {
+	return pf.cooldown
+}
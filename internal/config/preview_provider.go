@@ -0,0 +1,83 @@
+package config
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// PreviewProviderType 网盘原生转码接口的类型
+type PreviewProviderType string
+
+const (
+	PreviewProviderAliyun PreviewProviderType = "aliyun" // 阿里云盘开放平台
+	PreviewProvider115    PreviewProviderType = "115"    // 115 网盘
+)
+
+// PreviewProvider 网盘原生的转码预览接口
+//
+// alist 只返回网盘部分清晰度的转码资源, 配置后匹配 Prefix 的 alist 路径直接请求网盘的转码接口,
+// 请求失败时回退到 alist
+type PreviewProvider struct {
+	// Type 网盘类型: aliyun, 115
+	Type PreviewProviderType `yaml:"type"`
+	// Prefix 由当前网盘处理的 alist 路径前缀, 即网盘在 alist 中的挂载路径
+	Prefix string `yaml:"prefix"`
+	// Root alist 挂载的网盘目录, 网盘中的路径 = Root + 去掉 Prefix 之后的 alist 路径
+	Root string `yaml:"root"`
+
+	// ClientId 阿里云盘开放平台应用的 client id
+	ClientId string `yaml:"client-id"`
+	// ClientSecret 阿里云盘开放平台应用的 client secret
+	ClientSecret string `yaml:"client-secret"`
+	// RefreshToken 阿里云盘开放平台的 refresh token
+	RefreshToken string `yaml:"refresh-token"`
+	// Drive 阿里云盘使用的空间: default (备份盘), resource (资源库)
+	Drive string `yaml:"drive"`
+
+	// Cookie 115 网盘的登录 cookie
+	Cookie string `yaml:"cookie"`
+}
+
+// Init 配置初始化
+func (pp *PreviewProvider) Init() error {
+	pp.Type = PreviewProviderType(strings.ToLower(strings.TrimSpace(string(pp.Type))))
+	if strs.AnyEmpty(pp.Prefix) {
+		return fmt.Errorf("prefix 不能为空")
+	}
+	pp.Prefix = path.Clean("/" + pp.Prefix)
+	pp.Root = path.Clean("/" + pp.Root)
+
+	switch pp.Type {
+	case PreviewProviderAliyun:
+		if strs.AnyEmpty(pp.ClientId, pp.ClientSecret, pp.RefreshToken) {
+			return fmt.Errorf("aliyun 类型需要配置 client-id, client-secret, refresh-token")
+		}
+		pp.Drive = strings.ToLower(strings.TrimSpace(pp.Drive))
+		if strs.AnyEmpty(pp.Drive) {
+			pp.Drive = "resource"
+		}
+		if pp.Drive != "default" && pp.Drive != "resource" {
+			return fmt.Errorf("drive 配置错误: %s", pp.Drive)
+		}
+	case PreviewProvider115:
+		if strs.AnyEmpty(pp.Cookie) {
+			return fmt.Errorf("115 类型需要配置 cookie")
+		}
+	default:
+		return fmt.Errorf("不支持的类型: %s", pp.Type)
+	}
+	return nil
+}
+
+// DrivePath 将 alist 路径转换为网盘中的路径, 路径不匹配 Prefix 时返回 false
+func (pp *PreviewProvider) DrivePath(alistPath string) (string, bool) {
+	alistPath = path.Clean("/" + alistPath)
+	if pp.Prefix != "/" && alistPath != pp.Prefix && !strings.HasPrefix(alistPath, pp.Prefix+"/") {
+		return "", false
+	}
+	rel := strings.TrimPrefix(alistPath, pp.Prefix)
+	return path.Join(pp.Root, rel), true
+}
@@ -0,0 +1,66 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// Probe 客户端带宽测速配置
+//
+// 客户端请求 /probe 接口测量与本程序之间的带宽, 开启 auto 后,
+// 根据测速结果为每个设备自动选择重定向到网盘直链还是由服务器中转
+type Probe struct {
+	// Enable 是否启用测速接口
+	Enable bool `yaml:"enable"`
+	// MaxSize 单次测速允许传输的最大数据量, 默认 8MB
+	MaxSize string `yaml:"max-size"`
+	// Auto 是否根据测速结果自动选择播放链接
+	Auto bool `yaml:"auto"`
+	// ProxyThreshold 测得的带宽 (Mbps) 不低于该值时, 使用 alist 本地代理链接由服务器中转, 否则重定向到网盘直链
+	ProxyThreshold float64 `yaml:"proxy-threshold"`
+	// Ttl 测速结果的有效期, 默认 30m
+	Ttl string `yaml:"ttl"`
+
+	// maxSize 配置初始化转换之后的字节数
+	maxSize int64
+	// ttl 配置初始化转换之后的标准时间对象
+	ttl time.Duration
+}
+
+// Init 配置初始化
+func (p *Probe) Init() error {
+	p.maxSize = 8 * sizeMap["MB"]
+	if strs.AllNotEmpty(p.MaxSize) {
+		size, err := parseSize(p.MaxSize)
+		if err != nil {
+			return fmt.Errorf("probe.max-size 配置错误: %v", err)
+		}
+		p.maxSize = size
+	}
+
+	p.ttl = time.Minute * 30
+	if strs.AllNotEmpty(p.Ttl) {
+		ttl, err := parseDuration(p.Ttl)
+		if err != nil {
+			return fmt.Errorf("probe.ttl 配置错误: %v", err)
+		}
+		p.ttl = ttl
+	}
+
+	if p.Auto && p.ProxyThreshold <= 0 {
+		return fmt.Errorf("probe.proxy-threshold 配置错误, 开启 auto 时需大于 0: %v", p.ProxyThreshold)
+	}
+	return nil
+}
+
+// MaxSizeBytes 获取单次测速允许传输的最大字节数
+func (p *Probe) MaxSizeBytes() int64 {
+	return p.maxSize
+}
+
+// TtlDuration 获取测速结果的有效期
+func (p *Probe) TtlDuration() time.Duration {
+	return p.ttl
+}
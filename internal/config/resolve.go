@@ -0,0 +1,148 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+)
+
+// ResolveStep 直链解析步骤
+type ResolveStep string
+
+const (
+	ResolveAlistRaw   ResolveStep = "alist-raw"   // 重定向到 alist 网盘直链
+	ResolveAlistProxy ResolveStep = "alist-proxy" // 重定向到 alist 本地代理链接
+	ResolveLocal      ResolveStep = "local"       // 直接读取本地挂载的文件
+	ResolveOrigin     ResolveStep = "origin"      // 由 emby 源服务器串流
+
+	// ResolveCdn 重定向到 CDN 前缀拼接的 alist 代理链接, 仅由 geo 规则启用, 不支持在 resolve.chain 中配置
+	ResolveCdn ResolveStep = "cdn"
+)
+
+// validResolveSteps 用于校验用户配置的解析步骤是否合法
+var validResolveSteps = map[ResolveStep]struct{}{
+	ResolveAlistRaw: {}, ResolveAlistProxy: {}, ResolveLocal: {}, ResolveOrigin: {},
+}
+
+// localMount 一条本地挂载路径映射
+type localMount struct {
+	emby  string // emby 路径前缀
+	local string // 本地挂载路径前缀
+}
+
+// Resolve 直链解析配置
+type Resolve struct {
+	// Chain 直链解析步骤, 按顺序尝试, 某一步失败时自动尝试下一步
+	Chain []ResolveStep `yaml:"chain"`
+	// StepTimeout alist 解析 (alist-raw, alist-proxy, cdn 共用) 的超时时间
+	//
+	// local 和 origin 步骤直接向客户端传输媒体, 传输时长取决于媒体大小, 不受该超时限制
+	StepTimeout string `yaml:"step-timeout"`
+	// HedgeDelay alist 解析耗时超过该值时, 并发发起第二次解析, 使用先成功的结果, 不配置表示不启用
+	HedgeDelay string `yaml:"hedge-delay"`
+	// Probe 重定向到 alist 链接之前, 是否先探测链接是否可用
+	Probe bool `yaml:"probe"`
+	// ProbeTimeout 探测链接的超时时间, 超时后不再等待, 直接使用该链接
+	ProbeTimeout string `yaml:"probe-timeout"`
+	// LocalMounts emby 路径前缀映射到本地挂载路径前缀, 两个路径使用 : 符号隔开
+	LocalMounts []string `yaml:"local-mounts"`
+
+	// stepTimeout 配置初始化转换之后的标准时间对象
+	stepTimeout time.Duration
+	// hedgeDelay 配置初始化转换之后的标准时间对象, 零值表示不启用
+	hedgeDelay time.Duration
+	// probeTimeout 配置初始化转换之后的标准时间对象
+	probeTimeout time.Duration
+	// localMounts 根据 LocalMounts 转换的前缀映射, 按照 emby 路径前缀从长到短排列
+	localMounts []localMount
+}
+
+// Init 配置初始化
+func (r *Resolve) Init() error {
+	if len(r.Chain) == 0 {
+		// 默认只使用 alist 直链, 失败时交由 emby.proxy-error-strategy 处理
+		r.Chain = []ResolveStep{ResolveAlistRaw}
+	}
+	for i, step := range r.Chain {
+		step = ResolveStep(strings.ToLower(strings.TrimSpace(string(step))))
+		if _, ok := validResolveSteps[step]; !ok {
+			return fmt.Errorf("resolve.chain 配置错误, 不支持的步骤: %s", step)
+		}
+		r.Chain[i] = step
+	}
+
+	r.stepTimeout = time.Second * 10
+	if strs.AllNotEmpty(r.StepTimeout) {
+		timeout, err := parseDuration(r.StepTimeout)
+		if err != nil {
+			return fmt.Errorf("resolve.step-timeout 配置错误: %v", err)
+		}
+		r.stepTimeout = timeout
+	}
+
+	if strs.AllNotEmpty(r.HedgeDelay) {
+		delay, err := parseDuration(r.HedgeDelay)
+		if err != nil {
+			return fmt.Errorf("resolve.hedge-delay 配置错误: %v", err)
+		}
+		// 第二次解析需要在步骤超时之前发起, 否则只会在请求结束之后空跑
+		if delay >= r.stepTimeout {
+			return fmt.Errorf("resolve.hedge-delay 配置错误: 需要小于 step-timeout (%v)", r.stepTimeout)
+		}
+		r.hedgeDelay = delay
+	}
+
+	r.probeTimeout = time.Second * 3
+	if strs.AllNotEmpty(r.ProbeTimeout) {
+		timeout, err := parseDuration(r.ProbeTimeout)
+		if err != nil {
+			return fmt.Errorf("resolve.probe-timeout 配置错误: %v", err)
+		}
+		r.probeTimeout = timeout
+	}
+
+	r.localMounts = make([]localMount, 0, len(r.LocalMounts))
+	for _, mount := range r.LocalMounts {
+		from, to, ok := splitMapping(mount)
+		if !ok || strs.AnyEmpty(from, to) {
+			return errors.New("resolve.local-mounts 配置错误, " + mount + " 无法根据 ':' 进行分割")
+		}
+		r.localMounts = append(r.localMounts, localMount{emby: urls.TransferSlash(from), local: to})
+	}
+	// 前缀存在包含关系时 (如 /media 和 /media/tv), 优先匹配更长的前缀
+	sort.SliceStable(r.localMounts, func(i, j int) bool { return len(r.localMounts[i].emby) > len(r.localMounts[j].emby) })
+	return nil
+}
+
+// StepTimeoutDuration 获取每一个步骤的超时时间
+func (r *Resolve) StepTimeoutDuration() time.Duration {
+	return r.stepTimeout
+}
+
+// HedgeDelayDuration 获取发起第二次 alist 解析的等待时间, 返回零值表示不启用
+func (r *Resolve) HedgeDelayDuration() time.Duration {
+	return r.hedgeDelay
+}
+
+// ProbeTimeoutDuration 获取探测链接的超时时间
+func (r *Resolve) ProbeTimeoutDuration() time.Duration {
+	return r.probeTimeout
+}
+
+// MapLocal 将 emby 路径映射成本地挂载路径
+//
+// 没有匹配的映射时, 认为本地路径与 emby 路径一致
+func (r *Resolve) MapLocal(embyPath string) string {
+	embyPath = urls.TransferSlash(embyPath)
+	for _, m := range r.localMounts {
+		if strings.HasPrefix(embyPath, m.emby) {
+			return m.local + strings.TrimPrefix(embyPath, m.emby)
+		}
+	}
+	return embyPath
+}
@@ -0,0 +1,118 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/expr"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// RewriteAction 请求重写之后的处理方式
+type RewriteAction string
+
+const (
+	RewriteContinue RewriteAction = "continue" // 继续按照正常逻辑处理
+	RewriteOrigin   RewriteAction = "origin"   // 跳过代理逻辑, 直接回源
+)
+
+// validRewriteAction 用于校验用户配置的处理方式是否合法
+var validRewriteAction = map[RewriteAction]struct{}{
+	RewriteContinue: {}, RewriteOrigin: {},
+}
+
+// Rewrite 请求重写配置, 按照条件表达式改写请求, 用于兼容个别客户端的特殊行为
+type Rewrite struct {
+	// Rules 重写规则, 自上而下依次匹配, 所有满足条件的规则都会生效
+	Rules []*RewriteRule `yaml:"rules"`
+}
+
+// RewriteRule 请求重写规则
+type RewriteRule struct {
+	// Name 规则名称, 用于输出日志
+	Name string `yaml:"name"`
+	// When 条件表达式, 满足条件时才会重写请求
+	When string `yaml:"when"`
+	// SetHeader 设置请求头
+	SetHeader map[string]string `yaml:"set-header"`
+	// DelHeader 删除请求头
+	DelHeader []string `yaml:"del-header"`
+	// SetQuery 设置 query 参数
+	SetQuery map[string]string `yaml:"set-query"`
+	// DelQuery 删除 query 参数
+	DelQuery []string `yaml:"del-query"`
+	// Path 请求路径替换规则, 格式: 正则表达式 => 替换内容, 替换内容中可使用 $1 引用分组
+	Path string `yaml:"path"`
+	// Action 重写之后的处理方式
+	Action RewriteAction `yaml:"action"`
+
+	// when 编译之后的条件表达式
+	when *expr.Expr
+	// pathFrom 请求路径替换的正则表达式
+	pathFrom *regexp.Regexp
+	// pathTo 请求路径替换的替换内容
+	pathTo string
+}
+
+// Init 配置初始化
+func (r *Rewrite) Init() error {
+	for i, rule := range r.Rules {
+		if rule == nil {
+			return fmt.Errorf("rewrite.rules[%d] 配置不能为空", i)
+		}
+		if err := rule.init(); err != nil {
+			return fmt.Errorf("rewrite.rules[%d] 配置错误: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// init 初始化规则, 编译条件表达式和路径替换规则
+func (rr *RewriteRule) init() error {
+	if strs.AnyEmpty(rr.Name) {
+		rr.Name = rr.When
+	}
+	if strs.AnyEmpty(rr.When) {
+		return fmt.Errorf("when 不能为空")
+	}
+	when, err := expr.Compile(rr.When)
+	if err != nil {
+		return fmt.Errorf("when 表达式错误: %v", err)
+	}
+	rr.when = when
+
+	if strs.AllNotEmpty(rr.Path) {
+		from, to, ok := strings.Cut(rr.Path, "=>")
+		if !ok {
+			return fmt.Errorf("path 配置不规范: %s, 请使用 => 进行分割", rr.Path)
+		}
+		reg, err := regexp.Compile(strings.TrimSpace(from))
+		if err != nil {
+			return fmt.Errorf("path 正则表达式编译失败: %v", err)
+		}
+		rr.pathFrom, rr.pathTo = reg, strings.TrimSpace(to)
+	}
+
+	rr.Action = RewriteAction(strings.ToLower(strings.TrimSpace(string(rr.Action))))
+	if strs.AnyEmpty(string(rr.Action)) {
+		rr.Action = RewriteContinue
+	}
+	if _, ok := validRewriteAction[rr.Action]; !ok {
+		return fmt.Errorf("action 配置错误: %s", rr.Action)
+	}
+	return nil
+}
+
+// Match 判断请求是否满足规则的条件
+func (rr *RewriteRule) Match(vars expr.Vars) bool {
+	return rr.when.Eval(vars)
+}
+
+// RewritePath 按照规则替换请求路径, 没有配置替换规则时原样返回
+func (rr *RewriteRule) RewritePath(path string) string {
+	if rr.pathFrom == nil {
+		return path
+	}
+	return rr.pathFrom.ReplaceAllString(path, rr.pathTo)
+}
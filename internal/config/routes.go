@@ -0,0 +1,126 @@
+package config
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// RouteHandler 自定义路由的处理方式
+type RouteHandler string
+
+const (
+	RouteRawProxy       RouteHandler = "raw-proxy"       // 原样代理到目标地址
+	RouteRedirect       RouteHandler = "redirect"        // 重定向到目标地址
+	RouteStaticResponse RouteHandler = "static-response" // 返回固定的响应
+)
+
+// validRouteHandler 用于校验用户配置的处理方式是否合法
+var validRouteHandler = map[RouteHandler]struct{}{
+	RouteRawProxy: {}, RouteRedirect: {}, RouteStaticResponse: {},
+}
+
+// Routes 自定义路由配置, 用于覆盖程序尚未适配的接口
+type Routes struct {
+	// Rules 自定义路由规则, 自上而下匹配第一个满足条件的规则, 优先于内置路由
+	Rules []*CustomRoute `yaml:"rules"`
+}
+
+// CustomRoute 自定义路由规则
+type CustomRoute struct {
+	// Name 规则名称, 用于输出日志
+	Name string `yaml:"name"`
+	// Method 请求方法, 多个使用逗号分隔, 为空时匹配所有方法
+	Method string `yaml:"method"`
+	// Pattern 匹配请求 RequestURI 的正则表达式
+	Pattern string `yaml:"pattern"`
+	// Handler 处理方式
+	Handler RouteHandler `yaml:"handler"`
+	// Target 目标地址模板, raw-proxy 为空时代理到 emby 的原始地址, redirect 必须配置
+	Target string `yaml:"target"`
+	// Status 响应码, redirect 默认为 302, static-response 默认为 200
+	Status int `yaml:"status"`
+	// Headers 设置的响应头, 值支持模板
+	Headers map[string]string `yaml:"headers"`
+	// Body static-response 的响应体模板
+	Body string `yaml:"body"`
+
+	// methods 允许的请求方法
+	methods map[string]struct{}
+	// pattern 编译之后的正则表达式
+	pattern *regexp.Regexp
+}
+
+// Init 配置初始化
+func (r *Routes) Init() error {
+	for i, route := range r.Rules {
+		if route == nil {
+			return fmt.Errorf("routes.rules[%d] 配置不能为空", i)
+		}
+		if err := route.init(); err != nil {
+			return fmt.Errorf("routes.rules[%d] 配置错误: %v", i, err)
+		}
+	}
+	return nil
+}
+
+// init 初始化规则, 编译正则表达式并填充默认值
+func (cr *CustomRoute) init() error {
+	if strs.AnyEmpty(cr.Pattern) {
+		return fmt.Errorf("pattern 不能为空")
+	}
+	reg, err := regexp.Compile(cr.Pattern)
+	if err != nil {
+		return fmt.Errorf("pattern 正则表达式编译失败: %v", err)
+	}
+	cr.pattern = reg
+	if strs.AnyEmpty(cr.Name) {
+		cr.Name = cr.Pattern
+	}
+
+	cr.methods = make(map[string]struct{})
+	for _, m := range strings.Split(cr.Method, ",") {
+		if m = strings.ToUpper(strings.TrimSpace(m)); m != "" {
+			cr.methods[m] = struct{}{}
+		}
+	}
+
+	cr.Handler = RouteHandler(strings.ToLower(strings.TrimSpace(string(cr.Handler))))
+	if _, ok := validRouteHandler[cr.Handler]; !ok {
+		return fmt.Errorf("handler 配置错误: %s", cr.Handler)
+	}
+	switch cr.Handler {
+	case RouteRedirect:
+		if strs.AnyEmpty(cr.Target) {
+			return fmt.Errorf("redirect 的 target 不能为空")
+		}
+		if cr.Status == 0 {
+			cr.Status = http.StatusFound
+		}
+	case RouteStaticResponse:
+		if cr.Status == 0 {
+			cr.Status = http.StatusOK
+		}
+	}
+	if cr.Status != 0 && (cr.Status < 100 || cr.Status > 599) {
+		return fmt.Errorf("status 配置错误: %d", cr.Status)
+	}
+	return nil
+}
+
+// Match 判断请求是否匹配规则, 匹配成功时返回正则表达式的分组
+func (cr *CustomRoute) Match(method, uri string) ([]int, bool) {
+	if _, ok := cr.methods[strings.ToUpper(method)]; len(cr.methods) > 0 && !ok {
+		return nil, false
+	}
+	loc := cr.pattern.FindStringSubmatchIndex(uri)
+	return loc, loc != nil
+}
+
+// Expand 使用正则表达式的分组填充模板, 模板中可使用 $1 或 ${name} 引用分组
+func (cr *CustomRoute) Expand(tmpl, uri string, match []int) string {
+	return string(cr.pattern.ExpandString(nil, tmpl, uri, match))
+}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"sync/atomic"
+)
+
+// sensitiveKeySegments 敏感配置项名称中的关键词, 日志脱敏和配置展示共用同一份规则
+//
+// 按照 yaml 名称中以 - 分隔的完整片段匹配, 如: api-key, bot-token, 避免名称中恰好包含关键词的配置项被误判
+var sensitiveKeySegments = map[string]struct{}{
+	"token":    {},
+	"key":      {},
+	"password": {},
+	"secret":   {},
+	"dsn":      {},
+}
+
+// nonSensitiveKeys 名称符合规则但不是密钥的配置项 (完整路径)
+var nonSensitiveKeys = map[string]struct{}{
+	// 私钥的文件名称, 不是私钥内容
+	"ssl.key": {},
+}
+
+// secretsCache 缓存的敏感配置项的值, 只在配置重新加载之后重新计算
+type secretsCache struct {
+	// cfg 计算时使用的配置
+	cfg *Config
+	// secrets 敏感配置项的值
+	secrets []string
+}
+
+// cachedSecrets 当前配置的敏感配置项的值
+var cachedSecrets atomic.Pointer[secretsCache]
+
+// IsSensitiveKey 判断配置项是否为敏感配置
+//
+// path 为以 . 分隔的 yaml 名称完整路径, 如: emby.api-key
+func IsSensitiveKey(path string) bool {
+	if _, ok := nonSensitiveKeys[path]; ok {
+		return false
+	}
+	name := path[strings.LastIndex(path, ".")+1:]
+	for _, seg := range strings.Split(strings.ToLower(name), "-") {
+		if _, ok := sensitiveKeySegments[seg]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// Secrets 获取当前配置中所有敏感配置项的非空值, 包括出站代理地址中的密码
+//
+// 按照 yaml 名称匹配, 后续新增的密钥类配置只要名称符合规则即可自动纳入;
+// 结果在配置加载之后计算一次, 配置对象被替换时重新计算
+func Secrets() []string {
+	c := C
+	if c == nil {
+		return nil
+	}
+	if sc := cachedSecrets.Load(); sc != nil && sc.cfg == c {
+		return sc.secrets
+	}
+	return refreshSecrets(c)
+}
+
+// refreshSecrets 重新计算 c 中敏感配置项的值并缓存
+func refreshSecrets(c *Config) []string {
+	secrets := make([]string, 0)
+	collectSecrets(reflect.ValueOf(c), "", &secrets)
+	if c.Network != nil && c.Network.Proxy.Enabled() {
+		if pwd, ok := c.Network.Proxy.ProxyUrl().User.Password(); ok && pwd != "" {
+			secrets = append(secrets, pwd)
+		}
+	}
+	cachedSecrets.Store(&secretsCache{cfg: c, secrets: secrets})
+	return secrets
+}
+
+// collectSecrets 递归收集 v 中敏感配置项的值, path 为 v 所属的配置项路径
+func collectSecrets(v reflect.Value, path string, secrets *[]string) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if !v.IsNil() {
+			collectSecrets(v.Elem(), path, secrets)
+		}
+	case reflect.Struct:
+		t := v.Type()
+		for i := 0; i < v.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			if path != "" {
+				name = path + "." + name
+			}
+			collectSecrets(v.Field(i), name, secrets)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			collectSecrets(v.Index(i), path, secrets)
+		}
+	case reflect.Map:
+		iter := v.MapRange()
+		for iter.Next() {
+			collectSecrets(iter.Value(), path, secrets)
+		}
+	case reflect.String:
+		if s := v.String(); s != "" && IsSensitiveKey(path) {
+			*secrets = append(*secrets, s)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// Sentry 异常上报配置
+type Sentry struct {
+	// Enable 是否启用异常上报
+	Enable bool `yaml:"enable"`
+	// Dsn sentry 项目的 DSN 地址
+	Dsn string `yaml:"dsn"`
+	// Environment 上报时附带的环境标识
+	Environment string `yaml:"environment"`
+
+	// storeUrl 由 DSN 解析出的事件上报地址
+	storeUrl string
+	// publicKey 由 DSN 解析出的项目公钥
+	publicKey string
+}
+
+// Init 配置初始化
+func (s *Sentry) Init() error {
+	if strs.AnyEmpty(s.Environment) {
+		s.Environment = "production"
+	}
+	if !s.Enable {
+		return nil
+	}
+	if strs.AnyEmpty(s.Dsn) {
+		return errors.New("sentry 已启用, 但 dsn 未配置")
+	}
+
+	// dsn 格式: {scheme}://{public_key}@{host}/{project_id}
+	u, err := url.Parse(s.Dsn)
+	if err != nil {
+		return fmt.Errorf("sentry.dsn 配置错误: %v", err)
+	}
+	if u.User == nil || strs.AnyEmpty(u.User.Username(), u.Host) {
+		return errors.New("sentry.dsn 配置错误: 缺少公钥或主机地址")
+	}
+	path := strings.TrimSuffix(u.Path, "/")
+	idx := strings.LastIndex(path, "/")
+	projectId := path[idx+1:]
+	if strs.AnyEmpty(projectId) {
+		return errors.New("sentry.dsn 配置错误: 缺少项目 id")
+	}
+
+	s.publicKey = u.User.Username()
+	s.storeUrl = fmt.Sprintf("%s://%s%s/api/%s/store/", u.Scheme, u.Host, path[:idx], projectId)
+	return nil
+}
+
+// StoreUrl 获取事件上报地址
+func (s *Sentry) StoreUrl() string {
+	return s.storeUrl
+}
+
+// PublicKey 获取项目公钥
+func (s *Sentry) PublicKey() string {
+	return s.publicKey
+}
@@ -0,0 +1,130 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// Server 本程序 http/https 服务的防护配置
+//
+// 部署在公网时, 用于限制请求头/请求体大小, 读写超时以及并发连接数, 防止异常客户端耗尽资源
+type Server struct {
+	// ReadHeaderTimeout 读取请求头的超时时间, 默认 10s, 用于防护 slowloris 慢速攻击
+	ReadHeaderTimeout string `yaml:"read-header-timeout"`
+	// ReadTimeout 读取整个请求 (包括请求体) 的超时时间, 为空表示不限制
+	ReadTimeout string `yaml:"read-timeout"`
+	// WriteTimeout 写入响应的超时时间, 为空表示不限制
+	//
+	// 经过本程序中转的串流响应时间很长, 配置过小会导致播放中断
+	WriteTimeout string `yaml:"write-timeout"`
+	// IdleTimeout keep-alive 连接的空闲超时时间, 默认 2m
+	IdleTimeout string `yaml:"idle-timeout"`
+	// MaxHeaderSize 请求头的最大大小, 默认 1MB
+	MaxHeaderSize string `yaml:"max-header-size"`
+	// MaxBodySize 请求体的最大大小, 如: 20MB, 为空表示不限制, 超出时响应 413
+	MaxBodySize string `yaml:"max-body-size"`
+	// MaxConns 最大并发连接数, 达到上限后新连接等待已有连接关闭, 0 表示不限制
+	MaxConns int `yaml:"max-conns"`
+	// MaxConnsPerIp 单个 ip 的最大并发连接数, 超出时直接关闭新连接, 0 表示不限制
+	MaxConnsPerIp int `yaml:"max-conns-per-ip"`
+
+	// readHeaderTimeout 配置初始化转换之后的标准时间对象
+	readHeaderTimeout time.Duration
+	// readTimeout 配置初始化转换之后的标准时间对象
+	readTimeout time.Duration
+	// writeTimeout 配置初始化转换之后的标准时间对象
+	writeTimeout time.Duration
+	// idleTimeout 配置初始化转换之后的标准时间对象
+	idleTimeout time.Duration
+	// maxHeaderSize 配置初始化转换之后的字节数
+	maxHeaderSize int64
+	// maxBodySize 配置初始化转换之后的字节数
+	maxBodySize int64
+}
+
+// Init 配置初始化
+func (s *Server) Init() error {
+	durations := []struct {
+		name  string
+		str   string
+		dft   time.Duration
+		value *time.Duration
+	}{
+		{"read-header-timeout", s.ReadHeaderTimeout, time.Second * 10, &s.readHeaderTimeout},
+		{"read-timeout", s.ReadTimeout, 0, &s.readTimeout},
+		{"write-timeout", s.WriteTimeout, 0, &s.writeTimeout},
+		{"idle-timeout", s.IdleTimeout, time.Minute * 2, &s.idleTimeout},
+	}
+	for _, d := range durations {
+		*d.value = d.dft
+		if strs.AnyEmpty(d.str) {
+			continue
+		}
+		value, err := parseDuration(d.str)
+		if err != nil {
+			return fmt.Errorf("server.%s 配置错误: %v", d.name, err)
+		}
+		*d.value = value
+	}
+
+	sizes := []struct {
+		name  string
+		str   string
+		dft   int64
+		value *int64
+	}{
+		{"max-header-size", s.MaxHeaderSize, 1024 * 1024, &s.maxHeaderSize},
+		{"max-body-size", s.MaxBodySize, 0, &s.maxBodySize},
+	}
+	for _, sz := range sizes {
+		*sz.value = sz.dft
+		if strs.AnyEmpty(sz.str) {
+			continue
+		}
+		value, err := parseSize(sz.str)
+		if err != nil {
+			return fmt.Errorf("server.%s 配置错误: %v", sz.name, err)
+		}
+		*sz.value = value
+	}
+
+	if s.MaxConns < 0 {
+		return fmt.Errorf("server.max-conns 不能小于 0")
+	}
+	if s.MaxConnsPerIp < 0 {
+		return fmt.Errorf("server.max-conns-per-ip 不能小于 0")
+	}
+	return nil
+}
+
+// ReadHeaderTimeoutDuration 获取读取请求头的超时时间
+func (s *Server) ReadHeaderTimeoutDuration() time.Duration {
+	return s.readHeaderTimeout
+}
+
+// ReadTimeoutDuration 获取读取整个请求的超时时间, 0 表示不限制
+func (s *Server) ReadTimeoutDuration() time.Duration {
+	return s.readTimeout
+}
+
+// WriteTimeoutDuration 获取写入响应的超时时间, 0 表示不限制
+func (s *Server) WriteTimeoutDuration() time.Duration {
+	return s.writeTimeout
+}
+
+// IdleTimeoutDuration 获取 keep-alive 连接的空闲超时时间
+func (s *Server) IdleTimeoutDuration() time.Duration {
+	return s.idleTimeout
+}
+
+// MaxHeaderBytes 获取请求头的最大字节数
+func (s *Server) MaxHeaderBytes() int64 {
+	return s.maxHeaderSize
+}
+
+// MaxBodyBytes 获取请求体的最大字节数, 0 表示不限制
+func (s *Server) MaxBodyBytes() int64 {
+	return s.maxBodySize
+}
@@ -0,0 +1,90 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// Shadow 请求影子配置
+//
+// 升级 emby 之前, 按比例将只读请求同时发送到源服务器和预发布服务器, 对比两者响应的结构差异并输出日志,
+// 用于发现新版本中会导致代理改写失效的接口变化; 影子请求在后台执行, 不影响客户端的响应
+type Shadow struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Host 预发布 emby 服务器的访问地址
+	Host string `yaml:"host"`
+	// Percent 采样百分比, 允许配置范围: [1, 100]
+	Percent int `yaml:"percent"`
+	// Routes 需要影子的路由, 匹配请求 RequestURI 的正则表达式, 为空时影子所有只读的接口请求
+	Routes []string `yaml:"routes"`
+	// Concurrency 同时进行的影子请求个数, 超出时丢弃新的采样
+	Concurrency int `yaml:"concurrency"`
+	// MaxBodySize 参与对比的响应体最大大小, 超出时只对比响应码
+	MaxBodySize string `yaml:"max-body-size"`
+
+	// routes 编译之后的路由正则表达式
+	routes []*regexp.Regexp
+	// maxBodySize 配置初始化转换之后的字节数
+	maxBodySize int64
+}
+
+// Init 配置初始化
+func (s *Shadow) Init() error {
+	if s.Percent == 0 {
+		s.Percent = 10
+	}
+	if s.Percent < 1 || s.Percent > 100 {
+		return fmt.Errorf("shadow.percent 配置错误: %d, 允许配置范围: [1, 100]", s.Percent)
+	}
+	if s.Concurrency == 0 {
+		s.Concurrency = 4
+	}
+	if s.Concurrency < 0 {
+		return fmt.Errorf("shadow.concurrency 配置错误: %d, 不能小于 0", s.Concurrency)
+	}
+
+	s.routes = make([]*regexp.Regexp, 0, len(s.Routes))
+	for _, r := range s.Routes {
+		reg, err := regexp.Compile(r)
+		if err != nil {
+			return fmt.Errorf("shadow.routes 正则表达式编译失败: %s, err: %v", r, err)
+		}
+		s.routes = append(s.routes, reg)
+	}
+
+	if strs.AnyEmpty(s.MaxBodySize) {
+		s.MaxBodySize = "1MB"
+	}
+	size, err := parseSize(s.MaxBodySize)
+	if err != nil {
+		return fmt.Errorf("shadow.max-body-size 配置错误: %v", err)
+	}
+	s.maxBodySize = size
+
+	if s.Enable && strs.AnyEmpty(s.Host) {
+		return errors.New("shadow.host 启用时不能为空")
+	}
+	return nil
+}
+
+// Match 判断请求是否在影子的路由范围内, 未配置路由时返回 true
+func (s *Shadow) Match(uri string) bool {
+	if len(s.routes) == 0 {
+		return true
+	}
+	for _, reg := range s.routes {
+		if reg.MatchString(uri) {
+			return true
+		}
+	}
+	return false
+}
+
+// MaxBodySizeBytes 获取参与对比的响应体最大字节数
+func (s *Shadow) MaxBodySizeBytes() int64 {
+	return s.maxBodySize
+}
@@ -0,0 +1,98 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// StartupAction 等待依赖服务超时后的处理方式
+type StartupAction string
+
+const (
+	StartupServe StartupAction = "serve" // 忽略未就绪的依赖服务, 开始处理请求
+	StartupExit  StartupAction = "exit"  // 退出程序, 交由 docker 等进程管理工具重启
+)
+
+// validStartupAction 用于校验用户配置的处理方式是否合法
+var validStartupAction = map[StartupAction]struct{}{
+	StartupServe: {}, StartupExit: {},
+}
+
+// Startup 启动配置
+//
+// 启用等待后, 程序启动时先探测 emby 和 alist 是否可用, 全部可用之后才开始处理请求,
+// 等待期间 /healthz 返回未就绪, 其余请求返回 503
+type Startup struct {
+	// Wait 是否等待依赖服务就绪
+	Wait bool `yaml:"wait"`
+	// Timeout 最长等待时间
+	Timeout string `yaml:"timeout"`
+	// Interval 首次重试的间隔, 之后每次翻倍
+	Interval string `yaml:"interval"`
+	// MaxInterval 重试间隔的上限
+	MaxInterval string `yaml:"max-interval"`
+	// OnTimeout 等待超时后的处理方式
+	OnTimeout StartupAction `yaml:"on-timeout"`
+
+	// timeout 配置初始化转换之后的标准时间对象
+	timeout time.Duration
+	// interval 配置初始化转换之后的标准时间对象
+	interval time.Duration
+	// maxInterval 配置初始化转换之后的标准时间对象
+	maxInterval time.Duration
+}
+
+// Init 配置初始化
+func (s *Startup) Init() error {
+	durations := []struct {
+		name  string
+		str   string
+		dft   time.Duration
+		value *time.Duration
+	}{
+		{"timeout", s.Timeout, time.Minute * 5, &s.timeout},
+		{"interval", s.Interval, time.Second * 2, &s.interval},
+		{"max-interval", s.MaxInterval, time.Second * 30, &s.maxInterval},
+	}
+	for _, d := range durations {
+		*d.value = d.dft
+		if strs.AnyEmpty(d.str) {
+			continue
+		}
+		value, err := parseDuration(d.str)
+		if err != nil {
+			return fmt.Errorf("startup.%s 配置错误: %v", d.name, err)
+		}
+		*d.value = value
+	}
+	if s.maxInterval < s.interval {
+		s.maxInterval = s.interval
+	}
+
+	s.OnTimeout = StartupAction(strings.TrimSpace(string(s.OnTimeout)))
+	if strs.AnyEmpty(string(s.OnTimeout)) {
+		s.OnTimeout = StartupServe
+	}
+	if _, ok := validStartupAction[s.OnTimeout]; !ok {
+		return fmt.Errorf("startup.on-timeout 配置错误: %s", s.OnTimeout)
+	}
+	return nil
+}
+
+// TimeoutDuration 获取最长等待时间
+func (s *Startup) TimeoutDuration() time.Duration {
+	return s.timeout
+}
+
+// IntervalDuration 获取首次重试的间隔
+func (s *Startup) IntervalDuration() time.Duration {
+	return s.interval
+}
+
+// MaxIntervalDuration 获取重试间隔的上限
+func (s *Startup) MaxIntervalDuration() time.Duration {
+	return s.maxInterval
+}
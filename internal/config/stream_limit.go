@@ -0,0 +1,90 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// StreamLimitStrategy 超出并发串流限制时的处理策略
+type StreamLimitStrategy string
+
+const (
+	StreamLimitReject StreamLimitStrategy = "reject" // 拒绝请求
+	StreamLimitOrigin StreamLimitStrategy = "origin" // 降级为由 emby 源服务器串流
+)
+
+// validStreamLimitStrategy 用于校验用户配置的策略是否合法
+var validStreamLimitStrategy = map[StreamLimitStrategy]struct{}{
+	StreamLimitReject: {}, StreamLimitOrigin: {},
+}
+
+// StreamLimit 每个用户的并发串流数限制
+//
+// 同一个用户的每个设备视为一路串流, 设备停止播放或超过 SessionTimeout 没有上报播放进度时释放
+type StreamLimit struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Default 每个用户默认的最大并发串流数, 0 表示不限制
+	Default int `yaml:"default"`
+	// Users 指定用户 (用户名) 的最大并发串流数
+	Users map[string]int `yaml:"users"`
+	// Strategy 超出限制时的处理策略
+	Strategy StreamLimitStrategy `yaml:"strategy"`
+	// Message 拒绝请求时返回给客户端的提示信息
+	Message string `yaml:"message"`
+	// SessionTimeout 串流会话超时时间
+	SessionTimeout string `yaml:"session-timeout"`
+
+	// sessionTimeout 配置初始化转换之后的标准时间对象
+	sessionTimeout time.Duration
+}
+
+// Init 配置初始化
+func (sl *StreamLimit) Init() error {
+	if sl.Default < 0 {
+		return fmt.Errorf("stream-limit.default 不能小于 0")
+	}
+	for user, limit := range sl.Users {
+		if limit < 0 {
+			return fmt.Errorf("stream-limit.users 配置错误, 用户 %s 的串流数不能小于 0", user)
+		}
+	}
+
+	sl.Strategy = StreamLimitStrategy(strings.ToLower(strings.TrimSpace(string(sl.Strategy))))
+	if strs.AnyEmpty(string(sl.Strategy)) {
+		sl.Strategy = StreamLimitReject
+	}
+	if _, ok := validStreamLimitStrategy[sl.Strategy]; !ok {
+		return fmt.Errorf("stream-limit.strategy 配置错误: %s", sl.Strategy)
+	}
+
+	if strs.AnyEmpty(sl.Message) {
+		sl.Message = "当前用户同时播放的数量已达上限, 请先停止其他设备上的播放"
+	}
+
+	sl.sessionTimeout = time.Minute * 2
+	if strs.AllNotEmpty(sl.SessionTimeout) {
+		timeout, err := parseDuration(sl.SessionTimeout)
+		if err != nil {
+			return fmt.Errorf("stream-limit.session-timeout 配置错误: %v", err)
+		}
+		sl.sessionTimeout = timeout
+	}
+	return nil
+}
+
+// Limit 获取指定用户的最大并发串流数, 0 表示不限制
+func (sl *StreamLimit) Limit(user string) int {
+	if limit, ok := sl.Users[user]; ok {
+		return limit
+	}
+	return sl.Default
+}
+
+// SessionTimeoutDuration 获取串流会话超时时间
+func (sl *StreamLimit) SessionTimeoutDuration() time.Duration {
+	return sl.sessionTimeout
+}
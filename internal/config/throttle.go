@@ -0,0 +1,85 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// sizeMap 字符串配置映射成字节数
+var sizeMap = map[string]int64{
+	"B":  1,
+	"KB": 1024,
+	"MB": 1024 * 1024,
+	"GB": 1024 * 1024 * 1024,
+}
+
+// parseSize 将形如 512KB, 20MB 的配置字符串转换为字节数
+func parseSize(str string) (int64, error) {
+	str = strings.ToUpper(strings.TrimSpace(str))
+	numStr := strings.TrimRight(str, "KMGB")
+	unit := strings.TrimPrefix(str, numStr)
+	if unit == "" {
+		unit = "B"
+	}
+	base, ok := sizeMap[unit]
+	if !ok {
+		return 0, fmt.Errorf("不支持的大小单位: %s, 支持的单位: B, KB, MB, GB", unit)
+	}
+	num, err := strconv.ParseFloat(strings.TrimSpace(numStr), 64)
+	if err != nil {
+		return 0, fmt.Errorf("大小格式错误: %s", str)
+	}
+	if num <= 0 {
+		return 0, fmt.Errorf("大小需大于 0: %s", str)
+	}
+	return int64(num * float64(base)), nil
+}
+
+// Throttle 代理串流的带宽限制
+//
+// 只对经过本程序传输的串流生效, 重定向到直链的串流不受影响
+type Throttle struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Stream 每一路串流每秒允许传输的大小, 如: 20MB, 为空表示不限制
+	Stream string `yaml:"stream"`
+	// Global 所有串流合计每秒允许传输的大小, 如: 80MB, 为空表示不限制
+	Global string `yaml:"global"`
+
+	// stream 配置初始化转换之后的字节数
+	stream int64
+	// global 配置初始化转换之后的字节数
+	global int64
+}
+
+// Init 配置初始化
+func (t *Throttle) Init() error {
+	if strs.AllNotEmpty(t.Stream) {
+		stream, err := parseSize(t.Stream)
+		if err != nil {
+			return fmt.Errorf("throttle.stream 配置错误: %v", err)
+		}
+		t.stream = stream
+	}
+	if strs.AllNotEmpty(t.Global) {
+		global, err := parseSize(t.Global)
+		if err != nil {
+			return fmt.Errorf("throttle.global 配置错误: %v", err)
+		}
+		t.global = global
+	}
+	return nil
+}
+
+// StreamRate 获取每一路串流每秒允许传输的字节数, 0 表示不限制
+func (t *Throttle) StreamRate() int64 {
+	return t.stream
+}
+
+// GlobalRate 获取所有串流合计每秒允许传输的字节数, 0 表示不限制
+func (t *Throttle) GlobalRate() int64 {
+	return t.global
+}
@@ -0,0 +1,61 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// TrickplayDir 进度条预览图缓存目录名称
+const TrickplayDir = "trickplay"
+
+// Trickplay 进度条预览图 (Trickplay/BIF) 缓存配置
+type Trickplay struct {
+	// Enable 是否将预览图缓存到磁盘
+	Enable bool `yaml:"enable"`
+	// Expired 磁盘缓存的过期时间
+	Expired string `yaml:"expired"`
+	// Prefetch 返回 PlaybackInfo 时是否预先请求 BIF 预览图
+	Prefetch bool `yaml:"prefetch"`
+	// PrefetchWidth 预先请求的 BIF 预览图宽度
+	PrefetchWidth int `yaml:"prefetch-width"`
+
+	// expired 配置初始化转换之后的标准时间对象
+	expired time.Duration
+}
+
+// Init 配置初始化
+func (t *Trickplay) Init() error {
+	t.expired = time.Hour * 24 * 30
+	if strs.AllNotEmpty(t.Expired) {
+		expired, err := parseDuration(t.Expired)
+		if err != nil {
+			return fmt.Errorf("trickplay.expired 配置错误: %v", err)
+		}
+		t.expired = expired
+	}
+	if t.PrefetchWidth <= 0 {
+		t.PrefetchWidth = 320
+	}
+
+	if !t.Enable {
+		return nil
+	}
+	if err := os.MkdirAll(t.Dir(), os.ModeDir|os.ModePerm); err != nil {
+		return fmt.Errorf("初始化 trickplay 缓存目录失败: %v", err)
+	}
+	return nil
+}
+
+// ExpiredDuration 获取磁盘缓存的过期时间
+func (t *Trickplay) ExpiredDuration() time.Duration {
+	return t.expired
+}
+
+// Dir 获取磁盘缓存目录的绝对路径
+func (t *Trickplay) Dir() string {
+	return filepath.Join(BasePath, TrickplayDir)
+}
@@ -0,0 +1,68 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// UpdateApply 新版本的安装方式
+type UpdateApply string
+
+const (
+	UpdateApplyOff    UpdateApply = "off"    // 只检查新版本, 不替换程序
+	UpdateApplyManual UpdateApply = "manual" // 允许通过管理接口下载新版本替换程序并重启
+	UpdateApplyAuto   UpdateApply = "auto"   // 检查到新版本时自动下载替换并重启
+)
+
+// Update 版本检查和自动更新配置
+type Update struct {
+	// Check 是否定期检查 GitHub 上的新版本, 检查到新版本时打印日志并在管理面板中提示
+	Check bool `yaml:"check"`
+	// Interval 检查间隔
+	Interval string `yaml:"interval"`
+	// Prerelease 是否包含预发布版本
+	Prerelease bool `yaml:"prerelease"`
+	// Repo 发布新版本的 GitHub 仓库
+	Repo string `yaml:"repo"`
+	// Apply 新版本的安装方式: off, manual, auto
+	Apply UpdateApply `yaml:"apply"`
+	// AllowUnverified 新版本中找不到对应文件的校验和时, 是否仍然允许替换程序
+	AllowUnverified bool `yaml:"allow-unverified"`
+
+	// interval 配置初始化转换之后的标准时间对象
+	interval time.Duration
+}
+
+// Init 配置初始化
+func (u *Update) Init() error {
+	u.interval = time.Hour * 24
+	if strs.AllNotEmpty(u.Interval) {
+		interval, err := parseDuration(u.Interval)
+		if err != nil {
+			return fmt.Errorf("update.interval 配置错误: %v", err)
+		}
+		u.interval = interval
+	}
+	if strs.AnyEmpty(u.Repo) {
+		u.Repo = "AmbitiousJun/go-emby2alist"
+	}
+	if strs.AnyEmpty(string(u.Apply)) {
+		u.Apply = UpdateApplyOff
+	}
+	switch u.Apply {
+	case UpdateApplyOff, UpdateApplyManual, UpdateApplyAuto:
+	default:
+		return fmt.Errorf("update.apply 配置错误: %s, 可选值: off, manual, auto", u.Apply)
+	}
+	if u.Apply == UpdateApplyAuto && !u.Check {
+		return fmt.Errorf("update.apply 配置为 auto 时需要开启 update.check")
+	}
+	return nil
+}
+
+// IntervalDuration 获取检查间隔
+func (u *Update) IntervalDuration() time.Duration {
+	return u.interval
+}
@@ -1,5 +1,42 @@
 package config
 
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// PlaylistNormalize 远程播放列表的规范化级别
+type PlaylistNormalize string
+
+const (
+	NormalizeOff    PlaylistNormalize = "off"    // 不做处理
+	NormalizeBasic  PlaylistNormalize = "basic"  // 移除 BOM 和行尾空白, 去除重复的头部标签
+	NormalizeStrict PlaylistNormalize = "strict" // 在 basic 的基础上补全缺失的头部标签, 修正 #EXT-X-TARGETDURATION
+)
+
+// validPlaylistNormalize 用于校验用户配置的规范化级别是否合法
+var validPlaylistNormalize = map[PlaylistNormalize]struct{}{
+	NormalizeOff: {}, NormalizeBasic: {}, NormalizeStrict: {},
+}
+
+// SegmentUrl 代理播放列表中切片和字幕地址的格式
+type SegmentUrl string
+
+const (
+	SegmentUrlAbsolute SegmentUrl = "absolute" // 使用客户端请求的协议和域名生成绝对地址
+	SegmentUrlRelative SegmentUrl = "relative" // 使用相对于播放列表的地址
+)
+
+// validSegmentUrl 用于校验用户配置的地址格式是否合法
+var validSegmentUrl = map[SegmentUrl]struct{}{
+	SegmentUrlAbsolute: {}, SegmentUrlRelative: {},
+}
+
 type VideoPreview struct {
 	// Enable 是否开启网盘转码链接代理
 	Enable bool `yaml:"enable"`
@@ -7,14 +44,48 @@ type VideoPreview struct {
 	Containers []string `yaml:"containers"`
 	// IgnoreTemplateIds 忽略的转码清晰度
 	IgnoreTemplateIds []string `yaml:"ignore-template-ids"`
+	// Lazy 是否延迟获取转码资源, 开启后 PlaybackInfo 只返回一个占位的转码资源, 选择播放时才请求 alist
+	Lazy bool `yaml:"lazy"`
+	// ProbeAudio 是否探测转码播放列表中实际存在的音轨, 并按照探测结果改写转码资源的音轨信息
+	ProbeAudio bool `yaml:"probe-audio"`
+	// CollectTimeout PlaybackInfo 等待转码资源的最长时间, 超时之后先返回已获取到的资源
+	CollectTimeout string `yaml:"collect-timeout"`
+	// RangeLabel 在资源名称中标注动态范围 (HDR/SDR) 的配置
+	RangeLabel *RangeLabel `yaml:"range-label"`
+	// RememberChoice 记住用户在剧集中选择的资源的配置
+	RememberChoice *RememberChoice `yaml:"remember-choice"`
+	// ResumeOnSwitch 切换资源时续播的配置
+	ResumeOnSwitch *ResumeOnSwitch `yaml:"resume-on-switch"`
+	// CastCompat 投屏兼容模式的配置
+	CastCompat *CastCompat `yaml:"cast-compat"`
+	// PlaylistRefresh 转码播放列表的后台刷新配置
+	PlaylistRefresh *PlaylistRefresh `yaml:"playlist-refresh"`
+	// SegmentCache 热门切片缓存配置
+	SegmentCache *SegmentCache `yaml:"segment-cache"`
+	// DefaultPreview 低带宽用户默认使用转码资源的配置
+	DefaultPreview *DefaultPreview `yaml:"default-preview"`
+	// Normalize 远程播放列表的规范化级别, 默认 basic
+	Normalize PlaylistNormalize `yaml:"normalize"`
+	// SegmentUrl 代理播放列表中切片和字幕地址的格式, 默认 absolute
+	SegmentUrl SegmentUrl `yaml:"segment-url"`
+	// PlaylistTags 代理播放列表时注入或移除的标签规则
+	PlaylistTags []*PlaylistTagRule `yaml:"playlist-tags"`
+	// Providers 网盘原生的转码预览接口
+	Providers []*PreviewProvider `yaml:"providers"`
 
 	// containerMap 依据 Containers 初始化该 map, 便于后续快速判断
 	containerMap map[string]struct{}
 	// ignoreTemplateIdMap 依据 IgnoreTemplateIds 初始化该 map
 	ignoreTemplateIdMap map[string]struct{}
+	// collectTimeout 配置初始化转换之后的标准时间对象
+	collectTimeout time.Duration
 }
 
 func (vp *VideoPreview) Init() error {
+	if constant.Minimal && vp.Enable {
+		log.Println("精简构建不包含转码资源功能, 已忽略 video-preview.enable 配置")
+		vp.Enable = false
+	}
 	vp.containerMap = make(map[string]struct{})
 	for _, container := range vp.Containers {
 		vp.containerMap[container] = struct{}{}
@@ -23,6 +94,83 @@ func (vp *VideoPreview) Init() error {
 	for _, id := range vp.IgnoreTemplateIds {
 		vp.ignoreTemplateIdMap[id] = struct{}{}
 	}
+	vp.collectTimeout = time.Second * 5
+	if strs.AllNotEmpty(vp.CollectTimeout) {
+		timeout, err := parseDuration(vp.CollectTimeout)
+		if err != nil {
+			return fmt.Errorf("video-preview.collect-timeout 配置错误: %v", err)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("video-preview.collect-timeout 必须大于 0: %s", vp.CollectTimeout)
+		}
+		vp.collectTimeout = timeout
+	}
+
+	if vp.RangeLabel == nil {
+		vp.RangeLabel = new(RangeLabel)
+	}
+	if err := vp.RangeLabel.Init(); err != nil {
+		return fmt.Errorf("video-preview.range-label 配置错误: %v", err)
+	}
+	if vp.RememberChoice == nil {
+		vp.RememberChoice = new(RememberChoice)
+	}
+	if vp.RememberChoice.MinTimes <= 0 {
+		vp.RememberChoice.MinTimes = 2
+	}
+	if vp.ResumeOnSwitch == nil {
+		vp.ResumeOnSwitch = new(ResumeOnSwitch)
+	}
+	if err := vp.ResumeOnSwitch.Init(); err != nil {
+		return fmt.Errorf("video-preview.resume-on-switch 配置错误: %v", err)
+	}
+	if vp.CastCompat == nil {
+		vp.CastCompat = new(CastCompat)
+	}
+	if vp.PlaylistRefresh == nil {
+		vp.PlaylistRefresh = new(PlaylistRefresh)
+	}
+	if err := vp.PlaylistRefresh.Init(); err != nil {
+		return fmt.Errorf("video-preview.playlist-refresh 配置错误: %v", err)
+	}
+	if vp.SegmentCache == nil {
+		vp.SegmentCache = new(SegmentCache)
+	}
+	if err := vp.SegmentCache.Init(); err != nil {
+		return fmt.Errorf("video-preview.segment-cache 配置错误: %v", err)
+	}
+	if vp.DefaultPreview == nil {
+		vp.DefaultPreview = new(DefaultPreview)
+	}
+	vp.DefaultPreview.Init()
+	if strs.AnyEmpty(string(vp.Normalize)) {
+		vp.Normalize = NormalizeBasic
+	}
+	if _, ok := validPlaylistNormalize[vp.Normalize]; !ok {
+		return fmt.Errorf("video-preview.normalize 配置错误: %s", vp.Normalize)
+	}
+	if strs.AnyEmpty(string(vp.SegmentUrl)) {
+		vp.SegmentUrl = SegmentUrlAbsolute
+	}
+	if _, ok := validSegmentUrl[vp.SegmentUrl]; !ok {
+		return fmt.Errorf("video-preview.segment-url 配置错误: %s", vp.SegmentUrl)
+	}
+	for i, rule := range vp.PlaylistTags {
+		if rule == nil {
+			return fmt.Errorf("video-preview.playlist-tags[%d] 配置为空", i)
+		}
+		if err := rule.Init(); err != nil {
+			return fmt.Errorf("video-preview.playlist-tags[%d] 配置错误: %v", i, err)
+		}
+	}
+	for i, provider := range vp.Providers {
+		if provider == nil {
+			return fmt.Errorf("video-preview.providers[%d] 配置为空", i)
+		}
+		if err := provider.Init(); err != nil {
+			return fmt.Errorf("video-preview.providers[%d] 配置错误: %v", i, err)
+		}
+	}
 	return nil
 }
 
@@ -37,3 +185,307 @@ func (vp *VideoPreview) IsTemplateIgnore(templateId string) bool {
 	_, ok := vp.ignoreTemplateIdMap[templateId]
 	return ok
 }
+
+// CollectTimeoutDuration 获取 PlaybackInfo 等待转码资源的最长时间
+func (vp *VideoPreview) CollectTimeoutDuration() time.Duration {
+	return vp.collectTimeout
+}
+
+// RangeLabel 在资源名称中标注动态范围 (HDR/SDR) 的配置
+//
+// 网盘转码资源不保留 HDR 信息, 原画为 HDR 时分别为原画和转码资源加上标签, 避免误选
+type RangeLabel struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Template 资源名称模板, 支持占位符: ${name} 原始名称, ${label} 标签
+	Template string `yaml:"template"`
+	// Origin HDR 原画资源的标签
+	Origin string `yaml:"origin"`
+	// Transcode HDR 原画对应转码资源的标签
+	Transcode string `yaml:"transcode"`
+}
+
+// Init 配置初始化
+func (rl *RangeLabel) Init() error {
+	if strs.AnyEmpty(rl.Template) {
+		rl.Template = "${name} [${label}]"
+	}
+	if !strings.Contains(rl.Template, "${name}") {
+		return fmt.Errorf("template 必须包含 ${name} 占位符: %s", rl.Template)
+	}
+	if strs.AnyEmpty(rl.Origin) {
+		rl.Origin = "HDR 原画"
+	}
+	if strs.AnyEmpty(rl.Transcode) {
+		rl.Transcode = "SDR 转码"
+	}
+	return nil
+}
+
+// Apply 使用模板为资源名称加上标签
+func (rl *RangeLabel) Apply(name, label string) string {
+	return strings.NewReplacer("${name}", name, "${label}", label).Replace(rl.Template)
+}
+
+// RememberChoice 记住用户在剧集中选择的资源
+//
+// 用户在同一部剧集中连续选择同一种清晰度时, 后续剧集的 PlaybackInfo 默认使用该清晰度
+type RememberChoice struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// MinTimes 连续选择多少次之后才记住
+	MinTimes int `yaml:"min-times"`
+}
+
+// ResumeOnSwitch 在原画和转码资源之间切换时, 从切换前的播放进度继续播放
+//
+// 部分客户端切换资源时会重新生成 PlaySessionId, 导致从头开始播放
+type ResumeOnSwitch struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Window 播放进度的有效时间, 超过该时间没有上报进度时不再续播
+	Window string `yaml:"window"`
+
+	// window 配置初始化转换之后的标准时间对象
+	window time.Duration
+}
+
+// Init 配置初始化
+func (rs *ResumeOnSwitch) Init() error {
+	rs.window = time.Minute * 5
+	if strs.AllNotEmpty(rs.Window) {
+		window, err := parseDuration(rs.Window)
+		if err != nil {
+			return fmt.Errorf("window 配置错误: %v", err)
+		}
+		rs.window = window
+	}
+	return nil
+}
+
+// WindowDuration 获取播放进度的有效时间
+func (rs *ResumeOnSwitch) WindowDuration() time.Duration {
+	return rs.window
+}
+
+// CastCompat 投屏兼容模式
+//
+// Chromecast 等投屏设备播放代理的转码 m3u8 时, 要求响应携带 CORS 响应头,
+// 并且播放列表中的地址都是投屏设备可以直接访问的绝对地址
+type CastCompat struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+}
+
+// PlaylistRefresh 转码播放列表的后台刷新配置
+//
+// 网盘转码地址有有效期, 后台提前刷新正在播放的播放列表, 避免播放中途等待同步刷新造成卡顿
+type PlaylistRefresh struct {
+	// MaxAge 播放列表距离上次刷新超过该时间时, 在后台重新获取, 需要小于网盘转码地址的有效期
+	MaxAge string `yaml:"max-age"`
+	// ActiveWindow 客户端在该时间内读取过播放列表或切片时, 视为正在播放, 暂停播放不超过该时间时恢复播放不会卡顿
+	ActiveWindow string `yaml:"active-window"`
+
+	// maxAge 配置初始化转换之后的标准时间对象
+	maxAge time.Duration
+	// activeWindow 配置初始化转换之后的标准时间对象
+	activeWindow time.Duration
+}
+
+// Init 配置初始化
+func (pr *PlaylistRefresh) Init() error {
+	pr.maxAge = time.Minute * 10
+	if strs.AllNotEmpty(pr.MaxAge) {
+		maxAge, err := parseDuration(pr.MaxAge)
+		if err != nil {
+			return fmt.Errorf("max-age 配置错误: %v", err)
+		}
+		pr.maxAge = maxAge
+	}
+	if pr.maxAge < time.Minute {
+		return fmt.Errorf("max-age 不能小于 1m: %s", pr.MaxAge)
+	}
+
+	pr.activeWindow = time.Minute * 30
+	if strs.AllNotEmpty(pr.ActiveWindow) {
+		window, err := parseDuration(pr.ActiveWindow)
+		if err != nil {
+			return fmt.Errorf("active-window 配置错误: %v", err)
+		}
+		pr.activeWindow = window
+	}
+	return nil
+}
+
+// MaxAgeDuration 获取播放列表的最长刷新间隔
+func (pr *PlaylistRefresh) MaxAgeDuration() time.Duration {
+	return pr.maxAge
+}
+
+// ActiveWindowDuration 获取判断播放列表正在播放的时间窗口
+func (pr *PlaylistRefresh) ActiveWindowDuration() time.Duration {
+	return pr.activeWindow
+}
+
+// SegmentCache 热门切片缓存配置
+//
+// 热门剧集的片头切片会被反复请求, 启用后播放列表的前几个切片被请求足够多次时, 由本程序从网盘获取并缓存在内存中,
+// 后续的请求直接返回缓存, 不再重定向到网盘
+type SegmentCache struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Segments 只缓存每个播放列表的前多少个切片
+	Segments int `yaml:"segments"`
+	// MinHits 切片被请求多少次之后才允许写入缓存
+	MinHits int `yaml:"min-hits"`
+	// MaxSize 缓存的总大小, 如: 256MB
+	MaxSize string `yaml:"max-size"`
+	// MaxSegmentSize 单个切片的最大大小, 超出的切片不缓存
+	MaxSegmentSize string `yaml:"max-segment-size"`
+
+	// maxSize 配置初始化转换之后的字节数
+	maxSize int64
+	// maxSegmentSize 配置初始化转换之后的字节数
+	maxSegmentSize int64
+}
+
+// Init 配置初始化
+func (sc *SegmentCache) Init() error {
+	if sc.Segments == 0 {
+		sc.Segments = 6
+	}
+	if sc.Segments < 0 {
+		return fmt.Errorf("segments 不能小于 0: %d", sc.Segments)
+	}
+	if sc.MinHits == 0 {
+		sc.MinHits = 3
+	}
+	if sc.MinHits < 0 {
+		return fmt.Errorf("min-hits 不能小于 0: %d", sc.MinHits)
+	}
+
+	if strs.AnyEmpty(sc.MaxSize) {
+		sc.MaxSize = "256MB"
+	}
+	size, err := parseSize(sc.MaxSize)
+	if err != nil {
+		return fmt.Errorf("max-size 配置错误: %v", err)
+	}
+	sc.maxSize = size
+
+	if strs.AnyEmpty(sc.MaxSegmentSize) {
+		sc.MaxSegmentSize = "16MB"
+	}
+	size, err = parseSize(sc.MaxSegmentSize)
+	if err != nil {
+		return fmt.Errorf("max-segment-size 配置错误: %v", err)
+	}
+	sc.maxSegmentSize = size
+	return nil
+}
+
+// MaxSizeBytes 获取缓存的总字节数上限
+func (sc *SegmentCache) MaxSizeBytes() int64 {
+	return sc.maxSize
+}
+
+// MaxSegmentSizeBytes 获取单个切片的字节数上限
+func (sc *SegmentCache) MaxSegmentSizeBytes() int64 {
+	return sc.maxSegmentSize
+}
+
+// DefaultPreview 低带宽用户默认使用转码资源
+//
+// 匹配的用户或客户端请求 PlaybackInfo 时, 将转码资源移至 MediaSources 的最前面作为默认资源,
+// 原画资源仍然可以手动选择, 避免移动端误播放体积巨大的原画资源
+type DefaultPreview struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Templates 优先作为默认资源的转码清晰度, 按优先级排列, 都不存在时使用第一个转码资源
+	Templates []string `yaml:"templates"`
+	// Users 生效的用户名
+	Users []string `yaml:"users"`
+	// Clients 生效的客户端, 客户端名称包含其中任意一个关键字即匹配 (不区分大小写)
+	//
+	// Users 和 Clients 都不配置时, 对所有请求生效
+	Clients []string `yaml:"clients"`
+
+	// userMap 依据 Users 初始化该 map, 便于后续快速判断
+	userMap map[string]struct{}
+}
+
+// Init 配置初始化
+func (dp *DefaultPreview) Init() {
+	dp.userMap = make(map[string]struct{})
+	for _, user := range dp.Users {
+		dp.userMap[user] = struct{}{}
+	}
+	clients := make([]string, 0, len(dp.Clients))
+	for _, client := range dp.Clients {
+		if client = strings.ToLower(strings.TrimSpace(client)); client != "" {
+			clients = append(clients, client)
+		}
+	}
+	dp.Clients = clients
+}
+
+// Match 判断用户或客户端是否默认使用转码资源
+func (dp *DefaultPreview) Match(user, client string) bool {
+	if len(dp.userMap) == 0 && len(dp.Clients) == 0 {
+		return true
+	}
+	if _, ok := dp.userMap[user]; ok {
+		return true
+	}
+	client = strings.ToLower(client)
+	for _, keyword := range dp.Clients {
+		if strings.Contains(client, keyword) {
+			return true
+		}
+	}
+	return false
+}
+
+// PlaylistTagRule 代理播放列表时注入或移除的标签规则
+//
+// 部分播放器需要额外的标签 (如 #EXT-X-START:TIME-OFFSET=0) 才能正常播放, 或者无法处理某些标签
+type PlaylistTagRule struct {
+	// Templates 生效的转码清晰度, 不配置时对所有清晰度生效
+	Templates []string `yaml:"templates"`
+	// Inject 注入到播放列表头部的标签, 播放列表中已有的同名标签会被替换
+	Inject []string `yaml:"inject"`
+	// Strip 需要从播放列表中移除的标签名称, 如: #EXT-X-PROGRAM-DATE-TIME
+	Strip []string `yaml:"strip"`
+}
+
+// Init 配置初始化
+func (ptr *PlaylistTagRule) Init() error {
+	for i, tag := range ptr.Inject {
+		tag = strings.TrimSpace(tag)
+		if !strings.HasPrefix(tag, "#EXT") {
+			return fmt.Errorf("inject 中的标签需要以 #EXT 开头: %s", tag)
+		}
+		ptr.Inject[i] = tag
+	}
+	for i, tag := range ptr.Strip {
+		tag = strings.TrimSpace(tag)
+		if !strings.HasPrefix(tag, "#") || strings.Contains(tag, ":") {
+			return fmt.Errorf("strip 中需要配置以 # 开头的标签名称: %s", tag)
+		}
+		ptr.Strip[i] = tag
+	}
+	return nil
+}
+
+// Match 判断规则是否对指定的转码清晰度生效
+func (ptr *PlaylistTagRule) Match(templateId string) bool {
+	if len(ptr.Templates) == 0 {
+		return true
+	}
+	for _, t := range ptr.Templates {
+		if strings.EqualFold(t, templateId) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,159 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/crons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// Warmup 继续观看列表的定时预解析配置
+//
+// 按照 cron 表达式定时查询每个用户的 "继续观看" 列表, 提前解析网盘直链并预热转码播放列表,
+// 用户在高峰期打开播放时可以直接使用预解析的结果
+type Warmup struct {
+	// Enable 是否启用定时预解析
+	Enable bool `yaml:"enable"`
+	// Cron 触发时间, 标准的 5 段 cron 表达式, 默认每天 19:30
+	Cron string `yaml:"cron"`
+	// Limit 每个用户预解析的最大 item 数, 默认 5
+	Limit int `yaml:"limit"`
+	// Users 需要预解析的用户名, 不配置时预解析所有用户
+	Users []string `yaml:"users"`
+	// Ttl 预解析直链的有效期, 需要小于网盘直链本身的有效期, 默认 2h
+	Ttl string `yaml:"ttl"`
+	// Detail 打开 item 详情页时的预解析配置
+	Detail *WarmupDetail `yaml:"detail"`
+	// Queue 播放队列的预解析配置
+	Queue *WarmupQueue `yaml:"queue"`
+
+	// schedule 配置初始化解析之后的 cron 表达式
+	schedule *crons.Schedule
+	// ttl 配置初始化转换之后的标准时间对象
+	ttl time.Duration
+	// userMap 依据 Users 初始化该 map, 便于后续快速判断
+	userMap map[string]struct{}
+}
+
+// Init 配置初始化
+func (w *Warmup) Init() error {
+	if strs.AnyEmpty(w.Cron) {
+		w.Cron = "30 19 * * *"
+	}
+	schedule, err := crons.Parse(w.Cron)
+	if err != nil {
+		return fmt.Errorf("warmup.cron 配置错误: %v", err)
+	}
+	w.schedule = schedule
+
+	if w.Limit <= 0 {
+		w.Limit = 5
+	}
+
+	w.ttl = time.Hour * 2
+	if strs.AllNotEmpty(w.Ttl) {
+		ttl, err := parseDuration(w.Ttl)
+		if err != nil {
+			return fmt.Errorf("warmup.ttl 配置错误: %v", err)
+		}
+		w.ttl = ttl
+	}
+
+	w.userMap = make(map[string]struct{})
+	for _, user := range w.Users {
+		w.userMap[user] = struct{}{}
+	}
+
+	if w.Detail == nil {
+		w.Detail = new(WarmupDetail)
+	}
+	if err := w.Detail.Init(); err != nil {
+		return fmt.Errorf("warmup.detail 配置错误: %v", err)
+	}
+
+	if w.Queue == nil {
+		w.Queue = new(WarmupQueue)
+	}
+	if err := w.Queue.Init(); err != nil {
+		return fmt.Errorf("warmup.queue 配置错误: %v", err)
+	}
+	return nil
+}
+
+// LinksEnabled 是否使用预解析的直链, 任意一种预解析开启即可
+func (w *Warmup) LinksEnabled() bool {
+	return w.Enable || w.Detail.Enable || w.Queue.Enable
+}
+
+// Schedule 获取解析之后的 cron 表达式
+func (w *Warmup) Schedule() *crons.Schedule {
+	return w.schedule
+}
+
+// TtlDuration 获取预解析直链的有效期
+func (w *Warmup) TtlDuration() time.Duration {
+	return w.ttl
+}
+
+// UserValid 判断用户是否需要预解析
+func (w *Warmup) UserValid(user string) bool {
+	if len(w.userMap) == 0 {
+		return true
+	}
+	_, ok := w.userMap[user]
+	return ok
+}
+
+// WarmupDetail 打开 item 详情页时的预解析配置
+//
+// 用户打开 item 详情页时, 异步预解析 item 资源的网盘直链, 随后点击播放时可以直接使用预解析的结果
+type WarmupDetail struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Rate 每个用户每分钟最多预解析的资源数, 默认 10
+	Rate int `yaml:"rate"`
+	// Sources 每个 item 最多预解析的资源数 (多版本资源), 默认 1
+	Sources int `yaml:"sources"`
+}
+
+// Init 配置初始化
+func (wd *WarmupDetail) Init() error {
+	if wd.Rate < 0 {
+		return fmt.Errorf("rate 不能小于 0: %d", wd.Rate)
+	}
+	if wd.Rate == 0 {
+		wd.Rate = 10
+	}
+	if wd.Sources < 0 {
+		return fmt.Errorf("sources 不能小于 0: %d", wd.Sources)
+	}
+	if wd.Sources == 0 {
+		wd.Sources = 1
+	}
+	return nil
+}
+
+// WarmupQueue 播放队列的预解析配置
+//
+// 客户端使用播放列表或 "播放全部" 连续播放时, 当前 item 的播放进度达到阈值后,
+// 异步预解析队列中下一个 item 的直链, 减少切换下一集时的卡顿
+type WarmupQueue struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Progress 触发预解析的播放进度百分比, 默认 80
+	Progress int `yaml:"progress"`
+	// NextEpisode 播放队列中没有下一个 item 时, 是否预解析剧集的下一集
+	NextEpisode bool `yaml:"next-episode"`
+}
+
+// Init 配置初始化
+func (wq *WarmupQueue) Init() error {
+	if wq.Progress < 0 || wq.Progress > 100 {
+		return fmt.Errorf("progress 需要在 0 ~ 100 之间: %d", wq.Progress)
+	}
+	if wq.Progress == 0 {
+		wq.Progress = 80
+	}
+	return nil
+}
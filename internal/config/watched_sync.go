@@ -0,0 +1,92 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/crons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// WatchedSync 网盘播放记录同步配置
+//
+// 直接在网盘 App 中观看的资源 emby 无法感知, 启用后定时读取网盘的播放记录,
+// 将对应的 item 在 emby 中标记为已观看
+type WatchedSync struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Cron 触发时间, 标准的 5 段 cron 表达式, 默认每小时一次
+	Cron string `yaml:"cron"`
+	// Sources 播放记录来源
+	Sources []*WatchedSource `yaml:"sources"`
+
+	// schedule 配置初始化解析之后的 cron 表达式
+	schedule *crons.Schedule
+}
+
+// WatchedSource 一个网盘播放记录来源
+//
+// 网盘的播放记录接口各不相同并且需要单独鉴权, 由外部程序 (如网盘的 API 脚本) 转换成统一的格式提供,
+// 接口需返回 json 数组: [{"path": "alist 中的文件路径", "played_at": 观看时间戳 (秒, 可选)}]
+type WatchedSource struct {
+	// Name 来源名称, 用于区分日志以及记录上次同步的时间
+	Name string `yaml:"name"`
+	// Url 播放记录接口地址
+	Url string `yaml:"url"`
+	// Users 需要标记为已观看的 emby 用户名, 不配置时标记所有用户
+	Users []string `yaml:"users"`
+
+	// userMap 依据 Users 初始化该 map, 便于后续快速判断
+	userMap map[string]struct{}
+}
+
+// Init 配置初始化
+func (ws *WatchedSync) Init() error {
+	if strs.AnyEmpty(ws.Cron) {
+		ws.Cron = "0 * * * *"
+	}
+	schedule, err := crons.Parse(ws.Cron)
+	if err != nil {
+		return fmt.Errorf("watched-sync.cron 配置错误: %v", err)
+	}
+	ws.schedule = schedule
+
+	names := make(map[string]struct{})
+	for i, source := range ws.Sources {
+		if source == nil {
+			return fmt.Errorf("watched-sync.sources[%d] 配置不能为空", i)
+		}
+		if strs.AnyEmpty(source.Name, source.Url) {
+			return fmt.Errorf("watched-sync.sources[%d] 配置错误: name 和 url 不能为空", i)
+		}
+		if _, ok := names[source.Name]; ok {
+			return fmt.Errorf("watched-sync.sources[%d] 配置错误: name 重复: %s", i, source.Name)
+		}
+		names[source.Name] = struct{}{}
+		if _, err := url.ParseRequestURI(source.Url); err != nil {
+			return fmt.Errorf("watched-sync.sources[%d] 配置错误: url 格式错误: %v", i, err)
+		}
+		source.userMap = make(map[string]struct{})
+		for _, user := range source.Users {
+			source.userMap[user] = struct{}{}
+		}
+	}
+	if ws.Enable && len(ws.Sources) == 0 {
+		return fmt.Errorf("watched-sync 启用时 sources 不能为空")
+	}
+	return nil
+}
+
+// Schedule 获取解析之后的 cron 表达式
+func (ws *WatchedSync) Schedule() *crons.Schedule {
+	return ws.schedule
+}
+
+// UserValid 判断用户是否需要同步该来源的播放记录
+func (source *WatchedSource) UserValid(user string) bool {
+	if len(source.userMap) == 0 {
+		return true
+	}
+	_, ok := source.userMap[user]
+	return ok
+}
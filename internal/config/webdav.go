@@ -0,0 +1,27 @@
+package config
+
+import (
+	"errors"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// Webdav 只读的 WebDAV 服务配置
+//
+// 启用后可以通过 /dav/ 以目录的形式浏览 emby 媒体库, 文件请求重定向到网盘直链
+type Webdav struct {
+	// Enable 是否启用
+	Enable bool `yaml:"enable"`
+	// Username Basic 鉴权的用户名
+	Username string `yaml:"username"`
+	// Password Basic 鉴权的密码
+	Password string `yaml:"password"`
+}
+
+// Init 配置初始化
+func (w *Webdav) Init() error {
+	if w.Enable && strs.AnyEmpty(w.Username, w.Password) {
+		return errors.New("webdav.username 和 webdav.password 不能为空")
+	}
+	return nil
+}
@@ -0,0 +1,8 @@
+//go:build minimal
+
+package constant
+
+// Minimal 是否为精简构建 (go build -tags minimal)
+//
+// 精简构建只保留直链播放, 不包含转码资源 (视频预览)、m3u8 代理以及字幕转换
+const Minimal = true
@@ -1,13 +1,22 @@
 package constant
 
+const (
+	CurrentVersion = "v1.3.0-beta-v3"
+	RepoAddr       = "https://github.com/AmbitiousJun/go-emby2alist"
+)
+
 const (
 	Reg_Socket                   = `(?i)^/.*(socket|embywebsocket)`
 	Reg_PlaybackInfo             = `(?i)^/.*items/.*/playbackinfo\??`
 	Reg_UserItems                = `(?i)^/.*users/.*/items/\d+($|\?)`
 	Reg_UserEpisodeItems         = `(?i)^/.*users/.*/items\?.*includeitemtypes=(episode|movie)`
+	Reg_UserItemsList            = `(?i)^/.*users/[^/]+/items($|\?)`
 	Reg_UserItemsRandomResort    = `(?i)^/.*users/.*/items\?.*SortBy=Random`
 	Reg_UserItemsRandomWithLimit = `(?i)^/.*users/.*/items/with_limit\?.*SortBy=Random`
+	Reg_KodiSyncQueue            = `(?i)^/.*emby\.kodi\.syncqueue/`
 	Reg_ShowEpisodes             = `(?i)^/.*shows/.*/episodes\??`
+	Reg_ShowsNextUp              = `(?i)^/.*shows/nextup($|\?)`
+	Reg_UserItemsResume          = `(?i)^/.*users/[^/]+/items/resume($|\?)`
 	Reg_VideoSubtitles           = `(?i)^/.*videos/.*/subtitles`
 	Reg_ResourceStream           = `(?i)^/.*(videos|audio)/.*/(stream|universal)(\.\w+)?\??`
 	Reg_ResourceMaster           = `(?i)^/.*(videos|audio)/.*/(master)(\.\w+)?\??`
@@ -15,8 +24,56 @@ const (
 	Reg_ProxyPlaylist            = `(?i)^/.*videos/proxy_playlist\??`
 	Reg_ProxyTs                  = `(?i)^/.*videos/proxy_ts\??`
 	Reg_ProxySubtitle            = `(?i)^/.*videos/proxy_subtitle\??`
+	Reg_AdditionalParts          = `(?i)^/.*videos/\d+/additionalparts($|\?)`
+	Reg_Trickplay                = `(?i)^/.*videos/[^/]+/(trickplay/|[^/?]+\.bif($|\?))`
+	Reg_ActiveEncodings          = `(?i)^/.*videos/activeencodings($|\?)`
+	Reg_LiveStreamClose          = `(?i)^/.*livestreams/close($|\?)`
+	Reg_PlayingSessions          = `(?i)^/.*sessions/playing(/progress|/stopped)?($|\?)`
 	Reg_ItemDownload             = `(?i)^/.*items/\d+/download($|\?)`
+	Reg_PhotoOriginal            = `(?i)^/.*items/\d+/images/original($|\?)`
+	Reg_ChapterImages            = `(?i)^/.*items/[^/]+/images/chapter/\d+`
+	Reg_ItemRemoteImages         = `(?i)^/.*items/[^/]+/remoteimages($|\?)`
+	Reg_RemoteImage              = `(?i)^/.*images/remote($|\?)`
 	Reg_Images                   = `(?i)^/.*images`
+	Reg_Dlna                     = `(?i)^(/emby)?/dlna/`
+	Reg_PlayHandoff              = `(?i)^/play/\d+($|\?)`
+	Reg_Probe                    = `(?i)^/probe($|\?)`
+	Reg_FeedRecent               = `(?i)^/feeds/recent\.(json|rss)($|\?)`
+	Reg_FeedLink                 = `(?i)^/feeds/link/[^/?]+($|\?)`
+	Reg_FeedPoster               = `(?i)^/feeds/poster/[^/?]+($|\?)`
+	Reg_Webdav                   = `(?i)^/dav(/|$|\?)`
+	Reg_FeedExport               = `(?i)^/feeds/export/[^/?]+\.(m3u|zip)($|\?)`
+	Reg_AdminLatency             = `(?i)^/admin/metrics/latency($|\?)`
+	Reg_AdminDecisions           = `(?i)^/admin/metrics/decisions($|\?)`
+	Reg_AdminStats               = `(?i)^/admin/stats($|\?)`
+	Reg_AdminStatsReset          = `(?i)^/admin/stats/reset($|\?)`
+	Reg_AdminSessions            = `(?i)^/admin/sessions($|\?)`
+	Reg_AdminSessionStop         = `(?i)^/admin/sessions/stop($|\?)`
+	Reg_AdminSessionMessage      = `(?i)^/admin/sessions/message($|\?)`
+	Reg_AdminSessionBroadcast    = `(?i)^/admin/sessions/broadcast($|\?)`
+	Reg_AdminUi                  = `(?i)^/admin/ui/?($|\?)`
+	Reg_AdminRequests            = `(?i)^/admin/requests($|\?)`
+	Reg_AdminHealth              = `(?i)^/admin/health($|\?)`
+	Reg_AdminCache               = `(?i)^/admin/cache($|\?)`
+	Reg_AdminCachePurge          = `(?i)^/admin/cache/purge($|\?)`
+	Reg_AdminResolve             = `(?i)^/admin/resolve/\d+($|\?)`
+	Reg_AdminPathMap             = `(?i)^/admin/pathmap/\d+($|\?)`
+	Reg_AdminSimulate            = `(?i)^/admin/simulate($|\?)`
+	Reg_AdminPathMapOverride     = `(?i)^/admin/pathmap/override($|\?)`
+	Reg_AdminPreview             = `(?i)^/admin/preview/\d+($|\?)`
+	Reg_AdminPreviewPin          = `(?i)^/admin/preview/pin($|\?)`
+	Reg_AdminLibraryChanged      = `(?i)^/admin/library/changed($|\?)`
+	Reg_AdminFeatures            = `(?i)^/admin/features($|\?)`
+	Reg_AdminLogLevel            = `(?i)^/admin/loglevel($|\?)`
+	Reg_AdminConfig              = `(?i)^/admin/config($|\?)`
+	Reg_AdminOpenApi             = `(?i)^/admin/openapi\.json($|\?)`
+	Reg_AdminDebugSnapshot       = `(?i)^/admin/debug/snapshot($|\?)`
+	Reg_AdminDebugTrace          = `(?i)^/admin/debug/trace($|\?)`
+	Reg_AdminCapture             = `(?i)^/admin/capture($|\?)`
+	Reg_AdminCaptureExport       = `(?i)^/admin/capture/export($|\?)`
+	Reg_AdminCaptureClear        = `(?i)^/admin/capture/clear($|\?)`
+	Reg_AdminVersion             = `(?i)^/admin/version($|\?)`
+	Reg_AdminVersionUpdate       = `(?i)^/admin/version/update($|\?)`
 	Reg_Proxy2Origin             = `^/$|(?i)^.*(/web|/users|/artists|/genres|/similar|/shows|/system|/remote|/scheduledtasks)`
 	Reg_All                      = `.*`
 )
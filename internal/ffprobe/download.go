@@ -0,0 +1,136 @@
+package ffprobe
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+)
+
+const (
+	// downloadTimeout 下载 ffprobe 的超时时间
+	downloadTimeout = time.Minute * 10
+
+	// maxDownloadSize 下载文件的最大大小
+	maxDownloadSize = 256 * 1024 * 1024
+)
+
+// install 下载并校验 ffprobe, 写入到 dst
+func install(src *config.FfprobeSource, dst string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), downloadTimeout)
+	defer cancel()
+
+	log.Printf(colors.ToBlue("正在下载 ffprobe: %s"), src.Url)
+	data, err := download(ctx, src.Url)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(data)
+	if got := hex.EncodeToString(sum[:]); got != src.Sha256 {
+		return fmt.Errorf("文件校验失败, 期望: %s, 实际: %s", src.Sha256, got)
+	}
+	bin, err := extract(src.Url, data)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(dst), os.ModePerm); err != nil {
+		return fmt.Errorf("创建目录失败: %v", err)
+	}
+	tmp := dst + ".tmp"
+	if err := os.WriteFile(tmp, bin, 0755); err != nil {
+		return fmt.Errorf("写入文件失败: %v", err)
+	}
+	if err := os.Rename(tmp, dst); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("写入文件失败: %v", err)
+	}
+	return nil
+}
+
+// download 下载文件, 超出 maxDownloadSize 时返回错误
+func download(ctx context.Context, u string) ([]byte, error) {
+	_, resp, err := https.RequestRedirectCtx(ctx, http.MethodGet, u, nil, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("响应码: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxDownloadSize {
+		return nil, fmt.Errorf("文件大小超出限制: %d MB", maxDownloadSize>>20)
+	}
+	return data, nil
+}
+
+// extract 从下载的文件中取出 ffprobe, 压缩包 (.tar.gz, .zip) 中按照文件名查找, 其他格式视为程序本身
+func extract(u string, data []byte) ([]byte, error) {
+	name := strings.ToLower(strings.SplitN(u, "?", 2)[0])
+	switch {
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("解压失败: %v", err)
+		}
+		tr := tar.NewReader(gr)
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("解压失败: %v", err)
+			}
+			if hdr.Typeflag == tar.TypeReg && isBin(hdr.Name) {
+				return io.ReadAll(io.LimitReader(tr, maxDownloadSize))
+			}
+		}
+	case strings.HasSuffix(name, ".zip"):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("解压失败: %v", err)
+		}
+		for _, f := range zr.File {
+			if f.FileInfo().IsDir() || !isBin(f.Name) {
+				continue
+			}
+			rc, err := f.Open()
+			if err != nil {
+				return nil, fmt.Errorf("解压失败: %v", err)
+			}
+			defer rc.Close()
+			return io.ReadAll(io.LimitReader(rc, maxDownloadSize))
+		}
+	default:
+		return data, nil
+	}
+	return nil, errors.New("压缩包中没有 ffprobe 程序")
+}
+
+// isBin 判断压缩包中的文件是否为 ffprobe 程序
+func isBin(name string) bool {
+	base := strings.ToLower(path.Base(strings.ReplaceAll(name, `\`, "/")))
+	return base == "ffprobe" || base == "ffprobe.exe"
+}
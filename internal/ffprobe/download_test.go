@@ -0,0 +1,95 @@
+package ffprobe
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+)
+
+func TestExtract(t *testing.T) {
+	bin := []byte("ffprobe-binary")
+
+	var tgz bytes.Buffer
+	gw := gzip.NewWriter(&tgz)
+	tw := tar.NewWriter(gw)
+	for name, content := range map[string][]byte{"ffmpeg-6.0/ffmpeg": []byte("ffmpeg-binary-larger"), "ffmpeg-6.0/ffprobe": bin} {
+		tw.WriteHeader(&tar.Header{Name: name, Mode: 0755, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		tw.Write(content)
+	}
+	tw.Close()
+	gw.Close()
+
+	var zipped bytes.Buffer
+	zw := zip.NewWriter(&zipped)
+	w, _ := zw.Create(`ffmpeg\bin\ffprobe.exe`)
+	w.Write(bin)
+	zw.Close()
+
+	tests := []struct {
+		name string
+		url  string
+		data []byte
+	}{
+		{"tar.gz", "https://example.com/ffmpeg.tar.gz", tgz.Bytes()},
+		{"zip", "https://example.com/ffmpeg.zip?token=1", zipped.Bytes()},
+		{"raw", "https://example.com/ffprobe", bin},
+	}
+	for _, tt := range tests {
+		got, err := extract(tt.url, tt.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if !bytes.Equal(got, bin) {
+			t.Errorf("%s: extract() = %q, want %q", tt.name, got, bin)
+		}
+	}
+
+	if _, err := extract("https://example.com/ffmpeg.zip", func() []byte {
+		var buf bytes.Buffer
+		zw := zip.NewWriter(&buf)
+		w, _ := zw.Create("ffmpeg")
+		w.Write(bin)
+		zw.Close()
+		return buf.Bytes()
+	}()); err == nil {
+		t.Error("压缩包中没有 ffprobe 时应该返回错误")
+	}
+}
+
+func TestInstall(t *testing.T) {
+	bin := []byte("ffprobe-binary")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(bin)
+	}))
+	defer srv.Close()
+
+	dst := filepath.Join(t.TempDir(), "bin", "ffprobe")
+	if err := install(&config.FfprobeSource{Url: srv.URL + "/ffprobe", Sha256: "0000"}, dst); err == nil {
+		t.Fatal("校验和不匹配时应该返回错误")
+	}
+	if _, err := os.Stat(dst); !os.IsNotExist(err) {
+		t.Fatal("校验失败时不应该写入文件")
+	}
+
+	sum := sha256.Sum256(bin)
+	if err := install(&config.FfprobeSource{Url: srv.URL + "/ffprobe", Sha256: hex.EncodeToString(sum[:])}, dst); err != nil {
+		t.Fatal(err)
+	}
+	got, err := os.ReadFile(dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, bin) {
+		t.Errorf("install() 写入 %q, want %q", got, bin)
+	}
+}
@@ -0,0 +1,148 @@
+// ffprobe 程序管理, 启动时查找或下载当前平台的 ffprobe, 供需要探测媒体信息的功能使用
+package ffprobe
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// verifyTimeout 校验 ffprobe 能否正常运行的超时时间
+const verifyTimeout = time.Second * 10
+
+// ErrUnavailable 找不到可用的 ffprobe
+var ErrUnavailable = errors.New("ffprobe 不可用, 请安装 ffprobe 或者配置 ffprobe.path, ffprobe.download")
+
+// retryInterval 查找或下载失败之后, 再次尝试的最小间隔
+const retryInterval = time.Minute * 5
+
+var (
+	// binPath 当前使用的 ffprobe 路径, 为空表示不可用
+	binPath string
+	// lastAttempt 最近一次查找失败的时间, 用于控制重试间隔
+	lastAttempt time.Time
+	// mu 并发控制, 同一时间只进行一次查找
+	mu sync.Mutex
+)
+
+// Prepare 查找当前平台可用的 ffprobe, 找到之后缓存结果, 不再重复查找
+//
+// 查找顺序: ffprobe.path 配置 > 自动下载目录 > 系统 PATH, 都找不到时按照 ffprobe.download 配置下载;
+// 查找或下载失败时不缓存结果, 距离上次失败超过 retryInterval 后再次调用会重新尝试
+func Prepare() error {
+	mu.Lock()
+	defer mu.Unlock()
+	if binPath != "" {
+		return nil
+	}
+	if !lastAttempt.IsZero() && time.Since(lastAttempt) < retryInterval {
+		return ErrUnavailable
+	}
+
+	p, err := locate()
+	if err == nil && p == "" {
+		err = ErrUnavailable
+	}
+	if err != nil {
+		lastAttempt = time.Now()
+		return err
+	}
+	binPath = p
+	log.Printf(colors.ToBlue("使用 ffprobe: %s"), p)
+	return nil
+}
+
+// Path 获取可用的 ffprobe 路径, 还未找到时先进行查找
+func Path() (string, error) {
+	if err := Prepare(); err != nil {
+		return "", err
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	return binPath, nil
+}
+
+// Probe 使用 ffprobe 探测媒体的格式和流信息, input 可以是本地文件或者远程地址
+func Probe(ctx context.Context, input string) (*jsons.Item, error) {
+	p, err := Path()
+	if err != nil {
+		return nil, err
+	}
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, p, "-v", "error", "-print_format", "json", "-show_format", "-show_streams", input)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffprobe 探测失败: %v, %s", err, bytes.TrimSpace(stderr.Bytes()))
+	}
+	return jsons.New(stdout.String())
+}
+
+// locate 按顺序查找可用的 ffprobe, 都找不到并且未开启下载时返回空串
+func locate() (string, error) {
+	cfg := config.C.Ffprobe
+	if strs.AllNotEmpty(cfg.Path) {
+		p, err := exec.LookPath(cfg.Path)
+		if err == nil {
+			err = verify(p)
+		}
+		if err != nil {
+			return "", fmt.Errorf("ffprobe.path 配置的程序不可用: %s, err: %v", cfg.Path, err)
+		}
+		return p, nil
+	}
+
+	managed := filepath.Join(cfg.Dir(), binName())
+	if _, err := os.Stat(managed); err == nil {
+		if err := verify(managed); err == nil {
+			return managed, nil
+		}
+		log.Printf(colors.ToYellow("已下载的 ffprobe 不可用, 忽略: %s"), managed)
+	}
+
+	if p, err := exec.LookPath("ffprobe"); err == nil && verify(p) == nil {
+		return p, nil
+	}
+
+	if !cfg.Download {
+		return "", nil
+	}
+	src, ok := cfg.Source()
+	if !ok {
+		return "", fmt.Errorf("未配置当前平台 (%s/%s) 的 ffprobe 下载地址, 请在 ffprobe.sources 中添加", runtime.GOOS, runtime.GOARCH)
+	}
+	if err := install(src, managed); err != nil {
+		return "", fmt.Errorf("下载 ffprobe 失败: %v", err)
+	}
+	if err := verify(managed); err != nil {
+		return "", fmt.Errorf("下载的 ffprobe 无法运行, 请检查下载地址是否适用于当前平台 (%s/%s): %v", runtime.GOOS, runtime.GOARCH, err)
+	}
+	return managed, nil
+}
+
+// verify 校验 ffprobe 能否正常运行
+func verify(p string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+	defer cancel()
+	return exec.CommandContext(ctx, p, "-version").Run()
+}
+
+// binName 当前平台的 ffprobe 程序名称
+func binName() string {
+	if runtime.GOOS == "windows" {
+		return "ffprobe.exe"
+	}
+	return "ffprobe"
+}
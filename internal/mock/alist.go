@@ -0,0 +1,108 @@
+package mock
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+// alistTemplates 模拟的 alist 转码清晰度
+var alistTemplates = []struct {
+	Id     string
+	Width  int
+	Height int
+}{
+	{Id: "FHD", Width: 1920, Height: 1080},
+	{Id: "HD", Width: 1280, Height: 720},
+	{Id: "SD", Width: 854, Height: 480},
+}
+
+// AlistHandler 模拟的 alist 服务器
+//
+// AlistRoot 下的任意文件路径都视为存在, 直链指向模拟服务器自身的 /d 接口
+func AlistHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := "http://" + r.Host
+
+		switch {
+		case r.URL.Path == "/ping":
+			w.Write([]byte("pong"))
+		case strings.HasPrefix(r.URL.Path, "/api/"):
+			if r.Header.Get("Authorization") != AlistToken {
+				writeAlist(w, http.StatusUnauthorized, "token is invalid", nil)
+				return
+			}
+			var body struct{ Path string }
+			json.NewDecoder(r.Body).Decode(&body)
+			handleAlistApi(w, r.URL.Path, body.Path, host)
+		case strings.HasPrefix(r.URL.Path, "/d/") || strings.HasPrefix(r.URL.Path, "/p/"):
+			w.Header().Set("Content-Type", "application/octet-stream")
+			http.ServeContent(w, r, path.Base(r.URL.Path), time.Time{}, bytes.NewReader([]byte("mock alist content")))
+		case strings.HasPrefix(r.URL.Path, "/transcode/"):
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			w.Write([]byte("#EXTM3U\n#EXT-X-VERSION:3\n#EXT-X-TARGETDURATION:10\n#EXTINF:10.0,\n" + host + "/d/mock/segment.ts\n#EXT-X-ENDLIST\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	})
+}
+
+// handleAlistApi 处理 alist 的 fs 接口和当前用户信息接口
+func handleAlistApi(w http.ResponseWriter, api, fsPath, host string) {
+	exist := fsPath == "/" || fsPath == AlistRoot || strings.HasPrefix(fsPath, AlistRoot+"/")
+
+	switch api {
+	case "/api/me":
+		writeAlist(w, http.StatusOK, "success", map[string]interface{}{"id": 1, "username": "admin", "base_path": "/"})
+	case "/api/fs/get":
+		if !exist {
+			writeAlist(w, http.StatusInternalServerError, "object not found", nil)
+			return
+		}
+		writeAlist(w, http.StatusOK, "success", map[string]interface{}{
+			"name":    path.Base(fsPath),
+			"size":    1 << 30,
+			"is_dir":  false,
+			"sign":    "mock-sign",
+			"raw_url": host + "/d" + (&url.URL{Path: fsPath}).EscapedPath(),
+		})
+	case "/api/fs/other":
+		if !exist {
+			writeAlist(w, http.StatusInternalServerError, "object not found", nil)
+			return
+		}
+		tasks := make([]interface{}, 0, len(alistTemplates))
+		for _, t := range alistTemplates {
+			tasks = append(tasks, map[string]interface{}{
+				"template_id":     t.Id,
+				"template_width":  t.Width,
+				"template_height": t.Height,
+				"status":          "finished",
+				"url":             fmt.Sprintf("%s/transcode/%s.m3u8", host, t.Id),
+			})
+		}
+		writeAlist(w, http.StatusOK, "success", map[string]interface{}{
+			"video_preview_play_info": map[string]interface{}{
+				"live_transcoding_task_list":          tasks,
+				"live_transcoding_subtitle_task_list": []interface{}{},
+			},
+		})
+	case "/api/fs/list":
+		writeAlist(w, http.StatusOK, "success", map[string]interface{}{
+			"content": []interface{}{map[string]interface{}{"name": strings.TrimPrefix(AlistRoot, "/"), "is_dir": true}},
+			"total":   1,
+		})
+	default:
+		writeAlist(w, http.StatusNotFound, "api not found", nil)
+	}
+}
+
+// writeAlist 以 alist 的响应格式响应
+func writeAlist(w http.ResponseWriter, code int, message string, data interface{}) {
+	writeJson(w, map[string]interface{}{"code": code, "message": message, "data": data})
+}
@@ -0,0 +1,196 @@
+package mock
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// embyItem 模拟的 emby 媒体
+type embyItem struct {
+	Id        string
+	Name      string
+	Type      string
+	Path      string
+	Container string
+	Size      int64
+	IsRemote  bool
+	Tags      []string
+}
+
+// EmbyItems 模拟 emby 服务器中的所有媒体, 分别覆盖了本地挂载资源、剧集、strm 远程资源
+var EmbyItems = []embyItem{
+	{Id: "1001", Name: "Mock Movie", Type: "Movie", Path: MountPath + "/movie/Mock Movie (2024)/Mock Movie (2024).mkv", Container: "mkv", Size: 4 << 30},
+	{Id: "1002", Name: "Mock Episode", Type: "Episode", Path: MountPath + "/series/Mock Series/Season 01/Mock Series S01E01.mp4", Container: "mp4", Size: 1 << 30},
+	{Id: "1003", Name: "Mock Strm", Type: "Movie", Path: "https://example.com/mock/strm.mp4", Container: "strm", IsRemote: true},
+}
+
+// NastyDir 特殊字符文件名所在的目录, 相对于挂载路径
+const NastyDir = "/movie/Nasty #1 (100%)"
+
+// NastyNames 包含特殊字符的文件名, 用于测试直链解析和转码代理过程中的编码处理
+var NastyNames = []string{
+	"Hash #1.mkv",
+	"100% Pure.mkv",
+	"a+b=c&d.mkv",
+	"电影 🎬 émoji.mkv",
+	"%2F looks escaped %41.mkv",
+	"question? [brackets] {braces}.mkv",
+	"semi;colon 'quote' \"double\".mkv",
+}
+
+func init() {
+	for i, name := range NastyNames {
+		EmbyItems = append(EmbyItems, embyItem{
+			Id:        fmt.Sprintf("%d", 2001+i),
+			Name:      name,
+			Type:      "Movie",
+			Path:      MountPath + NastyDir + "/" + name,
+			Container: "mkv",
+			Size:      1 << 30,
+		})
+	}
+}
+
+var (
+	// embyPrefixRegex 匹配 emby 接口可选的 /emby 前缀
+	embyPrefixRegex = regexp.MustCompile(`(?i)^/emby`)
+
+	// playbackInfoRegex 匹配 PlaybackInfo 接口, 分组为 item id
+	playbackInfoRegex = regexp.MustCompile(`(?i)^/items/([^/]+)/playbackinfo$`)
+
+	// userItemRegex 匹配用户的单个 item 接口, 分组为 item id
+	userItemRegex = regexp.MustCompile(`(?i)^/users/[^/]+/items/([^/]+)$`)
+
+	// resumeRegex 匹配用户的继续观看列表接口
+	resumeRegex = regexp.MustCompile(`(?i)^/users/[^/]+/items/resume$`)
+
+	// streamRegex 匹配串流接口
+	streamRegex = regexp.MustCompile(`(?i)^/(videos|audio)/[^/]+/(stream|original)`)
+)
+
+// EmbyHandler 模拟的 emby 服务器
+func EmbyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		p := strings.ToLower(embyPrefixRegex.ReplaceAllString(r.URL.Path, ""))
+
+		switch {
+		case p == "/system/info/public" || p == "/system/info":
+			writeJson(w, map[string]string{"ServerName": "mock-emby", "Version": "4.8.0.0", "Id": "mock-emby"})
+		case p == "/auth/keys":
+			if !embyAuthorized(r) {
+				w.WriteHeader(http.StatusUnauthorized)
+				w.Write([]byte("Access token is invalid or expired."))
+				return
+			}
+			writeJson(w, map[string]interface{}{"Items": []interface{}{}, "TotalRecordCount": 0})
+		case playbackInfoRegex.MatchString(p):
+			item, ok := findEmbyItem(playbackInfoRegex.FindStringSubmatch(p)[1])
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			writeJson(w, map[string]interface{}{
+				"MediaSources":  []interface{}{embyMediaSource(item)},
+				"PlaySessionId": "mock-play-session",
+			})
+		case p == "/users":
+			writeJson(w, []interface{}{map[string]string{"Id": UserId, "Name": "mock"}})
+		case resumeRegex.MatchString(p):
+			items := make([]interface{}, 0)
+			for _, item := range EmbyItems {
+				items = append(items, embyItemJson(item))
+			}
+			writeJson(w, map[string]interface{}{"Items": items, "TotalRecordCount": len(items)})
+		case userItemRegex.MatchString(p):
+			item, ok := findEmbyItem(userItemRegex.FindStringSubmatch(p)[1])
+			if !ok {
+				http.NotFound(w, r)
+				return
+			}
+			writeJson(w, embyItemJson(item))
+		case p == "/items" || strings.HasSuffix(p, "/items"):
+			items := make([]interface{}, 0)
+			ids := r.URL.Query().Get("Ids")
+			for _, item := range EmbyItems {
+				if ids == "" || strings.Contains(","+ids+",", ","+item.Id+",") {
+					items = append(items, embyItemJson(item))
+				}
+			}
+			writeJson(w, map[string]interface{}{"Items": items, "TotalRecordCount": len(items)})
+		case streamRegex.MatchString(p):
+			w.Header().Set("Content-Type", "application/octet-stream")
+			w.Write([]byte("mock emby stream"))
+		default:
+			writeJson(w, map[string]string{"Mock": "emby", "Method": r.Method, "Path": r.URL.Path})
+		}
+	})
+}
+
+// embyAuthorized 校验请求是否携带了模拟服务器认可的 api_key
+func embyAuthorized(r *http.Request) bool {
+	q := r.URL.Query()
+	return q.Get("api_key") == ApiKey || q.Get("X-Emby-Token") == ApiKey ||
+		strings.Contains(r.Header.Get("Authorization"), ApiKey) ||
+		r.Header.Get("X-Emby-Token") == ApiKey
+}
+
+// findEmbyItem 根据 id 查找模拟的媒体
+func findEmbyItem(id string) (embyItem, bool) {
+	for _, item := range EmbyItems {
+		if item.Id == id {
+			return item, true
+		}
+	}
+	return embyItem{}, false
+}
+
+// embyMediaSource 生成媒体的 MediaSource 响应
+func embyMediaSource(item embyItem) map[string]interface{} {
+	protocol := "File"
+	if item.IsRemote {
+		protocol = "Http"
+	}
+	return map[string]interface{}{
+		"Id":                   "mediasource_" + item.Id,
+		"ItemId":               item.Id,
+		"Name":                 item.Name,
+		"Path":                 item.Path,
+		"Protocol":             protocol,
+		"Container":            item.Container,
+		"Size":                 item.Size,
+		"Bitrate":              8_000_000,
+		"RunTimeTicks":         72_000_000_000,
+		"IsRemote":             item.IsRemote,
+		"SupportsDirectPlay":   true,
+		"SupportsDirectStream": true,
+		"SupportsTranscoding":  true,
+		"TranscodingUrl":       "/videos/" + item.Id + "/master.m3u8?MediaSourceId=mediasource_" + item.Id,
+		"MediaStreams": []interface{}{
+			map[string]interface{}{"Type": "Video", "Index": 0, "Codec": "h264", "DisplayTitle": "1080p H264", "Width": 1920, "Height": 1080, "IsDefault": true},
+			map[string]interface{}{"Type": "Audio", "Index": 1, "Codec": "aac", "Language": "chi", "DisplayTitle": "Chinese AAC stereo", "IsDefault": true},
+		},
+	}
+}
+
+// embyItemJson 生成媒体的 item 响应
+func embyItemJson(item embyItem) map[string]interface{} {
+	return map[string]interface{}{
+		"Id":           item.Id,
+		"Name":         item.Name,
+		"Type":         item.Type,
+		"MediaType":    "Video",
+		"Path":         item.Path,
+		"IsFolder":     false,
+		"Tags":         append([]string{}, item.Tags...),
+		"MediaSources": []interface{}{embyMediaSource(item)},
+	}
+}
+
+// writeJson 以 json 格式响应
+func writeJson(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,82 @@
+// 模拟的 Emby 和 Alist 服务器, 内置 PlaybackInfo、fs/get 等接口的固定响应,
+// 用于在没有真实服务器的情况下端到端地测试程序的改写逻辑
+package mock
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+)
+
+const (
+	// ApiKey 模拟 emby 服务器认可的 api_key
+	ApiKey = "mock-emby-api-key"
+
+	// AlistToken 模拟 alist 服务器认可的 token
+	AlistToken = "mock-alist-token"
+
+	// UserId 模拟 emby 服务器中唯一的用户 id
+	UserId = "mock-user"
+
+	// MountPath 模拟 emby 的挂载路径
+	MountPath = "/data"
+
+	// AlistRoot 挂载路径在 alist 中对应的根目录
+	AlistRoot = "/mock"
+)
+
+// Servers 启动之后的模拟服务器地址
+type Servers struct {
+	EmbyHost  string
+	AlistHost string
+}
+
+// Start 在本地随机端口上启动模拟的 emby 和 alist 服务器
+func Start() (Servers, error) {
+	embyHost, err := serve("emby", EmbyHandler())
+	if err != nil {
+		return Servers{}, err
+	}
+	alistHost, err := serve("alist", AlistHandler())
+	if err != nil {
+		return Servers{}, err
+	}
+	return Servers{EmbyHost: embyHost, AlistHost: alistHost}, nil
+}
+
+// Config 生成指向模拟服务器的最小配置, 格式与 config.yml 一致
+func (s Servers) Config() []byte {
+	return []byte(fmt.Sprintf(`emby:
+  host: %s
+  mount-path: %s
+  api-key: %s
+alist:
+  host: %s
+  token: %s
+path:
+  emby2alist:
+    - /movie:%s/movie
+    - /series:%s/series
+cache:
+  enable: false
+`, s.EmbyHost, MountPath, ApiKey, s.AlistHost, AlistToken, AlistRoot, AlistRoot))
+}
+
+// serve 在本地随机端口上启动 http 服务, 返回服务地址
+func serve(name string, handler http.Handler) (string, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("启动模拟 %s 服务器失败: %v", name, err)
+	}
+	host := "http://" + ln.Addr().String()
+	go func() {
+		if err := http.Serve(ln, handler); err != nil {
+			log.Printf(colors.ToRed("模拟 %s 服务器异常: %v"), name, err)
+		}
+	}()
+	log.Printf(colors.ToYellow("模拟 %s 服务器已启动: %s"), name, host)
+	return host, nil
+}
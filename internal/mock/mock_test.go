@@ -0,0 +1,106 @@
+package mock_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/mock"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web"
+)
+
+// TestEndToEnd 基于模拟服务器, 端到端地测试 PlaybackInfo 改写和直链重定向
+func TestEndToEnd(t *testing.T) {
+	servers, err := mock.Start()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := config.ReadFromBytes(servers.Config(), t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+	handler := web.NewHandler()
+	web.StartBackground()
+
+	do := func(method, uri string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest(method, uri, nil))
+		return w
+	}
+
+	deadline := time.Now().Add(10 * time.Second)
+	for do(http.MethodGet, web.HealthzPath).Code != http.StatusOK {
+		if time.Now().After(deadline) {
+			t.Fatal("等待服务就绪超时")
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+
+	t.Run("鉴权失败", func(t *testing.T) {
+		w := do(http.MethodPost, "/emby/Items/1001/PlaybackInfo?api_key=invalid")
+		if w.Code != http.StatusUnauthorized {
+			t.Errorf("响应码错误, 期望: %d, 实际: %d", http.StatusUnauthorized, w.Code)
+		}
+	})
+
+	t.Run("PlaybackInfo 改写", func(t *testing.T) {
+		w := do(http.MethodPost, "/emby/Items/1001/PlaybackInfo?api_key="+mock.ApiKey)
+		if w.Code != http.StatusOK {
+			t.Fatalf("响应码错误: %d, 响应: %s", w.Code, w.Body.String())
+		}
+		body, err := jsons.New(w.Body.String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		dsu, _ := body.Attr("MediaSources").Idx(0).Attr("DirectStreamUrl").String()
+		if !strings.Contains(dsu, "/videos/1001/stream") {
+			t.Errorf("DirectStreamUrl 改写错误: %s", dsu)
+		}
+	})
+
+	t.Run("直链重定向", func(t *testing.T) {
+		w := do(http.MethodGet, "/videos/1001/stream?Static=true&MediaSourceId=mediasource_1001&api_key="+mock.ApiKey)
+		loc := w.Header().Get("Location")
+		if !https.IsRedirectCode(w.Code) || !strings.HasPrefix(loc, servers.AlistHost+"/d/mock/movie/") {
+			t.Errorf("重定向错误, 响应码: %d, 地址: %s", w.Code, loc)
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "video/x-matroska" {
+			t.Errorf("Content-Type 错误: %s", ct)
+		}
+	})
+
+	t.Run("特殊字符文件名", func(t *testing.T) {
+		for i, name := range mock.NastyNames {
+			id := fmt.Sprintf("%d", 2001+i)
+			w := do(http.MethodPost, "/emby/Items/"+id+"/PlaybackInfo?api_key="+mock.ApiKey)
+			if w.Code != http.StatusOK {
+				t.Fatalf("[%s] 响应码错误: %d, 响应: %s", name, w.Code, w.Body.String())
+			}
+			body, err := jsons.New(w.Body.String())
+			if err != nil {
+				t.Fatal(err)
+			}
+			dsu, _ := body.Attr("MediaSources").Idx(0).Attr("DirectStreamUrl").String()
+			if _, err := url.Parse(dsu); err != nil {
+				t.Errorf("[%s] DirectStreamUrl 无法解析: %s", name, dsu)
+				continue
+			}
+
+			w = do(http.MethodGet, "/emby"+dsu)
+			loc, err := url.Parse(w.Header().Get("Location"))
+			if !https.IsRedirectCode(w.Code) || err != nil {
+				t.Errorf("[%s] 重定向错误, 响应码: %d, 地址: %s", name, w.Code, w.Header().Get("Location"))
+				continue
+			}
+			if want := "/d" + mock.AlistRoot + mock.NastyDir + "/" + name; loc.Path != want {
+				t.Errorf("[%s] 直链路径错误, 期望: %s, 实际: %s", name, want, loc.Path)
+			}
+		}
+	})
+}
@@ -0,0 +1,296 @@
+// selftest 包实现 selftest 子命令, 使用当前的配置对各个子系统执行端到端的检查,
+// 用于部署之后快速验证配置是否正确
+package selftest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/path"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+)
+
+const (
+	// stepTimeout 单个检查步骤的网络请求超时时间
+	stepTimeout = time.Second * 30
+	// segmentReadLimit 拉取切片时最多读取的字节数
+	segmentReadLimit = 4 * 1024 * 1024
+)
+
+// errSkip 步骤的前置条件不满足, 跳过检查
+var errSkip = errors.New("skip")
+
+// skipf 构造一个跳过检查的错误, 附带跳过的原因
+func skipf(format string, v ...any) error {
+	return fmt.Errorf("%w: "+format, append([]any{errSkip}, v...)...)
+}
+
+// sample 用于检查的样本 item
+type sample struct {
+	itemId  string
+	name    string
+	source  emby.MediaSource
+	segment string // 转码播放列表中第一个切片的地址
+}
+
+// Run 依次检查 emby, alist, 直链解析, 转码播放列表, 切片和字幕, 输出每个子系统的检查结果
+//
+// itemId 为空时使用媒体库中最近添加的电影或剧集作为样本; 所有检查都通过 (或跳过) 时返回 true
+func Run(itemId string) bool {
+	fmt.Println(colors.ToBlue("开始自检..."))
+	ok := true
+	run := func(name string, fn func() (string, error)) {
+		start := time.Now()
+		detail, err := fn()
+		cost := time.Since(start).Milliseconds()
+		switch {
+		case err == nil:
+			fmt.Println(colors.ToGreen(fmt.Sprintf("[PASS] %-9s (%dms) %s", name, cost, detail)))
+		case errors.Is(err, errSkip):
+			fmt.Println(colors.ToYellow(fmt.Sprintf("[SKIP] %-9s %s", name, strings.TrimPrefix(err.Error(), errSkip.Error()+": "))))
+		default:
+			ok = false
+			fmt.Println(colors.ToRed(fmt.Sprintf("[FAIL] %-9s (%dms) %v", name, cost, err)))
+		}
+	}
+
+	s := new(sample)
+	run("emby", checkEmby)
+	run("alist", checkAlist)
+	run("sample", func() (string, error) { return findSample(itemId, s) })
+	run("resolve", func() (string, error) { return checkResolve(s) })
+	run("playlist", func() (string, error) { return checkPlaylist(s) })
+	run("segment", func() (string, error) { return checkSegment(s) })
+	run("subtitle", func() (string, error) { return checkSubtitle(s) })
+
+	if ok {
+		fmt.Println(colors.ToGreen("自检完成, 所有检查均已通过"))
+	} else {
+		fmt.Println(colors.ToRed("自检完成, 存在未通过的检查, 请根据输出调整配置"))
+	}
+	return ok
+}
+
+// checkEmby 检查 emby 源服务器是否可以访问, api key 是否有效
+func checkEmby() (string, error) {
+	res, _ := emby.RawFetch("/System/Info", http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return "", fmt.Errorf("请求 emby 失败: %s", res.Msg)
+	}
+	version, ok := res.Data.Attr("Version").String()
+	if !ok {
+		return "", fmt.Errorf("api key 无效或响应异常, 原始响应: %v", res.Data)
+	}
+	name, _ := res.Data.Attr("ServerName").String()
+	return fmt.Sprintf("%s, 版本: %s", name, version), nil
+}
+
+// checkAlist 检查 alist 是否可以访问, token 是否有效
+func checkAlist() (string, error) {
+	res := alist.Fetch("/api/me", http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return "", fmt.Errorf("请求 alist 失败: %s", res.Msg)
+	}
+	username, _ := res.Data.Attr("username").String()
+	return "登录用户: " + username, nil
+}
+
+// findSample 获取样本 item 的资源信息
+func findSample(itemId string, s *sample) (string, error) {
+	q := url.Values{}
+	q.Set("Recursive", "true")
+	q.Set("Fields", "Path,MediaSources")
+	q.Set("Limit", "1")
+	if itemId != "" {
+		q.Set("Ids", itemId)
+	} else {
+		q.Set("IncludeItemTypes", "Movie,Episode")
+		q.Set("SortBy", "DateCreated")
+		q.Set("SortOrder", "Descending")
+	}
+	res, _ := emby.RawFetch("/Items?"+q.Encode(), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return "", fmt.Errorf("查询样本 item 失败: %s", res.Msg)
+	}
+	item, ok := res.Data.Attr("Items").Idx(0).Done()
+	if !ok {
+		return "", errors.New("查询不到样本 item, 可以通过 selftest <itemId> 指定")
+	}
+	s.itemId, _ = item.Attr("Id").String()
+	s.name, _ = item.Attr("Name").String()
+
+	var sources []emby.MediaSource
+	if msArr, ok := item.Attr("MediaSources").Done(); !ok || msArr.To(&sources) != nil || len(sources) == 0 {
+		s.itemId = ""
+		return "", fmt.Errorf("样本 item [%s] 没有可用的 MediaSource", s.name)
+	}
+	s.source = sources[0]
+	return fmt.Sprintf("%s (%s), 路径: %s", s.name, s.itemId, s.source.Path), nil
+}
+
+// checkResolve 对样本 item 完整执行一次直链解析
+func checkResolve(s *sample) (string, error) {
+	if s.itemId == "" {
+		return "", skipf("没有可用的样本 item")
+	}
+	d := emby.DiagnoseItem(s.itemId, s.source.Id)
+	steps := make([]string, 0, len(d.Steps))
+	failed := make([]string, 0)
+	for _, step := range d.Steps {
+		steps = append(steps, step.Name)
+		if !step.Ok {
+			failed = append(failed, fmt.Sprintf("[%s] %s", step.Name, step.Error))
+		}
+	}
+	if !d.Ok {
+		return "", fmt.Errorf("解析失败: %s", strings.Join(failed, "; "))
+	}
+	return "通过的步骤: " + strings.Join(steps, ", "), nil
+}
+
+// checkPlaylist 获取样本 item 的第一个转码清晰度, 并请求转码播放列表
+func checkPlaylist(s *sample) (string, error) {
+	if constant.Minimal || !config.C.VideoPreview.Enable {
+		return "", skipf("未开启 video-preview")
+	}
+	if s.itemId == "" {
+		return "", skipf("没有可用的样本 item")
+	}
+	if urls.IsRemote(s.source.Path) || !config.C.VideoPreview.ContainerValid(s.source.Container) {
+		return "", skipf("样本 item 的容器 [%s] 不使用转码资源", s.source.Container)
+	}
+	alistPathRes := path.Emby2Alist(s.source.Path)
+	if !alistPathRes.Success {
+		return "", fmt.Errorf("路径转换失败: %s", s.source.Path)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), stepTimeout)
+	defer cancel()
+	res := alist.FetchFsOther(ctx, alistPathRes.Path, nil)
+	if res.Code != http.StatusOK {
+		return "", fmt.Errorf("请求转码资源失败: %s", res.Msg)
+	}
+	tasks, ok := res.Data.Attr("video_preview_play_info").Attr("live_transcoding_task_list").Done()
+	if !ok {
+		return "", errors.New("获取不到转码清晰度列表")
+	}
+	var template, link string
+	tasks.RangeArr(func(_ int, task *jsons.Item) error {
+		id, _ := task.Attr("template_id").String()
+		if config.C.VideoPreview.IsTemplateIgnore(id) {
+			return nil
+		}
+		template = id
+		link, _ = task.Attr("url").String()
+		return jsons.ErrBreakRange
+	})
+	if link == "" {
+		return "", errors.New("获取不到未被忽略的转码清晰度")
+	}
+
+	resp, err := https.RequestCtx(ctx, http.MethodGet, link, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("请求播放列表失败: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("读取播放列表失败: %v", err)
+	}
+	content := strings.TrimPrefix(string(body), "\uFEFF")
+	if !strings.HasPrefix(strings.TrimSpace(content), "#EXTM3U") {
+		return "", fmt.Errorf("播放列表格式错误, code: %d", resp.StatusCode)
+	}
+
+	segments := 0
+	base, _ := url.Parse(link)
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if segments == 0 {
+			if u, err := base.Parse(line); err == nil {
+				s.segment = u.String()
+			}
+		}
+		segments++
+	}
+	if segments == 0 {
+		return "", errors.New("播放列表中没有切片")
+	}
+	return fmt.Sprintf("清晰度: %s, 切片个数: %d", template, segments), nil
+}
+
+// checkSegment 拉取转码播放列表中的第一个切片
+func checkSegment(s *sample) (string, error) {
+	if s.segment == "" {
+		return "", skipf("没有可用的转码播放列表")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), stepTimeout)
+	defer cancel()
+	resp, err := https.RequestCtx(ctx, http.MethodGet, s.segment, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("请求切片失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return "", fmt.Errorf("请求切片失败, code: %d", resp.StatusCode)
+	}
+	n, err := io.Copy(io.Discard, io.LimitReader(resp.Body, segmentReadLimit))
+	if err != nil {
+		return "", fmt.Errorf("读取切片失败: %v", err)
+	}
+	if n == 0 {
+		return "", errors.New("切片内容为空")
+	}
+	return fmt.Sprintf("读取 %d 字节", n), nil
+}
+
+// checkSubtitle 请求源服务器将样本 item 的第一个字幕转换为 WebVTT 格式
+func checkSubtitle(s *sample) (string, error) {
+	if s.itemId == "" {
+		return "", skipf("没有可用的样本 item")
+	}
+	var stream *emby.MediaStream
+	for i := range s.source.MediaStreams {
+		if s.source.MediaStreams[i].Type == "Subtitle" {
+			stream = &s.source.MediaStreams[i]
+			break
+		}
+	}
+	if stream == nil {
+		return "", skipf("样本 item 没有字幕")
+	}
+
+	u := fmt.Sprintf("%s/Videos/%s/%s/Subtitles/%d/Stream.vtt", config.C.Emby.Host, s.itemId, s.source.Id, stream.Index)
+	u = urls.AppendArgs(u, emby.QueryApiKeyName, config.C.Emby.ApiKey)
+	ctx, cancel := context.WithTimeout(context.Background(), stepTimeout)
+	defer cancel()
+	resp, err := https.RequestCtx(ctx, http.MethodGet, u, nil, nil)
+	if err != nil {
+		return "", fmt.Errorf("请求字幕失败: %v", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("读取字幕失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK || !strings.HasPrefix(strings.TrimPrefix(string(body), "\uFEFF"), "WEBVTT") {
+		return "", fmt.Errorf("字幕转换失败, code: %d", resp.StatusCode)
+	}
+	return fmt.Sprintf("%s 字幕 (index: %d) 转换为 WebVTT, %d 字节", stream.Codec, stream.Index, len(body)), nil
+}
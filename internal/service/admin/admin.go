@@ -0,0 +1,43 @@
+// 管理接口, 所有接口都需要通过 admin.token 鉴权
+package admin
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	HeaderTokenName = "X-Admin-Token" // 请求头中的管理密钥
+	QueryTokenName  = "admin_token"   // query 参数中的管理密钥
+)
+
+// Auth 为管理接口包装鉴权逻辑
+//
+// 未配置 admin.token 时, 所有管理接口都不可用
+func Auth(handler func(*gin.Context)) func(*gin.Context) {
+	return func(c *gin.Context) {
+		if !CheckToken(c) {
+			c.String(http.StatusForbidden, "管理接口鉴权失败")
+			return
+		}
+		handler(c)
+	}
+}
+
+// CheckToken 校验请求中的管理密钥是否正确
+func CheckToken(c *gin.Context) bool {
+	token := config.C.Admin.Token
+	if strs.AnyEmpty(token) {
+		return false
+	}
+	reqToken := c.GetHeader(HeaderTokenName)
+	if strs.AnyEmpty(reqToken) {
+		reqToken = c.Query(QueryTokenName)
+	}
+	return subtle.ConstantTimeCompare([]byte(reqToken), []byte(token)) == 1
+}
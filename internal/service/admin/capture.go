@@ -0,0 +1,61 @@
+package admin
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/capture"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Capture 获取或切换请求录制状态
+//
+// GET 请求返回录制状态和记录条数, POST 请求通过 enable 参数切换录制状态, 重启后恢复为配置文件中的状态
+func Capture(c *gin.Context) {
+	if c.Request.Method == http.MethodPost {
+		enable, err := strconv.ParseBool(c.Query("enable"))
+		if err != nil {
+			c.String(http.StatusBadRequest, "enable 参数错误: %v", err)
+			return
+		}
+		capture.SetEnabled(enable)
+		log.Printf(colors.ToYellow("请求录制已切换为: %v"), enable)
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"Enable": capture.Enabled(),
+		"Count":  len(capture.Entries()),
+	})
+}
+
+// ExportCapture 下载请求录制记录
+//
+// format 参数指定导出格式: har (默认), jsonl
+func ExportCapture(c *gin.Context) {
+	format := strings.ToLower(c.DefaultQuery("format", "har"))
+	fileName := "go-emby2alist-" + time.Now().Format("20060102150405") + "." + format
+	entries := capture.Entries()
+
+	switch format {
+	case "har":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+		c.JSON(http.StatusOK, capture.HAR(entries))
+	case "jsonl":
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s"`, fileName))
+		c.Data(http.StatusOK, "application/x-ndjson; charset=utf-8", capture.JSONL(entries))
+	default:
+		c.String(http.StatusBadRequest, "不支持的导出格式: %s", format)
+	}
+}
+
+// ClearCapture 清空请求录制记录
+func ClearCapture(c *gin.Context) {
+	capture.Clear()
+	log.Println(colors.ToYellow("请求录制记录已清空"))
+	c.Status(http.StatusNoContent)
+}
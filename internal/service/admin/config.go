@@ -0,0 +1,67 @@
+package admin
+
+import (
+	"net/http"
+	"net/url"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/yaml.v3"
+)
+
+// Config 获取当前生效的配置, 敏感信息已脱敏
+func Config(c *gin.Context) {
+	cfg, err := maskedConfig()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "序列化配置失败: %v", err)
+		return
+	}
+	c.JSON(http.StatusOK, cfg)
+}
+
+// maskedConfig 获取按照配置项名称脱敏之后的生效配置
+func maskedConfig() (map[string]interface{}, error) {
+	bytes, err := yaml.Marshal(config.C)
+	if err != nil {
+		return nil, err
+	}
+	var cfg map[string]interface{}
+	if err := yaml.Unmarshal(bytes, &cfg); err != nil {
+		return nil, err
+	}
+	maskSensitive(cfg, "")
+	return cfg, nil
+}
+
+// maskSensitive 递归地将敏感配置项的值替换为 ***, 地址中携带的密码 (如代理地址) 同样替换
+//
+// path 为 v 所属的配置项路径, 如: emby.api-key
+func maskSensitive(v interface{}, path string) interface{} {
+	switch val := v.(type) {
+	case map[string]interface{}:
+		for k, item := range val {
+			key := k
+			if path != "" {
+				key = path + "." + k
+			}
+			if s, ok := item.(string); ok && s != "" && config.IsSensitiveKey(key) {
+				val[k] = "***"
+				continue
+			}
+			val[k] = maskSensitive(item, key)
+		}
+	case []interface{}:
+		for i, item := range val {
+			val[i] = maskSensitive(item, path)
+		}
+	case string:
+		if u, err := url.Parse(val); err == nil && u.User != nil {
+			if _, ok := u.User.Password(); ok {
+				u.User = url.UserPassword(u.User.Username(), "***")
+				return u.String()
+			}
+		}
+	}
+	return v
+}
@@ -0,0 +1,87 @@
+package admin
+
+import (
+	_ "embed"
+	"net/http"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dashboardHtml 管理面板页面
+//
+//go:embed ui/index.html
+var dashboardHtml []byte
+
+// Dashboard 管理面板页面, 页面中的数据通过其他管理接口获取
+//
+// 访问时需要通过 query 参数 admin_token 传递管理密钥, 页面会使用该密钥请求其他接口
+func Dashboard(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", dashboardHtml)
+}
+
+// Requests 获取最近的请求记录
+func Requests(c *gin.Context) {
+	c.JSON(http.StatusOK, metrics.RecentRequests())
+}
+
+// Cache 获取缓存统计信息
+func Cache(c *gin.Context) {
+	c.JSON(http.StatusOK, cache.GetStats())
+}
+
+// PurgeCache 清除缓存, 只允许 POST 请求
+//
+// 通过 space 参数指定要清除的缓存空间, 不传递时清除所有缓存
+func PurgeCache(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.String(http.StatusMethodNotAllowed, "请使用 POST 请求")
+		return
+	}
+	count := cache.Purge(c.Query("space"))
+	c.JSON(http.StatusOK, map[string]int{"purged": count})
+}
+
+// UpstreamHealth 上游服务的健康状态
+type UpstreamHealth struct {
+	Ok      bool   // 是否可用
+	Latency int64  // 探测耗时 (毫秒)
+	Error   string `json:",omitempty"` // 不可用的原因
+	Breaker string `json:",omitempty"` // 熔断器状态
+}
+
+// Health 探测 emby 和 alist 的健康状态
+func Health(c *gin.Context) {
+	res := map[string]UpstreamHealth{
+		"Emby":  probeUpstream(config.C.Emby.Host + "/emby/System/Info/Public"),
+		"Alist": probeUpstream(config.C.Alist.Host + "/ping"),
+	}
+	alistHealth := res["Alist"]
+	alistHealth.Breaker = string(alist.BreakerState())
+	res["Alist"] = alistHealth
+	c.JSON(http.StatusOK, res)
+}
+
+// probeUpstream 请求上游服务的探测地址, 响应码小于 500 即视为可用
+func probeUpstream(u string) UpstreamHealth {
+	start := time.Now()
+	resp, err := https.Request(http.MethodGet, u, nil, nil)
+	res := UpstreamHealth{Latency: time.Since(start).Milliseconds()}
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		res.Error = http.StatusText(resp.StatusCode)
+		return res
+	}
+	res.Ok = true
+	return res
+}
@@ -0,0 +1,104 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// startTime 程序启动时间
+var startTime = time.Now()
+
+// Snapshot 调试快照, 用于附加到问题反馈中
+type Snapshot struct {
+	Version      string                 // 程序版本号
+	GoVersion    string                 // 编译使用的 go 版本
+	Revision     string                 // 编译时的 git 提交
+	Minimal      bool                   // 是否为精简构建
+	Uptime       string                 // 运行时长
+	Goroutines   int                    // 当前 goroutine 个数
+	Config       map[string]interface{} // 按照配置项名称脱敏后的生效配置
+	Cache        cache.Stats            // 缓存统计
+	RecentErrors []metrics.ErrorRecord  // 最近的异常记录
+}
+
+// DebugSnapshot 获取当前程序的调试快照
+func DebugSnapshot(c *gin.Context) {
+	snapshot := Snapshot{
+		Version:      constant.CurrentVersion,
+		GoVersion:    runtime.Version(),
+		Minimal:      constant.Minimal,
+		Uptime:       time.Since(startTime).Truncate(time.Second).String(),
+		Goroutines:   runtime.NumGoroutine(),
+		Cache:        cache.GetStats(),
+		RecentErrors: metrics.RecentErrors(),
+	}
+
+	if info, ok := debug.ReadBuildInfo(); ok {
+		for _, setting := range info.Settings {
+			if setting.Key == "vcs.revision" {
+				snapshot.Revision = setting.Value
+			}
+		}
+	}
+
+	cfg, err := maskedConfig()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "序列化配置失败: %v", err)
+		return
+	}
+	snapshot.Config = cfg
+
+	c.JSON(http.StatusOK, snapshot)
+}
+
+// defaultTraceTtl 调试跟踪默认的持续时间
+const defaultTraceTtl = time.Minute * 10
+
+// DebugTrace 获取或设置调试跟踪
+//
+// GET 请求返回当前的跟踪条件, POST 请求通过 item, user, ttl 参数设置跟踪条件,
+// item 和 user 都为空时停止跟踪; 匹配的请求会临时输出调试日志并被请求录制记录下来
+func DebugTrace(c *gin.Context) {
+	if c.Request.Method == http.MethodPost {
+		item, user := c.Query("item"), c.Query("user")
+		if item == "" && user == "" {
+			logs.SetTrace(nil)
+			log.Println(colors.ToYellow("调试跟踪已停止"))
+			c.JSON(http.StatusOK, map[string]interface{}{"Enable": false})
+			return
+		}
+		ttl := defaultTraceTtl
+		if ttlStr := c.Query("ttl"); ttlStr != "" {
+			var err error
+			if ttl, err = time.ParseDuration(ttlStr); err != nil || ttl <= 0 {
+				c.String(http.StatusBadRequest, "ttl 参数错误: %s", ttlStr)
+				return
+			}
+		}
+		logs.SetTrace(&logs.Trace{Item: item, User: user, Expired: time.Now().Add(ttl)})
+		log.Printf(colors.ToYellow("调试跟踪已开启, item: %s, user: %s, 持续时间: %v"), item, user, ttl)
+	}
+
+	t, ok := logs.GetTrace()
+	if !ok {
+		c.JSON(http.StatusOK, map[string]interface{}{"Enable": false})
+		return
+	}
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"Enable":  true,
+		"Item":    t.Item,
+		"User":    t.User,
+		"Expired": t.Expired,
+	})
+}
@@ -0,0 +1,40 @@
+package admin
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/feature"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Features 获取或切换功能开关
+//
+// GET 请求返回所有功能的开启状态, POST 请求通过 name 和 enable 参数切换功能开关,
+// 切换后会清空响应缓存, 避免旧的缓存结果干扰排查
+func Features(c *gin.Context) {
+	if c.Request.Method == http.MethodPost {
+		name := feature.Name(c.Query("name"))
+		enable, err := strconv.ParseBool(c.Query("enable"))
+		if err != nil {
+			c.String(http.StatusBadRequest, "enable 参数错误: %v", err)
+			return
+		}
+		if err := feature.Set(name, enable); err != nil {
+			if errors.Is(err, feature.ErrInvalidName) {
+				c.String(http.StatusBadRequest, err.Error())
+				return
+			}
+			// 持久化失败不影响本次运行时的切换结果
+			log.Printf(colors.ToRed("功能开关持久化失败: %v"), err)
+		}
+		log.Printf(colors.ToYellow("功能 [%s] 开关已切换为: %v"), name, enable)
+		cache.Purge("")
+	}
+	c.JSON(http.StatusOK, feature.All())
+}
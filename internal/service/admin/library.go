@@ -0,0 +1,65 @@
+package admin
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// libraryDeletedEvent emby webhook 中 item 被删除的事件名称
+const libraryDeletedEvent = "library.deleted"
+
+// libraryWebhook emby webhook 推送内容中需要用到的字段
+type libraryWebhook struct {
+	Event string
+	Item  struct{ Id, Path string }
+}
+
+// LibraryChanged 接收媒体库变更通知, 立即更新缓存版本
+//
+// 可以配置为 emby webhook 的推送地址 (如: 新媒体加入媒体库事件), 只接受 POST 请求;
+// 推送的是 item 被删除事件 (library.deleted) 时, 同时清除该 item 残留的缓存
+func LibraryChanged(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.String(http.StatusMethodNotAllowed, "只支持 POST 请求")
+		return
+	}
+	reason := c.Query("reason")
+	hook, ok := parseLibraryWebhook(c)
+	if reason == "" && ok && hook.Event != "" {
+		reason = hook.Event
+	}
+	if reason == "" {
+		reason = "webhook"
+	}
+
+	purged := 0
+	if ok && hook.Event == libraryDeletedEvent {
+		purged = emby.PurgeItem(hook.Item.Id, hook.Item.Path)
+	}
+	emby.NotifyLibraryChanged(reason)
+	c.JSON(http.StatusOK, map[string]interface{}{"Version": cache.Version(), "Purged": purged})
+}
+
+// parseLibraryWebhook 解析 emby webhook 的推送内容
+//
+// emby 的 webhook 可能以 json 请求体推送, 也可能以表单的 data 字段推送, 解析失败时返回 false
+func parseLibraryWebhook(c *gin.Context) (libraryWebhook, bool) {
+	var hook libraryWebhook
+	var data []byte
+	if strings.HasPrefix(c.ContentType(), "multipart/") || c.ContentType() == "application/x-www-form-urlencoded" {
+		data = []byte(c.PostForm("data"))
+	} else if c.Request.Body != nil {
+		data, _ = io.ReadAll(c.Request.Body)
+	}
+	if len(data) == 0 || json.Unmarshal(data, &hook) != nil {
+		return hook, false
+	}
+	return hook, true
+}
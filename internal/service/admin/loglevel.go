@@ -0,0 +1,27 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// LogLevel 获取或切换日志级别
+//
+// GET 请求返回当前的日志级别, POST 请求通过 level 参数切换日志级别, 重启后恢复为配置文件中的级别
+func LogLevel(c *gin.Context) {
+	if c.Request.Method == http.MethodPost {
+		level, err := logs.ParseLevel(c.Query("level"))
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		logs.SetLevel(level)
+		log.Printf(colors.ToYellow("日志级别已切换为: %s"), level)
+	}
+	c.JSON(http.StatusOK, map[string]logs.Level{"Level": logs.GetLevel()})
+}
@@ -0,0 +1,19 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Latency 获取各个上游服务的耗时分位统计 (毫秒)
+func Latency(c *gin.Context) {
+	c.JSON(http.StatusOK, metrics.LatencySnapshot())
+}
+
+// Decisions 获取各个路由的改写决策次数统计, 按照决策结果和原因分类
+func Decisions(c *gin.Context) {
+	c.JSON(http.StatusOK, metrics.DecisionSnapshot())
+}
@@ -0,0 +1,207 @@
+package admin
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+
+	"github.com/gin-gonic/gin"
+)
+
+// operation 管理接口的描述信息, 用于生成 OpenAPI 文档
+type operation struct {
+	Path    string  // 接口路径, 路径参数使用 {name} 表示
+	Method  string  // 请求方法
+	Tag     string  // 分组
+	Summary string  // 接口说明
+	Params  []param // 参数列表
+	Preview bool    // 是否为转码资源相关的接口, 精简构建中不包含
+}
+
+// param 管理接口的参数
+type param struct {
+	Name     string // 参数名称
+	In       string // 参数位置: query, path
+	Desc     string // 参数说明
+	Required bool   // 是否必须
+}
+
+// operations 所有的管理接口, 新增管理接口时需要同步维护
+var operations = []operation{
+	{Path: "/admin/ui", Method: http.MethodGet, Tag: "dashboard", Summary: "管理面板页面"},
+	{Path: "/admin/requests", Method: http.MethodGet, Tag: "dashboard", Summary: "获取最近的请求记录"},
+	{Path: "/admin/health", Method: http.MethodGet, Tag: "dashboard", Summary: "探测 emby 和 alist 的健康状态"},
+	{Path: "/admin/metrics/latency", Method: http.MethodGet, Tag: "dashboard", Summary: "获取各个上游服务 (emby, alist, m3u8 播放列表和切片) 的耗时分位统计 (毫秒)"},
+	{Path: "/admin/metrics/decisions", Method: http.MethodGet, Tag: "dashboard", Summary: "获取各个路由的改写决策 (重定向, 中转, 回源, 拒绝) 次数统计"},
+	{Path: "/admin/debug/snapshot", Method: http.MethodGet, Tag: "dashboard", Summary: "获取当前程序的调试快照"},
+	{Path: "/admin/debug/trace", Method: http.MethodGet, Tag: "dashboard", Summary: "获取当前的调试跟踪条件"},
+	{Path: "/admin/debug/trace", Method: http.MethodPost, Tag: "dashboard", Summary: "针对单个 item 或用户开启调试跟踪, 匹配的请求临时输出调试日志并被请求录制记录, item 和 user 都为空时停止跟踪", Params: []param{
+		{Name: "item", In: "query", Desc: "跟踪的 item id"},
+		{Name: "user", In: "query", Desc: "跟踪的用户名或用户 id"},
+		{Name: "ttl", In: "query", Desc: "跟踪的持续时间, 如: 10m, 默认 10m"},
+	}},
+
+	{Path: "/admin/cache", Method: http.MethodGet, Tag: "cache", Summary: "获取缓存统计信息"},
+	{Path: "/admin/cache/purge", Method: http.MethodPost, Tag: "cache", Summary: "清除缓存", Params: []param{
+		{Name: "space", In: "query", Desc: "要清除的缓存空间, 不传递时清除所有缓存"},
+	}},
+	{Path: "/admin/library/changed", Method: http.MethodPost, Tag: "cache", Summary: "通知媒体库已经发生变化, 立即更新缓存版本, 收到 emby 的 item 删除事件时清除该 item 残留的缓存", Params: []param{
+		{Name: "reason", In: "query", Desc: "变更原因, 仅用于日志"},
+	}},
+
+	{Path: "/admin/sessions", Method: http.MethodGet, Tag: "sessions", Summary: "获取代理记录的所有活跃串流会话"},
+	{Path: "/admin/sessions/stop", Method: http.MethodPost, Tag: "sessions", Summary: "停止指定用户在指定设备上的播放", Params: []param{
+		{Name: "user", In: "query", Desc: "用户", Required: true},
+		{Name: "device", In: "query", Desc: "设备, 不传递时停止用户的所有播放"},
+	}},
+	{Path: "/admin/sessions/message", Method: http.MethodPost, Tag: "sessions", Summary: "向指定用户在指定设备上的客户端发送消息", Params: []param{
+		{Name: "user", In: "query", Desc: "用户", Required: true},
+		{Name: "device", In: "query", Desc: "设备, 不传递时发送到用户的所有设备"},
+		{Name: "text", In: "query", Desc: "消息内容", Required: true},
+		{Name: "header", In: "query", Desc: "消息标题"},
+		{Name: "timeout", In: "query", Desc: "消息显示时长, 如: 10s"},
+	}},
+	{Path: "/admin/sessions/broadcast", Method: http.MethodPost, Tag: "sessions", Summary: "通过本程序代理的 websocket 连接向客户端推送横幅消息, 不需要 emby 管理员权限", Params: []param{
+		{Name: "user", In: "query", Desc: "用户, 不传递时推送给所有连接的客户端"},
+		{Name: "device", In: "query", Desc: "设备, 不传递时推送给用户的所有设备"},
+		{Name: "text", In: "query", Desc: "消息内容", Required: true},
+		{Name: "header", In: "query", Desc: "消息标题"},
+		{Name: "timeout", In: "query", Desc: "消息显示时长, 如: 10s"},
+	}},
+
+	{Path: "/admin/stats", Method: http.MethodGet, Tag: "stats", Summary: "获取播放统计数据, 包括各个上游主机、用户和 item 的流量"},
+	{Path: "/admin/stats/reset", Method: http.MethodPost, Tag: "stats", Summary: "清空播放统计数据"},
+
+	{Path: "/admin/resolve/{itemId}", Method: http.MethodPost, Tag: "resolve", Summary: "对指定 item 完整执行一次直链解析流程, 返回每一步的诊断结果", Params: []param{
+		{Name: "itemId", In: "path", Desc: "emby item id", Required: true},
+		{Name: "MediaSourceId", In: "query", Desc: "要诊断的资源, 不传递时诊断第一个资源"},
+	}},
+	{Path: "/admin/simulate", Method: http.MethodGet, Tag: "resolve", Summary: "模拟指定客户端请求 item 的 PlaybackInfo, 返回命中的客户端规则、客户端会拿到的资源以及每个资源的播放方式 (302, proxy, origin); POST 请求时请求体作为客户端的 DeviceProfile", Params: []param{
+		{Name: "item", In: "query", Desc: "emby item id", Required: true},
+		{Name: "client", In: "query", Desc: "客户端名称 (X-Emby-Client)"},
+		{Name: "version", In: "query", Desc: "客户端版本 (X-Emby-Client-Version)"},
+		{Name: "device", In: "query", Desc: "设备 id"},
+		{Name: "user", In: "query", Desc: "用户名"},
+		{Name: "ua", In: "query", Desc: "客户端的 User-Agent"},
+		{Name: "ip", In: "query", Desc: "客户端 ip"},
+		{Name: "MediaSourceId", In: "query", Desc: "客户端请求携带的 MediaSourceId"},
+	}},
+	{Path: "/admin/pathmap/{itemId}", Method: http.MethodGet, Tag: "resolve", Summary: "查看 item 所有资源的路径映射缓存", Params: []param{
+		{Name: "itemId", In: "path", Desc: "emby item id", Required: true},
+	}},
+	{Path: "/admin/pathmap/{itemId}", Method: http.MethodDelete, Tag: "resolve", Summary: "清除 item 所有资源的路径映射缓存", Params: []param{
+		{Name: "itemId", In: "path", Desc: "emby item id", Required: true},
+	}},
+	{Path: "/admin/pathmap/override", Method: http.MethodGet, Tag: "resolve", Summary: "查看所有手动指定的 item 路径"},
+	{Path: "/admin/pathmap/override", Method: http.MethodPost, Tag: "resolve", Summary: "将 item 固定到指定的 alist 路径, 解析直链时优先于自动映射", Params: []param{
+		{Name: "itemId", In: "query", Desc: "emby item id", Required: true},
+		{Name: "alistPath", In: "query", Desc: "alist 中的文件路径", Required: true},
+		{Name: "MediaSourceId", In: "query", Desc: "要指定路径的资源, 不传递时使用第一个资源"},
+	}},
+	{Path: "/admin/pathmap/override", Method: http.MethodDelete, Tag: "resolve", Summary: "移除 item 手动指定的路径", Params: []param{
+		{Name: "itemId", In: "query", Desc: "emby item id", Required: true},
+	}},
+	{Path: "/admin/preview/{itemId}", Method: http.MethodGet, Tag: "resolve", Summary: "查看 item 在 alist 中当前可用的转码清晰度, 以及播放列表的维护状态和最近的更新失败记录", Params: []param{
+		{Name: "itemId", In: "path", Desc: "emby item id", Required: true},
+	}, Preview: true},
+	{Path: "/admin/preview/pin", Method: http.MethodGet, Tag: "resolve", Summary: "查看所有剧集固定的转码清晰度", Preview: true},
+	{Path: "/admin/preview/pin", Method: http.MethodPost, Tag: "resolve", Summary: "固定剧集使用的转码清晰度, 剧集中的所有单集只返回该清晰度的转码资源", Params: []param{
+		{Name: "seriesId", In: "query", Desc: "剧集 id, 也可以传递剧集中任意一集的 item id", Required: true},
+		{Name: "template", In: "query", Desc: "转码清晰度, 如: FHD", Required: true},
+	}, Preview: true},
+	{Path: "/admin/preview/pin", Method: http.MethodDelete, Tag: "resolve", Summary: "移除剧集固定的转码清晰度", Params: []param{
+		{Name: "seriesId", In: "query", Desc: "剧集 id", Required: true},
+	}, Preview: true},
+
+	{Path: "/admin/config", Method: http.MethodGet, Tag: "config", Summary: "获取当前生效的配置, 敏感信息已脱敏"},
+	{Path: "/admin/features", Method: http.MethodGet, Tag: "config", Summary: "获取所有功能的开启状态"},
+	{Path: "/admin/features", Method: http.MethodPost, Tag: "config", Summary: "切换功能开关, 切换后清空响应缓存", Params: []param{
+		{Name: "name", In: "query", Desc: "功能名称", Required: true},
+		{Name: "enable", In: "query", Desc: "是否开启: true, false", Required: true},
+	}},
+	{Path: "/admin/loglevel", Method: http.MethodGet, Tag: "config", Summary: "获取当前的日志级别"},
+	{Path: "/admin/loglevel", Method: http.MethodPost, Tag: "config", Summary: "切换日志级别, 重启后恢复为配置文件中的级别", Params: []param{
+		{Name: "level", In: "query", Desc: "日志级别", Required: true},
+	}},
+	{Path: "/admin/version", Method: http.MethodGet, Tag: "config", Summary: "获取当前版本和最近一次检查到的最新版本", Params: []param{
+		{Name: "refresh", In: "query", Desc: "是否立即检查一次新版本: true, false"},
+	}},
+	{Path: "/admin/version/update", Method: http.MethodPost, Tag: "config", Summary: "下载最新版本替换当前程序并平滑重启, 需要配置 update.apply 为 manual 或 auto"},
+	{Path: "/admin/openapi.json", Method: http.MethodGet, Tag: "config", Summary: "获取管理接口的 OpenAPI 文档"},
+
+	{Path: "/admin/capture", Method: http.MethodGet, Tag: "capture", Summary: "获取请求录制状态和记录条数"},
+	{Path: "/admin/capture", Method: http.MethodPost, Tag: "capture", Summary: "切换请求录制状态, 重启后恢复为配置文件中的状态", Params: []param{
+		{Name: "enable", In: "query", Desc: "是否开启: true, false", Required: true},
+	}},
+	{Path: "/admin/capture/export", Method: http.MethodGet, Tag: "capture", Summary: "下载请求录制记录", Params: []param{
+		{Name: "format", In: "query", Desc: "导出格式: har (默认), jsonl"},
+	}},
+	{Path: "/admin/capture/clear", Method: http.MethodPost, Tag: "capture", Summary: "清空请求录制记录"},
+}
+
+// pathParamRegex 匹配路径参数
+var pathParamRegex = regexp.MustCompile(`\{(\w+)\}`)
+
+// OpenApi 获取管理接口的 OpenAPI 文档
+func OpenApi(c *gin.Context) {
+	c.JSON(http.StatusOK, openApiSpec())
+}
+
+// openApiSpec 根据 operations 生成 OpenAPI 3.0 文档
+func openApiSpec() map[string]interface{} {
+	paths := map[string]map[string]interface{}{}
+	for _, op := range operations {
+		if op.Preview && constant.Minimal {
+			continue
+		}
+		params := make([]map[string]interface{}, 0, len(op.Params))
+		for _, p := range op.Params {
+			params = append(params, map[string]interface{}{
+				"name":        p.Name,
+				"in":          p.In,
+				"description": p.Desc,
+				"required":    p.Required || p.In == "path",
+				"schema":      map[string]string{"type": "string"},
+			})
+		}
+
+		if paths[op.Path] == nil {
+			paths[op.Path] = map[string]interface{}{}
+		}
+		paths[op.Path][strings.ToLower(op.Method)] = map[string]interface{}{
+			"tags":        []string{op.Tag},
+			"summary":     op.Summary,
+			"operationId": operationId(op),
+			"parameters":  params,
+			"responses": map[string]interface{}{
+				"200": map[string]string{"description": "成功"},
+				"403": map[string]string{"description": "管理接口鉴权失败"},
+			},
+		}
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]string{
+			"title":   "go-emby2alist admin api",
+			"version": constant.CurrentVersion,
+		},
+		"paths": paths,
+		"components": map[string]interface{}{
+			"securitySchemes": map[string]interface{}{
+				"headerToken": map[string]string{"type": "apiKey", "in": "header", "name": HeaderTokenName},
+				"queryToken":  map[string]string{"type": "apiKey", "in": "query", "name": QueryTokenName},
+			},
+		},
+		"security": []map[string][]string{{"headerToken": {}}, {"queryToken": {}}},
+	}
+}
+
+// operationId 生成接口的唯一标识, 如: post_admin_cache_purge
+func operationId(op operation) string {
+	p := pathParamRegex.ReplaceAllString(op.Path, "$1")
+	p = strings.NewReplacer("/", "_", ".", "_").Replace(strings.Trim(p, "/"))
+	return strings.ToLower(op.Method) + "_" + p
+}
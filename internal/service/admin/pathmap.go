@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/pathmap"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// pathmapItemIdRegex 从路径映射接口地址中匹配出 item id
+var pathmapItemIdRegex = regexp.MustCompile(`(?i)^/admin/pathmap/(\d+)`)
+
+// PathMap 查看 (GET) 或清除 (DELETE) 单个 item 的路径映射缓存
+func PathMap(c *gin.Context) {
+	matches := pathmapItemIdRegex.FindStringSubmatch(c.Request.URL.Path)
+	if len(matches) < 2 {
+		c.String(http.StatusBadRequest, "item id 格式错误")
+		return
+	}
+	itemId := matches[1]
+
+	switch c.Request.Method {
+	case http.MethodGet:
+		mappings, err := emby.ItemPathMappings(itemId)
+		if err != nil {
+			c.String(http.StatusBadGateway, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, mappings)
+	case http.MethodDelete:
+		cnt, err := emby.InvalidateItemPathMappings(itemId)
+		if err != nil {
+			c.String(http.StatusBadGateway, err.Error())
+			return
+		}
+		c.JSON(http.StatusOK, map[string]int{"Removed": cnt})
+	default:
+		c.String(http.StatusMethodNotAllowed, "只支持 GET, DELETE 请求")
+	}
+}
+
+// PathMapOverride 查看 (GET), 设置 (POST) 或移除 (DELETE) 手动指定的 item 路径
+//
+// 自动映射无法找到文件时, 可以将 item 固定到指定的 alist 路径, 解析直链时优先使用
+func PathMapOverride(c *gin.Context) {
+	itemId := c.Query("itemId")
+	switch c.Request.Method {
+	case http.MethodGet:
+		c.JSON(http.StatusOK, pathmap.Overrides())
+	case http.MethodPost:
+		alistPath := c.Query("alistPath")
+		if strs.AnyEmpty(itemId, alistPath) {
+			c.String(http.StatusBadRequest, "itemId 和 alistPath 不能为空")
+			return
+		}
+		o, err := emby.OverrideItemPath(itemId, c.Query("MediaSourceId"), alistPath)
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		log.Printf(colors.ToYellow("手动指定路径, item: %s, %s => %s"), itemId, o.EmbyPath, o.AlistPath)
+		c.JSON(http.StatusOK, o)
+	case http.MethodDelete:
+		if strs.AnyEmpty(itemId) {
+			c.String(http.StatusBadRequest, "itemId 不能为空")
+			return
+		}
+		c.JSON(http.StatusOK, map[string]bool{"Removed": pathmap.RemoveOverride(itemId)})
+	default:
+		c.String(http.StatusMethodNotAllowed, "只支持 GET, POST, DELETE 请求")
+	}
+}
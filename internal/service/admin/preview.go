@@ -0,0 +1,94 @@
+//go:build !minimal
+
+package admin
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/m3u8"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// previewItemIdRegex 从转码状态接口地址中匹配出 item id
+var previewItemIdRegex = regexp.MustCompile(`(?i)^/admin/preview/(\d+)`)
+
+// previewResult item 的转码状态
+type previewResult struct {
+	Enable       bool
+	Lazy         bool
+	NoPreviewTag bool
+	Sources      []previewSourceResult
+}
+
+// previewSourceResult 单个资源的转码状态, 附带内存中播放列表的维护状态
+type previewSourceResult struct {
+	emby.PreviewSourceStatus
+	Playlists []m3u8.PlaylistStatus
+}
+
+// Preview 查看 item 在 alist 中当前可用的转码清晰度, 以及播放列表的维护状态和最近的更新失败记录, 只允许 GET 请求
+func Preview(c *gin.Context) {
+	if c.Request.Method != http.MethodGet {
+		c.String(http.StatusMethodNotAllowed, "请使用 GET 请求")
+		return
+	}
+	matches := previewItemIdRegex.FindStringSubmatch(c.Request.URL.Path)
+	if len(matches) < 2 {
+		c.String(http.StatusBadRequest, "item id 格式错误")
+		return
+	}
+
+	status, err := emby.ItemPreviewStatus(matches[1])
+	if err != nil {
+		c.String(http.StatusBadGateway, err.Error())
+		return
+	}
+	res := previewResult{Enable: status.Enable, Lazy: status.Lazy, NoPreviewTag: status.NoPreviewTag, Sources: make([]previewSourceResult, 0, len(status.Sources))}
+	for _, source := range status.Sources {
+		sr := previewSourceResult{PreviewSourceStatus: source, Playlists: make([]m3u8.PlaylistStatus, 0)}
+		if strs.AllNotEmpty(source.AlistPath) {
+			sr.Playlists = m3u8.GetPlaylistStatus(source.AlistPath)
+		}
+		res.Sources = append(res.Sources, sr)
+	}
+	c.JSON(http.StatusOK, res)
+}
+
+// PreviewPin 查看 (GET), 设置 (POST) 或移除 (DELETE) 剧集固定的转码清晰度
+//
+// 固定之后剧集中的所有单集只返回该清晰度的转码资源, 修改之后清空 PlaybackInfo 缓存
+func PreviewPin(c *gin.Context) {
+	seriesId := c.Query("seriesId")
+	switch c.Request.Method {
+	case http.MethodGet:
+		c.JSON(http.StatusOK, emby.SeriesPins())
+	case http.MethodPost:
+		pin, err := emby.PinSeriesTemplate(seriesId, c.Query("template"))
+		if err != nil {
+			c.String(http.StatusBadRequest, err.Error())
+			return
+		}
+		cache.Purge(emby.PlaybackCacheSpace)
+		log.Printf(colors.ToYellow("剧集 [%s] 固定使用转码清晰度: %s"), pin.SeriesId, pin.TemplateId)
+		c.JSON(http.StatusOK, pin)
+	case http.MethodDelete:
+		if strs.AnyEmpty(seriesId) {
+			c.String(http.StatusBadRequest, "seriesId 不能为空")
+			return
+		}
+		removed := emby.UnpinSeriesTemplate(seriesId)
+		if removed {
+			cache.Purge(emby.PlaybackCacheSpace)
+		}
+		c.JSON(http.StatusOK, map[string]bool{"Removed": removed})
+	default:
+		c.String(http.StatusMethodNotAllowed, "只支持 GET, POST, DELETE 请求")
+	}
+}
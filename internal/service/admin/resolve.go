@@ -0,0 +1,29 @@
+package admin
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resolveItemIdRegex 从诊断接口地址中匹配出 item id
+var resolveItemIdRegex = regexp.MustCompile(`(?i)^/admin/resolve/(\d+)`)
+
+// Resolve 对指定 item 完整执行一次直链解析流程, 返回每一步的诊断结果, 只允许 POST 请求
+//
+// 可选参数: MediaSourceId 指定要诊断的资源, 不传递时诊断第一个资源
+func Resolve(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.String(http.StatusMethodNotAllowed, "请使用 POST 请求")
+		return
+	}
+	matches := resolveItemIdRegex.FindStringSubmatch(c.Request.URL.Path)
+	if len(matches) < 2 {
+		c.String(http.StatusBadRequest, "item id 格式错误")
+		return
+	}
+	c.JSON(http.StatusOK, emby.DiagnoseItem(matches[1], c.Query("MediaSourceId")))
+}
@@ -0,0 +1,93 @@
+package admin
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Sessions 获取代理记录的所有活跃串流会话
+func Sessions(c *gin.Context) {
+	c.JSON(http.StatusOK, emby.StreamSessions())
+}
+
+// StopSession 停止指定用户 (user) 在指定设备 (device) 上的播放, 只允许 POST 请求
+//
+// 不传递 device 时停止用户的所有播放
+func StopSession(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.String(http.StatusMethodNotAllowed, "请使用 POST 请求")
+		return
+	}
+	count, err := emby.StopStreamSession(c.Query("user"), c.Query("device"))
+	respondSessionCommand(c, count, err)
+}
+
+// SendSessionMessage 向指定用户 (user) 在指定设备 (device) 上的客户端发送消息, 只允许 POST 请求
+//
+// 消息内容通过 text 参数传递, 可选参数: header 消息标题, timeout 消息显示时长 (如: 10s)
+func SendSessionMessage(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.String(http.StatusMethodNotAllowed, "请使用 POST 请求")
+		return
+	}
+	text := c.Query("text")
+	if strs.AnyEmpty(text) {
+		c.String(http.StatusBadRequest, "消息内容不能为空")
+		return
+	}
+	var timeout time.Duration
+	if t := c.Query("timeout"); strs.AllNotEmpty(t) {
+		var err error
+		if timeout, err = time.ParseDuration(t); err != nil {
+			c.String(http.StatusBadRequest, "timeout 参数错误: %v", err)
+			return
+		}
+	}
+	count, err := emby.SendSessionMessage(c.Query("user"), c.Query("device"), c.Query("header"), text, timeout)
+	respondSessionCommand(c, count, err)
+}
+
+// BroadcastMessage 通过本程序代理的 websocket 连接向客户端推送横幅消息, 只允许 POST 请求
+//
+// 不经过 emby 的会话接口, 不需要 emby 管理员权限; 消息内容通过 text 参数传递,
+// 可选参数: user 用户名, device 设备, 都为空时推送给所有连接的客户端; header 消息标题, timeout 消息显示时长 (如: 10s)
+func BroadcastMessage(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.String(http.StatusMethodNotAllowed, "请使用 POST 请求")
+		return
+	}
+	text := c.Query("text")
+	if strs.AnyEmpty(text) {
+		c.String(http.StatusBadRequest, "消息内容不能为空")
+		return
+	}
+	var timeout time.Duration
+	if t := c.Query("timeout"); strs.AllNotEmpty(t) {
+		var err error
+		if timeout, err = time.ParseDuration(t); err != nil {
+			c.String(http.StatusBadRequest, "timeout 参数错误: %v", err)
+			return
+		}
+	}
+	count := emby.BroadcastMessage(c.Query("user"), c.Query("device"), c.Query("header"), text, timeout)
+	c.JSON(http.StatusOK, map[string]int{"connections": count})
+}
+
+// respondSessionCommand 响应会话控制指令的执行结果
+func respondSessionCommand(c *gin.Context, count int, err error) {
+	if errors.Is(err, emby.ErrSessionNotFound) {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		c.String(http.StatusBadGateway, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, map[string]int{"sessions": count})
+}
@@ -0,0 +1,45 @@
+package admin
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Simulate 模拟指定客户端请求 item 的 PlaybackInfo, 返回命中的客户端规则、客户端会拿到的资源以及每个资源的播放方式,
+// 用于排查某个客户端为什么走了转码
+//
+// 必须参数: item; 可选参数: client, version, device, user, ua, ip, MediaSourceId,
+// POST 请求时请求体作为客户端的 DeviceProfile
+func Simulate(c *gin.Context) {
+	item := c.Query("item")
+	if strs.AnyEmpty(item) {
+		c.String(http.StatusBadRequest, "参数 item 不能为空")
+		return
+	}
+
+	var body []byte
+	if c.Request.Method == http.MethodPost {
+		var err error
+		if body, err = io.ReadAll(c.Request.Body); err != nil {
+			c.String(http.StatusBadRequest, "读取请求体失败: %v", err)
+			return
+		}
+	}
+
+	c.JSON(http.StatusOK, emby.SimulatePlayback(emby.SimulateParams{
+		ItemId:        item,
+		MediaSourceId: c.Query("MediaSourceId"),
+		Client:        c.Query("client"),
+		Version:       c.Query("version"),
+		Device:        c.Query("device"),
+		User:          c.Query("user"),
+		UserAgent:     c.Query("ua"),
+		Ip:            c.Query("ip"),
+		Body:          body,
+	}))
+}
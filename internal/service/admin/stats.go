@@ -0,0 +1,24 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/stats"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Stats 获取播放统计数据
+func Stats(c *gin.Context) {
+	c.JSON(http.StatusOK, stats.Snapshot())
+}
+
+// ResetStats 清空播放统计数据, 只允许 POST 请求
+func ResetStats(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.String(http.StatusMethodNotAllowed, "请使用 POST 请求")
+		return
+	}
+	stats.Reset()
+	c.JSON(http.StatusOK, stats.Snapshot())
+}
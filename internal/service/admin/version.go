@@ -0,0 +1,35 @@
+package admin
+
+import (
+	"net/http"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/updater"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Version 获取当前版本和最近一次检查到的最新版本
+//
+// refresh 参数为 true 时立即检查一次新版本
+func Version(c *gin.Context) {
+	if c.Query("refresh") == "true" {
+		if _, err := updater.Check(c.Request.Context()); err != nil {
+			c.String(http.StatusBadGateway, err.Error())
+			return
+		}
+	}
+	c.JSON(http.StatusOK, updater.GetStatus())
+}
+
+// UpdateVersion 下载最新版本替换当前程序, 成功后平滑重启服务, 只允许 POST 请求
+func UpdateVersion(c *gin.Context) {
+	if c.Request.Method != http.MethodPost {
+		c.String(http.StatusMethodNotAllowed, "请使用 POST 请求")
+		return
+	}
+	if err := updater.Apply(c.Request.Context()); err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, updater.GetStatus())
+}
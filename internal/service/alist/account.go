@@ -0,0 +1,25 @@
+package alist
+
+import "context"
+
+// accountCtxKey 上下文中记录 alist 账号名称的 key
+type accountCtxKey struct{}
+
+// WithAccount 返回携带 alist 账号的上下文
+//
+// 使用该上下文请求 alist 时, 使用账号对应的访问地址和 api key, account 为空表示默认账号
+func WithAccount(ctx context.Context, account string) context.Context {
+	if account == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, accountCtxKey{}, account)
+}
+
+// AccountOf 获取上下文中的 alist 账号名称, 默认账号返回空
+func AccountOf(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	account, _ := ctx.Value(accountCtxKey{}).(string)
+	return account
+}
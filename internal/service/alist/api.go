@@ -1,30 +1,71 @@
 package alist
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"sync"
+	"time"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/config"
 	"github.com/AmbitiousJun/go-emby2alist/internal/model"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/notify"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/preview"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/schema"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/breaker"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
 )
 
+// fetchBreakers alist 请求熔断器, 每个账号独立熔断, 在首次请求时根据配置初始化
+var fetchBreakers = sync.Map{}
+
+// fetchBreaker 获取账号对应的熔断器
+func fetchBreaker(account string) *breaker.Breaker {
+	if b, ok := fetchBreakers.Load(account); ok {
+		return b.(*breaker.Breaker)
+	}
+	cfg := config.C.Alist.Breaker
+	b, _ := fetchBreakers.LoadOrStore(account, breaker.New(cfg.Threshold, cfg.CooldownDuration()))
+	return b.(*breaker.Breaker)
+}
+
+// BreakerState 获取默认账号熔断器的当前状态
+func BreakerState() breaker.State {
+	return fetchBreaker("").State()
+}
+
 // FetchResource 请求 alist 资源 url 直链
 func FetchResource(fi FetchInfo) model.HttpRes[Resource] {
 	if strs.AnyEmpty(fi.Path) {
 		return model.HttpRes[Resource]{Code: http.StatusBadRequest, Msg: "参数 path 不能为空"}
 	}
+	if fi.Ctx == nil {
+		fi.Ctx = context.Background()
+	}
 
 	if !fi.UseTranscode {
 		// 请求原画资源
-		res := FetchFsGet(fi.Path, fi.Header)
+		release, err := acquireFetch(fi.Ctx, rawTemplate)
+		if err != nil {
+			return model.HttpRes[Resource]{Code: http.StatusTooManyRequests, Msg: err.Error()}
+		}
+		res := FetchFsGet(fi.Ctx, fi.Path, fi.Header)
+		release()
 		if res.Code == http.StatusOK {
+			if err := schema.Check(schema.AlistFsGet, res.Data); err != nil {
+				return model.HttpRes[Resource]{Code: http.StatusBadGateway, Msg: err.Error()}
+			}
 			if link, ok := res.Data.Attr("raw_url").String(); ok {
-				return model.HttpRes[Resource]{Code: http.StatusOK, Data: Resource{Url: link}}
+				sign, _ := res.Data.Attr("sign").String()
+				size, _ := res.Data.Attr("size").Int64()
+				return model.HttpRes[Resource]{Code: http.StatusOK, Data: Resource{Url: link, Sign: sign, Size: size}}
 			}
 		}
 		if res.Msg == "" {
@@ -44,7 +85,12 @@ func FetchResource(fi FetchInfo) model.HttpRes[Resource] {
 	}
 
 	// 请求转码资源
-	res := FetchFsOther(fi.Path, fi.Header)
+	release, err := acquireFetch(fi.Ctx, fi.Format)
+	if err != nil {
+		return failedAndTryRaw(model.HttpRes[*jsons.Item]{Code: http.StatusTooManyRequests, Msg: err.Error()})
+	}
+	res := FetchFsOther(fi.Ctx, fi.Path, fi.Header)
+	release()
 	if res.Code != http.StatusOK {
 		return failedAndTryRaw(res)
 	}
@@ -83,14 +129,31 @@ func FetchResource(fi FetchInfo) model.HttpRes[Resource] {
 	return model.HttpRes[Resource]{Code: http.StatusOK, Data: Resource{Url: link, Subtitles: subtitles}}
 }
 
+// ProxyUrl 获取 alist 资源的本地代理链接, 由 alist 服务器中转资源
+//
+// ctx 中携带的账号决定使用哪一个 alist 服务器
+func ProxyUrl(ctx context.Context, path, sign string) string {
+	host, _ := config.C.Alist.Credential(AccountOf(ctx))
+	return host + ProxyPath(path, sign)
+}
+
+// ProxyPath 获取 alist 资源本地代理链接的路径部分, 如: /p/movie/a.mp4?sign=xxx
+func ProxyPath(path, sign string) string {
+	u := url.URL{Path: "/p" + path}
+	if strs.AllNotEmpty(sign) {
+		u.RawQuery = "sign=" + url.QueryEscape(sign)
+	}
+	return u.String()
+}
+
 // FetchFsList 请求 alist "/api/fs/list" 接口
 //
 // 传入 path 与接口的 path 作用一致
-func FetchFsList(path string, header http.Header) model.HttpRes[*jsons.Item] {
+func FetchFsList(ctx context.Context, path string, header http.Header) model.HttpRes[*jsons.Item] {
 	if strs.AnyEmpty(path) {
 		return model.HttpRes[*jsons.Item]{Code: http.StatusBadRequest, Msg: "参数 path 不能为空"}
 	}
-	return Fetch("/api/fs/list", http.MethodPost, header, map[string]interface{}{
+	return FetchCtx(ctx, "/api/fs/list", http.MethodPost, header, map[string]interface{}{
 		"refresh":  true,
 		"password": "",
 		"path":     path,
@@ -100,12 +163,12 @@ func FetchFsList(path string, header http.Header) model.HttpRes[*jsons.Item] {
 // FetchFsGet 请求 alist "/api/fs/get" 接口
 //
 // 传入 path 与接口的 path 作用一致
-func FetchFsGet(path string, header http.Header) model.HttpRes[*jsons.Item] {
+func FetchFsGet(ctx context.Context, path string, header http.Header) model.HttpRes[*jsons.Item] {
 	if strs.AnyEmpty(path) {
 		return model.HttpRes[*jsons.Item]{Code: http.StatusBadRequest, Msg: "参数 path 不能为空"}
 	}
 
-	return Fetch("/api/fs/get", http.MethodPost, header, map[string]interface{}{
+	return FetchCtx(ctx, "/api/fs/get", http.MethodPost, header, map[string]interface{}{
 		"refresh":  true,
 		"password": "",
 		"path":     path,
@@ -114,13 +177,27 @@ func FetchFsGet(path string, header http.Header) model.HttpRes[*jsons.Item] {
 
 // FetchFsOther 请求 alist "/api/fs/other" 接口
 //
-// 传入 path 与接口的 path 作用一致
-func FetchFsOther(path string, header http.Header) model.HttpRes[*jsons.Item] {
+// 传入 path 与接口的 path 作用一致,
+// 配置了匹配路径的网盘原生转码接口 (video-preview.providers) 时优先使用原生接口, 请求失败再回退到 alist
+func FetchFsOther(ctx context.Context, path string, header http.Header) model.HttpRes[*jsons.Item] {
 	if strs.AnyEmpty(path) {
 		return model.HttpRes[*jsons.Item]{Code: http.StatusBadRequest, Msg: "参数 path 不能为空"}
 	}
 
-	return Fetch("/api/fs/other", http.MethodPost, header, map[string]interface{}{
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	info, matched, err := preview.PlayInfo(ctx, path)
+	if matched && err == nil {
+		data := jsons.NewEmptyObj()
+		data.Put("video_preview_play_info", info)
+		return model.HttpRes[*jsons.Item]{Code: http.StatusOK, Data: data}
+	}
+	if matched {
+		log.Printf(colors.ToYellow("请求网盘原生转码接口失败, 回退到 alist, path: %s, err: %v"), path, err)
+	}
+
+	return FetchCtx(ctx, "/api/fs/other", http.MethodPost, header, map[string]interface{}{
 		"method":   "video_preview",
 		"password": "",
 		"path":     path,
@@ -129,8 +206,16 @@ func FetchFsOther(path string, header http.Header) model.HttpRes[*jsons.Item] {
 
 // Fetch 请求 alist api
 func Fetch(uri, method string, header http.Header, body map[string]interface{}) model.HttpRes[*jsons.Item] {
-	host := config.C.Alist.Host
-	token := config.C.Alist.Token
+	return FetchCtx(context.Background(), uri, method, header, body)
+}
+
+// FetchCtx 请求 alist api, ctx 结束时中断请求
+//
+// 通过 WithAccount 指定账号时, 使用账号对应的 alist 服务器和 api key;
+// 配置了 alist.mirrors 时, 访问地址不可用会自动切换到备用地址
+func FetchCtx(ctx context.Context, uri, method string, header http.Header, body map[string]interface{}) model.HttpRes[*jsons.Item] {
+	account := AccountOf(ctx)
+	host, token := config.C.Alist.Credential(account)
 
 	// 1 发出请求
 	if header == nil {
@@ -138,17 +223,39 @@ func Fetch(uri, method string, header http.Header, body map[string]interface{})
 	}
 	header.Set("Content-Type", "application/json;charset=utf-8")
 	header.Set("Authorization", token)
+	// alist api 均为查询接口, 允许失败重试
+	https.MarkIdempotent(header)
 
-	resp, err := https.Request(method, host+uri, header, https.MapBody(body))
-	if err != nil {
+	// 熔断中, 直接返回失败, 交由调用方的异常策略处理
+	fb := fetchBreaker(account)
+	if !fb.Allow() {
+		return model.HttpRes[*jsons.Item]{Code: http.StatusServiceUnavailable, Msg: "alist 请求熔断中, 暂不可用"}
+	}
+
+	start := time.Now()
+	code, bodyBytes, err := fetchMirrors(ctx, host, uri, method, header, body)
+	metrics.ObserveLatency(metrics.UpstreamAlist, time.Since(start))
+	if err != nil && ctx.Err() != nil {
+		// 请求被取消不代表 alist 不可用, 不计入熔断
+		fb.Cancel()
+		return model.HttpRes[*jsons.Item]{Code: http.StatusBadRequest, Msg: "请求已取消: " + err.Error()}
+	}
+	if err != nil && code == 0 {
+		fb.Failure()
+		notify.Failure(notify.KindAlist, err.Error())
 		return model.HttpRes[*jsons.Item]{Code: http.StatusBadRequest, Msg: "请求发送失败: " + err.Error()}
 	}
-	defer resp.Body.Close()
+	if code >= http.StatusInternalServerError {
+		fb.Failure()
+		notify.Failure(notify.KindAlist, fmt.Sprintf("alist 响应异常, uri: %s, code: %d", uri, code))
+	} else {
+		fb.Success()
+		notify.Success(notify.KindAlist)
+	}
 
 	// 2 封装响应
-	bodyBytes, err := io.ReadAll(resp.Body)
 	if err != nil {
-		return model.HttpRes[*jsons.Item]{Code: http.StatusBadRequest, Msg: "读取响应体失败: " + err.Error()}
+		return model.HttpRes[*jsons.Item]{Code: http.StatusBadRequest, Msg: err.Error()}
 	}
 	result, err := jsons.New(string(bodyBytes))
 	if err != nil {
@@ -165,3 +272,57 @@ func Fetch(uri, method string, header http.Header, body map[string]interface{})
 
 	return model.HttpRes[*jsons.Item]{Code: http.StatusBadRequest, Msg: "未知异常, result: " + result.String()}
 }
+
+// fetchMirrors 依次使用访问地址及其备用地址请求 alist api, 返回第一个成功的响应码和响应体
+//
+// 请求失败、超时或者响应 5xx 时切换到下一个地址, 所有地址都失败时返回最后一个地址的结果;
+// 请求发送失败时响应码为 0
+func fetchMirrors(ctx context.Context, host, uri, method string, header http.Header, body map[string]interface{}) (int, []byte, error) {
+	hosts := mirrorCandidates(host)
+	var (
+		code      int
+		bodyBytes []byte
+		err       error
+	)
+	for i, h := range hosts {
+		code, bodyBytes, err = fetchOnce(ctx, method, h+uri, header, body, len(hosts) > 1)
+		if ctx.Err() != nil || len(hosts) == 1 {
+			return code, bodyBytes, err
+		}
+		if err == nil && code < http.StatusInternalServerError {
+			markMirrorUp(h)
+			return code, bodyBytes, nil
+		}
+
+		markMirrorDown(h)
+		reason := fmt.Sprintf("code: %d", code)
+		if err != nil {
+			reason = err.Error()
+		}
+		if i < len(hosts)-1 {
+			log.Printf(colors.ToYellow("alist 地址 [%s] 请求失败: %s, 切换到备用地址 [%s]"), h, reason, hosts[i+1])
+		}
+	}
+	return code, bodyBytes, err
+}
+
+// fetchOnce 向单个 alist 地址发起请求并读取响应体
+//
+// withTimeout 为 true 时使用 alist.mirror-timeout 限制请求时间, 请求发送失败时响应码为 0
+func fetchOnce(ctx context.Context, method, url string, header http.Header, body map[string]interface{}, withTimeout bool) (int, []byte, error) {
+	if withTimeout {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, config.C.Alist.MirrorTimeoutDuration())
+		defer cancel()
+	}
+	resp, err := https.RequestCtx(ctx, method, url, header, https.MapBody(body))
+	if err != nil {
+		return 0, nil, err
+	}
+	defer resp.Body.Close()
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return resp.StatusCode, nil, fmt.Errorf("读取响应体失败: %v", err)
+	}
+	return resp.StatusCode, bodyBytes, nil
+}
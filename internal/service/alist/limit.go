@@ -0,0 +1,54 @@
+package alist
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/ratelimit"
+)
+
+// rawTemplate 原画资源在并发控制中使用的清晰度名称
+const rawTemplate = "raw"
+
+var (
+	// fetchBuckets qps => 全局令牌桶, 在首次请求时根据配置初始化
+	fetchBuckets = sync.Map{}
+	// fetchSemaphores 清晰度 => 并发控制信号量
+	fetchSemaphores = sync.Map{}
+)
+
+// acquireFetch 按照 alist.rate-limit 配置获取一次资源请求的许可
+//
+// 成功时返回释放许可的函数, 请求结束之后需要调用; 排队超时或 ctx 结束时返回错误
+func acquireFetch(ctx context.Context, template string) (func(), error) {
+	cfg := config.C.Alist.RateLimit
+	if cfg.QPS <= 0 && cfg.Concurrency <= 0 {
+		return func() {}, nil
+	}
+	ctx, cancel := context.WithTimeout(ctx, cfg.TimeoutDuration())
+	defer cancel()
+
+	release := func() {}
+	if cfg.Concurrency > 0 {
+		key := fmt.Sprintf("%s|%d", template, cfg.Concurrency)
+		sem, _ := fetchSemaphores.LoadOrStore(key, make(chan struct{}, cfg.Concurrency))
+		ch := sem.(chan struct{})
+		select {
+		case ch <- struct{}{}:
+			release = sync.OnceFunc(func() { <-ch })
+		case <-ctx.Done():
+			return nil, fmt.Errorf("清晰度 %s 的并发请求数已达上限 %d, 排队超时", template, cfg.Concurrency)
+		}
+	}
+
+	if cfg.QPS > 0 {
+		bucket, _ := fetchBuckets.LoadOrStore(cfg.QPS, ratelimit.NewBucket(int64(cfg.QPS)))
+		if err := bucket.(*ratelimit.Bucket).Wait(ctx, 1); err != nil {
+			release()
+			return nil, fmt.Errorf("请求频率已达上限 %d/s, 排队超时", cfg.QPS)
+		}
+	}
+	return release, nil
+}
@@ -0,0 +1,41 @@
+package alist
+
+import (
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+)
+
+// mirrorDownUntil alist 访问地址 => 请求失败之后暂时跳过该地址的截止时间
+var mirrorDownUntil = sync.Map{}
+
+// mirrorCandidates 获取本次请求依次尝试的访问地址
+//
+// 可用的地址按照配置顺序排在前面, 暂时跳过的地址排在最后作为兜底
+func mirrorCandidates(host string) []string {
+	hosts := config.C.Alist.HostsOf(host)
+	if len(hosts) == 1 {
+		return hosts
+	}
+	healthy, down := make([]string, 0, len(hosts)), make([]string, 0)
+	now := time.Now()
+	for _, h := range hosts {
+		if until, ok := mirrorDownUntil.Load(h); ok && now.Before(until.(time.Time)) {
+			down = append(down, h)
+			continue
+		}
+		healthy = append(healthy, h)
+	}
+	return append(healthy, down...)
+}
+
+// markMirrorDown 记录访问地址请求失败, 在熔断冷却时间内优先使用其他地址
+func markMirrorDown(host string) {
+	mirrorDownUntil.Store(host, time.Now().Add(config.C.Alist.Breaker.CooldownDuration()))
+}
+
+// markMirrorUp 记录访问地址请求成功, 恢复按照配置顺序使用
+func markMirrorUp(host string) {
+	mirrorDownUntil.Delete(host)
+}
@@ -1,19 +1,25 @@
 package alist
 
-import "net/http"
+import (
+	"context"
+	"net/http"
+)
 
 // FetchInfo 请求 alist 资源需要的参数信息
 type FetchInfo struct {
-	Path                  string      // alist 资源绝对路径
-	UseTranscode          bool        // 是否请求转码资源 (只支持视频资源)
-	Format                string      // 要请求的转码资源格式, 如: FHD
-	TryRawIfTranscodeFail bool        // 如果请求转码资源失败, 是否尝试请求原画资源
-	Header                http.Header // 自定义的请求头
+	Path                  string          // alist 资源绝对路径
+	UseTranscode          bool            // 是否请求转码资源 (只支持视频资源)
+	Format                string          // 要请求的转码资源格式, 如: FHD
+	TryRawIfTranscodeFail bool            // 如果请求转码资源失败, 是否尝试请求原画资源
+	Header                http.Header     // 自定义的请求头
+	Ctx                   context.Context // 请求上下文, 结束时中断请求, 为空表示不中断
 }
 
 // Resource alist 资源信息封装
 type Resource struct {
 	Url       string         // 资源远程路径
+	Sign      string         // alist 文件签名, 用于拼接 alist 代理链接
+	Size      int64          // 资源大小 (Byte), 只有原画资源有值
 	Subtitles []SubtitleInfo // 字幕信息
 }
 
@@ -1,15 +1,19 @@
 package emby
 
 import (
+	"context"
 	"errors"
 	"io"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/config"
 	"github.com/AmbitiousJun/go-emby2alist/internal/model"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/notify"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
 
 	"github.com/gin-gonic/gin"
@@ -20,7 +24,7 @@ import (
 //
 // 如果请求是失败的响应, 会直接返回客户端, 并在第二个参数中返回 false
 func proxyAndSetRespHeader(c *gin.Context) (model.HttpRes[*jsons.Item], bool) {
-	res, respHeader := RawFetch(c.Request.URL.String(), c.Request.Method, nil, c.Request.Body)
+	res, respHeader := RawFetchCtx(c.Request.Context(), c.Request.URL.String(), c.Request.Method, nil, c.Request.Body)
 	if res.Code != http.StatusOK {
 		checkErr(c, errors.New(res.Msg))
 		return res, false
@@ -58,6 +62,11 @@ func Fetch(uri, method string, header http.Header, body map[string]interface{})
 //
 // 如果 uri 中不包含 token, 自动从配置中取 token 进行拼接
 func RawFetch(uri, method string, header http.Header, body io.ReadCloser) (model.HttpRes[*jsons.Item], http.Header) {
+	return RawFetchCtx(context.Background(), uri, method, header, body)
+}
+
+// RawFetchCtx 与 RawFetch 相同, ctx 结束时中断请求
+func RawFetchCtx(ctx context.Context, uri, method string, header http.Header, body io.ReadCloser) (model.HttpRes[*jsons.Item], http.Header) {
 	host := config.C.Emby.Host
 	token := config.C.Emby.ApiKey
 
@@ -75,11 +84,18 @@ func RawFetch(uri, method string, header http.Header, body io.ReadCloser) (model
 		header.Set("Content-Type", "application/json;charset=utf-8")
 	}
 
-	resp, err := https.Request(method, u, header, body)
+	start := time.Now()
+	resp, err := https.RequestCtx(ctx, method, u, header, body)
+	metrics.ObserveLatency(metrics.UpstreamEmby, time.Since(start))
+	if err != nil && ctx.Err() != nil {
+		return model.HttpRes[*jsons.Item]{Code: http.StatusBadRequest, Msg: "请求已取消: " + err.Error()}, nil
+	}
 	if err != nil {
+		notify.Failure(notify.KindEmby, err.Error())
 		return model.HttpRes[*jsons.Item]{Code: http.StatusBadRequest, Msg: "请求发送失败: " + err.Error()}, nil
 	}
 	defer resp.Body.Close()
+	notify.Success(notify.KindEmby)
 
 	// 3 读取响应
 	bodyBytes, err := io.ReadAll(resp.Body)
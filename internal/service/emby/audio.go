@@ -0,0 +1,90 @@
+package emby
+
+import (
+	"fmt"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// audioUniversalRegex 匹配音频 universal 接口
+var audioUniversalRegex = regexp.MustCompile(`(?i)^/.*audio/\d+/universal`)
+
+// isAudioSource 判断 MediaSource 是否为音频资源 (有媒体流, 但不包含视频流)
+func isAudioSource(source *jsons.Item) bool {
+	if source == nil || source.Type() != jsons.JsonTypeObj {
+		return false
+	}
+	streams, ok := source.Attr("MediaStreams").Done()
+	if !ok || streams.Type() != jsons.JsonTypeArr || streams.Empty() {
+		return false
+	}
+	_, hasVideo := source.QueryOne(videoStreamQuery)
+	return !hasVideo
+}
+
+// keepAudioTranscoding 判断音频资源是否需要保留 emby 的转码配置
+//
+// emby 判定客户端无法直接播放, 并且给出了转码地址时, 保留转码配置交由 emby 处理
+func keepAudioTranscoding(source *jsons.Item) bool {
+	if !isAudioSource(source) {
+		return false
+	}
+	dp, _ := source.Attr("SupportsDirectPlay").Bool()
+	tu, _ := source.Attr("TranscodingUrl").String()
+	return !dp && strs.AllNotEmpty(tu)
+}
+
+// directStreamUrl 生成 MediaSource 的直链播放地址, 音频资源使用 audio 接口
+//
+// 多分段资源的每个 MediaSource 属于不同的 item, 优先使用 MediaSource 自身的 ItemId
+func directStreamUrl(source *jsons.Item, itemId, apiKey string) string {
+	if id, ok := source.Attr("ItemId").String(); ok && strs.AllNotEmpty(id) {
+		itemId = id
+	}
+	if !isAudioSource(source) {
+		return fmt.Sprintf(
+			"/videos/%s/stream?MediaSourceId=%s&%s=%s&Static=true",
+			itemId, url.QueryEscape(fmt.Sprint(source.Attr("Id").Val())), QueryApiKeyName, url.QueryEscape(apiKey),
+		)
+	}
+
+	stream := "stream"
+	if container, ok := source.Attr("Container").String(); ok && strs.AllNotEmpty(container) {
+		stream += "." + container
+	}
+	return fmt.Sprintf(
+		"/audio/%s/%s?MediaSourceId=%s&%s=%s&Static=true",
+		itemId, stream, url.QueryEscape(fmt.Sprint(source.Attr("Id").Val())), QueryApiKeyName, url.QueryEscape(apiKey),
+	)
+}
+
+// audioUniversalPlayable 判断客户端请求的音频 universal 接口能否使用直链播放
+//
+// 客户端在 Container 参数中声明自身支持的容器, 如: opus,mp3|mp3,flac,webma,
+// 资源的容器不在其中时, 需要交由 emby 转码
+func audioUniversalPlayable(c *gin.Context, embyPath string) bool {
+	if !audioUniversalRegex.MatchString(c.Request.URL.Path) {
+		return true
+	}
+	containers := c.Query("Container")
+	if strs.AnyEmpty(containers) {
+		return true
+	}
+
+	ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(embyPath), "."))
+	for _, container := range strings.Split(containers, ",") {
+		// 容器后可能携带编码信息, 如: mp3|mp3
+		container, _, _ = strings.Cut(container, "|")
+		if strings.EqualFold(strings.TrimSpace(container), ext) {
+			return true
+		}
+	}
+	return false
+}
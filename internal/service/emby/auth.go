@@ -14,6 +14,7 @@ import (
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
 
 	"github.com/gin-gonic/gin"
 )
@@ -56,12 +57,16 @@ func ApiKeyChecker() gin.HandlerFunc {
 		regexp.MustCompile(constant.Reg_ResourceStream),
 		regexp.MustCompile(constant.Reg_PlaybackInfo),
 		regexp.MustCompile(constant.Reg_ItemDownload),
+		regexp.MustCompile(constant.Reg_Trickplay),
+		regexp.MustCompile(constant.Reg_PhotoOriginal),
 		regexp.MustCompile(constant.Reg_VideoSubtitles),
 		regexp.MustCompile(constant.Reg_ProxyPlaylist),
 		regexp.MustCompile(constant.Reg_ProxyTs),
 		regexp.MustCompile(constant.Reg_ProxySubtitle),
 		regexp.MustCompile(constant.Reg_ShowEpisodes),
 		regexp.MustCompile(constant.Reg_UserItems),
+		regexp.MustCompile(constant.Reg_PlayHandoff),
+		regexp.MustCompile(constant.Reg_Probe),
 	}
 
 	return func(c *gin.Context) {
@@ -110,8 +115,7 @@ func ApiKeyChecker() gin.HandlerFunc {
 
 		// 5 判断是否被源服务器拒绝
 		if resp.StatusCode == http.StatusUnauthorized && respBody == UnauthorizedResp {
-			c.String(http.StatusUnauthorized, "鉴权失败")
-			c.Abort()
+			apierr.Respond(c, http.StatusUnauthorized, apierr.Unauthorized, "鉴权失败")
 			return
 		}
 
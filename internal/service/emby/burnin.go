@@ -0,0 +1,36 @@
+package emby
+
+import (
+	"log"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+
+	"github.com/gin-gonic/gin"
+)
+
+// keepSubtitleBurnIn 判断 PlaybackInfo 是否需要原样代理到源服务器, 由 emby 烧录特效字幕
+//
+// 客户端匹配 emby.subtitle-burn-in 配置, 并且任意一个资源带有需要烧录的字幕时返回 true
+func keepSubtitleBurnIn(c *gin.Context, mediaSources *jsons.Item) bool {
+	cfg := config.C.Emby.SubtitleBurnIn
+	client := requestClient(c)
+	if !cfg.Match(client) {
+		return false
+	}
+
+	var sources []MediaSource
+	if mediaSources.To(&sources) != nil {
+		return false
+	}
+	for _, source := range sources {
+		for _, stream := range source.MediaStreams {
+			if stream.Type == "Subtitle" && cfg.CodecValid(stream.Codec) {
+				log.Printf(colors.ToBlue("客户端 [%s] 无法渲染 %s 字幕, 保留 emby 的烧录字幕转码配置"), client, stream.Codec)
+				return true
+			}
+		}
+	}
+	return false
+}
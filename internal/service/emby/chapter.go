@@ -0,0 +1,54 @@
+package emby
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// ChapterImageCacheSpace 章节图片的缓存空间 key
+	ChapterImageCacheSpace = "ChapterImage"
+
+	// ChapterImageCacheExpired 章节图片的缓存时间
+	ChapterImageCacheExpired = time.Hour * 24 * 30
+)
+
+// chapterImageRegex 用于匹配出章节图片请求中的 itemId 和章节序号
+var chapterImageRegex = regexp.MustCompile(`(?i)/items/([^/]+)/images/chapter/(\d+)`)
+
+// HandleChapterImages 处理章节图片请求
+//
+// 章节图片按照 item + 章节序号缓存到独立的缓存空间中,
+// 不同客户端请求不同尺寸的同一章节图片时, 复用同一份缓存
+func HandleChapterImages(c *gin.Context) {
+	matches := chapterImageRegex.FindStringSubmatch(c.Request.URL.Path)
+	if len(matches) < 3 {
+		HandleImages(c)
+		return
+	}
+	spaceKey := fmt.Sprintf("%s_%s", matches[1], matches[2])
+
+	// 1 优先从缓存空间中获取
+	if spaceCache, ok := cache.GetSpaceCache(ChapterImageCacheSpace, spaceKey); ok {
+		logs.Debugf(colors.ToBlue("复用缓存空间中的章节图片, key: %s"), spaceKey)
+		c.Header(cache.HeaderKeyExpired, "-1")
+		c.Status(spaceCache.Code())
+		https.CloneHeader(c, spaceCache.Headers())
+		c.Writer.Write(spaceCache.BodyBytes())
+		return
+	}
+
+	// 2 请求源服务器, 并将结果缓存到指定的缓存空间下
+	c.Header(cache.HeaderKeyExpired, cache.Duration(ChapterImageCacheExpired))
+	c.Header(cache.HeaderKeySpace, ChapterImageCacheSpace)
+	c.Header(cache.HeaderKeySpaceKey, spaceKey)
+	HandleImages(c)
+}
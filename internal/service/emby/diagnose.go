@@ -0,0 +1,185 @@
+package emby
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/path"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+)
+
+// DiagnoseStep 诊断过程中某一步骤的执行结果
+type DiagnoseStep struct {
+	Name   string      // 步骤名称
+	Ok     bool        // 是否成功
+	Cost   int64       // 耗时 (毫秒)
+	Detail interface{} `json:",omitempty"` // 步骤的输出信息
+	Error  string      `json:",omitempty"` // 失败原因
+}
+
+// Diagnosis item 的直链解析诊断结果
+type Diagnosis struct {
+	ItemId        string         // item id
+	MediaSourceId string         // 诊断的 MediaSource id
+	Ok            bool           // 所有步骤是否都成功
+	Steps         []DiagnoseStep // 各个步骤的执行结果
+}
+
+// DiagnoseItem 对指定 item 完整执行一次直链解析流程, 返回每一步的执行结果
+//
+// 包括: 请求 PlaybackInfo, 路径映射, 请求 alist 资源, 检查本地文件, 获取转码资源,
+// 任意一步失败时不会中断, 便于一次性定位所有问题
+//
+// mediaSourceId 为空时诊断第一个 MediaSource
+func DiagnoseItem(itemId, mediaSourceId string) Diagnosis {
+	d := Diagnosis{ItemId: itemId, Ok: true}
+	run := func(name string, fn func() (interface{}, error)) bool {
+		start := time.Now()
+		detail, err := fn()
+		step := DiagnoseStep{Name: name, Ok: err == nil, Cost: time.Since(start).Milliseconds(), Detail: detail}
+		if err != nil {
+			step.Error = err.Error()
+			d.Ok = false
+		}
+		d.Steps = append(d.Steps, step)
+		return err == nil
+	}
+
+	// 1 请求 PlaybackInfo
+	var source *jsons.Item
+	ok := run("playback-info", func() (interface{}, error) {
+		uri := fmt.Sprintf("/Items/%s/PlaybackInfo?reqformat=json", itemId)
+		res, _ := RawFetch(uri, http.MethodPost, nil, io.NopCloser(bytes.NewBufferString(PlaybackCommonPayload)))
+		if res.Code != http.StatusOK {
+			return nil, fmt.Errorf("请求 PlaybackInfo 失败: %s", res.Msg)
+		}
+		mediaSources, ok := res.Data.Attr("MediaSources").Done()
+		if !ok || mediaSources.Type() != jsons.JsonTypeArr || mediaSources.Empty() {
+			return nil, fmt.Errorf("获取不到 MediaSources, 原始响应: %v", res.Data)
+		}
+
+		var info PlaybackInfo
+		res.Data.To(&info)
+		summaries := make([]map[string]interface{}, 0, len(info.MediaSources))
+		for _, ms := range info.MediaSources {
+			summaries = append(summaries, map[string]interface{}{
+				"Id": ms.Id, "Name": ms.Name, "Path": ms.Path, "Protocol": ms.Protocol,
+				"Container": ms.Container, "IsRemote": ms.IsRemote, "IsDisc": ms.IsDisc(),
+			})
+		}
+
+		reqId, _ := url.QueryUnescape(mediaSourceId)
+		mediaSources.RangeArr(func(idx int, value *jsons.Item) error {
+			id, _ := value.Attr("Id").String()
+			if idx == 0 || id == reqId {
+				source = value
+			}
+			if id == reqId {
+				return jsons.ErrBreakRange
+			}
+			return nil
+		})
+		return summaries, nil
+	})
+	if !ok {
+		return d
+	}
+	d.MediaSourceId, _ = source.Attr("Id").String()
+	embyPath, _ := source.Attr("Path").String()
+
+	// 2 远程资源 (strm) 直接重定向, 不需要后续步骤
+	if urls.IsRemote(embyPath) {
+		run("strm", func() (interface{}, error) {
+			return map[string]string{"EmbyPath": embyPath, "RedirectTo": mapStrmPath(embyPath)}, nil
+		})
+		return d
+	}
+
+	// 3 路径映射
+	alistPathRes := path.Emby2Alist(embyPath)
+	run("path-map", func() (interface{}, error) {
+		detail := map[string]interface{}{"EmbyPath": embyPath, "AlistPath": alistPathRes.Path}
+		if !alistPathRes.Success {
+			return detail, fmt.Errorf("路径转换失败")
+		}
+		return detail, nil
+	})
+
+	// 4 请求 alist 原画资源, 依次尝试所有可能的路径
+	run("alist-resource", func() (interface{}, error) {
+		attempts := make([]map[string]interface{}, 0)
+		fetch := func(p string) bool {
+			res := alist.FetchResource(alist.FetchInfo{Path: p})
+			attempt := map[string]interface{}{"Path": p, "Code": res.Code}
+			if res.Code == http.StatusOK {
+				attempt["Url"], attempt["Size"] = res.Data.Url, res.Data.Size
+			} else {
+				attempt["Msg"] = res.Msg
+			}
+			attempts = append(attempts, attempt)
+			return res.Code == http.StatusOK
+		}
+
+		if alistPathRes.Success && fetch(alistPathRes.Path) {
+			return attempts, nil
+		}
+		paths, err := alistPathRes.Range()
+		if err != nil {
+			return attempts, err
+		}
+		for _, p := range paths {
+			if fetch(p) {
+				return attempts, nil
+			}
+		}
+		return attempts, fmt.Errorf("所有路径均请求失败")
+	})
+
+	// 5 检查本地文件, 只有解析步骤中配置了 local 时才检查
+	for _, step := range config.C.Resolve.Chain {
+		if step != config.ResolveLocal {
+			continue
+		}
+		run("local", func() (interface{}, error) {
+			localPath := filepath.FromSlash(config.C.Resolve.MapLocal(embyPath))
+			stat, err := os.Stat(localPath)
+			if err != nil {
+				return localPath, err
+			}
+			return map[string]interface{}{"Path": localPath, "Size": stat.Size()}, nil
+		})
+	}
+
+	// 6 获取转码资源
+	cfg := config.C.VideoPreview
+	container, _ := source.Attr("Container").String()
+	if cfg.Enable && cfg.ContainerValid(container) {
+		run("video-preview", func() (interface{}, error) {
+			resChan := make(chan []*jsons.Item, 1)
+			name, _ := source.Attr("Name").String()
+			findVideoPreviewInfos(context.Background(), source, name, config.C.Emby.ApiKey, resChan)
+			previews := <-resChan
+			names := make([]string, 0, len(previews))
+			for _, preview := range previews {
+				n, _ := preview.Attr("Name").String()
+				names = append(names, n)
+			}
+			if len(names) == 0 {
+				return names, fmt.Errorf("获取不到转码资源")
+			}
+			return names, nil
+		})
+	}
+
+	return d
+}
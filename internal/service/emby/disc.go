@@ -0,0 +1,138 @@
+package emby
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/path"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// discStreamDir 蓝光原盘中存放视频流文件的目录
+const discStreamDir = "/BDMV/STREAM"
+
+// IsDisc 判断资源是否为光盘原盘 (ISO/BDMV/DVD)
+func (ms MediaSource) IsDisc() bool {
+	switch strings.ToLower(ms.VideoType) {
+	case "iso", "bluray", "dvd":
+		return true
+	}
+	switch strings.ToLower(ms.Container) {
+	case "iso", "bluray", "dvd":
+		return true
+	}
+	lowerPath := strings.ToLower(ms.Path)
+	return strings.HasSuffix(lowerPath, ".iso") || strings.Contains(lowerPath, "/bdmv")
+}
+
+// isDiscSource 判断 json 格式的 MediaSource 是否为光盘原盘
+func isDiscSource(source *jsons.Item) bool {
+	var ms MediaSource
+	if err := source.To(&ms); err != nil {
+		return false
+	}
+	return ms.IsDisc()
+}
+
+// keepDiscTranscoding 判断原盘资源是否需要保留 emby 的转码配置
+func keepDiscTranscoding(source *jsons.Item) bool {
+	return config.C.Emby.DiscStrategy == config.DiscOrigin && isDiscSource(source)
+}
+
+// handleDiscPlayback 按照 emby.disc-strategy 配置处理原盘资源的播放请求
+//
+// 返回 true 表示请求已经被处理
+func handleDiscPlayback(c *gin.Context, source MediaSource) bool {
+	strategy := config.C.Emby.DiscStrategy
+	if strategy == config.DiscDirect || !source.IsDisc() {
+		return false
+	}
+	logs.Debugf(colors.ToBlue("检测到原盘资源, 播放策略: %s, path: %s"), strategy, source.Path)
+
+	if strategy == config.DiscM2ts {
+		m2tsPath, err := findLargestM2ts(alistCtx(c, c.Request.Context()), source.Path)
+		if err == nil {
+			log.Printf(colors.ToGreen("找到原盘中最大的 m2ts 文件: %s"), m2tsPath)
+			c.Set(ginKeyStreamContainer, "m2ts")
+			resolveDirectLink(c, source.Path, path.AlistPathRes{
+				Success: true,
+				Path:    m2tsPath,
+				Range:   func() ([]string, error) { return nil, nil },
+			}, false)
+			return true
+		}
+		log.Printf(colors.ToYellow("查找原盘 m2ts 文件失败, 回源处理: %v"), err)
+	}
+
+	c.Header(cache.HeaderKeyExpired, "-1")
+	recordDecision(c, metrics.DecisionOrigin, metrics.ReasonPolicy)
+	ProxyOrigin(c)
+	return true
+}
+
+// findLargestM2ts 在 alist 中查找原盘 BDMV/STREAM 目录下体积最大的 m2ts 文件
+//
+// ISO 文件无法查看内部结构, 直接返回错误
+func findLargestM2ts(ctx context.Context, embyPath string) (string, error) {
+	if strings.EqualFold(filepath.Ext(embyPath), ".iso") {
+		return "", errors.New("不支持查找 ISO 文件内部的 m2ts")
+	}
+
+	// 资源路径可能是原盘根目录, 也可能是 BDMV 目录中的某个文件
+	root := embyPath
+	if idx := strings.Index(strings.ToLower(root), "/bdmv"); idx != -1 {
+		root = root[:idx]
+	}
+
+	alistPathRes := path.Emby2Alist(root)
+	candidates := make([]string, 0)
+	if alistPathRes.Success {
+		candidates = append(candidates, alistPathRes.Path)
+	}
+	if paths, err := alistPathRes.Range(); err == nil {
+		candidates = append(candidates, paths...)
+	}
+
+	for _, candidate := range candidates {
+		dir := strings.TrimSuffix(candidate, "/") + discStreamDir
+		res := alist.FetchFsList(ctx, dir, nil)
+		if res.Code != http.StatusOK {
+			continue
+		}
+		content, ok := res.Data.Attr("content").Done()
+		if !ok || content.Type() != jsons.JsonTypeArr {
+			continue
+		}
+
+		var largest string
+		var largestSize int64
+		content.RangeArr(func(_ int, file *jsons.Item) error {
+			name, _ := file.Attr("name").String()
+			size, _ := file.Attr("size").Int64()
+			if isDir, _ := file.Attr("is_dir").Bool(); isDir || !strings.EqualFold(filepath.Ext(name), ".m2ts") {
+				return nil
+			}
+			if size > largestSize {
+				largest, largestSize = dir+"/"+name, size
+			}
+			return nil
+		})
+		if largest != "" {
+			return largest, nil
+		}
+	}
+	return "", fmt.Errorf("alist 中找不到原盘的 m2ts 文件: %s", embyPath)
+}
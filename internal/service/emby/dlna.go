@@ -0,0 +1,101 @@
+package emby
+
+import (
+	"bytes"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// dlnaResultRegex 匹配 ContentDirectory Browse/Search 响应中转义后的 DIDL-Lite 内容
+	dlnaResultRegex = regexp.MustCompile(`(?s)(<Result>)(.*?)(</Result>)`)
+
+	// dlnaResRegex 匹配 DIDL-Lite 中的资源地址
+	dlnaResRegex = regexp.MustCompile(`(?s)(<res[^>]*>)(.*?)(</res>)`)
+
+	// dlnaStreamRegex 判断资源地址是否为媒体串流
+	dlnaStreamRegex = regexp.MustCompile(constant.Reg_ResourceStream)
+)
+
+// ProxyDlna 代理 DLNA 相关接口
+//
+// ContentDirectory 响应中的媒体资源地址指向 emby 源服务器,
+// 将其改写为本程序的地址, 使 DLNA 播放器拉流时同样走直链
+func ProxyDlna(c *gin.Context) {
+	proxyHost, legacy := https.ClientRequestHost(c), IsLegacyClient(c)
+	checkErr(c, https.ProxyRequestWithHook(c, config.C.Emby.Host, true, func(resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "xml") {
+			return nil
+		}
+
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return err
+		}
+
+		cnt := 0
+		newBody := dlnaResultRegex.ReplaceAllStringFunc(string(bodyBytes), func(result string) string {
+			sm := dlnaResultRegex.FindStringSubmatch(result)
+			didl, n := rewriteDidlResources(html.UnescapeString(sm[2]), proxyHost, config.C.Emby.ApiKey, legacy)
+			cnt += n
+			return sm[1] + html.EscapeString(didl) + sm[3]
+		})
+		if cnt > 0 {
+			logs.Debugf(colors.ToBlue("DLNA 资源地址已改写为本地代理地址, 个数: %d"), cnt)
+		}
+
+		resp.Body = io.NopCloser(bytes.NewReader([]byte(newBody)))
+		resp.ContentLength = int64(len(newBody))
+		resp.Header.Set("Content-Length", strconv.Itoa(len(newBody)))
+		resp.Header.Del("Content-Encoding")
+		return nil
+	}))
+}
+
+// rewriteDidlResources 将 DIDL-Lite 中的媒体串流地址改写为本程序的地址
+//
+// DLNA 播放器不会携带 emby 的鉴权信息, 缺失 api_key 时自动补充; shorten 为 true 时改写为短链接,
+// 返回改写后的 DIDL-Lite 以及改写的资源个数
+func rewriteDidlResources(didl, proxyHost, apiKey string, shorten bool) (string, int) {
+	host, err := url.Parse(proxyHost)
+	if err != nil {
+		return didl, 0
+	}
+
+	cnt := 0
+	res := dlnaResRegex.ReplaceAllStringFunc(didl, func(res string) string {
+		sm := dlnaResRegex.FindStringSubmatch(res)
+		u, err := url.Parse(strings.TrimSpace(html.UnescapeString(sm[2])))
+		if err != nil || !u.IsAbs() || !dlnaStreamRegex.MatchString(u.Path) {
+			return res
+		}
+
+		u.Scheme, u.Host = host.Scheme, host.Host
+		q := u.Query()
+		if q.Get(QueryApiKeyName) == "" && q.Get(QueryTokenName) == "" && apiKey != "" {
+			q.Set(QueryApiKeyName, apiKey)
+			u.RawQuery = q.Encode()
+		}
+		newUrl := u.String()
+		if shorten {
+			newUrl = ShortenUrl(newUrl)
+		}
+		cnt++
+		return sm[1] + html.EscapeString(newUrl) + sm[3]
+	})
+	return res, cnt
+}
@@ -0,0 +1,93 @@
+package emby
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/path"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dryRunPlaybackInfo PlaybackInfo 演练模式
+//
+// 原样返回源服务器的响应, 同时在后台计算每个 MediaSource 的直链并输出日志,
+// 用于在正式启用之前验证路径映射是否正确
+func dryRunPlaybackInfo(c *gin.Context, itemInfo ItemInfo) {
+	c.Header(cache.HeaderKeyExpired, "-1")
+
+	// 后台计算时请求已经结束, 需要使用独立的上下文
+	dc := c.Copy()
+	dc.Request = c.Request.Clone(context.Background())
+
+	err := https.ProxyRequestWithHook(c, config.C.Emby.Host, true, func(resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+			return nil
+		}
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		if err != nil {
+			return err
+		}
+		go logDryRun(dc, itemInfo, string(bodyBytes))
+		return nil
+	})
+	if err != nil && !c.Writer.Written() {
+		checkErr(c, err)
+	}
+}
+
+// logDryRun 计算 PlaybackInfo 响应中每个 MediaSource 的处理结果, 并输出日志
+func logDryRun(c *gin.Context, itemInfo ItemInfo, body string) {
+	resJson, err := jsons.New(body)
+	if err != nil {
+		log.Printf(colors.ToRed("[dry-run] 解析 PlaybackInfo 响应失败, itemId: %s, err: %v"), itemInfo.Id, err)
+		return
+	}
+	mediaSources, ok := resJson.Attr("MediaSources").Done()
+	if !ok || mediaSources.Type() != jsons.JsonTypeArr || mediaSources.Empty() {
+		log.Printf(colors.ToYellow("[dry-run] itemId: %s, 没有找到可播放的资源"), itemInfo.Id)
+		return
+	}
+
+	mediaSources.RangeArr(func(idx int, source *jsons.Item) error {
+		name, _ := source.Attr("Name").String()
+		embyPath, _ := source.Attr("Path").String()
+
+		if iis, _ := source.Attr("IsInfiniteStream").Bool(); iis {
+			log.Printf(colors.ToYellow("[dry-run] itemId: %s, 资源 [%d] %s: 直播流, 将代理到源服务器"), itemInfo.Id, idx, name)
+			return nil
+		}
+		if keepAudioTranscoding(source) || keepDiscTranscoding(source) {
+			log.Printf(colors.ToYellow("[dry-run] itemId: %s, 资源 [%d] %s: 保留 emby 的转码配置, 不做改写"), itemInfo.Id, idx, name)
+			return nil
+		}
+
+		newUrl := directStreamUrl(source, itemInfo.Id, itemInfo.ApiKey)
+		if ir, _ := source.Attr("IsRemote").Bool(); ir {
+			log.Printf(colors.ToGreen("[dry-run] itemId: %s, 资源 [%d] %s: DirectStreamUrl 将改写为: %s, 远程地址映射: %s => %s"), itemInfo.Id, idx, name, newUrl, embyPath, mapStrmPath(embyPath))
+			return nil
+		}
+
+		alistPathRes := path.Emby2Alist(embyPath)
+		r, err := fetchAlistResource(c, alistPathRes)
+		if err != nil {
+			log.Printf(colors.ToRed("[dry-run] itemId: %s, 资源 [%d] %s: DirectStreamUrl 将改写为: %s, 路径映射失败: %s => %s, err: %v"),
+				itemInfo.Id, idx, name, newUrl, embyPath, alistPathRes.Path, err)
+			return nil
+		}
+		log.Printf(colors.ToGreen("[dry-run] itemId: %s, 资源 [%d] %s: DirectStreamUrl 将改写为: %s, 路径映射: %s => %s, 直链: %s"),
+			itemInfo.Id, idx, name, newUrl, embyPath, r.path, r.res.Url)
+		return nil
+	})
+}
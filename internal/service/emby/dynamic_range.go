@@ -0,0 +1,59 @@
+package emby
+
+import (
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+)
+
+// hdrTransfers HDR 视频使用的传输特性
+var hdrTransfers = map[string]struct{}{
+	"smpte2084": {}, "arib-std-b67": {},
+}
+
+// isHdrSource 根据原始视频流的元数据判断 MediaSource 是否为 HDR (包括杜比视界) 资源
+func isHdrSource(source *jsons.Item) bool {
+	videoStream, ok := source.QueryOne(videoStreamQuery)
+	if !ok {
+		return false
+	}
+
+	if vr, ok := videoStream.Attr("VideoRange").String(); ok && vr != "" && !strings.EqualFold(vr, "SDR") {
+		return true
+	}
+	if ct, ok := videoStream.Attr("ColorTransfer").String(); ok {
+		if _, hdr := hdrTransfers[strings.ToLower(ct)]; hdr {
+			return true
+		}
+	}
+	for _, key := range []string{"ExtendedVideoType", "ExtendedVideoSubType"} {
+		if evt, ok := videoStream.Attr(key).String(); ok {
+			lower := strings.ToLower(evt)
+			if strings.Contains(lower, "hdr") || strings.Contains(lower, "dolby") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// labelSourceRange 为 HDR 原画资源及其转码资源的名称加上动态范围标签
+//
+// origin 是原画资源, target 是需要修改名称的资源, 传入相同对象表示标注原画资源本身
+func labelSourceRange(origin, target *jsons.Item, isTranscode bool) {
+	cfg := config.C.VideoPreview.RangeLabel
+	if !cfg.Enable || !isHdrSource(origin) {
+		return
+	}
+	name, ok := target.Attr("Name").String()
+	if !ok {
+		return
+	}
+
+	label := cfg.Origin
+	if isTranscode {
+		label = cfg.Transcode
+	}
+	target.Put("Name", jsons.NewByVal(cfg.Apply(name, label)))
+}
@@ -2,19 +2,24 @@ package emby
 
 import (
 	"bytes"
+	"context"
 	"io"
 	"log"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
-	"strconv"
 	"strings"
 	"sync"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/notify"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/sentry"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/plugin"
 	"github.com/AmbitiousJun/go-emby2alist/internal/web/webport"
 
 	"github.com/gin-gonic/gin"
@@ -45,23 +50,24 @@ func ProxySocket() func(*gin.Context) {
 			r.URL.Scheme = u.Scheme
 			r.URL.Host = u.Host
 		}
+		proxy.ModifyResponse = wrapSocketResponse
 	}
 
 	return func(c *gin.Context) {
 		once.Do(initFunc)
+		client := socketClient{user: requestUser(c), device: sessionDevice(c)}
+		c.Request = c.Request.WithContext(context.WithValue(c.Request.Context(), socketClientKey{}, client))
 		proxy.ServeHTTP(c.Writer, c.Request)
 	}
 }
 
 // HandleImages 处理图片请求
 //
-// 修改图片质量参数为配置值
+// 图片质量和尺寸参数已经在 ImagesRewriter 中间件中改写, 优先返回预取的首页图片, 否则代理到源服务器
 func HandleImages(c *gin.Context) {
-	q := c.Request.URL.Query()
-	q.Del("quality")
-	q.Del("Quality")
-	q.Set("Quality", strconv.Itoa(config.C.Emby.ImagesQuality))
-	c.Request.URL.RawQuery = q.Encode()
+	if serveHomeImage(c) {
+		return
+	}
 	ProxyOrigin(c)
 }
 
@@ -70,10 +76,31 @@ func ProxyOrigin(c *gin.Context) {
 	if c == nil {
 		return
 	}
+	stripProxyLiveStreamId(c)
 	origin := config.C.Emby.Host
-	if err := https.ProxyRequest(c, origin, true); err != nil {
+	var hook https.ResponseHook
+	if staleEnabled(c) {
+		hook = staleRecordHook(staleKey(c))
+	}
+	recorded := len(https.UpstreamTimings(c))
+	err := https.ProxyRequestWithHook(c, origin, true, plugin.ResponseHook(c, hook))
+	// 只统计反向代理收到响应头时记录的耗时, 响应体 (如串流) 的传输时间取决于客户端, 不计入上游耗时
+	for _, timing := range https.UpstreamTimings(c)[recorded:] {
+		if timing.Name == "origin" {
+			metrics.ObserveLatency(metrics.UpstreamEmby, timing.Duration)
+		}
+	}
+	if err != nil {
 		log.Printf(colors.ToRed("代理异常: %v"), err)
+		metrics.RecordError("代理回源异常: " + err.Error())
+		sentry.CaptureError(c, err)
+		notify.Failure(notify.KindEmby, err.Error())
+		if staleEnabled(c) && !serveStale(c) && !c.Writer.Written() {
+			apierr.Respond(c, http.StatusBadGateway, apierr.UpstreamEmbyDown, "源服务器不可用, 请检查日志")
+		}
+		return
 	}
+	notify.Success(notify.KindEmby)
 }
 
 // TestProxyUri 用于测试的代理,
@@ -0,0 +1,39 @@
+package emby
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// CloseTranscode 代理客户端结束转码或关闭直播流的请求
+//
+// 包括 DELETE /Videos/ActiveEncodings 和 POST /LiveStreams/Close,
+// 请求原样转发到 emby 结束源服务器上的转码进程, 同时清理本地维护的串流会话和 LiveStream
+func CloseTranscode(c *gin.Context) {
+	c.Header(cache.HeaderKeyExpired, "-1")
+	user, device := requestUser(c), sessionDevice(c)
+	if user != "" {
+		removeStreamSession(user, device)
+	}
+	log.Printf(colors.ToBlue("客户端结束转码, 用户: %s, 设备: %s, PlaySessionId: %s"), user, device, c.Query("PlaySessionId"))
+
+	// 本程序生成的 LiveStream 直接关闭, 不转发到源服务器
+	if closeProxyLiveStream(c) {
+		return
+	}
+	if c.Request.Method == http.MethodDelete {
+		cleanLiveStreams(func(_ string, ls liveStream) bool { return ls.User == user && ls.Device == device })
+	}
+
+	if err := https.ProxyRequest(c, config.C.Emby.Host, true); err != nil {
+		log.Printf(colors.ToRed("结束转码请求转发失败: %v"), err)
+		checkErr(c, err)
+	}
+}
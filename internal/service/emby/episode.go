@@ -1,12 +1,13 @@
 package emby
 
 import (
-	"errors"
-	"net/http"
+	"net/url"
+	"strings"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/config"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
 
 	"github.com/gin-gonic/gin"
 )
@@ -14,10 +15,11 @@ import (
 // ResortEpisodes 代理剧集列表请求
 //
 // 如果开启了 emby.episodes-unplay-prior 配置,
-// 则会将未播剧集排在前面位置
+// 则会将未播剧集排在前面位置;
+// 客户端查询 "下一集" 时 (指定了 StartItemId 或 AdjacentTo 参数) 依赖原始顺序, 不进行排序
 func ResortEpisodes(c *gin.Context) {
 	// 1 检查配置是否开启
-	if !config.C.Emby.EpisodesUnplayPrior {
+	if !config.C.Emby.EpisodesUnplayPrior || isNextEpisodeQuery(c.Request.URL.Query()) {
 		checkErr(c, https.ProxyRequest(c, config.C.Emby.Host, true))
 		return
 	}
@@ -28,22 +30,28 @@ func ResortEpisodes(c *gin.Context) {
 	q.Del("StartIndex")
 	c.Request.URL.RawQuery = q.Encode()
 
-	// 3 代理请求
-	res, respHeader := RawFetch(c.Request.URL.String(), c.Request.Method, nil, c.Request.Body)
-	if res.Code != http.StatusOK {
-		checkErr(c, errors.New(res.Msg))
-		return
+	// 3 代理请求, 对响应中的剧集重新排序
+	checkErr(c, https.ProxyRequestWithHook(c, config.C.Emby.Host, true, https.JsonHook(resortUnplayedFirst)))
+}
+
+// isNextEpisodeQuery 判断剧集列表请求是否为客户端查询 "下一集" 的请求
+func isNextEpisodeQuery(q url.Values) bool {
+	for key, values := range q {
+		if len(values) == 0 || strs.AnyEmpty(values[0]) {
+			continue
+		}
+		if strings.EqualFold(key, "StartItemId") || strings.EqualFold(key, "AdjacentTo") {
+			return true
+		}
 	}
-	resJson := res.Data
-	https.CloneHeader(c, respHeader)
-	defer func() {
-		c.JSON(res.Code, resJson.Struct())
-	}()
+	return false
+}
 
-	// 4 处理数据
+// resortUnplayedFirst 将未播的剧集排在前面
+func resortUnplayedFirst(resJson *jsons.Item) error {
 	items, ok := resJson.Attr("Items").Done()
 	if !ok || items.Type() != jsons.JsonTypeArr {
-		return
+		return nil
 	}
 	playedItems, allItems := make([]*jsons.Item, 0), make([]*jsons.Item, 0)
 	items.RangeArr(func(_ int, value *jsons.Item) error {
@@ -66,5 +74,5 @@ func ResortEpisodes(c *gin.Context) {
 	allItems = append(allItems, playedItems...)
 
 	resJson.Put("Items", jsons.NewByVal(allItems))
-	c.Writer.Header().Del("Content-Length")
+	return nil
 }
@@ -0,0 +1,145 @@
+package emby
+
+import (
+	"archive/zip"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// exportItemTypes 导出时包含的媒体类型
+const exportItemTypes = "Movie,Episode,Audio,MusicVideo,Video"
+
+var (
+	// exportPathRegex 从导出接口的路径中解析出父级 id 和导出格式
+	exportPathRegex = regexp.MustCompile(`(?i)/feeds/export/([^/]+)\.(m3u|zip)$`)
+
+	// invalidFileNameRegex 文件名中不允许出现的字符
+	invalidFileNameRegex = regexp.MustCompile(`[\\/:*?"<>|\x00-\x1f]`)
+)
+
+// ExportItems 将媒体库、合集或播放列表导出为 strm 压缩包或 m3u 播放列表
+//
+// 导出的地址均指向订阅源的直链接口, Kodi/VLC 等播放器无需 emby 客户端即可直接播放
+func ExportItems(c *gin.Context) {
+	if !checkFeedToken(c) {
+		return
+	}
+	c.Header(cache.HeaderKeyExpired, "-1")
+
+	matches := exportPathRegex.FindStringSubmatch(c.Request.URL.Path)
+	if len(matches) < 3 {
+		apierr.Respond(c, http.StatusBadRequest, apierr.InvalidRequest, "导出路径错误")
+		return
+	}
+	parentId, format := matches[1], strings.ToLower(matches[2])
+
+	items, err := fetchExportItems(parentId)
+	if err != nil {
+		apierr.Respond(c, http.StatusBadGateway, apierr.UpstreamEmbyDown, err.Error())
+		return
+	}
+	host := https.ClientRequestHost(c)
+	log.Printf(colors.ToGreen("导出媒体, 父级 id: %s, 格式: %s, 个数: %d"), parentId, format, len(items))
+
+	if format == "m3u" {
+		sb := strings.Builder{}
+		sb.WriteString("#EXTM3U\n")
+		for _, item := range items {
+			link, ok := feedLinkUrl(host, item.Id)
+			if !ok {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("#EXTINF:%d,%s\n", item.RunTimeTicks/10_000_000, feedTitle(item)))
+			sb.WriteString(link + "\n")
+		}
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.m3u"`, parentId))
+		c.Data(http.StatusOK, "audio/x-mpegurl; charset=utf-8", []byte(sb.String()))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.zip"`, parentId))
+	c.Header("Content-Type", "application/zip")
+	c.Status(http.StatusOK)
+	zw := zip.NewWriter(c.Writer)
+	defer zw.Close()
+	names := make(map[string]struct{})
+	for _, item := range items {
+		link, ok := feedLinkUrl(host, item.Id)
+		if !ok {
+			continue
+		}
+		name := strmFileName(item, names)
+		w, err := zw.Create(name)
+		if err != nil {
+			log.Printf(colors.ToRed("导出 strm 文件失败: %s, err: %v"), name, err)
+			return
+		}
+		if _, err := w.Write([]byte(link)); err != nil {
+			log.Printf(colors.ToRed("导出 strm 文件失败: %s, err: %v"), name, err)
+			return
+		}
+	}
+}
+
+// fetchExportItems 请求 emby 获取父级 (媒体库、合集、播放列表) 下的所有可播放媒体
+func fetchExportItems(parentId string) ([]feedEmbyItem, error) {
+	q := url.Values{}
+	q.Set("ParentId", parentId)
+	q.Set("Recursive", "true")
+	q.Set("IncludeItemTypes", exportItemTypes)
+	q.Set("Fields", "ProductionYear")
+	q.Set("IsMissing", "false")
+	res, _ := Fetch("/emby/Items?"+q.Encode(), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return nil, fmt.Errorf("请求 emby 媒体列表失败: %s", res.Msg)
+	}
+
+	var body struct{ Items []feedEmbyItem }
+	if err := res.Data.To(&body); err != nil {
+		return nil, fmt.Errorf("解析 emby 响应失败: %v", err)
+	}
+	return body.Items, nil
+}
+
+// strmFileName 生成媒体在压缩包中的 strm 文件路径, 剧集按照剧名和季分目录存放
+//
+// names 记录已经使用的文件路径, 重名时自动追加 item id
+func strmFileName(item feedEmbyItem, names map[string]struct{}) string {
+	name := invalidFileNameRegex.ReplaceAllString(feedTitle(item), "_")
+	if item.Type == "Episode" && strs.AllNotEmpty(item.SeriesName) {
+		series := invalidFileNameRegex.ReplaceAllString(item.SeriesName, "_")
+		name = path.Join(series, fmt.Sprintf("Season %02d", item.ParentIndexNumber), name)
+	}
+
+	fileName := name + ".strm"
+	if _, ok := names[fileName]; ok {
+		// 调用方已经确认 id 可以混淆, 这里不会失败
+		id, _ := externalId(item.Id)
+		fileName = fmt.Sprintf("%s [%s].strm", name, id)
+	}
+	names[fileName] = struct{}{}
+	return fileName
+}
+
+// feedLinkUrl 生成订阅源直链接口的地址, 启用 id 混淆时使用混淆之后的 id, 混淆失败时返回 false
+func feedLinkUrl(host, itemId string) (string, bool) {
+	id, ok := externalId(itemId)
+	if !ok {
+		return "", false
+	}
+	return fmt.Sprintf("%s/feeds/link/%s?%s=%s", host, id, FeedTokenName, url.QueryEscape(config.C.Feed.Token)), true
+}
@@ -0,0 +1,113 @@
+package emby
+
+import (
+	"log"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// demotedSources 设备 + item id + MediaSourceId => 降级的过期时间
+//
+// 客户端上报播放失败时没有携带 MediaSourceId 的, 对 item 的所有原画资源降级
+var demotedSources sync.Map
+
+// recordPlaybackFailure 客户端上报直链资源播放失败时, 在冷却时间内对该设备降级处理这个资源
+func recordPlaybackFailure(c *gin.Context, device string) {
+	cfg := config.C.PlaybackFallback
+	if !cfg.Enable || !playingStoppedRegex.MatchString(c.Request.URL.Path) {
+		return
+	}
+	body, ok := reportBody(c)
+	if !ok {
+		return
+	}
+	if failed, _ := body.Attr("Failed").Bool(); !failed {
+		return
+	}
+	itemId, _ := body.Attr("ItemId").String()
+	if strs.AnyEmpty(itemId) {
+		return
+	}
+	mediaSourceId, _ := body.Attr("MediaSourceId").String()
+	if unescaped, err := url.QueryUnescape(mediaSourceId); err == nil {
+		mediaSourceId = unescaped
+	}
+	msInfo, err := resolveMediaSourceId(mediaSourceId)
+	if err != nil || msInfo.Transcode {
+		// 转码资源不经过网盘直链, 不需要降级
+		return
+	}
+
+	demotedSources.Store(demotedSourceKey(device, itemId, msInfo.OriginId), time.Now().Add(cfg.CooldownDuration()))
+	log.Printf(colors.ToYellow("设备 [%s] 上报直链播放失败, item: %s, MediaSourceId: %s, %v 内降级处理"), device, itemId, msInfo.OriginId, cfg.CooldownDuration())
+}
+
+// isSourceDemoted 判断当前设备播放指定资源时是否需要降级处理
+func isSourceDemoted(c *gin.Context, itemId, sourceId string) bool {
+	if !config.C.PlaybackFallback.Enable {
+		return false
+	}
+	device := sessionDevice(c)
+	for _, id := range []string{sourceId, ""} {
+		key := demotedSourceKey(device, itemId, id)
+		expired, ok := demotedSources.Load(key)
+		if !ok {
+			continue
+		}
+		if time.Now().Before(expired.(time.Time)) {
+			return true
+		}
+		demotedSources.CompareAndDelete(key, expired)
+	}
+	return false
+}
+
+// applySourceFallback 当前设备的原画资源被降级时, 将第一个转码资源移至 MediaSources 的最前面, 作为默认资源
+func applySourceFallback(c *gin.Context, itemInfo ItemInfo, resJson *jsons.Item) {
+	if !config.C.PlaybackFallback.Enable || !itemInfo.MsInfo.Empty {
+		return
+	}
+	mediaSources, ok := resJson.Attr("MediaSources").Done()
+	if !ok || mediaSources.Type() != jsons.JsonTypeArr {
+		return
+	}
+
+	demoted := false
+	previewIdx := -1
+	mediaSources.RangeArr(func(index int, source *jsons.Item) error {
+		id, _ := source.Attr("Id").String()
+		msInfo, err := resolveMediaSourceId(id)
+		if err != nil {
+			return nil
+		}
+		if msInfo.Transcode {
+			if previewIdx == -1 {
+				previewIdx = index
+			}
+			return nil
+		}
+		if index == 0 && isSourceDemoted(c, itemInfo.Id, msInfo.OriginId) {
+			demoted = true
+		}
+		return nil
+	})
+	if !demoted || previewIdx <= 0 {
+		return
+	}
+	moveSourceToFront(resJson, mediaSources, previewIdx)
+	logs.Debugf(colors.ToBlue("item [%s] 的原画资源在当前设备上已降级, 默认使用转码资源"), itemInfo.Id)
+}
+
+// demotedSourceKey 计算降级资源的 key
+func demotedSourceKey(device, itemId, sourceId string) string {
+	return device + "\n" + itemId + "\n" + sourceId
+}
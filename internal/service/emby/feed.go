@@ -0,0 +1,288 @@
+package emby
+
+import (
+	"crypto/subtle"
+	"encoding/xml"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// FeedTokenName query 参数中的订阅源密钥
+const FeedTokenName = "token"
+
+// feedIdRegex 从订阅源直链和海报接口的路径中解析出 item id
+var feedIdRegex = regexp.MustCompile(`(?i)^/feeds/(link|poster)/([^/?]+)`)
+
+// feedEmbyItem 订阅源需要的 emby item 属性
+type feedEmbyItem struct {
+	Id                string
+	Name              string
+	Type              string
+	SeriesId          string
+	SeriesName        string
+	ParentIndexNumber int
+	IndexNumber       int
+	ProductionYear    int
+	Overview          string
+	DateCreated       string
+	RunTimeTicks      int64
+	ImageTags         map[string]string
+}
+
+// FeedItem 订阅源中的一个媒体
+type FeedItem struct {
+	Id       string `json:"id"`
+	Title    string `json:"title"`
+	Type     string `json:"type"`
+	Overview string `json:"overview,omitempty"`
+	Added    string `json:"added"`
+	Poster   string `json:"poster"`
+	Link     string `json:"link"`
+}
+
+// rssFeed rss 2.0 订阅源
+type rssFeed struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+type rssChannel struct {
+	Title       string    `xml:"title"`
+	Link        string    `xml:"link"`
+	Description string    `xml:"description"`
+	Items       []rssItem `xml:"item"`
+}
+
+type rssItem struct {
+	Title       string       `xml:"title"`
+	Link        string       `xml:"link"`
+	Guid        string       `xml:"guid"`
+	PubDate     string       `xml:"pubDate,omitempty"`
+	Description string       `xml:"description,omitempty"`
+	Enclosure   rssEnclosure `xml:"enclosure"`
+}
+
+type rssEnclosure struct {
+	Url    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length int    `xml:"length,attr"`
+}
+
+// checkFeedToken 校验订阅源是否启用以及请求中的密钥是否正确
+//
+// 校验不通过时直接响应客户端, 返回 false
+func checkFeedToken(c *gin.Context) bool {
+	cfg := config.C.Feed
+	if !cfg.Enable {
+		apierr.Respond(c, http.StatusNotFound, apierr.NotFound, "订阅源未启用")
+		return false
+	}
+	token := c.Query(FeedTokenName)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(cfg.Token)) != 1 {
+		apierr.Respond(c, http.StatusForbidden, apierr.Unauthorized, "订阅源鉴权失败")
+		return false
+	}
+	return true
+}
+
+// RecentFeed 最近添加的媒体订阅源, 根据请求后缀返回 json 或 rss 格式
+func RecentFeed(c *gin.Context) {
+	if !checkFeedToken(c) {
+		return
+	}
+	c.Header(cache.HeaderKeyExpired, "-1")
+
+	items, err := fetchRecentFeedItems(https.ClientRequestHost(c))
+	if err != nil {
+		apierr.Respond(c, http.StatusBadGateway, apierr.UpstreamEmbyDown, err.Error())
+		return
+	}
+
+	if !strings.HasSuffix(strings.ToLower(c.Request.URL.Path), ".rss") {
+		c.JSON(http.StatusOK, items)
+		return
+	}
+
+	channel := rssChannel{
+		Title:       "Emby 最近添加",
+		Link:        https.ClientRequestHost(c),
+		Description: "最近添加到媒体库的媒体",
+	}
+	for _, item := range items {
+		ri := rssItem{
+			Title:       item.Title,
+			Link:        item.Link,
+			Guid:        item.Id,
+			Description: item.Overview,
+			Enclosure:   rssEnclosure{Url: item.Poster, Type: "image/jpeg"},
+		}
+		if t, err := time.Parse(time.RFC3339Nano, item.Added); err == nil {
+			ri.PubDate = t.Format(time.RFC1123Z)
+		}
+		channel.Items = append(channel.Items, ri)
+	}
+	c.XML(http.StatusOK, rssFeed{Version: "2.0", Channel: channel})
+}
+
+// FeedLink 订阅源中的直链地址, 校验订阅源密钥后重定向到网盘直链
+//
+// 使用配置中的 api_key 请求 emby, 外部程序无需 emby 的鉴权信息
+func FeedLink(c *gin.Context) {
+	if !checkFeedToken(c) {
+		return
+	}
+	if !restoreFeedId(c) {
+		return
+	}
+	DownloadItem(c)
+}
+
+// FeedPoster 启用 id 混淆时订阅源中的海报地址, 校验订阅源密钥后代理到源服务器的海报接口
+func FeedPoster(c *gin.Context) {
+	if !checkFeedToken(c) {
+		return
+	}
+	if config.C.Feed.Obfuscation.IdCodec() == nil {
+		apierr.Respond(c, http.StatusNotFound, apierr.NotFound, "id 混淆未启用")
+		return
+	}
+	if !restoreFeedId(c) {
+		return
+	}
+	id := feedIdRegex.FindStringSubmatch(c.Request.URL.Path)[2]
+	c.Request.URL.Path = fmt.Sprintf("/emby/Items/%s/Images/Primary", id)
+	c.Request.URL.RawQuery = ""
+	c.Request.RequestURI = c.Request.URL.RequestURI()
+	ProxyOrigin(c)
+}
+
+// externalId 混淆对外分享的链接中的 item id, 未启用混淆时原样返回
+//
+// 混淆失败时返回 false, 调用方需要丢弃该 item, 不能退回使用原始 id: 既会泄露原始 id, 链接也无法被还原
+func externalId(id string) (string, bool) {
+	codec := config.C.Feed.Obfuscation.IdCodec()
+	if codec == nil {
+		return id, true
+	}
+	encoded, err := codec.Encode(id)
+	if err != nil {
+		log.Printf(colors.ToRed("混淆 item id 失败, 不对外提供该 item: %s, err: %v"), id, err)
+		return "", false
+	}
+	return encoded, true
+}
+
+// restoreFeedId 将请求路径中混淆之后的 item id 还原为原始 id, 未启用混淆时不做处理
+//
+// 启用混淆后不再接受原始 id, 还原失败时直接响应客户端, 返回 false
+func restoreFeedId(c *gin.Context) bool {
+	codec := config.C.Feed.Obfuscation.IdCodec()
+	if codec == nil {
+		return true
+	}
+	matches := feedIdRegex.FindStringSubmatch(c.Request.URL.Path)
+	if len(matches) < 3 {
+		apierr.Respond(c, http.StatusBadRequest, apierr.InvalidRequest, "链接格式错误")
+		return false
+	}
+	id, err := codec.Decode(matches[2])
+	if err != nil {
+		apierr.Respond(c, http.StatusNotFound, apierr.NotFound, "链接无效或已失效")
+		return false
+	}
+	c.Request.URL.Path = fmt.Sprintf("/feeds/%s/%s", matches[1], id)
+	c.Request.RequestURI = c.Request.URL.RequestURI()
+	return true
+}
+
+// fetchRecentFeedItems 请求 emby 获取最近添加的媒体, 转换为订阅源格式
+func fetchRecentFeedItems(host string) ([]FeedItem, error) {
+	cfg := config.C.Feed
+	q := url.Values{}
+	q.Set("Recursive", "true")
+	q.Set("SortBy", "DateCreated")
+	q.Set("SortOrder", "Descending")
+	q.Set("IncludeItemTypes", cfg.ItemTypes)
+	q.Set("Limit", fmt.Sprintf("%d", cfg.Limit))
+	q.Set("Fields", "DateCreated,Overview,ProductionYear")
+	q.Set("IsMissing", "false")
+	res, _ := Fetch("/emby/Items?"+q.Encode(), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return nil, fmt.Errorf("请求 emby 最近添加的媒体失败: %s", res.Msg)
+	}
+
+	var body struct{ Items []feedEmbyItem }
+	if err := res.Data.To(&body); err != nil {
+		return nil, fmt.Errorf("解析 emby 响应失败: %v", err)
+	}
+
+	items := make([]FeedItem, 0, len(body.Items))
+	for _, ei := range body.Items {
+		id, ok := externalId(ei.Id)
+		if !ok {
+			continue
+		}
+		poster, ok := feedPoster(host, ei)
+		if !ok {
+			continue
+		}
+		link, ok := feedLinkUrl(host, ei.Id)
+		if !ok {
+			continue
+		}
+		items = append(items, FeedItem{
+			Id:       id,
+			Title:    feedTitle(ei),
+			Type:     ei.Type,
+			Overview: ei.Overview,
+			Added:    ei.DateCreated,
+			Poster:   poster,
+			Link:     link,
+		})
+	}
+	return items, nil
+}
+
+// feedTitle 生成订阅源中媒体的标题, 剧集带上剧名和集数
+func feedTitle(ei feedEmbyItem) string {
+	if ei.Type == "Episode" && strs.AllNotEmpty(ei.SeriesName) {
+		return fmt.Sprintf("%s S%02dE%02d %s", ei.SeriesName, ei.ParentIndexNumber, ei.IndexNumber, ei.Name)
+	}
+	if ei.ProductionYear > 0 {
+		return fmt.Sprintf("%s (%d)", ei.Name, ei.ProductionYear)
+	}
+	return ei.Name
+}
+
+// feedPoster 生成订阅源中媒体的海报地址, 剧集没有封面时使用剧的海报
+//
+// 启用 id 混淆时使用订阅源的海报接口, 不暴露原始 id, 与直链地址一样携带订阅源密钥; 混淆失败时返回 false
+func feedPoster(host string, ei feedEmbyItem) (string, bool) {
+	id := ei.Id
+	if _, ok := ei.ImageTags["Primary"]; !ok && strs.AllNotEmpty(ei.SeriesId) {
+		id = ei.SeriesId
+	}
+	if config.C.Feed.Obfuscation.IdCodec() != nil {
+		extId, ok := externalId(id)
+		if !ok {
+			return "", false
+		}
+		return fmt.Sprintf("%s/feeds/poster/%s?%s=%s", host, extId, FeedTokenName, url.QueryEscape(config.C.Feed.Token)), true
+	}
+	return fmt.Sprintf("%s/emby/Items/%s/Images/Primary", host, id), true
+}
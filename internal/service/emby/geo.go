@@ -0,0 +1,49 @@
+package emby
+
+import (
+	"slices"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/geoip"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// geoChain 根据客户端 ip 匹配的地区规则调整直链解析步骤
+//
+// proxy 将网盘直链替换为 alist 本地代理链接, cdn 将 alist 的两个步骤替换为 CDN 链接,
+// 未启用 geo 或匹配不到规则时, 原样返回 chain
+func geoChain(c *gin.Context, chain []config.ResolveStep) ([]config.ResolveStep, *config.GeoRule) {
+	rule, record := geoip.Rule(c.ClientIP())
+	if rule == nil || rule.Action == config.GeoRedirect {
+		return chain, rule
+	}
+	logs.Debugf(colors.ToBlue("客户端 ip: %s, 地区: %s, ASN: %s, 链接选择方式: %s"), c.ClientIP(), record.Country, record.Asn, rule.Action)
+
+	switch rule.Action {
+	case config.GeoProxy:
+		return replaceSteps(chain, config.ResolveAlistProxy, config.ResolveAlistRaw), rule
+	case config.GeoCdn:
+		return replaceSteps(chain, config.ResolveCdn, config.ResolveAlistRaw, config.ResolveAlistProxy), rule
+	}
+	return chain, rule
+}
+
+// replaceSteps 将 chain 中属于 from 的步骤替换为 to, 替换后重复的步骤只保留第一个
+func replaceSteps(chain []config.ResolveStep, to config.ResolveStep, from ...config.ResolveStep) []config.ResolveStep {
+	replaced := make([]config.ResolveStep, 0, len(chain))
+	seen := make(map[config.ResolveStep]struct{})
+	for _, step := range chain {
+		if slices.Contains(from, step) {
+			step = to
+		}
+		if _, ok := seen[step]; ok {
+			continue
+		}
+		seen[step] = struct{}{}
+		replaced = append(replaced, step)
+	}
+	return replaced
+}
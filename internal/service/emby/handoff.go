@@ -0,0 +1,97 @@
+package emby
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// handoffSchemes 外部播放器的自定义协议模板
+//
+// ${url} 替换为原始地址, ${encodedUrl} 替换为 url 编码之后的地址
+var handoffSchemes = map[string]string{
+	"mpv":       "mpv://${url}",
+	"iina":      "iina://weblink?url=${encodedUrl}",
+	"potplayer": "potplayer://${url}",
+	"vlc":       "vlc://${url}",
+	"infuse":    "infuse://x-callback-url/play?url=${encodedUrl}",
+}
+
+// HandoffResult 外部播放器唤起接口的响应
+type HandoffResult struct {
+	Url    string `json:"url"`    // 播放地址
+	Direct bool   `json:"direct"` // 是否为解析完成的网盘直链, 为 false 时是本程序的串流地址
+}
+
+// PlayHandoff 将资源交由外部播放器播放
+//
+// 未指定 player 参数时, 以 json 格式返回解析出的直链;
+// 指定了 player 参数时, 通过播放器的自定义协议重定向, 唤起本地播放器
+func PlayHandoff(c *gin.Context) {
+	c.Header(cache.HeaderKeyExpired, "-1")
+	c.Header("Cache-Control", "no-store")
+
+	player := strings.ToLower(c.Query("player"))
+	scheme, ok := handoffSchemes[player]
+	if player != "" && !ok {
+		apierr.Respondf(c, http.StatusBadRequest, apierr.InvalidRequest, "不支持的播放器: %s", player)
+		return
+	}
+
+	itemInfo, err := resolveItemInfo(c)
+	if err != nil {
+		apierr.Respond(c, http.StatusBadRequest, apierr.InvalidRequest, err.Error())
+		return
+	}
+	res := resolveHandoffUrl(c, itemInfo)
+
+	if player == "" {
+		c.JSON(http.StatusOK, res)
+		return
+	}
+	target := strings.ReplaceAll(scheme, "${encodedUrl}", url.QueryEscape(res.Url))
+	target = strings.ReplaceAll(target, "${url}", res.Url)
+	log.Printf(colors.ToGreen("唤起外部播放器 [%s], itemId: %s"), player, itemInfo.Id)
+	c.Redirect(http.StatusFound, target)
+}
+
+// resolveHandoffUrl 解析资源的播放地址
+//
+// 优先返回 strm 远程地址或 alist 直链, 解析失败时返回本程序的串流地址, 播放时再进行重定向
+func resolveHandoffUrl(c *gin.Context, itemInfo ItemInfo) HandoffResult {
+	source, err := getEmbyMediaSource(itemInfo)
+	if err != nil {
+		log.Printf(colors.ToYellow("获取 MediaSource 失败, 使用串流地址: %v"), err)
+		return handoffStreamUrl(c, itemInfo, "")
+	}
+
+	if urls.IsRemote(source.Path) {
+		return HandoffResult{Url: mapStrmPath(source.Path), Direct: true}
+	}
+
+	r, err := fetchAlistResource(c, sourceAlistPath(source))
+	if err != nil {
+		log.Printf(colors.ToYellow("解析 alist 直链失败, 使用串流地址: %v"), err)
+		return handoffStreamUrl(c, itemInfo, source.Id)
+	}
+	return HandoffResult{Url: r.res.Url, Direct: true}
+}
+
+// handoffStreamUrl 生成本程序的串流地址
+func handoffStreamUrl(c *gin.Context, itemInfo ItemInfo, mediaSourceId string) HandoffResult {
+	u := fmt.Sprintf("%s/videos/%s/stream?Static=true&%s=%s", https.ClientRequestHost(c), itemInfo.Id, QueryApiKeyName, url.QueryEscape(itemInfo.ApiKey))
+	if mediaSourceId != "" {
+		u += "&MediaSourceId=" + url.QueryEscape(mediaSourceId)
+	}
+	return HandoffResult{Url: u}
+}
@@ -0,0 +1,50 @@
+package emby
+
+import (
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/encrypts"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HomeListsCacheSpace 首页继续观看和下一集列表的缓存空间 key
+const HomeListsCacheSpace = "HomeLists"
+
+// ProxyHomeList 代理首页的继续观看 (Items/Resume) 和下一集 (Shows/NextUp) 列表
+//
+// 启用 cache.home-lists 时, 响应按照 "用户/请求摘要" 写入缓存空间, 停止播放时清除该用户的列表缓存
+func ProxyHomeList(c *gin.Context) {
+	if config.C.Cache.Enable && config.C.Cache.HomeLists.Enable {
+		if user := requestUser(c); user != "" {
+			c.Header(cache.HeaderKeySpace, HomeListsCacheSpace)
+			c.Header(cache.HeaderKeySpaceKey, homeListSpaceKey(c, user))
+		}
+	}
+	ProxyOrigin(c)
+}
+
+// homeListSpaceKey 计算列表在缓存空间中的 key, 以用户开头便于按用户清除
+//
+// 不同设备和客户端的请求分开缓存, 避免互相覆盖缓存空间中的引用
+func homeListSpaceKey(c *gin.Context, user string) string {
+	digest := encrypts.Md5Hash(c.Request.URL.RequestURI() + requestToken(c) + requestDeviceId(c) + c.GetHeader("User-Agent"))
+	return user + "/" + digest
+}
+
+// purgeHomeLists 清除用户的首页列表缓存, 使停止播放后的继续观看和下一集列表立即刷新
+func purgeHomeLists(user string) {
+	if !config.C.Cache.Enable || !config.C.Cache.HomeLists.Enable || user == "" {
+		return
+	}
+	prefix := user + "/"
+	count := cache.PurgeSpaceFunc(HomeListsCacheSpace, func(spaceKey string) bool {
+		return strings.HasPrefix(spaceKey, prefix)
+	})
+	if count > 0 {
+		logs.Debugf("用户 [%s] 停止播放, 清除首页列表缓存 %d 个", user, count)
+	}
+}
@@ -0,0 +1,70 @@
+package emby
+
+import (
+	"bytes"
+	"io"
+	"regexp"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/hooks"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+
+	"github.com/gin-gonic/gin"
+)
+
+// playingStartRegex 匹配客户端的开始播放上报接口
+var playingStartRegex = regexp.MustCompile(`(?i)/sessions/playing($|\?)`)
+
+// fireDirectLink 触发下发直链事件
+func fireDirectLink(c *gin.Context, provider, embyPath, link string) {
+	var itemId string
+	if matches := itemIdRegex.FindStringSubmatch(c.Request.URL.Path); len(matches) > 1 {
+		itemId = matches[1]
+	}
+	hooks.Fire(hooks.EventDirectLink, map[string]interface{}{
+		"itemId":   itemId,
+		"user":     requestUser(c),
+		"device":   sessionDevice(c),
+		"provider": provider,
+		"embyPath": embyPath,
+		"url":      link,
+	})
+}
+
+// firePlaybackEvent 客户端上报开始播放或停止播放时, 触发对应的事件
+func firePlaybackEvent(c *gin.Context, user, device string) {
+	event := hooks.EventPlaybackStart
+	switch {
+	case playingStoppedRegex.MatchString(c.Request.URL.Path):
+		event = hooks.EventPlaybackStop
+	case !playingStartRegex.MatchString(c.Request.URL.Path):
+		return
+	}
+
+	data := map[string]interface{}{"user": user, "device": device}
+	if body, ok := reportBody(c); ok {
+		data["itemId"], _ = body.Attr("ItemId").String()
+		data["mediaSourceId"], _ = body.Attr("MediaSourceId").String()
+		data["positionTicks"], _ = body.Attr("PositionTicks").Int64()
+	}
+	hooks.Fire(event, data)
+}
+
+// reportBody 解析播放状态上报请求的请求体
+//
+// 读取请求体之后会重新设置回请求中, 不影响后续代理
+func reportBody(c *gin.Context) (*jsons.Item, bool) {
+	if c.Request.Body == nil {
+		return nil, false
+	}
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	c.Request.Body.Close()
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	if err != nil {
+		return nil, false
+	}
+	body, err := jsons.New(string(bodyBytes))
+	if err != nil {
+		return nil, false
+	}
+	return body, true
+}
@@ -0,0 +1,157 @@
+package emby
+
+import (
+	"net"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/feature"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ImagesRewriter 图片请求改写中间件
+//
+// 按照请求的用户和客户端 (emby.images-rules) 设置图片质量和最大宽度, 没有匹配的规则时使用 emby.images-quality;
+// 需要在缓存中间件之前执行, 使改写后的参数参与缓存 key 的计算, 不同规则的图片分开缓存
+func ImagesRewriter() gin.HandlerFunc {
+	imagesReg := regexp.MustCompile(constant.Reg_Images)
+	// 章节图片和照片原图有单独的处理逻辑, 远程图片不经过源服务器的图片处理
+	excludes := []*regexp.Regexp{
+		regexp.MustCompile(constant.Reg_ChapterImages),
+		regexp.MustCompile(constant.Reg_PhotoOriginal),
+		regexp.MustCompile(constant.Reg_ItemRemoteImages),
+		regexp.MustCompile(constant.Reg_RemoteImage),
+	}
+
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if !imagesReg.MatchString(path) || !feature.Enabled(feature.ImagesQuality) {
+			return
+		}
+		for _, reg := range excludes {
+			if reg.MatchString(path) {
+				return
+			}
+		}
+
+		profile := resolveImagesProfile(c)
+		c.Set(ginKeyImagesProfile, profile)
+
+		q := c.Request.URL.Query()
+		delQueryFold(q, "quality")
+		q.Set("Quality", strconv.Itoa(profile.quality))
+		if profile.maxWidth > 0 {
+			capImageWidth(q, profile.maxWidth)
+		}
+		c.Request.URL.RawQuery = q.Encode()
+		// 路由规则依据 RequestURI 进行匹配, 需要同步更新
+		c.Request.RequestURI = c.Request.URL.RequestURI()
+	}
+}
+
+// ginKeyImagesProfile 图片请求使用的质量和最大宽度, 由 ImagesRewriter 写入请求上下文
+const ginKeyImagesProfile = "ImagesProfile"
+
+// imagesProfile 请求使用的图片质量和最大宽度
+type imagesProfile struct {
+	quality  int // 图片质量
+	maxWidth int // 最大宽度, 0 表示不限制
+}
+
+// resolveImagesProfile 获取请求使用的图片质量和最大宽度
+func resolveImagesProfile(c *gin.Context) imagesProfile {
+	profile := imagesProfile{quality: config.C.Emby.ImagesQuality}
+	if rule := matchImagesRule(c); rule != nil {
+		logs.Debugf(colors.ToBlue("图片请求命中规则 [%s], quality: %d, max-width: %d"), rule.Name, rule.Quality, rule.MaxWidth)
+		if rule.Quality > 0 {
+			profile.quality = rule.Quality
+		}
+		profile.maxWidth = rule.MaxWidth
+	}
+	return profile
+}
+
+// matchImagesRule 获取请求匹配的第一个图片规则, 没有匹配时返回 nil
+func matchImagesRule(c *gin.Context) *config.ImagesRule {
+	rules := config.C.Emby.ImagesRules
+	if len(rules) == 0 {
+		return nil
+	}
+
+	client, lan := requestClient(c), isLanClient(c.ClientIP())
+	// 获取用户名可能需要请求 emby, 只在规则需要时获取一次
+	user, userLoaded := "", false
+	userFn := func() string {
+		if !userLoaded {
+			user, userLoaded = requestUser(c), true
+		}
+		return user
+	}
+	for _, rule := range rules {
+		if rule.Match(userFn, client, lan) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// capImageWidth 限制图片的最大宽度
+//
+// 客户端指定的宽度超出限制时移除宽高参数, 由 emby 按照最大宽度等比缩放
+func capImageWidth(q url.Values, maxWidth int) {
+	if width, _ := strconv.Atoi(popQueryFold(q, "width")); width > maxWidth {
+		delQueryFold(q, "height")
+	} else if width > 0 {
+		q.Set("Width", strconv.Itoa(width))
+	}
+	if width, _ := strconv.Atoi(popQueryFold(q, "maxwidth")); width > 0 && width < maxWidth {
+		maxWidth = width
+	}
+	q.Set("MaxWidth", strconv.Itoa(maxWidth))
+}
+
+// popQueryFold 移除 query 中指定名称的参数 (不区分大小写), 返回第一个参数值
+func popQueryFold(q url.Values, name string) string {
+	value := ""
+	for key, values := range q {
+		if !strings.EqualFold(key, name) {
+			continue
+		}
+		if value == "" && len(values) > 0 {
+			value = values[0]
+		}
+		q.Del(key)
+	}
+	return value
+}
+
+// getQueryFold 获取 query 中指定名称的第一个参数值 (不区分大小写)
+func getQueryFold(q url.Values, name string) string {
+	for key, values := range q {
+		if strings.EqualFold(key, name) && len(values) > 0 {
+			return values[0]
+		}
+	}
+	return ""
+}
+
+// delQueryFold 移除 query 中指定名称的参数 (不区分大小写)
+func delQueryFold(q url.Values, name string) {
+	popQueryFold(q, name)
+}
+
+// isLanClient 判断客户端 ip 是否为本机或局域网地址
+func isLanClient(ip string) bool {
+	addr := net.ParseIP(ip)
+	if addr == nil {
+		return false
+	}
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast()
+}
@@ -0,0 +1,247 @@
+package emby
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/feature"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// HomeImageCacheSpace 首页预取图片的缓存空间 key
+	HomeImageCacheSpace = "HomeImage"
+
+	// homeImageTimeout 预取单张图片的超时时间
+	homeImageTimeout = time.Second * 30
+
+	// maxHomeImageSize 单张预取图片的最大大小
+	maxHomeImageSize = 10 * 1024 * 1024
+)
+
+var (
+	// userViewsRegex 匹配客户端加载首页时请求的用户媒体库视图接口, 提取用户 id
+	userViewsRegex = regexp.MustCompile(`(?i)/users/([^/]+)/views/?$`)
+
+	// homeImageRegex 匹配背景图和 logo 请求, 提取 item id, 图片类型和序号
+	homeImageRegex = regexp.MustCompile(`(?i)/items/([^/]+)/images/(backdrop|logo)(?:/(\d+))?/?$`)
+
+	// prefetchedAt 用户 id => 最近一次预取的时间
+	prefetchedAt = sync.Map{}
+)
+
+// homeItem 首页列表中的 item, 只保留预取图片需要的属性
+type homeItem struct {
+	Id                      string
+	ImageTags               map[string]string
+	BackdropImageTags       []string
+	ParentBackdropItemId    string
+	ParentBackdropImageTags []string
+	ParentLogoItemId        string
+	ParentLogoImageTag      string
+}
+
+// homeImage 需要预取的图片
+type homeImage struct {
+	itemId    string // 图片所属的 item id, 剧集使用所属剧集的图片
+	imageType string // 图片类型: Backdrop, Logo
+	tag       string // 图片标签
+}
+
+// ImagesPrefetcher 首页图片预取中间件
+//
+// 客户端加载首页 (请求用户的媒体库视图) 时, 在后台预取用户继续观看和最近添加列表中 item 的背景图和 logo,
+// 同一个用户在 emby.images-prefetch.interval 内只预取一次
+func ImagesPrefetcher() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.C.Emby.ImagesPrefetch
+		if !cfg.Enable || !config.C.Cache.Enable || !feature.Enabled(feature.ImagesQuality) || c.Request.Method != http.MethodGet {
+			return
+		}
+		matches := userViewsRegex.FindStringSubmatch(c.Request.URL.Path)
+		if len(matches) < 2 {
+			return
+		}
+		userId, now := matches[1], time.Now()
+		if last, ok := prefetchedAt.Load(userId); ok && now.Sub(last.(time.Time)) < cfg.IntervalDuration() {
+			return
+		}
+		prefetchedAt.Store(userId, now)
+		// 与客户端请求图片时使用相同的质量和最大宽度, 保证预取的图片能够被复用
+		go prefetchHomeImages(userId, resolveImagesProfile(c))
+	}
+}
+
+// serveHomeImage 请求的背景图或 logo 已经预取时, 直接返回预取的图片
+//
+// 与章节图片一致, 预取的图片忽略客户端请求的尺寸, 只区分图片质量和最大宽度
+func serveHomeImage(c *gin.Context) bool {
+	if !config.C.Emby.ImagesPrefetch.Enable {
+		return false
+	}
+	profile, ok := c.Get(ginKeyImagesProfile)
+	if !ok {
+		return false
+	}
+	matches := homeImageRegex.FindStringSubmatch(c.Request.URL.Path)
+	if len(matches) < 4 || matches[3] != "" && matches[3] != "0" {
+		return false
+	}
+	tag := c.Query("tag")
+	if tag == "" {
+		tag = c.Query("Tag")
+	}
+	if tag == "" {
+		return false
+	}
+
+	key := homeImageKey(homeImage{itemId: matches[1], imageType: matches[2], tag: tag}, profile.(imagesProfile))
+	rc, ok := cache.GetSpaceCache(HomeImageCacheSpace, key)
+	if !ok {
+		return false
+	}
+	logs.Debugf(colors.ToBlue("复用预取的首页图片, key: %s"), key)
+	c.Header(cache.HeaderKeyExpired, "-1")
+	c.Status(rc.Code())
+	https.CloneHeader(c, rc.Headers())
+	c.Writer.Write(rc.BodyBytes())
+	return true
+}
+
+// prefetchHomeImages 预取用户首页列表中 item 的背景图和 logo
+func prefetchHomeImages(userId string, profile imagesProfile) {
+	cfg := config.C.Emby.ImagesPrefetch
+	items, err := fetchHomeItems(userId, cfg.Limit)
+	if err != nil {
+		log.Printf(colors.ToYellow("获取用户 [%s] 的首页列表失败, 跳过图片预取: %v"), userId, err)
+		return
+	}
+
+	width := cfg.MaxWidth
+	if profile.maxWidth > 0 {
+		width = min(width, profile.maxWidth)
+	}
+	count := 0
+	for _, img := range homeImages(items) {
+		key := homeImageKey(img, profile)
+		if _, ok := cache.GetSpaceCache(HomeImageCacheSpace, key); ok {
+			continue
+		}
+		if err := prefetchHomeImage(img, key, profile.quality, width, cfg.ExpiredDuration()); err != nil {
+			logs.Debugf(colors.ToYellow("预取图片失败, item: %s, type: %s, err: %v"), img.itemId, img.imageType, err)
+			continue
+		}
+		count++
+	}
+	if count > 0 {
+		logs.Debugf(colors.ToGreen("用户 [%s] 的首页图片预取完成, 个数: %d"), userId, count)
+	}
+}
+
+// fetchHomeItems 获取用户继续观看和最近添加列表中的 item
+func fetchHomeItems(userId string, limit int) ([]homeItem, error) {
+	q := url.Values{}
+	q.Set("Limit", strconv.Itoa(limit))
+	q.Set("EnableImageTypes", "Backdrop,Logo")
+	q.Set("ImageTypeLimit", "1")
+	base := "/emby/Users/" + url.PathEscape(userId)
+
+	res, _ := Fetch(base+"/Items/Resume?"+q.Encode(), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return nil, fmt.Errorf("请求继续观看列表失败: %s", res.Msg)
+	}
+	var resume struct{ Items []homeItem }
+	if err := res.Data.To(&resume); err != nil {
+		return nil, fmt.Errorf("解析 emby 响应失败: %v", err)
+	}
+
+	res, _ = Fetch(base+"/Items/Latest?"+q.Encode(), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return nil, fmt.Errorf("请求最近添加列表失败: %s", res.Msg)
+	}
+	var latest []homeItem
+	if err := res.Data.To(&latest); err != nil {
+		return nil, fmt.Errorf("解析 emby 响应失败: %v", err)
+	}
+	return append(resume.Items, latest...), nil
+}
+
+// homeImages 获取 item 需要预取的背景图和 logo, item 本身没有图片时使用所属剧集的图片
+func homeImages(items []homeItem) []homeImage {
+	res := make([]homeImage, 0, len(items)*2)
+	seen := make(map[homeImage]struct{})
+	add := func(img homeImage) {
+		if img.itemId == "" || img.tag == "" {
+			return
+		}
+		if _, ok := seen[img]; ok {
+			return
+		}
+		seen[img] = struct{}{}
+		res = append(res, img)
+	}
+
+	for _, item := range items {
+		if len(item.BackdropImageTags) > 0 {
+			add(homeImage{itemId: item.Id, imageType: "Backdrop", tag: item.BackdropImageTags[0]})
+		} else if len(item.ParentBackdropImageTags) > 0 {
+			add(homeImage{itemId: item.ParentBackdropItemId, imageType: "Backdrop", tag: item.ParentBackdropImageTags[0]})
+		}
+		if tag := item.ImageTags["Logo"]; tag != "" {
+			add(homeImage{itemId: item.Id, imageType: "Logo", tag: tag})
+		} else {
+			add(homeImage{itemId: item.ParentLogoItemId, imageType: "Logo", tag: item.ParentLogoImageTag})
+		}
+	}
+	return res
+}
+
+// prefetchHomeImage 请求源服务器的图片, 写入缓存空间
+func prefetchHomeImage(img homeImage, key string, quality, width int, expired time.Duration) error {
+	q := url.Values{}
+	q.Set("tag", img.tag)
+	q.Set("Quality", strconv.Itoa(quality))
+	q.Set("MaxWidth", strconv.Itoa(width))
+	q.Set(QueryApiKeyName, config.C.Emby.ApiKey)
+	u := fmt.Sprintf("%s/emby/Items/%s/Images/%s/0?%s", config.C.Emby.Host, url.PathEscape(img.itemId), img.imageType, q.Encode())
+
+	ctx, cancel := context.WithTimeout(context.Background(), homeImageTimeout)
+	defer cancel()
+	resp, err := https.RequestCtx(ctx, http.MethodGet, u, nil, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("响应码: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxHomeImageSize+1))
+	if err != nil {
+		return err
+	}
+	if len(body) > maxHomeImageSize {
+		return fmt.Errorf("图片大小超出限制: %d MB", maxHomeImageSize>>20)
+	}
+	cache.PutSpaceCache(HomeImageCacheSpace, key, resp.StatusCode, resp.Header, body, expired)
+	return nil
+}
+
+// homeImageKey 预取图片在缓存空间中的 key, 不同的图片质量和最大宽度分开缓存
+func homeImageKey(img homeImage, profile imagesProfile) string {
+	return fmt.Sprintf("%s_%s_%s_%d_%d", img.itemId, strings.ToLower(img.imageType), img.tag, profile.quality, profile.maxWidth)
+}
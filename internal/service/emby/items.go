@@ -12,9 +12,11 @@ import (
 	"time"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/feature"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
 	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
 
 	"github.com/gin-gonic/gin"
@@ -53,11 +55,11 @@ func ResortRandomItems(c *gin.Context) {
 		bodyBytes = spaceCache.BodyBytes()
 		code = spaceCache.Code()
 		header = spaceCache.Headers()
-		log.Println(colors.ToBlue("使用缓存空间中的 random items 列表"))
+		logs.Debugln(colors.ToBlue("使用缓存空间中的 random items 列表"))
 	} else {
 		// 请求原始列表
 		u := strings.ReplaceAll(https.ClientRequestUrl(c), "/Items", "/Items/with_limit")
-		resp, err := https.Request(http.MethodGet, u, c.Request.Header, c.Request.Body)
+		resp, err := https.RequestCtx(c.Request.Context(), http.MethodGet, u, c.Request.Header, c.Request.Body)
 		if checkErr(c, err) {
 			return
 		}
@@ -146,7 +148,7 @@ func RandomItemsWithLimit(c *gin.Context) {
 	u.RawQuery = q.Encode()
 	embyHost := config.C.Emby.Host
 	c.Request.Header.Del("Accept-Encoding")
-	resp, err := https.Request(c.Request.Method, embyHost+u.String(), c.Request.Header, c.Request.Body)
+	resp, err := https.RequestCtx(c.Request.Context(), c.Request.Method, embyHost+u.String(), c.Request.Header, c.Request.Body)
 	if checkErr(c, err) {
 		return
 	}
@@ -184,7 +186,14 @@ func calcRandomItemsCacheKey(c *gin.Context) string {
 // ProxyAddItemsPreviewInfo 代理 Items 接口, 并
 func ProxyAddItemsPreviewInfo(c *gin.Context) {
 	// 检查用户是否启用了转码版本获取
-	if !config.C.VideoPreview.Enable {
+	if isKodiClient(c) {
+		ProxyKodiItems(c)
+		return
+	}
+
+	// Infuse 同步媒体库时不需要转码版本信息, 跳过响应解析
+	if !config.C.VideoPreview.Enable || !feature.Enabled(feature.VideoPreview) ||
+		config.C.Cache.Infuse.Match(c.GetHeader("User-Agent")) {
 		ProxyOrigin(c)
 		return
 	}
@@ -192,7 +201,7 @@ func ProxyAddItemsPreviewInfo(c *gin.Context) {
 	// 代理请求
 	embyHost := config.C.Emby.Host
 	c.Request.Header.Del("Accept-Encoding")
-	resp, err := https.Request(c.Request.Method, embyHost+c.Request.URL.String(), c.Request.Header, c.Request.Body)
+	resp, err := https.RequestCtx(c.Request.Context(), c.Request.Method, embyHost+c.Request.URL.String(), c.Request.Header, c.Request.Body)
 	if checkErr(c, err) {
 		return
 	}
@@ -216,20 +225,14 @@ func ProxyAddItemsPreviewInfo(c *gin.Context) {
 	defer func() {
 		resp.Header.Del("Content-Length")
 		https.CloneHeader(c, resp.Header)
-		c.JSON(http.StatusOK, resJson.Struct())
+		c.JSON(http.StatusOK, resJson)
 	}()
 
-	// 获取 Items 数组
-	itemsArr, ok := resJson.Attr("Items").Done()
-	if !ok || itemsArr.Empty() || itemsArr.Type() != jsons.JsonTypeArr {
-		return
-	}
-
-	// 遍历每个 Item, 修改 MediaSource 信息
-	itemsArr.RangeArr(func(index int, item *jsons.Item) error {
-		mediaSources, ok := item.Attr("MediaSources").Done()
-		if !ok || mediaSources.Empty() {
-			return nil
+	// 遍历每个 Item 的 MediaSources, 修改 MediaSource 信息
+	allMediaSources, _ := resJson.Query("$.Items[*].MediaSources")
+	for _, mediaSources := range allMediaSources {
+		if mediaSources.Type() != jsons.JsonTypeArr || mediaSources.Empty() {
+			continue
 		}
 
 		toAdd := make([]*jsons.Item, 0)
@@ -241,21 +244,20 @@ func ProxyAddItemsPreviewInfo(c *gin.Context) {
 			ms.Put("Name", jsons.NewByVal("(原画) "+originName))
 
 			originMediaStreams, _ := ms.Attr("MediaStreams").Done()
-			copyMediaStreams := jsons.NewByVal(originMediaStreams.Struct())
+			copyMediaStreams := originMediaStreams.Clone()
 			videoStreamIdx := copyMediaStreams.FindIdx(func(val *jsons.Item) bool { return val.Attr("Type").Val() == "Video" })
 			copyMediaStreams.Ti().Idx(videoStreamIdx).Attr("Codec").Set("prores")
 
 			for _, tplId := range allTplIds {
-				copyMs := jsons.NewByVal(ms.Struct())
+				copyMs := ms.Clone()
 				copyMs.Put("Name", jsons.NewByVal(fmt.Sprintf("(%s) %s", tplId, originName)))
 				copyMs.Put("Id", jsons.NewByVal(fmt.Sprintf("%s%s%s", originId, MediaSourceIdSegment, tplId)))
-				copyMs.Put("MediaStreams", copyMediaStreams)
+				copyMs.Put("MediaStreams", copyMediaStreams.Clone())
 				toAdd = append(toAdd, copyMs)
 			}
 			return nil
 		})
 
 		mediaSources.Append(toAdd...)
-		return nil
-	})
+	}
 }
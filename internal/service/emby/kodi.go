@@ -0,0 +1,101 @@
+package emby
+
+import (
+	"regexp"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// kodiClientRegex 匹配 Emby for Kodi 客户端
+var kodiClientRegex = regexp.MustCompile(`(?i)kodi`)
+
+// isKodiClient 判断请求是否来自 Emby for Kodi
+func isKodiClient(c *gin.Context) bool {
+	return kodiClientRegex.MatchString(requestClient(c)) ||
+		kodiClientRegex.MatchString(c.GetHeader("User-Agent"))
+}
+
+// ProxyUserItems 代理用户的 Items 列表接口
+//
+// Kodi 客户端同步媒体库时走兼容处理; 按名称排序的列表按照 emby.locale-sort 重新排序;
+// 启用 emby.remote-images 时改写响应中的远程图片地址, 否则直接回源
+func ProxyUserItems(c *gin.Context) {
+	if isKodiClient(c) {
+		ProxyKodiItems(c)
+		return
+	}
+	if localeSortable(c) {
+		ProxyLocaleSortedItems(c)
+		return
+	}
+	if config.C.Emby.RemoteImages.Enable {
+		proxyRewriteRemoteImages(c)
+		return
+	}
+	ProxyOrigin(c)
+}
+
+// ProxyKodiItems 代理 Kodi 客户端的 Items 接口
+//
+// 响应不做转码版本等改写, 避免 Kodi 同步出重复的资源;
+// 启用 direct-path 时, 将媒体路径改写为本程序的直链地址, 供 Kodi 的原生模式直接播放
+func ProxyKodiItems(c *gin.Context) {
+	if !config.C.Emby.Kodi.DirectPath {
+		ProxyOrigin(c)
+		return
+	}
+
+	_, apiKey := getApiKey(c)
+	if apiKey == "" {
+		apiKey = config.C.Emby.ApiKey
+	}
+	host := https.ClientRequestHost(c)
+
+	checkErr(c, https.ProxyRequestWithHook(c, config.C.Emby.Host, true, https.JsonHook(func(body *jsons.Item) error {
+		items := []*jsons.Item{body}
+		if arr, ok := body.Attr("Items").Done(); ok && arr.Type() == jsons.JsonTypeArr {
+			items = arr.ValuesArr()
+		}
+		cnt := 0
+		for _, item := range items {
+			if rewriteKodiPath(item, host, apiKey) {
+				cnt++
+			}
+		}
+		logs.Debugf(colors.ToBlue("Kodi 媒体路径已改写为直链地址, 个数: %d"), cnt)
+		return nil
+	})))
+}
+
+// rewriteKodiPath 将 item 及其 MediaSource 的路径改写为本程序的直链地址
+//
+// 远程资源 (strm) 改写为映射之后的远程地址, 返回是否发生了改写
+func rewriteKodiPath(item *jsons.Item, host, apiKey string) bool {
+	sources, ok := item.Attr("MediaSources").Done()
+	if !ok || sources.Type() != jsons.JsonTypeArr || sources.Empty() {
+		return false
+	}
+	itemId, _ := item.Attr("Id").String()
+
+	rewritten := false
+	sources.RangeArr(func(idx int, source *jsons.Item) error {
+		link := host + directStreamUrl(source, itemId, apiKey)
+		if ir, _ := source.Attr("IsRemote").Bool(); ir {
+			path, _ := source.Attr("Path").String()
+			link = mapStrmPath(path)
+		}
+		source.Put("Path", jsons.NewByVal(link))
+		if idx == 0 {
+			item.Put("Path", jsons.NewByVal(link))
+		}
+		rewritten = true
+		return nil
+	})
+	return rewritten
+}
@@ -0,0 +1,71 @@
+package emby
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// applyLanguageProfile 按照请求用户的语言偏好设置 MediaSource 的默认音轨和默认字幕
+//
+// 客户端请求中已经指定了音轨或字幕时, 以客户端的选择为准
+func applyLanguageProfile(c *gin.Context, source *jsons.Item) {
+	cfg := config.C.Language
+	if !cfg.Enable || source == nil {
+		return
+	}
+	user := requestUser(c)
+	profile := cfg.Profile(user)
+
+	if strs.AnyEmpty(c.Query("AudioStreamIndex")) {
+		if idx, ok := pickStreamIndex(source, "Audio", profile.Audio, false); ok {
+			source.Put("DefaultAudioStreamIndex", jsons.NewByVal(idx))
+			logs.Debugf(colors.ToBlue("按照用户 [%s] 的语言偏好设置默认音轨: %d"), user, idx)
+		}
+	}
+
+	if strs.AnyEmpty(c.Query("SubtitleStreamIndex")) {
+		idx, ok := pickStreamIndex(source, "Subtitle", profile.Subtitle, profile.ForcedOnly)
+		if !ok && profile.ForcedOnly {
+			// 没有匹配的强制字幕, 关闭字幕
+			idx, ok = -1, true
+		}
+		if ok {
+			source.Put("DefaultSubtitleStreamIndex", jsons.NewByVal(idx))
+			logs.Debugf(colors.ToBlue("按照用户 [%s] 的语言偏好设置默认字幕: %d"), user, idx)
+		}
+	}
+}
+
+// pickStreamIndex 按照语言优先级从 MediaSource 中选出指定类型的媒体流, 返回媒体流的 Index
+//
+// forcedOnly 为 true 时只匹配强制字幕
+func pickStreamIndex(source *jsons.Item, streamType string, langs []string, forcedOnly bool) (int, bool) {
+	query := fmt.Sprintf("$.MediaStreams[?(@.Type=='%s')]", streamType)
+	if forcedOnly {
+		query = fmt.Sprintf("$.MediaStreams[?(@.Type=='%s' && @.IsForced==true)]", streamType)
+	}
+	streams, err := source.Query(query)
+	if err != nil || len(streams) == 0 {
+		return 0, false
+	}
+
+	for _, lang := range langs {
+		for _, stream := range streams {
+			if l, _ := stream.Attr("Language").String(); !strings.EqualFold(l, lang) {
+				continue
+			}
+			if idx, ok := stream.Attr("Index").Int(); ok {
+				return idx, true
+			}
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,101 @@
+package emby
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/path"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/pathmap"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+const (
+	// LazyTemplateId 延迟获取转码资源时, 占位资源使用的清晰度 id
+	LazyTemplateId = "lazy"
+
+	// lazyTemplateExpired 延迟解析出的清晰度的缓存时间, 与 PlaybackInfo 的缓存时间一致
+	lazyTemplateExpired = time.Hour * 12
+)
+
+// lazyTemplate 延迟解析出的清晰度
+type lazyTemplate struct {
+	id      string
+	expired time.Time
+}
+
+// lazyTemplates alist 账号 + alist 路径 => 延迟解析出的清晰度
+var lazyTemplates sync.Map
+
+// lazyPreviewSource 生成延迟获取转码资源的占位资源, 不请求 alist
+//
+// 客户端选择该资源播放时, 才由 ResolveLazyTemplate 获取实际使用的清晰度
+func lazyPreviewSource(account string, source *jsons.Item, originName, clientApiKey string) *jsons.Item {
+	alistPath := previewAlistPath(account, source)
+	if alistPath == "" {
+		return nil
+	}
+	return newPreviewSource(source, alistPath, LazyTemplateId, "auto", fmt.Sprintf("(转码可用) %s", originName), clientApiKey)
+}
+
+// previewAlistPath 不请求 alist, 使用手动指定的路径, 映射缓存或路径转换规则获取 source 的 alist 路径, 转换失败时返回空字符串
+func previewAlistPath(account string, source *jsons.Item) string {
+	embyPath, _ := source.Attr("Path").String()
+	alistPathRes := path.Emby2Alist(embyPath)
+	alistPath := alistPathRes.Path
+	if p, ok := pathmap.GetOverride(alistPathRes.EmbyPath); ok {
+		alistPath = p
+	} else if p, ok := pathmap.Get(account, alistPathRes.EmbyPath); ok {
+		alistPath = p
+	}
+	if !alistPathRes.Success || strs.AnyEmpty(alistPath) {
+		return ""
+	}
+	return alistPath
+}
+
+// ResolveLazyTemplate 获取占位资源实际使用的清晰度, 选择未被忽略的最高清晰度
+//
+// 首次解析时请求 alist 转码信息, 之后使用缓存的结果
+func ResolveLazyTemplate(account, alistPath string) (string, error) {
+	key := account + "|" + alistPath
+	if v, ok := lazyTemplates.Load(key); ok {
+		if lt := v.(lazyTemplate); time.Now().Before(lt.expired) {
+			return lt.id, nil
+		}
+		lazyTemplates.Delete(key)
+	}
+
+	res := alist.FetchFsOther(alist.WithAccount(context.Background(), account), alistPath, nil)
+	if res.Code != http.StatusOK {
+		return "", fmt.Errorf("请求 alist 转码资源失败: %s", res.Msg)
+	}
+	list, ok := res.Data.Attr("video_preview_play_info").Attr("live_transcoding_task_list").Done()
+	if !ok || list.Type() != jsons.JsonTypeArr {
+		return "", fmt.Errorf("alist 转码资源响应异常, path: %s", alistPath)
+	}
+
+	templateId, maxHeight := "", -1
+	list.RangeArr(func(_ int, task *jsons.Item) error {
+		id, _ := task.Attr("template_id").String()
+		height, _ := task.Attr("template_height").Int()
+		if strs.AllNotEmpty(id) && !config.C.VideoPreview.IsTemplateIgnore(id) && height > maxHeight {
+			templateId, maxHeight = id, height
+		}
+		return nil
+	})
+	if templateId == "" {
+		return "", fmt.Errorf("没有可用的转码清晰度, path: %s", alistPath)
+	}
+
+	logs.Debugf(colors.ToBlue("延迟解析转码清晰度: %s => %s"), alistPath, templateId)
+	lazyTemplates.Store(key, lazyTemplate{id: templateId, expired: time.Now().Add(lazyTemplateExpired)})
+	return templateId, nil
+}
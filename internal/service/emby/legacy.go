@@ -0,0 +1,28 @@
+package emby
+
+import (
+	"net/url"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/shortlink"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IsLegacyClient 判断请求是否来自 legacy-client 配置的旧设备
+func IsLegacyClient(c *gin.Context) bool {
+	return config.C.LegacyClient.Match(requestClient(c), c.GetHeader("User-Agent"))
+}
+
+// ShortenUrl 将地址替换为短链接, 绝对地址保留原有的协议和域名
+func ShortenUrl(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return raw
+	}
+	short := shortlink.Shorten(u.RequestURI(), config.C.LegacyClient.ExpiredDuration())
+	if u.IsAbs() {
+		return u.Scheme + "://" + u.Host + short
+	}
+	return short
+}
@@ -0,0 +1,78 @@
+package emby
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+)
+
+// libraryTaskKey emby 媒体库扫描计划任务的 key
+const libraryTaskKey = "RefreshLibrary"
+
+// WatchLibrary 启动媒体库变更监听
+//
+// 定期轮询 emby 的媒体库扫描任务, 每次扫描完成后更新缓存版本, 使缓存在媒体库变化时立即失效,
+// 并核对缓存中记录的 item, 清除已经从 emby 中删除的 item 残留的缓存
+func WatchLibrary() {
+	cfg := config.C.Cache.LibraryWatch
+	if !cfg.Enable {
+		return
+	}
+
+	go func() {
+		lastScan := ""
+		ticker := time.NewTicker(cfg.IntervalDuration())
+		defer ticker.Stop()
+		for {
+			scan, err := fetchLastLibraryScan()
+			if err != nil {
+				log.Printf(colors.ToYellow("查询媒体库扫描任务失败: %v"), err)
+			} else if scan != lastScan {
+				lastScan = scan
+				cache.SetVersion("scan-" + scan)
+				ReconcileOrphans()
+			}
+			<-ticker.C
+		}
+	}()
+}
+
+// NotifyLibraryChanged 通知媒体库已经发生变化, 立即更新缓存版本
+//
+// 供 emby webhook 等外部信号调用
+func NotifyLibraryChanged(reason string) {
+	log.Printf(colors.ToYellow("收到媒体库变更通知: %s"), reason)
+	cache.SetVersion("notify-" + strconv.FormatInt(time.Now().UnixMilli(), 10))
+}
+
+// fetchLastLibraryScan 获取最近一次完成的媒体库扫描时间
+//
+// 扫描正在进行时返回上一次完成的时间, 等待扫描结束后再更新版本
+func fetchLastLibraryScan() (string, error) {
+	res, _ := Fetch("/emby/ScheduledTasks?IsHidden=false", http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return "", fmt.Errorf("请求 emby 失败: %s", res.Msg)
+	}
+
+	idx := res.Data.FindIdx(func(task *jsons.Item) bool {
+		key, _ := task.Attr("Key").String()
+		return key == libraryTaskKey
+	})
+	if idx == -1 {
+		return "", fmt.Errorf("未找到媒体库扫描任务: %s", libraryTaskKey)
+	}
+	task := res.Data.Idx(idx)
+	if state, _ := task.Attr("State").String(); state == "Running" {
+		logs.Debugf(colors.ToBlue("媒体库扫描进行中, 等待扫描结束"))
+	}
+	end, _ := task.Attr("LastExecutionResult").Attr("EndTimeUtc").String()
+	return end, nil
+}
@@ -0,0 +1,197 @@
+package emby
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/cluster"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/encrypts"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// LiveStreamIdPrefix 本程序生成的 LiveStreamId 前缀
+	//
+	// 完整格式为: 前缀 + 8 位摘要 + "_" + MediaSourceId, 从 id 中即可还原出对应的资源,
+	// 程序重启或者 PlaybackInfo 命中缓存时也能正确处理
+	LiveStreamIdPrefix = "e2a_"
+
+	// liveStreamExpired 未关闭的 LiveStream 最长保留时间
+	liveStreamExpired = time.Hour * 12
+)
+
+// liveStream 本程序维护的 LiveStream 信息
+type liveStream struct {
+	ItemId        string
+	MediaSourceId string
+	User          string
+	Device        string
+	OpenedAt      time.Time
+}
+
+// liveStreams LiveStreamId => liveStream
+var liveStreams sync.Map
+
+// autoOpenLiveStream 判断客户端请求 PlaybackInfo 时是否要求自动打开 LiveStream
+func autoOpenLiveStream(c *gin.Context) bool {
+	if strings.EqualFold(c.Query("AutoOpenLiveStream"), "true") {
+		return true
+	}
+	reqJson, ok := requestBodyJson(c)
+	if !ok {
+		return false
+	}
+	open, _ := reqJson.Attr("AutoOpenLiveStream").Bool()
+	return open
+}
+
+// requestBodyJson 读取并解析 json 请求体, 读取之后重新设置回请求中
+func requestBodyJson(c *gin.Context) (*jsons.Item, bool) {
+	if c.Request.Body == nil {
+		return nil, false
+	}
+	bodyBytes, err := io.ReadAll(c.Request.Body)
+	if err != nil {
+		return nil, false
+	}
+	c.Request.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+	reqJson, err := jsons.New(string(bodyBytes))
+	return reqJson, err == nil
+}
+
+// mintLiveStreamId 为资源生成 LiveStreamId, 同一个资源生成的 id 始终一致
+func mintLiveStreamId(itemId, mediaSourceId string) string {
+	return LiveStreamIdPrefix + encrypts.Md5Hash(itemId + mediaSourceId)[:8] + "_" + mediaSourceId
+}
+
+// parseLiveStreamId 从本程序生成的 LiveStreamId 中还原 MediaSourceId
+func parseLiveStreamId(id string) (string, bool) {
+	if !strings.HasPrefix(id, LiveStreamIdPrefix) {
+		return "", false
+	}
+	rest := strings.TrimPrefix(id, LiveStreamIdPrefix)
+	if len(rest) < 10 || rest[8] != '_' {
+		return "", false
+	}
+	return rest[9:], true
+}
+
+// applyLiveStreams 处理 PlaybackInfo 中资源的 LiveStream 信息
+//
+// emby 返回的 LiveStreamId 对应的是源服务器的转码流, 改写为直链之后不再可用, 需要移除;
+// 客户端要求自动打开 LiveStream 时, 为每个资源生成本程序的 LiveStreamId 并记录
+func applyLiveStreams(c *gin.Context, itemInfo ItemInfo, mediaSources *jsons.Item, autoOpen bool) {
+	applyLiveStreamsFor(requestUser(c), sessionDevice(c), itemInfo, mediaSources, autoOpen)
+}
+
+// applyLiveStreamsFor 使用指定的用户和设备处理资源的 LiveStream 信息, 用于请求结束之后补充的资源
+func applyLiveStreamsFor(user, device string, itemInfo ItemInfo, mediaSources *jsons.Item, autoOpen bool) {
+	mediaSources.RangeArr(func(_ int, source *jsons.Item) error {
+		source.DelKey("LiveStreamId")
+		source.DelKey("OpenToken")
+		source.Put("RequiresOpening", jsons.NewByVal(false))
+		if !autoOpen {
+			source.Put("RequiresClosing", jsons.NewByVal(false))
+			return nil
+		}
+
+		sourceId, _ := source.Attr("Id").String()
+		itemId, _ := source.Attr("ItemId").String()
+		if strs.AnyEmpty(itemId) {
+			itemId = itemInfo.Id
+		}
+		id := mintLiveStreamId(itemId, sourceId)
+		source.Put("LiveStreamId", jsons.NewByVal(id))
+		source.Put("RequiresClosing", jsons.NewByVal(true))
+		ls := liveStream{ItemId: itemId, MediaSourceId: sourceId, User: user, Device: device, OpenedAt: time.Now()}
+		liveStreams.Store(id, ls)
+		shareLiveStream(id, ls)
+		return nil
+	})
+	if autoOpen {
+		logs.Debugf(colors.ToBlue("已为 %d 个资源生成 LiveStreamId, 用户: %s, 设备: %s"), mediaSources.Len(), user, device)
+	}
+	cleanLiveStreams(nil)
+}
+
+// cleanLiveStreams 清理过期的 LiveStream, 以及满足 match 条件的 LiveStream
+func cleanLiveStreams(match func(id string, ls liveStream) bool) int {
+	cnt := 0
+	liveStreams.Range(func(key, value any) bool {
+		id, ls := key.(string), value.(liveStream)
+		if time.Since(ls.OpenedAt) > liveStreamExpired || (match != nil && match(id, ls)) {
+			liveStreams.Delete(key)
+			cnt++
+		}
+		return true
+	})
+	return cnt
+}
+
+// shareLiveStream 集群模式下将 LiveStream 注册到 redis 中, 任意副本都可以关闭
+func shareLiveStream(id string, ls liveStream) {
+	if !cluster.Enabled() {
+		return
+	}
+	data, err := json.Marshal(ls)
+	if err != nil {
+		return
+	}
+	go cluster.Set(cluster.Key("livestream", id), string(data), liveStreamExpired)
+}
+
+// requestLiveStreamId 从请求参数或请求体中获取 LiveStreamId
+func requestLiveStreamId(c *gin.Context) string {
+	if id := c.Query("LiveStreamId"); strs.AllNotEmpty(id) {
+		return id
+	}
+	reqJson, ok := requestBodyJson(c)
+	if !ok {
+		return ""
+	}
+	id, _ := reqJson.Attr("LiveStreamId").String()
+	return id
+}
+
+// closeProxyLiveStream 关闭本程序生成的 LiveStream, 源服务器不认识这类 id, 请求不再转发
+//
+// 返回 true 表示请求已经处理完毕
+func closeProxyLiveStream(c *gin.Context) bool {
+	id := requestLiveStreamId(c)
+	if _, ok := parseLiveStreamId(id); !ok {
+		return false
+	}
+	c.Header(cache.HeaderKeyExpired, "-1")
+	liveStreams.Delete(id)
+	if cluster.Enabled() {
+		go cluster.Del(cluster.Key("livestream", id))
+	}
+	log.Printf(colors.ToBlue("关闭 LiveStream: %s"), id)
+	c.Status(http.StatusNoContent)
+	return true
+}
+
+// stripProxyLiveStreamId 回源之前移除请求参数中本程序生成的 LiveStreamId,
+// 避免源服务器找不到对应的流而报错
+func stripProxyLiveStreamId(c *gin.Context) {
+	q := c.Request.URL.Query()
+	id := q.Get("LiveStreamId")
+	if _, ok := parseLiveStreamId(id); !ok {
+		return
+	}
+	q.Del("LiveStreamId")
+	c.Request.URL.RawQuery = q.Encode()
+	c.Request.RequestURI = c.Request.URL.RequestURI()
+}
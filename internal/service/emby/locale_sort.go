@@ -0,0 +1,224 @@
+package emby
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/collate"
+)
+
+// localeSortedList 本地化排序之后的完整列表
+type localeSortedList struct {
+	resMain map[string]json.RawMessage // 响应中除了 Items 之外的属性
+	items   []json.RawMessage          // 排序之后的 Items
+	header  http.Header
+	expired time.Time
+}
+
+var (
+	// localeSortedLists 请求地址 (不含分页参数) => 排序之后的完整列表, 客户端翻页时复用
+	localeSortedLists = sync.Map{}
+
+	// libraryIds 媒体库名称 => 媒体库 id, 用于匹配 locale-sort.libraries 中配置的名称
+	libraryIds map[string]string
+	// libraryIdsMu 并发控制
+	libraryIdsMu sync.Mutex
+)
+
+// localeSortable 判断 Items 列表请求是否需要进行本地化重排序
+//
+// 只处理第一排序字段为 SortName 且属于生效媒体库的请求
+func localeSortable(c *gin.Context) bool {
+	cfg := config.C.Emby.LocaleSort
+	if !cfg.Enable || c.Request.Method != http.MethodGet {
+		return false
+	}
+	q := c.Request.URL.Query()
+	sortBy, _, _ := strings.Cut(getQueryFold(q, "SortBy"), ",")
+	if !strings.EqualFold(strings.TrimSpace(sortBy), "SortName") {
+		return false
+	}
+	if len(cfg.Libraries) == 0 {
+		return true
+	}
+	parentId := getQueryFold(q, "ParentId")
+	if parentId == "" {
+		return false
+	}
+	for _, lib := range cfg.Libraries {
+		if lib == parentId || libraryId(lib) == parentId {
+			return true
+		}
+	}
+	return false
+}
+
+// ProxyLocaleSortedItems 获取完整的 Items 列表, 按照 locale-sort 配置的语言重新排序之后分页返回
+//
+// 请求异常时回源处理
+func ProxyLocaleSortedItems(c *gin.Context) {
+	q := c.Request.URL.Query()
+	startIndex, _ := strconv.Atoi(popQueryFold(q, "StartIndex"))
+	limit, err := strconv.Atoi(popQueryFold(q, "Limit"))
+	if err != nil || limit <= 0 {
+		limit = -1
+	}
+	descending := strings.EqualFold(strings.TrimSpace(strings.Split(getQueryFold(q, "SortOrder"), ",")[0]), "Descending")
+
+	// 排序需要 SortName 字段
+	fields := popQueryFold(q, "Fields")
+	if !slices.ContainsFunc(strings.Split(fields, ","), func(f string) bool { return strings.EqualFold(strings.TrimSpace(f), "SortName") }) {
+		fields = strings.Trim(fields+",SortName", ",")
+	}
+	q.Set("Fields", fields)
+	uri := c.Request.URL.Path + "?" + q.Encode()
+
+	list, err := loadLocaleSortedList(c, uri, descending)
+	if err != nil {
+		log.Printf(colors.ToYellow("本地化排序 Items 列表失败, 回源处理: %v"), err)
+		ProxyOrigin(c)
+		return
+	}
+
+	// 分页
+	startIndex = max(0, min(startIndex, len(list.items)))
+	end := len(list.items)
+	if limit > 0 {
+		end = min(end, startIndex+limit)
+	}
+	resMain := make(map[string]json.RawMessage, len(list.resMain)+1)
+	for key, value := range list.resMain {
+		resMain[key] = value
+	}
+	resMain["Items"], _ = json.Marshal(list.items[startIndex:end])
+	resMain["TotalRecordCount"], _ = json.Marshal(len(list.items))
+	body, _ := json.Marshal(resMain)
+
+	if config.C.Emby.RemoteImages.Enable {
+		host := https.ClientRequestHost(c)
+		if patched, _, err := jsons.PatchStrings(body, func(_, val string) (string, bool) {
+			return remoteImageProxyUrl(val, host)
+		}); err == nil {
+			body = patched
+		}
+	}
+
+	header := list.header.Clone()
+	header.Del("Content-Length")
+	https.CloneHeader(c, header)
+	c.Status(http.StatusOK)
+	c.Writer.Write(body)
+}
+
+// loadLocaleSortedList 获取排序之后的完整列表, 优先使用缓存
+func loadLocaleSortedList(c *gin.Context, uri string, descending bool) (*localeSortedList, error) {
+	if v, ok := localeSortedLists.Load(uri); ok {
+		if list := v.(*localeSortedList); time.Now().Before(list.expired) {
+			logs.Debugf(colors.ToBlue("使用缓存的本地化排序列表: %s"), uri)
+			return list, nil
+		}
+		localeSortedLists.Delete(uri)
+	}
+
+	c.Request.Header.Del("Accept-Encoding")
+	resp, err := https.RequestCtx(c.Request.Context(), http.MethodGet, config.C.Emby.Host+uri, c.Request.Header, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("错误的响应码: %d", resp.StatusCode)
+	}
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应体失败: %v", err)
+	}
+
+	// 对 item 内部结构不关心, 只解析排序需要的字段
+	var resMain map[string]json.RawMessage
+	if err := json.Unmarshal(bodyBytes, &resMain); err != nil {
+		return nil, fmt.Errorf("解析响应体失败: %v", err)
+	}
+	var items []json.RawMessage
+	if err := json.Unmarshal(resMain["Items"], &items); err != nil {
+		return nil, fmt.Errorf("解析 Items 失败: %v", err)
+	}
+	delete(resMain, "Items")
+	sortItemsByLocale(items, descending)
+
+	cfg := config.C.Emby.LocaleSort
+	list := &localeSortedList{resMain: resMain, items: items, header: resp.Header, expired: time.Now().Add(cfg.ExpiredDuration())}
+	localeSortedLists.Store(uri, list)
+	logs.Debugf(colors.ToBlue("Items 列表已按照 [%s] 重新排序, 个数: %d"), cfg.Tag(), len(items))
+	return list, nil
+}
+
+// sortItemsByLocale 按照 SortName (为空时使用 Name) 对 items 进行本地化排序, 数字按照数值大小比较
+func sortItemsByLocale(items []json.RawMessage, descending bool) {
+	names := make([]string, len(items))
+	for i, raw := range items {
+		var item struct{ SortName, Name string }
+		json.Unmarshal(raw, &item)
+		names[i] = item.SortName
+		if names[i] == "" {
+			names[i] = item.Name
+		}
+	}
+
+	// collator 不支持并发使用, 每次排序单独创建
+	col := collate.New(config.C.Emby.LocaleSort.Tag(), collate.Numeric, collate.IgnoreCase)
+	idx := make([]int, len(items))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.SliceStable(idx, func(a, b int) bool {
+		cmp := col.CompareString(names[idx[a]], names[idx[b]])
+		if descending {
+			return cmp > 0
+		}
+		return cmp < 0
+	})
+
+	sorted := make([]json.RawMessage, len(items))
+	for i, from := range idx {
+		sorted[i] = items[from]
+	}
+	copy(items, sorted)
+}
+
+// libraryId 获取媒体库名称对应的 id, 首次调用时请求 emby 获取所有媒体库, 获取失败时下次调用重试
+func libraryId(name string) string {
+	libraryIdsMu.Lock()
+	defer libraryIdsMu.Unlock()
+	if libraryIds == nil {
+		res, _ := Fetch("/Library/VirtualFolders", http.MethodGet, nil, nil)
+		if res.Code != http.StatusOK {
+			log.Printf(colors.ToYellow("获取媒体库列表失败: %s"), res.Msg)
+			return ""
+		}
+		libraryIds = make(map[string]string)
+		res.Data.RangeArr(func(_ int, lib *jsons.Item) error {
+			libName, _ := lib.Attr("Name").String()
+			id, _ := lib.Attr("ItemId").String()
+			libraryIds[libName] = id
+			return nil
+		})
+	}
+	return libraryIds[name]
+}
@@ -2,6 +2,8 @@ package emby
 
 import (
 	"bytes"
+	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"io"
@@ -15,10 +17,14 @@ import (
 	"github.com/AmbitiousJun/go-emby2alist/internal/config"
 	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
 	"github.com/AmbitiousJun/go-emby2alist/internal/service/path"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/randoms"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
 
 	"github.com/gin-gonic/gin"
 )
@@ -33,53 +39,65 @@ const MediaSourceIdSegment = "[[_]]"
 // uri 中必须有 query 参数 MediaSourceId,
 // 如果没有携带该参数, 可能会请求到多个资源, 默认返回第一个资源
 func getEmbyFileLocalPath(itemInfo ItemInfo) (string, error) {
-	res, _ := Fetch(itemInfo.PlaybackInfoUri, http.MethodPost, nil, nil)
+	source, err := getEmbyMediaSource(itemInfo)
+	if err != nil {
+		return "", err
+	}
+	return source.Path, nil
+}
+
+// getEmbyMediaSource 获取 Emby 指定资源的 MediaSource 信息
+//
+// 匹配规则与 getEmbyFileLocalPath 一致
+func getEmbyMediaSource(itemInfo ItemInfo) (MediaSource, error) {
+	res, _ := Fetch(itemInfo.PlaybackInfoUri, http.MethodPost, https.MarkIdempotent(nil), nil)
 	if res.Code != http.StatusOK {
-		return "", fmt.Errorf("请求 Emby 接口异常, error: %s", res.Msg)
+		return MediaSource{}, apierr.New(apierr.UpstreamEmbyDown, "请求 Emby 接口异常, error: %s", res.Msg)
 	}
 	body := res.Data
 
-	mediaSources, ok := body.Attr("MediaSources").Done()
-	if !ok {
-		return "", fmt.Errorf("获取不到 MediaSources, 原始响应: %v", body)
+	var info PlaybackInfo
+	if err := body.To(&info); err != nil || len(info.MediaSources) == 0 {
+		return MediaSource{}, apierr.New(apierr.MediaSourceNotFound, "获取不到 MediaSources, 原始响应: %v", body)
 	}
 
-	var path string
-	var defaultPath string
+	var matched, defaultSource *MediaSource
+	var itemSourceFound bool
 
 	reqId, _ := url.QueryUnescape(itemInfo.MsInfo.RawId)
-	// 获取指定 MediaSourceId 的 Path
-	mediaSources.RangeArr(func(_ int, value *jsons.Item) error {
-		if strs.AnyEmpty(defaultPath) {
-			// 默认选择第一个路径
-			defaultPath, _ = value.Attr("Path").String()
+	// 获取指定 MediaSourceId 的 MediaSource
+	for i := range info.MediaSources {
+		source := &info.MediaSources[i]
+		if defaultSource == nil || (source.ItemId == itemInfo.Id && !itemSourceFound) {
+			// 默认选择第一个属于当前 item 的资源, 多分段资源中其他分段的资源不作为默认值
+			defaultSource = source
+			itemSourceFound = source.ItemId == itemInfo.Id
 		}
 		if itemInfo.MsInfo.Empty {
-			// 如果没有传递 MediaSourceId, 就使用默认的 Path
-			return jsons.ErrBreakRange
+			// 如果没有传递 MediaSourceId, 就使用默认的资源
+			break
 		}
 
-		curId, _ := url.QueryUnescape(value.Attr("Id").Val().(string))
+		curId, _ := url.QueryUnescape(source.Id)
 		if curId == reqId {
-			path, _ = value.Attr("Path").String()
-			return jsons.ErrBreakRange
+			matched = source
+			break
 		}
-		return nil
-	})
+	}
 
-	if strs.AllNotEmpty(path) {
-		return path, nil
+	if matched != nil && strs.AllNotEmpty(matched.Path) {
+		return *matched, nil
 	}
-	if strs.AllNotEmpty(defaultPath) {
-		return defaultPath, nil
+	if defaultSource != nil && strs.AllNotEmpty(defaultSource.Path) {
+		return *defaultSource, nil
 	}
-	return "", fmt.Errorf("获取不到 Path 参数, 原始响应: %v", body)
+	return MediaSource{}, apierr.New(apierr.MediaSourceNotFound, "获取不到 Path 参数, 原始响应: %v", body)
 }
 
 // findVideoPreviewInfos 查找 source 的所有转码资源
 //
-// 传递 resChan 进行异步查询, 通过监听 resChan 获取查询结果
-func findVideoPreviewInfos(source *jsons.Item, originName, clientApiKey string, resChan chan []*jsons.Item) {
+// 传递 resChan 进行异步查询, 通过监听 resChan 获取查询结果, ctx 决定使用的 alist 账号
+func findVideoPreviewInfos(ctx context.Context, source *jsons.Item, originName, clientApiKey string, resChan chan []*jsons.Item) {
 	if source == nil || source.Type() != jsons.JsonTypeObj {
 		resChan <- nil
 		return
@@ -90,7 +108,7 @@ func findVideoPreviewInfos(source *jsons.Item, originName, clientApiKey string,
 	var transcodingList, subtitleList *jsons.Item
 	firstFetchSuccess := false
 	if alistPathRes.Success {
-		res := alist.FetchFsOther(alistPathRes.Path, nil)
+		res := alist.FetchFsOther(ctx, alistPathRes.Path, nil)
 
 		if res.Code == http.StatusOK {
 			if list, ok := res.Data.Attr("video_preview_play_info").Attr("live_transcoding_task_list").Done(); ok {
@@ -118,7 +136,7 @@ func findVideoPreviewInfos(source *jsons.Item, originName, clientApiKey string,
 		}
 
 		for i := 0; i < len(paths); i++ {
-			res := alist.FetchFsOther(paths[i], nil)
+			res := alist.FetchFsOther(ctx, paths[i], nil)
 			if res.Code == http.StatusOK {
 				if list, ok := res.Data.Attr("video_preview_play_info").Attr("live_transcoding_task_list").Done(); ok {
 					transcodingList = list
@@ -140,7 +158,6 @@ func findVideoPreviewInfos(source *jsons.Item, originName, clientApiKey string,
 
 	res := make([]*jsons.Item, transcodingList.Len())
 	wg := sync.WaitGroup{}
-	itemId, _ := source.Attr("ItemId").String()
 	transcodingList.RangeArr(func(idx int, transcode *jsons.Item) error {
 		wg.Add(1)
 		go func() {
@@ -151,42 +168,24 @@ func findVideoPreviewInfos(source *jsons.Item, originName, clientApiKey string,
 				return
 			}
 
-			copySource := jsons.NewByVal(source.Struct())
 			templateWidth, _ := transcode.Attr("template_width").Int()
 			templateHeight, _ := transcode.Attr("template_height").Int()
 			format := fmt.Sprintf("%dx%d", templateWidth, templateHeight)
-			copySource.Attr("Name").Set(fmt.Sprintf("(%s_%s) %s", templateId, format, originName))
-
-			// 重要！！！这里的 id 必须和原本的 id 不一样, 但又要确保能够正常反推出原本的 id
-			newId := fmt.Sprintf(
-				"%s%s%s%s%s%s%s",
-				source.Attr("Id").Val(), MediaSourceIdSegment,
-				templateId, MediaSourceIdSegment,
-				format, MediaSourceIdSegment,
-				url.QueryEscape(alistPathRes.Path),
-			)
-			copySource.Attr("Id").Set(newId)
-
-			// 设置转码代理播放链接
-			tu, _ := url.Parse(strings.ReplaceAll(MasterM3U8UrlTemplate, "${itemId}", itemId))
-			q := tu.Query()
-			q.Set("alist_path", alistPathRes.Path)
-			q.Set("template_id", templateId)
-			q.Set(QueryApiKeyName, clientApiKey)
-			tu.RawQuery = q.Encode()
-
-			// 标记转码资源使用转码容器
-			copySource.Put("SupportsTranscoding", jsons.NewByVal(true))
-			copySource.Put("TranscodingContainer", jsons.NewByVal("ts"))
-			copySource.Put("TranscodingSubProtocol", jsons.NewByVal("hls"))
-			copySource.Put("TranscodingUrl", jsons.NewByVal(tu.String()))
-			copySource.DelKey("DirectStreamUrl")
-			copySource.Put("SupportsDirectPlay", jsons.NewByVal(false))
-			copySource.Put("SupportsDirectStream", jsons.NewByVal(false))
+			copySource := newPreviewSource(source, alistPathRes.Path, templateId, format, fmt.Sprintf("(%s_%s) %s", templateId, format, originName), clientApiKey)
+			annotatePreviewBitrate(copySource, templateHeight)
 
 			// 设置转码字幕
 			addSubtitles2MediaStreams(copySource, subtitleList, alistPathRes.Path, templateId, clientApiKey)
 
+			// 探测转码资源实际可用的音轨, 需要在添加字幕之后处理, 避免字幕的 Index 与已有的媒体流冲突
+			if playlistUrl, ok := transcode.Attr("url").String(); ok && config.C.VideoPreview.ProbeAudio {
+				if renditions, err := probePreviewAudio(ctx, playlistUrl); err == nil {
+					applyPreviewAudio(copySource, renditions)
+				} else {
+					logs.Debugf(colors.ToYellow("探测转码资源音轨失败, templateId: %s, err: %v"), templateId, err)
+				}
+			}
+
 			res[idx] = copySource
 		}()
 		return nil
@@ -205,6 +204,95 @@ func findVideoPreviewInfos(source *jsons.Item, originName, clientApiKey string,
 	resChan <- res
 }
 
+// newPreviewSource 根据原画资源生成一个使用转码代理播放的资源
+func newPreviewSource(source *jsons.Item, alistPath, templateId, format, name, clientApiKey string) *jsons.Item {
+	copySource := source.Clone()
+	itemId, _ := source.Attr("ItemId").String()
+	copySource.Attr("Name").Set(name)
+	labelSourceRange(source, copySource, true)
+
+	// 重要！！！这里的 id 必须和原本的 id 不一样, 但又要确保能够正常反推出原本的 id
+	newId := fmt.Sprintf(
+		"%s%s%s%s%s%s%s",
+		source.Attr("Id").Val(), MediaSourceIdSegment,
+		templateId, MediaSourceIdSegment,
+		format, MediaSourceIdSegment,
+		encodeMsAlistPath(alistPath),
+	)
+	copySource.Attr("Id").Set(newId)
+
+	// 设置转码代理播放链接
+	tu, _ := url.Parse(strings.ReplaceAll(MasterM3U8UrlTemplate, "${itemId}", itemId))
+	q := tu.Query()
+	q.Set("alist_path", alistPath)
+	q.Set("template_id", templateId)
+	q.Set(QueryApiKeyName, clientApiKey)
+	tu.RawQuery = q.Encode()
+
+	// 标记转码资源使用转码容器
+	copySource.Put("SupportsTranscoding", jsons.NewByVal(true))
+	copySource.Put("TranscodingContainer", jsons.NewByVal("ts"))
+	copySource.Put("TranscodingSubProtocol", jsons.NewByVal("hls"))
+	copySource.Put("TranscodingUrl", jsons.NewByVal(tu.String()))
+	copySource.DelKey("DirectStreamUrl")
+	copySource.Put("SupportsDirectPlay", jsons.NewByVal(false))
+	copySource.Put("SupportsDirectStream", jsons.NewByVal(false))
+	return copySource
+}
+
+// previewBitrates 转码清晰度的估算码率 (bps), 按照模板高度从小到大排列
+var previewBitrates = []struct {
+	height  int
+	bitrate int64
+}{
+	{360, 800_000},
+	{480, 1_200_000},
+	{540, 1_500_000},
+	{720, 2_500_000},
+	{1080, 5_000_000},
+	{1440, 9_000_000},
+	{2160, 16_000_000},
+}
+
+// estimatePreviewBitrate 根据转码模板的高度估算码率, 不超过原画码率
+func estimatePreviewBitrate(height int, originBitrate int64) int64 {
+	bitrate := previewBitrates[len(previewBitrates)-1].bitrate
+	for _, pb := range previewBitrates {
+		if height <= pb.height {
+			bitrate = pb.bitrate
+			break
+		}
+	}
+	if originBitrate > 0 && originBitrate < bitrate {
+		return originBitrate
+	}
+	return bitrate
+}
+
+// annotatePreviewBitrate 为转码资源填充估算的码率和大小, 便于客户端估算所需带宽
+//
+// 无法获取时长时移除 Size 属性, 避免客户端误用原画的文件大小
+func annotatePreviewBitrate(previewSource *jsons.Item, templateHeight int) {
+	origin, _ := jsonInt64(previewSource.Attr("Bitrate"))
+	bitrate := estimatePreviewBitrate(templateHeight, origin)
+	previewSource.Put("Bitrate", jsons.NewByVal(bitrate))
+
+	ticks, ok := jsonInt64(previewSource.Attr("RunTimeTicks"))
+	if !ok || ticks <= 0 {
+		previewSource.DelKey("Size")
+		return
+	}
+	previewSource.Put("Size", jsons.NewByVal(bitrate/8*(ticks/10_000_000)))
+}
+
+// jsonInt64 获取 json 中的整数值, 兼容解析时产生的 int 和 int64 类型
+func jsonInt64(ti *jsons.TempItem) (int64, bool) {
+	if v, ok := ti.Int(); ok {
+		return int64(v), true
+	}
+	return ti.Int64()
+}
+
 // addSubtitles2MediaStreams 添加转码字幕到 PlaybackInfo 的 MediaStreams 项中
 //
 // subtitleList 是请求 alist 转码信息接口获取到的字幕列表
@@ -256,20 +344,22 @@ func findMediaSourceName(source *jsons.Item) string {
 		return ""
 	}
 
-	mediaStreams, ok := source.Attr("MediaStreams").Done()
-	if !ok || mediaStreams.Type() != jsons.JsonTypeArr {
-		return source.Attr("Name").Val().(string)
-	}
-
-	idx := mediaStreams.FindIdx(func(val *jsons.Item) bool {
-		return val.Attr("Type").Val() == "Video"
-	})
-	if idx == -1 {
-		return source.Attr("Name").Val().(string)
+	if title, ok := source.QueryOne(videoStreamQuery + ".DisplayTitle"); ok {
+		if str, ok := title.Ti().String(); ok {
+			return str
+		}
 	}
-	return mediaStreams.Ti().Idx(idx).Attr("DisplayTitle").Val().(string)
+	name, _ := source.Attr("Name").String()
+	return name
 }
 
+const (
+	// videoStreamQuery 查询 MediaSource 中视频流的表达式
+	videoStreamQuery = "$.MediaStreams[?(@.Type=='Video')]"
+	// audioStreamQuery 查询 MediaSource 中音频流的表达式
+	audioStreamQuery = "$.MediaStreams[?(@.Type=='Audio')]"
+)
+
 // findMediaSourceRect 查找 MediaSource 中的宽高信息, 如 '1920 1080'
 //
 // 获取不到时返回零值
@@ -278,20 +368,13 @@ func findMediaSourceRect(source *jsons.Item) (width, height int) {
 		return
 	}
 
-	mediaStreams, ok := source.Attr("MediaStreams").Done()
-	if !ok || mediaStreams.Type() != jsons.JsonTypeArr {
-		return
-	}
-
-	idx := mediaStreams.FindIdx(func(val *jsons.Item) bool {
-		return val.Attr("Type").Val() == "Video"
-	})
-	if idx == -1 {
+	videoStream, ok := source.QueryOne(videoStreamQuery)
+	if !ok {
 		return
 	}
 
-	width, okW := mediaStreams.Ti().Idx(idx).Attr("Width").Int()
-	height, okH := mediaStreams.Ti().Idx(idx).Attr("Height").Int()
+	width, okW := videoStream.Attr("Width").Int()
+	height, okH := videoStream.Attr("Height").Int()
 	if okW && okH {
 		return
 	}
@@ -310,7 +393,7 @@ func resolveItemInfo(c *gin.Context) (ItemInfo, error) {
 	uri := c.Request.RequestURI
 	matches := itemIdRegex.FindStringSubmatch(uri)
 	if len(matches) < 2 {
-		return ItemInfo{}, fmt.Errorf("itemId 匹配失败, uri: %s", uri)
+		return ItemInfo{}, apierr.New(apierr.InvalidRequest, "itemId 匹配失败, uri: %s", uri)
 	}
 	itemInfo := ItemInfo{Id: matches[1]}
 
@@ -321,7 +404,7 @@ func resolveItemInfo(c *gin.Context) (ItemInfo, error) {
 
 	msInfo, err := resolveMediaSourceId(getRequestMediaSourceId(c))
 	if err != nil {
-		return ItemInfo{}, fmt.Errorf("解析 MediaSource 失败, uri: %s, err: %v", uri, err)
+		return ItemInfo{}, apierr.New(apierr.InvalidRequest, "解析 MediaSource 失败, uri: %s, err: %v", uri, err)
 	}
 	itemInfo.MsInfo = msInfo
 
@@ -354,6 +437,9 @@ func getRequestMediaSourceId(c *gin.Context) string {
 	if strs.AllNotEmpty(q) {
 		return q
 	}
+	if id, ok := parseLiveStreamId(c.Query("LiveStreamId")); ok {
+		return id
+	}
 
 	// 2 从请求体中获取
 	bodyBytes, err := io.ReadAll(c.Request.Body)
@@ -399,7 +485,11 @@ func resolveMediaSourceId(id string) (MsInfo, error) {
 		res.OriginId = segments[0]
 		res.TemplateId = segments[1]
 		res.Format = segments[2]
-		res.AlistPath = segments[3]
+		alistPath, err := decodeMsAlistPath(segments[3])
+		if err != nil {
+			return MsInfo{}, fmt.Errorf("MediaSourceId 格式错误: %s, err: %v", id, err)
+		}
+		res.AlistPath = alistPath
 		res.SourceNamePrefix = fmt.Sprintf("%s_%s", res.TemplateId, res.Format)
 		return res, nil
 	}
@@ -407,6 +497,31 @@ func resolveMediaSourceId(id string) (MsInfo, error) {
 	return MsInfo{}, errors.New("MediaSourceId 格式错误: " + id)
 }
 
+// encodeMsAlistPath 编码 MediaSourceId 中的 alist 路径
+//
+// 使用 url 安全的 base64 编码, 避免文件名中的 %, +, # 等特殊字符在客户端传递时被重复编码或解码
+func encodeMsAlistPath(alistPath string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(alistPath))
+}
+
+// decodeMsAlistPath 解码 MediaSourceId 中的 alist 路径
+//
+// 兼容旧版本使用 url 编码生成的 MediaSourceId, alist 路径总是以 / 开头,
+// 以 / 或 %2F 开头的片段按照旧版本的规则处理
+func decodeMsAlistPath(seg string) (string, error) {
+	if strings.HasPrefix(seg, "/") {
+		return seg, nil
+	}
+	if strings.HasPrefix(strings.ToUpper(seg), "%2F") {
+		return url.QueryUnescape(seg)
+	}
+	bytes, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return "", err
+	}
+	return string(bytes), nil
+}
+
 // getAllPreviewTemplateIds 获取所有转码格式
 //
 // 在配置文件中忽略的格式不会返回
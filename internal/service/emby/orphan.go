@@ -0,0 +1,170 @@
+package emby
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/path"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/pathmap"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+)
+
+// orphanCheckBatch 核对 item 是否存在时, 单次请求 emby 的 item 个数
+const orphanCheckBatch = 100
+
+// itemCacheSpaces 以 "itemId_" 开头作为 key 的缓存空间
+var itemCacheSpaces = []string{PlaybackCacheSpace, ChapterImageCacheSpace, HomeImageCacheSpace}
+
+// PurgeItem 清除已经从 emby 中删除的 item 残留的缓存, 返回清除的条数
+//
+// 包括各个缓存空间中的缓存, 路径映射缓存, 手动指定的路径, 延迟解析的转码清晰度和剧集固定的清晰度;
+// item 已经不存在, 无法再请求 emby 获取资源路径, 路径从 embyPaths 以及缓存的 PlaybackInfo 中获取
+func PurgeItem(itemId string, embyPaths ...string) int {
+	if strs.AnyEmpty(itemId) {
+		return 0
+	}
+	prefix := itemId + "_"
+	embyPaths = append(embyPaths, cachedItemPaths(itemId)...)
+
+	cnt := 0
+	for _, space := range itemCacheSpaces {
+		cnt += cache.PurgeSpaceFunc(space, func(spaceKey string) bool {
+			return strings.HasPrefix(spaceKey, prefix)
+		})
+	}
+
+	for _, embyPath := range embyPaths {
+		if strs.AnyEmpty(embyPath) || urls.IsRemote(embyPath) {
+			continue
+		}
+		alistPathRes := path.Emby2Alist(embyPath)
+		cnt += pathmap.Invalidate(alistPathRes.EmbyPath)
+		if alistPathRes.Success {
+			suffix := "|" + alistPathRes.Path
+			lazyTemplates.Range(func(key, _ any) bool {
+				if strings.HasSuffix(key.(string), suffix) {
+					lazyTemplates.Delete(key)
+					cnt++
+				}
+				return true
+			})
+		}
+	}
+
+	if pathmap.RemoveOverride(itemId) {
+		cnt++
+	}
+	if UnpinSeriesTemplate(itemId) {
+		cnt++
+	}
+	itemSeries.Delete(itemId)
+
+	if cnt > 0 {
+		log.Printf(colors.ToYellow("item [%s] 已从 emby 中删除, 清除残留的缓存 %d 条"), itemId, cnt)
+	}
+	return cnt
+}
+
+// ReconcileOrphans 核对缓存中记录的 item 是否仍然存在于 emby 中, 清除已经删除的 item 残留的缓存
+//
+// 返回清除的 item 个数, 请求 emby 失败的批次直接跳过, 不做清除
+func ReconcileOrphans() int {
+	ids := make(map[string]struct{})
+	for _, space := range itemCacheSpaces {
+		for _, spaceKey := range cache.SpaceKeys(space) {
+			if id, _, ok := strings.Cut(spaceKey, "_"); ok && id != "" {
+				ids[id] = struct{}{}
+			}
+		}
+	}
+	for _, o := range pathmap.Overrides() {
+		ids[o.ItemId] = struct{}{}
+	}
+	for _, pin := range SeriesPins() {
+		ids[pin.SeriesId] = struct{}{}
+	}
+	if len(ids) == 0 {
+		return 0
+	}
+
+	all := make([]string, 0, len(ids))
+	for id := range ids {
+		all = append(all, id)
+	}
+	purged := 0
+	for start := 0; start < len(all); start += orphanCheckBatch {
+		batch := all[start:min(start+orphanCheckBatch, len(all))]
+		exists, ok := fetchExistingItemIds(batch)
+		if !ok {
+			continue
+		}
+		for _, id := range batch {
+			if _, ok := exists[id]; !ok {
+				PurgeItem(id)
+				purged++
+			}
+		}
+	}
+	logs.Debugf(colors.ToBlue("核对缓存中的 item 完成, 个数: %d, 已删除: %d"), len(all), purged)
+	return purged
+}
+
+// fetchExistingItemIds 请求 emby 获取 ids 中仍然存在的 item
+func fetchExistingItemIds(ids []string) (map[string]struct{}, bool) {
+	q := url.Values{}
+	q.Set("Ids", strings.Join(ids, ","))
+	q.Set("Recursive", "true")
+	res, _ := Fetch("/emby/Items?"+q.Encode(), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		log.Printf(colors.ToYellow("核对 item 是否存在失败: %s"), res.Msg)
+		return nil, false
+	}
+	exists := make(map[string]struct{}, len(ids))
+	items, ok := res.Data.Attr("Items").Done()
+	if !ok || items.Type() != jsons.JsonTypeArr {
+		log.Printf(colors.ToYellow("核对 item 是否存在失败: emby 响应异常"))
+		return nil, false
+	}
+	items.RangeArr(func(_ int, item *jsons.Item) error {
+		if id, ok := item.Attr("Id").String(); ok {
+			exists[id] = struct{}{}
+		}
+		return nil
+	})
+	return exists, true
+}
+
+// cachedItemPaths 从缓存的 PlaybackInfo 中获取 item 所有资源的 emby 路径
+func cachedItemPaths(itemId string) []string {
+	prefix := itemId + "_"
+	res := make([]string, 0)
+	for _, spaceKey := range cache.SpaceKeys(PlaybackCacheSpace) {
+		if !strings.HasPrefix(spaceKey, prefix) {
+			continue
+		}
+		rc, ok := cache.GetSpaceCache(PlaybackCacheSpace, spaceKey)
+		if !ok {
+			continue
+		}
+		body, err := rc.JsonBody()
+		if err != nil {
+			continue
+		}
+		paths, _ := body.Query("$.MediaSources[*].Path")
+		for _, p := range paths {
+			if s, ok := p.Ti().String(); ok {
+				res = append(res, s)
+			}
+		}
+		// 同一个 item 的不同 api key 缓存的资源相同, 取一份即可
+		break
+	}
+	return res
+}
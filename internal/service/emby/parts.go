@@ -0,0 +1,58 @@
+package emby
+
+import (
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// partSourcesQuery 查询附加分段列表中所有 MediaSource 的表达式
+const partSourcesQuery = "$.Items[*].MediaSources[*]"
+
+// TransferAdditionalParts 代理多分段 (part1/part2) 资源的附加分段列表接口
+//
+// 每个分段都是一个独立的 item, 将分段的 MediaSource 改写为直链播放地址,
+// 使客户端切换分段时同样走直链
+func TransferAdditionalParts(c *gin.Context) {
+	_, apiKey := getApiKey(c)
+	if apiKey == "" {
+		apiKey = config.C.Emby.ApiKey
+	}
+
+	checkErr(c, https.ProxyRequestWithHook(c, config.C.Emby.Host, true, https.JsonHook(func(body *jsons.Item) error {
+		sources, err := body.Query(partSourcesQuery)
+		if err != nil {
+			return err
+		}
+		for _, source := range sources {
+			rewritePartSource(source, apiKey)
+		}
+		logs.Debugf(colors.ToBlue("附加分段的 MediaSource 已改写为直链, 个数: %d"), len(sources))
+		return nil
+	})))
+}
+
+// rewritePartSource 将分段的 MediaSource 改写为直链播放地址
+func rewritePartSource(source *jsons.Item, apiKey string) {
+	if ir, _ := source.Attr("IsRemote").Bool(); ir {
+		return
+	}
+	if iis, _ := source.Attr("IsInfiniteStream").Bool(); iis {
+		return
+	}
+	if keepAudioTranscoding(source) {
+		return
+	}
+
+	itemId, _ := source.Attr("ItemId").String()
+	if itemId == "" {
+		return
+	}
+	source.Put("SupportsDirectPlay", jsons.NewByVal(true))
+	source.Put("SupportsDirectStream", jsons.NewByVal(true))
+	source.Put("DirectStreamUrl", jsons.NewByVal(directStreamUrl(source, itemId, apiKey)))
+}
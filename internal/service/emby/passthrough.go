@@ -0,0 +1,95 @@
+package emby
+
+import (
+	"log"
+	"net/http"
+	"sync"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/updater"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// passthroughLogged 已经输出过直通日志的 客户端/版本, 避免每个请求都输出
+var passthroughLogged = sync.Map{}
+
+// ClientPassthrough 客户端直通中间件
+//
+// 请求来自 client-passthrough 配置的客户端版本时, 不经过任何改写逻辑, 原样转发到源服务器
+func ClientPassthrough() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules := config.C.ClientPassthrough.Rules
+		if len(rules) == 0 {
+			return
+		}
+
+		client, version := requestClient(c), requestClientVersion(c)
+		rule := matchPassthroughRule(rules, client, version)
+		if rule == nil {
+			return
+		}
+
+		if _, logged := passthroughLogged.LoadOrStore(client+"/"+version, struct{}{}); !logged {
+			log.Printf(colors.ToYellow("客户端 [%s %s] 命中直通规则, 请求将原样转发到源服务器, 原因: %s"), client, version, rule.Reason)
+		}
+		logs.Debugf("客户端直通: %s", c.Request.RequestURI)
+
+		c.Abort()
+		if err := https.ProxyRequest(c, config.C.Emby.Host, true); err != nil {
+			log.Printf(colors.ToRed("客户端直通代理异常: %v"), err)
+			if !c.Writer.Written() {
+				apierr.Respond(c, http.StatusBadGateway, apierr.UpstreamEmbyDown, "源服务器不可用, 请检查日志")
+			}
+		}
+	}
+}
+
+// matchPassthroughRule 获取客户端版本匹配的第一条直通规则, 不匹配时返回 nil
+//
+// 规则配置了版本范围而客户端没有上报版本时, 视为不匹配
+func matchPassthroughRule(rules []*config.ClientPassthroughRule, client, version string) *config.ClientPassthroughRule {
+	for _, rule := range rules {
+		if !rule.Match(client) {
+			continue
+		}
+		constraints := rule.Constraints()
+		if len(constraints) > 0 && version == "" {
+			continue
+		}
+		ok := true
+		for _, cons := range constraints {
+			if !versionSatisfies(version, cons) {
+				ok = false
+				break
+			}
+		}
+		if ok {
+			return rule
+		}
+	}
+	return nil
+}
+
+// versionSatisfies 判断版本号是否满足约束
+func versionSatisfies(version string, cons config.VersionConstraint) bool {
+	cmp := updater.CompareVersion(version, cons.Version)
+	switch cons.Op {
+	case ">=":
+		return cmp >= 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	case "<":
+		return cmp < 0
+	case "!=":
+		return cmp != 0
+	default:
+		return cmp == 0
+	}
+}
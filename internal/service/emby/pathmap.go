@@ -0,0 +1,112 @@
+package emby
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/path"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/pathmap"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+)
+
+// PathMapping item 中单个资源的路径映射缓存
+type PathMapping struct {
+	MediaSourceId string          // 资源 id
+	EmbyPath      string          // 资源在 emby 中的路径
+	Override      string          // 手动指定的 alist 路径, 为空表示未指定
+	Entries       []pathmap.Entry // 每个 alist 账号下缓存的映射结果
+}
+
+// ItemPathMappings 获取 item 所有资源的路径映射缓存
+func ItemPathMappings(itemId string) ([]PathMapping, error) {
+	sources, err := fetchItemSources(itemId)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]PathMapping, 0, len(sources))
+	for _, source := range sources {
+		if urls.IsRemote(source.Path) {
+			continue
+		}
+		embyPath := path.Emby2Alist(source.Path).EmbyPath
+		override, _ := pathmap.GetOverride(embyPath)
+		res = append(res, PathMapping{MediaSourceId: source.Id, EmbyPath: embyPath, Override: override, Entries: pathmap.Lookup(embyPath)})
+	}
+	return res, nil
+}
+
+// InvalidateItemPathMappings 清除 item 所有资源的路径映射缓存, 返回清除的条数
+func InvalidateItemPathMappings(itemId string) (int, error) {
+	sources, err := fetchItemSources(itemId)
+	if err != nil {
+		return 0, err
+	}
+	cnt := 0
+	for _, source := range sources {
+		if !urls.IsRemote(source.Path) {
+			cnt += pathmap.Invalidate(path.Emby2Alist(source.Path).EmbyPath)
+		}
+	}
+	return cnt, nil
+}
+
+// OverrideItemPath 手动指定 item 资源的 alist 路径, 指定之前校验路径在 alist 中是否存在
+//
+// item 存在多个资源时需要通过 mediaSourceId 指定资源, 否则使用第一个本地资源
+func OverrideItemPath(itemId, mediaSourceId, alistPath string) (pathmap.Override, error) {
+	sources, err := fetchItemSources(itemId)
+	if err != nil {
+		return pathmap.Override{}, err
+	}
+	var target *MediaSource
+	for i, source := range sources {
+		if urls.IsRemote(source.Path) || (mediaSourceId != "" && source.Id != mediaSourceId) {
+			continue
+		}
+		target = &sources[i]
+		break
+	}
+	if target == nil {
+		return pathmap.Override{}, fmt.Errorf("item 中没有可以指定路径的资源: %s", itemId)
+	}
+
+	if res := alist.FetchFsGet(context.Background(), alistPath, nil); res.Code != http.StatusOK {
+		return pathmap.Override{}, fmt.Errorf("alist 路径不可用: %s, err: %s", alistPath, res.Msg)
+	}
+	o := pathmap.Override{
+		ItemId:    itemId,
+		EmbyPath:  path.Emby2Alist(target.Path).EmbyPath,
+		AlistPath: alistPath,
+		CreatedAt: time.Now(),
+	}
+	if err := pathmap.SetOverride(o); err != nil {
+		return pathmap.Override{}, err
+	}
+	return o, nil
+}
+
+// fetchItemSources 请求 emby 获取 item 的所有资源
+func fetchItemSources(itemId string) ([]MediaSource, error) {
+	q := url.Values{}
+	q.Set("Ids", itemId)
+	q.Set("Fields", "MediaSources,Path")
+	res, _ := Fetch("/emby/Items?"+q.Encode(), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return nil, fmt.Errorf("请求 emby 失败: %s", res.Msg)
+	}
+
+	var body struct {
+		Items []struct{ MediaSources []MediaSource }
+	}
+	if err := res.Data.To(&body); err != nil {
+		return nil, fmt.Errorf("解析 emby 响应失败: %v", err)
+	}
+	if len(body.Items) == 0 {
+		return nil, fmt.Errorf("item 不存在: %s", itemId)
+	}
+	return body.Items[0].MediaSources, nil
+}
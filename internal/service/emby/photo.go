@@ -0,0 +1,69 @@
+package emby
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/path"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RedirectPhotoOriginal 处理图片原图请求
+//
+// 如果请求的是照片库中的 item, 通过 alist 解析原始文件的直链并重定向,
+// 其余图片 (海报, 背景图等) 仍然交由源服务器处理
+func RedirectPhotoOriginal(c *gin.Context) {
+	matches := itemIdRegex.FindStringSubmatch(c.Request.URL.Path)
+	if len(matches) < 2 {
+		HandleImages(c)
+		return
+	}
+	itemId := matches[1]
+
+	embyPath, err := getEmbyPhotoPath(itemId)
+	if err != nil {
+		log.Printf(colors.ToYellow("非照片 item, 交由源服务器处理: %v"), err)
+		HandleImages(c)
+		return
+	}
+	if urls.IsRemote(embyPath) {
+		HandleImages(c)
+		return
+	}
+
+	logs.Debugf(colors.ToBlue("解析照片原图直链, itemId: %s, path: %s"), itemId, embyPath)
+	resolveDirectLink(c, embyPath, path.Emby2Alist(embyPath), false)
+}
+
+// getEmbyPhotoPath 查询照片 item 在 Emby 中的 Path 参数
+//
+// item 不是照片时返回错误
+func getEmbyPhotoPath(itemId string) (string, error) {
+	q := url.Values{}
+	q.Set("Ids", itemId)
+	q.Set("Fields", "Path,MediaType")
+	res, _ := Fetch("/Items?"+q.Encode(), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return "", fmt.Errorf("请求 Emby 接口异常, error: %s", res.Msg)
+	}
+
+	item, ok := res.Data.Attr("Items").Idx(0).Done()
+	if !ok {
+		return "", fmt.Errorf("找不到 item: %s", itemId)
+	}
+	if mediaType, _ := item.Attr("MediaType").String(); mediaType != "Photo" {
+		return "", fmt.Errorf("item 类型不是照片: %s", mediaType)
+	}
+	itemPath, ok := item.Attr("Path").String()
+	if !ok || strs.AnyEmpty(itemPath) {
+		return "", fmt.Errorf("获取不到 Path 参数, itemId: %s", itemId)
+	}
+	return itemPath, nil
+}
@@ -0,0 +1,182 @@
+package emby
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/store"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// SeriesPin 剧集固定使用的转码清晰度
+type SeriesPin struct {
+	SeriesId   string    // 剧集 id
+	TemplateId string    // 固定的转码清晰度, 如: FHD
+	Format     string    // 清晰度的格式, 如: 1920x1080, 首次获取到该清晰度时记录, 为空表示还未获取到
+	CreatedAt  time.Time // 固定时间
+}
+
+var (
+	// seriesPins 剧集 id => 固定的转码清晰度
+	seriesPins map[string]*SeriesPin
+	// seriesPinsMu 并发控制
+	seriesPinsMu sync.RWMutex
+	// seriesPinsOnce 首次使用时从存储中加载
+	seriesPinsOnce sync.Once
+)
+
+// PinSeriesTemplate 固定剧集使用的转码清晰度, 剧集之前固定的清晰度会被替换
+//
+// seriesId 也可以传递剧集中的单集 id, 会自动转换为所属的剧集
+func PinSeriesTemplate(seriesId, templateId string) (SeriesPin, error) {
+	templateId = strings.TrimSpace(templateId)
+	if strs.AnyEmpty(seriesId, templateId) {
+		return SeriesPin{}, errors.New("剧集 id 和清晰度不能为空")
+	}
+	if templateId == LazyTemplateId || config.C.VideoPreview.IsTemplateIgnore(templateId) {
+		return SeriesPin{}, fmt.Errorf("清晰度 [%s] 不可用, 请检查 video-preview.ignore-template-ids 配置", templateId)
+	}
+	if id := getItemSeriesId(seriesId); id != "" {
+		seriesId = id
+	}
+
+	loadSeriesPins()
+	seriesPinsMu.Lock()
+	defer seriesPinsMu.Unlock()
+	pin := &SeriesPin{SeriesId: seriesId, TemplateId: templateId, CreatedAt: time.Now()}
+	if old, ok := seriesPins[seriesId]; ok && strings.EqualFold(old.TemplateId, templateId) {
+		pin.Format = old.Format
+	}
+	if err := store.Default().Put(store.BucketSeriesPins, seriesId, pin); err != nil {
+		return SeriesPin{}, err
+	}
+	seriesPins[seriesId] = pin
+	return *pin, nil
+}
+
+// UnpinSeriesTemplate 移除剧集固定的转码清晰度, 不存在时返回 false
+func UnpinSeriesTemplate(seriesId string) bool {
+	loadSeriesPins()
+	seriesPinsMu.Lock()
+	defer seriesPinsMu.Unlock()
+	if _, ok := seriesPins[seriesId]; !ok {
+		return false
+	}
+	delete(seriesPins, seriesId)
+	store.Default().Delete(store.BucketSeriesPins, seriesId)
+	return true
+}
+
+// SeriesPins 获取所有剧集固定的转码清晰度, 按照固定时间排列
+func SeriesPins() []SeriesPin {
+	loadSeriesPins()
+	seriesPinsMu.RLock()
+	defer seriesPinsMu.RUnlock()
+	res := make([]SeriesPin, 0, len(seriesPins))
+	for _, pin := range seriesPins {
+		res = append(res, *pin)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreatedAt.Before(res[j].CreatedAt) })
+	return res
+}
+
+// itemSeriesPin 获取 item 所属剧集固定的转码清晰度
+//
+// 没有任何剧集固定清晰度时直接返回, 不查询 item 所属的剧集
+func itemSeriesPin(itemId string) (SeriesPin, bool) {
+	loadSeriesPins()
+	seriesPinsMu.RLock()
+	empty := len(seriesPins) == 0
+	seriesPinsMu.RUnlock()
+	if empty {
+		return SeriesPin{}, false
+	}
+
+	seriesId := getItemSeriesId(itemId)
+	seriesPinsMu.RLock()
+	defer seriesPinsMu.RUnlock()
+	pin, ok := seriesPins[seriesId]
+	if !ok {
+		return SeriesPin{}, false
+	}
+	return *pin, true
+}
+
+// pinnedPreviewSource 使用剧集固定的清晰度直接生成转码资源, 不请求 alist
+//
+// 清晰度的格式还未记录时返回 nil, 需要先完整获取一次转码资源
+func pinnedPreviewSource(account string, source *jsons.Item, originName, clientApiKey string, pin SeriesPin) *jsons.Item {
+	var width, height int
+	if _, err := fmt.Sscanf(pin.Format, "%dx%d", &width, &height); err != nil {
+		return nil
+	}
+	alistPath := previewAlistPath(account, source)
+	if alistPath == "" {
+		return nil
+	}
+	copySource := newPreviewSource(source, alistPath, pin.TemplateId, pin.Format, fmt.Sprintf("(%s_%s) %s", pin.TemplateId, pin.Format, originName), clientApiKey)
+	annotatePreviewBitrate(copySource, height)
+	return copySource
+}
+
+// findPinnedPreviewInfos 完整获取一次 source 的转码资源, 只保留剧集固定的清晰度, 并记录清晰度的格式
+//
+// 固定的清晰度不可用时, 返回所有的转码资源
+func findPinnedPreviewInfos(ctx context.Context, source *jsons.Item, originName, clientApiKey string, pin SeriesPin, resChan chan []*jsons.Item) {
+	allChan := make(chan []*jsons.Item, 1)
+	findVideoPreviewInfos(ctx, source, originName, clientApiKey, allChan)
+	all := <-allChan
+	for _, previewSource := range all {
+		id, _ := previewSource.Attr("Id").String()
+		msInfo, err := resolveMediaSourceId(id)
+		if err != nil || !strings.EqualFold(msInfo.TemplateId, pin.TemplateId) {
+			continue
+		}
+		recordSeriesPinTemplate(pin.SeriesId, msInfo.TemplateId, msInfo.Format)
+		resChan <- []*jsons.Item{previewSource}
+		return
+	}
+	if len(all) > 0 {
+		log.Printf(colors.ToYellow("剧集 [%s] 固定的清晰度 [%s] 不可用, 返回所有的转码资源"), pin.SeriesId, pin.TemplateId)
+	}
+	resChan <- all
+}
+
+// recordSeriesPinTemplate 记录 alist 返回的清晰度 id 和格式, 之后的单集不再请求 alist
+func recordSeriesPinTemplate(seriesId, templateId, format string) {
+	seriesPinsMu.Lock()
+	defer seriesPinsMu.Unlock()
+	pin, ok := seriesPins[seriesId]
+	if !ok || !strings.EqualFold(pin.TemplateId, templateId) || (pin.TemplateId == templateId && pin.Format == format) {
+		return
+	}
+	pin.TemplateId, pin.Format = templateId, format
+	if err := store.Default().Put(store.BucketSeriesPins, seriesId, pin); err != nil {
+		log.Printf(colors.ToRed("保存剧集固定的清晰度失败: %v"), err)
+	}
+}
+
+// loadSeriesPins 从存储中加载所有剧集固定的转码清晰度
+func loadSeriesPins() {
+	seriesPinsOnce.Do(func() {
+		seriesPins = make(map[string]*SeriesPin)
+		s := store.Default()
+		for _, seriesId := range s.Keys(store.BucketSeriesPins) {
+			var pin SeriesPin
+			if _, err := s.Get(store.BucketSeriesPins, seriesId, &pin); err != nil {
+				log.Printf(colors.ToYellow("加载剧集固定的清晰度失败, 剧集: %s, err: %v"), seriesId, err)
+				continue
+			}
+			seriesPins[seriesId] = &pin
+		}
+	})
+}
@@ -2,6 +2,7 @@ package emby
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"io"
@@ -13,9 +14,13 @@ import (
 	"time"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/feature"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/schema"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
 	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
 
 	"github.com/gin-gonic/gin"
@@ -26,6 +31,12 @@ const (
 	// PlaybackCacheSpace PlaybackInfo 的缓存空间 key
 	PlaybackCacheSpace = "PlaybackInfo"
 
+	// latePreviewWaitTimeout 后台等待超时转码资源的最长时间
+	latePreviewWaitTimeout = time.Minute
+
+	// latePreviewCacheRetries 等待 PlaybackInfo 缓存写入的重试次数, 每次间隔 500ms
+	latePreviewCacheRetries = 10
+
 	// MasterM3U8UrlTemplate 转码 m3u8 地址模板
 	MasterM3U8UrlTemplate = `/videos/${itemId}/master.m3u8?DeviceId=a690fc29-1f3e-423b-ba23-f03049361a3b\u0026MediaSourceId=83ed6e4e3d820864a3d07d2ef9efab2e\u0026PlaySessionId=9f01e60a22c74ad0847319175912663b\u0026api_key=f53f3bf34c0543ed81415b86576058f2\u0026LiveStreamId=06044cf0e6f93cdae5f285c9ecfaaeb4_01413a525b3a9622ce6fdf19f7dde354_83ed6e4e3d820864a3d07d2ef9efab2e\u0026VideoCodec=h264,h265,hevc,av1\u0026AudioCodec=mp3,aac\u0026VideoBitrate=6808000\u0026AudioBitrate=192000\u0026AudioStreamIndex=1\u0026TranscodingMaxAudioChannels=2\u0026SegmentContainer=ts\u0026MinSegments=1\u0026BreakOnNonKeyFrames=True\u0026SubtitleStreamIndexes=-1\u0026ManifestSubtitles=vtt\u0026h264-profile=high,main,baseline,constrainedbaseline,high10\u0026h264-level=62\u0026hevc-codectag=hvc1,hev1,hevc,hdmv`
 
@@ -44,13 +55,33 @@ var (
 
 // TransferPlaybackInfo 代理 PlaybackInfo 接口, 防止客户端转码
 func TransferPlaybackInfo(c *gin.Context) {
+	if !feature.Enabled(feature.PlaybackInfo) {
+		ProxyOrigin(c)
+		return
+	}
+
 	// 1 解析资源信息
 	itemInfo, err := resolveItemInfo(c)
-	log.Printf(colors.ToBlue("ItemInfo 解析结果: %s"), jsons.NewByVal(itemInfo))
+	logs.Debugf(colors.ToBlue("ItemInfo 解析结果: %s"), jsons.NewByVal(itemInfo))
 	if checkErr(c, err) {
 		return
 	}
 
+	// 演练模式, 原样返回源服务器的响应
+	if config.C.Emby.DryRun {
+		dryRunPlaybackInfo(c, itemInfo)
+		return
+	}
+
+	// 带有强制回源标签的 item, 原样代理到源服务器
+	policy := itemTagPolicy(itemInfo.Id)
+	if policy.forceOrigin {
+		logs.Debugf(colors.ToBlue("item [%s] 带有强制回源标签, 不改写 PlaybackInfo"), itemInfo.Id)
+		c.Header(cache.HeaderKeyExpired, "-1")
+		ProxyOrigin(c)
+		return
+	}
+
 	// 如果是远程资源, 直接代理到源服务器
 	if handleRemotePlayback(c, itemInfo) {
 		c.Header(cache.HeaderKeyExpired, "-1")
@@ -65,10 +96,13 @@ func TransferPlaybackInfo(c *gin.Context) {
 	}
 
 	// 2 请求 emby 源服务器的 PlaybackInfo 信息
+	autoOpen := autoOpenLiveStream(c)
 	c.Request.Header.Del("Accept-Encoding")
 	originRequestBody := c.Request.Body
 	c.Request.Body = io.NopCloser(bytes.NewBufferString(PlaybackCommonPayload))
-	res, respHeader := RawFetch(itemInfo.PlaybackInfoUri, c.Request.Method, c.Request.Header, c.Request.Body)
+	start := time.Now()
+	res, respHeader := RawFetchCtx(c.Request.Context(), itemInfo.PlaybackInfoUri, c.Request.Method, c.Request.Header, c.Request.Body)
+	https.RecordUpstream(c, "emby", time.Since(start))
 	if res.Code != http.StatusOK {
 		checkErr(c, errors.New(res.Msg))
 		return
@@ -76,18 +110,28 @@ func TransferPlaybackInfo(c *gin.Context) {
 
 	// 3 处理 JSON 响应
 	resJson := res.Data
-	mediaSources, ok := resJson.Attr("MediaSources").Done()
-	if !ok || mediaSources.Type() != jsons.JsonTypeArr {
-		checkErr(c, errors.New("获取不到 MediaSources 属性"))
+	if checkErr(c, schema.Check(schema.PlaybackInfo, resJson)) {
+		return
 	}
+	mediaSources, _ := resJson.Attr("MediaSources").Done()
 
 	if mediaSources.Empty() {
 		log.Println(colors.ToYellow("没有找到可播放的资源"))
-		c.JSON(res.Code, resJson.Struct())
+		c.JSON(res.Code, resJson)
 		return
 	}
 
-	log.Printf(colors.ToBlue("获取到的 MediaSources 个数: %d"), mediaSources.Len())
+	// 无法渲染特效字幕的客户端, 使用客户端原始的请求代理到源服务器, 由 emby 烧录字幕
+	if keepSubtitleBurnIn(c, mediaSources) {
+		c.Request.Body = originRequestBody
+		c.Header(cache.HeaderKeyExpired, "-1")
+		ProxyOrigin(c)
+		return
+	}
+
+	logs.Debugf(colors.ToBlue("获取到的 MediaSources 个数: %d"), mediaSources.Len())
+	// 受分辨率限制的用户需要知道每个转码资源的清晰度, 不使用占位资源
+	limited := resolutionLimited(requestUser(c))
 	var haveReturned = errors.New("have returned")
 	resChans := make([]chan []*jsons.Item, 0)
 	err = mediaSources.RangeArr(func(_ int, source *jsons.Item) error {
@@ -105,15 +149,27 @@ func TransferPlaybackInfo(c *gin.Context) {
 			return haveReturned
 		}
 
+		// 客户端无法直接播放的音频格式, 保留 emby 的转码配置
+		if keepAudioTranscoding(source) {
+			logs.Debugln(colors.ToBlue("音频格式无法直接播放, 保留转码配置"))
+			return nil
+		}
+
+		// 原盘资源配置了回源策略, 保留 emby 的转码配置
+		if keepDiscTranscoding(source) {
+			logs.Debugln(colors.ToBlue("原盘资源使用回源策略, 保留转码配置"))
+			return nil
+		}
+
 		// 转换直链链接
 		source.Put("SupportsDirectPlay", jsons.NewByVal(true))
 		source.Put("SupportsDirectStream", jsons.NewByVal(true))
-		newUrl := fmt.Sprintf(
-			"/videos/%s/stream?MediaSourceId=%s&%s=%s&Static=true",
-			itemInfo.Id, source.Attr("Id").Val(), QueryApiKeyName, itemInfo.ApiKey,
-		)
+		newUrl := directStreamUrl(source, itemInfo.Id, itemInfo.ApiKey)
+		if IsLegacyClient(c) {
+			newUrl = ShortenUrl(newUrl)
+		}
 		source.Put("DirectStreamUrl", jsons.NewByVal(newUrl))
-		log.Printf(colors.ToBlue("设置直链播放链接为: %s"), newUrl)
+		logs.Debugf(colors.ToBlue("设置直链播放链接为: %s"), newUrl)
 
 		// 简化资源名称
 		name := findMediaSourceName(source)
@@ -122,12 +178,13 @@ func TransferPlaybackInfo(c *gin.Context) {
 		}
 		name = source.Attr("Name").Val().(string)
 		source.Attr("Name").Set(fmt.Sprintf("(原画) %s", name))
+		labelSourceRange(source, source, false)
 
 		source.Put("SupportsTranscoding", jsons.NewByVal(false))
 		source.DelKey("TranscodingUrl")
 		source.DelKey("TranscodingSubProtocol")
 		source.DelKey("TranscodingContainer")
-		log.Println(colors.ToBlue("转码配置被移除"))
+		logs.Debugln(colors.ToBlue("转码配置被移除"))
 
 		// 如果是远程资源, 不获取转码地址
 		ir, _ := source.Attr("IsRemote").Bool()
@@ -135,13 +192,38 @@ func TransferPlaybackInfo(c *gin.Context) {
 			return nil
 		}
 
+		// 预加载进度条预览图
+		if sourceId, ok := source.Attr("Id").String(); ok {
+			prefetchTrickplay(itemInfo.Id, sourceId, itemInfo.ApiKey)
+		}
+
 		// 添加转码 MediaSource 获取
 		cfg := config.C.VideoPreview
-		if !msInfo.Empty || !cfg.Enable || !cfg.ContainerValid(source.Attr("Container").Val().(string)) {
+		if !msInfo.Empty || !cfg.Enable || policy.noPreview || !cfg.ContainerValid(source.Attr("Container").Val().(string)) {
 			return nil
 		}
 		resChan := make(chan []*jsons.Item, 1)
-		go findVideoPreviewInfos(source, name, itemInfo.ApiKey, resChan)
+		if pin, ok := itemSeriesPin(itemInfo.Id); ok && !limited {
+			// 剧集固定了转码清晰度, 只返回固定的清晰度, 记录了清晰度格式之后不再请求 alist
+			if pinned := pinnedPreviewSource(AlistAccount(c), source, name, itemInfo.ApiKey, pin); pinned != nil {
+				resChan <- []*jsons.Item{pinned}
+			} else {
+				go findPinnedPreviewInfos(alistCtx(c, context.Background()), source, name, itemInfo.ApiKey, pin, resChan)
+			}
+			resChans = append(resChans, resChan)
+			return nil
+		}
+		if cfg.Lazy && !limited {
+			// 只返回占位资源, 客户端选择播放时再获取转码清晰度
+			if lazy := lazyPreviewSource(AlistAccount(c), source, name, itemInfo.ApiKey); lazy != nil {
+				resChan <- []*jsons.Item{lazy}
+			} else {
+				resChan <- nil
+			}
+			resChans = append(resChans, resChan)
+			return nil
+		}
+		go findVideoPreviewInfos(alistCtx(c, context.Background()), source, name, itemInfo.ApiKey, resChan)
 		resChans = append(resChans, resChan)
 		return nil
 	})
@@ -158,18 +240,40 @@ func TransferPlaybackInfo(c *gin.Context) {
 		c.Header(cache.HeaderKeySpaceKey, calcPlaybackInfoSpaceCacheKey(itemInfo))
 	}()
 
-	// 收集异步请求的转码资源信息
+	// 收集异步请求的转码资源信息, 超时未返回的请求不再等待
+	collectCtx, cancel := context.WithTimeout(context.Background(), config.C.VideoPreview.CollectTimeoutDuration())
+	defer cancel()
+	lateChans := make([]chan []*jsons.Item, 0)
 	for _, resChan := range resChans {
-		previewInfos := <-resChan
-		if len(previewInfos) > 0 {
-			log.Printf(colors.ToGreen("找到 %d 个转码资源信息"), len(previewInfos))
-			mediaSources.Append(previewInfos...)
+		select {
+		case previewInfos := <-resChan:
+			if len(previewInfos) > 0 {
+				log.Printf(colors.ToGreen("找到 %d 个转码资源信息"), len(previewInfos))
+				mediaSources.Append(previewInfos...)
+			}
+		case <-collectCtx.Done():
+			lateChans = append(lateChans, resChan)
 		}
 	}
+	if len(lateChans) > 0 {
+		log.Printf(colors.ToYellow("%d 个原画资源的转码信息获取超时, 先返回已获取到的资源"), len(lateChans))
+		go appendLatePreviews(itemInfo, requestUser(c), sessionDevice(c), autoOpen, lateChans)
+	}
+
+	// 改写之后源服务器的 LiveStream 不再可用, 由本程序维护
+	applyLiveStreams(c, itemInfo, mediaSources, autoOpen)
+
+	// 隐藏超出用户分辨率限制的资源
+	applyMaxResolution(c, itemInfo, resJson)
+
+	// 低带宽用户默认使用转码资源, 用户在当前剧集中习惯选择的资源优先, 播放失败降级的原画资源不作为默认资源
+	applyDefaultPreview(c, itemInfo, resJson)
+	applySourceChoice(c, itemInfo, resJson)
+	applySourceFallback(c, itemInfo, resJson)
 
 	respHeader.Del("Content-Length")
 	https.CloneHeader(c, respHeader)
-	c.JSON(res.Code, resJson.Struct())
+	c.JSON(res.Code, resJson)
 }
 
 // handleRemotePlayback 判断如果请求的 PlaybackInfo 信息是远程地址, 直接返回结果
@@ -182,7 +286,7 @@ func handleRemotePlayback(c *gin.Context, itemInfo ItemInfo) bool {
 	c.Request.Header.Del("Accept-Encoding")
 	originRequestBody := c.Request.Body
 	c.Request.Body = io.NopCloser(bytes.NewBufferString(PlaybackCommonPayload))
-	res, _ := RawFetch(itemInfo.PlaybackInfoUri, c.Request.Method, c.Request.Header, c.Request.Body)
+	res, _ := RawFetchCtx(c.Request.Context(), itemInfo.PlaybackInfoUri, c.Request.Method, c.Request.Header, c.Request.Body)
 	if res.Code != http.StatusOK {
 		return false
 	}
@@ -286,7 +390,7 @@ func useCacheSpacePlaybackInfo(c *gin.Context, itemInfo ItemInfo) bool {
 		newHeader := spaceCache.Headers()
 		newHeader.Set("Content-Length", strconv.Itoa(len(newBody)))
 		spaceCache.Update(0, newBody, newHeader)
-		log.Printf(colors.ToPurple("刷新缓存空间 PlaybackInfo 信息, space: %s, spaceKey: %s"), spaceCache.Space(), spaceCache.SpaceKey())
+		logs.Debugf(colors.ToPurple("刷新缓存空间 PlaybackInfo 信息, space: %s, spaceKey: %s"), spaceCache.Space(), spaceCache.SpaceKey())
 	}
 
 	// findMediaSourceAndReturn 从全量 PlaybackInfo 信息中查询指定 MediaSourceId 信息
@@ -308,6 +412,10 @@ func useCacheSpacePlaybackInfo(c *gin.Context, itemInfo ItemInfo) bool {
 			if err == nil && cacheId == reqId {
 				newMediaSources.Append(value)
 				updateCache(spaceCache, jsonBody, index)
+				rememberSourceChoice(c, itemInfo)
+				// 语言偏好因用户而异, 只作用于本次响应, 不写入缓存
+				applyLanguageProfile(c, value)
+				applyResumePosition(c, itemInfo, jsonBody, value)
 				return jsons.ErrBreakRange
 			}
 			return nil
@@ -320,7 +428,7 @@ func useCacheSpacePlaybackInfo(c *gin.Context, itemInfo ItemInfo) bool {
 		respHeader := spaceCache.Headers()
 		respHeader.Del("Content-Length")
 		https.CloneHeader(c, respHeader)
-		c.JSON(http.StatusOK, jsonBody.Struct())
+		c.JSON(http.StatusOK, jsonBody)
 		return true
 	}
 
@@ -329,7 +437,7 @@ func useCacheSpacePlaybackInfo(c *gin.Context, itemInfo ItemInfo) bool {
 	if ok {
 		// 未传递 MediaSourceId, 返回整个缓存数据
 		if itemInfo.MsInfo.Empty {
-			log.Printf(colors.ToBlue("复用缓存空间中的 PlaybackInfo 信息, itemId: %s"), itemInfo.Id)
+			logs.Debugf(colors.ToBlue("复用缓存空间中的 PlaybackInfo 信息, itemId: %s"), itemInfo.Id)
 			c.Status(spaceCache.Code())
 			https.CloneHeader(c, spaceCache.Headers())
 			// 避免缓存的请求头中出现脏数据
@@ -352,7 +460,7 @@ func useCacheSpacePlaybackInfo(c *gin.Context, itemInfo ItemInfo) bool {
 	// 一般在请求指定 MediaSourceId 的 PlaybackInfo 信息时必然会先请求一次全量的 PlaybackInfo 信息
 	// 当用户停在已获取全量信息的剧集详情页面时缓存被清理, 或者是代理服务重启导致的缓存丢失
 	// 此时再去播放就会触发这个错误提示, 需要等待下次全量请求完成之后才可以正常播放
-	c.String(http.StatusInternalServerError, "查无缓存, 请稍后尝试重新播放")
+	apierr.Respond(c, http.StatusInternalServerError, apierr.PlaybackCacheMiss, "查无缓存, 请稍后尝试重新播放")
 	return true
 }
 
@@ -363,6 +471,16 @@ func useCacheSpacePlaybackInfo(c *gin.Context, itemInfo ItemInfo) bool {
 //
 // 防止转码资源信息丢失
 func LoadCacheItems(c *gin.Context) {
+	// Infuse 同步媒体库时不处理响应, 直接回源
+	if config.C.Cache.Infuse.Match(c.GetHeader("User-Agent")) {
+		ProxyOrigin(c)
+		return
+	}
+	if isKodiClient(c) {
+		ProxyKodiItems(c)
+		return
+	}
+
 	// 代理请求
 	res, ok := proxyAndSetRespHeader(c)
 	if !ok {
@@ -370,11 +488,14 @@ func LoadCacheItems(c *gin.Context) {
 	}
 	resJson := res.Data
 	defer func() {
-		c.JSON(res.Code, resJson.Struct())
+		c.JSON(res.Code, resJson)
 	}()
+	if res.Code == http.StatusOK {
+		warmupItemDetail(c, resJson)
+	}
 
 	// 未开启转码资源获取功能
-	if !config.C.VideoPreview.Enable {
+	if !config.C.VideoPreview.Enable || !feature.Enabled(feature.VideoPreview) {
 		return
 	}
 
@@ -394,7 +515,7 @@ func LoadCacheItems(c *gin.Context) {
 	if err != nil {
 		return
 	}
-	log.Printf(colors.ToBlue("itemInfo 解析结果: %s"), jsons.NewByVal(itemInfo))
+	logs.Debugf(colors.ToBlue("itemInfo 解析结果: %s"), jsons.NewByVal(itemInfo))
 
 	// coverMediaSources 解析 PlaybackInfo 中的 MediaSources 属性
 	// 并覆盖到当前请求的响应中
@@ -404,7 +525,7 @@ func LoadCacheItems(c *gin.Context) {
 		if !ok || cacheMs.Type() != jsons.JsonTypeArr {
 			return false
 		}
-		log.Printf(colors.ToBlue("使用 PlaybackInfo 的 MediaSources 覆盖 Items 接口响应, itemId: %s"), itemInfo.Id)
+		logs.Debugf(colors.ToBlue("使用 PlaybackInfo 的 MediaSources 覆盖 Items 接口响应, itemId: %s"), itemInfo.Id)
 		resJson.Put("MediaSources", cacheMs)
 		c.Writer.Header().Del("Content-Length")
 		return true
@@ -422,7 +543,7 @@ func LoadCacheItems(c *gin.Context) {
 	// 缓存空间中没有当前 Item 的 PlaybackInfo 数据, 手动请求
 	u := https.ClientRequestHost(c) + itemInfo.PlaybackInfoUri
 	reqBody := io.NopCloser(bytes.NewBufferString(PlaybackCommonPayload))
-	header := make(http.Header)
+	header := https.MarkIdempotent(nil)
 	header.Set("Content-Type", "text/plain")
 	resp, err := https.Request(http.MethodPost, u, header, reqBody)
 	if err != nil {
@@ -452,6 +573,64 @@ func calcPlaybackInfoSpaceCacheKey(itemInfo ItemInfo) string {
 	return itemInfo.Id + "_" + itemInfo.ApiKey
 }
 
+// appendLatePreviews 等待获取超时的转码资源, 获取到之后补充到 PlaybackInfo 缓存中
+//
+// 缓存在响应返回之后才写入, 需要等待缓存出现; 缓存未开启或超时仍未出现时丢弃这些资源
+func appendLatePreviews(itemInfo ItemInfo, user, device string, autoOpen bool, resChans []chan []*jsons.Item) {
+	timeout := time.NewTimer(latePreviewWaitTimeout)
+	defer timeout.Stop()
+	lateInfos := jsons.NewEmptyArr()
+	for _, resChan := range resChans {
+		select {
+		case previewInfos := <-resChan:
+			lateInfos.Append(previewInfos...)
+		case <-timeout.C:
+			log.Printf(colors.ToYellow("等待转码资源超时, itemId: %s"), itemInfo.Id)
+			return
+		}
+	}
+	if limit, ok := config.C.MaxResolution.Limit(user); ok {
+		lateInfos, _ = filterLimitedSources(lateInfos, limit)
+	}
+	if lateInfos.Empty() {
+		return
+	}
+	applyLiveStreamsFor(user, device, itemInfo, lateInfos, autoOpen)
+
+	var spaceCache cache.RespCache
+	for i := 0; i < latePreviewCacheRetries; i++ {
+		var ok bool
+		if spaceCache, ok = getPlaybackInfoByCacheSpace(itemInfo); ok {
+			break
+		}
+		time.Sleep(time.Millisecond * 500)
+	}
+	if spaceCache == nil {
+		log.Printf(colors.ToYellow("PlaybackInfo 缓存不存在, 丢弃 %d 个迟到的转码资源, itemId: %s"), lateInfos.Len(), itemInfo.Id)
+		return
+	}
+
+	jsonBody, err := spaceCache.JsonBody()
+	if err != nil {
+		log.Printf(colors.ToRed("解析缓存响应体失败: %v"), err)
+		return
+	}
+	mediaSources, ok := jsonBody.Attr("MediaSources").Done()
+	if !ok || mediaSources.Type() != jsons.JsonTypeArr {
+		return
+	}
+	lateInfos.RangeArr(func(_ int, info *jsons.Item) error {
+		mediaSources.Append(info)
+		return nil
+	})
+
+	newBody := []byte(jsonBody.String())
+	newHeader := spaceCache.Headers()
+	newHeader.Set("Content-Length", strconv.Itoa(len(newBody)))
+	spaceCache.Update(0, newBody, newHeader)
+	log.Printf(colors.ToGreen("补充 %d 个迟到的转码资源到缓存, space: %s, spaceKey: %s"), lateInfos.Len(), spaceCache.Space(), spaceCache.SpaceKey())
+}
+
 // getPlaybackInfoByCacheSpace 从缓存空间中获取 PlaybackInfo 信息
 func getPlaybackInfoByCacheSpace(itemInfo ItemInfo) (cache.RespCache, bool) {
 	spaceCache, ok := cache.GetSpaceCache(PlaybackCacheSpace, calcPlaybackInfoSpaceCacheKey(itemInfo))
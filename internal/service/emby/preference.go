@@ -0,0 +1,216 @@
+package emby
+
+import (
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/store"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OriginChoice 用户选择原画资源时记录的清晰度标识
+const OriginChoice = "origin"
+
+// sourceChoice 用户在某部剧集中选择的资源
+type sourceChoice struct {
+	TemplateId string // 转码清晰度, 原画为 OriginChoice
+	Times      int    // 连续选择的次数
+}
+
+var (
+	// sourceChoices 用户 => 剧集 id => 选择的资源
+	sourceChoices = map[string]map[string]*sourceChoice{}
+	// sourceChoicesMu 并发控制
+	sourceChoicesMu sync.Mutex
+	// sourceChoicesOnce 首次使用时从存储中加载用户选择的资源
+	sourceChoicesOnce sync.Once
+
+	// itemSeries item id => 剧集 id, 电影等不属于剧集的 item 对应空字符串
+	itemSeries = sync.Map{}
+)
+
+// rememberSourceChoice 记录用户在剧集中选择的资源
+func rememberSourceChoice(c *gin.Context, itemInfo ItemInfo) {
+	cfg := config.C.VideoPreview.RememberChoice
+	if !cfg.Enable || itemInfo.MsInfo.Empty {
+		return
+	}
+	user := requestUser(c)
+	if user == "" {
+		return
+	}
+	templateId := itemInfo.MsInfo.TemplateId
+	if !itemInfo.MsInfo.Transcode {
+		templateId = OriginChoice
+	}
+
+	go func() {
+		seriesId := getItemSeriesId(itemInfo.Id)
+		if seriesId == "" {
+			return
+		}
+		loadSourceChoices()
+		sourceChoicesMu.Lock()
+		defer sourceChoicesMu.Unlock()
+		if sourceChoices[user] == nil {
+			sourceChoices[user] = map[string]*sourceChoice{}
+		}
+		choice := sourceChoices[user][seriesId]
+		if choice == nil || choice.TemplateId != templateId {
+			choice = &sourceChoice{TemplateId: templateId}
+			sourceChoices[user][seriesId] = choice
+		}
+		choice.Times++
+		if err := store.Default().Put(store.BucketSourceChoices, user, sourceChoices[user]); err != nil {
+			log.Printf(colors.ToRed("保存用户选择的资源失败: %v"), err)
+		}
+	}()
+}
+
+// applySourceChoice 将用户在当前剧集中习惯选择的资源移至 MediaSources 的最前面, 作为默认资源
+func applySourceChoice(c *gin.Context, itemInfo ItemInfo, resJson *jsons.Item) {
+	cfg := config.C.VideoPreview.RememberChoice
+	if !cfg.Enable || !itemInfo.MsInfo.Empty {
+		return
+	}
+	user := requestUser(c)
+	loadSourceChoices()
+	sourceChoicesMu.Lock()
+	_, hasChoices := sourceChoices[user]
+	sourceChoicesMu.Unlock()
+	if !hasChoices {
+		return
+	}
+
+	seriesId := getItemSeriesId(itemInfo.Id)
+	sourceChoicesMu.Lock()
+	choice := sourceChoices[user][seriesId]
+	sourceChoicesMu.Unlock()
+	if choice == nil || choice.Times < cfg.MinTimes {
+		return
+	}
+
+	mediaSources, ok := resJson.Attr("MediaSources").Done()
+	if !ok || mediaSources.Type() != jsons.JsonTypeArr {
+		return
+	}
+	targetIdx := mediaSources.FindIdx(func(source *jsons.Item) bool {
+		id, _ := source.Attr("Id").String()
+		msInfo, err := resolveMediaSourceId(id)
+		if err != nil {
+			return false
+		}
+		if choice.TemplateId == OriginChoice {
+			return !msInfo.Transcode
+		}
+		return msInfo.Transcode && msInfo.TemplateId == choice.TemplateId
+	})
+	if targetIdx <= 0 {
+		return
+	}
+	moveSourceToFront(resJson, mediaSources, targetIdx)
+	logs.Debugf(colors.ToBlue("使用用户 [%s] 在剧集中习惯选择的资源作为默认资源: %s"), user, choice.TemplateId)
+}
+
+// loadSourceChoices 从存储中加载用户在剧集中选择的资源, 只在首次调用时加载
+func loadSourceChoices() {
+	sourceChoicesOnce.Do(func() {
+		st := store.Default()
+		sourceChoicesMu.Lock()
+		defer sourceChoicesMu.Unlock()
+		for _, user := range st.Keys(store.BucketSourceChoices) {
+			choices := map[string]*sourceChoice{}
+			if _, err := st.Get(store.BucketSourceChoices, user, &choices); err != nil {
+				log.Printf(colors.ToYellow("读取用户 [%s] 选择的资源失败: %v"), user, err)
+				continue
+			}
+			sourceChoices[user] = choices
+		}
+	})
+}
+
+// applyDefaultPreview 低带宽用户或客户端请求时, 将转码资源移至 MediaSources 的最前面, 作为默认资源
+func applyDefaultPreview(c *gin.Context, itemInfo ItemInfo, resJson *jsons.Item) {
+	cfg := config.C.VideoPreview.DefaultPreview
+	if !cfg.Enable || !itemInfo.MsInfo.Empty {
+		return
+	}
+	user, client := requestUser(c), requestClient(c)
+	if !cfg.Match(user, client) {
+		return
+	}
+
+	mediaSources, ok := resJson.Attr("MediaSources").Done()
+	if !ok || mediaSources.Type() != jsons.JsonTypeArr {
+		return
+	}
+	sourceTemplate := func(source *jsons.Item) (string, bool) {
+		id, _ := source.Attr("Id").String()
+		msInfo, err := resolveMediaSourceId(id)
+		if err != nil || !msInfo.Transcode {
+			return "", false
+		}
+		return msInfo.TemplateId, true
+	}
+	targetIdx := -1
+	for _, want := range cfg.Templates {
+		targetIdx = mediaSources.FindIdx(func(source *jsons.Item) bool {
+			templateId, ok := sourceTemplate(source)
+			return ok && strings.EqualFold(templateId, want)
+		})
+		if targetIdx != -1 {
+			break
+		}
+	}
+	if targetIdx == -1 {
+		targetIdx = mediaSources.FindIdx(func(source *jsons.Item) bool {
+			_, ok := sourceTemplate(source)
+			return ok
+		})
+	}
+	if targetIdx <= 0 {
+		return
+	}
+	moveSourceToFront(resJson, mediaSources, targetIdx)
+	logs.Debugf(colors.ToBlue("用户 [%s] 客户端 [%s] 默认使用转码资源"), user, client)
+}
+
+// moveSourceToFront 将 targetIdx 的资源移至 MediaSources 的最前面
+func moveSourceToFront(resJson, mediaSources *jsons.Item, targetIdx int) {
+	newMediaSources := jsons.NewEmptyArr()
+	target, _ := mediaSources.Idx(targetIdx).Done()
+	newMediaSources.Append(target)
+	mediaSources.RangeArr(func(index int, value *jsons.Item) error {
+		if index != targetIdx {
+			newMediaSources.Append(value)
+		}
+		return nil
+	})
+	resJson.Put("MediaSources", newMediaSources)
+}
+
+// getItemSeriesId 查询 item 所属的剧集 id, 查询结果会被缓存
+func getItemSeriesId(itemId string) string {
+	if seriesId, ok := itemSeries.Load(itemId); ok {
+		return seriesId.(string)
+	}
+
+	q := url.Values{}
+	q.Set("Ids", itemId)
+	q.Set("Fields", "SeriesId")
+	res, _ := Fetch("/Items?"+q.Encode(), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return ""
+	}
+	seriesId, _ := res.Data.Attr("Items").Idx(0).Attr("SeriesId").String()
+	itemSeries.Store(itemId, seriesId)
+	return seriesId
+}
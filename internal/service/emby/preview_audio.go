@@ -0,0 +1,178 @@
+package emby
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+)
+
+// previewAudioProbeTimeout 探测转码播放列表音轨的超时时间
+const previewAudioProbeTimeout = time.Second * 3
+
+var (
+	// hlsAttrLanguageRegex 匹配 #EXT-X-MEDIA 中的语言
+	hlsAttrLanguageRegex = regexp.MustCompile(`LANGUAGE="([^"]*)"`)
+	// hlsAttrDefaultRegex 匹配 #EXT-X-MEDIA 中的默认标识
+	hlsAttrDefaultRegex = regexp.MustCompile(`DEFAULT=YES`)
+)
+
+// langAliases 播放列表中的双字母语言代码 => emby 使用的三字母语言代码
+var langAliases = map[string][]string{
+	"zh": {"chi", "zho"},
+	"en": {"eng"},
+	"ja": {"jpn"},
+	"ko": {"kor"},
+	"fr": {"fre", "fra"},
+	"de": {"ger", "deu"},
+	"es": {"spa"},
+	"it": {"ita"},
+	"ru": {"rus"},
+	"pt": {"por"},
+	"th": {"tha"},
+}
+
+// audioRendition 转码播放列表中的一条音轨
+type audioRendition struct {
+	Language string // 语言代码, 可能为空
+	Default  bool   // 是否为默认音轨
+}
+
+// probePreviewAudio 读取转码播放列表的头部, 获取其中声明的独立音轨
+//
+// 返回空列表表示播放列表中没有独立音轨, 只有与视频混流的一条音轨
+func probePreviewAudio(ctx context.Context, playlistUrl string) ([]audioRendition, error) {
+	ctx, cancel := context.WithTimeout(ctx, previewAudioProbeTimeout)
+	defer cancel()
+	resp, err := https.RequestCtx(ctx, http.MethodGet, playlistUrl, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("响应码: %d", resp.StatusCode)
+	}
+
+	res := make([]audioRendition, 0)
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		// 音轨只会声明在切片和子播放列表之前
+		if strings.HasPrefix(line, "#EXTINF") || strings.HasPrefix(line, "#EXT-X-STREAM-INF") {
+			break
+		}
+		if !strings.HasPrefix(line, "#EXT-X-MEDIA:") || !strings.Contains(line, "TYPE=AUDIO") {
+			continue
+		}
+		rendition := audioRendition{Default: hlsAttrDefaultRegex.MatchString(line)}
+		if matches := hlsAttrLanguageRegex.FindStringSubmatch(line); len(matches) == 2 {
+			rendition.Language = strings.ToLower(matches[1])
+		}
+		res = append(res, rendition)
+	}
+	return res, scanner.Err()
+}
+
+// applyPreviewAudio 按照转码播放列表中实际存在的音轨改写转码资源的 MediaStreams
+//
+// 没有独立音轨时只保留原画的默认音轨; 有独立音轨时按照语言匹配原画的音轨, 匹配不到的音轨被移除
+func applyPreviewAudio(source *jsons.Item, renditions []audioRendition) {
+	streams, ok := source.Attr("MediaStreams").Done()
+	if !ok || streams.Type() != jsons.JsonTypeArr {
+		return
+	}
+
+	type audioStream struct {
+		index     int
+		language  string
+		isDefault bool
+	}
+	audioStreams, _ := source.Query(audioStreamQuery)
+	audios := make([]audioStream, 0, len(audioStreams))
+	for _, stream := range audioStreams {
+		as := audioStream{}
+		as.index, _ = stream.Attr("Index").Int()
+		lang, _ := stream.Attr("Language").String()
+		as.language = strings.ToLower(lang)
+		as.isDefault, _ = stream.Attr("IsDefault").Bool()
+		audios = append(audios, as)
+	}
+	if len(audios) <= 1 {
+		return
+	}
+
+	// 计算需要保留的音轨
+	keep := map[int]struct{}{}
+	defaultIdx := -1
+	if len(renditions) == 0 {
+		defaultIdx = audios[0].index
+		for _, as := range audios {
+			if as.isDefault {
+				defaultIdx = as.index
+				break
+			}
+		}
+		keep[defaultIdx] = struct{}{}
+	}
+	for _, rendition := range renditions {
+		for _, as := range audios {
+			// 没有声明语言的音轨按顺序匹配
+			if _, ok := keep[as.index]; ok || (rendition.Language != "" && !sameLanguage(rendition.Language, as.language)) {
+				continue
+			}
+			keep[as.index] = struct{}{}
+			if rendition.Default || defaultIdx == -1 {
+				defaultIdx = as.index
+			}
+			break
+		}
+	}
+	if len(keep) == 0 || len(keep) == len(audios) {
+		return
+	}
+
+	newStreams := jsons.NewEmptyArr()
+	streams.RangeArr(func(_ int, stream *jsons.Item) error {
+		if t, _ := stream.Attr("Type").String(); t == "Audio" {
+			idx, _ := stream.Attr("Index").Int()
+			if _, ok := keep[idx]; !ok {
+				return nil
+			}
+			stream.Put("IsDefault", jsons.NewByVal(idx == defaultIdx))
+		}
+		newStreams.Append(stream)
+		return nil
+	})
+	source.Put("MediaStreams", newStreams)
+	source.Put("DefaultAudioStreamIndex", jsons.NewByVal(defaultIdx))
+	logs.Debugf(colors.ToBlue("转码资源实际可用的音轨个数: %d, 原画音轨个数: %d"), len(keep), len(audios))
+}
+
+// sameLanguage 判断播放列表中的语言代码和 emby 的语言代码是否为同一种语言
+func sameLanguage(hlsLang, embyLang string) bool {
+	if hlsLang == "" || embyLang == "" {
+		return false
+	}
+	if hlsLang == embyLang {
+		return true
+	}
+	// 忽略地区后缀, 如: zh-CN
+	hlsLang, _, _ = strings.Cut(hlsLang, "-")
+	if hlsLang == embyLang {
+		return true
+	}
+	for _, alias := range langAliases[hlsLang] {
+		if alias == embyLang {
+			return true
+		}
+	}
+	return false
+}
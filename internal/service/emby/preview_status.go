@@ -0,0 +1,105 @@
+package emby
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+)
+
+// PreviewStatus item 的转码资源状态, 用于排查转码资源不出现的问题
+type PreviewStatus struct {
+	Enable       bool                  // 是否开启了转码资源 (video-preview.enable)
+	Lazy         bool                  // 是否开启了延迟转码 (video-preview.lazy)
+	NoPreviewTag bool                  // item 是否被标记为不显示转码资源 (item-tags)
+	Sources      []PreviewSourceStatus // 每个资源的转码状态
+}
+
+// PreviewSourceStatus 单个资源的转码状态
+type PreviewSourceStatus struct {
+	MediaSourceId  string            // 资源 id
+	EmbyPath       string            // 资源在 emby 中的路径
+	AlistPath      string            // 解析成功的 alist 路径
+	Container      string            // 资源容器
+	ContainerValid bool              // 容器是否在 video-preview.containers 中
+	Templates      []PreviewTemplate // alist 当前提供的转码清晰度
+	Error          string            // 查询失败的原因
+}
+
+// PreviewTemplate alist 提供的一个转码清晰度
+type PreviewTemplate struct {
+	TemplateId string // 模板 id
+	Width      int    // 宽度
+	Height     int    // 高度
+	Status     string // alist 返回的转码状态
+	Ignored    bool   // 是否被 video-preview.ignore-template-ids 忽略
+}
+
+// ItemPreviewStatus 查询 item 所有资源在 alist 中当前可用的转码清晰度, 使用默认的 alist 账号
+func ItemPreviewStatus(itemId string) (PreviewStatus, error) {
+	sources, err := fetchItemSources(itemId)
+	if err != nil {
+		return PreviewStatus{}, err
+	}
+	vp := config.C.VideoPreview
+	res := PreviewStatus{
+		Enable:       vp.Enable,
+		Lazy:         vp.Lazy,
+		NoPreviewTag: itemTagPolicy(itemId).noPreview,
+		Sources:      make([]PreviewSourceStatus, 0, len(sources)),
+	}
+	for _, source := range sources {
+		if urls.IsRemote(source.Path) {
+			continue
+		}
+		res.Sources = append(res.Sources, previewSourceStatus(source))
+	}
+	return res, nil
+}
+
+// previewSourceStatus 查询单个资源在 alist 中当前可用的转码清晰度
+func previewSourceStatus(source MediaSource) PreviewSourceStatus {
+	alistPathRes := sourceAlistPath(source)
+	res := PreviewSourceStatus{
+		MediaSourceId:  source.Id,
+		EmbyPath:       alistPathRes.EmbyPath,
+		Container:      source.Container,
+		ContainerValid: config.C.VideoPreview.ContainerValid(source.Container),
+		Templates:      make([]PreviewTemplate, 0),
+	}
+
+	ctx := alist.WithAccount(context.Background(), "")
+	r, err := fetchAlistResourceCtx(ctx, nil, alistPathRes, func(time.Duration) {})
+	if err != nil {
+		res.Error = err.Error()
+		return res
+	}
+	res.AlistPath = r.path
+
+	fsRes := alist.FetchFsOther(ctx, r.path, nil)
+	if fsRes.Code != http.StatusOK {
+		res.Error = fmt.Sprintf("请求 alist 转码资源失败: %s", fsRes.Msg)
+		return res
+	}
+	list, ok := fsRes.Data.Attr("video_preview_play_info").Attr("live_transcoding_task_list").Done()
+	if !ok || list.Type() != jsons.JsonTypeArr {
+		res.Error = "alist 未返回转码资源列表"
+		return res
+	}
+	list.RangeArr(func(_ int, task *jsons.Item) error {
+		tpl := PreviewTemplate{}
+		tpl.TemplateId, _ = task.Attr("template_id").String()
+		tpl.Width, _ = task.Attr("template_width").Int()
+		tpl.Height, _ = task.Attr("template_height").Int()
+		tpl.Status, _ = task.Attr("status").String()
+		tpl.Ignored = config.C.VideoPreview.IsTemplateIgnore(tpl.TemplateId)
+		res.Templates = append(res.Templates, tpl)
+		return nil
+	})
+	return res
+}
@@ -0,0 +1,169 @@
+package emby
+
+import (
+	"crypto/rand"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// probeChunkSize 测速时每次写出的数据大小
+const probeChunkSize = 64 * 1024
+
+// probeDefaultSize 客户端未指定大小时的测速数据量
+const probeDefaultSize = 4 * 1024 * 1024
+
+// probeChunk 测速使用的随机数据, 避免被中间链路压缩
+var probeChunk = func() []byte {
+	buf := make([]byte, probeChunkSize)
+	rand.Read(buf)
+	return buf
+}()
+
+// ProbeResult 一次测速的结果
+type ProbeResult struct {
+	Bytes      int64     `json:"bytes"`      // 传输的字节数
+	DurationMs int64     `json:"durationMs"` // 耗时 (毫秒)
+	Mbps       float64   `json:"mbps"`       // 带宽
+	At         time.Time `json:"at"`         // 测速时间
+	Choice     string    `json:"choice"`     // 自动模式下选择的播放方式: redirect, proxy
+}
+
+// probeResults 设备 => 最近一次的测速结果
+var probeResults sync.Map
+
+// Probe 客户端带宽测速接口
+//
+// GET 下载 size 字节的随机数据, 由服务器记录写出耗时;
+// POST 上传任意数据, 返回测速结果; size=0 时返回设备最近一次的测速结果
+func Probe(c *gin.Context) {
+	cfg := config.C.Probe
+	if !cfg.Enable {
+		apierr.Respond(c, http.StatusNotFound, apierr.NotFound, "测速接口未启用")
+		return
+	}
+	c.Header(cache.HeaderKeyExpired, "-1")
+	c.Header("Cache-Control", "no-store")
+	device := sessionDevice(c)
+
+	switch c.Request.Method {
+	case http.MethodGet:
+		size := int64(probeDefaultSize)
+		if sizeStr := c.Query("size"); sizeStr != "" {
+			n, err := strconv.ParseInt(sizeStr, 10, 64)
+			if err != nil || n < 0 {
+				apierr.Respondf(c, http.StatusBadRequest, apierr.InvalidRequest, "无效的 size: %s", sizeStr)
+				return
+			}
+			size = n
+		}
+		if size == 0 {
+			res, ok := loadProbeResult(device)
+			if !ok {
+				apierr.Respond(c, http.StatusNotFound, apierr.NotFound, "当前设备没有有效的测速结果")
+				return
+			}
+			c.JSON(http.StatusOK, res)
+			return
+		}
+		size = min(size, cfg.MaxSizeBytes())
+
+		c.Header("Content-Type", "application/octet-stream")
+		c.Header("Content-Length", strconv.FormatInt(size, 10))
+		c.Status(http.StatusOK)
+		start := time.Now()
+		for remain := size; remain > 0; {
+			n := min(remain, probeChunkSize)
+			if _, err := c.Writer.Write(probeChunk[:n]); err != nil {
+				return
+			}
+			c.Writer.Flush()
+			remain -= n
+		}
+		recordProbe(device, size, time.Since(start))
+	case http.MethodPost:
+		start := time.Now()
+		n, err := io.Copy(io.Discard, io.LimitReader(c.Request.Body, cfg.MaxSizeBytes()))
+		if err != nil {
+			apierr.Respondf(c, http.StatusBadRequest, apierr.InvalidRequest, "读取测速数据失败: %v", err)
+			return
+		}
+		c.JSON(http.StatusOK, recordProbe(device, n, time.Since(start)))
+	default:
+		apierr.Respondf(c, http.StatusMethodNotAllowed, apierr.MethodNotAllowed, "不支持的请求方法: %s", c.Request.Method)
+	}
+}
+
+// recordProbe 记录设备的测速结果, 同时清理过期的结果
+func recordProbe(device string, bytes int64, cost time.Duration) ProbeResult {
+	cost = max(cost, time.Millisecond)
+	res := ProbeResult{
+		Bytes:      bytes,
+		DurationMs: cost.Milliseconds(),
+		Mbps:       float64(bytes*8) / cost.Seconds() / 1e6,
+		At:         time.Now(),
+	}
+	res.Choice = probeChoice(bytes, res.Mbps)
+
+	probeResults.Range(func(key, value any) bool {
+		if time.Since(value.(ProbeResult).At) > config.C.Probe.TtlDuration() {
+			probeResults.Delete(key)
+		}
+		return true
+	})
+	probeResults.Store(device, res)
+	log.Printf(colors.ToGreen("设备 [%s] 测速完成, 数据量: %d, 耗时: %v, 带宽: %.2f Mbps"), device, bytes, cost, res.Mbps)
+	return res
+}
+
+// probeChoice 根据带宽选择播放方式, 未开启自动模式时返回空
+func probeChoice(bytes int64, mbps float64) string {
+	cfg := config.C.Probe
+	if !cfg.Auto || bytes == 0 {
+		return ""
+	}
+	if mbps >= cfg.ProxyThreshold {
+		return string(config.GeoProxy)
+	}
+	return string(config.GeoRedirect)
+}
+
+// loadProbeResult 获取设备在有效期内的测速结果
+func loadProbeResult(device string) (ProbeResult, bool) {
+	v, ok := probeResults.Load(device)
+	if !ok {
+		return ProbeResult{}, false
+	}
+	res := v.(ProbeResult)
+	if time.Since(res.At) > config.C.Probe.TtlDuration() {
+		return ProbeResult{}, false
+	}
+	return res, true
+}
+
+// probeChain 自动模式下, 根据设备的测速结果调整直链解析步骤
+//
+// 带宽不低于 proxy-threshold 时, 将网盘直链替换为 alist 本地代理链接
+func probeChain(c *gin.Context, chain []config.ResolveStep) []config.ResolveStep {
+	cfg := config.C.Probe
+	if !cfg.Enable || !cfg.Auto {
+		return chain
+	}
+	res, ok := loadProbeResult(sessionDevice(c))
+	if !ok || res.Choice != string(config.GeoProxy) {
+		return chain
+	}
+	logs.Debugf(colors.ToBlue("设备测得带宽 %.2f Mbps, 使用服务器中转播放"), res.Mbps)
+	return replaceSteps(chain, config.ResolveAlistProxy, config.ResolveAlistRaw)
+}
@@ -11,12 +11,17 @@ import (
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/config"
 	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/feature"
 	"github.com/AmbitiousJun/go-emby2alist/internal/service/path"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/sentry"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
 	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
 
 	"github.com/gin-gonic/gin"
@@ -32,24 +37,41 @@ func Redirect2Transcode(c *gin.Context) {
 		ProxyOrigin(c)
 		return
 	}
-	log.Println(colors.ToBlue("检测到自定义的转码 m3u8 请求, 重定向到本地代理接口"))
+	logs.Debugln(colors.ToBlue("检测到自定义的转码 m3u8 请求, 重定向到本地代理接口"))
 	tu, _ := url.Parse("/videos/proxy_playlist")
 	q := tu.Query()
 	q.Set("alist_path", alistPath)
 	q.Set(QueryApiKeyName, apiKey)
 	q.Set("template_id", templateId)
 	tu.RawQuery = q.Encode()
-	c.Redirect(http.StatusTemporaryRedirect, tu.String())
+	target := tu.String()
+	if IsLegacyClient(c) {
+		target = ShortenUrl(target)
+	}
+	c.Redirect(http.StatusTemporaryRedirect, target)
 }
 
 // Redirect2AlistLink 重定向资源到 alist 网盘直链
 func Redirect2AlistLink(c *gin.Context) {
+	// 检查用户的并发串流数
+	if checkStreamLimit(c) {
+		return
+	}
+
 	// 1 解析要请求的资源信息
 	itemInfo, err := resolveItemInfo(c)
 	if checkErr(c, err) {
 		return
 	}
-	log.Printf(colors.ToBlue("解析到的 itemInfo: %v"), jsons.NewByVal(itemInfo))
+	logs.Debugf(colors.ToBlue("解析到的 itemInfo: %v"), jsons.NewByVal(itemInfo))
+
+	// 带有强制回源标签的 item, 由源服务器串流
+	if itemTagPolicy(itemInfo.Id).forceOrigin {
+		logs.Debugf(colors.ToBlue("item [%s] 带有强制回源标签, 代理到源服务器"), itemInfo.Id)
+		recordDecision(c, metrics.DecisionOrigin, metrics.ReasonPolicy)
+		ProxyOrigin(c)
+		return
+	}
 
 	// 2 如果请求的是转码资源, 重定向到本地的 m3u8 代理服务
 	msInfo := itemInfo.MsInfo
@@ -62,53 +84,85 @@ func Redirect2AlistLink(c *gin.Context) {
 		q.Set("alist_path", itemInfo.MsInfo.AlistPath)
 		u.RawQuery = q.Encode()
 		log.Printf(colors.ToGreen("重定向 playlist: %s"), u.String())
+		recordDecision(c, metrics.DecisionProxy, metrics.ReasonDefault)
 		c.Redirect(http.StatusTemporaryRedirect, u.String())
 		return
 	}
 
-	// 3 请求资源在 Emby 中的 Path 参数
-	embyPath, err := getEmbyFileLocalPath(itemInfo)
+	// 3 请求资源在 Emby 中的 MediaSource 信息
+	source, err := getEmbyMediaSource(itemInfo)
 	if checkErr(c, err) {
 		return
 	}
+	embyPath := source.Path
+	c.Set(ginKeyStreamContainer, source.Container)
 
 	// 4 如果是远程地址 (strm), 直接进行重定向
 	if urls.IsRemote(embyPath) {
-		finalPath := config.C.Emby.Strm.MapPath(embyPath)
+		finalPath := mapStrmPath(embyPath)
 		log.Printf(colors.ToGreen("重定向 strm: %s"), finalPath)
 		c.Header(cache.HeaderKeyExpired, "-1")
+		if contentType := streamContentType(c, finalPath); contentType != "" {
+			c.Header("Content-Type", contentType)
+		}
+		recordPlay(c, "strm", 0, true)
+		recordDecision(c, metrics.DecisionRedirect, metrics.ReasonDefault)
+		fireDirectLink(c, "strm", embyPath, finalPath)
 		c.Redirect(http.StatusTemporaryRedirect, finalPath)
 		return
 	}
 
-	// 5 请求 alist 资源
+	// 光盘原盘资源按照配置的策略处理
+	if !useTranscode && handleDiscPlayback(c, source) {
+		return
+	}
+
+	// 5 客户端无法直接播放的音频, 交由 emby 转码
+	if !audioUniversalPlayable(c, embyPath) {
+		logs.Debugln(colors.ToBlue("客户端不支持当前音频容器, 代理到源服务器转码"))
+		recordDecision(c, metrics.DecisionOrigin, metrics.ReasonClientRule)
+		ProxyOrigin(c)
+		return
+	}
+
+	// 当前设备上报过播放失败的原画资源, 冷却时间内由源服务器串流
+	if !useTranscode && isSourceDemoted(c, itemInfo.Id, source.Id) {
+		log.Printf(colors.ToYellow("资源在当前设备上已降级, 代理到源服务器: %s"), embyPath)
+		c.Header(cache.HeaderKeyExpired, "-1")
+		recordDecision(c, metrics.DecisionOrigin, metrics.ReasonFailure)
+		ProxyOrigin(c)
+		return
+	}
+
+	// 6 请求原画资源, 按照配置的解析链依次尝试
+	alistPathRes := sourceAlistPath(source)
+	if !useTranscode {
+		resolveDirectLink(c, embyPath, alistPathRes, false)
+		return
+	}
+
+	// 7 请求 alist 转码资源
 	fi := alist.FetchInfo{
 		Header:       c.Request.Header.Clone(),
 		UseTranscode: useTranscode,
 		Format:       msInfo.TemplateId,
+		Ctx:          alistCtx(c, c.Request.Context()),
 	}
-	alistPathRes := path.Emby2Alist(embyPath)
 
 	allErrors := strings.Builder{}
 	// handleAlistResource 根据传递的 path 请求 alist 资源
 	handleAlistResource := func(path string) bool {
-		log.Printf(colors.ToBlue("尝试请求 Alist 资源: %s"), path)
+		logs.Debugf(colors.ToBlue("尝试请求 Alist 资源: %s"), path)
 		fi.Path = path
+		start := time.Now()
 		res := alist.FetchResource(fi)
+		https.RecordUpstream(c, "alist", time.Since(start))
 
 		if res.Code != http.StatusOK {
 			allErrors.WriteString(fmt.Sprintf("请求 Alist 失败, code: %d, msg: %s, path: %s;", res.Code, res.Msg, path))
 			return false
 		}
 
-		// 处理直链
-		if !fi.UseTranscode {
-			log.Printf(colors.ToGreen("请求成功, 重定向到: %s"), res.Data.Url)
-			c.Header(cache.HeaderKeyExpired, cache.Duration(time.Minute*10))
-			c.Redirect(http.StatusTemporaryRedirect, res.Data.Url)
-			return true
-		}
-
 		// 代理转码 m3u
 		u, _ := url.Parse(strings.ReplaceAll(https.ClientRequestHost(c)+MasterM3U8UrlTemplate, "${itemId}", itemInfo.Id))
 		q := u.Query()
@@ -116,7 +170,7 @@ func Redirect2AlistLink(c *gin.Context) {
 		q.Set(QueryApiKeyName, itemInfo.ApiKey)
 		q.Set("alist_path", path)
 		u.RawQuery = q.Encode()
-		_, resp, err := https.RequestRedirect(http.MethodGet, u.String(), nil, nil, true)
+		_, resp, err := https.RequestRedirectCtx(c.Request.Context(), http.MethodGet, u.String(), nil, nil, true)
 		if err != nil {
 			allErrors.WriteString(fmt.Sprintf("代理转码 m3u 失败: %v;", err))
 			return false
@@ -137,7 +191,7 @@ func Redirect2AlistLink(c *gin.Context) {
 		return
 	}
 	paths, err := alistPathRes.Range()
-	if checkErr(c, err) {
+	if checkErr(c, apierr.Wrap(apierr.UpstreamAlistDown, err)) {
 		return
 	}
 	for _, path := range paths {
@@ -146,7 +200,53 @@ func Redirect2AlistLink(c *gin.Context) {
 		}
 	}
 
-	checkErr(c, fmt.Errorf("获取直链失败: %s", allErrors.String()))
+	checkErr(c, apierr.New(apierr.AlistResolveFailed, "获取直链失败: %s", allErrors.String()))
+}
+
+// DownloadItem 处理客户端的资源下载请求
+//
+// 下载始终使用原画资源, 与串流接口一样按照 resolve.chain 解析直链,
+// 避免文件经过 emby 源服务器下载
+func DownloadItem(c *gin.Context) {
+	// 1 解析要下载的资源信息
+	itemInfo, err := resolveItemInfo(c)
+	if checkErr(c, err) {
+		return
+	}
+	logs.Debugf(colors.ToBlue("解析到的下载 itemInfo: %v"), jsons.NewByVal(itemInfo))
+	if itemTagPolicy(itemInfo.Id).forceOrigin {
+		logs.Debugf(colors.ToBlue("item [%s] 带有强制回源标签, 代理到源服务器"), itemInfo.Id)
+		ProxyOrigin(c)
+		return
+	}
+
+	// 2 请求资源在 Emby 中的 Path 参数
+	embyPath, err := getEmbyFileLocalPath(itemInfo)
+	if err != nil {
+		// 照片没有 MediaSource 信息, 直接查询 item 的 Path
+		if photoPath, photoErr := getEmbyPhotoPath(itemInfo.Id); photoErr == nil {
+			embyPath, err = photoPath, nil
+		}
+	}
+	if checkErr(c, err) {
+		return
+	}
+
+	// 3 如果是远程地址 (strm), 直接进行重定向
+	if urls.IsRemote(embyPath) {
+		finalPath := mapStrmPath(embyPath)
+		log.Printf(colors.ToGreen("下载重定向 strm: %s"), finalPath)
+		c.Header(cache.HeaderKeyExpired, "-1")
+		if contentType := streamContentType(c, finalPath); contentType != "" {
+			c.Header("Content-Type", contentType)
+		}
+		fireDirectLink(c, "strm", embyPath, finalPath)
+		c.Redirect(http.StatusTemporaryRedirect, finalPath)
+		return
+	}
+
+	// 4 解析直链
+	resolveDirectLink(c, embyPath, path.Emby2Alist(embyPath), true)
 }
 
 // checkErr 检查 err 是否为空
@@ -162,6 +262,8 @@ func checkErr(c *gin.Context, err error) bool {
 
 	// 异常接口, 不缓存
 	c.Header(cache.HeaderKeyExpired, "-1")
+	metrics.RecordError(fmt.Sprintf("代理接口失败, uri: %s, err: %v", c.Request.URL.Path, err))
+	sentry.CaptureError(c, err)
 
 	// 请求参数中有忽略异常
 	if c.Query("ignore_error") == "true" {
@@ -169,15 +271,33 @@ func checkErr(c *gin.Context, err error) bool {
 		return true
 	}
 
+	// 优先返回最近一次成功的响应
+	if config.C.Emby.ProxyErrorStrategy == config.StrategyStale && serveStale(c) {
+		recordDecision(c, metrics.DecisionStale, metrics.ReasonFailure)
+		return true
+	}
+
 	// 采用拒绝策略, 直接返回错误
+	code := apierr.CodeOf(err)
 	if config.C.Emby.ProxyErrorStrategy == config.StrategyReject {
-		log.Printf(colors.ToRed("代理接口失败: %v"), err)
-		c.String(http.StatusInternalServerError, "代理接口失败, 请检查日志")
+		log.Printf(colors.ToRed("代理接口失败 [%s]: %v"), code, err)
+		recordDecision(c, metrics.DecisionReject, metrics.ReasonFailure)
+		apierr.Respond(c, apierr.StatusOf(code), code, "代理接口失败, 请检查日志")
 		return true
 	}
 
 	u := config.C.Emby.Host + c.Request.URL.String()
-	log.Printf(colors.ToRed("代理接口失败: %v, 重定向回源服务器处理\n"), err)
+	log.Printf(colors.ToRed("代理接口失败 [%s]: %v, 重定向回源服务器处理\n"), code, err)
+	c.Header(apierr.HeaderErrorCode, string(code))
+	recordDecision(c, metrics.DecisionOrigin, metrics.ReasonFailure)
 	c.Redirect(http.StatusTemporaryRedirect, u)
 	return true
 }
+
+// mapStrmPath 按照 strm 配置映射远程地址, 功能在运行时被关闭时原样返回
+func mapStrmPath(embyPath string) string {
+	if !feature.Enabled(feature.StrmMapping) {
+		return embyPath
+	}
+	return config.C.Emby.Strm.MapPath(embyPath)
+}
@@ -0,0 +1,91 @@
+package emby
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// remoteImagePath 远程图片的代理地址, 与 emby 的远程图片接口保持一致, 关闭代理后仍然可以由源服务器处理
+const remoteImagePath = "/emby/Images/Remote"
+
+// ProxyItemRemoteImages 代理 item 的远程图片列表接口, 将列表中的远程图片地址改写为代理地址
+func ProxyItemRemoteImages(c *gin.Context) {
+	if !config.C.Emby.RemoteImages.Enable {
+		ProxyOrigin(c)
+		return
+	}
+	proxyRewriteRemoteImages(c)
+}
+
+// ProxyRemoteImage 代理远程图片
+//
+// 只代理 emby.remote-images.hosts 中的图片, 其余请求交给源服务器处理
+func ProxyRemoteImage(c *gin.Context) {
+	cfg := config.C.Emby.RemoteImages
+	if !cfg.Enable {
+		ProxyOrigin(c)
+		return
+	}
+	imageUrl := popQueryFold(c.Request.URL.Query(), "imageUrl")
+	u, err := url.Parse(imageUrl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !cfg.MatchHost(u.Hostname()) {
+		ProxyOrigin(c)
+		return
+	}
+
+	resp, err := https.RequestCtx(c.Request.Context(), http.MethodGet, u.String(), nil, nil)
+	if checkErr(c, err) {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf(colors.ToYellow("请求远程图片失败, url: %s, 响应码: %d"), imageUrl, resp.StatusCode)
+		c.Header(cache.HeaderKeyExpired, "-1")
+		c.Status(resp.StatusCode)
+		return
+	}
+
+	expired := cfg.ExpiredDuration()
+	c.Header(cache.HeaderKeyExpired, cache.Duration(expired))
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(expired.Seconds())))
+	c.DataFromReader(http.StatusOK, resp.ContentLength, resp.Header.Get("Content-Type"), resp.Body, nil)
+}
+
+// proxyRewriteRemoteImages 代理请求, 将 json 响应中的远程图片地址改写为代理地址
+func proxyRewriteRemoteImages(c *gin.Context) {
+	host := https.ClientRequestHost(c)
+	patcher := func(_, val string) (string, bool) {
+		return remoteImageProxyUrl(val, host)
+	}
+	checkErr(c, https.ProxyRequestWithHook(c, config.C.Emby.Host, true, https.JsonStringHook(patcher, func(cnt int) {
+		if cnt > 0 {
+			logs.Debugf(colors.ToBlue("远程图片地址已改写为代理地址, 个数: %d"), cnt)
+		}
+	})))
+}
+
+// remoteImageProxyUrl 将允许代理的远程图片地址转换为代理地址
+func remoteImageProxyUrl(val any, host string) (string, bool) {
+	raw, ok := val.(string)
+	if !ok || !strings.HasPrefix(raw, "http") {
+		return "", false
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || !config.C.Emby.RemoteImages.MatchHost(u.Hostname()) {
+		return "", false
+	}
+	q := url.Values{}
+	q.Set("ImageUrl", raw)
+	return host + remoteImagePath + "?" + q.Encode(), true
+}
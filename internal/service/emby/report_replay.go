@@ -0,0 +1,218 @@
+package emby
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/notify"
+	"github.com/AmbitiousJun/go-emby2alist/internal/store"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+
+	"github.com/gin-gonic/gin"
+)
+
+// reportQueueKey 重放队列在存储中的 key
+const reportQueueKey = "queue"
+
+// replayHeaders 重放上报请求时需要保留的请求头
+var replayHeaders = []string{
+	"Content-Type", HeaderAuthName, HeaderFullAuthName, QueryTokenName, "X-Emby-Device-Id",
+}
+
+// queuedReport 上报失败, 等待重放的请求
+type queuedReport struct {
+	Uri      string      // 请求 uri, 包含 query 参数
+	Header   http.Header // 请求头
+	Body     []byte      // 请求体
+	Device   string      // 上报的设备标识
+	QueuedAt time.Time   // 加入队列的时间
+}
+
+var (
+	// reportQueue 等待重放的上报请求, 按照上报顺序排列
+	reportQueue []queuedReport
+	// reportQueueMu 并发控制
+	reportQueueMu sync.Mutex
+	// reportReplayOnce 首次上报时加载磁盘中的队列, 并启动重放任务
+	reportReplayOnce sync.Once
+)
+
+// proxyPlaybackReport 代理客户端的播放状态上报请求
+//
+// emby 不可用时将请求加入重放队列, 并告知客户端上报成功, 待 emby 恢复后重放
+func proxyPlaybackReport(c *gin.Context) {
+	if !config.C.Emby.ReportReplay.Enable || c.Request.Method != http.MethodPost {
+		ProxyOrigin(c)
+		return
+	}
+	reportReplayOnce.Do(startReportReplay)
+
+	var bodyBytes []byte
+	if c.Request.Body != nil {
+		bodyBytes, _ = io.ReadAll(c.Request.Body)
+		c.Request.Body.Close()
+		c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+	}
+
+	device := sessionDevice(c)
+	err := https.ProxyRequestWithHook(c, config.C.Emby.Host, true, func(resp *http.Response) error {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("源服务器响应异常: %d", resp.StatusCode)
+		}
+		return nil
+	})
+	if err == nil {
+		notify.Success(notify.KindEmby)
+		discardStaleReports(device)
+		return
+	}
+
+	log.Printf(colors.ToYellow("播放状态上报失败, 加入重放队列: %v"), err)
+	notify.Failure(notify.KindEmby, err.Error())
+	header := make(http.Header)
+	for _, key := range replayHeaders {
+		if values, ok := c.Request.Header[http.CanonicalHeaderKey(key)]; ok {
+			header[http.CanonicalHeaderKey(key)] = values
+		}
+	}
+	enqueueReport(queuedReport{
+		Uri:      c.Request.URL.String(),
+		Header:   header,
+		Body:     bodyBytes,
+		Device:   device,
+		QueuedAt: time.Now(),
+	})
+	c.Status(http.StatusNoContent)
+}
+
+// enqueueReport 将上报请求加入重放队列, 超出最大个数时丢弃最早的请求
+func enqueueReport(r queuedReport) {
+	reportQueueMu.Lock()
+	defer reportQueueMu.Unlock()
+	reportQueue = append(reportQueue, r)
+	if maxSize := config.C.Emby.ReportReplay.MaxSize; len(reportQueue) > maxSize {
+		reportQueue = reportQueue[len(reportQueue)-maxSize:]
+	}
+	saveReportQueue()
+}
+
+// discardStaleReports 设备上报成功后, 队列中该设备的播放进度已经过时, 不再重放
+//
+// 开始播放和停止播放的上报会影响观看状态, 仍然保留
+func discardStaleReports(device string) {
+	reportQueueMu.Lock()
+	defer reportQueueMu.Unlock()
+	if len(reportQueue) == 0 {
+		return
+	}
+	kept := reportQueue[:0]
+	for _, r := range reportQueue {
+		if r.Device == device && isProgressReport(r.Uri) {
+			continue
+		}
+		kept = append(kept, r)
+	}
+	if len(kept) != len(reportQueue) {
+		reportQueue = kept
+		saveReportQueue()
+	}
+}
+
+// isProgressReport 判断上报请求是否为播放进度上报
+func isProgressReport(uri string) bool {
+	return strings.Contains(strings.ToLower(uri), "/sessions/playing/progress")
+}
+
+// startReportReplay 加载存储中的重放队列, 并启动定时重放任务
+func startReportReplay() {
+	reportQueueMu.Lock()
+	if _, err := store.Default().Get(store.BucketReportQueue, reportQueueKey, &reportQueue); err != nil {
+		log.Printf(colors.ToYellow("解析上报重放队列失败, 忽略已保存的请求: %v"), err)
+		reportQueue = nil
+	}
+	reportQueueMu.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(config.C.Emby.ReportReplay.IntervalDuration())
+		defer ticker.Stop()
+		for range ticker.C {
+			replayReports()
+		}
+	}()
+}
+
+// replayReports 按顺序重放队列中的上报请求, 出现网络异常时停止, 等待下一次重放
+func replayReports() {
+	reportQueueMu.Lock()
+	queue := make([]queuedReport, len(reportQueue))
+	copy(queue, reportQueue)
+	reportQueueMu.Unlock()
+	if len(queue) == 0 {
+		return
+	}
+
+	maxAge := config.C.Emby.ReportReplay.MaxAgeDuration()
+	done := 0
+	for i, r := range queue {
+		// 同一个设备只重放最后一次播放进度
+		superseded := isProgressReport(r.Uri) && func() bool {
+			for _, later := range queue[i+1:] {
+				if later.Device == r.Device && isProgressReport(later.Uri) {
+					return true
+				}
+			}
+			return false
+		}()
+		if superseded || time.Since(r.QueuedAt) > maxAge {
+			done++
+			continue
+		}
+
+		resp, err := https.Request(http.MethodPost, config.C.Emby.Host+r.Uri, r.Header.Clone(), io.NopCloser(bytes.NewReader(r.Body)))
+		if err != nil {
+			log.Printf(colors.ToYellow("重放播放状态上报失败, 等待下次重放: %v"), err)
+			break
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusInternalServerError {
+			log.Printf(colors.ToYellow("重放播放状态上报失败, 源服务器响应码: %d, 等待下次重放"), resp.StatusCode)
+			break
+		}
+		done++
+	}
+	if done == 0 {
+		return
+	}
+
+	log.Printf(colors.ToGreen("已处理 %d 个待重放的播放状态上报"), done)
+	reportQueueMu.Lock()
+	defer reportQueueMu.Unlock()
+	// 重放期间队列可能有变化, 只移除已处理的请求
+	processed := make(map[time.Time]struct{}, done)
+	for _, r := range queue[:done] {
+		processed[r.QueuedAt] = struct{}{}
+	}
+	kept := reportQueue[:0]
+	for _, r := range reportQueue {
+		if _, ok := processed[r.QueuedAt]; !ok {
+			kept = append(kept, r)
+		}
+	}
+	reportQueue = kept
+	saveReportQueue()
+}
+
+// saveReportQueue 将重放队列保存到存储中, 调用方需持有 reportQueueMu
+func saveReportQueue() {
+	if err := store.Default().Put(store.BucketReportQueue, reportQueueKey, reportQueue); err != nil {
+		log.Printf(colors.ToRed("保存上报重放队列失败: %v"), err)
+	}
+}
@@ -0,0 +1,71 @@
+package emby
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resolutionLimited 判断当前请求用户是否配置了最大分辨率/码率限制
+func resolutionLimited(user string) bool {
+	_, ok := config.C.MaxResolution.Limit(user)
+	return ok
+}
+
+// applyMaxResolution 受限用户只保留满足最大分辨率/码率限制的资源
+func applyMaxResolution(c *gin.Context, itemInfo ItemInfo, resJson *jsons.Item) {
+	user := requestUser(c)
+	limit, ok := config.C.MaxResolution.Limit(user)
+	if !ok {
+		return
+	}
+	mediaSources, ok := resJson.Attr("MediaSources").Done()
+	if !ok || mediaSources.Type() != jsons.JsonTypeArr {
+		return
+	}
+
+	kept, hidden := filterLimitedSources(mediaSources, limit)
+	if hidden == 0 {
+		return
+	}
+	resJson.Put("MediaSources", kept)
+	log.Printf(colors.ToBlue("用户 [%s] 超出最大分辨率/码率限制, 隐藏 item [%s] 的 %d 个资源, 剩余 %d 个"), user, itemInfo.Id, hidden, kept.Len())
+	if kept.Empty() {
+		log.Printf(colors.ToYellow("item [%s] 没有满足用户 [%s] 限制的资源, 请检查是否开启了转码资源代理"), itemInfo.Id, user)
+	}
+}
+
+// filterLimitedSources 过滤掉超出限制的资源, 返回保留的资源和被隐藏的资源个数
+func filterLimitedSources(mediaSources *jsons.Item, limit *config.ResolutionLimit) (*jsons.Item, int) {
+	kept, hidden := jsons.NewEmptyArr(), 0
+	mediaSources.RangeArr(func(_ int, source *jsons.Item) error {
+		if limit.Exceed(sourceResolution(source)) {
+			hidden++
+			return nil
+		}
+		kept.Append(source)
+		return nil
+	})
+	return kept, hidden
+}
+
+// sourceResolution 获取资源的视频高度和码率
+//
+// 转码资源是从原画资源复制的, 高度需要从 MediaSourceId 中记录的格式解析
+func sourceResolution(source *jsons.Item) (int, int64) {
+	bitrate, _ := jsonInt64(source.Attr("Bitrate"))
+	_, height := findMediaSourceRect(source)
+	id, _ := source.Attr("Id").String()
+	if msInfo, err := resolveMediaSourceId(id); err == nil && msInfo.Transcode {
+		var width int
+		if _, err := fmt.Sscanf(msInfo.Format, "%dx%d", &width, &height); err != nil {
+			height = 0
+		}
+	}
+	return height, bitrate
+}
@@ -0,0 +1,473 @@
+package emby
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/hooks"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/path"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/pathmap"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/mimes"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// alistResolved alist 资源解析结果
+type alistResolved struct {
+	path string         // 解析成功的 alist 路径
+	res  alist.Resource // 资源信息
+}
+
+// resolveDirectLink 按照 resolve.chain 配置依次尝试各个解析步骤,
+// 某一步失败时自动尝试下一步, 直到成功提供播放
+//
+// download 为 true 时, 本地文件以附件的形式响应给客户端
+func resolveDirectLink(c *gin.Context, embyPath string, alistPathRes path.AlistPathRes, download bool) {
+	cfg := config.C.Resolve
+
+	// alist 的两个步骤共用同一次解析结果
+	resolveAlist := sync.OnceValues(func() (alistResolved, error) {
+		if r, ok := loadWarmLink(AlistAccount(c), embyPath); ok {
+			logs.Debugf(colors.ToBlue("使用预解析的直链: %s"), embyPath)
+			return r, nil
+		}
+		r, err := fetchAlistResourceTimeout(c, alistPathRes, cfg.StepTimeoutDuration(), cfg.HedgeDelayDuration())
+		if err != nil {
+			hooks.Fire(hooks.EventAlistFailed, map[string]interface{}{
+				"embyPath":  embyPath,
+				"alistPath": alistPathRes.Path,
+				"error":     err.Error(),
+			})
+		}
+		return r, err
+	})
+
+	// 按照资源的真实容器修正响应类型, 避免部分播放器无法识别 application/octet-stream
+	contentType := streamContentType(c, embyPath)
+
+	chain, rule := geoChain(c, cfg.Chain)
+	if rule == nil {
+		chain = probeChain(c, chain)
+	}
+	// 命中地区规则或测速结果改变了解析链时, 决策原因归为客户端规则
+	reason := metrics.ReasonDefault
+	if rule != nil || !slices.Equal(chain, cfg.Chain) {
+		reason = metrics.ReasonClientRule
+	}
+	allErrors := strings.Builder{}
+	for _, step := range chain {
+		start := time.Now()
+		var err error
+		switch step {
+		case config.ResolveAlistRaw:
+			err = serveAlistLink(c, resolveAlist, contentType, func(r alistResolved) string { return r.res.Url })
+		case config.ResolveAlistProxy:
+			err = serveAlistLink(c, resolveAlist, contentType, func(r alistResolved) string {
+				return alist.ProxyUrl(alistCtx(c, c.Request.Context()), r.path, r.res.Sign)
+			})
+		case config.ResolveCdn:
+			err = serveAlistLink(c, resolveAlist, contentType, func(r alistResolved) string { return rule.CdnPrefix + alist.ProxyPath(r.path, r.res.Sign) })
+		case config.ResolveLocal:
+			err = serveLocalFile(c, embyPath, contentType, download)
+		case config.ResolveOrigin:
+			c.Header(cache.HeaderKeyExpired, "-1")
+			err = https.ProxyRequestWithHook(c, config.C.Emby.Host, true, contentTypeHook(contentType))
+		}
+
+		if err == nil {
+			log.Printf(colors.ToGreen("直链解析步骤 [%s] 提供播放, 耗时: %v, embyPath: %s"), step, time.Since(start), embyPath)
+			if allErrors.Len() > 0 {
+				reason = metrics.ReasonFailure
+			}
+			recordDecision(c, stepDecision(step), reason)
+			if step == config.ResolveAlistRaw || step == config.ResolveAlistProxy || step == config.ResolveCdn {
+				r, _ := resolveAlist()
+				recordPlay(c, string(step), r.res.Size, true)
+				fireDirectLink(c, string(step), embyPath, c.Writer.Header().Get("Location"))
+			} else {
+				recordPlay(c, string(step), int64(c.Writer.Size()), false)
+			}
+			return
+		}
+		log.Printf(colors.ToYellow("直链解析步骤 [%s] 失败: %v"), step, err)
+		allErrors.WriteString(fmt.Sprintf("[%s] %v;", step, err))
+
+		// 步骤失败之前已经向客户端写入了响应 (如串流中途断开), 无法再尝试下一步
+		if c.Writer.Written() {
+			log.Printf(colors.ToRed("直链解析步骤 [%s] 失败时已经写入了响应, 不再尝试后续步骤, embyPath: %s"), step, embyPath)
+			recordDecision(c, stepDecision(step), metrics.ReasonFailure)
+			metrics.RecordError(fmt.Sprintf("直链解析步骤 [%s] 中途失败, uri: %s, err: %v", step, c.Request.URL.Path, err))
+			return
+		}
+	}
+
+	// 异常码以 alist 的解析结果为准
+	code := apierr.AlistResolveFailed
+	if _, err := resolveAlist(); err != nil {
+		code = apierr.CodeOf(err)
+	}
+	checkErr(c, apierr.New(code, "获取直链失败: %s", allErrors.String()))
+}
+
+// stepDecision 获取直链解析步骤对应的改写决策
+func stepDecision(step config.ResolveStep) string {
+	switch step {
+	case config.ResolveAlistRaw, config.ResolveCdn:
+		return metrics.DecisionRedirect
+	case config.ResolveOrigin:
+		return metrics.DecisionOrigin
+	default:
+		return metrics.DecisionProxy
+	}
+}
+
+// sourceAlistPath 转换 MediaSource 的路径, 并附带资源的大小和时长, 用于路径不存在时查找重命名后的文件
+func sourceAlistPath(source MediaSource) path.AlistPathRes {
+	res := path.Emby2Alist(source.Path)
+	res.Size, res.RunTime = source.Size, time.Duration(source.RunTimeTicks*100)
+	return res
+}
+
+// fetchAlistResource 依次尝试所有可能的 alist 路径, 获取原画资源
+func fetchAlistResource(c *gin.Context, alistPathRes path.AlistPathRes) (alistResolved, error) {
+	return fetchAlistResourceCtx(alistCtx(c, c.Request.Context()), c.Request.Header.Clone(), alistPathRes, func(d time.Duration) {
+		https.RecordUpstream(c, "alist", d)
+	})
+}
+
+// fetchAlistResourceTimeout 在 timeout 时间内获取原画资源, 超过 hedgeDelay 仍未返回时并发再获取一次
+//
+// 超时之后后台的解析仍可能继续执行, 而 gin 会复用 c 处理其他请求,
+// 因此后台只使用提前取出的请求头, alist 账号和上下文, 耗时在返回之后再记录到 c 中
+func fetchAlistResourceTimeout(c *gin.Context, alistPathRes path.AlistPathRes, timeout, hedgeDelay time.Duration) (alistResolved, error) {
+	header := c.Request.Header.Clone()
+	ctx, cancel := context.WithCancel(alistCtx(c, c.Request.Context()))
+	defer cancel()
+
+	var (
+		timings   []time.Duration
+		timingsMu sync.Mutex
+	)
+	record := func(d time.Duration) {
+		timingsMu.Lock()
+		defer timingsMu.Unlock()
+		timings = append(timings, d)
+	}
+
+	r, err := withTimeout(timeout, func() (alistResolved, error) {
+		return hedged(ctx, hedgeDelay, func() (alistResolved, error) {
+			return fetchAlistResourceCtx(ctx, header, alistPathRes, record)
+		})
+	})
+	cancel()
+
+	timingsMu.Lock()
+	defer timingsMu.Unlock()
+	for _, d := range timings {
+		https.RecordUpstream(c, "alist", d)
+	}
+	return r, err
+}
+
+// fetchAlistResourceCtx 与 fetchAlistResource 相同, 不依赖客户端请求, record 用于记录每次请求 alist 的耗时
+func fetchAlistResourceCtx(ctx context.Context, header http.Header, alistPathRes path.AlistPathRes, record func(time.Duration)) (alistResolved, error) {
+	fi := alist.FetchInfo{Header: header, Ctx: ctx}
+	allErrors := strings.Builder{}
+	// notFound 所有尝试的路径在 alist 中均不存在, 说明路径映射有误
+	notFound := true
+	fetch := func(path string) (alistResolved, bool) {
+		logs.Debugf(colors.ToBlue("尝试请求 Alist 资源: %s"), path)
+		fi.Path = path
+		start := time.Now()
+		res := alist.FetchResource(fi)
+		record(time.Since(start))
+		if res.Code != http.StatusOK {
+			allErrors.WriteString(fmt.Sprintf("请求 Alist 失败, code: %d, msg: %s, path: %s;", res.Code, res.Msg, path))
+			notFound = notFound && strings.Contains(strings.ToLower(res.Msg), "not found")
+			return alistResolved{}, false
+		}
+		return alistResolved{path: path, res: res.Data}, true
+	}
+
+	// 优先使用手动指定的路径, 请求失败时继续自动映射
+	account, cacheable := alist.AccountOf(ctx), strs.AllNotEmpty(alistPathRes.EmbyPath)
+	if p, ok := pathmap.GetOverride(alistPathRes.EmbyPath); cacheable && ok {
+		if r, ok := fetch(p); ok {
+			return r, nil
+		}
+		log.Printf(colors.ToYellow("手动指定的路径请求失败, 尝试自动映射: %s"), p)
+	}
+
+	// 其次使用缓存的映射结果, 请求失败时缓存失效, 重新遍历
+	cached := ""
+	if cacheable {
+		if p, ok := pathmap.Get(account, alistPathRes.EmbyPath); ok {
+			if r, ok := fetch(p); ok {
+				return r, nil
+			}
+			cached = p
+			pathmap.Remove(account, alistPathRes.EmbyPath)
+		}
+	}
+	done := func(r alistResolved) (alistResolved, error) {
+		if cacheable {
+			pathmap.Put(account, alistPathRes.EmbyPath, r.path)
+		}
+		return r, nil
+	}
+
+	if alistPathRes.Success && alistPathRes.Path != cached {
+		if r, ok := fetch(alistPathRes.Path); ok {
+			return done(r)
+		}
+	}
+	paths, err := alistPathRes.Range()
+	if err != nil {
+		return alistResolved{}, apierr.Wrap(apierr.UpstreamAlistDown, err)
+	}
+	for _, path := range paths {
+		if path == cached {
+			continue
+		}
+		if r, ok := fetch(path); ok {
+			return done(r)
+		}
+	}
+
+	// 路径存在 Unicode 形式或大小写差异时, 逐级查找 alist 中的真实路径
+	if pc := config.C.Path; notFound && alistPathRes.Success && (pc.IgnoreCase || pc.Normalize != config.PathNormalizeNone) {
+		if p, err := path.FindFold(ctx, alistPathRes.Path); err == nil && p != alistPathRes.Path {
+			if r, ok := fetch(p); ok {
+				return done(r)
+			}
+		} else if err != nil {
+			allErrors.WriteString(err.Error() + ";")
+		}
+	}
+
+	// 文件在网盘中被重命名时, 在父目录中按照大小查找, 并记住修正后的路径
+	if notFound && alistPathRes.Success && config.C.Path.FuzzyMatch {
+		if p, err := path.FindMoved(ctx, alistPathRes.Path, alistPathRes.Size, alistPathRes.RunTime); err == nil {
+			if r, ok := fetch(p); ok {
+				log.Printf(colors.ToYellow("路径在 alist 中不存在, 按照文件大小匹配到: %s => %s"), alistPathRes.Path, p)
+				if cacheable {
+					pathmap.Correct(account, alistPathRes.EmbyPath, p)
+				}
+				return r, nil
+			}
+		} else {
+			allErrors.WriteString(err.Error() + ";")
+		}
+	}
+	if notFound {
+		return alistResolved{}, apierr.New(apierr.PathMapMiss, "%s", allErrors.String())
+	}
+	return alistResolved{}, apierr.New(apierr.AlistResolveFailed, "%s", allErrors.String())
+}
+
+// serveAlistLink 将客户端重定向到 alist 链接, link 用于从解析结果中生成链接
+//
+// contentType 不为空时设置到重定向响应中, 供部分根据响应类型选择解码器的播放器使用
+func serveAlistLink(c *gin.Context, resolve func() (alistResolved, error), contentType string, link func(alistResolved) string) error {
+	r, err := resolve()
+	if err != nil {
+		return err
+	}
+	u := link(r)
+	if config.C.Resolve.Probe {
+		ctx, cancel := context.WithTimeout(c.Request.Context(), config.C.Resolve.ProbeTimeoutDuration())
+		err := probeLink(ctx, u)
+		cancel()
+		if errors.Is(err, errLinkExpired) {
+			return err
+		}
+		if err != nil {
+			// 超时或网络异常时无法确定链接已失效, 继续使用该链接, 避免误回退到更慢的步骤
+			logs.Debugf(colors.ToYellow("探测链接失败, 继续使用: %v"), err)
+		}
+	}
+	log.Printf(colors.ToGreen("请求成功, 重定向到: %s"), u)
+	c.Header(cache.HeaderKeyExpired, cache.Duration(time.Minute*10))
+	if contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	c.Redirect(http.StatusTemporaryRedirect, u)
+	return nil
+}
+
+// ginKeyStreamContainer 记录当前串流资源在 PlaybackInfo 中的容器名称的 gin key
+const ginKeyStreamContainer = "stream-container"
+
+// streamContentType 获取当前串流资源的 MIME 类型, 优先使用 PlaybackInfo 中的容器, 其次使用文件扩展名
+//
+// 无法识别时返回空字符串
+func streamContentType(c *gin.Context, embyPath string) string {
+	contentType, _ := mimes.Resolve(c.GetString(ginKeyStreamContainer), embyPath)
+	return contentType
+}
+
+// contentTypeHook 回源串流时, 将不准确的响应类型修正为 contentType
+func contentTypeHook(contentType string) https.ResponseHook {
+	if contentType == "" {
+		return nil
+	}
+	return func(resp *http.Response) error {
+		if resp.StatusCode < http.StatusBadRequest && mimes.Inaccurate(resp.Header.Get("Content-Type")) {
+			resp.Header.Set("Content-Type", contentType)
+		}
+		return nil
+	}
+}
+
+// errLinkExpired 探测到链接已经失效 (403/404/410), 需要回退到下一个解析步骤
+var errLinkExpired = errors.New("链接已失效")
+
+// probeLink 使用 HEAD 请求探测链接是否可用, 确认链接已失效时返回 errLinkExpired
+//
+// 部分网盘的签名链接只对 GET 请求有效, HEAD 请求响应 403/405 时使用 Range 请求第一个字节再次确认
+func probeLink(ctx context.Context, u string) error {
+	code, err := probeStatus(ctx, http.MethodHead, u)
+	if err == nil && (code == http.StatusForbidden || code == http.StatusMethodNotAllowed) {
+		code, err = probeStatus(ctx, http.MethodGet, u)
+	}
+	if err != nil {
+		return err
+	}
+	switch code {
+	case http.StatusOK, http.StatusPartialContent:
+		return nil
+	case http.StatusForbidden, http.StatusNotFound, http.StatusGone:
+		return fmt.Errorf("%w, 响应码: %d", errLinkExpired, code)
+	}
+	return fmt.Errorf("响应码: %d", code)
+}
+
+// probeStatus 请求链接, 返回跟随重定向之后的响应码
+func probeStatus(ctx context.Context, method, u string) (int, error) {
+	header := make(http.Header)
+	header.Set("Range", "bytes=0-0")
+	_, resp, err := https.RequestRedirectCtx(ctx, method, u, header, nil, true)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
+
+// serveLocalFile 直接读取本地挂载的文件响应给客户端, 支持 Range 请求
+func serveLocalFile(c *gin.Context, embyPath, contentType string, download bool) error {
+	localPath := filepath.FromSlash(config.C.Resolve.MapLocal(embyPath))
+	file, err := os.Open(localPath)
+	if err != nil {
+		return fmt.Errorf("打开本地文件失败: %v", err)
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil || stat.IsDir() {
+		return fmt.Errorf("本地文件不可用: %s", localPath)
+	}
+
+	c.Header(cache.HeaderKeyExpired, "-1")
+	if download {
+		c.Header("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": stat.Name()}))
+	}
+	if contentType != "" {
+		c.Header("Content-Type", contentType)
+	}
+	http.ServeContent(c.Writer, c.Request, stat.Name(), stat.ModTime(), file)
+	return nil
+}
+
+// withTimeout 在 timeout 时间内执行 fn, 超时后直接返回错误, 不等待 fn 执行完毕
+func withTimeout[T any](timeout time.Duration, fn func() (T, error)) (T, error) {
+	type result struct {
+		val T
+		err error
+	}
+	ch := make(chan result, 1)
+	go func() {
+		val, err := fn()
+		ch <- result{val: val, err: err}
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case r := <-ch:
+		return r.val, r.err
+	case <-timer.C:
+		var zero T
+		return zero, fmt.Errorf("超时 (%v)", timeout)
+	}
+}
+
+// hedged 执行 fn, 超过 delay 仍未返回时并发再执行一次, 返回先成功的结果
+//
+// delay 为零值时不启用; 首次执行在 delay 之前失败时直接返回错误, 两次执行都失败时返回最先出现的错误;
+// ctx 结束之后不再发起第二次执行, 直接返回 ctx 的错误
+func hedged[T any](ctx context.Context, delay time.Duration, fn func() (T, error)) (T, error) {
+	if delay <= 0 {
+		return fn()
+	}
+
+	type result struct {
+		val T
+		err error
+	}
+	ch := make(chan result, 2)
+	run := func() {
+		val, err := fn()
+		ch <- result{val: val, err: err}
+	}
+	go run()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	pending := 1
+	var firstErr error
+	for {
+		select {
+		case r := <-ch:
+			pending--
+			if r.err == nil {
+				return r.val, nil
+			}
+			if firstErr == nil {
+				firstErr = r.err
+			}
+			if pending == 0 {
+				var zero T
+				return zero, firstErr
+			}
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		case <-timer.C:
+			if ctx.Err() != nil {
+				continue
+			}
+			log.Printf(colors.ToYellow("alist 解析耗时超过 %v, 并发发起第二次解析"), delay)
+			pending++
+			go run()
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package emby
+
+import (
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+
+	"github.com/gin-gonic/gin"
+)
+
+// playPosition 客户端上报的播放进度
+type playPosition struct {
+	mediaSourceId string    // 上报进度时播放的资源 id
+	ticks         int64     // 播放进度
+	reportAt      time.Time // 上报时间
+}
+
+var (
+	// playPositions 用户 + item id => 播放进度
+	playPositions = map[string]playPosition{}
+	// playPositionsMu 并发控制
+	playPositionsMu sync.Mutex
+)
+
+// recordPlayPosition 记录客户端在播放状态上报接口中携带的播放进度
+func recordPlayPosition(c *gin.Context) {
+	if !config.C.VideoPreview.ResumeOnSwitch.Enable {
+		return
+	}
+	body, ok := reportBody(c)
+	if !ok {
+		return
+	}
+
+	itemId, _ := body.Attr("ItemId").String()
+	ticks, ok := body.Attr("PositionTicks").Int64()
+	if strs.AnyEmpty(itemId) || !ok {
+		return
+	}
+	mediaSourceId, _ := body.Attr("MediaSourceId").String()
+	if unescaped, err := url.QueryUnescape(mediaSourceId); err == nil {
+		mediaSourceId = unescaped
+	}
+
+	key := playPositionKey(c, itemId)
+	playPositionsMu.Lock()
+	defer playPositionsMu.Unlock()
+	if playingStoppedRegex.MatchString(c.Request.URL.Path) && ticks == 0 {
+		// 播放结束时部分客户端会上报 0 进度, 不覆盖已有的进度
+		return
+	}
+	playPositions[key] = playPosition{mediaSourceId: mediaSourceId, ticks: ticks, reportAt: time.Now()}
+}
+
+// applyResumePosition 客户端切换资源时, 注入切换前的播放进度
+//
+// 客户端已经指定了 StartTimeTicks, 或者请求的资源与上报进度时的资源一致时不处理
+func applyResumePosition(c *gin.Context, itemInfo ItemInfo, jsonBody, source *jsons.Item) {
+	cfg := config.C.VideoPreview.ResumeOnSwitch
+	if !cfg.Enable || itemInfo.MsInfo.Empty {
+		return
+	}
+	if start, err := strconv.ParseInt(c.Query("StartTimeTicks"), 10, 64); err == nil && start > 0 {
+		return
+	}
+
+	key := playPositionKey(c, itemInfo.Id)
+	playPositionsMu.Lock()
+	pos, ok := playPositions[key]
+	if ok && time.Since(pos.reportAt) > cfg.WindowDuration() {
+		delete(playPositions, key)
+		ok = false
+	}
+	playPositionsMu.Unlock()
+
+	reqId, _ := url.QueryUnescape(itemInfo.MsInfo.RawId)
+	if !ok || pos.ticks <= 0 || pos.mediaSourceId == reqId {
+		return
+	}
+
+	ticks := strconv.FormatInt(pos.ticks, 10)
+	jsonBody.Put("StartTimeTicks", jsons.NewByVal(pos.ticks))
+	if dsu, ok := source.Attr("DirectStreamUrl").String(); ok && strs.AllNotEmpty(dsu) {
+		source.Put("DirectStreamUrl", jsons.NewByVal(urls.AppendArgs(dsu, "StartTimeTicks", ticks)))
+	}
+	logs.Debugf(colors.ToBlue("切换资源, 从上次的播放进度继续播放, itemId: %s, ticks: %s"), itemInfo.Id, ticks)
+}
+
+// playPositionKey 计算播放进度的存储 key, 获取不到用户时使用设备标识
+func playPositionKey(c *gin.Context, itemId string) string {
+	owner := requestUser(c)
+	if owner == "" {
+		owner = sessionDevice(c)
+	}
+	return owner + "|" + itemId
+}
@@ -0,0 +1,193 @@
+package emby
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/cluster"
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// playingStoppedRegex 匹配客户端的停止播放上报接口
+var playingStoppedRegex = regexp.MustCompile(`(?i)/sessions/playing/stopped`)
+
+var (
+	// streamSessions 用户 => 设备 id => 最后活跃时间
+	streamSessions = map[string]map[string]time.Time{}
+	// streamSessionsMu 并发控制
+	streamSessionsMu sync.Mutex
+)
+
+// TrackPlaybackSession 代理客户端的播放状态上报接口, 同时维护用户的串流会话和播放进度,
+// 记录直链资源的播放失败, 并在播放进度达到阈值时预解析播放队列中的下一个 item;
+// 停止播放时清除用户的首页列表缓存
+func TrackPlaybackSession(c *gin.Context) {
+	user, device := requestUser(c), sessionDevice(c)
+	if user != "" {
+		if playingStoppedRegex.MatchString(c.Request.URL.Path) {
+			removeStreamSession(user, device)
+		} else {
+			touchStreamSession(user, device)
+		}
+	}
+	firePlaybackEvent(c, user, device)
+	recordPlayPosition(c)
+	recordPlaybackFailure(c, device)
+	warmupNextQueued(c, user)
+	proxyPlaybackReport(c)
+	if playingStoppedRegex.MatchString(c.Request.URL.Path) {
+		// 停止播放之后继续观看和下一集列表发生变化, 上报转发完成之后再清除缓存
+		purgeHomeLists(user)
+	}
+}
+
+// checkStreamLimit 记录用户的串流会话, 并检查用户的并发串流数是否超出限制
+//
+// 超出限制时按照 stream-limit.strategy 配置处理, 返回 true 表示请求已经被处理
+func checkStreamLimit(c *gin.Context) bool {
+	user := requestUser(c)
+	if user == "" {
+		return false
+	}
+	device := sessionDevice(c)
+
+	cfg := config.C.StreamLimit
+	limit := cfg.Limit(user)
+	if cfg.Enable && limit > 0 {
+		if active := activeStreams(user, device); active >= limit {
+			log.Printf(colors.ToYellow("用户 [%s] 的并发串流数已达上限: %d, 处理策略: %s"), user, limit, cfg.Strategy)
+			c.Header(cache.HeaderKeyExpired, "-1")
+			if cfg.Strategy == config.StreamLimitOrigin {
+				recordDecision(c, metrics.DecisionOrigin, metrics.ReasonPolicy)
+				ProxyOrigin(c)
+				return true
+			}
+			recordDecision(c, metrics.DecisionReject, metrics.ReasonPolicy)
+			apierr.Respond(c, http.StatusTooManyRequests, apierr.StreamLimited, cfg.Message)
+			return true
+		}
+	}
+
+	touchStreamSession(user, device)
+	return false
+}
+
+// sessionDevice 获取串流会话的设备标识, 获取不到设备 id 时使用客户端 ip 代替
+func sessionDevice(c *gin.Context) string {
+	if device := requestDeviceId(c); device != "" {
+		return device
+	}
+	return c.ClientIP()
+}
+
+// activeStreams 统计用户在其他设备上的活跃串流数, 同时清理过期的会话
+//
+// 集群模式下统计所有副本上的会话
+func activeStreams(user, excludeDevice string) int {
+	timeout := config.C.StreamLimit.SessionTimeoutDuration()
+	streamSessionsMu.Lock()
+	devices := streamSessions[user]
+	for device, lastSeen := range devices {
+		if time.Since(lastSeen) > timeout {
+			delete(devices, device)
+		}
+	}
+	streamSessionsMu.Unlock()
+
+	count := 0
+	for device, lastSeen := range allStreamSessions()[user] {
+		if time.Since(lastSeen) <= timeout && device != excludeDevice {
+			count++
+		}
+	}
+	return count
+}
+
+// touchStreamSession 刷新用户在指定设备上的会话活跃时间
+func touchStreamSession(user, device string) {
+	now := time.Now()
+	streamSessionsMu.Lock()
+	if streamSessions[user] == nil {
+		streamSessions[user] = map[string]time.Time{}
+	}
+	streamSessions[user][device] = now
+	streamSessionsMu.Unlock()
+
+	if cluster.Enabled() {
+		ttl := config.C.StreamLimit.SessionTimeoutDuration()
+		cluster.HSet(cluster.Key("sessions"), sessionField(user, device), strconv.FormatInt(now.UnixMilli(), 10), ttl)
+	}
+}
+
+// removeStreamSession 移除用户在指定设备上的会话
+func removeStreamSession(user, device string) {
+	streamSessionsMu.Lock()
+	delete(streamSessions[user], device)
+	streamSessionsMu.Unlock()
+
+	if cluster.Enabled() {
+		cluster.HDel(cluster.Key("sessions"), sessionField(user, device))
+	}
+}
+
+// allStreamSessions 获取所有用户的会话快照: 用户 => 设备 id => 最后活跃时间
+//
+// 集群模式下合并 redis 中共享的会话注册表, 同一个会话使用最近的活跃时间
+func allStreamSessions() map[string]map[string]time.Time {
+	res := map[string]map[string]time.Time{}
+	put := func(user, device string, lastSeen time.Time) {
+		if res[user] == nil {
+			res[user] = map[string]time.Time{}
+		}
+		if lastSeen.After(res[user][device]) {
+			res[user][device] = lastSeen
+		}
+	}
+
+	streamSessionsMu.Lock()
+	for user, devices := range streamSessions {
+		for device, lastSeen := range devices {
+			put(user, device, lastSeen)
+		}
+	}
+	streamSessionsMu.Unlock()
+
+	if !cluster.Enabled() {
+		return res
+	}
+	shared, ok := cluster.HGetAll(cluster.Key("sessions"))
+	if !ok {
+		return res
+	}
+	timeout := config.C.StreamLimit.SessionTimeoutDuration()
+	expired := make([]string, 0)
+	for field, millis := range shared {
+		user, device, ok := strings.Cut(field, "\n")
+		ms, err := strconv.ParseInt(millis, 10, 64)
+		if !ok || err != nil || time.Since(time.UnixMilli(ms)) > timeout {
+			expired = append(expired, field)
+			continue
+		}
+		put(user, device, time.UnixMilli(ms))
+	}
+	if len(expired) > 0 {
+		cluster.HDel(cluster.Key("sessions"), expired...)
+	}
+	return res
+}
+
+// sessionField 会话在共享注册表中的字段名
+func sessionField(user, device string) string {
+	return user + "\n" + device
+}
@@ -0,0 +1,178 @@
+package emby
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+)
+
+// StreamSession 代理记录的串流会话
+type StreamSession struct {
+	User           string    // 用户名
+	Device         string    // 设备 id, 获取不到设备 id 时为客户端 ip
+	LastSeen       time.Time // 最后活跃时间
+	EmbySessionIds []string  // 对应的 emby 会话 id
+	NowPlaying     string    // 正在播放的资源名称
+}
+
+// ErrSessionNotFound 找不到对应的 emby 会话
+var ErrSessionNotFound = errors.New("找不到对应的 emby 会话")
+
+// ActiveStreamSessions 获取代理记录的所有活跃串流会话, 不请求 emby
+func ActiveStreamSessions() []StreamSession {
+	timeout := config.C.StreamLimit.SessionTimeoutDuration()
+	res := make([]StreamSession, 0)
+	for user, devices := range allStreamSessions() {
+		for device, lastSeen := range devices {
+			if time.Since(lastSeen) > timeout {
+				continue
+			}
+			res = append(res, StreamSession{User: user, Device: device, LastSeen: lastSeen})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].LastSeen.After(res[j].LastSeen) })
+	return res
+}
+
+// StreamSessions 获取代理记录的所有活跃串流会话, 并关联 emby 的会话信息
+func StreamSessions() []StreamSession {
+	res := ActiveStreamSessions()
+	embySessions, err := fetchEmbySessions()
+	if err != nil {
+		log.Printf(colors.ToYellow("获取 emby 会话列表失败: %v"), err)
+	}
+	for i := range res {
+		for _, es := range matchEmbySessions(embySessions, res[i].User, res[i].Device) {
+			id, _ := es.Attr("Id").String()
+			res[i].EmbySessionIds = append(res[i].EmbySessionIds, id)
+			if name, ok := es.Attr("NowPlayingItem").Attr("Name").String(); ok {
+				res[i].NowPlaying = name
+			}
+		}
+	}
+	return res
+}
+
+// StopStreamSession 停止用户在指定设备上的播放, device 为空时停止用户的所有播放
+//
+// 返回成功发送停止指令的 emby 会话个数
+func StopStreamSession(user, device string) (int, error) {
+	count, err := sendSessionCommand(user, device, "/Playing/Stop", nil)
+	if err != nil {
+		return count, err
+	}
+	devices := []string{device}
+	if device == "" {
+		devices = sessionDevices(user)
+	}
+	for _, d := range devices {
+		removeStreamSession(user, d)
+	}
+	log.Printf(colors.ToYellow("已停止用户 [%s] 的播放, 设备: %s, 会话数: %d"), user, device, count)
+	return count, nil
+}
+
+// SendSessionMessage 向用户在指定设备上的客户端发送消息, device 为空时发送到用户的所有设备
+//
+// 返回成功发送消息的 emby 会话个数
+func SendSessionMessage(user, device, header, text string, timeout time.Duration) (int, error) {
+	body := map[string]interface{}{"Header": header, "Text": text}
+	if timeout > 0 {
+		body["TimeoutMs"] = timeout.Milliseconds()
+	}
+	return sendSessionCommand(user, device, "/Message", body)
+}
+
+// sendSessionCommand 向代理会话对应的所有 emby 会话发送控制指令
+func sendSessionCommand(user, device, command string, body map[string]interface{}) (int, error) {
+	if strs.AnyEmpty(user) {
+		return 0, errors.New("用户名不能为空")
+	}
+	embySessions, err := fetchEmbySessions()
+	if err != nil {
+		return 0, err
+	}
+
+	var targets []*jsons.Item
+	if device != "" {
+		targets = matchEmbySessions(embySessions, user, device)
+	} else {
+		for _, d := range sessionDevices(user) {
+			targets = append(targets, matchEmbySessions(embySessions, user, d)...)
+		}
+	}
+	if len(targets) == 0 {
+		return 0, ErrSessionNotFound
+	}
+
+	count := 0
+	for _, target := range targets {
+		id, _ := target.Attr("Id").String()
+		u := urls.AppendArgs(config.C.Emby.Host+"/emby/Sessions/"+id+command, QueryApiKeyName, config.C.Emby.ApiKey)
+		header := make(http.Header)
+		header.Set("Content-Type", "application/json;charset=utf-8")
+		resp, err := https.Request(http.MethodPost, u, header, https.MapBody(body))
+		if err != nil {
+			return count, fmt.Errorf("发送指令失败: %v", err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= http.StatusBadRequest {
+			return count, fmt.Errorf("发送指令失败, 会话: %s, 响应码: %d", id, resp.StatusCode)
+		}
+		count++
+	}
+	return count, nil
+}
+
+// fetchEmbySessions 获取 emby 的会话列表
+func fetchEmbySessions() (*jsons.Item, error) {
+	res, _ := Fetch("/emby/Sessions", http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return nil, errors.New(res.Msg)
+	}
+	if res.Data.Type() != jsons.JsonTypeArr {
+		return nil, errors.New("会话列表格式错误")
+	}
+	return res.Data, nil
+}
+
+// matchEmbySessions 从 emby 会话列表中找出用户在指定设备上的会话
+//
+// 代理会话的设备标识可能是客户端 ip, 此时匹配 emby 会话的 RemoteEndPoint
+func matchEmbySessions(embySessions *jsons.Item, user, device string) []*jsons.Item {
+	var res []*jsons.Item
+	if embySessions == nil {
+		return res
+	}
+	embySessions.RangeArr(func(_ int, es *jsons.Item) error {
+		if name, _ := es.Attr("UserName").String(); name != user {
+			return nil
+		}
+		deviceId, _ := es.Attr("DeviceId").String()
+		remote, _ := es.Attr("RemoteEndPoint").String()
+		if deviceId == device || remote == device {
+			res = append(res, es)
+		}
+		return nil
+	})
+	return res
+}
+
+// sessionDevices 获取用户所有会话的设备 id, 集群模式下包括其他副本上的会话
+func sessionDevices(user string) []string {
+	devices := make([]string, 0)
+	for d := range allStreamSessions()[user] {
+		devices = append(devices, d)
+	}
+	return devices
+}
@@ -0,0 +1,236 @@
+package emby
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/redact"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// shadowTimeout 单次影子请求的超时时间
+	shadowTimeout = time.Second * 30
+	// shadowMaxDiffs 每个请求最多输出的差异个数
+	shadowMaxDiffs = 20
+)
+
+// shadowExcludes 不参与影子的请求, 串流、图片、websocket 等请求体积大或者不是接口响应
+var shadowExcludes = []*regexp.Regexp{
+	regexp.MustCompile(constant.Reg_Socket),
+	regexp.MustCompile(constant.Reg_ResourceStream),
+	regexp.MustCompile(constant.Reg_ResourceMaster),
+	regexp.MustCompile(constant.Reg_ResourceMain),
+	regexp.MustCompile(constant.Reg_VideoSubtitles),
+	regexp.MustCompile(constant.Reg_Trickplay),
+	regexp.MustCompile(constant.Reg_ItemDownload),
+	regexp.MustCompile(constant.Reg_Images),
+	regexp.MustCompile(`(?i)^/(admin|feeds|dav|play|probe)(/|$|\?)`),
+}
+
+// shadowSemaphores 并发数 => 影子请求的并发控制信号量
+var shadowSemaphores = sync.Map{}
+
+// RequestShadower 请求影子中间件
+//
+// 按照 shadow 配置采样只读请求, 在后台将请求同时发送到源服务器和预发布服务器, 对比响应并输出差异日志
+func RequestShadower() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.C.Shadow
+		if !cfg.Enable || c.Request.Method != http.MethodGet || !shadowable(c.Request.RequestURI) {
+			return
+		}
+		if rand.Intn(100) >= cfg.Percent {
+			return
+		}
+
+		sem, _ := shadowSemaphores.LoadOrStore(cfg.Concurrency, make(chan struct{}, cfg.Concurrency))
+		ch := sem.(chan struct{})
+		select {
+		case ch <- struct{}{}:
+		default:
+			logs.Debugf("影子请求并发数已达上限, 跳过采样: %s", redact.String(c.Request.RequestURI))
+			return
+		}
+
+		// 后续的处理器可能改写请求, 在这里复制一份原始请求
+		uri, header := c.Request.URL.RequestURI(), c.Request.Header.Clone()
+		go func() {
+			defer func() { <-ch }()
+			compareShadow(uri, header)
+		}()
+	}
+}
+
+// shadowable 判断请求是否需要影子
+func shadowable(uri string) bool {
+	for _, reg := range shadowExcludes {
+		if reg.MatchString(uri) {
+			return false
+		}
+	}
+	return config.C.Shadow.Match(uri)
+}
+
+// shadowResp 影子请求的响应
+type shadowResp struct {
+	code      int
+	body      []byte
+	json      bool // 响应体是否为 json
+	truncated bool // 响应体是否超出对比的大小限制
+}
+
+// compareShadow 将请求分别发送到源服务器和预发布服务器, 对比两者的响应码和 json 响应体的结构
+func compareShadow(uri string, header http.Header) {
+	// 由 http 客户端协商压缩, 条件请求头会使响应体为空, 都不转发
+	header.Del("Accept-Encoding")
+	header.Del("If-None-Match")
+	header.Del("If-Modified-Since")
+
+	var (
+		origin, staging       shadowResp
+		originErr, stagingErr error
+		wg                    sync.WaitGroup
+	)
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		origin, originErr = fetchShadow(config.C.Emby.Host, uri, header.Clone())
+	}()
+	go func() {
+		defer wg.Done()
+		staging, stagingErr = fetchShadow(config.C.Shadow.Host, uri, header.Clone())
+	}()
+	wg.Wait()
+
+	target := redact.String(uri)
+	if originErr != nil || stagingErr != nil {
+		log.Printf(colors.ToYellow("[shadow] 请求失败, uri: %s, 源服务器: %v, 预发布服务器: %v"), target, originErr, stagingErr)
+		return
+	}
+
+	diffs := make([]string, 0)
+	if origin.code != staging.code {
+		diffs = append(diffs, fmt.Sprintf("响应码: %d => %d", origin.code, staging.code))
+	}
+	if origin.json != staging.json {
+		diffs = append(diffs, fmt.Sprintf("响应体是否为 json: %v => %v", origin.json, staging.json))
+	}
+	if origin.json && staging.json && !origin.truncated && !staging.truncated {
+		var originVal, stagingVal any
+		if json.Unmarshal(origin.body, &originVal) == nil && json.Unmarshal(staging.body, &stagingVal) == nil {
+			diffShape("$", originVal, stagingVal, &diffs)
+		}
+	}
+
+	if len(diffs) == 0 {
+		logs.Debugf("[shadow] 响应一致, uri: %s", target)
+		return
+	}
+	log.Printf(colors.ToYellow("[shadow] 响应存在差异, uri: %s\n  %s"), target, strings.Join(diffs, "\n  "))
+}
+
+// fetchShadow 向指定服务器发起影子请求, 响应体超出 shadow.max-body-size 时只读取到上限
+func fetchShadow(host, uri string, header http.Header) (shadowResp, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shadowTimeout)
+	defer cancel()
+	resp, err := https.RequestCtx(ctx, http.MethodGet, host+uri, header, nil)
+	if err != nil {
+		return shadowResp{}, err
+	}
+	defer resp.Body.Close()
+
+	max := config.C.Shadow.MaxBodySizeBytes()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		return shadowResp{}, fmt.Errorf("读取响应体失败: %v", err)
+	}
+	return shadowResp{
+		code:      resp.StatusCode,
+		body:      body,
+		json:      strings.Contains(resp.Header.Get("Content-Type"), "json"),
+		truncated: int64(len(body)) > max,
+	}, nil
+}
+
+// diffShape 对比两个 json 值的结构, 只对比字段是否存在和值的类型, 不对比具体的值
+//
+// 数组只对比第一个元素, null 与任意类型视为一致; 差异超出 shadowMaxDiffs 个时不再记录
+func diffShape(path string, origin, staging any, diffs *[]string) {
+	if len(*diffs) >= shadowMaxDiffs || origin == nil || staging == nil {
+		return
+	}
+	if ot, st := shapeType(origin), shapeType(staging); ot != st {
+		*diffs = append(*diffs, fmt.Sprintf("%s 类型: %s => %s", path, ot, st))
+		return
+	}
+
+	switch ov := origin.(type) {
+	case map[string]any:
+		sv := staging.(map[string]any)
+		keys := make([]string, 0, len(ov)+len(sv))
+		for key := range ov {
+			keys = append(keys, key)
+		}
+		for key := range sv {
+			if _, ok := ov[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if len(*diffs) >= shadowMaxDiffs {
+				return
+			}
+			o, inOrigin := ov[key]
+			s, inStaging := sv[key]
+			switch {
+			case !inStaging:
+				*diffs = append(*diffs, fmt.Sprintf("%s.%s 字段缺失", path, key))
+			case !inOrigin:
+				*diffs = append(*diffs, fmt.Sprintf("%s.%s 新增字段", path, key))
+			default:
+				diffShape(path+"."+key, o, s, diffs)
+			}
+		}
+	case []any:
+		sv := staging.([]any)
+		if len(ov) > 0 && len(sv) > 0 {
+			diffShape(path+"[0]", ov[0], sv[0], diffs)
+		}
+	}
+}
+
+// shapeType 获取 json 值的类型名称
+func shapeType(val any) string {
+	switch val.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case string:
+		return "string"
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	default:
+		return "null"
+	}
+}
@@ -0,0 +1,225 @@
+package emby
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/feature"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ginKeySimulateUser 模拟请求指定的用户名, 优先于从 token 中解析的用户
+const ginKeySimulateUser = "simulate-user"
+
+// SimulateParams 模拟的客户端信息
+type SimulateParams struct {
+	ItemId        string // item id
+	MediaSourceId string // 客户端请求携带的 MediaSourceId, 可为空
+	Client        string // 客户端名称 (X-Emby-Client)
+	Version       string // 客户端版本 (X-Emby-Client-Version)
+	Device        string // 设备 id
+	User          string // 用户名
+	UserAgent     string // 客户端的 User-Agent
+	Ip            string // 客户端 ip, 用于匹配地区规则
+	Body          []byte // 客户端请求 PlaybackInfo 时携带的 DeviceProfile, 为空时使用通用的 DeviceProfile
+}
+
+// Simulation 客户端请求 PlaybackInfo 的模拟结果
+type Simulation struct {
+	Rules   SimulateRules    // 命中的客户端规则
+	Rewrite bool             // PlaybackInfo 是否经过本程序改写, false 表示客户端拿到源服务器的原始响应
+	Code    int              // PlaybackInfo 的响应码
+	Sources []SimulateSource // 客户端拿到的资源, 第一个资源为客户端的默认选择
+	Error   string           `json:",omitempty"` // 模拟失败的原因
+}
+
+// SimulateRules 模拟请求命中的客户端规则
+type SimulateRules struct {
+	Passthrough       string   `json:",omitempty"` // 命中的 client-passthrough 规则原因
+	Rewrites          []string // 命中的 rewrite 规则名称
+	RewriteOrigin     bool     // 是否命中处理方式为 origin 的 rewrite 规则
+	LegacyClient      bool     // 是否为 legacy-client 旧设备
+	SubtitleBurnIn    bool     // 是否为需要烧录字幕的客户端
+	ForceOrigin       bool     // item 是否带有强制回源标签
+	NoPreview         bool     // item 是否带有不获取转码资源的标签
+	ResolutionLimited bool     // 用户是否受分辨率限制
+	DefaultPreview    bool     // 是否默认使用转码资源
+}
+
+// SimulateSource 客户端拿到的资源, 以及播放时本程序的处理方式
+type SimulateSource struct {
+	Id                         string
+	Name                       string
+	Decision                   string      // 播放时的处理方式: 302, proxy, origin, 与改写决策统计一致
+	Detail                     string      // 处理方式的说明
+	DefaultAudioStreamIndex    interface{} `json:",omitempty"`
+	DefaultSubtitleStreamIndex interface{} `json:",omitempty"`
+}
+
+// SimulatePlayback 模拟指定客户端请求 item 的 PlaybackInfo, 返回客户端会拿到的资源以及每个资源的播放方式
+//
+// 使用模拟的请求完整执行一次 PlaybackInfo 的处理逻辑, 不经过缓存中间件, 也不会真正播放资源
+func SimulatePlayback(p SimulateParams) Simulation {
+	s := Simulation{Rules: SimulateRules{Rewrites: []string{}}, Sources: []SimulateSource{}}
+
+	c, w, err := simulateContext(p)
+	if err != nil {
+		s.Error = err.Error()
+		return s
+	}
+
+	// 1 客户端规则
+	client, version, user := requestClient(c), requestClientVersion(c), requestUser(c)
+	if rule := matchPassthroughRule(config.C.ClientPassthrough.Rules, client, version); rule != nil {
+		s.Rules.Passthrough = rule.Reason
+		if strs.AnyEmpty(s.Rules.Passthrough) {
+			s.Rules.Passthrough = rule.Client
+		}
+	}
+	vars := RequestVars(c)
+	for _, rule := range config.C.Rewrite.Rules {
+		if rule.Match(vars) {
+			s.Rules.Rewrites = append(s.Rules.Rewrites, rule.Name)
+			s.Rules.RewriteOrigin = s.Rules.RewriteOrigin || rule.Action == config.RewriteOrigin
+		}
+	}
+	s.Rules.LegacyClient = IsLegacyClient(c)
+	s.Rules.SubtitleBurnIn = config.C.Emby.SubtitleBurnIn.Match(client)
+	policy := itemTagPolicy(p.ItemId)
+	s.Rules.ForceOrigin, s.Rules.NoPreview = policy.forceOrigin, policy.noPreview
+	s.Rules.ResolutionLimited = resolutionLimited(user)
+	s.Rules.DefaultPreview = config.C.VideoPreview.DefaultPreview.Enable && config.C.VideoPreview.DefaultPreview.Match(user, client)
+
+	// 2 获取客户端拿到的 PlaybackInfo, 直通的客户端拿到源服务器的原始响应
+	s.Rewrite = s.Rules.Passthrough == "" && !s.Rules.RewriteOrigin && !s.Rules.ForceOrigin && !s.Rules.SubtitleBurnIn &&
+		feature.Enabled(feature.PlaybackInfo) && !config.C.Emby.DryRun
+	if s.Rules.Passthrough != "" || s.Rules.RewriteOrigin {
+		ProxyOrigin(c)
+	} else {
+		TransferPlaybackInfo(c)
+	}
+	s.Code = c.Writer.Status()
+	body, err := jsons.New(w.Body.String())
+	if err != nil || body.Type() != jsons.JsonTypeObj {
+		s.Error = fmt.Sprintf("PlaybackInfo 响应异常, 响应码: %d, 响应: %s", s.Code, w.Body.String())
+		if location := w.Header().Get("Location"); location != "" {
+			s.Error += ", 重定向到: " + location
+		}
+		return s
+	}
+	mediaSources, ok := body.Attr("MediaSources").Done()
+	if !ok {
+		s.Error = fmt.Sprintf("PlaybackInfo 响应中没有 MediaSources: %s", w.Body.String())
+		return s
+	}
+
+	// 3 推断每个资源的播放方式
+	mediaSources.RangeArr(func(_ int, source *jsons.Item) error {
+		id, _ := source.Attr("Id").String()
+		name, _ := source.Attr("Name").String()
+		ss := SimulateSource{
+			Id:                         id,
+			Name:                       name,
+			DefaultAudioStreamIndex:    source.Attr("DefaultAudioStreamIndex").Val(),
+			DefaultSubtitleStreamIndex: source.Attr("DefaultSubtitleStreamIndex").Val(),
+		}
+		ss.Decision, ss.Detail = simulateSourceDecision(c, p.ItemId, source, s.Rewrite)
+		s.Sources = append(s.Sources, ss)
+		return nil
+	})
+	return s
+}
+
+// simulateRecorder 记录模拟请求的响应, 反向代理要求响应支持 CloseNotify
+type simulateRecorder struct {
+	*httptest.ResponseRecorder
+}
+
+// CloseNotify 模拟请求不会被客户端中断
+func (sr simulateRecorder) CloseNotify() <-chan bool {
+	return make(chan bool)
+}
+
+// simulateContext 构造模拟客户端请求 PlaybackInfo 的上下文
+func simulateContext(p SimulateParams) (*gin.Context, simulateRecorder, error) {
+	q := url.Values{}
+	q.Set("reqformat", "json")
+	q.Set(QueryApiKeyName, config.C.Emby.ApiKey)
+	if p.MediaSourceId != "" {
+		q.Set("MediaSourceId", p.MediaSourceId)
+	}
+	for key, value := range map[string]string{"X-Emby-Client": p.Client, "X-Emby-Client-Version": p.Version, "X-Emby-Device-Id": p.Device} {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+
+	body := p.Body
+	if len(body) == 0 {
+		body = []byte(PlaybackCommonPayload)
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("/Items/%s/PlaybackInfo?%s", url.PathEscape(p.ItemId), q.Encode()), io.NopCloser(bytes.NewReader(body)))
+	if err != nil {
+		return nil, simulateRecorder{}, fmt.Errorf("构造模拟请求失败: %v", err)
+	}
+	req.RequestURI = req.URL.RequestURI()
+	req.Header.Set("Content-Type", "application/json")
+	if p.UserAgent != "" {
+		req.Header.Set("User-Agent", p.UserAgent)
+	}
+	if p.Ip != "" {
+		req.RemoteAddr = p.Ip + ":0"
+	}
+
+	w := simulateRecorder{httptest.NewRecorder()}
+	c, _ := gin.CreateTestContext(w)
+	c.Request = req
+	if p.User != "" {
+		c.Set(ginKeySimulateUser, p.User)
+	}
+	return c, w, nil
+}
+
+// simulateSourceDecision 推断客户端播放资源时本程序的处理方式, 与 Redirect2AlistLink 的判断顺序保持一致
+//
+// rewrite 为 false 时客户端拿到的是源服务器的原始响应, 所有资源都由源服务器处理
+func simulateSourceDecision(c *gin.Context, itemId string, source *jsons.Item, rewrite bool) (string, string) {
+	id, _ := source.Attr("Id").String()
+	if msInfo, err := resolveMediaSourceId(id); rewrite && err == nil && msInfo.Transcode {
+		return metrics.DecisionProxy, fmt.Sprintf("网盘转码资源 (%s), 由本程序代理播放列表", msInfo.TemplateId)
+	}
+
+	// 改写之后的原画资源不再保留转码配置, 保留了转码配置的资源 (客户端无法播放的音频、回源的原盘) 由源服务器转码
+	tu, _ := source.Attr("TranscodingUrl").String()
+	if !rewrite || strs.AllNotEmpty(tu) {
+		if dp, _ := source.Attr("SupportsDirectPlay").Bool(); dp || strs.AnyEmpty(tu) {
+			return metrics.DecisionOrigin, "由源服务器串流"
+		}
+		return metrics.DecisionOrigin, "由源服务器转码"
+	}
+
+	var ms MediaSource
+	if source.To(&ms) != nil {
+		return metrics.DecisionRedirect, "重定向到网盘直链"
+	}
+	if urls.IsRemote(ms.Path) {
+		return metrics.DecisionRedirect, "strm 远程资源, 重定向到: " + mapStrmPath(ms.Path)
+	}
+	if ms.IsDisc() && config.C.Emby.DiscStrategy == config.DiscM2ts {
+		return metrics.DecisionRedirect, "原盘资源, 重定向到原盘中最大的 m2ts 文件直链"
+	}
+	if isSourceDemoted(c, itemId, ms.Id) {
+		return metrics.DecisionOrigin, "资源在当前设备上已降级, 由源服务器串流"
+	}
+	return metrics.DecisionRedirect, "重定向到网盘直链"
+}
@@ -0,0 +1,210 @@
+package emby
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// socketClientKey 在请求上下文中记录 websocket 客户端信息的 key
+type socketClientKey struct{}
+
+// socketClient 发起 websocket 连接的客户端信息
+type socketClient struct {
+	user   string // 用户
+	device string // 设备
+}
+
+// socketConns 本程序正在代理的所有 websocket 连接
+var socketConns sync.Map
+
+// wrapSocketResponse 升级为 websocket 之后, 接管源服务器连接, 以便向客户端推送本程序的消息
+func wrapSocketResponse(resp *http.Response) error {
+	if resp.StatusCode != http.StatusSwitchingProtocols {
+		return nil
+	}
+	upstream, ok := resp.Body.(io.ReadWriteCloser)
+	if !ok {
+		return nil
+	}
+	client, _ := resp.Request.Context().Value(socketClientKey{}).(socketClient)
+	resp.Body = newSocketConn(upstream, client)
+	return nil
+}
+
+// socketConn 代理中的 websocket 连接
+//
+// 写入方向 (客户端 => 源服务器) 原样转发; 读取方向逐帧转发源服务器的消息,
+// 并在完整的消息之间插入本程序推送的消息
+type socketConn struct {
+	io.ReadWriteCloser
+	client socketClient
+
+	pr *io.PipeReader
+	pw *io.PipeWriter
+
+	// mu 保证帧的写入不会交错
+	mu sync.Mutex
+	// fragmented 是否正在转发源服务器的分片消息, 分片之间不能插入其他消息
+	fragmented bool
+	// pending 等待分片消息结束后推送的消息帧
+	pending [][]byte
+
+	closeOnce sync.Once
+}
+
+// newSocketConn 包装源服务器连接, 并开始转发源服务器的消息
+func newSocketConn(upstream io.ReadWriteCloser, client socketClient) *socketConn {
+	pr, pw := io.Pipe()
+	sc := &socketConn{ReadWriteCloser: upstream, client: client, pr: pr, pw: pw}
+	socketConns.Store(sc, struct{}{})
+	go sc.relay()
+	return sc
+}
+
+// Read 读取发送给客户端的数据
+func (sc *socketConn) Read(p []byte) (int, error) {
+	return sc.pr.Read(p)
+}
+
+// Close 关闭连接
+func (sc *socketConn) Close() error {
+	sc.closeOnce.Do(func() {
+		socketConns.Delete(sc)
+		sc.pr.Close()
+	})
+	return sc.ReadWriteCloser.Close()
+}
+
+// relay 逐帧转发源服务器的消息
+func (sc *socketConn) relay() {
+	br := bufio.NewReader(sc.ReadWriteCloser)
+	for {
+		head, payloadLen, err := readFrameHeader(br)
+		if err != nil {
+			sc.pw.CloseWithError(err)
+			return
+		}
+
+		sc.mu.Lock()
+		_, err = sc.pw.Write(head)
+		if err == nil {
+			_, err = io.CopyN(sc.pw, br, int64(payloadLen))
+		}
+		// 控制帧可以出现在分片之间, 只有数据帧会改变分片状态
+		if opcode := head[0] & 0x0f; opcode < 0x8 {
+			sc.fragmented = head[0]&0x80 == 0
+		}
+		if err == nil && !sc.fragmented {
+			err = sc.flushPending()
+		}
+		sc.mu.Unlock()
+
+		if err != nil {
+			sc.pw.CloseWithError(err)
+			return
+		}
+	}
+}
+
+// push 向客户端推送一个文本消息, 正在转发分片消息时等待分片结束后再推送
+func (sc *socketConn) push(payload []byte) error {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.pending = append(sc.pending, textFrame(payload))
+	if sc.fragmented {
+		return nil
+	}
+	return sc.flushPending()
+}
+
+// flushPending 写入等待推送的消息帧, 调用方需要持有锁
+func (sc *socketConn) flushPending() error {
+	for len(sc.pending) > 0 {
+		if _, err := sc.pw.Write(sc.pending[0]); err != nil {
+			return err
+		}
+		sc.pending = sc.pending[1:]
+	}
+	return nil
+}
+
+// readFrameHeader 读取 websocket 帧头, 返回帧头的原始字节和负载长度
+func readFrameHeader(r *bufio.Reader) ([]byte, uint64, error) {
+	head := make([]byte, 2, 14)
+	if _, err := io.ReadFull(r, head); err != nil {
+		return nil, 0, err
+	}
+	payloadLen := uint64(head[1] & 0x7f)
+	extLen := 0
+	switch payloadLen {
+	case 126:
+		extLen = 2
+	case 127:
+		extLen = 8
+	}
+	if head[1]&0x80 != 0 {
+		// 掩码
+		extLen += 4
+	}
+	ext := make([]byte, extLen)
+	if _, err := io.ReadFull(r, ext); err != nil {
+		return nil, 0, err
+	}
+	switch payloadLen {
+	case 126:
+		payloadLen = uint64(binary.BigEndian.Uint16(ext))
+	case 127:
+		payloadLen = binary.BigEndian.Uint64(ext)
+	}
+	return append(head, ext...), payloadLen, nil
+}
+
+// textFrame 生成服务端发送给客户端的文本帧 (不带掩码)
+func textFrame(payload []byte) []byte {
+	frame := []byte{0x81}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, byte(n))
+	case n <= 0xffff:
+		frame = append(frame, 126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, 127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	return append(frame, payload...)
+}
+
+// BroadcastMessage 通过本程序代理的 websocket 连接向客户端推送横幅消息, 不需要 emby 管理员权限
+//
+// user 为空时推送给所有连接的客户端, device 为空时推送给用户的所有设备, 返回推送的连接个数
+//
+// 消息异步写入每个连接, 避免个别客户端读取缓慢时阻塞调用方
+func BroadcastMessage(user, device, header, text string, timeout time.Duration) int {
+	args := map[string]string{"Header": header, "Text": text}
+	if timeout > 0 {
+		args["TimeoutMs"] = strconv.FormatInt(timeout.Milliseconds(), 10)
+	}
+	payload, _ := json.Marshal(map[string]interface{}{
+		"MessageType": "GeneralCommand",
+		"Data":        map[string]interface{}{"Name": "DisplayMessage", "Arguments": args},
+	})
+
+	count := 0
+	socketConns.Range(func(key, _ any) bool {
+		sc := key.(*socketConn)
+		if (user != "" && sc.client.user != user) || (device != "" && sc.client.device != device) {
+			return true
+		}
+		go sc.push(payload)
+		count++
+		return true
+	})
+	return count
+}
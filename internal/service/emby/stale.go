@@ -0,0 +1,141 @@
+package emby
+
+import (
+	"bytes"
+	"container/list"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// staleMaxBodySize 单个响应记录的最大大小, 超出的响应不记录
+const staleMaxBodySize = 4 * 1024 * 1024
+
+// staleEntry 只读接口最近一次成功的响应
+type staleEntry struct {
+	key     string      // 记录 key
+	header  http.Header // 响应头
+	body    []byte      // 响应体
+	savedAt time.Time   // 记录时间
+}
+
+var (
+	// staleEntries 响应记录, 按照记录时间排列, 最早的记录位于队首
+	staleEntries = list.New()
+	// staleIndex 根据记录 key 快速定位响应记录
+	staleIndex = map[string]*list.Element{}
+	// staleMu 并发控制
+	staleMu sync.Mutex
+)
+
+// staleEnabled 判断当前请求是否需要记录或返回过期响应
+//
+// 只对只读接口 (GET) 生效
+func staleEnabled(c *gin.Context) bool {
+	return config.C.Emby.ProxyErrorStrategy == config.StrategyStale && c.Request.Method == http.MethodGet
+}
+
+// staleKey 计算响应记录 key, 不同用户的响应相互隔离
+func staleKey(c *gin.Context) string {
+	return requestToken(c) + "|" + c.Request.URL.RequestURI()
+}
+
+// staleRecordHook 记录 emby 成功响应的 json 内容
+//
+// emby 响应 5xx 时视为请求失败, 交由调用方返回过期响应
+func staleRecordHook(key string) https.ResponseHook {
+	return func(resp *http.Response) error {
+		if resp.StatusCode >= http.StatusInternalServerError {
+			return fmt.Errorf("源服务器响应异常: %d", resp.StatusCode)
+		}
+		if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+			return nil
+		}
+
+		origin := resp.Body
+		bodyBytes, err := io.ReadAll(io.LimitReader(origin, staleMaxBodySize+1))
+		if err != nil {
+			origin.Close()
+			return fmt.Errorf("读取响应体失败: %v", err)
+		}
+		if len(bodyBytes) > staleMaxBodySize {
+			// 响应过大, 拼接已读取的部分后原样透传
+			resp.Body = struct {
+				io.Reader
+				io.Closer
+			}{io.MultiReader(bytes.NewReader(bodyBytes), origin), origin}
+			return nil
+		}
+		origin.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+
+		putStale(&staleEntry{key: key, header: resp.Header.Clone(), body: bodyBytes, savedAt: time.Now()})
+		return nil
+	}
+}
+
+// putStale 保存响应记录, 超出数量限制时丢弃最早的记录
+func putStale(entry *staleEntry) {
+	staleMu.Lock()
+	defer staleMu.Unlock()
+
+	if elm, ok := staleIndex[entry.key]; ok {
+		staleEntries.Remove(elm)
+	}
+	staleIndex[entry.key] = staleEntries.PushBack(entry)
+
+	for staleEntries.Len() > config.C.Emby.StaleCache.MaxSize {
+		oldest := staleEntries.Remove(staleEntries.Front()).(*staleEntry)
+		delete(staleIndex, oldest.key)
+	}
+}
+
+// getStale 获取未超出最长保存时间的响应记录
+func getStale(key string) (*staleEntry, bool) {
+	staleMu.Lock()
+	defer staleMu.Unlock()
+
+	elm, ok := staleIndex[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elm.Value.(*staleEntry)
+	if time.Since(entry.savedAt) > config.C.Emby.StaleCache.MaxAgeDuration() {
+		staleEntries.Remove(elm)
+		delete(staleIndex, key)
+		return nil, false
+	}
+	return entry, true
+}
+
+// serveStale 返回当前请求最近一次成功的响应
+//
+// 没有可用的响应记录, 或者响应已经开始回写时返回 false
+func serveStale(c *gin.Context) bool {
+	if !staleEnabled(c) || c.Writer.Written() {
+		return false
+	}
+	entry, ok := getStale(staleKey(c))
+	if !ok {
+		return false
+	}
+
+	log.Printf(colors.ToYellow("emby 不可用, 返回 %s 记录的响应: %s"), entry.savedAt.Format(time.DateTime), c.Request.URL.Path)
+	c.Header(cache.HeaderKeyExpired, "-1")
+	https.CloneHeader(c, entry.header)
+	c.Header("Warning", `110 - "Response is Stale"`)
+	c.Status(http.StatusOK)
+	c.Writer.Write(entry.body)
+	return true
+}
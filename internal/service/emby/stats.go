@@ -0,0 +1,107 @@
+package emby
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/stats"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/encrypts"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// authUserIdRegex 从 X-Emby-Authorization 请求头中匹配出 UserId
+var authUserIdRegex = regexp.MustCompile(`(?i)UserId="([^"]+)"`)
+
+// recordPlay 记录一次播放统计, 每一次串流请求记为一次播放
+//
+// redirected 为 true 时, bytes 为资源大小; 否则为实际经过本程序传输的字节数
+func recordPlay(c *gin.Context, provider string, bytes int64, redirected bool) {
+	var itemId string
+	if matches := itemIdRegex.FindStringSubmatch(c.Request.URL.Path); len(matches) > 1 {
+		itemId = matches[1]
+	}
+	stats.RecordPlay(stats.Play{
+		ItemId:     itemId,
+		User:       requestUser(c),
+		Provider:   provider,
+		Bytes:      max(bytes, 0),
+		Redirected: redirected,
+	})
+}
+
+// decisionRoutes 改写决策统计的路由名称, 自上而下匹配第一个, 都不匹配时为 other
+var decisionRoutes = []struct {
+	name string
+	reg  *regexp.Regexp
+}{
+	{"stream", regexp.MustCompile(constant.Reg_ResourceStream)},
+	{"main", regexp.MustCompile(constant.Reg_ResourceMain)},
+	{"download", regexp.MustCompile(constant.Reg_ItemDownload)},
+	{"playbackinfo", regexp.MustCompile(constant.Reg_PlaybackInfo)},
+	{"webdav", regexp.MustCompile(constant.Reg_Webdav)},
+	{"feed", regexp.MustCompile(constant.Reg_FeedLink)},
+	{"photo", regexp.MustCompile(constant.Reg_PhotoOriginal)},
+}
+
+// recordDecision 记录一次请求的改写决策 (重定向, 中转, 回源, 拒绝) 及其原因
+func recordDecision(c *gin.Context, decision, reason string) {
+	route := "other"
+	for _, r := range decisionRoutes {
+		if r.reg.MatchString(c.Request.URL.Path) {
+			route = r.name
+			break
+		}
+	}
+	metrics.RecordDecision(route, decision, reason)
+}
+
+// TrafficTagger 流量归属中间件
+//
+// 在请求上下文中记录发起请求的用户和请求的 item, 处理请求期间从上游读取的流量都归属于该用户和 item;
+// 管理接口的请求不统计
+func TrafficTagger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(strings.ToLower(c.Request.URL.Path), "/admin/") {
+			return
+		}
+		// 用户标识在上报流量时才获取, 此时请求可能已经处理完毕, 需要使用上下文的副本
+		cp := c.Copy()
+		tag := https.TrafficTag{User: func() string { return requestUser(cp) }}
+		if matches := itemIdRegex.FindStringSubmatch(c.Request.URL.Path); len(matches) > 1 {
+			tag.ItemId = matches[1]
+		}
+		c.Request = c.Request.WithContext(https.WithTrafficTag(c.Request.Context(), tag))
+	}
+}
+
+// requestUser 获取发起请求的用户标识
+//
+// 优先使用 access token 所属的用户名, 其次是客户端传递的 UserId,
+// 都获取不到时使用 token 的摘要代替; 模拟请求直接使用指定的用户名
+func requestUser(c *gin.Context) string {
+	if user := c.GetString(ginKeySimulateUser); user != "" {
+		return user
+	}
+	token := requestToken(c)
+	if user, ok := tokenUser(token); ok {
+		return user
+	}
+	if userId := c.Query("UserId"); strs.AllNotEmpty(userId) {
+		return userId
+	}
+	if matches := authUserIdRegex.FindStringSubmatch(c.GetHeader(HeaderFullAuthName)); len(matches) > 1 {
+		return matches[1]
+	}
+	if matches := authUserIdRegex.FindStringSubmatch(c.GetHeader(HeaderAuthName)); len(matches) > 1 {
+		return matches[1]
+	}
+	if strs.AllNotEmpty(token) {
+		return "token:" + encrypts.Md5Hash(token)[:8]
+	}
+	return ""
+}
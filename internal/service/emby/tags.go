@@ -0,0 +1,83 @@
+package emby
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// itemTagsCache 缓存的 item 标签
+type itemTagsCache struct {
+	tags    []string
+	expired time.Time
+}
+
+// itemTags item id => 缓存的标签 (包括所属剧集的标签)
+var itemTags sync.Map
+
+// tagPolicy 根据 item 标签得出的代理行为
+type tagPolicy struct {
+	noPreview   bool // 不生成转码资源
+	forceOrigin bool // 不改写 PlaybackInfo, 串流请求回源
+}
+
+// itemTagPolicy 获取 item 的标签对应的代理行为, 未启用或获取标签失败时返回零值
+func itemTagPolicy(itemId string) tagPolicy {
+	cfg := config.C.ItemTags
+	if !cfg.Enable || strs.AnyEmpty(itemId) {
+		return tagPolicy{}
+	}
+	tags, err := fetchItemTags(itemId)
+	if err != nil {
+		log.Printf(colors.ToYellow("获取 item 标签失败, 使用默认行为: %v"), err)
+		return tagPolicy{}
+	}
+	return tagPolicy{noPreview: cfg.IsNoPreview(tags), forceOrigin: cfg.IsForceOrigin(tags)}
+}
+
+// fetchItemTags 获取 item 的标签, 剧集会同时返回所属剧的标签
+func fetchItemTags(itemId string) ([]string, error) {
+	if v, ok := itemTags.Load(itemId); ok {
+		if tc := v.(itemTagsCache); time.Now().Before(tc.expired) {
+			return tc.tags, nil
+		}
+	}
+
+	q := url.Values{}
+	q.Set("Ids", itemId)
+	q.Set("Fields", "Tags")
+	res, _ := Fetch("/emby/Items?"+q.Encode(), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return nil, fmt.Errorf("请求 emby 失败: %s", res.Msg)
+	}
+	var body struct {
+		Items []struct {
+			Tags     []string
+			SeriesId string
+		}
+	}
+	if err := res.Data.To(&body); err != nil {
+		return nil, fmt.Errorf("解析 emby 响应失败: %v", err)
+	}
+	if len(body.Items) == 0 {
+		return nil, fmt.Errorf("item 不存在: %s", itemId)
+	}
+
+	tags := body.Items[0].Tags
+	if seriesId := body.Items[0].SeriesId; strs.AllNotEmpty(seriesId) && seriesId != itemId {
+		seriesTags, err := fetchItemTags(seriesId)
+		if err != nil {
+			return nil, err
+		}
+		tags = append(append([]string{}, tags...), seriesTags...)
+	}
+	itemTags.Store(itemId, itemTagsCache{tags: tags, expired: time.Now().Add(config.C.ItemTags.CacheTtlDuration())})
+	return tags, nil
+}
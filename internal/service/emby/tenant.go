@@ -0,0 +1,48 @@
+package emby
+
+import (
+	"context"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ginKeyAlistAccount 记录当前请求匹配到的 alist 账号的 gin key
+const ginKeyAlistAccount = "alist-account"
+
+// AlistAccount 获取发起请求的用户在多租户模式下关联的 alist 账号名称
+//
+// 只使用服务端核实过的身份匹配: 模拟请求指定的用户名, 以及 token 所属的用户名和用户 id;
+// 客户端自行传递的 UserId 可以被伪造, 不参与匹配; 未配置 alist.accounts 或匹配不到时返回空, 使用默认账号
+func AlistAccount(c *gin.Context) string {
+	if len(config.C.Alist.Accounts) == 0 {
+		return ""
+	}
+	if account, ok := c.Get(ginKeyAlistAccount); ok {
+		return account.(string)
+	}
+	candidates := []string{c.GetString(ginKeySimulateUser)}
+	token := requestToken(c)
+	if user, ok := tokenUser(token); ok {
+		candidates = append(candidates, user)
+	}
+	if userId, ok := tokenUserIds.Load(token); ok {
+		candidates = append(candidates, userId.(string))
+	}
+
+	account := config.C.Alist.AccountOf(candidates...)
+	c.Set(ginKeyAlistAccount, account)
+	if account != "" {
+		logs.Debugf(colors.ToBlue("使用用户关联的 alist 账号: %s"), account)
+	}
+	return account
+}
+
+// alistCtx 基于 parent 生成携带当前用户 alist 账号的上下文
+func alistCtx(c *gin.Context, parent context.Context) context.Context {
+	return alist.WithAccount(parent, AlistAccount(c))
+}
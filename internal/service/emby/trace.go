@@ -0,0 +1,49 @@
+package emby
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/redact"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GinKeyDebugTrace 标记当前请求被调试跟踪的 gin key
+const GinKeyDebugTrace = "debug-trace"
+
+// DebugTracer 调试跟踪中间件
+//
+// 请求的 item 和用户满足 /admin/debug/trace 设置的跟踪条件时, 处理期间临时输出调试日志
+func DebugTracer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		t, ok := logs.GetTrace()
+		if !ok || strings.HasPrefix(strings.ToLower(c.Request.URL.Path), "/admin/") {
+			return
+		}
+		item := c.Query("ItemId")
+		if matches := itemIdRegex.FindStringSubmatch(c.Request.URL.Path); len(matches) > 1 {
+			item = matches[1]
+		}
+		user := ""
+		if t.User != "" {
+			// 只有按用户跟踪时才解析用户, 避免额外请求源服务器
+			user = requestUser(c)
+		}
+		if !t.Match(item, user) {
+			return
+		}
+
+		c.Set(GinKeyDebugTrace, true)
+		end := logs.BeginTrace()
+		defer end()
+		start := time.Now()
+		uri := redact.String(c.Request.URL.RequestURI())
+		log.Printf(colors.ToPurple("[TRACE] 开始跟踪请求, item: %s, user: %s, method: %s, uri: %s"), item, user, c.Request.Method, uri)
+		c.Next()
+		log.Printf(colors.ToPurple("[TRACE] 请求处理完成, code: %d, 耗时: %v, uri: %s"), c.Writer.Status(), time.Since(start), uri)
+	}
+}
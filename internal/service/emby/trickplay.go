@@ -0,0 +1,181 @@
+package emby
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/encrypts"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// trickplayIgnoreParams 不参与预览图缓存 key 运算的参数 (小写)
+var trickplayIgnoreParams = map[string]struct{}{
+	strings.ToLower(QueryApiKeyName): {}, strings.ToLower(QueryTokenName): {},
+	"deviceid": {}, "playsessionid": {},
+}
+
+// ProxyTrickplay 代理进度条预览图 (Trickplay/BIF) 请求
+//
+// 开启 trickplay 配置后, 预览图会缓存到磁盘, 过期前不再请求源服务器
+func ProxyTrickplay(c *gin.Context) {
+	cfg := config.C.Trickplay
+	if !cfg.Enable {
+		ProxyOrigin(c)
+		return
+	}
+
+	// 预览图由磁盘缓存接管, 不再占用内存缓存
+	c.Header(cache.HeaderKeyExpired, "-1")
+	c.Header("Cache-Control", fmt.Sprintf("public, max-age=%d", int(cfg.ExpiredDuration().Seconds())))
+
+	// 1 命中磁盘缓存
+	filePath := trickplayCachePath(c.Request.URL)
+	if file, stat, ok := openTrickplayCache(filePath); ok {
+		defer file.Close()
+		c.Header("X-Cache-Status", "HIT")
+		http.ServeContent(c.Writer, c.Request, path.Base(c.Request.URL.Path), stat.ModTime(), file)
+		return
+	}
+
+	// 2 请求源服务器, 写入磁盘缓存
+	body, header, err := fetchTrickplay(c.Request.URL.String(), c.Request.Header.Clone())
+	if err != nil {
+		log.Printf(colors.ToYellow("请求预览图失败, 代理到源服务器: %v"), err)
+		ProxyOrigin(c)
+		return
+	}
+	if err := writeTrickplayCache(filePath, body); err != nil {
+		log.Printf(colors.ToYellow("写入预览图缓存失败: %v"), err)
+	}
+
+	c.Header("X-Cache-Status", "MISS")
+	c.Data(http.StatusOK, header.Get("Content-Type"), body)
+}
+
+// prefetchTrickplay 异步预先请求 item 的 BIF 预览图并写入磁盘缓存
+func prefetchTrickplay(itemId, mediaSourceId, apiKey string) {
+	cfg := config.C.Trickplay
+	if !cfg.Enable || !cfg.Prefetch {
+		return
+	}
+
+	u, _ := url.Parse(fmt.Sprintf("/videos/%s/index.bif", itemId))
+	q := u.Query()
+	q.Set("MediaSourceId", mediaSourceId)
+	q.Set("Width", fmt.Sprintf("%d", cfg.PrefetchWidth))
+	q.Set(QueryApiKeyName, apiKey)
+	u.RawQuery = q.Encode()
+
+	filePath := trickplayCachePath(u)
+	if file, _, ok := openTrickplayCache(filePath); ok {
+		file.Close()
+		return
+	}
+
+	go func() {
+		body, _, err := fetchTrickplay(u.String(), nil)
+		if err != nil {
+			log.Printf(colors.ToYellow("预先请求 BIF 预览图失败, itemId: %s, err: %v"), itemId, err)
+			return
+		}
+		if err := writeTrickplayCache(filePath, body); err != nil {
+			log.Printf(colors.ToYellow("写入预览图缓存失败: %v"), err)
+			return
+		}
+		log.Printf(colors.ToGreen("BIF 预览图预加载完成, itemId: %s"), itemId)
+	}()
+}
+
+// fetchTrickplay 请求源服务器的预览图, uri 为相对于 emby 源服务器的地址
+func fetchTrickplay(uri string, header http.Header) ([]byte, http.Header, error) {
+	if header != nil {
+		header.Del("Range")
+		header.Del("If-Modified-Since")
+		header.Del("If-None-Match")
+	}
+	resp, err := https.Request(http.MethodGet, config.C.Emby.Host+uri, header, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("响应码: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, nil, fmt.Errorf("读取响应体失败: %v", err)
+	}
+	return body, resp.Header, nil
+}
+
+// trickplayCachePath 计算预览图在磁盘中的缓存路径
+//
+// 忽略路径前缀 (如: /emby) 及鉴权相关的参数, 使不同客户端的请求可以共用缓存
+func trickplayCachePath(u *url.URL) string {
+	p := strings.ToLower(u.Path)
+	if idx := strings.Index(p, "/videos/"); idx != -1 {
+		p = p[idx:]
+	}
+
+	params := make([]string, 0)
+	for key, values := range u.Query() {
+		lowerKey := strings.ToLower(key)
+		if _, ok := trickplayIgnoreParams[lowerKey]; ok {
+			continue
+		}
+		params = append(params, lowerKey+"="+strings.Join(values, ","))
+	}
+	sort.Strings(params)
+
+	hash := encrypts.Md5Hash(p + "?" + strings.Join(params, "&"))
+	return filepath.Join(config.C.Trickplay.Dir(), hash[:2], hash+path.Ext(p))
+}
+
+// openTrickplayCache 打开未过期的磁盘缓存
+func openTrickplayCache(filePath string) (*os.File, os.FileInfo, bool) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, nil, false
+	}
+	stat, err := file.Stat()
+	if err != nil || time.Since(stat.ModTime()) > config.C.Trickplay.ExpiredDuration() {
+		file.Close()
+		return nil, nil, false
+	}
+	return file, stat, true
+}
+
+// writeTrickplayCache 将预览图写入磁盘缓存, 先写临时文件再重命名, 避免读到不完整的文件
+func writeTrickplayCache(filePath string, body []byte) error {
+	if err := os.MkdirAll(filepath.Dir(filePath), os.ModeDir|os.ModePerm); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), "tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, bytes.NewReader(body)); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
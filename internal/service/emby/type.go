@@ -19,3 +19,48 @@ type ItemInfo struct {
 	ApiKey          string // emby 接口密钥
 	PlaybackInfoUri string // item 信息查询接口 uri, 通过源服务器查询
 }
+
+// PlaybackInfo emby PlaybackInfo 接口响应
+//
+// 只包含程序需要使用的属性, 需要修改响应时仍应操作原始的 json 对象, 避免丢失其他属性
+type PlaybackInfo struct {
+	MediaSources  []MediaSource
+	PlaySessionId string
+}
+
+// MediaSource emby 媒体源信息
+type MediaSource struct {
+	Id                   string
+	ItemId               string
+	Name                 string
+	Path                 string
+	Protocol             string
+	Container            string
+	VideoType            string `json:",omitempty"`
+	Size                 int64
+	Bitrate              int64
+	RunTimeTicks         int64 `json:",omitempty"`
+	IsRemote             bool
+	SupportsDirectPlay   bool
+	SupportsDirectStream bool
+	SupportsTranscoding  bool
+	DirectStreamUrl      string `json:",omitempty"`
+	TranscodingUrl       string `json:",omitempty"`
+	MediaStreams         []MediaStream
+}
+
+// MediaStream emby 媒体流信息, 包括视频, 音频, 字幕等
+type MediaStream struct {
+	Type           string // Video, Audio, Subtitle
+	Index          int
+	Codec          string
+	Language       string `json:",omitempty"`
+	Title          string `json:",omitempty"`
+	DisplayTitle   string
+	Width          int `json:",omitempty"`
+	Height         int `json:",omitempty"`
+	IsDefault      bool
+	IsExternal     bool
+	DeliveryMethod string `json:",omitempty"`
+	DeliveryUrl    string `json:",omitempty"`
+}
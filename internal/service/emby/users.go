@@ -0,0 +1,154 @@
+package emby
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TokenUsersRefreshInterval 两次刷新 token 用户映射的最小间隔
+const TokenUsersRefreshInterval = time.Second * 30
+
+var (
+	// tokenUsers access token => 用户名
+	tokenUsers = sync.Map{}
+	// tokenUserIds access token => 用户 id
+	tokenUserIds = sync.Map{}
+	// tokenUsersRefreshAt 上一次刷新 token 用户映射的时间
+	tokenUsersRefreshAt time.Time
+	// tokenUsersMu 控制刷新频率
+	tokenUsersMu sync.Mutex
+)
+
+var (
+	// authTokenRegex 从 Authorization 请求头中匹配出 Token
+	authTokenRegex = regexp.MustCompile(`(?i)Token="([^"]+)"`)
+	// authDeviceIdRegex 从 Authorization 请求头中匹配出 DeviceId
+	authDeviceIdRegex = regexp.MustCompile(`(?i)DeviceId="([^"]+)"`)
+	// authClientRegex 从 Authorization 请求头中匹配出 Client
+	authClientRegex = regexp.MustCompile(`(?i)Client="([^"]+)"`)
+	// authVersionRegex 从 Authorization 请求头中匹配出客户端 Version
+	authVersionRegex = regexp.MustCompile(`(?i)\bVersion="([^"]+)"`)
+)
+
+// requestToken 获取请求中携带的 access token
+func requestToken(c *gin.Context) string {
+	kType, apiKey := getApiKey(c)
+	if kType == Query {
+		return apiKey
+	}
+	if matches := authTokenRegex.FindStringSubmatch(apiKey); len(matches) > 1 {
+		return matches[1]
+	}
+	return ""
+}
+
+// requestDeviceId 获取发起请求的设备 id
+func requestDeviceId(c *gin.Context) string {
+	for _, key := range []string{"DeviceId", "X-Emby-Device-Id"} {
+		if id := c.Query(key); strs.AllNotEmpty(id) {
+			return id
+		}
+	}
+	if id := c.GetHeader("X-Emby-Device-Id"); strs.AllNotEmpty(id) {
+		return id
+	}
+	for _, key := range []string{HeaderFullAuthName, HeaderAuthName} {
+		if matches := authDeviceIdRegex.FindStringSubmatch(c.GetHeader(key)); len(matches) > 1 {
+			return matches[1]
+		}
+	}
+	return ""
+}
+
+// requestClient 获取发起请求的客户端名称
+func requestClient(c *gin.Context) string {
+	if client := c.Query("X-Emby-Client"); strs.AllNotEmpty(client) {
+		return client
+	}
+	if client := c.GetHeader("X-Emby-Client"); strs.AllNotEmpty(client) {
+		return client
+	}
+	for _, key := range []string{HeaderFullAuthName, HeaderAuthName} {
+		if matches := authClientRegex.FindStringSubmatch(c.GetHeader(key)); len(matches) > 1 {
+			return matches[1]
+		}
+	}
+	return ""
+}
+
+// requestClientVersion 获取发起请求的客户端版本
+func requestClientVersion(c *gin.Context) string {
+	if version := c.Query("X-Emby-Client-Version"); strs.AllNotEmpty(version) {
+		return version
+	}
+	if version := c.GetHeader("X-Emby-Client-Version"); strs.AllNotEmpty(version) {
+		return version
+	}
+	for _, key := range []string{HeaderFullAuthName, HeaderAuthName} {
+		if matches := authVersionRegex.FindStringSubmatch(c.GetHeader(key)); len(matches) > 1 {
+			return matches[1]
+		}
+	}
+	return ""
+}
+
+// tokenUser 获取 access token 所属的用户名
+//
+// 映射关系从 emby 的 token 列表中获取, 查询不到时刷新一次
+func tokenUser(token string) (string, bool) {
+	if strs.AnyEmpty(token) {
+		return "", false
+	}
+	if user, ok := tokenUsers.Load(token); ok {
+		return user.(string), true
+	}
+	refreshTokenUsers()
+	if user, ok := tokenUsers.Load(token); ok {
+		return user.(string), true
+	}
+	return "", false
+}
+
+// refreshTokenUsers 从 emby 的 token 列表中刷新 token 用户映射
+func refreshTokenUsers() {
+	tokenUsersMu.Lock()
+	defer tokenUsersMu.Unlock()
+	if time.Since(tokenUsersRefreshAt) < TokenUsersRefreshInterval {
+		return
+	}
+	tokenUsersRefreshAt = time.Now()
+
+	res, _ := Fetch(AuthUri, http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		log.Printf(colors.ToYellow("获取 emby token 列表失败: %s"), res.Msg)
+		return
+	}
+	items, ok := res.Data.Attr("Items").Done()
+	if !ok || items.Type() != jsons.JsonTypeArr {
+		return
+	}
+	items.RangeArr(func(_ int, item *jsons.Item) error {
+		token, _ := item.Attr("AccessToken").String()
+		user, _ := item.Attr("UserName").String()
+		userId, _ := item.Attr("UserId").String()
+		if strs.AnyEmpty(user) {
+			user = userId
+		}
+		if strs.AllNotEmpty(token, user) {
+			tokenUsers.Store(token, user)
+		}
+		if strs.AllNotEmpty(token, userId) {
+			tokenUserIds.Store(token, userId)
+		}
+		return nil
+	})
+}
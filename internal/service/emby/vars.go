@@ -0,0 +1,45 @@
+package emby
+
+import (
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/expr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequestVars 获取请求相关的变量, 用于条件表达式求值
+//
+// 变量在使用时才会计算, 需要请求 emby 的变量 (如 user) 不会影响其他规则的性能
+func RequestVars(c *gin.Context) expr.Vars {
+	return func(name string) string {
+		if key, ok := strings.CutPrefix(name, "header."); ok {
+			return c.GetHeader(key)
+		}
+		if key, ok := strings.CutPrefix(name, "query."); ok {
+			return c.Query(key)
+		}
+
+		switch name {
+		case "method":
+			return c.Request.Method
+		case "path":
+			return c.Request.URL.Path
+		case "uri":
+			return c.Request.RequestURI
+		case "client":
+			return requestClient(c)
+		case "client_version":
+			return requestClientVersion(c)
+		case "device":
+			return requestDeviceId(c)
+		case "user":
+			return requestUser(c)
+		case "item":
+			if matches := itemIdRegex.FindStringSubmatch(c.Request.URL.Path); len(matches) > 1 {
+				return matches[1]
+			}
+		}
+		return ""
+	}
+}
@@ -0,0 +1,165 @@
+package emby
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// wakeProbeTimeout 探测源服务器是否可达的超时时间
+	wakeProbeTimeout = time.Second
+	// wakeProbeInterval 等待唤醒期间探测源服务器的间隔
+	wakeProbeInterval = time.Second * 2
+	// originAwakeTtl 探测到源服务器可达之后, 在这个时间内不再重复探测
+	originAwakeTtl = time.Second * 10
+)
+
+// wakeAttempt 一次唤醒源服务器的尝试, 等待期间到达的请求共享同一次尝试的结果
+type wakeAttempt struct {
+	done chan struct{}
+	ok   bool
+}
+
+var (
+	// originAwakeAt 最近一次探测到源服务器可达的时间戳 (毫秒)
+	originAwakeAt atomic.Int64
+
+	// currentWake 正在进行的唤醒尝试
+	currentWake *wakeAttempt
+	// currentWakeMu 并发控制
+	currentWakeMu sync.Mutex
+)
+
+// OriginWaker 源服务器唤醒中间件
+//
+// 源服务器不可达时发送唤醒信号, 并在 emby.wake.window 内等待源服务器恢复之后再继续处理请求
+func OriginWaker() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !config.C.Emby.Wake.Enable || strings.HasPrefix(strings.ToLower(c.Request.URL.Path), "/admin/") {
+			return
+		}
+		ensureOriginAwake(c.Request.Context())
+	}
+}
+
+// ensureOriginAwake 确保源服务器可达, 不可达时发送唤醒信号并等待, 返回源服务器是否可达
+func ensureOriginAwake(ctx context.Context) bool {
+	if time.Now().UnixMilli()-originAwakeAt.Load() < originAwakeTtl.Milliseconds() || probeOrigin() {
+		return true
+	}
+
+	currentWakeMu.Lock()
+	attempt := currentWake
+	if attempt == nil {
+		attempt = &wakeAttempt{done: make(chan struct{})}
+		currentWake = attempt
+		go attempt.run()
+	}
+	currentWakeMu.Unlock()
+
+	select {
+	case <-attempt.done:
+		return attempt.ok
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// run 发送唤醒信号, 并等待源服务器可达或者超时
+func (wa *wakeAttempt) run() {
+	defer func() {
+		currentWakeMu.Lock()
+		currentWake = nil
+		currentWakeMu.Unlock()
+		close(wa.done)
+	}()
+
+	cfg := config.C.Emby.Wake
+	start := time.Now()
+	log.Printf(colors.ToYellow("源服务器不可达, 发送唤醒信号, 最长等待 %v"), cfg.WindowDuration())
+	sendWakeSignal(cfg)
+
+	deadline := start.Add(cfg.WindowDuration())
+	for time.Now().Before(deadline) {
+		time.Sleep(wakeProbeInterval)
+		if probeOrigin() {
+			log.Printf(colors.ToGreen("源服务器已唤醒, 耗时: %v"), time.Since(start).Round(time.Second))
+			wa.ok = true
+			return
+		}
+	}
+	log.Printf(colors.ToRed("等待源服务器唤醒超时: %v"), cfg.WindowDuration())
+}
+
+// probeOrigin 探测源服务器端口是否可达
+func probeOrigin() bool {
+	conn, err := net.DialTimeout("tcp", originHostPort(), wakeProbeTimeout)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+	originAwakeAt.Store(time.Now().UnixMilli())
+	return true
+}
+
+// originHostPort 获取源服务器的地址和端口, 未指定端口时按照协议使用默认端口
+func originHostPort() string {
+	u, err := url.Parse(config.C.Emby.Host)
+	if err != nil {
+		return config.C.Emby.Host
+	}
+	if u.Port() != "" {
+		return u.Host
+	}
+	if u.Scheme == "https" {
+		return net.JoinHostPort(u.Hostname(), "443")
+	}
+	return net.JoinHostPort(u.Hostname(), "80")
+}
+
+// sendWakeSignal 发送 WoL 数据包, 并请求唤醒 webhook
+func sendWakeSignal(cfg *config.EmbyWake) {
+	if mac := cfg.HardwareAddr(); mac != nil {
+		if err := sendMagicPacket(cfg.Broadcast, mac); err != nil {
+			log.Printf(colors.ToRed("发送 WoL 数据包失败: %v"), err)
+		}
+	}
+	if cfg.Webhook != "" {
+		body := https.MapBody(map[string]interface{}{"event": "emby.wake", "host": config.C.Emby.Host})
+		header := make(http.Header)
+		header.Set("Content-Type", "application/json;charset=utf-8")
+		resp, err := https.Request(http.MethodPost, cfg.Webhook, header, body)
+		if err != nil {
+			log.Printf(colors.ToRed("请求唤醒 webhook 失败: %v"), err)
+			return
+		}
+		resp.Body.Close()
+	}
+}
+
+// sendMagicPacket 发送 WoL 魔术包: 6 个字节的 0xFF, 之后是重复 16 次的 MAC 地址
+func sendMagicPacket(broadcast string, mac net.HardwareAddr) error {
+	packet := bytes.Repeat([]byte{0xff}, 6)
+	packet = append(packet, bytes.Repeat(mac, 16)...)
+	conn, err := net.Dial("udp", broadcast)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write(packet)
+	return err
+}
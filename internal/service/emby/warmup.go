@@ -0,0 +1,286 @@
+package emby
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+
+	"github.com/gin-gonic/gin"
+)
+
+// PlaylistPusher 预热转码播放列表的函数, 由调用方注入, 避免与 m3u8 包循环依赖
+type PlaylistPusher func(account, alistPath, templateId string)
+
+// warmLink 预解析的直链
+type warmLink struct {
+	res     alistResolved
+	expired time.Time
+}
+
+// warmLinks alist 账号 + emby 路径 => 预解析的直链
+var warmLinks sync.Map
+
+// warmupPusher 预热转码播放列表的函数, 由 StartWarmup 注入
+var warmupPusher PlaylistPusher
+
+// warmLinkKey 计算预解析直链的 key
+func warmLinkKey(account, embyPath string) string {
+	return account + "|" + embyPath
+}
+
+// loadWarmLink 获取未过期的预解析直链
+func loadWarmLink(account, embyPath string) (alistResolved, bool) {
+	if !config.C.Warmup.LinksEnabled() {
+		return alistResolved{}, false
+	}
+	key := warmLinkKey(account, embyPath)
+	v, ok := warmLinks.Load(key)
+	if !ok {
+		return alistResolved{}, false
+	}
+	if wl := v.(warmLink); time.Now().Before(wl.expired) {
+		return wl.res, true
+	}
+	warmLinks.Delete(key)
+	return alistResolved{}, false
+}
+
+// StartWarmup 按照配置的 cron 表达式, 定时预解析所有用户继续观看列表中的资源
+//
+// push 同时用于播放队列预解析时预热下一集的转码播放列表
+func StartWarmup(push PlaylistPusher) {
+	warmupPusher = push
+	cfg := config.C.Warmup
+	if !cfg.Enable {
+		return
+	}
+
+	go func() {
+		for {
+			next := cfg.Schedule().Next(time.Now())
+			if next.IsZero() {
+				log.Printf(colors.ToYellow("warmup.cron 无法触发, 停止定时预解析: %s"), cfg.Schedule())
+				return
+			}
+			logs.Debugf(colors.ToBlue("下一次预解析继续观看列表的时间: %s"), next.Format(time.DateTime))
+			time.Sleep(time.Until(next))
+			warmupResumeItems(push)
+		}
+	}()
+}
+
+// warmupResumeItems 预解析所有用户继续观看列表中的资源
+func warmupResumeItems(push PlaylistPusher) {
+	cfg := config.C.Warmup
+	start := time.Now()
+	users, err := fetchWarmupUsers()
+	if err != nil {
+		log.Printf(colors.ToRed("预解析继续观看列表失败: %v"), err)
+		return
+	}
+
+	total, success := 0, 0
+	for _, user := range users {
+		if !cfg.UserValid(user.Name) {
+			continue
+		}
+		sources, err := fetchResumeSources(user.Id, cfg.Limit)
+		if err != nil {
+			log.Printf(colors.ToYellow("获取用户 [%s] 的继续观看列表失败: %v"), user.Name, err)
+			continue
+		}
+		account := config.C.Alist.AccountOf(user.Name, user.Id)
+		for _, source := range sources {
+			// 远程资源 (strm) 和原盘资源不需要预解析
+			if strs.AnyEmpty(source.Path) || urls.IsRemote(source.Path) || source.IsDisc() {
+				continue
+			}
+			total++
+			if err := warmupSource(account, source, push); err != nil {
+				log.Printf(colors.ToYellow("预解析失败, 用户: %s, path: %s, err: %v"), user.Name, source.Path, err)
+				continue
+			}
+			success++
+		}
+	}
+	log.Printf(colors.ToGreen("继续观看列表预解析完成, 成功: %d, 总数: %d, 耗时: %v"), success, total, time.Since(start))
+}
+
+// warmupUser 需要预解析的 emby 用户
+type warmupUser struct {
+	Id   string
+	Name string
+}
+
+// fetchWarmupUsers 获取 emby 中所有启用的用户
+func fetchWarmupUsers() ([]warmupUser, error) {
+	res, _ := Fetch("/emby/Users?IsDisabled=false", http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return nil, fmt.Errorf("请求 emby 用户列表失败: %s", res.Msg)
+	}
+	var users []warmupUser
+	if err := res.Data.To(&users); err != nil {
+		return nil, fmt.Errorf("解析 emby 响应失败: %v", err)
+	}
+	return users, nil
+}
+
+// fetchResumeSources 获取用户继续观看列表中每个 item 的第一个资源
+func fetchResumeSources(userId string, limit int) ([]MediaSource, error) {
+	q := url.Values{}
+	q.Set("Limit", fmt.Sprintf("%d", limit))
+	q.Set("MediaTypes", "Video")
+	q.Set("Fields", "MediaSources")
+	res, _ := Fetch(fmt.Sprintf("/emby/Users/%s/Items/Resume?%s", userId, q.Encode()), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return nil, fmt.Errorf("请求 emby 失败: %s", res.Msg)
+	}
+
+	var body struct {
+		Items []struct{ MediaSources []MediaSource }
+	}
+	if err := res.Data.To(&body); err != nil {
+		return nil, fmt.Errorf("解析 emby 响应失败: %v", err)
+	}
+	sources := make([]MediaSource, 0, len(body.Items))
+	for _, item := range body.Items {
+		if len(item.MediaSources) > 0 {
+			sources = append(sources, item.MediaSources[0])
+		}
+	}
+	return sources, nil
+}
+
+// warmupSource 预解析单个资源的直链, 开启转码代理时同时预热所有清晰度的播放列表
+func warmupSource(account string, source MediaSource, push PlaylistPusher) error {
+	ctx := alist.WithAccount(context.Background(), account)
+	r, err := fetchAlistResourceCtx(ctx, nil, sourceAlistPath(source), func(time.Duration) {})
+	if err != nil {
+		return err
+	}
+	warmLinks.Store(warmLinkKey(account, source.Path), warmLink{res: r, expired: time.Now().Add(config.C.Warmup.TtlDuration())})
+	logs.Debugf(colors.ToBlue("预解析直链成功: %s"), source.Path)
+
+	vp := config.C.VideoPreview
+	if push == nil || !vp.Enable || !vp.ContainerValid(source.Container) {
+		return nil
+	}
+	res := alist.FetchFsOther(ctx, r.path, nil)
+	if res.Code != http.StatusOK {
+		return fmt.Errorf("请求 alist 转码资源失败: %s", res.Msg)
+	}
+	list, ok := res.Data.Attr("video_preview_play_info").Attr("live_transcoding_task_list").Done()
+	if !ok || list.Type() != jsons.JsonTypeArr {
+		return nil
+	}
+	list.RangeArr(func(_ int, task *jsons.Item) error {
+		if templateId, _ := task.Attr("template_id").String(); strs.AllNotEmpty(templateId) && !vp.IsTemplateIgnore(templateId) {
+			push(account, r.path, templateId)
+		}
+		return nil
+	})
+	return nil
+}
+
+var (
+	// detailWarmups 用户 => 最近一分钟内详情页预解析的时间, 用于限制预解析频率
+	detailWarmups = map[string][]time.Time{}
+	// detailWarmupsMu 并发控制
+	detailWarmupsMu sync.Mutex
+	// detailWarming 正在预解析的资源, 避免重复打开详情页时重复解析
+	detailWarming sync.Map
+)
+
+// warmupItemDetail 用户打开 item 详情页时, 异步预解析 item 资源的直链
+func warmupItemDetail(c *gin.Context, item *jsons.Item) {
+	cfg := config.C.Warmup
+	if !cfg.Detail.Enable {
+		return
+	}
+	user := requestUser(c)
+	if !cfg.UserValid(user) {
+		return
+	}
+	limitKey := user
+	if strs.AnyEmpty(limitKey) {
+		limitKey = requestDeviceId(c)
+	}
+	if strs.AnyEmpty(limitKey) {
+		return
+	}
+
+	var sources []MediaSource
+	if ms, ok := item.Attr("MediaSources").Done(); !ok || ms.Type() != jsons.JsonTypeArr || ms.To(&sources) != nil {
+		return
+	}
+	account := AlistAccount(c)
+	targets := make([]MediaSource, 0, cfg.Detail.Sources)
+	for _, source := range sources {
+		if len(targets) == cfg.Detail.Sources {
+			break
+		}
+		// 远程资源 (strm) 和原盘资源不需要预解析
+		if strs.AnyEmpty(source.Path) || urls.IsRemote(source.Path) || source.IsDisc() {
+			continue
+		}
+		if _, ok := loadWarmLink(account, source.Path); ok {
+			continue
+		}
+		targets = append(targets, source)
+	}
+	if len(targets) == 0 {
+		return
+	}
+	if !acquireDetailWarmup(limitKey, len(targets)) {
+		logs.Debugf(colors.ToYellow("用户 [%s] 的详情页预解析次数超出限制, 跳过"), limitKey)
+		return
+	}
+
+	go func() {
+		for _, source := range targets {
+			key := warmLinkKey(account, source.Path)
+			if _, loaded := detailWarming.LoadOrStore(key, struct{}{}); loaded {
+				continue
+			}
+			if err := warmupSource(account, source, nil); err != nil {
+				logs.Debugf(colors.ToYellow("详情页预解析失败, path: %s, err: %v"), source.Path, err)
+			}
+			detailWarming.Delete(key)
+		}
+	}()
+}
+
+// acquireDetailWarmup 判断用户在最近一分钟内的预解析次数是否超出限制, 未超出时记录本次预解析
+func acquireDetailWarmup(key string, n int) bool {
+	detailWarmupsMu.Lock()
+	defer detailWarmupsMu.Unlock()
+
+	now := time.Now()
+	recent := detailWarmups[key][:0]
+	for _, t := range detailWarmups[key] {
+		if now.Sub(t) < time.Minute {
+			recent = append(recent, t)
+		}
+	}
+	if len(recent)+n > config.C.Warmup.Detail.Rate {
+		detailWarmups[key] = recent
+		return false
+	}
+	for i := 0; i < n; i++ {
+		recent = append(recent, now)
+	}
+	detailWarmups[key] = recent
+	return true
+}
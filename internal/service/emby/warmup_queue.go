@@ -0,0 +1,211 @@
+package emby
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+
+	"github.com/gin-gonic/gin"
+)
+
+var (
+	// playingItems item id => 播放中的 item 信息, 用于计算播放进度和查找下一集
+	playingItems sync.Map
+	// nextEpisodes item id => 剧集的下一集 id, 没有下一集时为空字符串
+	nextEpisodes sync.Map
+	// queueWarmed alist 账号 + 下一个 item id => 预解析时间, 避免每次上报进度时重复预解析
+	queueWarmed sync.Map
+)
+
+// warmupNextQueued 客户端上报播放进度时, 如果当前 item 的播放进度达到阈值, 异步预解析播放队列中下一个 item 的直链
+//
+// 播放队列中没有下一个 item 时, 按照 warmup.queue.next-episode 配置预解析剧集的下一集
+func warmupNextQueued(c *gin.Context, user string) {
+	cfg := config.C.Warmup
+	if !cfg.Queue.Enable || !cfg.UserValid(user) || playingStoppedRegex.MatchString(c.Request.URL.Path) {
+		return
+	}
+	body, ok := reportBody(c)
+	if !ok {
+		return
+	}
+	itemId, _ := body.Attr("ItemId").String()
+	ticks, ok := body.Attr("PositionTicks").Int64()
+	if strs.AnyEmpty(itemId) || !ok || ticks <= 0 {
+		return
+	}
+	nextId := nextQueuedItem(body, itemId)
+	if strs.AnyEmpty(nextId) && !cfg.Queue.NextEpisode {
+		return
+	}
+
+	account := AlistAccount(c)
+	warmed := func(nextId string) bool {
+		at, ok := queueWarmed.Load(account + "\n" + nextId)
+		return ok && time.Since(at.(time.Time)) < cfg.TtlDuration()
+	}
+	if strs.AllNotEmpty(nextId) && warmed(nextId) {
+		return
+	}
+
+	go func() {
+		item, err := fetchPlayingItem(itemId)
+		if err != nil {
+			logs.Debugf(colors.ToYellow("获取 item 信息失败, id: %s, err: %v"), itemId, err)
+			return
+		}
+		if item.RunTimeTicks <= 0 || ticks*100 < item.RunTimeTicks*int64(cfg.Queue.Progress) {
+			return
+		}
+		if strs.AnyEmpty(nextId) {
+			if nextId, err = fetchNextEpisode(itemId, item); err != nil {
+				logs.Debugf(colors.ToYellow("获取剧集的下一集失败, id: %s, err: %v"), itemId, err)
+				return
+			}
+			if strs.AnyEmpty(nextId) || warmed(nextId) {
+				return
+			}
+		}
+
+		key, now := account+"\n"+nextId, time.Now()
+		if at, loaded := queueWarmed.LoadOrStore(key, now); loaded {
+			// 已经预解析过且未过期, 或者其他请求正在预解析
+			if time.Since(at.(time.Time)) < cfg.TtlDuration() || !queueWarmed.CompareAndSwap(key, at, now) {
+				return
+			}
+		}
+		if err := warmupQueuedItem(account, nextId); err != nil {
+			queueWarmed.Delete(key)
+			logs.Debugf(colors.ToYellow("播放队列预解析失败, id: %s, err: %v"), nextId, err)
+		}
+	}()
+}
+
+// nextQueuedItem 从播放进度上报的请求体中获取播放队列中的下一个 item id, 没有下一个 item 时返回空字符串
+func nextQueuedItem(body *jsons.Item, itemId string) string {
+	queue, ok := body.Attr("NowPlayingQueue").Done()
+	if !ok || queue.Type() != jsons.JsonTypeArr {
+		return ""
+	}
+	ids := make([]string, 0, queue.Len())
+	queue.RangeArr(func(_ int, value *jsons.Item) error {
+		id, _ := value.Attr("Id").String()
+		ids = append(ids, id)
+		return nil
+	})
+
+	// 同一个 item 可能在队列中出现多次, 优先使用客户端上报的队列下标
+	idx := -1
+	if i, ok := body.Attr("PlaylistIndex").Int(); ok && i >= 0 && i < len(ids) && ids[i] == itemId {
+		idx = i
+	}
+	for i := 0; idx == -1 && i < len(ids); i++ {
+		if ids[i] == itemId {
+			idx = i
+		}
+	}
+	if idx == -1 || idx+1 >= len(ids) {
+		return ""
+	}
+	return ids[idx+1]
+}
+
+// fetchPlayingItem 获取播放中的 item 信息, 获取成功后缓存在内存中
+func fetchPlayingItem(itemId string) (queueItem, error) {
+	if item, ok := playingItems.Load(itemId); ok {
+		return item.(queueItem), nil
+	}
+	items, err := fetchQueueItems(url.Values{"Ids": {itemId}})
+	if err != nil {
+		return queueItem{}, err
+	}
+	playingItems.Store(itemId, items[0])
+	return items[0], nil
+}
+
+// fetchNextEpisode 获取剧集的下一集 id, 不是剧集或者没有下一集时返回空字符串
+func fetchNextEpisode(itemId string, item queueItem) (string, error) {
+	if nextId, ok := nextEpisodes.Load(itemId); ok {
+		return nextId.(string), nil
+	}
+	if item.Type != "Episode" || strs.AnyEmpty(item.SeriesId) {
+		return "", nil
+	}
+	// 剧集列表从当前集开始, 第二个 item 即为下一集
+	res, _ := Fetch(fmt.Sprintf("/emby/Shows/%s/Episodes?%s", item.SeriesId, url.Values{
+		"StartItemId": {itemId},
+		"Limit":       {"2"},
+	}.Encode()), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return "", fmt.Errorf("请求 emby 失败: %s", res.Msg)
+	}
+	var body struct{ Items []struct{ Id string } }
+	if err := res.Data.To(&body); err != nil {
+		return "", fmt.Errorf("解析 emby 响应失败: %v", err)
+	}
+	nextId := ""
+	if len(body.Items) > 1 && body.Items[0].Id == itemId {
+		nextId = body.Items[1].Id
+	}
+	nextEpisodes.Store(itemId, nextId)
+	return nextId, nil
+}
+
+// warmupQueuedItem 预解析队列中 item 默认播放的资源的直链, 并预热转码播放列表
+func warmupQueuedItem(account, itemId string) error {
+	items, err := fetchQueueItems(url.Values{"Ids": {itemId}, "Fields": {"MediaSources"}})
+	if err != nil {
+		return err
+	}
+	if len(items[0].MediaSources) == 0 {
+		return nil
+	}
+	// 客户端默认播放第一个资源, 远程资源 (strm) 和原盘资源不需要预解析
+	source := items[0].MediaSources[0]
+	if strs.AnyEmpty(source.Path) || urls.IsRemote(source.Path) || source.IsDisc() {
+		return nil
+	}
+	if _, ok := loadWarmLink(account, source.Path); ok {
+		return nil
+	}
+	key := warmLinkKey(account, source.Path)
+	if _, loaded := detailWarming.LoadOrStore(key, struct{}{}); loaded {
+		return nil
+	}
+	defer detailWarming.Delete(key)
+	return warmupSource(account, source, warmupPusher)
+}
+
+// queueItem 播放队列预解析需要的 item 信息
+type queueItem struct {
+	Type         string
+	SeriesId     string
+	RunTimeTicks int64
+	MediaSources []MediaSource
+}
+
+// fetchQueueItems 请求 emby 获取 item 信息, 请求成功时至少返回一个 item
+func fetchQueueItems(q url.Values) ([]queueItem, error) {
+	res, _ := Fetch("/emby/Items?"+q.Encode(), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return nil, fmt.Errorf("请求 emby 失败: %s", res.Msg)
+	}
+
+	var body struct{ Items []queueItem }
+	if err := res.Data.To(&body); err != nil {
+		return nil, fmt.Errorf("解析 emby 响应失败: %v", err)
+	}
+	if len(body.Items) == 0 {
+		return nil, fmt.Errorf("item 不存在: %s", q.Get("Ids"))
+	}
+	return body.Items, nil
+}
@@ -0,0 +1,199 @@
+package emby
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/path"
+	"github.com/AmbitiousJun/go-emby2alist/internal/store"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
+)
+
+// watchedItemTypes 同步播放记录时匹配的媒体类型
+const watchedItemTypes = "Movie,Episode,Video,MusicVideo"
+
+// watchedRecord 播放记录来源返回的单条记录
+type watchedRecord struct {
+	Path     string `json:"path"`      // alist 中的文件路径
+	PlayedAt int64  `json:"played_at"` // 观看时间戳 (秒), 0 表示未知
+}
+
+// StartWatchedSync 按照配置的 cron 表达式, 定时将网盘的播放记录同步到 emby
+func StartWatchedSync() {
+	cfg := config.C.WatchedSync
+	if !cfg.Enable {
+		return
+	}
+
+	go func() {
+		for {
+			next := cfg.Schedule().Next(time.Now())
+			if next.IsZero() {
+				log.Printf(colors.ToYellow("watched-sync.cron 无法触发, 停止同步网盘播放记录: %s"), cfg.Schedule())
+				return
+			}
+			logs.Debugf(colors.ToBlue("下一次同步网盘播放记录的时间: %s"), next.Format(time.DateTime))
+			time.Sleep(time.Until(next))
+			syncWatched()
+		}
+	}()
+}
+
+// syncWatched 读取所有来源新增的播放记录, 将匹配的 item 在 emby 中标记为已观看
+//
+// 每个来源记录上一次同步到的观看时间, 之后只处理更晚的记录, 避免覆盖用户在 emby 中手动取消的已观看状态
+func syncWatched() {
+	start := time.Now()
+	sources := make(map[*config.WatchedSource]map[string]struct{})
+	latest := make(map[string]int64)
+	for _, source := range config.C.WatchedSync.Sources {
+		var since int64
+		if _, err := store.Default().Get(store.BucketWatchedSync, source.Name, &since); err != nil {
+			log.Printf(colors.ToYellow("读取播放记录来源 [%s] 的同步进度失败: %v"), source.Name, err)
+		}
+		records, err := fetchWatchedRecords(source.Url)
+		if err != nil {
+			log.Printf(colors.ToRed("读取播放记录来源 [%s] 失败: %v"), source.Name, err)
+			continue
+		}
+
+		paths := make(map[string]struct{})
+		latest[source.Name] = since
+		for _, record := range records {
+			if strs.AnyEmpty(record.Path) || (record.PlayedAt > 0 && record.PlayedAt <= since) {
+				continue
+			}
+			paths[watchedPathKey(record.Path)] = struct{}{}
+			latest[source.Name] = max(latest[source.Name], record.PlayedAt)
+		}
+		if len(paths) > 0 {
+			sources[source] = paths
+		}
+	}
+	if len(sources) == 0 {
+		return
+	}
+
+	users, err := fetchWarmupUsers()
+	if err != nil {
+		log.Printf(colors.ToRed("同步网盘播放记录失败: %v"), err)
+		return
+	}
+	marked, failed := 0, false
+	for _, user := range users {
+		paths := make(map[string]struct{})
+		for source, sourcePaths := range sources {
+			if !source.UserValid(user.Name) {
+				continue
+			}
+			for p := range sourcePaths {
+				paths[p] = struct{}{}
+			}
+		}
+		if len(paths) == 0 {
+			continue
+		}
+		cnt, err := markWatchedItems(user, paths)
+		if err != nil {
+			log.Printf(colors.ToYellow("同步用户 [%s] 的网盘播放记录失败: %v"), user.Name, err)
+			failed = true
+			continue
+		}
+		marked += cnt
+	}
+
+	// 存在同步失败的用户时不更新同步进度, 下一次重新处理这些记录
+	if !failed {
+		for name, playedAt := range latest {
+			if err := store.Default().Put(store.BucketWatchedSync, name, playedAt); err != nil {
+				log.Printf(colors.ToYellow("保存播放记录来源 [%s] 的同步进度失败: %v"), name, err)
+			}
+		}
+	}
+	log.Printf(colors.ToGreen("网盘播放记录同步完成, 标记已观看: %d, 耗时: %v"), marked, time.Since(start))
+}
+
+// fetchWatchedRecords 请求播放记录来源接口
+func fetchWatchedRecords(sourceUrl string) ([]watchedRecord, error) {
+	resp, err := https.Request(http.MethodGet, sourceUrl, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("接口响应异常: %s", resp.Status)
+	}
+	bytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应失败: %v", err)
+	}
+	var records []watchedRecord
+	if err := json.Unmarshal(bytes, &records); err != nil {
+		return nil, fmt.Errorf("解析响应失败: %v", err)
+	}
+	return records, nil
+}
+
+// markWatchedItems 遍历用户所有未观看的 item, 资源路径映射到 alist 之后存在于 paths 中时标记为已观看
+func markWatchedItems(user warmupUser, paths map[string]struct{}) (int, error) {
+	q := url.Values{}
+	q.Set("Recursive", "true")
+	q.Set("IsPlayed", "false")
+	q.Set("IncludeItemTypes", watchedItemTypes)
+	q.Set("Fields", "MediaSources")
+	res, _ := Fetch(fmt.Sprintf("/emby/Users/%s/Items?%s", user.Id, q.Encode()), http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return 0, fmt.Errorf("请求 emby 失败: %s", res.Msg)
+	}
+	var body struct {
+		Items []struct {
+			Id           string
+			Name         string
+			MediaSources []MediaSource
+		}
+	}
+	if err := res.Data.To(&body); err != nil {
+		return 0, fmt.Errorf("解析 emby 响应失败: %v", err)
+	}
+
+	cnt := 0
+	for _, item := range body.Items {
+		for _, source := range item.MediaSources {
+			if urls.IsRemote(source.Path) {
+				continue
+			}
+			if _, ok := paths[watchedPathKey(path.Emby2Alist(source.Path).Path)]; !ok {
+				continue
+			}
+			res, _ := Fetch(fmt.Sprintf("/emby/Users/%s/PlayedItems/%s", user.Id, item.Id), http.MethodPost, nil, nil)
+			if res.Code != http.StatusOK {
+				log.Printf(colors.ToYellow("标记已观看失败, 用户: %s, item: %s, err: %s"), user.Name, item.Name, res.Msg)
+				break
+			}
+			log.Printf(colors.ToGreen("同步网盘播放记录, 用户 [%s] 已观看: %s"), user.Name, item.Name)
+			cnt++
+			break
+		}
+	}
+	return cnt, nil
+}
+
+// watchedPathKey 统一路径的形式, 便于比较播放记录与 emby 中的资源路径
+func watchedPathKey(p string) string {
+	p = config.C.Path.NormalizePath(urls.TransferSlash(p))
+	if config.C.Path.IgnoreCase {
+		p = strings.ToLower(p)
+	}
+	return p
+}
@@ -0,0 +1,268 @@
+package emby
+
+import (
+	"crypto/subtle"
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// WebdavPrefix WebDAV 服务的路径前缀
+	WebdavPrefix = "/dav"
+
+	// MethodPropfind WebDAV 查询属性的请求方法
+	MethodPropfind = "PROPFIND"
+
+	// davListExpired 目录列表的缓存时间
+	davListExpired = time.Minute
+)
+
+// davEntry WebDAV 中的一个目录或文件
+type davEntry struct {
+	Id       string
+	Name     string
+	IsDir    bool
+	Size     int64
+	Modified time.Time
+}
+
+// davListCache 缓存的目录列表
+type davListCache struct {
+	entries []davEntry
+	expired time.Time
+}
+
+// davLists 目录列表缓存, key 为 emby 的父级 id, 根目录为空字符串
+var davLists sync.Map
+
+// davMultistatus PROPFIND 的响应体
+type davMultistatus struct {
+	XMLName   xml.Name      `xml:"D:multistatus"`
+	Xmlns     string        `xml:"xmlns:D,attr"`
+	Responses []davResponse `xml:"D:response"`
+}
+
+type davResponse struct {
+	Href     string      `xml:"D:href"`
+	Propstat davPropstat `xml:"D:propstat"`
+}
+
+type davPropstat struct {
+	Prop   davProp `xml:"D:prop"`
+	Status string  `xml:"D:status"`
+}
+
+type davProp struct {
+	DisplayName   string          `xml:"D:displayname"`
+	ResourceType  davResourceType `xml:"D:resourcetype"`
+	ContentLength int64           `xml:"D:getcontentlength,omitempty"`
+	LastModified  string          `xml:"D:getlastmodified,omitempty"`
+}
+
+type davResourceType struct {
+	Collection *struct{} `xml:"D:collection"`
+}
+
+// ServeWebdav 只读的 WebDAV 服务
+//
+// 目录对应 emby 的媒体库/剧/季, 文件请求重定向到网盘直链
+func ServeWebdav(c *gin.Context) {
+	cfg := config.C.Webdav
+	if !cfg.Enable {
+		apierr.Respond(c, http.StatusNotFound, apierr.NotFound, "WebDAV 未启用")
+		return
+	}
+	username, password, ok := c.Request.BasicAuth()
+	if !ok || subtle.ConstantTimeCompare([]byte(username), []byte(cfg.Username)) != 1 ||
+		subtle.ConstantTimeCompare([]byte(password), []byte(cfg.Password)) != 1 {
+		c.Header("WWW-Authenticate", `Basic realm="go-emby2alist"`)
+		apierr.Respond(c, http.StatusUnauthorized, apierr.Unauthorized, "WebDAV 鉴权失败")
+		return
+	}
+	c.Header(cache.HeaderKeyExpired, "-1")
+
+	switch c.Request.Method {
+	case http.MethodOptions:
+		c.Header("DAV", "1")
+		c.Header("Allow", "OPTIONS, PROPFIND, GET, HEAD")
+		c.Status(http.StatusOK)
+		return
+	case MethodPropfind, http.MethodGet, http.MethodHead:
+	default:
+		apierr.Respondf(c, http.StatusMethodNotAllowed, apierr.MethodNotAllowed, "WebDAV 只读, 不支持的请求方法: %s", c.Request.Method)
+		return
+	}
+
+	davPath := strings.Trim(strings.TrimPrefix(c.Request.URL.Path, WebdavPrefix), "/")
+	entry, err := resolveDavPath(davPath)
+	if err != nil {
+		apierr.Respond(c, http.StatusNotFound, apierr.NotFound, err.Error())
+		return
+	}
+
+	if c.Request.Method != MethodPropfind {
+		if entry.IsDir {
+			apierr.Respond(c, http.StatusMethodNotAllowed, apierr.MethodNotAllowed, "不支持直接请求目录")
+			return
+		}
+		// 文件请求改写为 emby 的下载接口, 使用配置中的 api_key 解析直链
+		logs.Debugf(colors.ToBlue("WebDAV 文件请求: %s, itemId: %s"), davPath, entry.Id)
+		c.Request.Header.Del(HeaderAuthName)
+		c.Request.RequestURI = fmt.Sprintf("/emby/Items/%s/Download", entry.Id)
+		DownloadItem(c)
+		return
+	}
+
+	href := WebdavPrefix + "/"
+	if davPath != "" {
+		href += davEscape(davPath)
+	}
+	ms := davMultistatus{Xmlns: "DAV:", Responses: []davResponse{davEntryResponse(href, entry)}}
+	if entry.IsDir && c.GetHeader("Depth") != "0" {
+		children, err := listDavDir(entry.Id)
+		if err != nil {
+			apierr.Respond(c, http.StatusBadGateway, apierr.UpstreamEmbyDown, err.Error())
+			return
+		}
+		for _, child := range children {
+			ms.Responses = append(ms.Responses, davEntryResponse(strings.TrimSuffix(href, "/")+"/"+davEscape(child.Name), child))
+		}
+	}
+	c.XML(http.StatusMultiStatus, ms)
+}
+
+// davEntryResponse 生成单个目录或文件的 PROPFIND 响应
+func davEntryResponse(href string, entry davEntry) davResponse {
+	prop := davProp{DisplayName: entry.Name}
+	if entry.IsDir {
+		prop.ResourceType.Collection = &struct{}{}
+		href = strings.TrimSuffix(href, "/") + "/"
+	} else {
+		prop.ContentLength = entry.Size
+	}
+	if !entry.Modified.IsZero() {
+		prop.LastModified = entry.Modified.UTC().Format(http.TimeFormat)
+	}
+	return davResponse{
+		Href:     href,
+		Propstat: davPropstat{Prop: prop, Status: "HTTP/1.1 200 OK"},
+	}
+}
+
+// davEscape 对路径中的每一段分别进行转义
+func davEscape(p string) string {
+	segs := strings.Split(p, "/")
+	for i, seg := range segs {
+		segs[i] = url.PathEscape(seg)
+	}
+	return strings.Join(segs, "/")
+}
+
+// resolveDavPath 从根目录开始逐级匹配名称, 将 WebDAV 路径解析为 emby 中的目录或文件
+func resolveDavPath(davPath string) (davEntry, error) {
+	entry := davEntry{Name: "/", IsDir: true}
+	if davPath == "" {
+		return entry, nil
+	}
+	for _, seg := range strings.Split(davPath, "/") {
+		if !entry.IsDir {
+			return davEntry{}, fmt.Errorf("路径不存在: %s", davPath)
+		}
+		children, err := listDavDir(entry.Id)
+		if err != nil {
+			return davEntry{}, err
+		}
+		found := false
+		for _, child := range children {
+			if child.Name == seg {
+				entry, found = child, true
+				break
+			}
+		}
+		if !found {
+			return davEntry{}, fmt.Errorf("路径不存在: %s", davPath)
+		}
+	}
+	return entry, nil
+}
+
+// listDavDir 获取 emby 父级下的目录和文件, parentId 为空时返回所有媒体库
+func listDavDir(parentId string) ([]davEntry, error) {
+	if v, ok := davLists.Load(parentId); ok {
+		if lc := v.(davListCache); time.Now().Before(lc.expired) {
+			return lc.entries, nil
+		}
+	}
+
+	uri := "/emby/Library/MediaFolders"
+	if strs.AllNotEmpty(parentId) {
+		q := url.Values{}
+		q.Set("ParentId", parentId)
+		q.Set("Fields", "MediaSources,DateCreated,ProductionYear")
+		q.Set("SortBy", "SortName")
+		q.Set("IsMissing", "false")
+		uri = "/emby/Items?" + q.Encode()
+	}
+	res, _ := Fetch(uri, http.MethodGet, nil, nil)
+	if res.Code != http.StatusOK {
+		return nil, fmt.Errorf("请求 emby 目录列表失败: %s", res.Msg)
+	}
+
+	var body struct {
+		Items []struct {
+			feedEmbyItem
+			IsFolder     bool
+			MediaType    string
+			MediaSources []struct {
+				Container string
+				Size      int64
+			}
+		}
+	}
+	if err := res.Data.To(&body); err != nil {
+		return nil, fmt.Errorf("解析 emby 响应失败: %v", err)
+	}
+
+	entries := make([]davEntry, 0, len(body.Items))
+	names := make(map[string]struct{})
+	for _, item := range body.Items {
+		entry := davEntry{Id: item.Id, IsDir: item.IsFolder}
+		entry.Modified, _ = time.Parse(time.RFC3339Nano, item.DateCreated)
+		name, ext := invalidFileNameRegex.ReplaceAllString(item.Name, "_"), ""
+		if !item.IsFolder {
+			if item.MediaType != "Video" && item.MediaType != "Audio" {
+				continue
+			}
+			name = invalidFileNameRegex.ReplaceAllString(feedTitle(item.feedEmbyItem), "_")
+			if len(item.MediaSources) > 0 {
+				entry.Size = item.MediaSources[0].Size
+				if strs.AllNotEmpty(item.MediaSources[0].Container) {
+					ext = "." + item.MediaSources[0].Container
+				}
+			}
+		}
+		entry.Name = name + ext
+		if _, ok := names[entry.Name]; ok {
+			entry.Name = fmt.Sprintf("%s [%s]%s", name, item.Id, ext)
+		}
+		names[entry.Name] = struct{}{}
+		entries = append(entries, entry)
+	}
+
+	davLists.Store(parentId, davListCache{entries: entries, expired: time.Now().Add(davListExpired)})
+	return entries, nil
+}
@@ -0,0 +1,116 @@
+// 功能开关, 允许在运行时临时关闭主要功能, 便于排查新版本客户端的兼容问题
+//
+// 开关状态持久化到存储中, 重启后依然生效
+package feature
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/store"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+)
+
+// Name 功能名称
+type Name string
+
+const (
+	VideoPreview  Name = "video-preview"  // 转码资源获取 (视频预览)
+	PlaybackInfo  Name = "playbackinfo"   // PlaybackInfo 响应改写
+	ImagesQuality Name = "images-quality" // 图片质量代理
+	StrmMapping   Name = "strm-mapping"   // strm 路径映射
+)
+
+// validName 用于校验功能名称是否合法
+var validName = map[Name]struct{}{
+	VideoPreview: {}, PlaybackInfo: {}, ImagesQuality: {}, StrmMapping: {},
+}
+
+// stateKey 开关状态在存储中的 key
+const stateKey = "state"
+
+// ErrInvalidName 功能名称不合法
+var ErrInvalidName = errors.New("不支持的功能名称")
+
+var (
+	// disabled 运行时被关闭的功能, 未记录的功能视为开启
+	disabled = map[Name]bool{}
+	// mu 并发控制
+	mu sync.RWMutex
+	// loadOnce 首次使用时从磁盘中加载开关状态
+	loadOnce sync.Once
+)
+
+// Enabled 判断功能是否处于开启状态
+//
+// 开关只能在配置的基础上关闭功能, 配置中未启用的功能不受影响
+func Enabled(name Name) bool {
+	loadOnce.Do(load)
+	mu.RLock()
+	defer mu.RUnlock()
+	return !disabled[name]
+}
+
+// Set 切换功能的开启状态, 并立即写入磁盘
+func Set(name Name, enable bool) error {
+	if _, ok := validName[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrInvalidName, name)
+	}
+	loadOnce.Do(load)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if enable {
+		delete(disabled, name)
+	} else {
+		disabled[name] = true
+	}
+	return save()
+}
+
+// All 获取所有功能的开启状态
+func All() map[Name]bool {
+	loadOnce.Do(load)
+	mu.RLock()
+	defer mu.RUnlock()
+	res := make(map[Name]bool, len(validName))
+	for name := range validName {
+		res[name] = !disabled[name]
+	}
+	return res
+}
+
+// load 从存储中加载开关状态
+func load() {
+	var state map[Name]bool
+	if _, err := store.Default().Get(store.BucketFeatures, stateKey, &state); err != nil {
+		log.Printf(colors.ToRed("解析功能开关状态失败: %v"), err)
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for name, enable := range state {
+		if _, ok := validName[name]; ok && !enable {
+			disabled[name] = true
+			log.Printf(colors.ToYellow("功能 [%s] 已在运行时关闭"), name)
+		}
+	}
+}
+
+// save 将开关状态保存到存储中并立即写入磁盘, 调用方需持有 mu
+func save() error {
+	state := make(map[Name]bool, len(validName))
+	for name := range validName {
+		state[name] = !disabled[name]
+	}
+	if err := store.Default().Put(store.BucketFeatures, stateKey, state); err != nil {
+		return fmt.Errorf("保存功能开关状态失败: %v", err)
+	}
+	if err := store.Default().Flush(); err != nil {
+		return fmt.Errorf("写入功能开关状态失败: %v", err)
+	}
+	return nil
+}
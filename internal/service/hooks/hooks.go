@@ -0,0 +1,120 @@
+// 事件钩子, 在请求处理过程中的关键节点触发事件,
+// 推送到配置的 webhook 地址, 或者交由编译进程序的 Go 钩子处理
+package hooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// Event 事件类型
+type Event string
+
+const (
+	EventDirectLink    Event = "direct-link"    // 下发了直链 (包括 strm 重定向)
+	EventPlaybackStart Event = "playback-start" // 客户端上报开始播放
+	EventPlaybackStop  Event = "playback-stop"  // 客户端上报停止播放
+	EventAlistFailed   Event = "alist-failed"   // alist 资源解析失败
+)
+
+// HeaderSignature 推送请求中携带请求体签名的请求头
+const HeaderSignature = "X-Hook-Signature"
+
+// Payload 推送的事件内容
+type Payload struct {
+	Event Event                  `json:"event"` // 事件类型
+	Time  string                 `json:"time"`  // 事件发生时间
+	Data  map[string]interface{} `json:"data"`  // 事件数据
+}
+
+// Handler 编译进程序的 Go 钩子, 在单独的 goroutine 中执行
+type Handler func(p Payload)
+
+var (
+	// handlers 已注册的 Go 钩子
+	handlers []Handler
+	// handlersMu 并发控制
+	handlersMu sync.RWMutex
+)
+
+// Register 注册 Go 钩子, 所有事件都会交由钩子处理
+//
+// 一般在自定义包的 init 函数中调用, 并在 main 包中匿名导入该自定义包
+func Register(h Handler) {
+	if h == nil {
+		return
+	}
+	handlersMu.Lock()
+	defer handlersMu.Unlock()
+	handlers = append(handlers, h)
+}
+
+// Fire 异步触发事件, 不会阻塞请求处理
+func Fire(event Event, data map[string]interface{}) {
+	p := Payload{Event: event, Time: time.Now().Format(time.DateTime), Data: data}
+
+	handlersMu.RLock()
+	for _, h := range handlers {
+		go runHandler(h, p)
+	}
+	handlersMu.RUnlock()
+
+	if config.C == nil {
+		return
+	}
+	for _, wh := range config.C.Hooks.Webhooks {
+		if wh.Subscribed(string(event)) {
+			go push(wh, p)
+		}
+	}
+}
+
+// runHandler 执行 Go 钩子, 钩子 panic 时不影响程序运行
+func runHandler(h Handler, p Payload) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf(colors.ToRed("事件钩子执行异常, event: %s, err: %v"), p.Event, r)
+		}
+	}()
+	h(p)
+}
+
+// push 推送事件到 webhook
+func push(wh *config.Webhook, p Payload) {
+	body, err := json.Marshal(p)
+	if err != nil {
+		log.Printf(colors.ToRed("序列化事件失败: %v"), err)
+		return
+	}
+
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json;charset=utf-8")
+	if strs.AllNotEmpty(wh.Secret) {
+		mac := hmac.New(sha256.New, []byte(wh.Secret))
+		mac.Write(body)
+		header.Set(HeaderSignature, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := https.Request(http.MethodPost, wh.Url, header, io.NopCloser(bytes.NewReader(body)))
+	if err != nil {
+		log.Printf(colors.ToRed("推送事件失败, url: %s, err: %v"), wh.Url, err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= http.StatusBadRequest {
+		log.Printf(colors.ToRed("推送事件失败, url: %s, 响应码: %d"), wh.Url, resp.StatusCode)
+	}
+}
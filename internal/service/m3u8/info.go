@@ -2,10 +2,10 @@ package m3u8
 
 import (
 	"bufio"
+	"context"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"strconv"
@@ -16,15 +16,20 @@ import (
 	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
 )
 
 // NewByContent 根据 m3u8 文本初始化一个 info 对象
 //
-// 如果文本中的 ts 地址是相对地址, 可通过 baseUrl 指定请求前缀
+// 如果文本中的 ts 地址是相对地址, 可通过 baseUrl 指定请求前缀;
+// 按照 video-preview.normalize 配置对不规范的播放列表进行规范化
 func NewByContent(baseUrl, content string) (*Info, error) {
 	info := Info{RemoteBase: baseUrl}
+	level := normalizeLevel()
+	content = normalizeContent(content, level)
 
 	// 逐行遍历文本
 	scanner := bufio.NewScanner(strings.NewReader(content))
@@ -66,6 +71,7 @@ func NewByContent(baseUrl, content string) (*Info, error) {
 		return nil, scanner.Err()
 	}
 
+	normalizeInfo(&info, level)
 	return &info, nil
 }
 
@@ -83,7 +89,9 @@ func NewByRemote(url string, header http.Header) (*Info, error) {
 	baseUrl := url[:lastSepPos+1]
 
 	// 2 请求远程地址
+	start := time.Now()
 	resp, err := https.Request(http.MethodGet, url, header, nil)
+	metrics.ObserveLatency(metrics.UpstreamM3U8, time.Since(start))
 	if err != nil {
 		return nil, fmt.Errorf("请求远程地址失败, url: %s, err: %v", url, err)
 	}
@@ -114,14 +122,15 @@ func (i *Info) GetTsLink(idx int) (string, bool) {
 
 // Deprecated: MasterFunc 获取变体 m3u8
 //
-// 当 info 包含有字幕时, 需要调用这个方法返回
-func (i *Info) MasterFunc(cntMapper func() string, clientApiKey string) string {
+// 当 info 包含有字幕时, 需要调用这个方法返回,
+// routePrefix 为字幕地址的前缀, 为空时使用相对地址
+func (i *Info) MasterFunc(cntMapper func() string, routePrefix, clientApiKey string) string {
 	sb := strings.Builder{}
 	sb.WriteString("#EXTM3U\n")
 	sb.WriteString("#EXT-X-VERSION:3\n")
 	// 写入字幕信息
 	for _, subInfo := range i.Subtitles {
-		u, _ := url.Parse("proxy_subtitle")
+		u, _ := url.Parse(routePrefix + "proxy_subtitle")
 		q := u.Query()
 		q.Set("alist_path", i.AlistPath)
 		q.Set("template_id", i.TemplateId)
@@ -167,6 +176,8 @@ func (i *Info) ContentFunc(tsMapper func(int, string) string) string {
 }
 
 // ProxyContent 将 i 转换为 m3u8 本地代理文本
+//
+// 媒体播放列表会按照 video-preview.playlist-tags 配置注入或移除标签
 func (i *Info) ProxyContent(main bool, routePrefix, clientApiKey string) string {
 	baseRoute := strings.Builder{}
 	if routePrefix != "" {
@@ -176,6 +187,7 @@ func (i *Info) ProxyContent(main bool, routePrefix, clientApiKey string) string
 
 	// 有内封字幕的资源, 切换为变体 m3u8
 	if !main && len(i.Subtitles) > 0 {
+		subtitleRoute := baseRoute.String()
 		baseRoute.WriteString("proxy_playlist")
 		return i.MasterFunc(func() string {
 			u, _ := url.Parse(baseRoute.String())
@@ -186,11 +198,11 @@ func (i *Info) ProxyContent(main bool, routePrefix, clientApiKey string) string
 			q.Set("type", "main")
 			u.RawQuery = q.Encode()
 			return u.String()
-		}, clientApiKey)
+		}, subtitleRoute, clientApiKey)
 	}
 
 	baseRoute.WriteString("proxy_ts")
-	return i.ContentFunc(func(idx int, _ string) string {
+	content := i.ContentFunc(func(idx int, _ string) string {
 		u, _ := url.Parse(baseRoute.String())
 		q := u.Query()
 		q.Set("idx", strconv.Itoa(idx))
@@ -200,6 +212,7 @@ func (i *Info) ProxyContent(main bool, routePrefix, clientApiKey string) string
 		u.RawQuery = q.Encode()
 		return u.String()
 	})
+	return applyPlaylistTags(content, i.TemplateId)
 }
 
 // Content 将 i 转换为 m3u8 文本
@@ -216,10 +229,11 @@ func (i *Info) UpdateContent() error {
 	if i.AlistPath == "" || i.TemplateId == "" {
 		return errors.New("参数为设置, 无法更新")
 	}
-	log.Printf(colors.ToPurple("更新 playlist, alistPath: %s, templateId: %s"), i.AlistPath, i.TemplateId)
+	logs.Debugf(colors.ToPurple("更新 playlist, alistPath: %s, templateId: %s"), i.AlistPath, i.TemplateId)
 
 	// 请求 alist 资源
 	res := alist.FetchResource(alist.FetchInfo{
+		Ctx:          alist.WithAccount(context.Background(), i.Account),
 		Path:         i.AlistPath,
 		UseTranscode: true,
 		Format:       i.TemplateId,
@@ -231,7 +245,7 @@ func (i *Info) UpdateContent() error {
 	// 解析地址
 	newInfo, err := NewByRemote(res.Data.Url, nil)
 	if err != nil {
-		return fmt.Errorf("解析远程 m3u8 失败, url: %s, err: %v", res.Data, err)
+		return fmt.Errorf("解析远程 m3u8 失败, url: %s, err: %v", res.Data.Url, err)
 	}
 
 	// 拷贝最新数据
@@ -1,19 +1,23 @@
 package m3u8
 
 import (
+	"fmt"
 	"log"
 	"sort"
 	"sync"
 	"time"
 
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
 )
 
 const (
 
 	// MaxPlaylistNum 在内存中最多维护的 m3u8 列表个数
-	// 超出则淘汰最久没有读取的一个
+	// 超出则淘汰最久没有读取的一个, 正在播放的列表不会被淘汰
 	MaxPlaylistNum = 10
 
 	// PreChanSize 预处理通道大小, 塞满时从头部开始淘汰
@@ -25,13 +29,29 @@ func init() {
 }
 
 // GetPlaylist 获取 m3u 播放列表, 返回 m3u 文本
-var GetPlaylist func(alistPath, templateId string, proxy, main bool, routePrefix, clientApiKey string) (string, bool)
+var GetPlaylist func(alistPath, templateId, account string, proxy, main bool, routePrefix, clientApiKey string) (string, bool)
 
 // GetTsLink 获取 m3u 播放列表中的某个 ts 链接
-var GetTsLink func(alistPath, templateId string, idx int) (string, bool)
+var GetTsLink func(alistPath, templateId, account string, idx int) (string, bool)
 
 // GetSubtitleLink 获取字幕链接
-var GetSubtitleLink func(alistPath, templateId, subName string) (string, bool)
+var GetSubtitleLink func(alistPath, templateId, account, subName string) (string, bool)
+
+// statusQuery 播放列表状态查询请求
+type statusQuery struct {
+	alistPath string
+	res       chan []PlaylistStatus
+}
+
+// statusQueryChan 播放列表状态查询通道, 由维护内存的 goroutine 响应, 避免并发读写
+var statusQueryChan = make(chan statusQuery)
+
+// GetPlaylistStatus 获取内存中某个 alist 资源所有清晰度播放列表的维护状态, 以及最近的更新失败记录
+func GetPlaylistStatus(alistPath string) []PlaylistStatus {
+	q := statusQuery{alistPath: alistPath, res: make(chan []PlaylistStatus, 1)}
+	statusQueryChan <- q
+	return <-q.res
+}
 
 // preMaintainInfoChan 预处理通道
 //
@@ -49,7 +69,7 @@ func PushPlaylistAsync(info Info) {
 	if info.AlistPath == "" || info.TemplateId == "" {
 		return
 	}
-	info = Info{AlistPath: info.AlistPath, TemplateId: info.TemplateId}
+	info = Info{AlistPath: info.AlistPath, TemplateId: info.TemplateId, Account: info.Account}
 	preChanHandlingGroup.Add(1)
 	doneOnce := sync.OnceFunc(preChanHandlingGroup.Done)
 	go func() {
@@ -75,25 +95,43 @@ func loopMaintainPlaylist() {
 	// arr 记录播放列表, 便于实现淘汰机制
 	infoArr := make([]*Info, 0)
 
-	// maintainDuration goroutine 维护 playlist 的间隔
-	maintainDuration := time.Minute * 10
-	// stopUpdateTimeMillis 超过这个时间未读, playlist 停止更新
-	stopUpdateTimeMillis := (maintainDuration + time.Minute).Milliseconds()
-	// removeTimeMillis 超过这个时间未读, playlist 被移除
+	// maintainDuration goroutine 检查 playlist 是否需要刷新的间隔
+	maintainDuration := time.Minute
+	// removeTimeMillis 超过这个时间未更新, playlist 被移除
 	removeTimeMillis := time.Hour.Milliseconds()
 
+	// maxAgeMillis playlist 距离上次更新超过这个时间, 需要刷新
+	maxAgeMillis := func() int64 {
+		return config.C.VideoPreview.PlaylistRefresh.MaxAgeDuration().Milliseconds()
+	}
+	// activeWindowMillis 在这个时间内被读取过的 playlist 视为正在播放, 在后台刷新
+	activeWindowMillis := func() int64 {
+		return config.C.VideoPreview.PlaylistRefresh.ActiveWindowDuration().Milliseconds()
+	}
+
 	// publicApiUpdateMutex 对外部暴露的 api 的内部实现中
 	// 如果涉及到更新的操作, 需要获取这个锁, 避免频繁请求 alist
 	publicApiUpdateMutex := sync.Mutex{}
 
-	// printErr 打印错误日志
-	printErr := func(info *Info, err error) {
-		log.Printf(colors.ToRed("playlist 更新失败, path: %s, template: %s, err: %v"), info.AlistPath, info.TemplateId, err)
-	}
-
 	// calcMapKey 计算 info 在 map 中的 key
 	calcMapKey := func(info Info) string {
-		return info.AlistPath + info.TemplateId
+		return info.Account + ":" + info.AlistPath + info.TemplateId
+	}
+
+	// failures 记录每个 playlist 最近一次更新失败的信息, 更新失败的 playlist 会被移除, 仅用于排查问题
+	failures := map[string]PlaylistStatus{}
+
+	// printErr 打印错误日志, 并记录失败信息
+	printErr := func(info *Info, err error) {
+		log.Printf(colors.ToRed("playlist 更新失败, path: %s, template: %s, err: %v"), info.AlistPath, info.TemplateId, err)
+		metrics.RecordError(fmt.Sprintf("playlist 更新失败, path: %s, template: %s, err: %v", info.AlistPath, info.TemplateId, err))
+		failures[calcMapKey(*info)] = PlaylistStatus{
+			AlistPath:   info.AlistPath,
+			TemplateId:  info.TemplateId,
+			Account:     info.Account,
+			LastError:   err.Error(),
+			LastErrorAt: time.Now(),
+		}
 	}
 
 	// beforeNow 判断一个时间是不是在当前时间之前
@@ -101,12 +139,19 @@ func loopMaintainPlaylist() {
 		return millis < time.Now().UnixMilli()
 	}
 
+	// pinned 判断 info 是否被正在播放的会话固定
+	//
+	// 预热推送的 info 不会被固定, 只有客户端真正读取过的才会
+	pinned := func(info *Info) bool {
+		return info.LastPlay > 0 && !beforeNow(info.LastPlay+activeWindowMillis())
+	}
+
 	// queryInfo 查询内存中的 info 信息
 	//
 	// 如果内存中 map 已经能查询到 info 信息, 直接返回
 	// 否则会等待预处理通道处理完毕后再次判断
-	queryInfo := func(alistPath, templateId string) (info *Info) {
-		key := calcMapKey(Info{AlistPath: alistPath, TemplateId: templateId})
+	queryInfo := func(alistPath, templateId, account string) (info *Info) {
+		key := calcMapKey(Info{AlistPath: alistPath, TemplateId: templateId, Account: account})
 		var ok bool
 		info, ok = infoMap[key]
 
@@ -114,19 +159,27 @@ func loopMaintainPlaylist() {
 			if info == nil {
 				return
 			}
-			// 如果当前 info 已经停止更新, 则手动触发更新
-			if beforeNow(info.LastRead + stopUpdateTimeMillis) {
+			// 如果当前 info 已经不在后台刷新 (客户端长时间未读取), 则手动触发更新
+			staleMillis := maxAgeMillis() + maintainDuration.Milliseconds()
+			if beforeNow(info.LastUpdate + staleMillis) {
 				publicApiUpdateMutex.Lock()
 				defer publicApiUpdateMutex.Unlock()
-				if beforeNow(info.LastRead + stopUpdateTimeMillis) {
+				if beforeNow(info.LastUpdate + staleMillis) {
 					if err := info.UpdateContent(); err != nil {
 						printErr(info, err)
-						info = nil
+						// 正在播放的 info 继续使用旧地址响应, 避免播放中断
+						if !pinned(info) {
+							info = nil
+						}
 					}
 				}
 			}
+			if info == nil {
+				return
+			}
 			// 更新最后读取时间
-			info.LastRead = time.Now().UnixMilli()
+			now := time.Now().UnixMilli()
+			info.LastRead, info.LastPlay = now, now
 		}()
 
 		if ok {
@@ -143,8 +196,8 @@ func loopMaintainPlaylist() {
 		return nil
 	}
 
-	GetPlaylist = func(alistPath, templateId string, proxy, main bool, routePrefix, clientApiKey string) (string, bool) {
-		info := queryInfo(alistPath, templateId)
+	GetPlaylist = func(alistPath, templateId, account string, proxy, main bool, routePrefix, clientApiKey string) (string, bool) {
+		info := queryInfo(alistPath, templateId, account)
 		if info == nil {
 			return "", false
 		}
@@ -154,16 +207,16 @@ func loopMaintainPlaylist() {
 		return info.Content(), true
 	}
 
-	GetTsLink = func(alistPath, templateId string, idx int) (string, bool) {
-		info := queryInfo(alistPath, templateId)
+	GetTsLink = func(alistPath, templateId, account string, idx int) (string, bool) {
+		info := queryInfo(alistPath, templateId, account)
 		if info == nil {
 			return "", false
 		}
 		return info.GetTsLink(idx)
 	}
 
-	GetSubtitleLink = func(alistPath, templateId, subName string) (string, bool) {
-		info := queryInfo(alistPath, templateId)
+	GetSubtitleLink = func(alistPath, templateId, account, subName string) (string, bool) {
+		info := queryInfo(alistPath, templateId, account)
 		if info == nil {
 			return "", false
 		}
@@ -176,6 +229,44 @@ func loopMaintainPlaylist() {
 		return "", false
 	}
 
+	// playlistStatus 获取 alist 资源所有清晰度播放列表的维护状态
+	playlistStatus := func(alistPath string) []PlaylistStatus {
+		res := make([]PlaylistStatus, 0)
+		for key, info := range infoMap {
+			if info.AlistPath != alistPath {
+				continue
+			}
+			status := PlaylistStatus{
+				AlistPath:  info.AlistPath,
+				TemplateId: info.TemplateId,
+				Account:    info.Account,
+				Cached:     true,
+				Segments:   len(info.RemoteTsInfos),
+				LastRead:   time.UnixMilli(info.LastRead),
+				LastUpdate: time.UnixMilli(info.LastUpdate),
+				Age:        time.Since(time.UnixMilli(info.LastUpdate)).Round(time.Second).String(),
+				Active:     !beforeNow(info.LastRead + activeWindowMillis()),
+				Pinned:     pinned(info),
+			}
+			if f, ok := failures[key]; ok {
+				status.LastError, status.LastErrorAt = f.LastError, f.LastErrorAt
+			}
+			res = append(res, status)
+		}
+		for key, f := range failures {
+			if _, ok := infoMap[key]; !ok && f.AlistPath == alistPath {
+				res = append(res, f)
+			}
+		}
+		sort.Slice(res, func(i, j int) bool {
+			if res[i].Account != res[j].Account {
+				return res[i].Account < res[j].Account
+			}
+			return res[i].TemplateId < res[j].TemplateId
+		})
+		return res
+	}
+
 	// removeInfo 删除内存中的 info 信息
 	removeInfo := func(key string) {
 		info, ok := infoMap[key]
@@ -191,42 +282,58 @@ func loopMaintainPlaylist() {
 		}
 	}
 
-	// updateAll 更新内存中的 info 信息
+	// updateAll 在后台刷新正在播放并且即将过期的 info 信息
 	//
-	// 如果 lastRead 不满足条件, 被淘汰
+	// 长时间未更新的 info 被淘汰
 	updateAll := func() {
 		// 复制一份 arr
 		cpArr := append(([]*Info)(nil), infoArr...)
-		tot, active := len(cpArr), 0
+		tot, active, refreshed := len(cpArr), 0, 0
+
+		// 清除过旧的失败记录
+		for key, f := range failures {
+			if beforeNow(f.LastErrorAt.UnixMilli() + removeTimeMillis) {
+				delete(failures, key)
+			}
+		}
 
 		for _, info := range cpArr {
-			key := calcMapKey(Info{AlistPath: info.AlistPath, TemplateId: info.TemplateId})
+			key := calcMapKey(*info)
 
-			// 长时间未读, 移除
-			if beforeNow(info.LastUpdate + removeTimeMillis) {
+			// 长时间未更新, 移除
+			if beforeNow(info.LastUpdate+removeTimeMillis) && !pinned(info) {
 				removeInfo(key)
 				log.Printf(colors.ToGray("playlist 长时间未被更新, 已移除, alistPath: %s, templateId: %s"), info.AlistPath, info.TemplateId)
 				tot--
 				continue
 			}
 
-			// 超过指定时间未读, 不更新
-			if beforeNow(info.LastRead + stopUpdateTimeMillis) {
+			// 超过活跃时间窗口未读, 视为已停止播放, 不在后台刷新
+			if beforeNow(info.LastRead + activeWindowMillis()) {
 				continue
 			}
-
-			// 如果更新失败, 移除
 			active++
+
+			// 还未到刷新时间
+			if !beforeNow(info.LastUpdate + maxAgeMillis()) {
+				continue
+			}
+
+			// 如果更新失败, 移除; 正在播放的 info 保留旧地址, 下次维护时重试
+			refreshed++
 			if err := info.UpdateContent(); err != nil {
 				printErr(info, err)
+				if pinned(info) {
+					continue
+				}
 				removeInfo(key)
 				tot--
 				active--
 			}
 		}
 
-		if len(cpArr) > 0 {
-			log.Printf(colors.ToPurple("当前正在维护的 playlist 个数: %d, 活跃个数: %d"), tot, active)
+		if refreshed > 0 {
+			logs.Debugf(colors.ToPurple("当前正在维护的 playlist 个数: %d, 活跃个数: %d, 本次刷新个数: %d"), tot, active, refreshed)
 		}
 	}
 
@@ -260,16 +367,27 @@ func loopMaintainPlaylist() {
 		if len(infoArr) <= MaxPlaylistNum {
 			return
 		}
-		// 内存满, 淘汰旧内存
+		// 内存满, 淘汰旧内存, 跳过正在播放的 info
 		sort.Slice(infoArr, func(i, j int) bool {
 			return infoArr[i].LastRead < infoArr[j].LastRead
 		})
-		toDeletes := make([]*Info, len(infoArr)-MaxPlaylistNum)
-		copy(toDeletes, infoArr)
+		overflow := len(infoArr) - MaxPlaylistNum
+		toDeletes := make([]*Info, 0, overflow)
+		for _, arrInfo := range infoArr {
+			if len(toDeletes) == overflow {
+				break
+			}
+			if !pinned(arrInfo) {
+				toDeletes = append(toDeletes, arrInfo)
+			}
+		}
 		for _, toDel := range toDeletes {
-			removeInfo(calcMapKey(Info{AlistPath: toDel.AlistPath, TemplateId: toDel.TemplateId}))
+			removeInfo(calcMapKey(*toDel))
 			log.Printf(colors.ToGray("playlist 被淘汰并从内存中移除, alistPath: %s, templateId: %s"), toDel.AlistPath, toDel.TemplateId)
 		}
+		if len(toDeletes) < overflow {
+			log.Printf(colors.ToYellow("有 %d 个正在播放的 playlist 被固定在内存中, 当前维护个数: %d, 超出上限: %d"), overflow-len(toDeletes), len(infoArr), MaxPlaylistNum)
+		}
 	}
 
 	// 定时维护一次内存中的数据
@@ -283,6 +401,8 @@ func loopMaintainPlaylist() {
 		case preInfo := <-preMaintainInfoChan:
 			addInfo(preInfo)
 			preChanHandlingGroup.Done()
+		case q := <-statusQueryChan:
+			q.res <- playlistStatus(q.alistPath)
 		}
 	}
 
@@ -19,7 +19,7 @@ func TestPlaylistCache(t *testing.T) {
 	m3u8.PushPlaylistAsync(info)
 
 	// 获取 playlist
-	m3uContent, ok := m3u8.GetPlaylist(info.AlistPath, info.TemplateId, true, true, "", "")
+	m3uContent, ok := m3u8.GetPlaylist(info.AlistPath, info.TemplateId, "", true, true, "", "")
 	if !ok {
 		log.Fatal("获取 m3u 失败")
 	}
@@ -28,10 +28,10 @@ func TestPlaylistCache(t *testing.T) {
 	// 获取 ts
 	log.Printf("\n\n\n")
 	log.Println("获取 162 ts: ")
-	log.Println(m3u8.GetTsLink(info.AlistPath, info.TemplateId, 162))
+	log.Println(m3u8.GetTsLink(info.AlistPath, info.TemplateId, "", 162))
 
 	// 获取 ts
 	log.Printf("\n\n\n")
 	log.Println("获取 150 ts: ")
-	log.Println(m3u8.GetTsLink(info.AlistPath, info.TemplateId, 150))
+	log.Println(m3u8.GetTsLink(info.AlistPath, info.TemplateId, "", 150))
 }
@@ -0,0 +1,107 @@
+package m3u8
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+)
+
+// uniqueHeadComments 在播放列表中只能出现一次的头部标签
+var uniqueHeadComments = map[string]struct{}{
+	"#EXTM3U": {}, "#EXT-X-VERSION": {}, "#EXT-X-MEDIA-SEQUENCE": {},
+	"#EXT-X-TARGETDURATION": {}, "#EXT-X-INDEPENDENT-SEGMENTS": {},
+}
+
+// normalizeLevel 获取配置的规范化级别, 配置未初始化时使用 basic
+func normalizeLevel() config.PlaylistNormalize {
+	if config.C == nil || config.C.VideoPreview == nil || config.C.VideoPreview.Normalize == "" {
+		return config.NormalizeBasic
+	}
+	return config.C.VideoPreview.Normalize
+}
+
+// normalizeContent 解析之前对播放列表文本进行规范化, 移除 BOM, 统一换行符, 去除行首尾的空白
+func normalizeContent(content string, level config.PlaylistNormalize) string {
+	if level == config.NormalizeOff {
+		return content
+	}
+	content = strings.TrimPrefix(content, "\ufeff")
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	content = strings.ReplaceAll(content, "\r", "\n")
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// normalizeInfo 解析之后对播放列表结构进行规范化
+//
+// basic: 重复的头部标签和尾部标签只保留第一个;
+// strict: 额外保证 #EXTM3U 位于第一行, 补全缺失的 #EXT-X-VERSION, 修正小于切片时长的 #EXT-X-TARGETDURATION
+func normalizeInfo(info *Info, level config.PlaylistNormalize) {
+	if level == config.NormalizeOff {
+		return
+	}
+	info.HeadComments = dedupeComments(info.HeadComments)
+	info.TailComments = dedupeComments(info.TailComments)
+	if level != config.NormalizeStrict {
+		return
+	}
+
+	head := slices.DeleteFunc(info.HeadComments, func(cmt string) bool { return cmt == "#EXTM3U" })
+	info.HeadComments = append([]string{"#EXTM3U"}, head...)
+	if !slices.ContainsFunc(info.HeadComments, func(cmt string) bool { return tagName(cmt) == "#EXT-X-VERSION" }) {
+		info.HeadComments = slices.Insert(info.HeadComments, 1, "#EXT-X-VERSION:3")
+	}
+
+	if len(info.RemoteTsInfos) == 0 {
+		return
+	}
+	maxDuration := 0.0
+	for _, ti := range info.RemoteTsInfos {
+		for _, cmt := range ti.Comments {
+			if tagName(cmt) != "#EXTINF" {
+				continue
+			}
+			durStr, _, _ := strings.Cut(strings.TrimPrefix(cmt, "#EXTINF:"), ",")
+			if dur, err := strconv.ParseFloat(strings.TrimSpace(durStr), 64); err == nil {
+				maxDuration = max(maxDuration, dur)
+			}
+		}
+	}
+	// 切片时长四舍五入之后不能超过 #EXT-X-TARGETDURATION
+	target := int(math.Round(maxDuration))
+	idx := slices.IndexFunc(info.HeadComments, func(cmt string) bool { return tagName(cmt) == "#EXT-X-TARGETDURATION" })
+	if idx == -1 {
+		if target > 0 {
+			info.HeadComments = append(info.HeadComments, fmt.Sprintf("#EXT-X-TARGETDURATION:%d", target))
+		}
+		return
+	}
+	if cur, err := strconv.Atoi(strings.TrimPrefix(info.HeadComments[idx], "#EXT-X-TARGETDURATION:")); err != nil || cur < target {
+		info.HeadComments[idx] = fmt.Sprintf("#EXT-X-TARGETDURATION:%d", target)
+	}
+}
+
+// dedupeComments 移除重复出现的唯一标签, 只保留第一个
+func dedupeComments(comments []string) []string {
+	seen := make(map[string]struct{})
+	res := make([]string, 0, len(comments))
+	for _, cmt := range comments {
+		name := tagName(cmt)
+		_, unique := uniqueHeadComments[name]
+		if unique || name == "#EXT-X-ENDLIST" {
+			if _, ok := seen[name]; ok {
+				continue
+			}
+			seen[name] = struct{}{}
+		}
+		res = append(res, cmt)
+	}
+	return res
+}
@@ -10,9 +10,12 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
 
 	"github.com/gin-gonic/gin"
 )
@@ -28,137 +31,235 @@ func baseCheck(c *gin.Context) (ProxyParams, error) {
 		return ProxyParams{}, err
 	}
 
-	alistPath, err := url.QueryUnescape(strings.TrimSpace(params.AlistPath))
-	if err != nil {
-		return ProxyParams{}, fmt.Errorf("alistPath 转换失败: %v", err)
+	// 参数已经过一次解码, 只对旧版本重复编码的路径 (以 %2F 开头) 再解码一次,
+	// 避免文件名中的 % 和 + 被错误解码
+	params.AlistPath = strings.TrimSpace(params.AlistPath)
+	if strings.HasPrefix(strings.ToUpper(params.AlistPath), "%2F") {
+		alistPath, err := url.QueryUnescape(params.AlistPath)
+		if err != nil {
+			return ProxyParams{}, fmt.Errorf("alistPath 转换失败: %v", err)
+		}
+		params.AlistPath = alistPath
 	}
-	params.AlistPath = alistPath
 
 	if params.AlistPath == "" || params.TemplateId == "" || params.ApiKey == "" {
 		return ProxyParams{}, errors.New("参数不足")
 	}
+	params.Account = emby.AlistAccount(c)
 
 	return params, nil
 }
 
+// castCompat 投屏兼容模式下, 为播放列表相关的接口补充 CORS 响应头
+//
+// 返回 true 表示当前请求是 CORS 预检请求, 已经响应完毕
+func castCompat(c *gin.Context) bool {
+	if !config.C.VideoPreview.CastCompat.Enable {
+		return false
+	}
+	c.Header("Access-Control-Allow-Origin", "*")
+	c.Header("Access-Control-Allow-Methods", "GET, HEAD, OPTIONS")
+	c.Header("Access-Control-Allow-Headers", "*")
+	c.Header("Access-Control-Expose-Headers", "Content-Length, Content-Range, Content-Type")
+	if c.Request.Method == http.MethodOptions {
+		c.Status(http.StatusNoContent)
+		return true
+	}
+	return false
+}
+
+// playlistRoutePrefix 播放列表中切片和字幕地址的前缀
+//
+// video-preview.segment-url 为 relative 时返回空字符串, 使用相对于播放列表的地址;
+// 旧设备的短链接和投屏设备需要绝对地址, 不受该配置影响;
+// 投屏兼容模式下优先使用反向代理传递的协议和域名, 保证投屏设备拿到的是可以直接访问的绝对地址
+func playlistRoutePrefix(c *gin.Context, legacy bool) string {
+	cfg := config.C.VideoPreview
+	if cfg.SegmentUrl == config.SegmentUrlRelative && !legacy && !cfg.CastCompat.Enable {
+		return ""
+	}
+	host := https.ClientRequestHost(c)
+	if !cfg.CastCompat.Enable {
+		return host + "/videos"
+	}
+
+	u, err := url.Parse(host)
+	if err != nil {
+		return host + "/videos"
+	}
+	if proto := strings.TrimSpace(strings.Split(c.GetHeader("X-Forwarded-Proto"), ",")[0]); proto != "" {
+		u.Scheme = proto
+	}
+	if fwdHost := strings.TrimSpace(strings.Split(c.GetHeader("X-Forwarded-Host"), ",")[0]); fwdHost != "" {
+		u.Host = fwdHost
+	}
+	return u.String() + "/videos"
+}
+
 // ProxyPlaylist 代理 m3u8 转码地址
 func ProxyPlaylist(c *gin.Context) {
+	if castCompat(c) {
+		return
+	}
 	params, err := baseCheck(c)
 	if err != nil {
 		log.Printf(colors.ToRed("代理 m3u8 失败: %v"), err.Error())
-		c.String(http.StatusBadRequest, "代理 m3u8 失败, 请检查日志")
+		apierr.Respond(c, http.StatusBadRequest, apierr.InvalidRequest, "代理 m3u8 失败, 请检查日志")
 		return
 	}
 
+	// 占位资源在首次播放时解析实际使用的清晰度
+	if params.TemplateId == emby.LazyTemplateId {
+		templateId, err := emby.ResolveLazyTemplate(params.Account, params.AlistPath)
+		if err != nil {
+			log.Printf(colors.ToRed("解析转码清晰度失败: %v"), err)
+			apierr.Respond(c, http.StatusBadGateway, apierr.TranscodeFailed, "解析转码清晰度失败, 请检查日志")
+			return
+		}
+		params.TemplateId = templateId
+	}
+
+	legacy := emby.IsLegacyClient(c)
 	okContent := func(content string) {
+		if legacy {
+			content = shortenPlaylist(content)
+		}
 		c.Header("Content-Type", "application/vnd.apple.mpegurl")
 		c.String(http.StatusOK, content)
 	}
 
-	// ts 切片使用绝对路径
-	routePrefix := https.ClientRequestHost(c) + "/videos"
+	// 切片和字幕地址的前缀, 按照 video-preview.segment-url 配置使用绝对地址或相对地址
+	routePrefix := playlistRoutePrefix(c, legacy)
 
-	m3uContent, ok := GetPlaylist(params.AlistPath, params.TemplateId, true, true, routePrefix, params.ApiKey)
+	m3uContent, ok := GetPlaylist(params.AlistPath, params.TemplateId, params.Account, true, true, routePrefix, params.ApiKey)
 	if ok {
 		okContent(m3uContent)
 		return
 	}
 
 	// 获取失败, 将当前请求的地址加入到预处理通道
-	PushPlaylistAsync(Info{AlistPath: params.AlistPath, TemplateId: params.TemplateId})
+	PushPlaylistAsync(Info{AlistPath: params.AlistPath, TemplateId: params.TemplateId, Account: params.Account})
 
 	// 重新获取一次
-	m3uContent, ok = GetPlaylist(params.AlistPath, params.TemplateId, true, true, routePrefix, params.ApiKey)
+	m3uContent, ok = GetPlaylist(params.AlistPath, params.TemplateId, params.Account, true, true, routePrefix, params.ApiKey)
 	if ok {
 		okContent(m3uContent)
 		return
 	}
-	c.String(http.StatusBadRequest, "获取不到播放列表, 请检查日志")
+	apierr.Respond(c, http.StatusBadRequest, apierr.TranscodeFailed, "获取不到播放列表, 请检查日志")
+}
+
+// shortenPlaylist 将播放列表中的切片地址替换为短链接, 供无法处理长地址的旧设备使用
+func shortenPlaylist(content string) string {
+	lines := strings.Split(content, "\n")
+	for i, line := range lines {
+		if line = strings.TrimSpace(line); line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines[i] = emby.ShortenUrl(line)
+	}
+	return strings.Join(lines, "\n")
 }
 
 // ProxyTsLink 代理 ts 直链地址
 func ProxyTsLink(c *gin.Context) {
+	if castCompat(c) {
+		return
+	}
 	params, err := baseCheck(c)
 	if err != nil {
 		log.Printf(colors.ToRed("代理 ts 失败: %v"), err)
-		c.String(http.StatusBadRequest, "代理 ts 失败, 请检查日志")
+		apierr.Respond(c, http.StatusBadRequest, apierr.InvalidRequest, "代理 ts 失败, 请检查日志")
 		return
 	}
 
 	idx, err := strconv.Atoi(params.IdxStr)
 	if err != nil || idx < 0 {
-		c.String(http.StatusBadRequest, "无效 idx")
+		apierr.Respond(c, http.StatusBadRequest, apierr.InvalidRequest, "无效 idx")
 		return
 	}
 
 	okRedirect := func(link string) {
+		if serveHotSegment(c, params, idx, link) {
+			return
+		}
 		log.Printf(colors.ToGreen("重定向 ts: %s"), link)
 		c.Redirect(http.StatusTemporaryRedirect, link)
 	}
 
-	tsLink, ok := GetTsLink(params.AlistPath, params.TemplateId, idx)
+	tsLink, ok := GetTsLink(params.AlistPath, params.TemplateId, params.Account, idx)
 	if ok {
 		okRedirect(tsLink)
 		return
 	}
 
 	// 获取失败, 将当前请求的地址加入到预处理通道
-	PushPlaylistAsync(Info{AlistPath: params.AlistPath, TemplateId: params.TemplateId})
+	PushPlaylistAsync(Info{AlistPath: params.AlistPath, TemplateId: params.TemplateId, Account: params.Account})
 
-	tsLink, ok = GetTsLink(params.AlistPath, params.TemplateId, idx)
+	tsLink, ok = GetTsLink(params.AlistPath, params.TemplateId, params.Account, idx)
 	if ok {
 		okRedirect(tsLink)
 		return
 	}
-	c.String(http.StatusBadRequest, "获取不到 ts, 请检查日志")
+	apierr.Respond(c, http.StatusBadRequest, apierr.TranscodeFailed, "获取不到 ts, 请检查日志")
 }
 
 // ProxySubtitle 代理字幕请求
 func ProxySubtitle(c *gin.Context) {
+	if castCompat(c) {
+		return
+	}
 	params, err := baseCheck(c)
 	if err != nil {
 		log.Printf(colors.ToRed("代理字幕失败: %v"), err)
-		c.String(http.StatusBadRequest, "代理字幕失败, 请检查日志")
+		apierr.Respond(c, http.StatusBadRequest, apierr.InvalidRequest, "代理字幕失败, 请检查日志")
 		return
 	}
 
 	subName := c.Query("sub_name")
 	if strs.AnyEmpty(subName) {
-		c.String(http.StatusBadRequest, "代理字幕失败, 缺少 sub_name 参数")
+		apierr.Respond(c, http.StatusBadRequest, apierr.InvalidRequest, "代理字幕失败, 缺少 sub_name 参数")
 		return
 	}
 
 	proxySubtitle := func(link string) {
 		log.Printf(colors.ToGreen("代理字幕: %s"), link)
-		resp, err := https.Request(http.MethodGet, link, nil, nil)
+		resp, err := https.RequestCtx(c.Request.Context(), http.MethodGet, link, nil, nil)
 		if err != nil {
 			log.Printf(colors.ToRed("代理字幕失败: %v"), err)
-			c.String(http.StatusInternalServerError, "代理字幕失败, 请检查日志")
+			apierr.Respond(c, http.StatusInternalServerError, apierr.TranscodeFailed, "代理字幕失败, 请检查日志")
 			return
 		}
 		defer resp.Body.Close()
 		https.CloneHeader(c, resp.Header)
+		if config.C.VideoPreview.CastCompat.Enable {
+			// 网盘返回的字幕类型通常是 application/octet-stream, 投屏设备无法识别
+			castCompat(c)
+			if strings.HasSuffix(strings.ToLower(subName), ".vtt") {
+				c.Header("Content-Type", "text/vtt; charset=utf-8")
+			}
+		}
 		c.Status(resp.StatusCode)
 		if _, err = io.Copy(c.Writer, resp.Body); err != nil {
 			log.Printf(colors.ToRed("代理字幕失败: %v"), err)
-			c.String(http.StatusInternalServerError, "代理字幕失败, 请检查日志")
+			apierr.Respond(c, http.StatusInternalServerError, apierr.TranscodeFailed, "代理字幕失败, 请检查日志")
 			return
 		}
 	}
 
-	subtitleLink, ok := GetSubtitleLink(params.AlistPath, params.TemplateId, subName)
+	subtitleLink, ok := GetSubtitleLink(params.AlistPath, params.TemplateId, params.Account, subName)
 	if ok {
 		proxySubtitle(subtitleLink)
 		return
 	}
 
 	// 获取失败, 将当前请求的地址加入到预处理通道
-	PushPlaylistAsync(Info{AlistPath: params.AlistPath, TemplateId: params.TemplateId})
+	PushPlaylistAsync(Info{AlistPath: params.AlistPath, TemplateId: params.TemplateId, Account: params.Account})
 
-	subtitleLink, ok = GetSubtitleLink(params.AlistPath, params.TemplateId, subName)
+	subtitleLink, ok = GetSubtitleLink(params.AlistPath, params.TemplateId, params.Account, subName)
 	if ok {
 		proxySubtitle(subtitleLink)
 		return
 	}
-	c.String(http.StatusBadRequest, "获取不到字幕")
+	apierr.Respond(c, http.StatusBadRequest, apierr.TranscodeFailed, "获取不到字幕")
 }
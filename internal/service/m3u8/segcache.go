@@ -0,0 +1,190 @@
+package m3u8
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
+
+	"github.com/gin-gonic/gin"
+)
+
+// segFreqMaxKeys 访问频率表最多记录多少个切片, 超出时所有切片的频率减半, 使过时的热门切片逐渐失去优先级
+const segFreqMaxKeys = 10000
+
+// segCacheHeaders 缓存切片时保留的响应头
+var segCacheHeaders = []string{"Content-Type", "Content-Range", "Accept-Ranges", "Last-Modified", "ETag"}
+
+// segEntry 缓存的切片响应
+type segEntry struct {
+	code   int
+	header http.Header
+	body   []byte
+}
+
+var (
+	// segEntries 切片 key => 缓存的切片响应
+	segEntries = map[string]*segEntry{}
+	// segFreq 切片 key => 访问频率
+	segFreq = map[string]int{}
+	// segSize 缓存的切片总大小
+	segSize int64
+	// segMu 并发控制
+	segMu sync.Mutex
+)
+
+// segKey 计算切片的缓存 key, 由切片地址 (不含会过期的签名参数) 和请求的字节范围组成
+func segKey(params ProxyParams, idx int, rangeHeader string) string {
+	return params.Account + "|" + params.AlistPath + "|" + params.TemplateId + "|" + strconv.Itoa(idx) + "|" + rangeHeader
+}
+
+// serveHotSegment 按照 video-preview.segment-cache 配置, 使用内存缓存响应热门切片
+//
+// 命中缓存时直接回写; 未命中但访问频率达到 min-hits 时由本程序从网盘获取切片, 回写的同时尝试写入缓存;
+// 返回 false 表示不处理, 由调用方重定向到网盘
+func serveHotSegment(c *gin.Context, params ProxyParams, idx int, link string) bool {
+	cfg := config.C.VideoPreview.SegmentCache
+	if !cfg.Enable || idx >= cfg.Segments {
+		return false
+	}
+
+	rangeHeader := c.GetHeader("Range")
+	key := segKey(params, idx, rangeHeader)
+	entry, freq := touchSegment(key)
+	if entry != nil {
+		logs.Debugf("命中热门切片缓存, idx: %d, alistPath: %s", idx, params.AlistPath)
+		writeSegment(c, entry)
+		return true
+	}
+	if freq < cfg.MinHits {
+		return false
+	}
+
+	header := make(http.Header)
+	if rangeHeader != "" {
+		header.Set("Range", rangeHeader)
+	}
+	start := time.Now()
+	resp, err := https.RequestCtx(c.Request.Context(), http.MethodGet, link, header, nil)
+	metrics.ObserveLatency(metrics.UpstreamSegment, time.Since(start))
+	if err != nil {
+		log.Printf(colors.ToYellow("获取热门切片失败, 回退到重定向: %v"), err)
+		return false
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		log.Printf(colors.ToYellow("获取热门切片失败, 回退到重定向, code: %d"), resp.StatusCode)
+		return false
+	}
+
+	max := cfg.MaxSegmentSizeBytes()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, max+1))
+	if err != nil {
+		log.Printf(colors.ToYellow("读取热门切片失败, 回退到重定向: %v"), err)
+		return false
+	}
+	entry = &segEntry{code: resp.StatusCode, header: make(http.Header), body: body}
+	for _, name := range segCacheHeaders {
+		if value := resp.Header.Get(name); value != "" {
+			entry.header.Set(name, value)
+		}
+	}
+
+	if int64(len(body)) > max {
+		// 切片超出大小限制, 不缓存, 将已经读取的部分和剩余部分一起回写
+		https.CloneHeader(c, entry.header)
+		if length := resp.Header.Get("Content-Length"); length != "" {
+			c.Header("Content-Length", length)
+		}
+		c.Status(entry.code)
+		io.Copy(c.Writer, io.MultiReader(bytes.NewReader(body), resp.Body))
+		return true
+	}
+
+	if admitSegment(key, entry) {
+		logs.Debugf("热门切片写入缓存, idx: %d, 频率: %d, alistPath: %s", idx, freq, params.AlistPath)
+	}
+	writeSegment(c, entry)
+	return true
+}
+
+// writeSegment 回写缓存的切片响应
+func writeSegment(c *gin.Context, entry *segEntry) {
+	https.CloneHeader(c, entry.header)
+	c.Header("Content-Length", strconv.Itoa(len(entry.body)))
+	c.Status(entry.code)
+	c.Writer.Write(entry.body)
+}
+
+// touchSegment 记录切片的一次访问, 返回缓存的响应 (未缓存时为 nil) 和当前的访问频率
+func touchSegment(key string) (*segEntry, int) {
+	segMu.Lock()
+	defer segMu.Unlock()
+	segFreq[key]++
+	if len(segFreq) > segFreqMaxKeys {
+		for k, f := range segFreq {
+			if f /= 2; f > 0 {
+				segFreq[k] = f
+				continue
+			}
+			if _, ok := segEntries[k]; ok {
+				segFreq[k] = 1
+				continue
+			}
+			delete(segFreq, k)
+		}
+	}
+	return segEntries[key], segFreq[key]
+}
+
+// admitSegment LFU 准入, 将切片写入缓存
+//
+// 缓存空间不足时依次淘汰访问频率最低的切片, 被淘汰的切片频率不低于新切片时放弃写入
+func admitSegment(key string, entry *segEntry) bool {
+	segMu.Lock()
+	defer segMu.Unlock()
+	if _, ok := segEntries[key]; ok {
+		return false
+	}
+	size, limit := int64(len(entry.body)), config.C.VideoPreview.SegmentCache.MaxSizeBytes()
+	if size > limit {
+		return false
+	}
+	freq := segFreq[key]
+
+	victims := make([]string, 0)
+	freed := int64(0)
+	for segSize-freed+size > limit {
+		victim, victimFreq := "", 0
+		for k := range segEntries {
+			if slices.Contains(victims, k) {
+				continue
+			}
+			if f := segFreq[k]; victim == "" || f < victimFreq {
+				victim, victimFreq = k, f
+			}
+		}
+		if victim == "" || victimFreq >= freq {
+			return false
+		}
+		victims = append(victims, victim)
+		freed += int64(len(segEntries[victim].body))
+	}
+
+	for _, victim := range victims {
+		delete(segEntries, victim)
+	}
+	segEntries[key] = entry
+	segSize += size - freed
+	return true
+}
@@ -0,0 +1,57 @@
+package m3u8
+
+import (
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+)
+
+// applyPlaylistTags 按照 video-preview.playlist-tags 配置, 移除和注入播放列表中的标签
+//
+// 注入的标签写在头注释之后, 播放列表中已有的同名标签会被替换
+func applyPlaylistTags(content, templateId string) string {
+	strip, inject := map[string]struct{}{}, make([]string, 0)
+	for _, rule := range config.C.VideoPreview.PlaylistTags {
+		if !rule.Match(templateId) {
+			continue
+		}
+		for _, tag := range rule.Strip {
+			strip[tag] = struct{}{}
+		}
+		for _, tag := range rule.Inject {
+			strip[tagName(tag)] = struct{}{}
+			inject = append(inject, tag)
+		}
+	}
+	if len(strip) == 0 {
+		return content
+	}
+
+	lines := strings.Split(content, "\n")
+	res := make([]string, 0, len(lines)+len(inject))
+	injected := len(inject) == 0
+	for _, line := range lines {
+		name := tagName(line)
+		if _, ok := strip[name]; ok {
+			continue
+		}
+		if !injected {
+			// 遇到第一个非头注释的行时写入注入的标签
+			if _, ok := ParentHeadComments[name]; !ok {
+				res = append(res, inject...)
+				injected = true
+			}
+		}
+		res = append(res, line)
+	}
+	if !injected {
+		res = append(res, inject...)
+	}
+	return strings.Join(res, "\n")
+}
+
+// tagName 获取标签行的标签名称, 如: #EXT-X-START:TIME-OFFSET=0 => #EXT-X-START
+func tagName(line string) string {
+	name, _, _ := strings.Cut(line, ":")
+	return name
+}
@@ -1,6 +1,10 @@
 package m3u8
 
-import "github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+import (
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+)
 
 // ParentHeadComments 记录文件头注释
 var ParentHeadComments = map[string]struct{}{
@@ -26,6 +30,7 @@ var ValidM3U8Contents = map[string]struct{}{
 type Info struct {
 	AlistPath     string               // 资源在 alist 中的绝对路径
 	TemplateId    string               // 转码资源模板 id
+	Account       string               // 请求转码资源使用的 alist 账号, 为空表示默认账号
 	Subtitles     []alist.SubtitleInfo // 字幕信息, 如果一个资源是含有字幕的, 会返回变体 m3u8
 	RemoteBase    string               // 远程 m3u8 地址前缀
 	HeadComments  []string             // 头注释信息
@@ -34,17 +39,39 @@ type Info struct {
 
 	// LastRead 客户端最后读取的时间戳 (毫秒)
 	//
-	// 超过 30 分钟未读取, 程序停止更新;
-	// 超过 12 小时未读取, m3u info 被移除
+	// 超过 video-preview.playlist-refresh.active-window 未读取, 程序停止在后台更新
 	LastRead int64
 
+	// LastPlay 客户端最后一次请求播放列表、分片或字幕的时间戳 (毫秒)
+	//
+	// 在 video-preview.playlist-refresh.active-window 内被客户端播放的 m3u info 会被固定在内存中,
+	// 不会因为内存已满或者长时间未更新而被淘汰, 直到会话结束
+	LastPlay int64
+
 	// LastUpdate 程序最后的更新时间戳 (毫秒)
 	//
-	// 客户端来读取时, 如果 m3u info 已经超过 10 分钟没有更新了
-	// 触发更新机制之后, 再返回最新的地址
+	// 正在播放的 m3u info 超过 video-preview.playlist-refresh.max-age 没有更新时, 在后台更新;
+	// 客户端来读取时, 如果 m3u info 已经停止在后台更新, 触发更新机制之后, 再返回最新的地址;
+	// 超过 1 小时没有更新, m3u info 被移除 (被固定的除外)
 	LastUpdate int64
 }
 
+// PlaylistStatus 一个播放列表的维护状态
+type PlaylistStatus struct {
+	AlistPath   string    // 资源在 alist 中的绝对路径
+	TemplateId  string    // 转码资源模板 id
+	Account     string    // 请求转码资源使用的 alist 账号, 为空表示默认账号
+	Cached      bool      // 是否维护在内存中, 更新失败的播放列表会被移除
+	Segments    int       // ts 分片个数
+	LastRead    time.Time // 客户端最后读取的时间
+	LastUpdate  time.Time // 程序最后的更新时间
+	Age         string    // 距离上次更新的时长
+	Active      bool      // 是否正在后台刷新
+	Pinned      bool      // 是否被正在播放的会话固定, 固定的播放列表不会被淘汰
+	LastError   string    // 最近一次更新失败的原因
+	LastErrorAt time.Time // 最近一次更新失败的时间
+}
+
 // TsInfo 记录一个 ts 相关信息
 type TsInfo struct {
 	Comments []string // 注释信息
@@ -59,4 +86,7 @@ type ProxyParams struct {
 	Type       string `form:"type"`
 	ApiKey     string `form:"api_key"`
 	IdxStr     string `form:"idx"`
+
+	// Account 根据请求用户匹配到的 alist 账号, 不从请求参数中读取
+	Account string `form:"-"`
 }
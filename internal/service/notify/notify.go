@@ -0,0 +1,143 @@
+// 异常通知功能, 当上游服务连续出现异常时
+// 通过 webhook 或 telegram 机器人推送通知
+package notify
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// Kind 异常类型
+type Kind string
+
+const (
+	KindAlist  Kind = "alist"  // alist 资源解析失败
+	KindEmby   Kind = "emby"   // emby 源服务器无法访问
+	KindSchema Kind = "schema" // 上游响应结构异常
+)
+
+// TelegramApi telegram 机器人消息推送接口
+const TelegramApi = "https://api.telegram.org/bot%s/sendMessage"
+
+// counter 记录某一类异常的状态
+type counter struct {
+	failures int       // 连续失败次数
+	lastSent time.Time // 最后一次推送通知的时间
+}
+
+// counters 各类异常的状态
+var counters = map[Kind]*counter{}
+
+// mu 并发控制
+var mu sync.Mutex
+
+// Failure 记录一次异常
+//
+// 当同一类异常连续出现的次数达到配置阈值, 并且距离上一次通知超过配置的间隔时,
+// 异步推送通知
+func Failure(kind Kind, msg string) {
+	if !enabled() {
+		return
+	}
+	cfg := config.C.Notify
+
+	mu.Lock()
+	defer mu.Unlock()
+	ct, ok := counters[kind]
+	if !ok {
+		ct = new(counter)
+		counters[kind] = ct
+	}
+	ct.failures++
+	if ct.failures < cfg.Threshold || time.Since(ct.lastSent) < cfg.IntervalDuration() {
+		return
+	}
+	ct.lastSent = time.Now()
+
+	text := fmt.Sprintf("[go-emby2alist] %s 连续异常 %d 次, 最近一次异常: %s", kind, ct.failures, msg)
+	go send(kind, text)
+}
+
+// Alert 直接推送一条通知, 不计入连续失败次数, 但同样遵守同一类异常的通知间隔
+//
+// 用于调用方已经自行聚合过的异常
+func Alert(kind Kind, msg string) {
+	if !enabled() {
+		return
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	ct, ok := counters[kind]
+	if !ok {
+		ct = new(counter)
+		counters[kind] = ct
+	}
+	if time.Since(ct.lastSent) < config.C.Notify.IntervalDuration() {
+		return
+	}
+	ct.lastSent = time.Now()
+	go send(kind, "[go-emby2alist] "+msg)
+}
+
+// Success 记录一次成功请求, 重置连续失败次数
+func Success(kind Kind) {
+	if !enabled() {
+		return
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if ct, ok := counters[kind]; ok {
+		ct.failures = 0
+	}
+}
+
+// enabled 判断通知功能是否启用
+func enabled() bool {
+	return config.C != nil && config.C.Notify != nil && config.C.Notify.Enable
+}
+
+// send 推送通知到所有已配置的渠道
+func send(kind Kind, text string) {
+	cfg := config.C.Notify
+
+	if strs.AllNotEmpty(cfg.Webhook) {
+		body := map[string]interface{}{
+			"kind": kind,
+			"text": text,
+			"time": time.Now().Format(time.DateTime),
+		}
+		post(cfg.Webhook, body)
+	}
+
+	if cfg.Telegram.Valid() {
+		body := map[string]interface{}{
+			"chat_id": cfg.Telegram.ChatId,
+			"text":    text,
+		}
+		post(fmt.Sprintf(TelegramApi, cfg.Telegram.BotToken), body)
+	}
+}
+
+// post 以 json 请求体发送通知
+func post(u string, body map[string]interface{}) {
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json;charset=utf-8")
+	resp, err := https.Request(http.MethodPost, u, header, https.MapBody(body))
+	if err != nil {
+		log.Printf(colors.ToRed("推送异常通知失败: %v"), err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf(colors.ToRed("推送异常通知失败, 响应码: %d"), resp.StatusCode)
+	}
+}
@@ -1,13 +1,21 @@
 package path
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
+	stdpath "path"
+	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/config"
 	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
 )
 
@@ -22,15 +30,31 @@ type AlistPathRes struct {
 
 	// Range 遍历所有 Alist 根路径生成的子路径
 	Range func() ([]string, error)
+
+	// EmbyPath 转换前的 Emby 路径, 用于缓存最终请求成功的 Alist 路径
+	EmbyPath string
+
+	// Size 资源在 Emby 中记录的大小, 路径不存在时用于查找重命名后的文件
+	Size int64
+
+	// RunTime 资源在 Emby 中记录的时长, 存在多个大小一致的文件时用于进一步筛选
+	RunTime time.Duration
 }
 
 // Emby2Alist Emby 资源路径转 Alist 资源路径
 func Emby2Alist(embyPath string) AlistPathRes {
-	embyPath = urls.TransferSlash(embyPath)
-	embyMount := config.C.Emby.MountPath
-	alistFilePath := strings.ReplaceAll(embyPath, embyMount, "")
+	embyPath = config.C.Path.NormalizePath(urls.TransferSlash(embyPath))
+	linkPath := config.C.Path.NormalizePath(resolveLink(embyPath))
+	embyMount := config.C.Path.NormalizePath(urls.TransferSlash(config.C.Path.MountPath(config.C.Emby.MountPath)))
+	alistFilePath, ok := config.C.Path.TrimPrefix(linkPath, embyMount)
+	if !ok {
+		alistFilePath = strings.ReplaceAll(linkPath, embyMount, "")
+	}
 	if mapPath, ok := config.C.Path.MapEmby2Alist(alistFilePath); ok {
 		alistFilePath = mapPath
+	} else if mapPath, ok := config.C.Path.MapEmby2Alist(linkPath); ok && urls.IsWinDrivePath(linkPath) {
+		// Windows 盘符路径允许直接配置盘符前缀的映射, 如: D:\Media\电影:/电影
+		alistFilePath = mapPath
 	}
 
 	rangeFunc := func() ([]string, error) {
@@ -39,7 +63,7 @@ func Emby2Alist(embyPath string) AlistPathRes {
 			return nil, fmt.Errorf("alistFilePath 解析异常: %s, error: %v", alistFilePath, err)
 		}
 
-		res := alist.FetchFsList("/", nil)
+		res := alist.FetchFsList(context.Background(), "/", nil)
 		if res.Code != http.StatusOK {
 			return nil, fmt.Errorf("请求 alist fs list 接口异常: %s", res.Msg)
 		}
@@ -63,10 +87,30 @@ func Emby2Alist(embyPath string) AlistPathRes {
 	}
 
 	return AlistPathRes{
-		Success: true,
-		Path:    alistFilePath,
-		Range:   rangeFunc,
+		Success:  true,
+		Path:     alistFilePath,
+		Range:    rangeFunc,
+		EmbyPath: embyPath,
+	}
+}
+
+// resolveLink 按照 path.bind-mounts 替换路径前缀, 开启 path.resolve-symlinks 时再解析路径中的软链接
+//
+// 路径在本机不存在或解析失败时, 使用替换前缀之后的路径
+func resolveLink(embyPath string) string {
+	linkPath, _ := config.C.Path.MapBindMount(embyPath)
+	if !config.C.Path.ResolveSymlinks || urls.IsRemote(linkPath) {
+		return linkPath
+	}
+	realPath, err := filepath.EvalSymlinks(filepath.FromSlash(linkPath))
+	if err != nil {
+		logs.Debugf(colors.ToYellow("解析软链接失败, 使用原始路径: %s, err: %v"), linkPath, err)
+		return linkPath
 	}
+	if realPath = urls.TransferSlash(realPath); realPath != linkPath {
+		logs.Debugf(colors.ToBlue("软链接解析: %s => %s"), linkPath, realPath)
+	}
+	return realPath
 }
 
 // SplitFromSecondSlash 找到给定字符串 str 中第二个 '/' 字符的位置
@@ -85,3 +129,123 @@ func SplitFromSecondSlash(str string) (string, error) {
 
 	return str[secondIdx+firstIdx+1:], nil
 }
+
+// FindFold 从根目录开始逐级列出 alist 目录, 查找与 alistPath 名称一致的文件
+//
+// 名称比较时统一 Unicode 规范化形式, 开启 path.ignore-case 时忽略大小写,
+// 用于兼容 macOS 创建的文件名以及大小写不敏感的存储, 返回文件在 alist 中的真实路径
+func FindFold(ctx context.Context, alistPath string) (string, error) {
+	segs := strings.Split(strings.Trim(urls.TransferSlash(alistPath), "/"), "/")
+	dir := "/"
+	for _, seg := range segs {
+		res := alist.FetchFsList(ctx, dir, nil)
+		if res.Code != http.StatusOK {
+			return "", fmt.Errorf("请求 alist fs list 接口异常: %s, path: %s", res.Msg, dir)
+		}
+		content, ok := res.Data.Attr("content").Done()
+		if !ok || content.Type() != jsons.JsonTypeArr {
+			return "", fmt.Errorf("alist fs list 接口响应异常, path: %s", dir)
+		}
+
+		found := ""
+		content.RangeArr(func(_ int, value *jsons.Item) error {
+			if name, _ := value.Attr("name").String(); config.C.Path.NameEqual(name, seg) {
+				found = name
+				return jsons.ErrBreakRange
+			}
+			return nil
+		})
+		if found == "" {
+			return "", fmt.Errorf("alist 目录 [%s] 中不存在: %s", dir, seg)
+		}
+		dir = strings.TrimSuffix(dir, "/") + "/" + found
+	}
+	return dir, nil
+}
+
+// moveRunTimeTolerance 按照时长筛选文件时允许的误差
+const moveRunTimeTolerance = time.Second * 2
+
+// FindMoved 在 alistPath 的父目录中查找大小为 size 的文件, 用于定位在网盘中被重命名的文件
+//
+// 存在多个大小一致的文件时, 优先选择扩展名一致的文件, 仍无法确定时,
+// 如果 runTime 大于 0, 再通过 alist 转码信息中的时长进行筛选, 最终只有唯一的候选文件才返回
+func FindMoved(ctx context.Context, alistPath string, size int64, runTime time.Duration) (string, error) {
+	if size <= 0 {
+		return "", errors.New("资源大小未知, 无法查找重命名后的文件")
+	}
+	alistPath = urls.TransferSlash(alistPath)
+	dir := stdpath.Dir(alistPath)
+	res := alist.FetchFsList(ctx, dir, nil)
+	if res.Code != http.StatusOK {
+		return "", fmt.Errorf("请求 alist fs list 接口异常: %s, path: %s", res.Msg, dir)
+	}
+	content, ok := res.Data.Attr("content").Done()
+	if !ok || content.Type() != jsons.JsonTypeArr {
+		return "", fmt.Errorf("alist fs list 接口响应异常, path: %s", dir)
+	}
+
+	candidates := make([]string, 0)
+	content.RangeArr(func(_ int, value *jsons.Item) error {
+		if value.Attr("is_dir").Val() == true {
+			return nil
+		}
+		if s, _ := jsonNumber(value.Attr("size")); int64(s) != size {
+			return nil
+		}
+		if name, _ := value.Attr("name").String(); strs.AllNotEmpty(name) {
+			candidates = append(candidates, stdpath.Join(dir, name))
+		}
+		return nil
+	})
+
+	if len(candidates) > 1 {
+		candidates = filterMoved(candidates, func(p string) bool {
+			return strings.EqualFold(stdpath.Ext(p), stdpath.Ext(alistPath))
+		})
+	}
+	if len(candidates) > 1 && runTime > 0 {
+		candidates = filterMoved(candidates, func(p string) bool {
+			res := alist.FetchFsOther(ctx, p, nil)
+			if res.Code != http.StatusOK {
+				return false
+			}
+			sec, ok := jsonNumber(res.Data.Attr("video_preview_play_info").Attr("meta").Attr("duration"))
+			diff := time.Duration(sec*float64(time.Second)) - runTime
+			return ok && diff < moveRunTimeTolerance && diff > -moveRunTimeTolerance
+		})
+	}
+
+	switch len(candidates) {
+	case 0:
+		return "", fmt.Errorf("alist 目录 [%s] 中不存在大小为 %d 的文件", dir, size)
+	case 1:
+		return candidates[0], nil
+	}
+	return "", fmt.Errorf("alist 目录 [%s] 中存在多个大小为 %d 的文件: %v", dir, size, candidates)
+}
+
+// filterMoved 筛选候选文件, 没有文件满足条件时保留原有的候选文件
+func filterMoved(candidates []string, keep func(string) bool) []string {
+	res := make([]string, 0, len(candidates))
+	for _, c := range candidates {
+		if keep(c) {
+			res = append(res, c)
+		}
+	}
+	if len(res) == 0 {
+		return candidates
+	}
+	return res
+}
+
+// jsonNumber 获取 json 中的数字, 兼容整数和浮点数
+func jsonNumber(ti *jsons.TempItem) (float64, bool) {
+	if v, ok := ti.Int(); ok {
+		return float64(v), true
+	}
+	if v, ok := ti.Int64(); ok {
+		return float64(v), true
+	}
+	return ti.Float()
+}
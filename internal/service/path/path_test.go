@@ -1,9 +1,13 @@
 package path_test
 
 import (
+	"fmt"
 	"log"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
 	"github.com/AmbitiousJun/go-emby2alist/internal/service/path"
 )
 
@@ -11,3 +15,94 @@ func TestSplit(t *testing.T) {
 	str := `H:\Phim4K\The.Lockdown.2024.2160p.WEB-DL.DDP5.1.DV.HDR.H.265-FLUX.mkv`
 	log.Println(path.SplitFromSecondSlash(str))
 }
+
+func TestEmby2AlistLink(t *testing.T) {
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	real := filepath.Join(root, "cloud", "movie", "Avatar (2009)")
+	if err := os.MkdirAll(real, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(real, "Avatar.mkv"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	links := filepath.Join(root, "links")
+	if err := os.MkdirAll(links, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join("..", "cloud", "movie", "Avatar (2009)"), filepath.Join(links, "Avatar")); err != nil {
+		t.Skipf("不支持创建软链接: %v", err)
+	}
+
+	cfg := fmt.Sprintf(`emby:
+  host: http://127.0.0.1:8096
+  api-key: test
+  mount-path: %s/cloud
+alist:
+  host: http://127.0.0.1:5244
+  token: test
+path:
+  emby2alist:
+    - /movie:/电影
+  resolve-symlinks: true
+  bind-mounts:
+    - /media:%s
+`, root, links)
+	if err := config.ReadFromBytes([]byte(cfg), t.TempDir()); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct{ embyPath, want string }{
+		{embyPath: "/media/Avatar/Avatar.mkv", want: "/电影/Avatar (2009)/Avatar.mkv"},
+		{embyPath: links + "/Avatar/Avatar.mkv", want: "/电影/Avatar (2009)/Avatar.mkv"},
+		{embyPath: root + "/cloud/movie/Avatar (2009)/Avatar.mkv", want: "/电影/Avatar (2009)/Avatar.mkv"},
+		// 本机不存在的路径保持不变
+		{embyPath: root + "/cloud/movie/missing.mkv", want: "/电影/missing.mkv"},
+	}
+	for _, tt := range tests {
+		if got := path.Emby2Alist(tt.embyPath).Path; got != tt.want {
+			t.Errorf("Emby2Alist(%s) = %s, want: %s", tt.embyPath, got, tt.want)
+		}
+	}
+}
+
+func TestEmby2AlistProfile(t *testing.T) {
+	cfg := `emby:
+  host: http://127.0.0.1:8096
+  api-key: test
+  mount-path: /data
+alist:
+  host: http://127.0.0.1:5244
+  token: test
+path:
+  emby2alist:
+    - /movie:/电影
+  profile: home
+  profiles:
+    home: {}
+    vps:
+      mount-path: /mnt/cd2
+      emby2alist:
+        - /movie:/115/电影
+`
+	tests := []struct{ env, embyPath, want string }{
+		{env: "", embyPath: "/data/movie/a.mkv", want: "/电影/a.mkv"},
+		{env: "vps", embyPath: "/mnt/cd2/movie/a.mkv", want: "/115/电影/a.mkv"},
+	}
+	for _, tt := range tests {
+		t.Setenv(config.PathProfileEnv, tt.env)
+		if err := config.ReadFromBytes([]byte(cfg), t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+		if got := path.Emby2Alist(tt.embyPath).Path; got != tt.want {
+			t.Errorf("[%s] Emby2Alist(%s) = %s, want: %s", tt.env, tt.embyPath, got, tt.want)
+		}
+	}
+
+	t.Setenv(config.PathProfileEnv, "missing")
+	if err := config.ReadFromBytes([]byte(cfg), t.TempDir()); err == nil {
+		t.Error("不存在的配置组应该初始化失败")
+	}
+}
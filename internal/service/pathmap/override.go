@@ -0,0 +1,99 @@
+package pathmap
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/store"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+)
+
+// Override 手动指定的路径, 优先于自动映射和映射缓存
+type Override struct {
+	ItemId    string    // emby item id
+	EmbyPath  string    // 资源在 emby 中的路径
+	AlistPath string    // 手动指定的 alist 路径
+	CreatedAt time.Time // 指定时间
+}
+
+var (
+	// overrides emby 路径 => 手动指定的路径
+	overrides map[string]Override
+	// overridesMu 并发控制
+	overridesMu sync.RWMutex
+	// overridesOnce 首次使用时从存储中加载
+	overridesOnce sync.Once
+)
+
+// GetOverride 获取 emby 路径手动指定的 alist 路径
+func GetOverride(embyPath string) (string, bool) {
+	loadOverrides()
+	overridesMu.RLock()
+	defer overridesMu.RUnlock()
+	o, ok := overrides[embyPath]
+	return o.AlistPath, ok
+}
+
+// SetOverride 手动指定 item 资源的 alist 路径, 同一个 item 之前指定的路径会被替换
+func SetOverride(o Override) error {
+	loadOverrides()
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	if err := store.Default().Put(store.BucketPathOverrides, o.ItemId, o); err != nil {
+		return err
+	}
+	for embyPath, old := range overrides {
+		if old.ItemId == o.ItemId {
+			delete(overrides, embyPath)
+		}
+	}
+	overrides[o.EmbyPath] = o
+	return nil
+}
+
+// RemoveOverride 移除 item 手动指定的路径, 不存在时返回 false
+func RemoveOverride(itemId string) bool {
+	loadOverrides()
+	overridesMu.Lock()
+	defer overridesMu.Unlock()
+	removed := false
+	for embyPath, o := range overrides {
+		if o.ItemId == itemId {
+			delete(overrides, embyPath)
+			removed = true
+		}
+	}
+	store.Default().Delete(store.BucketPathOverrides, itemId)
+	return removed
+}
+
+// Overrides 获取所有手动指定的路径, 按照指定时间排列
+func Overrides() []Override {
+	loadOverrides()
+	overridesMu.RLock()
+	defer overridesMu.RUnlock()
+	res := make([]Override, 0, len(overrides))
+	for _, o := range overrides {
+		res = append(res, o)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].CreatedAt.Before(res[j].CreatedAt) })
+	return res
+}
+
+// loadOverrides 从存储中加载所有手动指定的路径
+func loadOverrides() {
+	overridesOnce.Do(func() {
+		overrides = make(map[string]Override)
+		s := store.Default()
+		for _, itemId := range s.Keys(store.BucketPathOverrides) {
+			var o Override
+			if _, err := s.Get(store.BucketPathOverrides, itemId, &o); err != nil {
+				log.Printf(colors.ToYellow("加载手动指定的路径失败, item: %s, err: %v"), itemId, err)
+				continue
+			}
+			overrides[o.EmbyPath] = o
+		}
+	})
+}
@@ -0,0 +1,166 @@
+// 路径映射缓存, 记录 emby 路径最终在 alist 中请求成功的路径
+package pathmap
+
+import (
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/store"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+)
+
+// entriesKey 映射记录在存储中的 key
+const entriesKey = "entries"
+
+// Entry 一条路径映射记录
+type Entry struct {
+	Account    string    // alist 账号, 默认账号为空
+	EmbyPath   string    // emby 路径
+	AlistPath  string    // 请求成功的 alist 路径
+	ResolvedAt time.Time // 记录时间
+	Corrected  bool      // 是否为按照文件大小匹配到的修正路径 (path.fuzzy-match)
+}
+
+var (
+	// entries alist 账号 + emby 路径 => 映射记录
+	entries map[string]Entry
+	// dirty 缓存是否有未保存到存储中的修改
+	dirty bool
+	// mu 并发控制
+	mu sync.Mutex
+	// loadOnce 首次使用时从存储中加载缓存
+	loadOnce sync.Once
+)
+
+// key 计算映射记录的 key
+func key(account, embyPath string) string {
+	return account + "|" + embyPath
+}
+
+// Get 获取未过期的 alist 路径
+//
+// 未启用 path.cache 时, 只返回修正路径
+func Get(account, embyPath string) (string, bool) {
+	if !config.C.Path.Cache.Enable && !config.C.Path.FuzzyMatch {
+		return "", false
+	}
+	load()
+	mu.Lock()
+	defer mu.Unlock()
+	k := key(account, embyPath)
+	e, ok := entries[k]
+	if !ok || (!config.C.Path.Cache.Enable && !e.Corrected) {
+		return "", false
+	}
+	if time.Since(e.ResolvedAt) > config.C.Path.Cache.TtlDuration() {
+		delete(entries, k)
+		dirty = true
+		return "", false
+	}
+	return e.AlistPath, true
+}
+
+// Put 记录 emby 路径在 alist 中请求成功的路径
+func Put(account, embyPath, alistPath string) {
+	if !config.C.Path.Cache.Enable {
+		return
+	}
+	load()
+	mu.Lock()
+	defer mu.Unlock()
+	entries[key(account, embyPath)] = Entry{Account: account, EmbyPath: embyPath, AlistPath: alistPath, ResolvedAt: time.Now()}
+	dirty = true
+}
+
+// Correct 记录按照文件大小匹配到的修正路径, 未启用 path.cache 时同样生效
+func Correct(account, embyPath, alistPath string) {
+	load()
+	mu.Lock()
+	defer mu.Unlock()
+	entries[key(account, embyPath)] = Entry{Account: account, EmbyPath: embyPath, AlistPath: alistPath, ResolvedAt: time.Now(), Corrected: true}
+	dirty = true
+}
+
+// Remove 移除 emby 路径在某个 alist 账号下的映射记录
+func Remove(account, embyPath string) {
+	load()
+	mu.Lock()
+	defer mu.Unlock()
+	if _, ok := entries[key(account, embyPath)]; ok {
+		delete(entries, key(account, embyPath))
+		dirty = true
+	}
+}
+
+// Lookup 获取 emby 路径在所有 alist 账号下的映射记录, 包括已经过期的记录
+func Lookup(embyPath string) []Entry {
+	load()
+	mu.Lock()
+	defer mu.Unlock()
+	res := make([]Entry, 0)
+	for _, e := range entries {
+		if e.EmbyPath == embyPath {
+			res = append(res, e)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Account < res[j].Account })
+	return res
+}
+
+// Invalidate 清除 emby 路径在所有 alist 账号下的映射记录, 返回清除的条数
+func Invalidate(embyPath string) int {
+	load()
+	mu.Lock()
+	defer mu.Unlock()
+	cnt := 0
+	for k, e := range entries {
+		if e.EmbyPath == embyPath {
+			delete(entries, k)
+			cnt++
+		}
+	}
+	if cnt > 0 {
+		dirty = true
+	}
+	return cnt
+}
+
+// load 从存储中加载缓存, 并在存储每次写入磁盘之前保存缓存
+func load() {
+	loadOnce.Do(func() {
+		entries = map[string]Entry{}
+		var stored []Entry
+		if _, err := store.Default().Get(store.BucketPathCache, entriesKey, &stored); err != nil {
+			log.Printf(colors.ToYellow("解析路径映射缓存失败, 重新记录: %v"), err)
+		}
+		for _, e := range stored {
+			entries[key(e.Account, e.EmbyPath)] = e
+		}
+
+		store.Default().BeforeFlush(flush)
+	})
+}
+
+// flush 将有修改的缓存保存到存储中, 过期的记录不保存
+func flush() {
+	mu.Lock()
+	defer mu.Unlock()
+	if !dirty {
+		return
+	}
+	stored := make([]Entry, 0, len(entries))
+	for k, e := range entries {
+		if time.Since(e.ResolvedAt) > config.C.Path.Cache.TtlDuration() {
+			delete(entries, k)
+			continue
+		}
+		stored = append(stored, e)
+	}
+	dirty = false
+	if err := store.Default().Put(store.BucketPathCache, entriesKey, stored); err != nil {
+		log.Printf(colors.ToRed("保存路径映射缓存失败: %v"), err)
+	}
+}
@@ -0,0 +1,199 @@
+//go:build !minimal
+
+package preview
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/encrypts"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/files"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// AliyunApi 阿里云盘开放平台接口地址
+var AliyunApi = "https://openapi.alipan.com"
+
+// AliyunTokenFile 刷新之后的 refresh token 持久化文件名称, 存放在配置文件所在目录下
+const AliyunTokenFile = "aliyun_tokens.json"
+
+// aliyunTokensMu 持久化文件的并发控制
+var aliyunTokensMu sync.Mutex
+
+// aliyunTemplates 阿里云盘转码清晰度对应的分辨率, 接口没有返回分辨率时使用
+var aliyunTemplates = map[string][2]int{
+	"LD":  {640, 360},
+	"SD":  {960, 540},
+	"HD":  {1280, 720},
+	"FHD": {1920, 1080},
+	"QHD": {2560, 1440},
+}
+
+// aliyunProvider 阿里云盘开放平台的转码预览接口
+type aliyunProvider struct {
+	cfg *config.PreviewProvider
+
+	// mu 并发控制, 保护登录凭证
+	mu sync.Mutex
+	// accessToken 接口调用凭证
+	accessToken string
+	// refreshToken 刷新凭证, 每次刷新之后都会更新
+	refreshToken string
+	// expired accessToken 的过期时间
+	expired time.Time
+	// driveId 使用的空间 id
+	driveId string
+}
+
+// playInfo 通过网盘路径查询文件 id, 再获取文件的转码信息
+func (ap *aliyunProvider) playInfo(ctx context.Context, drivePath string) (*jsons.Item, error) {
+	token, driveId, err := ap.login(ctx)
+	if err != nil {
+		return nil, err
+	}
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer "+token)
+
+	file, err := requestJson(ctx, http.MethodPost, AliyunApi+"/adrive/v1.0/openFile/get_by_path", header, map[string]interface{}{
+		"drive_id":  driveId,
+		"file_path": drivePath,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("查询文件失败: %s, %v", drivePath, err)
+	}
+	fileId, ok := file.Attr("file_id").String()
+	if !ok {
+		return nil, fmt.Errorf("查询文件失败: %s, 响应: %v", drivePath, file)
+	}
+
+	res, err := requestJson(ctx, http.MethodPost, AliyunApi+"/adrive/v1.0/openFile/getVideoPreviewPlayInfo", header, map[string]interface{}{
+		"drive_id":          driveId,
+		"file_id":           fileId,
+		"category":          "live_transcoding",
+		"template_id":       "",
+		"get_subtitle_info": true,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("获取转码信息失败: %v", err)
+	}
+	info, ok := res.Attr("video_preview_play_info").Done()
+	if !ok {
+		return nil, fmt.Errorf("获取转码信息失败, 响应: %v", res)
+	}
+
+	// 补充分辨率信息
+	if list, ok := info.Attr("live_transcoding_task_list").Done(); ok && list.Type() == jsons.JsonTypeArr {
+		list.RangeArr(func(_ int, task *jsons.Item) error {
+			templateId, _ := task.Attr("template_id").String()
+			size, ok := aliyunTemplates[templateId]
+			if _, exist := task.Attr("template_height").Int(); exist || !ok {
+				return nil
+			}
+			task.Put("template_width", jsons.NewByVal(size[0]))
+			task.Put("template_height", jsons.NewByVal(size[1]))
+			return nil
+		})
+	}
+	return info, nil
+}
+
+// login 获取未过期的接口调用凭证和空间 id, 过期时使用 refreshToken 刷新
+func (ap *aliyunProvider) login(ctx context.Context) (string, string, error) {
+	ap.mu.Lock()
+	defer ap.mu.Unlock()
+	if strs.AllNotEmpty(ap.accessToken, ap.driveId) && time.Now().Before(ap.expired) {
+		return ap.accessToken, ap.driveId, nil
+	}
+
+	res, err := requestJson(ctx, http.MethodPost, AliyunApi+"/oauth/access_token", nil, map[string]interface{}{
+		"client_id":     ap.cfg.ClientId,
+		"client_secret": ap.cfg.ClientSecret,
+		"grant_type":    "refresh_token",
+		"refresh_token": ap.refreshToken,
+	})
+	if err != nil {
+		return "", "", fmt.Errorf("刷新 access token 失败: %v", err)
+	}
+	accessToken, _ := res.Attr("access_token").String()
+	if strs.AnyEmpty(accessToken) {
+		return "", "", fmt.Errorf("刷新 access token 失败, 响应: %v", res)
+	}
+	if refreshToken, ok := res.Attr("refresh_token").String(); ok && strs.AllNotEmpty(refreshToken) && refreshToken != ap.refreshToken {
+		ap.refreshToken = refreshToken
+		storeAliyunToken(ap.cfg, refreshToken)
+	}
+	expiresIn, ok := res.Attr("expires_in").Int()
+	if !ok || expiresIn <= 0 {
+		expiresIn = 7200
+	}
+
+	header := make(http.Header)
+	header.Set("Authorization", "Bearer "+accessToken)
+	drive, err := requestJson(ctx, http.MethodPost, AliyunApi+"/adrive/v1.0/user/getDriveInfo", header, map[string]interface{}{})
+	if err != nil {
+		return "", "", fmt.Errorf("获取空间信息失败: %v", err)
+	}
+	driveId, _ := drive.Attr(ap.cfg.Drive + "_drive_id").String()
+	if strs.AnyEmpty(driveId) {
+		return "", "", fmt.Errorf("获取不到 %s 空间, 响应: %v", ap.cfg.Drive, drive)
+	}
+
+	// 提前 5 分钟过期, 避免请求过程中失效
+	ap.accessToken, ap.driveId = accessToken, driveId
+	ap.expired = time.Now().Add(time.Duration(expiresIn)*time.Second - time.Minute*5)
+	return ap.accessToken, ap.driveId, nil
+}
+
+// aliyunTokenKey 计算配置在持久化文件中的 key, 配置文件中的 refresh token 变化之后不再使用旧的记录
+func aliyunTokenKey(cfg *config.PreviewProvider) string {
+	return cfg.Prefix + "|" + encrypts.Md5Hash(cfg.RefreshToken)
+}
+
+// loadAliyunToken 读取配置对应的最新 refresh token, 没有记录时使用配置文件中的值
+func loadAliyunToken(cfg *config.PreviewProvider) string {
+	aliyunTokensMu.Lock()
+	defer aliyunTokensMu.Unlock()
+	tokens := readAliyunTokens()
+	if token, ok := tokens[aliyunTokenKey(cfg)]; ok && strs.AllNotEmpty(token) {
+		return token
+	}
+	return cfg.RefreshToken
+}
+
+// storeAliyunToken 持久化刷新之后的 refresh token, 重启之后继续使用
+func storeAliyunToken(cfg *config.PreviewProvider, token string) {
+	aliyunTokensMu.Lock()
+	defer aliyunTokensMu.Unlock()
+	tokens := readAliyunTokens()
+	tokens[aliyunTokenKey(cfg)] = token
+	bytes, err := json.Marshal(tokens)
+	if err != nil {
+		log.Printf(colors.ToRed("序列化阿里云盘 refresh token 失败: %v"), err)
+		return
+	}
+
+	if err := files.WriteAtomic(filepath.Join(config.BasePath, AliyunTokenFile), bytes, 0600); err != nil {
+		log.Printf(colors.ToRed("写入阿里云盘 refresh token 失败: %v"), err)
+	}
+}
+
+// readAliyunTokens 读取持久化的 refresh token, 文件不存在或损坏时返回空 map
+func readAliyunTokens() map[string]string {
+	tokens := map[string]string{}
+	if bytes, err := os.ReadFile(filepath.Join(config.BasePath, AliyunTokenFile)); err == nil {
+		if err := json.Unmarshal(bytes, &tokens); err != nil {
+			log.Printf(colors.ToYellow("解析阿里云盘 refresh token 文件失败, 使用配置文件中的值: %v"), err)
+		}
+	}
+	return tokens
+}
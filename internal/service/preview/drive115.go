@@ -0,0 +1,177 @@
+//go:build !minimal
+
+package preview
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+var (
+	// Drive115Api 115 网盘文件接口地址
+	Drive115Api = "https://webapi.115.com"
+	// Drive115VideoApi 115 网盘视频接口地址
+	Drive115VideoApi = "https://115.com"
+)
+
+// drive115UserAgent 请求 115 接口使用的 User-Agent, 接口会拒绝非浏览器的请求
+const drive115UserAgent = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 115Browser/27.0.0"
+
+// drive115PageSize 列出目录时每页的文件个数
+const drive115PageSize = 1000
+
+var (
+	// streamInfResolutionRegex 匹配 #EXT-X-STREAM-INF 中的分辨率
+	streamInfResolutionRegex = regexp.MustCompile(`RESOLUTION=(\d+)x(\d+)`)
+	// streamInfNameRegex 匹配 #EXT-X-STREAM-INF 中的清晰度名称
+	streamInfNameRegex = regexp.MustCompile(`NAME="([^"]+)"`)
+)
+
+// drive115Provider 115 网盘的转码预览接口
+type drive115Provider struct {
+	cfg *config.PreviewProvider
+}
+
+// playInfo 通过网盘路径查询文件的 pickcode, 再解析视频的多清晰度播放列表
+func (dp *drive115Provider) playInfo(ctx context.Context, drivePath string) (*jsons.Item, error) {
+	pickcode, err := dp.pickcode(ctx, drivePath)
+	if err != nil {
+		return nil, err
+	}
+
+	masterUrl := fmt.Sprintf("%s/api/video/m3u8/%s.m3u8", Drive115VideoApi, pickcode)
+	resp, err := https.RequestCtx(ctx, http.MethodGet, masterUrl, dp.header(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("请求播放列表失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("请求播放列表失败, 响应码: %d", resp.StatusCode)
+	}
+	tasks, err := parseMasterPlaylist(masterUrl, resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	info := jsons.NewEmptyObj()
+	info.Put("live_transcoding_task_list", tasks)
+	info.Put("live_transcoding_subtitle_task_list", jsons.NewEmptyArr())
+	return info, nil
+}
+
+// pickcode 逐页列出父目录, 查询文件的 pickcode
+func (dp *drive115Provider) pickcode(ctx context.Context, drivePath string) (string, error) {
+	dir, name := path.Split(drivePath)
+	q := url.Values{}
+	q.Set("path", strings.TrimSuffix(dir, "/"))
+	res, err := requestJson(ctx, http.MethodGet, Drive115Api+"/files/getid?"+q.Encode(), dp.header(), nil)
+	if err != nil {
+		return "", fmt.Errorf("查询目录失败: %s, %v", dir, err)
+	}
+	cid := fmt.Sprintf("%v", res.Attr("id").Val())
+	if state, _ := res.Attr("state").Bool(); !state || (cid == "0" && dir != "/") {
+		return "", fmt.Errorf("目录不存在: %s", dir)
+	}
+
+	for offset := 0; ; offset += drive115PageSize {
+		q := url.Values{}
+		q.Set("aid", "1")
+		q.Set("cid", cid)
+		q.Set("offset", strconv.Itoa(offset))
+		q.Set("limit", strconv.Itoa(drive115PageSize))
+		q.Set("show_dir", "0")
+		q.Set("format", "json")
+		res, err := requestJson(ctx, http.MethodGet, Drive115Api+"/files?"+q.Encode(), dp.header(), nil)
+		if err != nil {
+			return "", fmt.Errorf("列出目录失败: %s, %v", dir, err)
+		}
+		files, ok := res.Attr("data").Done()
+		if !ok || files.Type() != jsons.JsonTypeArr || files.Empty() {
+			return "", fmt.Errorf("文件不存在: %s", drivePath)
+		}
+		idx := files.FindIdx(func(file *jsons.Item) bool { return file.Attr("n").Val() == name })
+		if idx != -1 {
+			if pc, _ := files.Idx(idx).Attr("pc").String(); strs.AllNotEmpty(pc) {
+				return pc, nil
+			}
+			return "", fmt.Errorf("获取不到文件的 pickcode: %s", drivePath)
+		}
+		if files.Len() < drive115PageSize {
+			return "", fmt.Errorf("文件不存在: %s", drivePath)
+		}
+	}
+}
+
+// header 请求 115 接口的请求头
+func (dp *drive115Provider) header() http.Header {
+	header := make(http.Header)
+	header.Set("Cookie", dp.cfg.Cookie)
+	header.Set("User-Agent", drive115UserAgent)
+	return header
+}
+
+// parseMasterPlaylist 解析多清晰度的 master 播放列表, 每个清晰度生成一个转码任务
+//
+// 播放列表中的相对地址基于 masterUrl 转换为绝对地址
+func parseMasterPlaylist(masterUrl string, r io.Reader) (*jsons.Item, error) {
+	base, err := url.Parse(masterUrl)
+	if err != nil {
+		return nil, fmt.Errorf("播放列表地址错误: %v", err)
+	}
+	tasks := jsons.NewEmptyArr()
+	scanner := bufio.NewScanner(r)
+	var streamInf string
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "#EXT-X-STREAM-INF") {
+			streamInf = line
+			continue
+		}
+		if line == "" || strings.HasPrefix(line, "#") || streamInf == "" {
+			continue
+		}
+
+		ref, err := url.Parse(line)
+		if err != nil {
+			streamInf = ""
+			continue
+		}
+		task := jsons.NewEmptyObj()
+		width, height := 0, 0
+		if matches := streamInfResolutionRegex.FindStringSubmatch(streamInf); len(matches) == 3 {
+			width, _ = strconv.Atoi(matches[1])
+			height, _ = strconv.Atoi(matches[2])
+		}
+		templateId := fmt.Sprintf("%dP", height)
+		if matches := streamInfNameRegex.FindStringSubmatch(streamInf); len(matches) == 2 {
+			templateId = matches[1]
+		}
+		task.Put("template_id", jsons.NewByVal(templateId))
+		task.Put("template_width", jsons.NewByVal(width))
+		task.Put("template_height", jsons.NewByVal(height))
+		task.Put("status", jsons.NewByVal("finished"))
+		task.Put("url", jsons.NewByVal(base.ResolveReference(ref).String()))
+		tasks.Append(task)
+		streamInf = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取播放列表失败: %v", err)
+	}
+	if tasks.Empty() {
+		return nil, fmt.Errorf("播放列表中没有可用的清晰度")
+	}
+	return tasks, nil
+}
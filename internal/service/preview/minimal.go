@@ -0,0 +1,14 @@
+//go:build minimal
+
+package preview
+
+import (
+	"context"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+)
+
+// PlayInfo 精简构建不包含网盘原生转码接口, 始终返回未匹配
+func PlayInfo(ctx context.Context, alistPath string) (info *jsons.Item, matched bool, err error) {
+	return nil, false, nil
+}
@@ -0,0 +1,97 @@
+//go:build !minimal
+
+// 网盘原生的转码预览接口, 直接请求网盘获取比 alist 更多的转码清晰度
+package preview
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+)
+
+// provider 一个网盘的转码预览接口
+type provider interface {
+	// playInfo 获取网盘中文件的转码信息, 格式与 alist "/api/fs/other" 接口响应中的 video_preview_play_info 一致
+	playInfo(ctx context.Context, drivePath string) (*jsons.Item, error)
+}
+
+var (
+	// providers 配置 => 初始化之后的转码接口, 接口内部会缓存登录凭证
+	providers = map[*config.PreviewProvider]provider{}
+	// providersMu 并发控制
+	providersMu sync.Mutex
+)
+
+// PlayInfo 使用匹配 alist 路径的网盘原生接口获取转码信息
+//
+// 没有配置匹配的接口时 matched 返回 false, 调用方应继续请求 alist
+func PlayInfo(ctx context.Context, alistPath string) (info *jsons.Item, matched bool, err error) {
+	if config.C == nil || config.C.VideoPreview == nil {
+		return nil, false, nil
+	}
+	for _, cfg := range config.C.VideoPreview.Providers {
+		drivePath, ok := cfg.DrivePath(alistPath)
+		if !ok {
+			continue
+		}
+		info, err = providerOf(cfg).playInfo(ctx, drivePath)
+		if err != nil {
+			return nil, true, fmt.Errorf("%s: %v", cfg.Type, err)
+		}
+		return info, true, nil
+	}
+	return nil, false, nil
+}
+
+// providerOf 获取配置对应的转码接口, 不存在时初始化
+func providerOf(cfg *config.PreviewProvider) provider {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	if p, ok := providers[cfg]; ok {
+		return p
+	}
+	var p provider
+	switch cfg.Type {
+	case config.PreviewProviderAliyun:
+		p = &aliyunProvider{cfg: cfg, refreshToken: loadAliyunToken(cfg)}
+	default:
+		p = &drive115Provider{cfg: cfg}
+	}
+	providers[cfg] = p
+	return p
+}
+
+// requestJson 发送请求并将响应体解析为 json, 响应码不是 200 时返回错误
+func requestJson(ctx context.Context, method, u string, header http.Header, body map[string]interface{}) (*jsons.Item, error) {
+	if header == nil {
+		header = make(http.Header)
+	}
+	var reqBody io.ReadCloser
+	if body != nil {
+		header.Set("Content-Type", "application/json;charset=utf-8")
+		reqBody = https.MapBody(body)
+	}
+	resp, err := https.RequestCtx(ctx, method, u, header, reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("请求发送失败: %v", err)
+	}
+	defer resp.Body.Close()
+	bodyBytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("读取响应体失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("响应码: %d, 响应: %s", resp.StatusCode, string(bodyBytes))
+	}
+	res, err := jsons.New(string(bodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("解析响应体失败: %v", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,190 @@
+// schema 包对关键的上游响应 (emby PlaybackInfo, alist fs/get) 进行轻量的结构校验,
+// 在上游升级导致字段缺失或改名时, 返回清晰的错误信息, 并聚合一段时间内的异常统一告警
+package schema
+
+import (
+	"fmt"
+	"log"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/notify"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+)
+
+// alertWindow 聚合告警的时间窗口, 窗口内出现的所有结构异常合并为一次告警
+const alertWindow = time.Minute
+
+// Type 字段的值类型
+type Type string
+
+const (
+	TypeObj    Type = "object"
+	TypeArr    Type = "array"
+	TypeString Type = "string"
+	TypeNumber Type = "number"
+	TypeBool   Type = "bool"
+)
+
+// Field 必须存在的字段
+type Field struct {
+	// Path 字段路径, 使用 . 分隔, 以 [] 结尾的片段表示校验数组中的每个元素, 如: MediaSources[].Id
+	Path string
+	// Type 字段的值类型
+	Type Type
+}
+
+// Schema 响应结构
+type Schema struct {
+	// Name 接口名称, 用于输出日志和告警
+	Name string
+	// Fields 必须存在的字段
+	Fields []Field
+}
+
+var (
+	// PlaybackInfo emby PlaybackInfo 接口的响应结构
+	PlaybackInfo = &Schema{Name: "emby PlaybackInfo", Fields: []Field{
+		{Path: "MediaSources", Type: TypeArr},
+		{Path: "MediaSources[].Id", Type: TypeString},
+		{Path: "MediaSources[].Protocol", Type: TypeString},
+	}}
+
+	// AlistFsGet alist fs/get 接口的响应结构
+	AlistFsGet = &Schema{Name: "alist fs/get", Fields: []Field{
+		{Path: "name", Type: TypeString},
+		{Path: "size", Type: TypeNumber},
+		{Path: "raw_url", Type: TypeString},
+	}}
+)
+
+var (
+	// pending 当前窗口内的结构异常 => 出现次数
+	pending = map[string]int{}
+	// pendingMu 并发控制
+	pendingMu sync.Mutex
+)
+
+// Check 校验响应结构, 不符合时记录异常并返回描述异常的错误
+func Check(s *Schema, data *jsons.Item) error {
+	problems := s.Validate(data)
+	if len(problems) == 0 {
+		return nil
+	}
+	record(s.Name, problems)
+	return fmt.Errorf("%s 响应结构异常, 上游版本可能不兼容: %s", s.Name, strings.Join(problems, "; "))
+}
+
+// Validate 校验响应结构, 返回所有不符合的字段描述
+func (s *Schema) Validate(data *jsons.Item) []string {
+	if data == nil || data.Type() != jsons.JsonTypeObj {
+		return []string{"响应体不是 json 对象"}
+	}
+	problems := make([]string, 0)
+	for _, field := range s.Fields {
+		// 父级字段异常时, 其下的每个字段都会得到相同的描述, 只保留一个
+		if problem := checkField(data, strings.Split(field.Path, "."), "", field); problem != "" && !slices.Contains(problems, problem) {
+			problems = append(problems, problem)
+		}
+	}
+	return problems
+}
+
+// checkField 沿着路径逐层校验字段, 数组片段会校验每个元素, 返回第一个异常描述
+//
+// prefix 为已经校验过的路径, 用于在描述中定位出现异常的字段
+func checkField(item *jsons.Item, segments []string, prefix string, field Field) string {
+	name, each := strings.CutSuffix(segments[0], "[]")
+	if prefix != "" {
+		prefix += "."
+	}
+	prefix += name
+	child, ok := item.Attr(name).Done()
+	if !ok {
+		return prefix + " 字段缺失"
+	}
+
+	if !each {
+		if len(segments) == 1 {
+			if actual := typeOf(child); actual != field.Type {
+				return fmt.Sprintf("%s 类型变化: %s => %s", prefix, field.Type, actual)
+			}
+			return ""
+		}
+		if child.Type() != jsons.JsonTypeObj {
+			return fmt.Sprintf("%s 类型变化: %s => %s", prefix, TypeObj, typeOf(child))
+		}
+		return checkField(child, segments[1:], prefix, field)
+	}
+
+	if child.Type() != jsons.JsonTypeArr {
+		return fmt.Sprintf("%s 类型变化: %s => %s", prefix, TypeArr, typeOf(child))
+	}
+	prefix += "[]"
+	problem := ""
+	child.RangeArr(func(_ int, elem *jsons.Item) error {
+		if elem.Type() != jsons.JsonTypeObj {
+			problem = fmt.Sprintf("%s 类型变化: %s => %s", prefix, TypeObj, typeOf(elem))
+			return jsons.ErrBreakRange
+		}
+		if problem = checkField(elem, segments[1:], prefix, field); problem != "" {
+			return jsons.ErrBreakRange
+		}
+		return nil
+	})
+	return problem
+}
+
+// typeOf 获取 json 值的类型
+func typeOf(item *jsons.Item) Type {
+	switch item.Type() {
+	case jsons.JsonTypeObj:
+		return TypeObj
+	case jsons.JsonTypeArr:
+		return TypeArr
+	}
+	switch item.Ti().Val().(type) {
+	case string:
+		return TypeString
+	case int, int64, float64:
+		return TypeNumber
+	case bool:
+		return TypeBool
+	}
+	return "null"
+}
+
+// record 记录结构异常, 窗口内的第一个异常负责在窗口结束时输出聚合告警
+func record(name string, problems []string) {
+	pendingMu.Lock()
+	defer pendingMu.Unlock()
+	if len(pending) == 0 {
+		time.AfterFunc(alertWindow, flush)
+	}
+	for _, problem := range problems {
+		pending[name+": "+problem]++
+	}
+}
+
+// flush 输出窗口内聚合的结构异常, 并推送告警
+func flush() {
+	pendingMu.Lock()
+	lines := make([]string, 0, len(pending))
+	for problem, count := range pending {
+		lines = append(lines, fmt.Sprintf("%s (%d 次)", problem, count))
+	}
+	pending = map[string]int{}
+	pendingMu.Unlock()
+	if len(lines) == 0 {
+		return
+	}
+
+	sort.Strings(lines)
+	text := fmt.Sprintf("最近 %v 内上游响应结构异常, 上游版本可能不兼容:\n  %s", alertWindow, strings.Join(lines, "\n  "))
+	log.Println(colors.ToRed(text))
+	notify.Alert(notify.KindSchema, text)
+}
@@ -0,0 +1,32 @@
+package schema_test
+
+import (
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/schema"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+)
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		raw  string
+		want int
+	}{
+		{`{"MediaSources":[{"Id":"1","Protocol":"File"}],"PlaySessionId":"x"}`, 0},
+		{`{"MediaSources":[]}`, 0},
+		{`{"Items":[]}`, 1},
+		{`{"MediaSources":{}}`, 1},
+		{`{"MediaSources":[{"Id":"1","Protocol":"File"},{"ID":"2","Protocol":"File"}]}`, 1},
+		{`{"MediaSources":[{"Id":1}]}`, 2},
+		{`[]`, 1},
+	}
+	for _, c := range cases {
+		data, err := jsons.New(c.raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if problems := schema.PlaybackInfo.Validate(data); len(problems) != c.want {
+			t.Errorf("Validate(%s) = %v, want %d problems", c.raw, problems, c.want)
+		}
+	}
+}
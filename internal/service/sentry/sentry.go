@@ -0,0 +1,113 @@
+// 异常上报功能, 将 panic 以及非预期的上游异常上报到 sentry
+//
+// 直接调用 sentry 的 store 接口, 不依赖官方 sdk
+package sentry
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"runtime"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/randoms"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/redact"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	LevelError = "error" // 非预期的异常
+	LevelFatal = "fatal" // 程序 panic
+)
+
+// ClientName 上报时使用的客户端标识
+const ClientName = "go-emby2alist/" + constant.CurrentVersion
+
+// CaptureError 上报一个非预期的异常
+//
+// c 为空时, 上报的事件不附带请求上下文
+func CaptureError(c *gin.Context, err error) {
+	if err == nil || !enabled() {
+		return
+	}
+	event := newEvent(c, LevelError, "error", err.Error())
+	go send(event)
+}
+
+// CapturePanic 上报一个 panic, stack 为 panic 发生时的调用栈
+func CapturePanic(c *gin.Context, recovered any, stack []byte) {
+	if !enabled() {
+		return
+	}
+	event := newEvent(c, LevelFatal, "panic", fmt.Sprintf("%v", recovered))
+	event["extra"] = map[string]interface{}{"stack": redact.String(string(stack))}
+	go send(event)
+}
+
+// enabled 判断异常上报功能是否启用
+func enabled() bool {
+	return config.C != nil && config.C.Sentry != nil && config.C.Sentry.Enable
+}
+
+// newEvent 构造 sentry 事件
+func newEvent(c *gin.Context, level, errType, msg string) map[string]interface{} {
+	hostname, _ := os.Hostname()
+	event := map[string]interface{}{
+		"event_id":    randoms.RandomHex(32),
+		"timestamp":   time.Now().UTC().Format(time.RFC3339),
+		"level":       level,
+		"platform":    "go",
+		"logger":      "go-emby2alist",
+		"server_name": hostname,
+		"release":     constant.CurrentVersion,
+		"environment": config.C.Sentry.Environment,
+		"exception": map[string]interface{}{
+			"values": []map[string]interface{}{{"type": errType, "value": redact.String(msg)}},
+		},
+		"contexts": map[string]interface{}{
+			"runtime": map[string]interface{}{"name": "go", "version": runtime.Version()},
+		},
+	}
+
+	if c != nil && c.Request != nil {
+		headers := map[string]string{}
+		reqHeader := redact.Header(c.Request.Header)
+		for key := range reqHeader {
+			headers[key] = reqHeader.Get(key)
+		}
+		event["request"] = map[string]interface{}{
+			"method":  c.Request.Method,
+			"url":     redact.String(https.ClientRequestUrl(c)),
+			"headers": headers,
+		}
+		event["transaction"] = c.Request.URL.Path
+	}
+	return event
+}
+
+// send 推送事件到 sentry
+func send(event map[string]interface{}) {
+	cfg := config.C.Sentry
+	header := make(http.Header)
+	header.Set("Content-Type", "application/json;charset=utf-8")
+	header.Set("X-Sentry-Auth", fmt.Sprintf(
+		"Sentry sentry_version=7, sentry_client=%s, sentry_key=%s",
+		ClientName, cfg.PublicKey(),
+	))
+
+	resp, err := https.Request(http.MethodPost, cfg.StoreUrl(), header, https.MapBody(event))
+	if err != nil {
+		log.Printf(colors.ToRed("sentry 上报失败: %v"), err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		log.Printf(colors.ToRed("sentry 上报失败, 响应码: %d"), resp.StatusCode)
+	}
+}
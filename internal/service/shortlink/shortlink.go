@@ -0,0 +1,77 @@
+package shortlink
+
+import (
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/encrypts"
+)
+
+const (
+	// PathPrefix 短链接的路径前缀
+	PathPrefix = "/s/"
+
+	// tokenLen 短链接 token 的长度
+	tokenLen = 12
+
+	// cleanInterval 清理过期短链接的间隔
+	cleanInterval = time.Minute * 10
+)
+
+// link 短链接指向的地址
+type link struct {
+	target  string // 请求地址 (路径 + query)
+	expired int64  // 过期时间戳 (UnixMilli)
+}
+
+var (
+	// links token => 短链接
+	links = map[string]*link{}
+	// linksMu 并发控制
+	linksMu sync.RWMutex
+	// cleanerOnce 首次生成短链接时启动清理任务
+	cleanerOnce sync.Once
+)
+
+// Shorten 为请求地址 (路径 + query) 生成短链接路径, 同一个地址生成的短链接保持不变, 并刷新有效期
+func Shorten(target string, ttl time.Duration) string {
+	cleanerOnce.Do(func() { go loopClean() })
+
+	token := encrypts.Md5Hash(target)[:tokenLen]
+	expired := time.Now().Add(ttl).UnixMilli()
+	linksMu.Lock()
+	if l, ok := links[token]; ok && l.target == target {
+		l.expired = max(l.expired, expired)
+	} else {
+		links[token] = &link{target: target, expired: expired}
+	}
+	linksMu.Unlock()
+	return PathPrefix + token
+}
+
+// Expand 获取短链接 token 指向的请求地址, 短链接不存在或已过期时返回 false
+func Expand(token string) (string, bool) {
+	linksMu.RLock()
+	defer linksMu.RUnlock()
+	l, ok := links[token]
+	if !ok || time.Now().UnixMilli() > l.expired {
+		return "", false
+	}
+	return l.target, true
+}
+
+// loopClean 定期清理过期的短链接
+func loopClean() {
+	ticker := time.NewTicker(cleanInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		now := time.Now().UnixMilli()
+		linksMu.Lock()
+		for token, l := range links {
+			if now > l.expired {
+				delete(links, token)
+			}
+		}
+		linksMu.Unlock()
+	}
+}
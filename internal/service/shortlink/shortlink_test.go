@@ -0,0 +1,33 @@
+package shortlink
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestShorten(t *testing.T) {
+	target := "/videos/1/stream?MediaSourceId=abc&api_key=xxx&Static=true"
+	short := Shorten(target, time.Minute)
+	if !strings.HasPrefix(short, PathPrefix) || len(short) != len(PathPrefix)+tokenLen {
+		t.Fatalf("短链接格式错误: %s", short)
+	}
+	if again := Shorten(target, time.Minute); again != short {
+		t.Fatalf("同一个地址生成了不同的短链接: %s, %s", short, again)
+	}
+
+	got, ok := Expand(strings.TrimPrefix(short, PathPrefix))
+	if !ok || got != target {
+		t.Fatalf("还原短链接失败, 期望: %s, 实际: %s", target, got)
+	}
+	if _, ok := Expand("000000000000"); ok {
+		t.Fatal("不存在的短链接被还原")
+	}
+}
+
+func TestExpandExpired(t *testing.T) {
+	short := Shorten("/videos/2/stream", -time.Second)
+	if _, ok := Expand(strings.TrimPrefix(short, PathPrefix)); ok {
+		t.Fatal("过期的短链接被还原")
+	}
+}
@@ -0,0 +1,176 @@
+// 播放统计, 记录代理实际分流了多少流量, 以及从各个上游读取的流量归属
+package stats
+
+import (
+	"log"
+	"maps"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/store"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+)
+
+// storeKey 统计数据在存储中的 key
+const storeKey = "current"
+
+// Play 一次播放记录
+type Play struct {
+	ItemId     string // 播放的 item id
+	User       string // 播放的用户标识
+	Provider   string // 提供播放的方式, 如: alist-raw, origin, strm
+	Bytes      int64  // 传输的字节数
+	Redirected bool   // 是否通过重定向播放, false 表示流量经过本程序
+}
+
+// Stats 播放统计数据
+type Stats struct {
+	Since           string           // 开始统计的时间
+	Plays           int64            // 总播放次数
+	BytesRedirected int64            // 通过重定向分流的字节数
+	BytesProxied    int64            // 经过本程序代理的字节数
+	Providers       map[string]int64 // 播放方式 => 次数
+	Users           map[string]int64 // 用户 => 次数
+	Items           map[string]int64 // item id => 次数
+	UpstreamBytes   map[string]int64 // 上游主机 => 读取的字节数
+	UserBytes       map[string]int64 // 用户 => 从上游读取的字节数
+	ItemBytes       map[string]int64 // item id => 从上游读取的字节数
+}
+
+var (
+	// current 当前的统计数据
+	current *Stats
+	// dirty 统计数据是否有未写入磁盘的修改
+	dirty bool
+	// mu 并发控制
+	mu sync.Mutex
+	// loadOnce 首次使用时从磁盘中加载统计数据
+	loadOnce sync.Once
+)
+
+// RecordPlay 记录一次播放
+func RecordPlay(p Play) {
+	load()
+	mu.Lock()
+	defer mu.Unlock()
+	current.Plays++
+	if p.Redirected {
+		current.BytesRedirected += p.Bytes
+	} else {
+		current.BytesProxied += p.Bytes
+	}
+	current.Providers[p.Provider]++
+	if p.User != "" {
+		current.Users[p.User]++
+	}
+	if p.ItemId != "" {
+		current.Items[p.ItemId]++
+	}
+	dirty = true
+}
+
+// RecordTraffic 记录一次从上游读取的流量, user 和 itemId 为空时只计入上游主机
+func RecordTraffic(host, user, itemId string, bytes int64) {
+	if bytes <= 0 {
+		return
+	}
+	load()
+	mu.Lock()
+	defer mu.Unlock()
+	current.UpstreamBytes[host] += bytes
+	if user != "" {
+		current.UserBytes[user] += bytes
+	}
+	if itemId != "" {
+		current.ItemBytes[itemId] += bytes
+	}
+	dirty = true
+}
+
+// Snapshot 获取统计数据快照
+func Snapshot() Stats {
+	load()
+	mu.Lock()
+	defer mu.Unlock()
+	res := *current
+	res.Providers = maps.Clone(current.Providers)
+	res.Users = maps.Clone(current.Users)
+	res.Items = maps.Clone(current.Items)
+	res.UpstreamBytes = maps.Clone(current.UpstreamBytes)
+	res.UserBytes = maps.Clone(current.UserBytes)
+	res.ItemBytes = maps.Clone(current.ItemBytes)
+	return res
+}
+
+// Reset 清空统计数据, 并立即写入磁盘
+func Reset() {
+	load()
+	mu.Lock()
+	current = newStats()
+	dirty = true
+	mu.Unlock()
+	flush(true)
+}
+
+// newStats 初始化一个空的统计数据
+func newStats() *Stats {
+	return &Stats{
+		Since:         time.Now().Format(time.DateTime),
+		Providers:     map[string]int64{},
+		Users:         map[string]int64{},
+		Items:         map[string]int64{},
+		UpstreamBytes: map[string]int64{},
+		UserBytes:     map[string]int64{},
+		ItemBytes:     map[string]int64{},
+	}
+}
+
+// load 从存储中加载统计数据, 并在存储每次写入磁盘之前保存统计数据
+func load() {
+	loadOnce.Do(func() {
+		current = newStats()
+		var stored Stats
+		if ok, err := store.Default().Get(store.BucketStats, storeKey, &stored); err != nil {
+			log.Printf(colors.ToYellow("解析播放统计失败, 重新开始统计: %v"), err)
+		} else if ok {
+			current = &stored
+			current.Providers = orEmpty(current.Providers)
+			current.Users = orEmpty(current.Users)
+			current.Items = orEmpty(current.Items)
+			current.UpstreamBytes = orEmpty(current.UpstreamBytes)
+			current.UserBytes = orEmpty(current.UserBytes)
+			current.ItemBytes = orEmpty(current.ItemBytes)
+		}
+
+		store.Default().BeforeFlush(func() { flush(false) })
+	})
+}
+
+// flush 将有修改的统计数据保存到存储中, now 为 true 时立即写入磁盘
+func flush(now bool) {
+	mu.Lock()
+	if !dirty {
+		mu.Unlock()
+		return
+	}
+	err := store.Default().Put(store.BucketStats, storeKey, current)
+	dirty = false
+	mu.Unlock()
+	if err != nil {
+		log.Printf(colors.ToRed("保存播放统计失败: %v"), err)
+		return
+	}
+	if !now {
+		return
+	}
+	if err := store.Default().Flush(); err != nil {
+		log.Printf(colors.ToRed("写入播放统计失败: %v"), err)
+	}
+}
+
+func orEmpty(m map[string]int64) map[string]int64 {
+	if m == nil {
+		return map[string]int64{}
+	}
+	return m
+}
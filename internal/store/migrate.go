@@ -0,0 +1,93 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+)
+
+// migration 一次存储结构的版本迁移
+type migration struct {
+	version int
+	name    string
+	// up 执行迁移, dir 为持久化文件所在的目录
+	up func(data *fileData, dir string) error
+}
+
+// migrations 所有的迁移, 按照版本号递增排列, 已发布的迁移不能修改
+var migrations = []migration{
+	{version: 1, name: "导入旧版播放统计文件 stats.json", up: importLegacyStats},
+	{version: 2, name: "导入旧版上报重放队列文件 report-queue.json", up: importLegacyFile("report-queue.json", BucketReportQueue, "queue")},
+	{version: 3, name: "导入旧版功能开关文件 features.json", up: importLegacyFile("features.json", BucketFeatures, "state")},
+	{version: 4, name: "导入旧版路径映射缓存文件 pathmap.json", up: importLegacyFile("pathmap.json", BucketPathCache, "entries")},
+}
+
+// migrate 按顺序执行版本号大于当前版本的迁移, 有迁移执行时立即写入磁盘
+func (s *Store) migrate() error {
+	dir := filepath.Dir(s.path)
+	migrated := false
+	for _, m := range migrations {
+		if m.version <= s.data.Version {
+			continue
+		}
+		if err := m.up(s.data, dir); err != nil {
+			return fmt.Errorf("执行存储迁移 [%d: %s] 失败: %v", m.version, m.name, err)
+		}
+		s.data.Version = m.version
+		migrated = true
+		log.Printf(colors.ToGreen("存储迁移完成 [%d: %s]"), m.version, m.name)
+	}
+	if !migrated {
+		return nil
+	}
+	s.dirty = true
+	return s.Flush()
+}
+
+// importLegacyStats 将旧版独立保存的播放统计导入 stats bucket, 原文件保留不再使用
+func importLegacyStats(data *fileData, dir string) error {
+	fp := filepath.Join(dir, "stats.json")
+	bytes, err := os.ReadFile(fp)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if !json.Valid(bytes) {
+		log.Printf(colors.ToYellow("旧版播放统计文件已损坏, 跳过导入: %s"), fp)
+		return nil
+	}
+	if data.Buckets[BucketStats] == nil {
+		data.Buckets[BucketStats] = map[string]json.RawMessage{}
+	}
+	data.Buckets[BucketStats]["current"] = bytes
+	return nil
+}
+
+// importLegacyFile 将旧版独立保存的 json 文件整体导入 bucket 的 key 中, 原文件保留不再使用
+func importLegacyFile(name, bucket, key string) func(data *fileData, dir string) error {
+	return func(data *fileData, dir string) error {
+		fp := filepath.Join(dir, name)
+		bytes, err := os.ReadFile(fp)
+		if os.IsNotExist(err) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !json.Valid(bytes) {
+			log.Printf(colors.ToYellow("旧版文件已损坏, 跳过导入: %s"), fp)
+			return nil
+		}
+		if data.Buckets[bucket] == nil {
+			data.Buckets[bucket] = map[string]json.RawMessage{}
+		}
+		data.Buckets[bucket][key] = bytes
+		return nil
+	}
+}
@@ -0,0 +1,247 @@
+// 内嵌的持久化存储, 为用户偏好, 播放统计等需要长期保存的数据提供统一的读写和版本迁移
+//
+// 数据按照 bucket => key => json 值组织, 整体保存在配置文件所在目录下的一个文件中,
+// 修改之后定时写入磁盘
+//
+// 没有使用 bbolt, SQLite 等嵌入式数据库: 需要保存的数据量很小 (通常不超过几千条记录),
+// 引入 SQLite 需要 cgo, 会破坏多平台的静态交叉编译, bbolt 则只为这点数据引入额外的依赖;
+// 单个 json 文件也便于用户直接查看和备份. 代价是每次写入都重写整个文件,
+// 数据量明显增长时 (如单个 bucket 超过数万条) 需要重新评估换用 bbolt
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/files"
+)
+
+const (
+	// StoreFile 存储的持久化文件名称, 存放在配置文件所在目录下
+	StoreFile = "store.json"
+
+	// FlushInterval 修改写入磁盘的间隔
+	FlushInterval = time.Second * 30
+)
+
+const (
+	BucketStats         = "stats"          // 播放统计
+	BucketSourceChoices = "source-choices" // 用户在剧集中选择的资源
+	BucketWatchedSync   = "watched-sync"   // 网盘播放记录来源的同步进度
+	BucketPathOverrides = "path-overrides" // 手动指定的 item 路径
+	BucketSeriesPins    = "series-pins"    // 剧集固定使用的转码清晰度
+	BucketReportQueue   = "report-queue"   // 等待重放的播放状态上报
+	BucketFeatures      = "features"       // 运行时切换的功能开关
+	BucketPathCache     = "path-cache"     // emby 路径在 alist 中请求成功的路径
+)
+
+// ErrCorrupted 持久化文件的内容无法解析
+var ErrCorrupted = errors.New("存储文件已损坏")
+
+// fileData 持久化文件的结构
+type fileData struct {
+	Version int                                   // 已执行的迁移版本
+	Buckets map[string]map[string]json.RawMessage // bucket => key => 值
+}
+
+// Store 一个持久化存储
+type Store struct {
+	path  string // 持久化文件路径, 为空时只保存在内存中
+	data  *fileData
+	dirty bool // 是否有未写入磁盘的修改
+	mu    sync.Mutex
+	// writeMu 写入磁盘的并发控制, 定时写入, 重启前写入和压缩可能同时发生,
+	// 需要保证临时文件的写入和重命名不交错, 且较早的快照不会覆盖较新的快照
+	writeMu sync.Mutex
+	// beforeFlush 每次写入磁盘之前执行的函数, 用于将各模块在内存中缓冲的数据先保存到存储中
+	beforeFlush []func()
+	// hooksMu beforeFlush 的并发控制
+	hooksMu sync.Mutex
+}
+
+var (
+	// defaultStore 程序使用的存储, 首次使用时打开
+	defaultStore *Store
+	// defaultOnce 并发控制
+	defaultOnce sync.Once
+)
+
+// Default 获取程序使用的存储, 首次调用时打开并启动定时写入任务
+//
+// 持久化文件内容损坏时重命名为 .broken 备份, 使用空的存储继续运行;
+// 其他原因 (如没有读取权限) 打开失败时不改动原文件, 只在内存中保存数据
+func Default() *Store {
+	defaultOnce.Do(func() {
+		fp := filepath.Join(config.BasePath, StoreFile)
+		s, err := Open(fp)
+		if errors.Is(err, ErrCorrupted) {
+			log.Printf(colors.ToRed("打开存储失败, 原文件备份为 %s.broken: %v"), StoreFile, err)
+			os.Rename(fp, fp+".broken")
+			s, err = Open(fp)
+		}
+		if err != nil {
+			log.Printf(colors.ToRed("打开存储失败, 数据不会被持久化: %v"), err)
+			s = &Store{data: &fileData{Buckets: map[string]map[string]json.RawMessage{}}}
+		}
+		defaultStore = s
+
+		go func() {
+			ticker := time.NewTicker(FlushInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if err := s.Flush(); err != nil {
+					log.Printf(colors.ToRed("写入存储失败: %v"), err)
+				}
+			}
+		}()
+	})
+	return defaultStore
+}
+
+// Open 打开指定路径的存储, 文件不存在时创建空的存储, 并执行未完成的迁移
+func Open(path string) (*Store, error) {
+	s := &Store{path: path, data: &fileData{}}
+	bytes, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("读取存储文件失败: %v", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(bytes, s.data); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrCorrupted, err)
+		}
+	}
+	if s.data.Buckets == nil {
+		s.data.Buckets = map[string]map[string]json.RawMessage{}
+	}
+
+	if err := s.migrate(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Get 读取 bucket 中 key 对应的值, 解析到 v 中, 值不存在时返回 false
+func (s *Store) Get(bucket, key string, v any) (bool, error) {
+	s.mu.Lock()
+	raw, ok := s.data.Buckets[bucket][key]
+	s.mu.Unlock()
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(raw, v); err != nil {
+		return true, fmt.Errorf("解析存储的值失败, bucket: %s, key: %s, err: %v", bucket, key, err)
+	}
+	return true, nil
+}
+
+// Put 保存 bucket 中 key 对应的值, 在下一次定时任务时写入磁盘
+func (s *Store) Put(bucket, key string, v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("序列化存储的值失败, bucket: %s, key: %s, err: %v", bucket, key, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Buckets[bucket] == nil {
+		s.data.Buckets[bucket] = map[string]json.RawMessage{}
+	}
+	s.data.Buckets[bucket][key] = raw
+	s.dirty = true
+	return nil
+}
+
+// Delete 删除 bucket 中 key 对应的值
+func (s *Store) Delete(bucket, key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.data.Buckets[bucket][key]; ok {
+		delete(s.data.Buckets[bucket], key)
+		s.dirty = true
+	}
+}
+
+// Keys 获取 bucket 中所有的 key, 按字典序排列
+func (s *Store) Keys(bucket string) []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.data.Buckets[bucket]))
+	for key := range s.data.Buckets[bucket] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// BeforeFlush 注册每次写入磁盘之前执行的函数
+//
+// 在内存中缓冲修改的模块通过它在写入之前将数据保存到存储中, 避免数据经过两次定时缓冲,
+// 退出和重启前写入存储时也会一并保存
+func (s *Store) BeforeFlush(fn func()) {
+	s.hooksMu.Lock()
+	defer s.hooksMu.Unlock()
+	s.beforeFlush = append(s.beforeFlush, fn)
+}
+
+// Flush 将未写入磁盘的修改立即写入
+func (s *Store) Flush() error {
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+
+	s.hooksMu.Lock()
+	hooks := append([]func(){}, s.beforeFlush...)
+	s.hooksMu.Unlock()
+	for _, fn := range hooks {
+		fn()
+	}
+
+	if s.path == "" {
+		return nil
+	}
+
+	s.mu.Lock()
+	if !s.dirty {
+		s.mu.Unlock()
+		return nil
+	}
+	bytes, err := json.Marshal(s.data)
+	s.dirty = false
+	s.mu.Unlock()
+	if err != nil {
+		return fmt.Errorf("序列化存储失败: %v", err)
+	}
+
+	if err := files.WriteAtomic(s.path, bytes, 0644); err != nil {
+		s.markDirty()
+		return fmt.Errorf("写入存储失败: %v", err)
+	}
+	return nil
+}
+
+// Compact 移除空的 bucket 并立即重写持久化文件
+func (s *Store) Compact() error {
+	s.mu.Lock()
+	for name, bucket := range s.data.Buckets {
+		if len(bucket) == 0 {
+			delete(s.data.Buckets, name)
+		}
+	}
+	s.dirty = true
+	s.mu.Unlock()
+	return s.Flush()
+}
+
+// markDirty 写入失败时重新标记为有修改, 等待下一次写入
+func (s *Store) markDirty() {
+	s.mu.Lock()
+	s.dirty = true
+	s.mu.Unlock()
+}
@@ -0,0 +1,189 @@
+package store_test
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/store"
+)
+
+func TestPersist(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), store.StoreFile)
+	s, err := store.Open(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("test", "b", map[string]int{"times": 2}); err != nil {
+		t.Fatal(err)
+	}
+	s.Put("test", "a", "value")
+	s.Put("test", "c", "value")
+	s.Delete("test", "c")
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = store.Open(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := s.Keys("test"); len(keys) != 2 || keys[0] != "a" || keys[1] != "b" {
+		t.Fatalf("存储的 key 不正确: %v", keys)
+	}
+	var v map[string]int
+	if ok, err := s.Get("test", "b", &v); !ok || err != nil || v["times"] != 2 {
+		t.Fatalf("读取存储的值失败: %v, %v, %v", ok, err, v)
+	}
+	if ok, _ := s.Get("test", "c", &v); ok {
+		t.Fatal("删除的值不应该存在")
+	}
+}
+
+func TestMigrateLegacyStats(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "stats.json"), []byte(`{"Plays":3}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	s, err := store.Open(filepath.Join(dir, store.StoreFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var stats struct{ Plays int64 }
+	if ok, err := s.Get(store.BucketStats, "current", &stats); !ok || err != nil || stats.Plays != 3 {
+		t.Fatalf("旧版播放统计没有被导入: %v, %v, %v", ok, err, stats)
+	}
+
+	// 迁移完成之后不再重复导入
+	os.WriteFile(filepath.Join(dir, "stats.json"), []byte(`{"Plays":5}`), 0644)
+	s, _ = store.Open(filepath.Join(dir, store.StoreFile))
+	s.Get(store.BucketStats, "current", &stats)
+	if stats.Plays != 3 {
+		t.Fatalf("迁移被重复执行: %v", stats)
+	}
+}
+
+func TestMigrateLegacyFiles(t *testing.T) {
+	dir := t.TempDir()
+	legacy := map[string]string{
+		"report-queue.json": `[{"Uri":"/emby/Sessions/Playing"}]`,
+		"features.json":     `{"playbackinfo":false}`,
+		"pathmap.json":      `[{"EmbyPath":"/a.mp4","AlistPath":"/b.mp4"}]`,
+	}
+	for name, content := range legacy {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := store.Open(filepath.Join(dir, store.StoreFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var queue []struct{ Uri string }
+	if ok, _ := s.Get(store.BucketReportQueue, "queue", &queue); !ok || len(queue) != 1 {
+		t.Fatalf("旧版上报重放队列没有被导入: %v, %v", ok, queue)
+	}
+	var features map[string]bool
+	if ok, _ := s.Get(store.BucketFeatures, "state", &features); !ok || features["playbackinfo"] {
+		t.Fatalf("旧版功能开关没有被导入: %v, %v", ok, features)
+	}
+	var entries []struct{ AlistPath string }
+	if ok, _ := s.Get(store.BucketPathCache, "entries", &entries); !ok || len(entries) != 1 || entries[0].AlistPath != "/b.mp4" {
+		t.Fatalf("旧版路径映射缓存没有被导入: %v, %v", ok, entries)
+	}
+}
+
+func TestCompact(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), store.StoreFile)
+	s, _ := store.Open(fp)
+	s.Put("empty", "a", "value")
+	s.Delete("empty", "a")
+	s.Put("test", "a", "value")
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+
+	bytes, err := os.ReadFile(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(bytes), `"empty"`) {
+		t.Fatalf("空的 bucket 应该被移除: %s", bytes)
+	}
+	if !strings.Contains(string(bytes), `"test"`) {
+		t.Fatalf("非空的 bucket 不应该被移除: %s", bytes)
+	}
+}
+
+func TestConcurrentFlush(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), store.StoreFile)
+	s, err := store.Open(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s.Put("test", strconv.Itoa(i), strings.Repeat("v", 4096))
+			if i%2 == 0 {
+				s.Compact()
+			} else if err := s.Flush(); err != nil {
+				t.Error(err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	s, err = store.Open(fp)
+	if err != nil {
+		t.Fatalf("并发写入之后存储文件损坏: %v", err)
+	}
+	if keys := s.Keys("test"); len(keys) != 20 {
+		t.Fatalf("并发写入之后存储的 key 个数不正确: %d", len(keys))
+	}
+}
+
+func TestOpenCorrupted(t *testing.T) {
+	dir := t.TempDir()
+	fp := filepath.Join(dir, store.StoreFile)
+	if err := os.WriteFile(fp, []byte(`{"Version":`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open(fp); !errors.Is(err, store.ErrCorrupted) {
+		t.Fatalf("内容损坏时应该返回 ErrCorrupted: %v", err)
+	}
+
+	// 路径是目录时读取失败, 不属于内容损坏
+	if _, err := store.Open(dir); err == nil || errors.Is(err, store.ErrCorrupted) {
+		t.Fatalf("读取失败时不应该返回 ErrCorrupted: %v", err)
+	}
+}
+
+func TestBeforeFlush(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), store.StoreFile)
+	s, err := store.Open(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.BeforeFlush(func() { s.Put("test", "a", "buffered") })
+	if err := s.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := store.Open(fp)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var v string
+	if ok, _ := reopened.Get("test", "a", &v); !ok || v != "buffered" {
+		t.Fatalf("写入之前缓冲的数据没有被保存: %v, %s", ok, v)
+	}
+}
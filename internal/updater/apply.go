@@ -0,0 +1,274 @@
+package updater
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+)
+
+const (
+	// downloadTimeout 下载新版本的超时时间
+	downloadTimeout = time.Minute * 10
+
+	// maxAssetSize 新版本文件的最大大小
+	maxAssetSize = 256 * 1024 * 1024
+)
+
+// applying 是否正在更新, 避免重复下载
+var applying atomic.Bool
+
+// Apply 下载最近一次检查到的新版本, 替换当前程序后重启服务
+//
+// 需要配置 update.apply 为 manual 或 auto; 在容器中运行时替换的程序会在重建容器后丢失, 不允许更新
+func Apply(ctx context.Context) error {
+	if config.C.Update.Apply == config.UpdateApplyOff {
+		return errors.New("未开启程序更新, 需要配置 update.apply 为 manual 或 auto")
+	}
+	if inContainer() {
+		return errors.New("当前在容器中运行, 请通过更新镜像的方式升级")
+	}
+	if !applying.CompareAndSwap(false, true) {
+		return errors.New("正在更新中")
+	}
+	defer applying.Store(false)
+
+	mu.Lock()
+	r, available, restart := latest, status.Available, restarter
+	mu.Unlock()
+	if r == nil || !available {
+		return errors.New("没有可用的新版本")
+	}
+
+	a, ok := pickAsset(r.Assets)
+	if !ok {
+		return fmt.Errorf("版本 %s 中没有适用于 %s/%s 的文件", r.TagName, runtime.GOOS, runtime.GOARCH)
+	}
+	ctx, cancel := context.WithTimeout(ctx, downloadTimeout)
+	defer cancel()
+
+	log.Printf(colors.ToBlue("正在下载新版本 %s: %s"), r.TagName, a.Name)
+	data, err := download(ctx, a.Url)
+	if err != nil {
+		return fmt.Errorf("下载新版本失败: %v", err)
+	}
+	if err := verifyChecksum(ctx, r.Assets, a, data); err != nil {
+		return err
+	}
+	bin, err := extractBinary(a.Name, data)
+	if err != nil {
+		return err
+	}
+	if err := replaceExecutable(bin); err != nil {
+		return err
+	}
+
+	log.Printf(colors.ToGreen("已更新到版本 %s, 正在重启服务"), r.TagName)
+	if restart != nil {
+		go restart()
+	}
+	return nil
+}
+
+// pickAsset 选择适用于当前平台的文件, 文件名中需要包含相邻的系统和架构, 如: go-emby2alist_linux_amd64.tar.gz
+func pickAsset(assets []asset) (asset, bool) {
+	for _, a := range assets {
+		if isChecksumFile(a.Name) {
+			continue
+		}
+		if matchPlatform(a.Name, runtime.GOOS, runtime.GOARCH) {
+			return a, true
+		}
+	}
+	return asset{}, false
+}
+
+// matchPlatform 判断文件名是否属于指定的平台
+//
+// 文件名按照 _ - . 拆分后, 系统和架构需要是完全相同且相邻的两段, 避免 arm 匹配到 arm64 的文件
+func matchPlatform(name, goos, goarch string) bool {
+	tokens := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return r == '_' || r == '-' || r == '.'
+	})
+	for i := 0; i+1 < len(tokens); i++ {
+		if tokens[i] == goos && tokens[i+1] == goarch {
+			return true
+		}
+	}
+	return false
+}
+
+// isChecksumFile 判断是否为校验和文件
+func isChecksumFile(name string) bool {
+	name = strings.ToLower(name)
+	return strings.HasSuffix(name, ".sha256") || strings.Contains(name, "checksum")
+}
+
+// download 下载文件, 超出 maxAssetSize 时返回错误
+func download(ctx context.Context, u string) ([]byte, error) {
+	_, resp, err := https.RequestRedirectCtx(ctx, http.MethodGet, u, githubHeader(), nil, true)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("响应码: %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxAssetSize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxAssetSize {
+		return nil, fmt.Errorf("文件大小超出限制: %d MB", maxAssetSize>>20)
+	}
+	return data, nil
+}
+
+// verifyChecksum 校验下载的文件是否完整
+//
+// 支持单个文件的 <文件名>.sha256, 以及 sha256sum 格式的汇总文件;
+// 版本中找不到该文件的校验和时返回错误, 除非配置了 update.allow-unverified
+func verifyChecksum(ctx context.Context, assets []asset, target asset, data []byte) error {
+	for _, a := range assets {
+		if !isChecksumFile(a.Name) || (strings.HasSuffix(strings.ToLower(a.Name), ".sha256") && a.Name != target.Name+".sha256") {
+			continue
+		}
+		sums, err := download(ctx, a.Url)
+		if err != nil {
+			return fmt.Errorf("下载校验和文件失败: %v", err)
+		}
+		want := ""
+		for _, line := range strings.Split(string(sums), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) == 1 || (len(fields) >= 2 && strings.TrimPrefix(fields[1], "*") == target.Name) {
+				want = strings.ToLower(fields[0])
+				break
+			}
+		}
+		if want == "" {
+			continue
+		}
+		sum := sha256.Sum256(data)
+		if got := hex.EncodeToString(sum[:]); got != want {
+			return fmt.Errorf("新版本文件校验失败, 期望: %s, 实际: %s", want, got)
+		}
+		return nil
+	}
+	if config.C.Update.AllowUnverified {
+		log.Printf(colors.ToYellow("版本中没有 %s 的校验和, 已配置 update.allow-unverified, 跳过校验"), target.Name)
+		return nil
+	}
+	return fmt.Errorf("版本中没有 %s 的校验和, 无法确认文件完整, 拒绝更新", target.Name)
+}
+
+// extractBinary 从下载的文件中取出程序, 压缩包 (.tar.gz, .zip) 中取体积最大的文件, 其他格式视为程序本身
+func extractBinary(name string, data []byte) ([]byte, error) {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz") || strings.HasSuffix(name, ".tgz"):
+		gr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, fmt.Errorf("解压新版本失败: %v", err)
+		}
+		tr := tar.NewReader(gr)
+		var bin []byte
+		for {
+			hdr, err := tr.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("解压新版本失败: %v", err)
+			}
+			if hdr.Typeflag != tar.TypeReg || hdr.Size <= int64(len(bin)) {
+				continue
+			}
+			if bin, err = io.ReadAll(io.LimitReader(tr, maxAssetSize)); err != nil {
+				return nil, fmt.Errorf("解压新版本失败: %v", err)
+			}
+		}
+		if len(bin) == 0 {
+			return nil, errors.New("压缩包中没有程序文件")
+		}
+		return bin, nil
+	case strings.HasSuffix(name, ".zip"):
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			return nil, fmt.Errorf("解压新版本失败: %v", err)
+		}
+		var target *zip.File
+		for _, f := range zr.File {
+			if !f.FileInfo().IsDir() && (target == nil || f.UncompressedSize64 > target.UncompressedSize64) {
+				target = f
+			}
+		}
+		if target == nil {
+			return nil, errors.New("压缩包中没有程序文件")
+		}
+		rc, err := target.Open()
+		if err != nil {
+			return nil, fmt.Errorf("解压新版本失败: %v", err)
+		}
+		defer rc.Close()
+		return io.ReadAll(io.LimitReader(rc, maxAssetSize))
+	}
+	return data, nil
+}
+
+// replaceExecutable 替换当前程序, 原程序备份为 .old
+//
+// 先写入同目录下的临时文件再重命名, 避免替换过程中失败导致程序损坏
+func replaceExecutable(bin []byte) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("获取当前程序路径失败: %v", err)
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return fmt.Errorf("获取当前程序路径失败: %v", err)
+	}
+
+	tmp := exe + ".new"
+	if err := os.WriteFile(tmp, bin, 0755); err != nil {
+		return fmt.Errorf("写入新版本失败: %v", err)
+	}
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("备份当前程序失败: %v", err)
+	}
+	if err := os.Rename(tmp, exe); err != nil {
+		// 恢复原程序
+		os.Rename(old, exe)
+		return fmt.Errorf("替换程序失败: %v", err)
+	}
+	return nil
+}
+
+// inContainer 判断当前是否在容器中运行
+func inContainer() bool {
+	for _, f := range []string{"/.dockerenv", "/run/.containerenv"} {
+		if _, err := os.Stat(f); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,173 @@
+// 版本检查和自动更新, 定期查询 GitHub 上的最新版本, 按照配置下载新版本替换程序并重启
+package updater
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+)
+
+// checkTimeout 查询最新版本的超时时间
+const checkTimeout = time.Second * 15
+
+// release GitHub 发布的版本
+type release struct {
+	TagName     string    `json:"tag_name"`
+	HtmlUrl     string    `json:"html_url"`
+	PublishedAt time.Time `json:"published_at"`
+	Prerelease  bool      `json:"prerelease"`
+	Draft       bool      `json:"draft"`
+	Assets      []asset   `json:"assets"`
+}
+
+// asset 版本附带的文件
+type asset struct {
+	Name string `json:"name"`
+	Url  string `json:"browser_download_url"`
+	Size int64  `json:"size"`
+}
+
+// Status 版本检查状态
+type Status struct {
+	Current     string    // 当前版本
+	Latest      string    `json:",omitempty"` // 最新版本
+	Available   bool      // 是否有可用的新版本
+	ReleaseUrl  string    `json:",omitempty"` // 最新版本的发布页面
+	PublishedAt time.Time `json:",omitempty"` // 最新版本的发布时间
+	CheckedAt   time.Time `json:",omitempty"` // 最近一次检查的时间
+	Error       string    `json:",omitempty"` // 最近一次检查失败的原因
+	Apply       string    // 新版本的安装方式
+}
+
+var (
+	// status 最近一次的检查状态
+	status = Status{Current: constant.CurrentVersion}
+	// latest 最近一次检查到的最新版本
+	latest *release
+	// restarter 替换程序之后的重启函数, 由 web 服务注入
+	restarter func()
+	// mu 并发控制
+	mu sync.Mutex
+	// startOnce 保证定期检查只启动一次
+	startOnce sync.Once
+)
+
+// Start 按照 update 配置定期检查新版本, restart 用于替换程序之后重启服务
+func Start(restart func()) {
+	mu.Lock()
+	restarter = restart
+	mu.Unlock()
+
+	cfg := config.C.Update
+	if !cfg.Check {
+		return
+	}
+	startOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(cfg.IntervalDuration())
+			defer ticker.Stop()
+			for {
+				s, err := Check(context.Background())
+				if err != nil {
+					log.Printf(colors.ToYellow("检查新版本失败: %v"), err)
+				} else if s.Available {
+					log.Printf(colors.ToYellow("发现新版本: %s (当前版本: %s), 发布页面: %s"), s.Latest, s.Current, s.ReleaseUrl)
+					if cfg.Apply == config.UpdateApplyAuto {
+						if err := Apply(context.Background()); err != nil {
+							log.Printf(colors.ToRed("自动更新失败: %v"), err)
+						}
+					}
+				}
+				<-ticker.C
+			}
+		}()
+	})
+}
+
+// GetStatus 获取最近一次的检查状态
+func GetStatus() Status {
+	mu.Lock()
+	defer mu.Unlock()
+	s := status
+	s.Apply = string(config.C.Update.Apply)
+	return s
+}
+
+// Check 立即检查一次新版本
+func Check(ctx context.Context) (Status, error) {
+	r, err := fetchLatest(ctx)
+
+	mu.Lock()
+	status.CheckedAt = time.Now()
+	if err != nil {
+		status.Error = err.Error()
+	} else {
+		latest = r
+		status.Error = ""
+		status.Latest = r.TagName
+		status.ReleaseUrl = r.HtmlUrl
+		status.PublishedAt = r.PublishedAt
+		status.Available = CompareVersion(r.TagName, constant.CurrentVersion) > 0
+	}
+	mu.Unlock()
+	return GetStatus(), err
+}
+
+// fetchLatest 查询 GitHub 上的最新版本, 未开启 update.prerelease 时忽略预发布版本
+func fetchLatest(ctx context.Context) (*release, error) {
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+
+	cfg := config.C.Update
+	u := fmt.Sprintf("https://api.github.com/repos/%s/releases?per_page=20", cfg.Repo)
+	var releases []release
+	if err := getJson(ctx, u, &releases); err != nil {
+		return nil, err
+	}
+	for i, r := range releases {
+		if r.Draft || (r.Prerelease && !cfg.Prerelease) {
+			continue
+		}
+		return &releases[i], nil
+	}
+	return nil, errors.New("仓库中没有可用的版本")
+}
+
+// getJson 请求 GitHub 接口并解析 json 响应
+func getJson(ctx context.Context, u string, v any) error {
+	resp, err := https.RequestCtx(ctx, http.MethodGet, u, githubHeader(), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("请求 GitHub 失败: %s", resp.Status)
+	}
+	bytes, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("读取 GitHub 响应失败: %v", err)
+	}
+	if err := json.Unmarshal(bytes, v); err != nil {
+		return fmt.Errorf("解析 GitHub 响应失败: %v", err)
+	}
+	return nil
+}
+
+// githubHeader 请求 GitHub 时使用的请求头
+func githubHeader() http.Header {
+	header := make(http.Header)
+	header.Set("User-Agent", "go-emby2alist/"+constant.CurrentVersion)
+	header.Set("Accept", "application/vnd.github+json")
+	return header
+}
@@ -0,0 +1,73 @@
+package updater
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// CompareVersion 比较两个版本号, a 较新时返回正数, 相同时返回 0, b 较新时返回负数
+//
+// 版本号格式为 v主版本.次版本.修订号[-预发布标识], 如: v1.3.0, v1.3.0-beta-v3;
+// 主体相同时正式版本比预发布版本新, 预发布标识中的数字按照数值比较
+func CompareVersion(a, b string) int {
+	aCore, aPre, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(a), "v"), "-")
+	bCore, bPre, _ := strings.Cut(strings.TrimPrefix(strings.TrimSpace(b), "v"), "-")
+
+	aParts, bParts := strings.Split(aCore, "."), strings.Split(bCore, ".")
+	for i := 0; i < max(len(aParts), len(bParts)); i++ {
+		var an, bn int
+		if i < len(aParts) {
+			an, _ = strconv.Atoi(aParts[i])
+		}
+		if i < len(bParts) {
+			bn, _ = strconv.Atoi(bParts[i])
+		}
+		if an != bn {
+			return an - bn
+		}
+	}
+
+	switch {
+	case aPre == bPre:
+		return 0
+	case aPre == "":
+		return 1
+	case bPre == "":
+		return -1
+	}
+	return compareNatural(aPre, bPre)
+}
+
+// compareNatural 按照自然顺序比较字符串, 连续的数字按照数值比较, 如: beta-v10 > beta-v9
+func compareNatural(a, b string) int {
+	aTokens, bTokens := tokenize(a), tokenize(b)
+	for i := 0; i < min(len(aTokens), len(bTokens)); i++ {
+		at, bt := aTokens[i], bTokens[i]
+		an, aErr := strconv.Atoi(at)
+		bn, bErr := strconv.Atoi(bt)
+		if aErr == nil && bErr == nil {
+			if an != bn {
+				return an - bn
+			}
+			continue
+		}
+		if c := strings.Compare(at, bt); c != 0 {
+			return c
+		}
+	}
+	return len(aTokens) - len(bTokens)
+}
+
+// tokenize 将字符串拆分为连续的数字和非数字片段
+func tokenize(s string) []string {
+	tokens := make([]string, 0)
+	start := 0
+	for i := 1; i <= len(s); i++ {
+		if i == len(s) || unicode.IsDigit(rune(s[i])) != unicode.IsDigit(rune(s[i-1])) {
+			tokens = append(tokens, s[start:i])
+			start = i
+		}
+	}
+	return tokens
+}
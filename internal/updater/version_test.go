@@ -0,0 +1,29 @@
+package updater_test
+
+import (
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/updater"
+)
+
+func TestCompareVersion(t *testing.T) {
+	cases := []struct {
+		a, b string
+		want int
+	}{
+		{"v1.3.0", "v1.3.0", 0},
+		{"v1.3.1", "v1.3.0", 1},
+		{"v1.10.0", "v1.9.0", 1},
+		{"v1.3.0", "v1.3.0-beta-v3", 1},
+		{"v1.3.0-beta-v10", "v1.3.0-beta-v9", 1},
+		{"v1.3.0-beta-v3", "v1.3.0-rc-v1", -1},
+		{"1.3", "v1.3.0", 0},
+		{"v1.2.9", "v1.3.0-beta-v1", -1},
+	}
+	for _, c := range cases {
+		got := updater.CompareVersion(c.a, c.b)
+		if (got > 0) != (c.want > 0) || (got < 0) != (c.want < 0) {
+			t.Errorf("CompareVersion(%s, %s) = %d, want %d", c.a, c.b, got, c.want)
+		}
+	}
+}
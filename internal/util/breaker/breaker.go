@@ -0,0 +1,110 @@
+// 熔断器, 上游服务连续失败达到阈值后熔断,
+// 冷却时间过后进入半开状态, 放行一个探测请求
+package breaker
+
+import (
+	"sync"
+	"time"
+)
+
+// State 熔断器状态
+type State string
+
+const (
+	StateClosed   State = "closed"    // 正常放行
+	StateOpen     State = "open"      // 熔断中, 拒绝请求
+	StateHalfOpen State = "half-open" // 半开, 放行一个探测请求
+)
+
+// Breaker 熔断器
+type Breaker struct {
+	threshold int           // 连续失败多少次后熔断, 小于等于 0 表示不启用
+	cooldown  time.Duration // 熔断后多久进入半开状态
+
+	state    State
+	failures int
+	openedAt time.Time
+	probing  bool // 半开状态下是否已经有探测请求在进行中
+	mu       sync.Mutex
+}
+
+// New 初始化一个熔断器
+func New(threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{threshold: threshold, cooldown: cooldown, state: StateClosed}
+}
+
+// Allow 判断当前是否允许请求通过
+func (b *Breaker) Allow() bool {
+	if b == nil || b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return true
+	case StateHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Success 记录一次成功请求, 熔断器恢复正常
+func (b *Breaker) Success() {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.state = StateClosed
+	b.failures = 0
+	b.probing = false
+}
+
+// Failure 记录一次失败请求, 达到阈值或者半开探测失败时熔断
+func (b *Breaker) Failure() {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.failures++
+	if b.state == StateHalfOpen || b.failures >= b.threshold {
+		b.state = StateOpen
+		b.openedAt = time.Now()
+		b.probing = false
+	}
+}
+
+// Cancel 记录一次被调用方取消的请求, 不计入成功或失败, 半开状态下释放探测名额
+func (b *Breaker) Cancel() {
+	if b == nil || b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateHalfOpen {
+		b.probing = false
+	}
+}
+
+// State 获取熔断器当前状态
+func (b *Breaker) State() State {
+	if b == nil {
+		return StateClosed
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
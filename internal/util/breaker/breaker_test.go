@@ -0,0 +1,52 @@
+package breaker_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/breaker"
+)
+
+func TestBreaker(t *testing.T) {
+	b := breaker.New(2, time.Millisecond*50)
+
+	b.Failure()
+	if !b.Allow() {
+		t.Fatal("未达到阈值时不应熔断")
+	}
+	b.Failure()
+	if b.Allow() {
+		t.Fatal("达到阈值后应该熔断")
+	}
+
+	time.Sleep(time.Millisecond * 60)
+	if !b.Allow() {
+		t.Fatal("冷却后应该放行一个探测请求")
+	}
+	if b.Allow() {
+		t.Fatal("半开状态下只允许一个探测请求")
+	}
+
+	b.Success()
+	if b.State() != breaker.StateClosed || !b.Allow() {
+		t.Fatal("探测成功后应该恢复正常")
+	}
+}
+
+func TestBreakerCancel(t *testing.T) {
+	b := breaker.New(1, time.Millisecond*50)
+
+	b.Failure()
+	time.Sleep(time.Millisecond * 60)
+	if !b.Allow() {
+		t.Fatal("冷却后应该放行一个探测请求")
+	}
+
+	b.Cancel()
+	if b.State() != breaker.StateHalfOpen {
+		t.Fatal("探测请求被取消时不应改变熔断状态")
+	}
+	if !b.Allow() {
+		t.Fatal("探测请求被取消后应该重新放行一个探测请求")
+	}
+}
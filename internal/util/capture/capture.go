@@ -0,0 +1,181 @@
+// 请求录制, 将请求和响应 (已脱敏) 记录到内存的环形缓冲区中,
+// 导出为 HAR/JSONL 文件, 便于远程排查个别客户端的兼容问题
+package capture
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+)
+
+// Entry 一次请求的录制记录
+type Entry struct {
+	RequestId     string      `json:"requestId"`     // 请求 id
+	Time          time.Time   `json:"time"`          // 请求时间
+	Cost          int64       `json:"cost"`          // 处理耗时 (毫秒)
+	Method        string      `json:"method"`        // 请求方法
+	Url           string      `json:"url"`           // 请求地址 (已脱敏)
+	ReqHeader     http.Header `json:"reqHeader"`     // 请求头 (已脱敏)
+	ReqBody       string      `json:"reqBody"`       // 请求体 (已脱敏)
+	Code          int         `json:"code"`          // 响应码
+	RespHeader    http.Header `json:"respHeader"`    // 响应头 (已脱敏)
+	RespBody      string      `json:"respBody"`      // 响应体 (已脱敏), 非文本响应不记录
+	RespSize      int         `json:"respSize"`      // 响应体的实际大小
+	BodyTruncated bool        `json:"bodyTruncated"` // 请求体或响应体是否被截断
+}
+
+var (
+	// enabled 是否正在录制
+	enabled atomic.Bool
+	// initOnce 首次使用时从配置中读取初始状态
+	initOnce sync.Once
+
+	// entries 录制记录, 按时间顺序排列
+	entries []Entry
+	// entriesMu 并发控制
+	entriesMu sync.Mutex
+)
+
+// Enabled 判断是否正在录制
+func Enabled() bool {
+	initOnce.Do(func() { enabled.Store(config.C.Log.Capture.Enable) })
+	return enabled.Load()
+}
+
+// SetEnabled 切换录制状态, 重启后恢复为配置文件中的状态
+func SetEnabled(enable bool) {
+	initOnce.Do(func() {})
+	enabled.Store(enable)
+}
+
+// Record 记录一次请求, 超过 max-entries 时淘汰最早的记录
+func Record(e Entry) {
+	max := config.C.Log.Capture.MaxEntries
+	entriesMu.Lock()
+	defer entriesMu.Unlock()
+	if len(entries) >= max {
+		entries = append(entries[:0], entries[len(entries)-max+1:]...)
+	}
+	entries = append(entries, e)
+}
+
+// Entries 获取所有的录制记录
+func Entries() []Entry {
+	entriesMu.Lock()
+	defer entriesMu.Unlock()
+	return append(([]Entry)(nil), entries...)
+}
+
+// Clear 清空录制记录
+func Clear() {
+	entriesMu.Lock()
+	defer entriesMu.Unlock()
+	entries = nil
+}
+
+// IsText 判断内容类型是否为文本, 只有文本内容才会记录到录制记录中
+func IsText(contentType string) bool {
+	ct := strings.ToLower(contentType)
+	for _, t := range []string{"text", "json", "xml", "javascript", "mpegurl", "x-www-form-urlencoded"} {
+		if strings.Contains(ct, t) {
+			return true
+		}
+	}
+	return false
+}
+
+// JSONL 将录制记录导出为 JSONL 格式, 每行一条记录
+func JSONL(es []Entry) []byte {
+	buf := new(bytes.Buffer)
+	enc := json.NewEncoder(buf)
+	for _, e := range es {
+		enc.Encode(e)
+	}
+	return buf.Bytes()
+}
+
+// HAR 将录制记录导出为 HAR 1.2 格式
+func HAR(es []Entry) map[string]interface{} {
+	harEntries := make([]map[string]interface{}, 0, len(es))
+	for _, e := range es {
+		request := map[string]interface{}{
+			"method":      e.Method,
+			"url":         e.Url,
+			"httpVersion": "HTTP/1.1",
+			"cookies":     []interface{}{},
+			"headers":     harHeaders(e.ReqHeader),
+			"queryString": harQuery(e.Url),
+			"headersSize": -1,
+			"bodySize":    len(e.ReqBody),
+		}
+		if e.ReqBody != "" {
+			request["postData"] = map[string]string{"mimeType": e.ReqHeader.Get("Content-Type"), "text": e.ReqBody}
+		}
+
+		harEntries = append(harEntries, map[string]interface{}{
+			"startedDateTime": e.Time.Format(time.RFC3339Nano),
+			"time":            e.Cost,
+			"request":         request,
+			"response": map[string]interface{}{
+				"status":      e.Code,
+				"statusText":  http.StatusText(e.Code),
+				"httpVersion": "HTTP/1.1",
+				"cookies":     []interface{}{},
+				"headers":     harHeaders(e.RespHeader),
+				"content": map[string]interface{}{
+					"size":     e.RespSize,
+					"mimeType": e.RespHeader.Get("Content-Type"),
+					"text":     e.RespBody,
+				},
+				"redirectURL": e.RespHeader.Get("Location"),
+				"headersSize": -1,
+				"bodySize":    e.RespSize,
+			},
+			"cache":      map[string]interface{}{},
+			"timings":    map[string]int64{"send": 0, "wait": e.Cost, "receive": 0},
+			"_requestId": e.RequestId,
+		})
+	}
+
+	return map[string]interface{}{
+		"log": map[string]interface{}{
+			"version": "1.2",
+			"creator": map[string]string{"name": "go-emby2alist", "version": constant.CurrentVersion},
+			"entries": harEntries,
+		},
+	}
+}
+
+// harHeaders 将请求头转换为 HAR 的格式
+func harHeaders(h http.Header) []map[string]string {
+	res := make([]map[string]string, 0, len(h))
+	for key, values := range h {
+		for _, value := range values {
+			res = append(res, map[string]string{"name": key, "value": value})
+		}
+	}
+	return res
+}
+
+// harQuery 将 url 中的 query 参数转换为 HAR 的格式
+func harQuery(rawUrl string) []map[string]string {
+	res := make([]map[string]string, 0)
+	u, err := url.Parse(rawUrl)
+	if err != nil {
+		return res
+	}
+	for key, values := range u.Query() {
+		for _, value := range values {
+			res = append(res, map[string]string{"name": key, "value": value})
+		}
+	}
+	return res
+}
@@ -0,0 +1,141 @@
+// 标准的 5 段 cron 表达式: 分 时 日 月 周
+//
+// 每一段支持: *, 数字, 范围 a-b, 步长 */n 或 a-b/n, 以及使用逗号分隔的列表;
+// 周的取值为 0-6, 0 表示周日, 同时兼容 7 表示周日
+package crons
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxSearchMinutes 查找下一次触发时间的最大分钟数, 超出后视为表达式无法触发
+const maxSearchMinutes = 366 * 24 * 60 * 5
+
+// Schedule 解析之后的 cron 表达式
+type Schedule struct {
+	raw string
+
+	minute, hour, dom, month, dow uint64
+
+	// domAny, dowAny 日和周是否为 *, 两者均被指定时满足任意一个即可触发
+	domAny, dowAny bool
+}
+
+// field 表达式中每一段的取值范围
+type field struct {
+	name     string
+	min, max int
+}
+
+var fields = []field{
+	{"分", 0, 59},
+	{"时", 0, 23},
+	{"日", 1, 31},
+	{"月", 1, 12},
+	{"周", 0, 7},
+}
+
+// Parse 解析 cron 表达式
+func Parse(spec string) (*Schedule, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(fields) {
+		return nil, fmt.Errorf("cron 表达式需要 %d 段, 实际: %d, 表达式: %s", len(fields), len(parts), spec)
+	}
+
+	bits := make([]uint64, len(fields))
+	for i, part := range parts {
+		b, err := parseField(part, fields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron 表达式 [%s] 错误: %v", spec, err)
+		}
+		bits[i] = b
+	}
+	// 7 和 0 均表示周日
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Schedule{
+		raw:    spec,
+		minute: bits[0], hour: bits[1], dom: bits[2], month: bits[3], dow: bits[4],
+		domAny: parts[2] == "*", dowAny: parts[4] == "*",
+	}, nil
+}
+
+// parseField 将表达式中的一段解析为位图
+func parseField(part string, f field) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(part, ",") {
+		rng, step := item, 1
+		if idx := strings.Index(item, "/"); idx != -1 {
+			s, err := strconv.Atoi(item[idx+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("%s: 步长错误: %s", f.name, item)
+			}
+			rng, step = item[:idx], s
+		}
+
+		lo, hi := f.min, f.max
+		if rng != "*" {
+			var err error
+			bounds := strings.SplitN(rng, "-", 2)
+			if lo, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("%s: 取值错误: %s", f.name, item)
+			}
+			hi = lo
+			if len(bounds) == 2 {
+				if hi, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("%s: 取值错误: %s", f.name, item)
+				}
+			} else if step > 1 {
+				// a/n 表示从 a 开始到最大值
+				hi = f.max
+			}
+		}
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%s: 取值超出范围 [%d, %d]: %s", f.name, f.min, f.max, item)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << v
+		}
+	}
+	return bits, nil
+}
+
+// String 返回原始表达式
+func (s *Schedule) String() string {
+	return s.raw
+}
+
+// Next 获取 t 之后 (不包含 t 所在的分钟) 的下一次触发时间, 无法触发时返回零值
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for i := 0; i < maxSearchMinutes; i++ {
+		switch {
+		case s.month&(1<<int(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatch(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case s.hour&(1<<t.Hour()) == 0:
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case s.minute&(1<<t.Minute()) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// dayMatch 判断日期是否满足日和周的限制
+func (s *Schedule) dayMatch(t time.Time) bool {
+	domOk := s.dom&(1<<t.Day()) != 0
+	dowOk := s.dow&(1<<int(t.Weekday())) != 0
+	if s.domAny || s.dowAny {
+		return domOk && dowOk
+	}
+	return domOk || dowOk
+}
@@ -0,0 +1,51 @@
+package crons_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/crons"
+)
+
+func TestNext(t *testing.T) {
+	base := time.Date(2024, 9, 6, 20, 15, 30, 0, time.Local) // 周五
+	cases := []struct {
+		spec string
+		want time.Time
+	}{
+		{"30 19 * * *", time.Date(2024, 9, 7, 19, 30, 0, 0, time.Local)},
+		{"*/20 * * * *", time.Date(2024, 9, 6, 20, 20, 0, 0, time.Local)},
+		{"0 18-22/2 * * *", time.Date(2024, 9, 6, 22, 0, 0, 0, time.Local)},
+		{"0 9 * * 0", time.Date(2024, 9, 8, 9, 0, 0, 0, time.Local)},
+		{"0 9 * * 7", time.Date(2024, 9, 8, 9, 0, 0, 0, time.Local)},
+		{"0 0 1 1 *", time.Date(2025, 1, 1, 0, 0, 0, 0, time.Local)},
+		{"0 12 13 * 5", time.Date(2024, 9, 13, 12, 0, 0, 0, time.Local)},
+	}
+	for _, c := range cases {
+		s, err := crons.Parse(c.spec)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := s.Next(base); !got.Equal(c.want) {
+			t.Errorf("%s: 期望: %v, 实际: %v", c.spec, c.want, got)
+		}
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := crons.Parse(spec); err == nil {
+			t.Errorf("表达式 [%s] 期望解析失败", spec)
+		}
+	}
+}
+
+func TestNever(t *testing.T) {
+	s, err := crons.Parse("0 0 31 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next := s.Next(time.Now()); !next.IsZero() {
+		t.Errorf("期望无法触发, 实际: %v", next)
+	}
+}
@@ -0,0 +1,156 @@
+// 磁盘缓存清理, 按照过期时间以及磁盘剩余空间水位淘汰缓存文件
+package diskcache
+
+import (
+	"errors"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+)
+
+// ErrUnsupported 当前平台不支持获取磁盘剩余空间
+var ErrUnsupported = errors.New("当前平台不支持获取磁盘剩余空间")
+
+// tmpPrefix 写入过程中的临时文件前缀, 未超过 tmpMaxAge 时不清理
+const tmpPrefix = "tmp-"
+
+// tmpMaxAge 临时文件的最长保留时间, 超出时认为是写入中断遗留的文件
+const tmpMaxAge = time.Hour
+
+// cacheDir 注册的缓存目录
+type cacheDir struct {
+	path string        // 目录绝对路径
+	ttl  time.Duration // 缓存文件的过期时间, 零值表示只按剩余空间淘汰
+}
+
+// cacheFile 缓存文件信息
+type cacheFile struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+var (
+	// dirs 所有注册的缓存目录
+	dirs []cacheDir
+	// dirsMu 并发控制
+	dirsMu sync.Mutex
+)
+
+// Register 注册一个需要清理的缓存目录
+func Register(path string, ttl time.Duration) {
+	dirsMu.Lock()
+	defer dirsMu.Unlock()
+	dirs = append(dirs, cacheDir{path: path, ttl: ttl})
+}
+
+// Start 按照 interval 定期清理所有注册的缓存目录
+//
+// minFree 为缓存所在磁盘的最低剩余空间 (Byte), 0 表示不限制
+func Start(interval time.Duration, minFree int64) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			Sweep(minFree)
+			<-ticker.C
+		}
+	}()
+}
+
+// Sweep 清理一次所有注册的缓存目录
+//
+// 先删除过期的缓存文件, 剩余空间仍低于 minFree 时从最早写入的文件开始淘汰
+func Sweep(minFree int64) {
+	dirsMu.Lock()
+	all := append([]cacheDir(nil), dirs...)
+	dirsMu.Unlock()
+
+	for _, dir := range all {
+		files, err := listFiles(dir.path)
+		if err != nil {
+			log.Printf(colors.ToRed("扫描缓存目录失败: %s, err: %v"), dir.path, err)
+			continue
+		}
+
+		alive := files[:0]
+		expired := 0
+		for _, f := range files {
+			if dir.ttl > 0 && time.Since(f.modTime) > dir.ttl {
+				if os.Remove(f.path) == nil {
+					expired++
+				}
+				continue
+			}
+			alive = append(alive, f)
+		}
+		if expired > 0 {
+			log.Printf(colors.ToGreen("清理过期缓存文件 %d 个, 目录: %s"), expired, dir.path)
+		}
+
+		if minFree > 0 {
+			evictByWatermark(dir.path, alive, minFree)
+		}
+	}
+}
+
+// evictByWatermark 磁盘剩余空间低于 minFree 时, 从最早写入的文件开始淘汰, 直到剩余空间满足要求
+func evictByWatermark(dir string, files []cacheFile, minFree int64) {
+	free, err := FreeSpace(dir)
+	if err != nil {
+		if !errors.Is(err, ErrUnsupported) {
+			log.Printf(colors.ToRed("获取磁盘剩余空间失败: %s, err: %v"), dir, err)
+		}
+		return
+	}
+	if free >= minFree {
+		return
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	evicted, released := 0, int64(0)
+	for _, f := range files {
+		if free+released >= minFree {
+			break
+		}
+		if os.Remove(f.path) == nil {
+			evicted++
+			released += f.size
+		}
+	}
+	log.Printf(colors.ToYellow("磁盘剩余空间不足 (%d MB), 淘汰缓存文件 %d 个, 释放 %d MB, 目录: %s"),
+		free>>20, evicted, released>>20, dir)
+}
+
+// listFiles 列出目录下所有的缓存文件, 正在写入的临时文件除外
+func listFiles(dir string) ([]cacheFile, error) {
+	files := make([]cacheFile, 0)
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		if strings.HasPrefix(d.Name(), tmpPrefix) && time.Since(info.ModTime()) < tmpMaxAge {
+			return nil
+		}
+		files = append(files, cacheFile{path: path, size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	return files, err
+}
@@ -0,0 +1,43 @@
+package diskcache_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/diskcache"
+)
+
+func TestSweepExpired(t *testing.T) {
+	dir := t.TempDir()
+	oldFile, newFile := filepath.Join(dir, "ab", "old.bif"), filepath.Join(dir, "new.bif")
+	os.MkdirAll(filepath.Dir(oldFile), os.ModePerm)
+	for _, f := range []string{oldFile, newFile} {
+		if err := os.WriteFile(f, []byte("bif"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	past := time.Now().Add(-time.Hour * 2)
+	os.Chtimes(oldFile, past, past)
+
+	diskcache.Register(dir, time.Hour)
+	diskcache.Sweep(0)
+
+	if _, err := os.Stat(oldFile); !os.IsNotExist(err) {
+		t.Fatal("过期的缓存文件应该被删除")
+	}
+	if _, err := os.Stat(newFile); err != nil {
+		t.Fatal("未过期的缓存文件不应该被删除")
+	}
+}
+
+func TestFreeSpace(t *testing.T) {
+	free, err := diskcache.FreeSpace(t.TempDir())
+	if err == diskcache.ErrUnsupported {
+		t.Skip(err)
+	}
+	if err != nil || free <= 0 {
+		t.Fatalf("获取磁盘剩余空间失败: %d, %v", free, err)
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !(linux || darwin || freebsd || windows)
+
+package diskcache
+
+// FreeSpace 当前平台不支持获取磁盘剩余空间, 只按照过期时间清理
+func FreeSpace(path string) (int64, error) {
+	return 0, ErrUnsupported
+}
@@ -0,0 +1,14 @@
+//go:build linux || darwin || freebsd
+
+package diskcache
+
+import "syscall"
+
+// FreeSpace 获取 path 所在磁盘对非特权用户可用的剩余空间 (Byte)
+func FreeSpace(path string) (int64, error) {
+	var st syscall.Statfs_t
+	if err := syscall.Statfs(path, &st); err != nil {
+		return 0, err
+	}
+	return int64(st.Bavail) * int64(st.Bsize), nil
+}
@@ -0,0 +1,25 @@
+//go:build windows
+
+package diskcache
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// getDiskFreeSpaceEx kernel32 中获取磁盘剩余空间的函数
+var getDiskFreeSpaceEx = syscall.NewLazyDLL("kernel32.dll").NewProc("GetDiskFreeSpaceExW")
+
+// FreeSpace 获取 path 所在磁盘对当前用户可用的剩余空间 (Byte)
+func FreeSpace(path string) (int64, error) {
+	p, err := syscall.UTF16PtrFromString(path)
+	if err != nil {
+		return 0, err
+	}
+	var available int64
+	ret, _, err := getDiskFreeSpaceEx.Call(uintptr(unsafe.Pointer(p)), uintptr(unsafe.Pointer(&available)), 0, 0)
+	if ret == 0 {
+		return 0, err
+	}
+	return available, nil
+}
@@ -0,0 +1,306 @@
+// 简单的条件表达式, 用于在配置中描述请求的匹配条件
+//
+// 支持的语法:
+//
+//	变量:     client, path, header.User-Agent, query.MediaSourceId 等, 取值由调用方提供, 不存在时为空字符串
+//	字符串:   "infuse", 使用双引号包裹, 支持 go 的转义规则
+//	比较:     a == b, a != b
+//	正则匹配: a =~ "(?i)infuse", a !~ "^/emby", 正则表达式必须是字符串常量
+//	逻辑运算: !a, a && b, a || b, 以及括号分组
+//	单独的变量作为条件时, 非空即为真
+package expr
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Vars 表达式求值时获取变量值的函数
+type Vars func(name string) string
+
+// Expr 编译之后的表达式
+type Expr struct {
+	raw  string
+	root node
+}
+
+// String 返回原始表达式
+func (e *Expr) String() string {
+	return e.raw
+}
+
+// Eval 对表达式求值
+func (e *Expr) Eval(vars Vars) bool {
+	return e.root.eval(vars) != ""
+}
+
+// Compile 编译表达式
+func Compile(s string) (*Expr, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	root, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("表达式存在多余的内容: %s", p.tokens[p.pos].val)
+	}
+	return &Expr{raw: s, root: root}, nil
+}
+
+// MustCompile 编译表达式, 失败时 panic
+func MustCompile(s string) *Expr {
+	e, err := Compile(s)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// truth 表达式的真值, 逻辑运算的结果用非空字符串表示真
+const truth = "true"
+
+func boolVal(b bool) string {
+	if b {
+		return truth
+	}
+	return ""
+}
+
+// node 表达式语法树节点, 所有节点都以字符串作为求值结果
+type node interface {
+	eval(vars Vars) string
+}
+
+type (
+	literalNode struct{ val string }
+	varNode     struct{ name string }
+	notNode     struct{ operand node }
+	andNode     struct{ left, right node }
+	orNode      struct{ left, right node }
+	equalNode   struct {
+		left, right node
+		negate      bool
+	}
+	matchNode struct {
+		left   node
+		reg    *regexp.Regexp
+		negate bool
+	}
+)
+
+func (n literalNode) eval(Vars) string  { return n.val }
+func (n varNode) eval(vars Vars) string { return vars(n.name) }
+func (n notNode) eval(vars Vars) string { return boolVal(n.operand.eval(vars) == "") }
+func (n andNode) eval(vars Vars) string {
+	return boolVal(n.left.eval(vars) != "" && n.right.eval(vars) != "")
+}
+func (n orNode) eval(vars Vars) string {
+	return boolVal(n.left.eval(vars) != "" || n.right.eval(vars) != "")
+}
+func (n equalNode) eval(vars Vars) string {
+	return boolVal((n.left.eval(vars) == n.right.eval(vars)) != n.negate)
+}
+func (n matchNode) eval(vars Vars) string {
+	return boolVal(n.reg.MatchString(n.left.eval(vars)) != n.negate)
+}
+
+// tokenKind 词法单元类型
+type tokenKind int
+
+const (
+	tokenIdent tokenKind = iota
+	tokenString
+	tokenOp
+)
+
+// token 词法单元
+type token struct {
+	kind tokenKind
+	val  string
+}
+
+// operators 支持的运算符, 长的运算符需要排在前面
+var operators = []string{"&&", "||", "==", "!=", "=~", "!~", "!", "(", ")"}
+
+// tokenize 词法分析
+func tokenize(s string) ([]token, error) {
+	tokens := make([]token, 0)
+	for i := 0; i < len(s); {
+		ch := rune(s[i])
+		if unicode.IsSpace(ch) {
+			i++
+			continue
+		}
+
+		if ch == '"' {
+			j := i + 1
+			for ; j < len(s) && s[j] != '"'; j++ {
+				if s[j] == '\\' {
+					j++
+				}
+			}
+			if j >= len(s) {
+				return nil, fmt.Errorf("字符串缺少结束引号, 位置: %d", i)
+			}
+			val, err := strconv.Unquote(s[i : j+1])
+			if err != nil {
+				return nil, fmt.Errorf("字符串格式错误, 位置: %d, err: %v", i, err)
+			}
+			tokens = append(tokens, token{kind: tokenString, val: val})
+			i = j + 1
+			continue
+		}
+
+		if isIdentChar(ch) {
+			j := i
+			for j < len(s) && isIdentChar(rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokenIdent, val: s[i:j]})
+			i = j
+			continue
+		}
+
+		matched := false
+		for _, op := range operators {
+			if strings.HasPrefix(s[i:], op) {
+				tokens = append(tokens, token{kind: tokenOp, val: op})
+				i += len(op)
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return nil, fmt.Errorf("无法识别的字符: %q, 位置: %d", ch, i)
+		}
+	}
+	return tokens, nil
+}
+
+// isIdentChar 判断字符能否作为变量名的一部分, 变量名中允许出现 . 和 -, 便于引用请求头
+func isIdentChar(ch rune) bool {
+	return ch == '_' || ch == '.' || ch == '-' || unicode.IsLetter(ch) || unicode.IsDigit(ch)
+}
+
+// parser 递归下降语法分析
+//
+// 优先级从低到高: ||, &&, 比较运算, !, 括号
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// peekOp 判断下一个词法单元是否为指定的运算符
+func (p *parser) peekOp(op string) bool {
+	return p.pos < len(p.tokens) && p.tokens[p.pos].kind == tokenOp && p.tokens[p.pos].val == op
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("||") {
+		p.pos++
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for p.peekOp("&&") {
+		p.pos++
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = andNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseCompare() (node, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case p.peekOp("==") || p.peekOp("!="):
+		negate := p.tokens[p.pos].val == "!="
+		p.pos++
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return equalNode{left: left, right: right, negate: negate}, nil
+	case p.peekOp("=~") || p.peekOp("!~"):
+		negate := p.tokens[p.pos].val == "!~"
+		p.pos++
+		if p.pos >= len(p.tokens) || p.tokens[p.pos].kind != tokenString {
+			return nil, fmt.Errorf("正则匹配的右侧必须是字符串常量")
+		}
+		reg, err := regexp.Compile(p.tokens[p.pos].val)
+		if err != nil {
+			return nil, fmt.Errorf("正则表达式编译失败: %v", err)
+		}
+		p.pos++
+		return matchNode{left: left, reg: reg, negate: negate}, nil
+	}
+	return left, nil
+}
+
+func (p *parser) parseUnary() (node, error) {
+	if p.peekOp("!") {
+		p.pos++
+		operand, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{operand: operand}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (node, error) {
+	if p.pos >= len(p.tokens) {
+		return nil, fmt.Errorf("表达式不完整")
+	}
+	tk := p.tokens[p.pos]
+	p.pos++
+
+	switch tk.kind {
+	case tokenString:
+		return literalNode{val: tk.val}, nil
+	case tokenIdent:
+		return varNode{name: tk.val}, nil
+	}
+
+	if tk.val != "(" {
+		return nil, fmt.Errorf("意外的运算符: %s", tk.val)
+	}
+	inner, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if !p.peekOp(")") {
+		return nil, fmt.Errorf("括号不匹配")
+	}
+	p.pos++
+	return inner, nil
+}
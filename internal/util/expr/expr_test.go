@@ -0,0 +1,47 @@
+package expr_test
+
+import (
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/expr"
+)
+
+func TestEval(t *testing.T) {
+	vars := map[string]string{
+		"client":            "Infuse-Direct",
+		"path":              "/emby/videos/123/stream.mkv",
+		"header.User-Agent": "Infuse/7.0",
+	}
+	get := func(name string) string { return vars[name] }
+
+	cases := []struct {
+		expr string
+		want bool
+	}{
+		{`client == "Infuse-Direct"`, true},
+		{`client != "Infuse-Direct"`, false},
+		{`client =~ "(?i)^infuse"`, true},
+		{`path !~ "/stream"`, false},
+		{`header.User-Agent =~ "Infuse" && path =~ "(?i)/videos/\\d+/stream"`, true},
+		{`query.Static || client == "Emby Web"`, false},
+		{`!query.Static && (client == "x" || path =~ "mkv$")`, true},
+		{`header.User-Agent`, true},
+	}
+	for _, c := range cases {
+		e, err := expr.Compile(c.expr)
+		if err != nil {
+			t.Fatalf("编译表达式失败: %s, err: %v", c.expr, err)
+		}
+		if got := e.Eval(get); got != c.want {
+			t.Errorf("表达式: %s, 期望: %v, 实际: %v", c.expr, c.want, got)
+		}
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	for _, s := range []string{`client ==`, `(client == "a"`, `client =~ path`, `client = "a"`, `"abc`, `client "a"`} {
+		if _, err := expr.Compile(s); err == nil {
+			t.Errorf("表达式应该编译失败: %s", s)
+		}
+	}
+}
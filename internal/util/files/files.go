@@ -0,0 +1,31 @@
+// 文件读写工具
+package files
+
+import (
+	"os"
+)
+
+// WriteAtomic 将 data 写入 path, 先写入同目录下的临时文件, 刷新到磁盘之后再重命名,
+// 避免写入过程中程序退出或断电导致原文件损坏
+func WriteAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
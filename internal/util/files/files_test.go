@@ -0,0 +1,35 @@
+package files_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/files"
+)
+
+func TestWriteAtomic(t *testing.T) {
+	fp := filepath.Join(t.TempDir(), "data.json")
+	for _, content := range []string{"old", "new"} {
+		if err := files.WriteAtomic(fp, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	bytes, err := os.ReadFile(fp)
+	if err != nil || string(bytes) != "new" {
+		t.Fatalf("写入结果不符合预期: %s, %v", bytes, err)
+	}
+	if _, err := os.Stat(fp + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("临时文件没有被清理: %v", err)
+	}
+
+	// 目标路径是目录时重命名失败, 临时文件同样需要清理
+	dir := filepath.Join(t.TempDir(), "dir")
+	os.MkdirAll(filepath.Join(dir, "child"), os.ModePerm)
+	if err := files.WriteAtomic(dir, []byte("x"), 0644); err == nil {
+		t.Fatal("目标路径是非空目录时应该写入失败")
+	}
+	if _, err := os.Stat(dir + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("写入失败时临时文件没有被清理: %v", err)
+	}
+}
@@ -0,0 +1,153 @@
+// ip 地区数据库, 从本地文件中加载网段与国家/地区、ASN 的对应关系,
+// 用于根据客户端 ip 选择播放链接
+package geoip
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+)
+
+// Record ip 的地区信息
+type Record struct {
+	Country string // 国家/地区代码, 如: CN
+	Asn     string // 自治系统编号, 如: AS4134, 数据库中没有时为空
+}
+
+// ipRange 一个网段
+type ipRange struct {
+	start, end netip.Addr
+	record     Record
+}
+
+// DB ip 地区数据库
+type DB struct {
+	ranges []ipRange    // 按照起始地址排序
+	maxEnd []netip.Addr // maxEnd[i] 为前 i+1 个同类型网段中最大的结束地址, 用于处理嵌套的网段
+}
+
+// Parse 解析数据库, 每行格式为: 网段,国家代码[,ASN], 空行和 # 开头的行会被忽略
+func Parse(r io.Reader) (*DB, error) {
+	db := new(DB)
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fields := strings.Split(text, ",")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("第 %d 行格式错误: %s", line, text)
+		}
+		prefix, err := netip.ParsePrefix(strings.TrimSpace(fields[0]))
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 行网段错误: %v", line, err)
+		}
+		record := Record{Country: strings.ToUpper(strings.TrimSpace(fields[1]))}
+		if len(fields) > 2 {
+			record.Asn = config.NormalizeAsn(fields[2])
+		}
+		prefix = prefix.Masked()
+		db.ranges = append(db.ranges, ipRange{start: prefix.Addr(), end: lastAddr(prefix), record: record})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	sort.Slice(db.ranges, func(i, j int) bool {
+		return db.ranges[i].start.Less(db.ranges[j].start)
+	})
+	db.maxEnd = make([]netip.Addr, len(db.ranges))
+	for i, r := range db.ranges {
+		db.maxEnd[i] = r.end
+		if prev := i - 1; prev >= 0 && db.maxEnd[prev].BitLen() == r.end.BitLen() && r.end.Less(db.maxEnd[prev]) {
+			db.maxEnd[i] = db.maxEnd[prev]
+		}
+	}
+	return db, nil
+}
+
+// lastAddr 获取网段中的最后一个地址
+func lastAddr(prefix netip.Prefix) netip.Addr {
+	addr := prefix.Addr()
+	bytes := addr.As16()
+	bits := prefix.Bits()
+	if addr.Is4() {
+		bits += 96
+	}
+	for i := bits; i < 128; i++ {
+		bytes[i/8] |= 1 << (7 - i%8)
+	}
+	last := netip.AddrFrom16(bytes)
+	if addr.Is4() {
+		return last.Unmap()
+	}
+	return last
+}
+
+// Lookup 查询 ip 的地区信息, 局域网和本机地址返回 LAN
+func (db *DB) Lookup(ip string) (Record, bool) {
+	addr, err := netip.ParseAddr(strings.TrimSpace(ip))
+	if err != nil {
+		return Record{}, false
+	}
+	addr = addr.Unmap()
+	if addr.IsPrivate() || addr.IsLoopback() || addr.IsLinkLocalUnicast() {
+		return Record{Country: config.GeoLan}, true
+	}
+	if db == nil {
+		return Record{}, false
+	}
+
+	// 找到最后一个起始地址不大于 ip 的网段
+	idx := sort.Search(len(db.ranges), func(i int) bool {
+		return addr.Less(db.ranges[i].start)
+	}) - 1
+	// 网段可能存在嵌套, 继续向前查找包含 ip 的网段, 直到前面不可能再有网段包含 ip
+	for ; idx >= 0 && db.maxEnd[idx].BitLen() == addr.BitLen() && !db.maxEnd[idx].Less(addr); idx-- {
+		if r := db.ranges[idx]; !r.end.Less(addr) {
+			return r.record, true
+		}
+	}
+	return Record{}, false
+}
+
+// defaultDB 从配置的数据库文件中加载的数据库, 在首次查询时加载
+var defaultDB = sync.OnceValue(func() *DB {
+	path := config.C.Geo.DatabasePath()
+	file, err := os.Open(path)
+	if err != nil {
+		log.Printf(colors.ToRed("加载 ip 地区数据库失败: %v"), err)
+		return nil
+	}
+	defer file.Close()
+	db, err := Parse(file)
+	if err != nil {
+		log.Printf(colors.ToRed("解析 ip 地区数据库失败: %s, err: %v"), path, err)
+		return nil
+	}
+	log.Printf(colors.ToGreen("ip 地区数据库加载完成, 网段数: %d"), len(db.ranges))
+	return db
+})
+
+// Rule 查询客户端 ip 匹配的地区规则, 未启用 geo 或匹配不到时返回 nil
+func Rule(ip string) (*config.GeoRule, Record) {
+	if !config.C.Geo.Enable {
+		return nil, Record{}
+	}
+	record, ok := defaultDB().Lookup(ip)
+	if !ok {
+		return nil, record
+	}
+	return config.C.Geo.Match(record.Country, record.Asn), record
+}
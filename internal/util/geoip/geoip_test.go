@@ -0,0 +1,43 @@
+package geoip_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/geoip"
+)
+
+func TestLookup(t *testing.T) {
+	db, err := geoip.Parse(strings.NewReader(`
+# 网段,国家代码,ASN
+1.0.0.0/8,US
+1.2.0.0/16,CN,4134
+1.2.3.0/24,JP
+240e::/20,CN,AS4134
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		ip     string
+		want   geoip.Record
+		wantOk bool
+	}{
+		{"1.1.1.1", geoip.Record{Country: "US"}, true},
+		{"1.2.200.1", geoip.Record{Country: "CN", Asn: "AS4134"}, true},
+		{"1.2.3.4", geoip.Record{Country: "JP"}, true},
+		{"1.3.0.1", geoip.Record{Country: "US"}, true},
+		{"2.0.0.1", geoip.Record{}, false},
+		{"240e:1::1", geoip.Record{Country: "CN", Asn: "AS4134"}, true},
+		{"192.168.1.10", geoip.Record{Country: "LAN"}, true},
+		{"::ffff:127.0.0.1", geoip.Record{Country: "LAN"}, true},
+		{"invalid", geoip.Record{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := db.Lookup(tt.ip)
+		if got != tt.want || ok != tt.wantOk {
+			t.Errorf("查询结果不符合预期, ip: %s, want: %v %v, got: %v %v", tt.ip, tt.want, tt.wantOk, got, ok)
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package https
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+)
+
+// HappyEyeballsDelay 双栈并发连接时, 备用协议延迟多久之后开始连接
+const HappyEyeballsDelay = time.Millisecond * 300
+
+// dialer 默认拨号器
+var dialer = &net.Dialer{Timeout: time.Second * 30, KeepAlive: time.Second * 30}
+
+// dialContext 根据 network 配置解析域名并建立连接
+//
+// 配置了自定义 dns 时使用自定义 dns 进行解析, 再按照 ip-preference 决定连接顺序
+func dialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	if config.C == nil || config.C.Network == nil {
+		return dialer.DialContext(ctx, network, addr)
+	}
+	cfg := config.C.Network
+	customDns := cfg.Dns.Enabled()
+	if !customDns && cfg.IpPreference == config.IpPreferenceAuto {
+		// 标准库的拨号器本身已经实现了 Happy Eyeballs
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil || net.ParseIP(host) != nil || isLocalHost(host) {
+		return dialer.DialContext(ctx, network, addr)
+	}
+
+	var ips []net.IP
+	if customDns {
+		ips, err = lookupIP(ctx, host)
+	} else {
+		ips, err = net.DefaultResolver.LookupIP(ctx, "ip", host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析域名失败: %s, err: %v", host, err)
+	}
+
+	v4, v6 := splitFamily(ips)
+	switch cfg.IpPreference {
+	case config.IpPreferenceV4:
+		return dialSerial(ctx, network, port, append(v4, v6...))
+	case config.IpPreferenceV6:
+		return dialSerial(ctx, network, port, append(v6, v4...))
+	}
+
+	// 与解析结果中第一个地址同协议的地址作为主连接
+	primaries, fallbacks := v4, v6
+	if len(ips) > 0 && ips[0].To4() == nil {
+		primaries, fallbacks = v6, v4
+	}
+	return dialParallel(ctx, network, port, primaries, fallbacks)
+}
+
+// splitFamily 将 ip 按照协议拆分为 ipv4 和 ipv6 两组
+func splitFamily(ips []net.IP) (v4, v6 []net.IP) {
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	return
+}
+
+// dialSerial 依次尝试连接 ips, 返回第一个成功的连接
+func dialSerial(ctx context.Context, network, port string, ips []net.IP) (net.Conn, error) {
+	if len(ips) == 0 {
+		return nil, fmt.Errorf("没有可用的地址")
+	}
+	var dialErr error
+	for _, ip := range ips {
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		dialErr = err
+	}
+	return nil, dialErr
+}
+
+// dialParallel Happy Eyeballs (RFC 8305) 的简化实现
+//
+// 先连接 primaries, 超过 HappyEyeballsDelay 仍未成功或者连接失败时,
+// 同时开始连接 fallbacks, 返回最先成功的连接
+func dialParallel(ctx context.Context, network, port string, primaries, fallbacks []net.IP) (net.Conn, error) {
+	if len(fallbacks) == 0 {
+		return dialSerial(ctx, network, port, primaries)
+	}
+	if len(primaries) == 0 {
+		return dialSerial(ctx, network, port, fallbacks)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	type result struct {
+		conn net.Conn
+		err  error
+	}
+	results := make(chan result, 2)
+	start := func(ips []net.IP) {
+		go func() {
+			conn, err := dialSerial(ctx, network, port, ips)
+			results <- result{conn: conn, err: err}
+		}()
+	}
+
+	start(primaries)
+	pending, fallbackStarted := 1, false
+	timer := time.NewTimer(HappyEyeballsDelay)
+	defer timer.Stop()
+
+	var firstErr error
+	for {
+		select {
+		case <-timer.C:
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				start(fallbacks)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				if pending > 0 {
+					// 关闭另一组较晚建立的连接
+					go func() {
+						if late := <-results; late.conn != nil {
+							late.conn.Close()
+						}
+					}()
+				}
+				return res.conn, nil
+			}
+			if firstErr == nil {
+				firstErr = res.err
+			}
+			if !fallbackStarted {
+				fallbackStarted = true
+				pending++
+				start(fallbacks)
+				continue
+			}
+			if pending == 0 {
+				return nil, firstErr
+			}
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package https
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// DnsCacheMinTTL dns 解析结果的最小缓存时间
+	DnsCacheMinTTL = time.Second * 30
+	// DnsCacheMaxTTL dns 解析结果的最大缓存时间
+	DnsCacheMaxTTL = time.Minute * 10
+)
+
+// dohClient 发起 doh 查询的客户端, 使用系统 dns 解析 doh 服务器的域名
+var dohClient = &http.Client{Timeout: time.Second * 5}
+
+// dnsCacheItem dns 解析结果缓存
+type dnsCacheItem struct {
+	ips    []net.IP
+	expire time.Time
+}
+
+var (
+	// dnsCache 域名 => 解析结果
+	dnsCache = map[string]dnsCacheItem{}
+	// dnsCacheMu 并发控制
+	dnsCacheMu sync.RWMutex
+)
+
+// lookupIP 使用自定义 dns 解析域名, 优先从缓存中获取
+func lookupIP(ctx context.Context, host string) ([]net.IP, error) {
+	dnsCacheMu.RLock()
+	item, ok := dnsCache[host]
+	dnsCacheMu.RUnlock()
+	if ok && time.Now().Before(item.expire) {
+		return item.ips, nil
+	}
+
+	cfg := config.C.Network.Dns
+	var ips []net.IP
+	var ttl time.Duration
+	var err error
+	if strs.AllNotEmpty(cfg.Doh) {
+		ips, ttl, err = lookupDoh(ctx, cfg.Doh, host)
+		if err != nil && len(cfg.Servers) > 0 {
+			log.Printf(colors.ToYellow("doh 解析失败, 尝试使用 dns 服务器解析, host: %s, err: %v"), host, err)
+		}
+	}
+	if len(ips) == 0 && len(cfg.Servers) > 0 {
+		ips, err = lookupServers(ctx, cfg.Servers, host)
+		ttl = DnsCacheMinTTL
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(ips) == 0 {
+		return nil, errors.New("没有解析到任何地址")
+	}
+
+	ttl = max(DnsCacheMinTTL, min(ttl, DnsCacheMaxTTL))
+	dnsCacheMu.Lock()
+	dnsCache[host] = dnsCacheItem{ips: ips, expire: time.Now().Add(ttl)}
+	dnsCacheMu.Unlock()
+	return ips, nil
+}
+
+// lookupServers 使用普通 dns 服务器解析域名, 依次尝试每个服务器
+func lookupServers(ctx context.Context, servers []string, host string) ([]net.IP, error) {
+	resolver := &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+			var dialErr error
+			for _, server := range servers {
+				conn, err := dialer.DialContext(ctx, network, server)
+				if err == nil {
+					return conn, nil
+				}
+				dialErr = err
+			}
+			return nil, dialErr
+		},
+	}
+	return resolver.LookupIP(ctx, "ip", host)
+}
+
+// lookupDoh 使用 DNS over HTTPS (RFC 8484) 解析域名
+//
+// 同时查询 A 和 AAAA 记录, ipv4 地址优先, 返回解析结果中最小的 TTL
+func lookupDoh(ctx context.Context, doh, host string) ([]net.IP, time.Duration, error) {
+	ips := make([]net.IP, 0)
+	var ttl time.Duration
+	var lastErr error
+	for _, qType := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		res, resTTL, err := queryDoh(ctx, doh, host, qType)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		ips = append(ips, res...)
+		if len(res) > 0 && (ttl == 0 || resTTL < ttl) {
+			ttl = resTTL
+		}
+	}
+	if len(ips) == 0 {
+		return nil, 0, lastErr
+	}
+	return ips, ttl, nil
+}
+
+// queryDoh 发起一次 doh 查询
+func queryDoh(ctx context.Context, doh, host string, qType dnsmessage.Type) ([]net.IP, time.Duration, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, 0, fmt.Errorf("非法的域名: %v", err)
+	}
+	msg := dnsmessage.Message{
+		Header:    dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: name, Type: qType, Class: dnsmessage.ClassINET}},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, 0, fmt.Errorf("构造 dns 查询失败: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, doh, bytes.NewReader(packed))
+	if err != nil {
+		return nil, 0, fmt.Errorf("创建 doh 请求失败: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := dohClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("doh 请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("doh 请求失败, 响应码: %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 65535))
+	if err != nil {
+		return nil, 0, fmt.Errorf("读取 doh 响应失败: %v", err)
+	}
+
+	var p dnsmessage.Parser
+	header, err := p.Start(body)
+	if err != nil {
+		return nil, 0, fmt.Errorf("解析 doh 响应失败: %v", err)
+	}
+	if header.RCode != dnsmessage.RCodeSuccess {
+		return nil, 0, fmt.Errorf("doh 查询失败: %v", header.RCode)
+	}
+	if err := p.SkipAllQuestions(); err != nil {
+		return nil, 0, fmt.Errorf("解析 doh 响应失败: %v", err)
+	}
+
+	ips := make([]net.IP, 0)
+	var ttl time.Duration
+	for {
+		h, err := p.AnswerHeader()
+		if err == dnsmessage.ErrSectionDone {
+			break
+		}
+		if err != nil {
+			return nil, 0, fmt.Errorf("解析 doh 响应失败: %v", err)
+		}
+
+		switch h.Type {
+		case dnsmessage.TypeA:
+			r, err := p.AResource()
+			if err != nil {
+				return nil, 0, fmt.Errorf("解析 A 记录失败: %v", err)
+			}
+			ips = append(ips, net.IP(r.A[:]))
+		case dnsmessage.TypeAAAA:
+			r, err := p.AAAAResource()
+			if err != nil {
+				return nil, 0, fmt.Errorf("解析 AAAA 记录失败: %v", err)
+			}
+			ips = append(ips, net.IP(r.AAAA[:]))
+		default:
+			// CNAME 等记录直接跳过, doh 服务器会一并返回最终的地址
+			if err := p.SkipAnswer(); err != nil {
+				return nil, 0, fmt.Errorf("解析 doh 响应失败: %v", err)
+			}
+			continue
+		}
+
+		recordTTL := time.Duration(h.TTL) * time.Second
+		if ttl == 0 || recordTTL < ttl {
+			ttl = recordTTL
+		}
+	}
+	return ips, ttl, nil
+}
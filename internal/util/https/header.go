@@ -0,0 +1,48 @@
+package https
+
+import (
+	"net/http"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+)
+
+// headerTransport 按照 network.headers 配置改写出站请求头
+//
+// 改写作用于每一次实际发出的请求, 包括自动重定向之后的请求以及失败重试的请求
+type headerTransport struct {
+	base http.RoundTripper
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if config.C == nil || config.C.Network == nil || len(config.C.Network.Headers) == 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	host := req.URL.Hostname()
+	var header http.Header
+	for _, rule := range config.C.Network.Headers {
+		if !rule.Match(host) {
+			continue
+		}
+		// RoundTripper 不允许修改传入的请求, 首次命中规则时克隆请求头
+		if header == nil {
+			header = req.Header.Clone()
+			if header == nil {
+				header = make(http.Header)
+			}
+		}
+		for key, value := range rule.Set {
+			header.Set(key, value)
+		}
+		for _, key := range rule.Del {
+			header.Del(key)
+		}
+	}
+	if header == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	newReq := req.Clone(req.Context())
+	newReq.Header = header
+	return t.base.RoundTrip(newReq)
+}
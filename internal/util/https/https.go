@@ -2,30 +2,41 @@ package https
 
 import (
 	"bytes"
+	"context"
 	"crypto/tls"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"net/url"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 var client *http.Client
 
+// GinKeyUpstreamTimings 记录单次请求过程中访问上游服务耗时的 gin key
+const GinKeyUpstreamTimings = "upstream-timings"
+
+// UpstreamTiming 单次上游请求的耗时
+type UpstreamTiming struct {
+	Name     string        // 上游名称, 如: emby, alist
+	Duration time.Duration // 耗时
+}
+
 // RedirectCodes 有重定向含义的 http 响应码
 var RedirectCodes = [4]int{http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect}
 
 func init() {
 	client = &http.Client{
-		Transport: &http.Transport{
+		Transport: &trafficTransport{base: &headerTransport{base: &limitTransport{base: &http.Transport{
+			Proxy:           proxyFunc,
+			DialContext:     dialContext,
 			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
+		}}}},
 		CheckRedirect: func(req *http.Request, via []*http.Request) error {
 			return http.ErrUseLastResponse
 		},
@@ -65,6 +76,25 @@ func ClientRequestUrl(c *gin.Context) string {
 	return fmt.Sprintf("%s%s", ClientRequestHost(c), c.Request.URL.String())
 }
 
+// RecordUpstream 记录一次上游请求的耗时到 c 中
+func RecordUpstream(c *gin.Context, name string, d time.Duration) {
+	if c == nil {
+		return
+	}
+	c.Set(GinKeyUpstreamTimings, append(UpstreamTimings(c), UpstreamTiming{Name: name, Duration: d}))
+}
+
+// UpstreamTimings 获取 c 中记录的所有上游请求耗时
+func UpstreamTimings(c *gin.Context) []UpstreamTiming {
+	if c == nil {
+		return nil
+	}
+	if timings, ok := c.Get(GinKeyUpstreamTimings); ok {
+		return timings.([]UpstreamTiming)
+	}
+	return nil
+}
+
 // IsRedirectCode 判断 http code 是否是重定向
 //
 // 301, 302, 307, 308
@@ -117,7 +147,14 @@ func CloneHeader(c *gin.Context, header http.Header) {
 
 // Request 发起 http 请求获取响应
 func Request(method, url string, header http.Header, body io.ReadCloser) (*http.Response, error) {
-	_, resp, err := RequestRedirect(method, url, header, body, false)
+	return RequestCtx(context.Background(), method, url, header, body)
+}
+
+// RequestCtx 发起 http 请求获取响应, ctx 结束时中断请求
+//
+// 处理客户端请求时应传入 c.Request.Context(), 客户端断开连接后不再继续请求上游
+func RequestCtx(ctx context.Context, method, url string, header http.Header, body io.ReadCloser) (*http.Response, error) {
+	_, resp, err := RequestRedirectCtx(ctx, method, url, header, body, false)
 	return resp, err
 }
 
@@ -126,6 +163,11 @@ func Request(method, url string, header http.Header, body io.ReadCloser) (*http.
 // 如果一个请求有多次重定向并且进行了 autoRedirect,
 // 则最后一次重定向的 url 会作为第一个参数返回
 func RequestRedirect(method, url string, header http.Header, body io.ReadCloser, autoRedirect bool) (string, *http.Response, error) {
+	return RequestRedirectCtx(context.Background(), method, url, header, body, autoRedirect)
+}
+
+// RequestRedirectCtx 与 RequestRedirect 相同, ctx 结束时中断请求
+func RequestRedirectCtx(ctx context.Context, method, url string, header http.Header, body io.ReadCloser, autoRedirect bool) (string, *http.Response, error) {
 	// 1 转换请求
 	var bodyBytes []byte
 	if body != nil {
@@ -134,14 +176,19 @@ func RequestRedirect(method, url string, header http.Header, body io.ReadCloser,
 			return "", nil, fmt.Errorf("读取请求体失败: %v", err)
 		}
 	}
-	req, err := http.NewRequest(method, url, bytes.NewBuffer(bodyBytes))
-	if err != nil {
-		return "", nil, fmt.Errorf("创建请求失败: %v", err)
+	var req *http.Request
+	newReq := func() (*http.Request, error) {
+		var err error
+		req, err = http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(bodyBytes))
+		if err != nil {
+			return nil, fmt.Errorf("创建请求失败: %v", err)
+		}
+		req.Header = header
+		return req, nil
 	}
-	req.Header = header
 
 	// 2 发出请求
-	resp, err := client.Do(req)
+	resp, err := doWithRetry(client.Do, newReq)
 	if err != nil {
 		return url, resp, err
 	}
@@ -153,71 +200,7 @@ func RequestRedirect(method, url string, header http.Header, body io.ReadCloser,
 			// 需要拼接上当前请求的前缀后再进行重定向
 			loc = fmt.Sprintf("%s://%s%s", req.URL.Scheme, req.URL.Host, loc)
 		}
-		return RequestRedirect(method, loc, header, body, autoRedirect)
+		return RequestRedirectCtx(ctx, method, loc, header, body, autoRedirect)
 	}
 	return url, resp, err
 }
-
-// ProxyRequest 代理请求
-func ProxyRequest(c *gin.Context, remote string, withUri bool) error {
-	if c == nil || remote == "" {
-		return errors.New("参数为空")
-	}
-
-	if withUri {
-		remote = remote + c.Request.URL.String()
-	}
-
-	// 1 解析远程地址
-	rmtUrl, err := url.Parse(remote)
-	if err != nil {
-		return fmt.Errorf("解析远程地址失败: %v", err)
-	}
-
-	// 2 拷贝 query 参数
-	rmtUrl.RawQuery = c.Request.URL.RawQuery
-
-	// 3 创建请求
-	var bodyBuffer io.Reader = nil
-	if c.Request.Body != nil {
-		reqBodyBytes, err := io.ReadAll(c.Request.Body)
-		if err != nil {
-			return fmt.Errorf("读取请求体失败: %v", err)
-		}
-		if len(reqBodyBytes) > 0 {
-			bodyBuffer = bytes.NewBuffer(reqBodyBytes)
-		}
-	}
-
-	req, err := http.NewRequest(c.Request.Method, rmtUrl.String(), bodyBuffer)
-	if err != nil {
-		return fmt.Errorf("初始化请求失败: %v", err)
-	}
-
-	// 4 拷贝请求头
-	req.Header = c.Request.Header
-
-	// 5 发起请求
-	resp, err := client.Do(req)
-	if err != nil {
-		return fmt.Errorf("请求失败: %v", err)
-	}
-	defer resp.Body.Close()
-
-	// 6 回写响应头
-	for key, values := range resp.Header {
-		for _, value := range values {
-			c.Header(key, value)
-		}
-	}
-
-	// 7 回写响应体
-	bodyBytes, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return fmt.Errorf("读取响应体失败: %v", err)
-	}
-	c.Status(resp.StatusCode)
-	c.Writer.Write(bodyBytes)
-	c.Writer.Flush()
-	return nil
-}
@@ -0,0 +1,85 @@
+package https
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+)
+
+// hostSemaphores 上游主机 => 并发控制信号量
+var hostSemaphores = sync.Map{}
+
+// limitTransport 按照 network.conn-limit 配置限制每个上游主机的并发连接数
+//
+// 超出限制的请求排队等待, 直到有连接释放或者等待超时
+type limitTransport struct {
+	base http.RoundTripper
+}
+
+func (t *limitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if config.C == nil || config.C.Network == nil {
+		return t.base.RoundTrip(req)
+	}
+	cfg := config.C.Network.ConnLimit
+	limit := hostLimit(cfg, strings.ToLower(req.URL.Hostname()))
+	if limit <= 0 {
+		return t.base.RoundTrip(req)
+	}
+
+	key := fmt.Sprintf("%s|%d", strings.ToLower(req.URL.Host), limit)
+	sem, _ := hostSemaphores.LoadOrStore(key, make(chan struct{}, limit))
+	ch := sem.(chan struct{})
+
+	timer := time.NewTimer(cfg.TimeoutDuration())
+	defer timer.Stop()
+	select {
+	case ch <- struct{}{}:
+	case <-req.Context().Done():
+		return nil, req.Context().Err()
+	case <-timer.C:
+		return nil, fmt.Errorf("上游主机 %s 并发连接数已达上限 %d, 排队超时", req.URL.Host, limit)
+	}
+
+	release := sync.OnceFunc(func() { <-ch })
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	// 响应体关闭之后才释放, 流式响应传输期间一直占用连接
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
+
+// releaseBody 关闭时释放信号量的响应体
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	defer b.release()
+	return b.ReadCloser.Close()
+}
+
+// hostLimit 获取 host 的最大并发连接数
+//
+// 优先使用精确匹配的配置, 多个通配符同时匹配时使用最长的规则
+func hostLimit(cfg *config.ConnLimit, host string) int {
+	if limit, ok := cfg.Hosts[host]; ok {
+		return limit
+	}
+	best, limit := "", cfg.Default
+	for pattern, l := range cfg.Hosts {
+		if ok, _ := path.Match(pattern, host); ok && len(pattern) > len(best) {
+			best, limit = pattern, l
+		}
+	}
+	return limit
+}
@@ -0,0 +1,67 @@
+package https
+
+import (
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+)
+
+// proxyFunc 根据 network.proxy 配置决定请求是否需要经过代理
+//
+// 本机以及局域网地址始终直连; emby 通常与本程序部署在同一网络中, 只有在 hosts 中显式列出时才走代理
+func proxyFunc(req *http.Request) (*url.URL, error) {
+	if config.C == nil || config.C.Network == nil || !config.C.Network.Proxy.Enabled() {
+		return nil, nil
+	}
+	cfg := config.C.Network.Proxy
+
+	host := strings.ToLower(req.URL.Hostname())
+	if isLocalHost(host) || matchAnyHost(cfg.Exclude, host) {
+		return nil, nil
+	}
+	if matchAnyHost(cfg.Hosts, host) {
+		return cfg.ProxyUrl(), nil
+	}
+	if cfg.All && !isEmbyHost(host) {
+		return cfg.ProxyUrl(), nil
+	}
+	return nil, nil
+}
+
+// isEmbyHost 判断 host 是否为 emby 的主机
+func isEmbyHost(host string) bool {
+	if config.C.Emby == nil {
+		return false
+	}
+	u, err := url.Parse(config.C.Emby.Host)
+	return err == nil && strings.EqualFold(u.Hostname(), host)
+}
+
+// matchAnyHost 判断 host 是否匹配任意一个通配符规则
+func matchAnyHost(patterns []string, host string) bool {
+	for _, pattern := range patterns {
+		if pattern == host {
+			return true
+		}
+		if ok, _ := path.Match(pattern, host); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// isLocalHost 判断 host 是否为本机或局域网地址
+func isLocalHost(host string) bool {
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	return ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast()
+}
@@ -0,0 +1,104 @@
+package https
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+)
+
+// IdempotentHeaderKey 标记请求为幂等请求的请求头
+//
+// 与标准库的约定保持一致, 值为 nil 时不会被发送到上游
+const IdempotentHeaderKey = "X-Idempotency-Key"
+
+// MarkIdempotent 将请求标记为幂等请求, 出现网络异常时允许重试
+//
+// header 为空时会创建一个新的请求头
+func MarkIdempotent(header http.Header) http.Header {
+	if header == nil {
+		header = make(http.Header)
+	}
+	header[IdempotentHeaderKey] = nil
+	return header
+}
+
+// isIdempotent 判断请求是否允许重试
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	if _, ok := req.Header[IdempotentHeaderKey]; ok {
+		return true
+	}
+	_, ok := req.Header["Idempotency-Key"]
+	return ok
+}
+
+// retryTransport 为反向代理提供失败重试能力的 RoundTripper
+type retryTransport struct {
+	base http.RoundTripper
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// 请求体无法重复读取时, 不进行重试
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return t.base.RoundTrip(req)
+	}
+
+	first := true
+	newReq := func() (*http.Request, error) {
+		if first {
+			first = false
+			return req, nil
+		}
+		clone := req.Clone(req.Context())
+		if req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			clone.Body = body
+		}
+		return clone, nil
+	}
+	return doWithRetry(t.base.RoundTrip, newReq)
+}
+
+// doWithRetry 使用 do 发起请求, 幂等请求出现网络异常时按照 network.retry 配置进行重试
+//
+// 每次重试都会调用 newReq 重新构造请求, 保证请求体可以被重复读取
+func doWithRetry(do func(*http.Request) (*http.Response, error), newReq func() (*http.Request, error)) (*http.Response, error) {
+	req, err := newReq()
+	if err != nil {
+		return nil, err
+	}
+	resp, err := do(req)
+	if err == nil || !isIdempotent(req) || errors.Is(err, context.Canceled) {
+		return resp, err
+	}
+
+	if config.C == nil || config.C.Network == nil {
+		return resp, err
+	}
+	cfg := config.C.Network.Retry
+	for i := 1; i <= cfg.MaxRetries() && err != nil; i++ {
+		log.Printf(colors.ToYellow("上游请求失败, %v 后进行第 %d 次重试, method: %s, url: %s, err: %v"), cfg.IntervalDuration(), i, req.Method, req.URL, err)
+		// 请求被取消 (如客户端断开连接) 时不再重试
+		select {
+		case <-req.Context().Done():
+			return resp, err
+		case <-time.After(cfg.IntervalDuration()):
+		}
+		if req, err = newReq(); err != nil {
+			return nil, err
+		}
+		resp, err = do(req)
+	}
+	return resp, err
+}
@@ -0,0 +1,194 @@
+package https
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForwardedHeaders 反向代理时需要原样透传的转发相关请求头
+var ForwardedHeaders = []string{"Forwarded", "X-Forwarded-For", "X-Forwarded-Host", "X-Forwarded-Proto"}
+
+// ResponseHook 响应改写钩子, 在响应回写到客户端之前调用
+//
+// 钩子中读取响应体会导致整个响应被缓冲, 只有确实需要改写响应体的处理器才使用
+type ResponseHook func(resp *http.Response) error
+
+// ProxyRequest 代理请求, 响应以流式的方式回写到客户端
+func ProxyRequest(c *gin.Context, remote string, withUri bool) error {
+	return ProxyRequestWithHook(c, remote, withUri, nil)
+}
+
+// ProxyRequestWithHook 代理请求, 响应回写到客户端之前先经过 hook 处理
+//
+// hook 为空时与 ProxyRequest 相同, 客户端主动断开连接不视为异常
+func ProxyRequestWithHook(c *gin.Context, remote string, withUri bool, hook ResponseHook) (err error) {
+	if c == nil || remote == "" {
+		return errors.New("参数为空")
+	}
+
+	if withUri {
+		remote = remote + c.Request.URL.String()
+	}
+
+	// 1 解析远程地址
+	rmtUrl, err := url.Parse(remote)
+	if err != nil {
+		return fmt.Errorf("解析远程地址失败: %v", err)
+	}
+
+	// 2 拷贝 query 参数
+	rmtUrl.RawQuery = c.Request.URL.RawQuery
+
+	// 3 缓冲请求体, 使请求在失败重试时可以被重复读取
+	if c.Request.Body != nil && c.Request.Body != http.NoBody {
+		bodyBytes, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			return fmt.Errorf("读取请求体失败: %v", err)
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(bodyBytes))
+		c.Request.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(bodyBytes)), nil
+		}
+		c.Request.ContentLength = int64(len(bodyBytes))
+	}
+
+	// 4 构造反向代理
+	start := time.Now()
+	var proxyErr error
+	proxy := &httputil.ReverseProxy{
+		Transport:     &retryTransport{base: client.Transport},
+		FlushInterval: time.Millisecond * 100,
+		Rewrite: func(pr *httputil.ProxyRequest) {
+			pr.Out.URL = rmtUrl
+			pr.Out.Host = ""
+			// 保持与客户端请求一致, 不追加代理自身的转发信息
+			for _, key := range ForwardedHeaders {
+				if values, ok := pr.In.Header[key]; ok {
+					pr.Out.Header[key] = values
+				}
+			}
+			if hook != nil {
+				// 需要改写响应体时, 由 Transport 负责解压, 钩子拿到的都是原始内容
+				pr.Out.Header.Del("Accept-Encoding")
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			RecordUpstream(c, "origin", time.Since(start))
+			if hook == nil {
+				return nil
+			}
+			return hook(resp)
+		},
+		ErrorHandler: func(_ http.ResponseWriter, _ *http.Request, err error) {
+			proxyErr = err
+		},
+	}
+
+	// 5 响应体传输过程中出现异常时, ReverseProxy 会以 http.ErrAbortHandler 中断处理
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		if r != http.ErrAbortHandler {
+			panic(r)
+		}
+		if c.Request.Context().Err() == nil {
+			err = errors.New("响应体传输中断")
+		}
+	}()
+
+	// 6 发起请求并回写响应
+	proxy.ServeHTTP(c.Writer, c.Request)
+	if proxyErr != nil && !errors.Is(proxyErr, context.Canceled) {
+		return fmt.Errorf("请求失败: %v", proxyErr)
+	}
+	return nil
+}
+
+// JsonHook 将 json 响应体解析为 jsons.Item, 交由 modify 改写后重新写回响应
+//
+// 只对响应码为 200 的 json 响应生效, 其余响应原样透传
+func JsonHook(modify func(body *jsons.Item) error) ResponseHook {
+	return func(resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+			return nil
+		}
+
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("读取响应体失败: %v", err)
+		}
+		item, err := jsons.New(string(bodyBytes))
+		if err != nil {
+			return fmt.Errorf("解析响应体失败: %v", err)
+		}
+		if err := modify(item); err != nil {
+			return err
+		}
+
+		setResponseBody(resp, []byte(item.String()))
+		return nil
+	}
+}
+
+// JsonStringHook 使用 patcher 改写 json 响应中的字符串值, 返回改写的个数给 done
+//
+// 开启 emby.json-patch 时直接替换原始响应的字节, 原始响应格式异常或者未开启时, 回退为完整解析和序列化;
+// 只对响应码为 200 的 json 响应生效, 其余响应原样透传
+func JsonStringHook(patcher jsons.StringPatcher, done func(cnt int)) ResponseHook {
+	return func(resp *http.Response) error {
+		if resp.StatusCode != http.StatusOK || !strings.Contains(resp.Header.Get("Content-Type"), "json") {
+			return nil
+		}
+
+		bodyBytes, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("读取响应体失败: %v", err)
+		}
+
+		if config.C != nil && config.C.Emby != nil && config.C.Emby.JsonPatch {
+			newBody, cnt, err := jsons.PatchStrings(bodyBytes, patcher)
+			if err == nil {
+				setResponseBody(resp, newBody)
+				done(cnt)
+				return nil
+			}
+			logs.Debugf("字节级别改写 json 响应失败, 回退为完整解析: %v", err)
+		}
+
+		item, err := jsons.New(string(bodyBytes))
+		if err != nil {
+			return fmt.Errorf("解析响应体失败: %v", err)
+		}
+		cnt := item.ReplaceStrings(patcher)
+		setResponseBody(resp, []byte(item.String()))
+		done(cnt)
+		return nil
+	}
+}
+
+// setResponseBody 替换响应体, 同步修改响应长度
+func setResponseBody(resp *http.Response, body []byte) {
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	resp.ContentLength = int64(len(body))
+	resp.Header.Set("Content-Length", strconv.Itoa(len(body)))
+	resp.Header.Del("Content-Encoding")
+}
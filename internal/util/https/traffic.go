@@ -0,0 +1,93 @@
+package https
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// trafficReportSize 累计读取多少字节后上报一次流量, 长时间的串流不必等到结束才能统计
+const trafficReportSize = 1024 * 1024
+
+// TrafficTag 出站请求的流量归属, 记录在请求上下文中
+type TrafficTag struct {
+	User   func() string // 用户标识, 上报流量时才获取
+	ItemId string        // 请求的 item id
+}
+
+// TrafficRecorder 记录从上游读取的流量
+type TrafficRecorder func(host, user, itemId string, bytes int64)
+
+// trafficTagKey 流量归属在请求上下文中的 key
+type trafficTagKey struct{}
+
+// trafficRecorder 流量记录函数, 由调用方注入, 避免与统计模块相互依赖
+var trafficRecorder atomic.Pointer[TrafficRecorder]
+
+// SetTrafficRecorder 设置流量记录函数
+func SetTrafficRecorder(recorder TrafficRecorder) {
+	trafficRecorder.Store(&recorder)
+}
+
+// WithTrafficTag 在上下文中记录流量归属, 使用该上下文发出的请求读取的流量都归属于 tag
+func WithTrafficTag(ctx context.Context, tag TrafficTag) context.Context {
+	user := tag.User
+	if user != nil {
+		tag.User = sync.OnceValue(user)
+	}
+	return context.WithValue(ctx, trafficTagKey{}, tag)
+}
+
+// trafficTransport 统计从每个上游主机读取的响应体字节数
+type trafficTransport struct {
+	base http.RoundTripper
+}
+
+func (t *trafficTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	recorder := trafficRecorder.Load()
+	if err != nil || recorder == nil || resp.Body == nil || resp.Body == http.NoBody {
+		return resp, err
+	}
+
+	host := strings.ToLower(req.URL.Host)
+	tag, _ := req.Context().Value(trafficTagKey{}).(TrafficTag)
+	resp.Body = &countingBody{ReadCloser: resp.Body, report: func(n int64) {
+		user := ""
+		if tag.User != nil {
+			user = tag.User()
+		}
+		(*recorder)(host, user, tag.ItemId, n)
+	}}
+	return resp, nil
+}
+
+// countingBody 统计读取字节数的响应体, 每读取 trafficReportSize 字节以及关闭时上报一次
+type countingBody struct {
+	io.ReadCloser
+	report  func(n int64)
+	pending atomic.Int64
+}
+
+func (b *countingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if b.pending.Add(int64(n)) >= trafficReportSize || err != nil {
+		b.flush()
+	}
+	return n, err
+}
+
+func (b *countingBody) Close() error {
+	b.flush()
+	return b.ReadCloser.Close()
+}
+
+// flush 上报累计的字节数
+func (b *countingBody) flush() {
+	if n := b.pending.Swap(0); n > 0 {
+		b.report(n)
+	}
+}
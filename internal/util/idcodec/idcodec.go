@@ -0,0 +1,104 @@
+// 可逆的 id 混淆, 用于隐藏对外分享的链接中的 emby item id
+//
+// 内置基于 aes 的混淆器, 下游分支可以在 init 函数中通过 Register 注册自定义的混淆器
+package idcodec
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// Codec 可逆的 id 混淆器
+type Codec interface {
+	// Encode 混淆 id
+	Encode(id string) (string, error)
+	// Decode 还原被混淆的 id, 不是由当前混淆器生成的字符串需要返回异常
+	Decode(s string) (string, error)
+}
+
+// Factory 根据密钥创建混淆器
+type Factory func(key string) (Codec, error)
+
+// CodecAes 内置的 aes 混淆器名称
+const CodecAes = "aes"
+
+var (
+	// factories 已注册的混淆器
+	factories = map[string]Factory{CodecAes: newAesCodec}
+	// factoriesMu 并发控制
+	factoriesMu sync.RWMutex
+)
+
+// Register 注册混淆器, 名称重复时 panic
+func Register(name string, f Factory) {
+	if name == "" || f == nil {
+		panic("idcodec: 混淆器名称和工厂函数不能为空")
+	}
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	if _, ok := factories[name]; ok {
+		panic(fmt.Sprintf("idcodec: 混淆器重复注册: %s", name))
+	}
+	factories[name] = f
+}
+
+// New 使用密钥创建指定名称的混淆器
+func New(name, key string) (Codec, error) {
+	factoriesMu.RLock()
+	f, ok := factories[name]
+	factoriesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("不支持的混淆器: %s", name)
+	}
+	return f(key)
+}
+
+// aesCodec 使用 aes 加密数字 id, 生成 22 个字符的 url 安全字符串
+//
+// 明文的前 8 个字节为 id, 后 8 个字节为 0, 解密之后用于校验字符串是否被篡改
+type aesCodec struct {
+	block cipher.Block
+}
+
+// newAesCodec 创建 aes 混淆器, 密钥经过 sha256 摘要之后使用
+func newAesCodec(key string) (Codec, error) {
+	if key == "" {
+		return nil, errors.New("密钥不能为空")
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return &aesCodec{block: block}, nil
+}
+
+func (ac *aesCodec) Encode(id string) (string, error) {
+	num, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return "", fmt.Errorf("只支持混淆数字 id: %s", id)
+	}
+	buf := make([]byte, aes.BlockSize)
+	binary.BigEndian.PutUint64(buf, num)
+	ac.block.Encrypt(buf, buf)
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func (ac *aesCodec) Decode(s string) (string, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(buf) != aes.BlockSize {
+		return "", fmt.Errorf("无效的 id: %s", s)
+	}
+	ac.block.Decrypt(buf, buf)
+	if binary.BigEndian.Uint64(buf[8:]) != 0 {
+		return "", fmt.Errorf("无效的 id: %s", s)
+	}
+	return strconv.FormatUint(binary.BigEndian.Uint64(buf), 10), nil
+}
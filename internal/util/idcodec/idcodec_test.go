@@ -0,0 +1,41 @@
+package idcodec_test
+
+import (
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/idcodec"
+)
+
+func TestAesCodec(t *testing.T) {
+	codec, err := idcodec.New(idcodec.CodecAes, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []string{"0", "1001", "18446744073709551615"} {
+		encoded, err := codec.Encode(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if encoded == id || len(encoded) != 22 {
+			t.Errorf("混淆结果不符合预期, id: %s, encoded: %s", id, encoded)
+		}
+		decoded, err := codec.Decode(encoded)
+		if err != nil || decoded != id {
+			t.Errorf("还原结果不符合预期, id: %s, decoded: %s, err: %v", id, decoded, err)
+		}
+	}
+
+	other, _ := idcodec.New(idcodec.CodecAes, "other")
+	encoded, _ := codec.Encode("1001")
+	if _, err := other.Decode(encoded); err == nil {
+		t.Error("使用不同密钥还原时应该失败")
+	}
+	for _, invalid := range []string{"1001", "", "not-a-valid-id!"} {
+		if _, err := codec.Decode(invalid); err == nil {
+			t.Errorf("无效的 id 应该还原失败: %s", invalid)
+		}
+	}
+	if _, err := codec.Encode("abc"); err == nil {
+		t.Error("非数字 id 应该混淆失败")
+	}
+}
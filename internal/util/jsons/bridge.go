@@ -0,0 +1,34 @@
+package jsons
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// To 将 item 转换为指定类型的对象, v 必须是指针
+//
+// 转换规则与标准库 encoding/json 保持一致, 结构体可以通过 json tag 指定属性名称
+func (i *Item) To(v interface{}) error {
+	bytes, err := json.Marshal(i.Struct())
+	if err != nil {
+		return fmt.Errorf("序列化 item 失败: %v", err)
+	}
+	if err := json.Unmarshal(bytes, v); err != nil {
+		return fmt.Errorf("转换 item 失败: %v", err)
+	}
+	return nil
+}
+
+// FromStruct 将任意对象转换为 item
+//
+// 与 NewByObj 不同, 这里会遵循结构体的 json tag 以及 omitempty 等规则
+func FromStruct(v interface{}) (*Item, error) {
+	if item, ok := v.(*Item); ok {
+		return item, nil
+	}
+	bytes, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("序列化对象失败: %v", err)
+	}
+	return New(string(bytes))
+}
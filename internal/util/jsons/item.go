@@ -27,6 +27,9 @@ type Item struct {
 	// obj 对象值
 	obj map[string]*Item
 
+	// keys 对象属性的顺序, 与原始 json 或者属性的插入顺序保持一致
+	keys []string
+
 	// arr 数组值
 	arr []*Item
 
@@ -49,23 +52,37 @@ func (i *Item) Put(key string, value *Item) {
 	}
 	i.mu.Lock()
 	defer i.mu.Unlock()
+	if _, ok := i.obj[key]; !ok {
+		i.keys = append(i.keys, key)
+	}
 	i.obj[key] = value
 }
 
+// Keys 按顺序获取对象的所有属性名
+func (i *Item) Keys() []string {
+	if i.jType != JsonTypeObj {
+		return nil
+	}
+	return append(([]string)(nil), i.keys...)
+}
+
 // Attr 获取对象属性的某个 key 值
 func (i *Item) Attr(key string) *TempItem {
 	ti := &TempItem{item: i}
 	return ti.Attr(key)
 }
 
-// RangeObj 遍历对象
+// RangeObj 按属性顺序遍历对象
 func (i *Item) RangeObj(callback func(key string, value *Item) error) error {
 	if i.jType != JsonTypeObj {
 		return nil
 	}
-	for k, v := range i.obj {
-		ck, cv := k, v
-		if err := callback(ck, cv); err == ErrBreakRange {
+	for _, k := range i.Keys() {
+		v, ok := i.obj[k]
+		if !ok {
+			continue
+		}
+		if err := callback(k, v); err == ErrBreakRange {
 			return nil
 		} else if err != nil {
 			return err
@@ -81,7 +98,16 @@ func (i *Item) DelKey(key string) {
 	}
 	i.mu.Lock()
 	defer i.mu.Unlock()
+	if _, ok := i.obj[key]; !ok {
+		return
+	}
 	delete(i.obj, key)
+	for idx, k := range i.keys {
+		if k == key {
+			i.keys = append(i.keys[:idx], i.keys[idx+1:]...)
+			break
+		}
+	}
 }
 
 // Append arr 添加属性
@@ -237,3 +263,24 @@ func (i *Item) Empty() bool {
 func (i *Item) Ti() *TempItem {
 	return &TempItem{item: i}
 }
+
+// Clone 深拷贝当前对象, 保留对象属性的顺序
+func (i *Item) Clone() *Item {
+	switch i.jType {
+	case JsonTypeObj:
+		res := NewEmptyObj()
+		i.RangeObj(func(key string, value *Item) error {
+			res.Put(key, value.Clone())
+			return nil
+		})
+		return res
+	case JsonTypeArr:
+		res := &Item{arr: make([]*Item, len(i.arr)), jType: JsonTypeArr}
+		for idx, value := range i.arr {
+			res.arr[idx] = value.Clone()
+		}
+		return res
+	default:
+		return &Item{val: i.val, jType: JsonTypeVal}
+	}
+}
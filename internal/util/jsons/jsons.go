@@ -3,7 +3,9 @@ package jsons
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"reflect"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -40,16 +42,20 @@ func NewByObj(obj interface{}) *Item {
 		return NewByVal(obj)
 	}
 
-	item := NewEmptyObj()
+	// 先并发转换属性值, 再按顺序放入对象中, 保证属性顺序稳定
+	var keys []string
+	var values []*Item
 	wg := sync.WaitGroup{}
 	if v.Kind() == reflect.Struct {
+		keys = make([]string, v.NumField())
+		values = make([]*Item, v.NumField())
 		for i := 0; i < v.NumField(); i++ {
-			fieldVal := v.Field(i)
-			fieldType := v.Type().Field(i)
+			ci := i
+			keys[ci] = v.Type().Field(ci).Name
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				item.Put(fieldType.Name, NewByVal(fieldVal.Interface()))
+				values[ci] = NewByVal(v.Field(ci).Interface())
 			}()
 		}
 	}
@@ -58,17 +64,27 @@ func NewByObj(obj interface{}) *Item {
 		if v.Type().Key() != reflect.TypeOf("") {
 			panic("不支持的 map 类型")
 		}
+		// map 本身是无序的, 按照 key 排序
 		for _, key := range v.MapKeys() {
-			ck := key
+			keys = append(keys, key.Interface().(string))
+		}
+		sort.Strings(keys)
+		values = make([]*Item, len(keys))
+		for i := range keys {
+			ci := i
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
-				item.Put(ck.Interface().(string), NewByVal(v.MapIndex(ck).Interface()))
+				values[ci] = NewByVal(v.MapIndex(reflect.ValueOf(keys[ci])).Interface())
 			}()
 		}
 	}
 
 	wg.Wait()
+	item := NewEmptyObj()
+	for i, key := range keys {
+		item.Put(key, values[i])
+	}
 	return item
 }
 
@@ -155,16 +171,16 @@ func New(rawJson string) (*Item, error) {
 	}
 
 	if strings.HasPrefix(rawJson, "{") {
-		var data map[string]json.RawMessage
-		if err := json.Unmarshal([]byte(rawJson), &data); err != nil {
+		keys, data, err := splitObj(rawJson)
+		if err != nil {
 			return nil, err
 		}
 
-		item := NewEmptyObj()
+		values := make([]*Item, len(data))
 		wg := sync.WaitGroup{}
 		var handleErr error
-		for key, value := range data {
-			ck, cv := key, value
+		for idx, value := range data {
+			ci, cv := idx, value
 			wg.Add(1)
 			go func() {
 				defer wg.Done()
@@ -173,7 +189,7 @@ func New(rawJson string) (*Item, error) {
 					handleErr = err
 					return
 				}
-				item.Put(ck, subI)
+				values[ci] = subI
 			}()
 		}
 		wg.Wait()
@@ -181,6 +197,10 @@ func New(rawJson string) (*Item, error) {
 		if handleErr != nil {
 			return nil, handleErr
 		}
+		item := NewEmptyObj()
+		for idx, key := range keys {
+			item.Put(key, values[idx])
+		}
 		return item, nil
 	}
 
@@ -234,3 +254,37 @@ func New(rawJson string) (*Item, error) {
 
 	return nil, fmt.Errorf("不支持的字符串: %s", rawJson)
 }
+
+// splitObj 按原始顺序拆分 json 对象中的所有属性名和属性值
+func splitObj(rawJson string) ([]string, []json.RawMessage, error) {
+	dec := json.NewDecoder(strings.NewReader(rawJson))
+	if tk, err := dec.Token(); err != nil || tk != json.Delim('{') {
+		return nil, nil, fmt.Errorf("非法的 json 对象: %s", rawJson)
+	}
+
+	keys, values := make([]string, 0), make([]json.RawMessage, 0)
+	for dec.More() {
+		tk, err := dec.Token()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, ok := tk.(string)
+		if !ok {
+			return nil, nil, fmt.Errorf("非法的 json 属性名: %v", tk)
+		}
+		var value json.RawMessage
+		if err := dec.Decode(&value); err != nil {
+			return nil, nil, err
+		}
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	if tk, err := dec.Token(); err != nil || tk != json.Delim('}') {
+		return nil, nil, fmt.Errorf("非法的 json 对象: %s", rawJson)
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, nil, fmt.Errorf("json 对象后存在多余的内容: %s", rawJson)
+	}
+	return keys, values, nil
+}
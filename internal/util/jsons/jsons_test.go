@@ -1,8 +1,10 @@
 package jsons_test
 
 import (
+	"encoding/json"
 	"log"
 	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
@@ -47,3 +49,167 @@ func TestMap(t *testing.T) {
 	res := item.Map(func(val *jsons.Item) interface{} { return "😄" + strconv.Itoa(val.Ti().Val().(int)) })
 	log.Println("转换完成后的数组: ", res)
 }
+
+func TestQuery(t *testing.T) {
+	item, err := jsons.New(`{"MediaSources":[{"Id":"a","MediaStreams":[{"Type":"Video","Index":0},{"Type":"Subtitle","Index":1,"Language":"chi"},{"Type":"Subtitle","Index":2,"Language":"eng"}]},{"Id":"b","MediaStreams":[{"Type":"Audio","Index":0}]}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	subs, err := item.Query("$.MediaSources[*].MediaStreams[?(@.Type=='Subtitle')]")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(subs) != 2 {
+		t.Fatalf("查询结果个数不符合预期, want: 2, got: %d", len(subs))
+	}
+
+	eng, ok := item.QueryOne(`$['MediaSources'][0].MediaStreams[?(@.Type=="Subtitle" && (@.Index>1 || @.Language=='chi') && !@.IsDefault)].Language`)
+	if lang, _ := eng.Ti().String(); !ok || lang != "chi" {
+		t.Fatalf("查询结果不符合预期, got: %v", eng)
+	}
+
+	last, ok := item.QueryOne("$.MediaSources[-1].Id")
+	if id, _ := last.Ti().String(); !ok || id != "b" {
+		t.Fatalf("负数索引查询结果不符合预期, got: %v", last)
+	}
+
+	cnt, err := item.QuerySet("$.MediaSources[*].Id", jsons.NewByVal("x"))
+	if err != nil || cnt != 2 {
+		t.Fatalf("批量设置失败, cnt: %d, err: %v", cnt, err)
+	}
+	if id, _ := item.Attr("MediaSources").Idx(1).Attr("Id").String(); id != "x" {
+		t.Fatalf("批量设置结果不符合预期, got: %s", id)
+	}
+
+	// 每个匹配项需要是独立的对象, 修改其中一处不影响其他位置
+	shared, _ := jsons.New(`{"A":{"Id":1},"B":{"Id":2}}`)
+	if cnt, err := shared.QuerySet("$.*.Id", jsons.NewEmptyObj()); err != nil || cnt != 2 {
+		t.Fatalf("批量设置失败, cnt: %d, err: %v", cnt, err)
+	}
+	first, _ := shared.QueryOne("$.A.Id")
+	first.Put("Changed", jsons.NewByVal(true))
+	if _, ok := shared.QueryOne("$.B.Id.Changed"); ok {
+		t.Fatal("批量设置的值在多个匹配项之间共享")
+	}
+
+	cnt, err = item.QueryDel("$.MediaSources[*].MediaStreams[?(@.Type=='Subtitle')]")
+	if err != nil || cnt != 2 {
+		t.Fatalf("批量删除失败, cnt: %d, err: %v", cnt, err)
+	}
+	if streams, _ := item.Attr("MediaSources").Idx(0).Attr("MediaStreams").Done(); streams.Len() != 1 {
+		t.Fatalf("批量删除结果不符合预期, got: %v", streams)
+	}
+
+	for _, invalid := range []string{"MediaSources", "$.", "$[?(@.Type==)]", "$[abc]", "$[0",
+		"$.a[?(@.b = 1)]", "$.a[?(@.b == 1 & @.c == 2)]", "$.a[?(@.b == 1 | @.c == 2)]"} {
+		if _, err := item.Query(invalid); err == nil {
+			t.Errorf("非法表达式未返回错误: %s", invalid)
+		}
+	}
+}
+
+func TestBridge(t *testing.T) {
+	type stream struct {
+		Type  string
+		Index int
+		Title string `json:",omitempty"`
+	}
+	type source struct {
+		Id           string `json:"Id"`
+		Size         int64
+		MediaStreams []stream
+	}
+
+	item, err := jsons.New(`{"Id":"a\"b","Size":1297828216,"Unknown":true,"MediaStreams":[{"Type":"Video","Index":0},{"Type":"Subtitle","Index":1,"Title":"中文"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var s source
+	if err := item.To(&s); err != nil {
+		t.Fatal(err)
+	}
+	if s.Id != `a"b` || s.Size != 1297828216 || len(s.MediaStreams) != 2 || s.MediaStreams[1].Title != "中文" {
+		t.Fatalf("转换结果不符合预期: %+v", s)
+	}
+
+	back, err := jsons.FromStruct(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := back.Attr("MediaStreams").Idx(0).Attr("Title").Done(); ok {
+		t.Fatal("omitempty 属性不应该被序列化")
+	}
+	if title, _ := back.Attr("MediaStreams").Idx(1).Attr("Title").String(); title != "中文" {
+		t.Fatalf("反向转换结果不符合预期: %v", back)
+	}
+
+	if err := item.To(&struct{ Id int }{}); err == nil {
+		t.Fatal("类型不匹配时应该返回错误")
+	}
+}
+
+func TestKeyOrder(t *testing.T) {
+	raw := `{"Name":"a \"quoted\" <name>","Id":"1","MediaSources":[{"Path":"/a/b.mp4","Container":"mp4","Bitrate":2270287}],"Empty":{},"Null":null,"Bool":false}`
+	item, err := jsons.New(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if got := item.String(); got != raw {
+			t.Fatalf("序列化结果与原始顺序不一致\nwant: %s\ngot:  %s", raw, got)
+		}
+	}
+
+	item.Put("Added", jsons.NewByVal(1))
+	item.DelKey("Id")
+	item.Put("Name", jsons.NewByVal("b"))
+	want := `{"Name":"b","MediaSources":[{"Path":"/a/b.mp4","Container":"mp4","Bitrate":2270287}],"Empty":{},"Null":null,"Bool":false,"Added":1}`
+	if got := item.Clone().String(); got != want {
+		t.Fatalf("修改后的序列化结果不符合预期\nwant: %s\ngot:  %s", want, got)
+	}
+
+	bytes, err := json.Marshal(map[string]interface{}{"Data": item})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(bytes); got != `{"Data":`+want+`}` {
+		t.Fatalf("MarshalJSON 结果不符合预期, got: %s", got)
+	}
+}
+
+func TestPatchStrings(t *testing.T) {
+	raw := `{"Items":[{"Name":"a \"quoted\" name","ImageUrl":"http://img/1.jpg","Tags":["http://img/2.jpg", "x"],"Child":{"ImageUrl":"http://img/3.jpg"}}],"Total":1}`
+	patcher := func(key, val string) (string, bool) {
+		if strings.HasPrefix(val, "http://img/") {
+			return key + ":" + strings.TrimPrefix(val, "http://img/"), true
+		}
+		if val == `a "quoted" name` {
+			return "<b>", true
+		}
+		return "", false
+	}
+
+	patched, cnt, err := jsons.PatchStrings([]byte(raw), patcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{"Items":[{"Name":"<b>","ImageUrl":"ImageUrl:1.jpg","Tags":["Tags:2.jpg", "x"],"Child":{"ImageUrl":"ImageUrl:3.jpg"}}],"Total":1}`
+	if cnt != 4 || string(patched) != want {
+		t.Fatalf("字节替换结果不符合预期, cnt: %d\nwant: %s\ngot:  %s", cnt, want, patched)
+	}
+
+	// 与完整解析之后的替换结果保持一致
+	item, err := jsons.New(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cnt := item.ReplaceStrings(patcher); cnt != 4 || item.String() != strings.ReplaceAll(want, ", ", ",") {
+		t.Fatalf("完整解析的替换结果不符合预期, cnt: %d, got: %s", cnt, item.String())
+	}
+
+	if _, _, err := jsons.PatchStrings([]byte(`{"a":"b`), patcher); err == nil {
+		t.Fatal("格式异常的 json 应该返回错误")
+	}
+}
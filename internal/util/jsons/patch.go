@@ -0,0 +1,145 @@
+package jsons
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// StringPatcher 字符串值的改写函数
+//
+// key 为值所属的字段名, 数组中的值为数组所属的字段名, 根节点为空字符串;
+// 返回新值和 true 表示需要替换, 返回 false 表示保持原值
+type StringPatcher func(key, val string) (string, bool)
+
+// ErrPatchSyntax 原始 json 格式异常, 无法进行字节级别的替换
+var ErrPatchSyntax = errors.New("json 格式异常")
+
+// PatchStrings 直接在原始 json 字节上替换字符串值, 不完整解析和序列化整个 json
+//
+// 只替换被 patcher 修改的字符串, 其余字节原样保留, 适用于大响应中只改写少量字段的场景;
+// 返回替换之后的 json 和替换的个数, 没有发生替换时返回原始字节
+func PatchStrings(data []byte, patcher StringPatcher) ([]byte, int, error) {
+	var (
+		out  *bytes.Buffer
+		last int // data 中还未写入 out 的起始位置
+		cnt  int
+		key  string
+		// stack 当前所处的容器, 数组记录所属的字段名, 对象记录为 nil
+		stack []*string
+	)
+	for i := 0; i < len(data); i++ {
+		switch data[i] {
+		case '{':
+			stack = append(stack, nil)
+		case '[':
+			arrKey := key
+			stack = append(stack, &arrKey)
+		case '}', ']':
+			if len(stack) == 0 {
+				return nil, 0, ErrPatchSyntax
+			}
+			stack = stack[:len(stack)-1]
+		case '"':
+			end, escaped := scanString(data, i)
+			if end < 0 {
+				return nil, 0, ErrPatchSyntax
+			}
+			raw := data[i : end+1]
+			val := string(raw[1 : len(raw)-1])
+			if escaped {
+				if err := json.Unmarshal(raw, &val); err != nil {
+					return nil, 0, ErrPatchSyntax
+				}
+			}
+
+			// 字符串之后紧跟冒号的是对象的字段名
+			next := end + 1
+			for next < len(data) && isSpace(data[next]) {
+				next++
+			}
+			if next < len(data) && data[next] == ':' {
+				key = val
+				i = end
+				continue
+			}
+
+			valKey := key
+			if len(stack) > 0 && stack[len(stack)-1] != nil {
+				valKey = *stack[len(stack)-1]
+			}
+			if newVal, ok := patcher(valKey, val); ok {
+				if out == nil {
+					out = bytes.NewBuffer(make([]byte, 0, len(data)+64))
+				}
+				out.Write(data[last:i])
+				out.WriteString(quote(newVal))
+				last = end + 1
+				cnt++
+			}
+			i = end
+		}
+	}
+	if len(stack) != 0 {
+		return nil, 0, ErrPatchSyntax
+	}
+	if out == nil {
+		return data, 0, nil
+	}
+	out.Write(data[last:])
+	return out.Bytes(), cnt, nil
+}
+
+// ReplaceStrings 递归替换 item 中的字符串值, 与 PatchStrings 的替换规则一致, 返回替换的个数
+func (i *Item) ReplaceStrings(patcher StringPatcher) int {
+	return i.replaceStrings("", patcher)
+}
+
+// replaceStrings 递归替换字符串值, key 为 item 所属的字段名
+func (i *Item) replaceStrings(key string, patcher StringPatcher) int {
+	cnt := 0
+	switch i.jType {
+	case JsonTypeVal:
+		val, ok := i.val.(string)
+		if !ok {
+			return 0
+		}
+		if newVal, ok := patcher(key, val); ok {
+			i.val = newVal
+			cnt++
+		}
+	case JsonTypeObj:
+		i.RangeObj(func(k string, value *Item) error {
+			cnt += value.replaceStrings(k, patcher)
+			return nil
+		})
+	case JsonTypeArr:
+		i.RangeArr(func(_ int, value *Item) error {
+			cnt += value.replaceStrings(key, patcher)
+			return nil
+		})
+	}
+	return cnt
+}
+
+// scanString 从 start 位置的引号开始查找字符串的结束引号, 返回结束引号的位置以及字符串中是否包含转义字符
+//
+// 找不到结束引号时返回 -1
+func scanString(data []byte, start int) (int, bool) {
+	escaped := false
+	for i := start + 1; i < len(data); i++ {
+		switch data[i] {
+		case '\\':
+			escaped = true
+			i++
+		case '"':
+			return i, escaped
+		}
+	}
+	return -1, escaped
+}
+
+// isSpace 判断是否为 json 中的空白字符
+func isSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\n' || b == '\r'
+}
@@ -0,0 +1,311 @@
+package jsons
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Query 使用 JSONPath 风格的表达式查询 item 中的所有匹配项
+//
+// 支持的语法:
+//
+//	$                 根节点
+//	.Key / ['Key']    对象属性
+//	[0] / [-1]        数组索引, 负数表示从末尾开始计算
+//	.* / [*]          对象或数组的所有子项
+//	[?(表达式)]        过滤数组或对象的子项, 如: [?(@.Type=='Subtitle' && @.Index>2)]
+//
+// 过滤表达式中支持 ==, !=, >, >=, <, <= 比较运算以及 &&, ||, () 组合,
+// 单独的 @.Key 表示判断属性是否存在
+func (i *Item) Query(path string) ([]*Item, error) {
+	matches, err := i.query(path)
+	if err != nil {
+		return nil, err
+	}
+	res := make([]*Item, len(matches))
+	for idx, m := range matches {
+		res[idx] = m.item
+	}
+	return res, nil
+}
+
+// QueryOne 查询第一个匹配项, 查询不到时返回 false
+func (i *Item) QueryOne(path string) (*Item, bool) {
+	res, err := i.Query(path)
+	if err != nil || len(res) == 0 {
+		return nil, false
+	}
+	return res[0], true
+}
+
+// QuerySet 将所有匹配项替换为 value, 返回被替换的个数
+//
+// 根节点无法被替换; 第一个匹配项使用 value 本身, 其余匹配项使用 value 的副本,
+// 避免之后修改其中一处时影响其他位置
+func (i *Item) QuerySet(path string, value *Item) (int, error) {
+	if value == nil {
+		return 0, errors.New("value 不能为空")
+	}
+	matches, err := i.query(path)
+	if err != nil {
+		return 0, err
+	}
+	cnt := 0
+	for _, m := range matches {
+		if m.parent == nil {
+			continue
+		}
+		v := value
+		if cnt > 0 {
+			v = value.Clone()
+		}
+		switch m.parent.jType {
+		case JsonTypeObj:
+			m.parent.Put(m.key, v)
+		case JsonTypeArr:
+			m.parent.PutIdx(m.idx, v)
+		}
+		cnt++
+	}
+	return cnt, nil
+}
+
+// QueryDel 删除所有匹配项, 返回被删除的个数
+//
+// 根节点无法被删除
+func (i *Item) QueryDel(path string) (int, error) {
+	matches, err := i.query(path)
+	if err != nil {
+		return 0, err
+	}
+
+	// 同一个数组中的元素需要从后往前删除, 避免索引错位
+	arrIdxs := make(map[*Item][]int)
+	cnt := 0
+	for _, m := range matches {
+		switch {
+		case m.parent == nil:
+			continue
+		case m.parent.jType == JsonTypeObj:
+			m.parent.DelKey(m.key)
+		case m.parent.jType == JsonTypeArr:
+			arrIdxs[m.parent] = append(arrIdxs[m.parent], m.idx)
+		}
+		cnt++
+	}
+	for arr, idxs := range arrIdxs {
+		sort.Sort(sort.Reverse(sort.IntSlice(idxs)))
+		for _, idx := range idxs {
+			arr.DelIdx(idx)
+		}
+	}
+	return cnt, nil
+}
+
+// queryMatch 查询匹配项, 同时记录匹配项所在的父节点, 便于修改
+type queryMatch struct {
+	item   *Item
+	parent *Item
+	key    string
+	idx    int
+}
+
+// segmentType 路径片段类型
+type segmentType int
+
+const (
+	segKey segmentType = iota
+	segIdx
+	segWildcard
+	segFilter
+)
+
+// segment 路径片段
+type segment struct {
+	sType  segmentType
+	key    string
+	idx    int
+	filter filterExpr
+}
+
+// query 根据表达式查询所有匹配项
+func (i *Item) query(path string) ([]queryMatch, error) {
+	segs, err := parsePath(strings.TrimSpace(path), '$')
+	if err != nil {
+		return nil, fmt.Errorf("解析表达式失败: %s, err: %v", path, err)
+	}
+	return evalSegments(i, segs), nil
+}
+
+// evalSegments 从 root 开始依次匹配路径片段
+func evalSegments(root *Item, segs []segment) []queryMatch {
+	cur := []queryMatch{{item: root, idx: -1}}
+	for _, seg := range segs {
+		next := make([]queryMatch, 0)
+		for _, m := range cur {
+			next = append(next, seg.apply(m.item)...)
+		}
+		cur = next
+		if len(cur) == 0 {
+			break
+		}
+	}
+	return cur
+}
+
+// apply 获取 item 中匹配当前片段的子项
+func (s segment) apply(item *Item) []queryMatch {
+	res := make([]queryMatch, 0)
+	if item == nil {
+		return res
+	}
+	switch s.sType {
+	case segKey:
+		if item.jType != JsonTypeObj {
+			return res
+		}
+		if sub, ok := item.obj[s.key]; ok {
+			res = append(res, queryMatch{item: sub, parent: item, key: s.key, idx: -1})
+		}
+	case segIdx:
+		if item.jType != JsonTypeArr {
+			return res
+		}
+		idx := s.idx
+		if idx < 0 {
+			idx += len(item.arr)
+		}
+		if idx >= 0 && idx < len(item.arr) {
+			res = append(res, queryMatch{item: item.arr[idx], parent: item, idx: idx})
+		}
+	case segWildcard, segFilter:
+		children(item, func(m queryMatch) {
+			if s.sType == segWildcard || s.filter.eval(m.item) {
+				res = append(res, m)
+			}
+		})
+	}
+	return res
+}
+
+// children 按顺序遍历 item 的所有直接子项
+func children(item *Item, callback func(m queryMatch)) {
+	switch item.jType {
+	case JsonTypeObj:
+		item.RangeObj(func(key string, value *Item) error {
+			callback(queryMatch{item: value, parent: item, key: key, idx: -1})
+			return nil
+		})
+	case JsonTypeArr:
+		for idx, sub := range item.arr {
+			callback(queryMatch{item: sub, parent: item, idx: idx})
+		}
+	}
+}
+
+// parsePath 将表达式解析为路径片段, root 为表达式的起始字符 ($ 或 @)
+func parsePath(path string, root byte) ([]segment, error) {
+	if len(path) == 0 || path[0] != root {
+		return nil, fmt.Errorf("表达式必须以 %c 开头", root)
+	}
+	segs := make([]segment, 0)
+	pos := 1
+	for pos < len(path) {
+		switch path[pos] {
+		case '.':
+			pos++
+			if pos < len(path) && path[pos] == '*' {
+				segs = append(segs, segment{sType: segWildcard})
+				pos++
+				continue
+			}
+			end := pos
+			for end < len(path) && path[end] != '.' && path[end] != '[' {
+				end++
+			}
+			if end == pos {
+				return nil, fmt.Errorf("位置 %d 处缺少属性名", pos)
+			}
+			segs = append(segs, segment{sType: segKey, key: path[pos:end]})
+			pos = end
+		case '[':
+			end, err := findBracketEnd(path, pos)
+			if err != nil {
+				return nil, err
+			}
+			seg, err := parseBracket(strings.TrimSpace(path[pos+1 : end]))
+			if err != nil {
+				return nil, err
+			}
+			segs = append(segs, seg)
+			pos = end + 1
+		default:
+			return nil, fmt.Errorf("位置 %d 处存在非法字符: %c", pos, path[pos])
+		}
+	}
+	return segs, nil
+}
+
+// parseBracket 解析中括号中的内容
+func parseBracket(content string) (segment, error) {
+	switch {
+	case content == "*":
+		return segment{sType: segWildcard}, nil
+	case strings.HasPrefix(content, "?"):
+		inner := strings.TrimSpace(content[1:])
+		if !strings.HasPrefix(inner, "(") || !strings.HasSuffix(inner, ")") {
+			return segment{}, fmt.Errorf("过滤表达式必须使用 () 包裹: %s", content)
+		}
+		expr, err := parseFilter(inner[1 : len(inner)-1])
+		if err != nil {
+			return segment{}, err
+		}
+		return segment{sType: segFilter, filter: expr}, nil
+	case isQuoted(content):
+		return segment{sType: segKey, key: content[1 : len(content)-1]}, nil
+	default:
+		idx, err := strconv.Atoi(content)
+		if err != nil {
+			return segment{}, fmt.Errorf("非法的数组索引: %s", content)
+		}
+		return segment{sType: segIdx, idx: idx}, nil
+	}
+}
+
+// findBracketEnd 查找与 start 处的 [ 相匹配的 ] 的位置, 忽略引号中的字符
+func findBracketEnd(path string, start int) (int, error) {
+	depth := 0
+	var quote byte
+	for pos := start; pos < len(path); pos++ {
+		ch := path[pos]
+		if quote != 0 {
+			if ch == quote {
+				quote = 0
+			}
+			continue
+		}
+		switch ch {
+		case '\'', '"':
+			quote = ch
+		case '[':
+			depth++
+		case ']':
+			depth--
+			if depth == 0 {
+				return pos, nil
+			}
+		}
+	}
+	return -1, fmt.Errorf("位置 %d 处的 [ 没有闭合", start)
+}
+
+// isQuoted 判断字符串是否被单引号或双引号包裹
+func isQuoted(s string) bool {
+	if len(s) < 2 {
+		return false
+	}
+	return (s[0] == '\'' && s[len(s)-1] == '\'') || (s[0] == '"' && s[len(s)-1] == '"')
+}
@@ -0,0 +1,352 @@
+package jsons
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// filterExpr 过滤表达式
+type filterExpr interface {
+	// eval 判断 item 是否满足表达式
+	eval(item *Item) bool
+}
+
+// logicExpr 逻辑运算表达式: &&, ||
+type logicExpr struct {
+	op          string
+	left, right filterExpr
+}
+
+func (e logicExpr) eval(item *Item) bool {
+	if e.op == "&&" {
+		return e.left.eval(item) && e.right.eval(item)
+	}
+	return e.left.eval(item) || e.right.eval(item)
+}
+
+// notExpr 取反表达式
+type notExpr struct {
+	expr filterExpr
+}
+
+func (e notExpr) eval(item *Item) bool {
+	return !e.expr.eval(item)
+}
+
+// existExpr 属性存在表达式, 如: @.Key
+type existExpr struct {
+	operand operand
+}
+
+func (e existExpr) eval(item *Item) bool {
+	_, ok := e.operand.resolve(item)
+	return ok
+}
+
+// compareExpr 比较表达式, 如: @.Type=='Subtitle'
+type compareExpr struct {
+	op          string
+	left, right operand
+}
+
+func (e compareExpr) eval(item *Item) bool {
+	lv, lok := e.left.resolve(item)
+	rv, rok := e.right.resolve(item)
+	if !lok || !rok {
+		return false
+	}
+	return compareVal(e.op, lv, rv)
+}
+
+// operand 比较运算的操作数, 为相对路径或者字面量
+type operand struct {
+	path    []segment
+	literal interface{}
+	isPath  bool
+}
+
+// resolve 获取操作数在 item 上的值
+//
+// 相对路径匹配不到时返回 false, 匹配到对象或数组时返回 item 本身
+func (o operand) resolve(item *Item) (interface{}, bool) {
+	if !o.isPath {
+		return o.literal, true
+	}
+	matches := evalSegments(item, o.path)
+	if len(matches) == 0 {
+		return nil, false
+	}
+	sub := matches[0].item
+	if sub.jType != JsonTypeVal {
+		return sub, true
+	}
+	return sub.val, true
+}
+
+// compareVal 比较两个值, 数字统一转换为 float64 进行比较
+func compareVal(op string, l, r interface{}) bool {
+	lf, lIsNum := toFloat(l)
+	rf, rIsNum := toFloat(r)
+	if lIsNum && rIsNum {
+		switch op {
+		case "==":
+			return lf == rf
+		case "!=":
+			return lf != rf
+		case ">":
+			return lf > rf
+		case ">=":
+			return lf >= rf
+		case "<":
+			return lf < rf
+		case "<=":
+			return lf <= rf
+		}
+		return false
+	}
+
+	ls, lIsStr := l.(string)
+	rs, rIsStr := r.(string)
+	if lIsStr && rIsStr {
+		switch op {
+		case "==":
+			return ls == rs
+		case "!=":
+			return ls != rs
+		case ">":
+			return ls > rs
+		case ">=":
+			return ls >= rs
+		case "<":
+			return ls < rs
+		case "<=":
+			return ls <= rs
+		}
+		return false
+	}
+
+	// 其余类型仅支持判断是否相等
+	_, lIsItem := l.(*Item)
+	_, rIsItem := r.(*Item)
+	if lIsItem || rIsItem {
+		return op == "!="
+	}
+	switch op {
+	case "==":
+		return l == r
+	case "!=":
+		return l != r
+	}
+	return false
+}
+
+// toFloat 将数字类型转换为 float64
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// filterParser 过滤表达式解析器
+type filterParser struct {
+	tokens []string
+	pos    int
+}
+
+// parseFilter 解析过滤表达式
+func parseFilter(raw string) (filterExpr, error) {
+	tokens, err := tokenizeFilter(raw)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("过滤表达式为空")
+	}
+	p := &filterParser{tokens: tokens}
+	expr, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("过滤表达式存在多余的内容: %s", strings.Join(p.tokens[p.pos:], " "))
+	}
+	return expr, nil
+}
+
+// peek 获取当前 token, 不移动位置
+func (p *filterParser) peek() string {
+	if p.pos >= len(p.tokens) {
+		return ""
+	}
+	return p.tokens[p.pos]
+}
+
+// next 获取当前 token, 并移动到下一个位置
+func (p *filterParser) next() string {
+	tk := p.peek()
+	p.pos++
+	return tk
+}
+
+func (p *filterParser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "||" {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = logicExpr{op: "||", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "&&" {
+		p.next()
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = logicExpr{op: "&&", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseUnary() (filterExpr, error) {
+	switch p.peek() {
+	case "!":
+		p.next()
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr: expr}, nil
+	case "(":
+		p.next()
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.next() != ")" {
+			return nil, fmt.Errorf("过滤表达式中的 ( 没有闭合")
+		}
+		return expr, nil
+	}
+
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	switch op := p.peek(); op {
+	case "==", "!=", ">", ">=", "<", "<=":
+		p.next()
+		right, err := p.parseOperand()
+		if err != nil {
+			return nil, err
+		}
+		return compareExpr{op: op, left: left, right: right}, nil
+	}
+	if !left.isPath {
+		return nil, fmt.Errorf("字面量不能单独作为过滤条件: %v", left.literal)
+	}
+	return existExpr{operand: left}, nil
+}
+
+func (p *filterParser) parseOperand() (operand, error) {
+	tk := p.next()
+	switch {
+	case tk == "":
+		return operand{}, fmt.Errorf("过滤表达式不完整")
+	case strings.HasPrefix(tk, "@"):
+		segs, err := parsePath(tk, '@')
+		if err != nil {
+			return operand{}, err
+		}
+		return operand{path: segs, isPath: true}, nil
+	case isQuoted(tk):
+		return operand{literal: tk[1 : len(tk)-1]}, nil
+	case tk == "true":
+		return operand{literal: true}, nil
+	case tk == "false":
+		return operand{literal: false}, nil
+	case tk == "null":
+		return operand{literal: nil}, nil
+	}
+	f, err := strconv.ParseFloat(tk, 64)
+	if err != nil {
+		return operand{}, fmt.Errorf("无法识别的操作数: %s", tk)
+	}
+	return operand{literal: f}, nil
+}
+
+// tokenizeFilter 将过滤表达式拆分为 token
+func tokenizeFilter(raw string) ([]string, error) {
+	tokens := make([]string, 0)
+	pos := 0
+	for pos < len(raw) {
+		ch := raw[pos]
+		switch {
+		case ch == ' ' || ch == '\t':
+			pos++
+		case ch == '(' || ch == ')':
+			tokens = append(tokens, string(ch))
+			pos++
+		case strings.HasPrefix(raw[pos:], "&&"), strings.HasPrefix(raw[pos:], "||"),
+			strings.HasPrefix(raw[pos:], "=="), strings.HasPrefix(raw[pos:], "!="),
+			strings.HasPrefix(raw[pos:], ">="), strings.HasPrefix(raw[pos:], "<="):
+			tokens = append(tokens, raw[pos:pos+2])
+			pos += 2
+		case ch == '>' || ch == '<' || ch == '!':
+			tokens = append(tokens, string(ch))
+			pos++
+		case ch == '\'' || ch == '"':
+			end := strings.IndexByte(raw[pos+1:], ch)
+			if end == -1 {
+				return nil, fmt.Errorf("过滤表达式中的引号没有闭合")
+			}
+			tokens = append(tokens, raw[pos:pos+end+2])
+			pos += end + 2
+		case ch == '@':
+			end := pos + 1
+			for end < len(raw) && !strings.ContainsRune(" \t()=!<>&|", rune(raw[end])) {
+				if raw[end] == '[' {
+					bracketEnd, err := findBracketEnd(raw, end)
+					if err != nil {
+						return nil, err
+					}
+					end = bracketEnd
+				}
+				end++
+			}
+			tokens = append(tokens, raw[pos:end])
+			pos = end
+		default:
+			end := pos
+			for end < len(raw) && !strings.ContainsRune(" \t()=!<>&|", rune(raw[end])) {
+				end++
+			}
+			if end == pos {
+				// 单独出现的 = & | 等符号不构成任何 token
+				return nil, fmt.Errorf("过滤表达式中存在无法识别的符号: %c", ch)
+			}
+			tokens = append(tokens, raw[pos:end])
+			pos = end
+		}
+	}
+	return tokens, nil
+}
@@ -1,12 +1,16 @@
 package jsons
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"strings"
 	"sync"
 )
 
 // Struct 将 item 转换为结构体对象
+//
+// 对象会被转换为 map, 不保留属性顺序, 需要保留顺序时直接序列化 item
 func (i *Item) Struct() interface{} {
 	switch i.jType {
 	case JsonTypeVal:
@@ -46,43 +50,68 @@ func (i *Item) Struct() interface{} {
 }
 
 // String 将 item 转换为 json 字符串
+//
+// 对象属性按照原始 json 或者属性的插入顺序进行序列化
 func (i *Item) String() string {
+	sb := strings.Builder{}
+	i.writeTo(&sb)
+	return sb.String()
+}
+
+// MarshalJSON 实现 json.Marshaler 接口, 序列化时保留对象属性的顺序
+func (i *Item) MarshalJSON() ([]byte, error) {
+	return []byte(i.String()), nil
+}
+
+// writeTo 将 item 序列化后写入 sb 中
+func (i *Item) writeTo(sb *strings.Builder) {
 	switch i.jType {
 	case JsonTypeVal:
 		if i.val == nil {
-			return "null"
+			sb.WriteString("null")
+			return
 		}
-		switch i.val.(type) {
+		switch val := i.val.(type) {
 		case string:
-			return fmt.Sprintf(`"%v"`, i.val)
+			sb.WriteString(quote(val))
 		default:
-			return fmt.Sprintf("%v", i.val)
+			sb.WriteString(fmt.Sprintf("%v", val))
 		}
 	case JsonTypeObj:
-		sb := strings.Builder{}
 		sb.WriteString("{")
-		cur, tot := 0, len(i.obj)
-		for key, value := range i.obj {
-			sb.WriteString(fmt.Sprintf(`"%s":%s`, key, value.String()))
-			cur++
-			if cur != tot {
+		cur := 0
+		i.RangeObj(func(key string, value *Item) error {
+			if cur > 0 {
 				sb.WriteString(",")
 			}
-		}
+			sb.WriteString(quote(key))
+			sb.WriteString(":")
+			value.writeTo(sb)
+			cur++
+			return nil
+		})
 		sb.WriteString("}")
-		return sb.String()
 	case JsonTypeArr:
-		sb := strings.Builder{}
 		sb.WriteString("[")
 		for idx, value := range i.arr {
-			sb.WriteString(value.String())
-			if idx < len(i.arr)-1 {
+			if idx > 0 {
 				sb.WriteString(",")
 			}
+			value.writeTo(sb)
 		}
 		sb.WriteString("]")
-		return sb.String()
 	default:
-		return "Error jType"
+		sb.WriteString("Error jType")
+	}
+}
+
+// quote 将字符串转换为 json 字符串字面量, 不对 html 字符进行转义
+func quote(str string) string {
+	buf := bytes.Buffer{}
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	if err := enc.Encode(str); err != nil {
+		return `""`
 	}
+	return strings.TrimSuffix(buf.String(), "\n")
 }
@@ -0,0 +1,81 @@
+// 日志级别控制, 支持在运行时切换
+package logs
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync/atomic"
+)
+
+// Level 日志级别
+type Level string
+
+const (
+	LevelDebug Level = "debug" // 输出所有日志, 包括请求处理过程中的详细信息
+	LevelInfo  Level = "info"  // 不输出调试日志
+)
+
+// ParseLevel 将字符串转换为日志级别, 不区分大小写
+func ParseLevel(s string) (Level, error) {
+	switch l := Level(strings.ToLower(strings.TrimSpace(s))); l {
+	case LevelDebug, LevelInfo:
+		return l, nil
+	default:
+		return "", fmt.Errorf("不支持的日志级别: %s, 可选值: debug, info", s)
+	}
+}
+
+// current 当前的日志级别
+var current atomic.Value
+
+func init() {
+	current.Store(LevelDebug)
+}
+
+// SetLevel 设置日志级别
+func SetLevel(l Level) {
+	current.Store(l)
+}
+
+// GetLevel 获取当前的日志级别
+func GetLevel() Level {
+	return current.Load().(Level)
+}
+
+// DebugEnabled 当前是否输出调试日志, 有被跟踪的请求正在处理时临时输出
+func DebugEnabled() bool {
+	return GetLevel() == LevelDebug || tracing.Load() > 0
+}
+
+// Debugf 输出调试日志, 用法与 log.Printf 一致
+func Debugf(format string, v ...any) {
+	if DebugEnabled() {
+		log.Output(2, fmt.Sprintf(format, v...))
+	}
+}
+
+// Debugln 输出调试日志, 用法与 log.Println 一致
+func Debugln(v ...any) {
+	if DebugEnabled() {
+		log.Output(2, fmt.Sprintln(v...))
+	}
+}
+
+// debugWriter 只在调试级别下写入的 io.Writer
+type debugWriter struct {
+	w io.Writer
+}
+
+func (dw *debugWriter) Write(p []byte) (int, error) {
+	if !DebugEnabled() {
+		return len(p), nil
+	}
+	return dw.w.Write(p)
+}
+
+// DebugWriter 包装 w, 只有调试级别下才会真正写入 w
+func DebugWriter(w io.Writer) io.Writer {
+	return &debugWriter{w: w}
+}
@@ -0,0 +1,61 @@
+package logs
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// Trace 针对单个 item 或用户的调试跟踪
+//
+// 日志级别为 info 时, 匹配的请求在处理期间临时输出调试日志, 并被请求录制记录下来;
+// 调试日志没有携带请求上下文, 同一时间处理的其他请求也可能输出少量调试日志
+type Trace struct {
+	Item    string    // 跟踪的 item id, 为空表示不限制
+	User    string    // 跟踪的用户名或用户 id, 为空表示不限制
+	Expired time.Time // 跟踪的过期时间
+}
+
+var (
+	// trace 当前生效的跟踪条件
+	trace atomic.Pointer[Trace]
+
+	// tracing 正在处理的被跟踪请求个数
+	tracing atomic.Int64
+)
+
+// SetTrace 设置跟踪条件, 传递 nil 时停止跟踪
+func SetTrace(t *Trace) {
+	trace.Store(t)
+}
+
+// GetTrace 获取当前生效的跟踪条件, 没有跟踪或已过期时返回 false
+func GetTrace() (*Trace, bool) {
+	t := trace.Load()
+	if t == nil {
+		return nil, false
+	}
+	if time.Now().After(t.Expired) {
+		trace.CompareAndSwap(t, nil)
+		return nil, false
+	}
+	return t, true
+}
+
+// Match 判断请求的 item 和用户是否满足跟踪条件
+func (t *Trace) Match(item, user string) bool {
+	if t.Item != "" && t.Item != item {
+		return false
+	}
+	return t.User == "" || t.User == user
+}
+
+// BeginTrace 开始处理一个被跟踪的请求, 返回的函数在请求处理完成后调用
+func BeginTrace() (end func()) {
+	tracing.Add(1)
+	var done atomic.Bool
+	return func() {
+		if done.CompareAndSwap(false, true) {
+			tracing.Add(-1)
+		}
+	}
+}
@@ -0,0 +1,23 @@
+// 进程内存占用统计
+package memstat
+
+import (
+	"errors"
+	"runtime"
+)
+
+// ErrUnsupported 当前平台不支持获取进程的常驻内存
+var ErrUnsupported = errors.New("当前平台不支持获取进程的常驻内存")
+
+// Usage 获取进程当前的内存占用 (Byte)
+//
+// 优先使用操作系统统计的常驻内存 (RSS), 不支持时使用 Go 运行时向操作系统申请且未归还的内存;
+// source 返回实际使用的统计方式: rss, heap
+func Usage() (usage int64, source string) {
+	if rss, err := RSS(); err == nil {
+		return rss, "rss"
+	}
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return int64(ms.Sys - ms.HeapReleased), "heap"
+}
@@ -0,0 +1,27 @@
+//go:build linux
+
+package memstat
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// RSS 读取 /proc/self/statm 获取进程的常驻内存 (Byte)
+func RSS() (int64, error) {
+	bytes, err := os.ReadFile("/proc/self/statm")
+	if err != nil {
+		return 0, err
+	}
+	fields := strings.Fields(string(bytes))
+	if len(fields) < 2 {
+		return 0, fmt.Errorf("statm 格式错误: %s", string(bytes))
+	}
+	pages, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("statm 格式错误: %v", err)
+	}
+	return pages * int64(os.Getpagesize()), nil
+}
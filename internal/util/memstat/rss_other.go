@@ -0,0 +1,8 @@
+//go:build !linux
+
+package memstat
+
+// RSS 当前平台不支持获取进程的常驻内存
+func RSS() (int64, error) {
+	return 0, ErrUnsupported
+}
@@ -0,0 +1,66 @@
+package metrics
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	DecisionRedirect = "302"    // 重定向到网盘直链
+	DecisionProxy    = "proxy"  // 经过 alist 或本程序中转
+	DecisionOrigin   = "origin" // 由 emby 源服务器处理
+	DecisionReject   = "reject" // 拒绝处理
+	DecisionStale    = "stale"  // 返回最近一次成功的响应
+)
+
+const (
+	ReasonDefault    = "default"     // 按照默认配置处理
+	ReasonPolicy     = "policy"      // 命中标签、并发限制、原盘策略等策略
+	ReasonFailure    = "failure"     // 解析失败或客户端上报播放失败
+	ReasonClientRule = "client-rule" // 命中地区、测速等客户端规则, 或客户端能力不足
+)
+
+// DecisionStat 某个路由中某种决策的次数统计
+type DecisionStat struct {
+	Route    string // 路由名称
+	Decision string // 决策结果
+	Reason   string // 决策原因
+	Count    int64  // 次数
+}
+
+// decisions 路由 + 决策结果 + 决策原因 => 次数
+var decisions = sync.Map{}
+
+// RecordDecision 记录一次请求的改写决策
+func RecordDecision(route, decision, reason string) {
+	key := route + "\n" + decision + "\n" + reason
+	cnt, _ := decisions.LoadOrStore(key, new(atomic.Int64))
+	cnt.(*atomic.Int64).Add(1)
+}
+
+// DecisionSnapshot 获取所有改写决策的次数统计, 按照路由, 决策结果, 决策原因排序
+func DecisionSnapshot() []DecisionStat {
+	res := make([]DecisionStat, 0)
+	decisions.Range(func(key, value any) bool {
+		segs := strings.SplitN(key.(string), "\n", 3)
+		res = append(res, DecisionStat{
+			Route:    segs[0],
+			Decision: segs[1],
+			Reason:   segs[2],
+			Count:    value.(*atomic.Int64).Load(),
+		})
+		return true
+	})
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Route != res[j].Route {
+			return res[i].Route < res[j].Route
+		}
+		if res[i].Decision != res[j].Decision {
+			return res[i].Decision < res[j].Decision
+		}
+		return res[i].Reason < res[j].Reason
+	})
+	return res
+}
@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"sync"
+	"time"
+)
+
+// MaxRecentErrors 最多保留多少条最近的异常信息
+const MaxRecentErrors = 50
+
+// ErrorRecord 异常记录
+type ErrorRecord struct {
+	Time string // 发生时间
+	Msg  string // 异常信息
+}
+
+var (
+	// recentErrors 最近的异常记录, 按时间顺序排列
+	recentErrors = make([]ErrorRecord, 0, MaxRecentErrors)
+
+	// errorsMu 并发控制
+	errorsMu sync.Mutex
+)
+
+// RecordError 记录一条异常信息, 超过 MaxRecentErrors 时淘汰最早的记录
+func RecordError(msg string) {
+	errorsMu.Lock()
+	defer errorsMu.Unlock()
+	if len(recentErrors) == MaxRecentErrors {
+		recentErrors = append(recentErrors[:0], recentErrors[1:]...)
+	}
+	recentErrors = append(recentErrors, ErrorRecord{Time: time.Now().Format(time.DateTime), Msg: msg})
+}
+
+// RecentErrors 获取最近的异常记录
+func RecentErrors() []ErrorRecord {
+	errorsMu.Lock()
+	defer errorsMu.Unlock()
+	return append(([]ErrorRecord)(nil), recentErrors...)
+}
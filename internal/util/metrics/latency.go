@@ -0,0 +1,89 @@
+package metrics
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// MaxLatencySamples 每一类上游最多保留多少个最近的耗时样本
+const MaxLatencySamples = 1024
+
+// 上游请求的分类
+//
+// 除 alist 资源解析统计完整的解析耗时外, 其余均统计发起请求到响应头到达的耗时 (首字节), 不包括响应体的传输
+const (
+	UpstreamEmby    = "emby"    // emby 接口请求以及回源代理
+	UpstreamAlist   = "alist"   // alist 资源解析
+	UpstreamM3U8    = "m3u8"    // 远程 m3u8 播放列表请求
+	UpstreamSegment = "segment" // 由本程序从网盘获取的 m3u8 切片 (热门切片缓存)
+)
+
+// latency 记录某一类上游请求的耗时样本
+//
+// 使用环形数组保存最近的 MaxLatencySamples 个样本
+type latency struct {
+	samples []time.Duration
+	next    int
+	count   int64
+	mu      sync.Mutex
+}
+
+// LatencyStat 耗时统计结果, 单位: 毫秒
+type LatencyStat struct {
+	Count int64   // 总请求次数
+	P50   float64 // 50 分位耗时
+	P95   float64 // 95 分位耗时
+	P99   float64 // 99 分位耗时
+	Max   float64 // 样本中的最大耗时
+}
+
+// latencies 所有上游的耗时记录
+var latencies = sync.Map{}
+
+// ObserveLatency 记录一次上游请求耗时
+func ObserveLatency(name string, d time.Duration) {
+	l, _ := latencies.LoadOrStore(name, &latency{samples: make([]time.Duration, 0, MaxLatencySamples)})
+	lt := l.(*latency)
+	lt.mu.Lock()
+	defer lt.mu.Unlock()
+	lt.count++
+	if len(lt.samples) < MaxLatencySamples {
+		lt.samples = append(lt.samples, d)
+		return
+	}
+	lt.samples[lt.next] = d
+	lt.next = (lt.next + 1) % MaxLatencySamples
+}
+
+// LatencySnapshot 获取所有上游的耗时统计快照
+func LatencySnapshot() map[string]LatencyStat {
+	res := make(map[string]LatencyStat)
+	latencies.Range(func(key, value any) bool {
+		lt := value.(*latency)
+		lt.mu.Lock()
+		sorted := append(([]time.Duration)(nil), lt.samples...)
+		count := lt.count
+		lt.mu.Unlock()
+
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		res[key.(string)] = LatencyStat{
+			Count: count,
+			P50:   quantile(sorted, 0.5),
+			P95:   quantile(sorted, 0.95),
+			P99:   quantile(sorted, 0.99),
+			Max:   quantile(sorted, 1),
+		}
+		return true
+	})
+	return res
+}
+
+// quantile 计算有序样本中的分位值, 单位: 毫秒
+func quantile(sorted []time.Duration, q float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(float64(len(sorted)-1) * q)
+	return float64(sorted[idx].Microseconds()) / 1000
+}
@@ -0,0 +1,44 @@
+package metrics
+
+import (
+	"sync"
+)
+
+// MaxRecentRequests 最多保留多少条最近的请求记录
+const MaxRecentRequests = 100
+
+// RequestRecord 请求记录
+type RequestRecord struct {
+	RequestId   string // 请求 id
+	Time        string // 请求时间
+	Method      string // 请求方法
+	Uri         string // 请求地址 (已脱敏)
+	Code        int    // 响应码
+	Cost        int64  // 处理耗时 (毫秒)
+	CacheStatus string // 缓存状态
+}
+
+var (
+	// recentRequests 最近的请求记录, 按时间顺序排列
+	recentRequests = make([]RequestRecord, 0, MaxRecentRequests)
+
+	// requestsMu 并发控制
+	requestsMu sync.Mutex
+)
+
+// RecordRequest 记录一条请求, 超过 MaxRecentRequests 时淘汰最早的记录
+func RecordRequest(r RequestRecord) {
+	requestsMu.Lock()
+	defer requestsMu.Unlock()
+	if len(recentRequests) == MaxRecentRequests {
+		recentRequests = append(recentRequests[:0], recentRequests[1:]...)
+	}
+	recentRequests = append(recentRequests, r)
+}
+
+// RecentRequests 获取最近的请求记录
+func RecentRequests() []RequestRecord {
+	requestsMu.Lock()
+	defer requestsMu.Unlock()
+	return append(([]RequestRecord)(nil), recentRequests...)
+}
@@ -0,0 +1,97 @@
+// 媒体容器与 MIME 类型的对应关系,
+// 用于修正网盘或源服务器返回的 application/octet-stream 等不准确的 Content-Type
+package mimes
+
+import (
+	"path"
+	"strings"
+)
+
+// OctetStream 通用的二进制流类型
+const OctetStream = "application/octet-stream"
+
+// containerMimes 容器 => MIME 类型
+var containerMimes = map[string]string{
+	// 视频
+	"mkv":  "video/x-matroska",
+	"mk3d": "video/x-matroska",
+	"mp4":  "video/mp4",
+	"m4v":  "video/mp4",
+	"mov":  "video/quicktime",
+	"webm": "video/webm",
+	"ts":   "video/mp2t",
+	"m2ts": "video/mp2t",
+	"mts":  "video/mp2t",
+	"avi":  "video/x-msvideo",
+	"flv":  "video/x-flv",
+	"wmv":  "video/x-ms-wmv",
+	"asf":  "video/x-ms-asf",
+	"mpg":  "video/mpeg",
+	"mpeg": "video/mpeg",
+	"vob":  "video/mpeg",
+	"3gp":  "video/3gpp",
+	"rmvb": "application/vnd.rn-realmedia-vbr",
+	"rm":   "application/vnd.rn-realmedia",
+	"iso":  "application/x-iso9660-image",
+
+	// 音频
+	"mp3":   "audio/mpeg",
+	"flac":  "audio/flac",
+	"m4a":   "audio/mp4",
+	"m4b":   "audio/mp4",
+	"aac":   "audio/aac",
+	"ogg":   "audio/ogg",
+	"oga":   "audio/ogg",
+	"opus":  "audio/ogg",
+	"wav":   "audio/wav",
+	"wma":   "audio/x-ms-wma",
+	"ape":   "audio/x-ape",
+	"dsf":   "audio/x-dsf",
+	"webma": "audio/webm",
+
+	// 图片
+	"jpg":  "image/jpeg",
+	"jpeg": "image/jpeg",
+	"png":  "image/png",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"bmp":  "image/bmp",
+	"heic": "image/heic",
+
+	// 播放列表
+	"m3u8": "application/vnd.apple.mpegurl",
+}
+
+// ByContainer 根据容器名称获取 MIME 类型
+//
+// emby 中的容器可能是以逗号分隔的多个名称, 如: mov,mp4,m4a, 返回第一个能识别的类型
+func ByContainer(container string) (string, bool) {
+	for _, name := range strings.Split(container, ",") {
+		if mime, ok := containerMimes[strings.ToLower(strings.TrimSpace(name))]; ok {
+			return mime, true
+		}
+	}
+	return "", false
+}
+
+// ByPath 根据文件路径或链接的扩展名获取 MIME 类型
+func ByPath(p string) (string, bool) {
+	if idx := strings.IndexAny(p, "?#"); idx != -1 {
+		p = p[:idx]
+	}
+	return ByContainer(strings.TrimPrefix(path.Ext(p), "."))
+}
+
+// Resolve 优先根据容器名称, 其次根据文件扩展名获取 MIME 类型
+func Resolve(container, p string) (string, bool) {
+	if mime, ok := ByContainer(container); ok {
+		return mime, true
+	}
+	return ByPath(p)
+}
+
+// Inaccurate 判断响应的 Content-Type 是否需要修正
+func Inaccurate(contentType string) bool {
+	contentType = strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	return contentType == "" || contentType == OctetStream || contentType == "binary/octet-stream"
+}
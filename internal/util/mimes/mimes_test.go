@@ -0,0 +1,40 @@
+package mimes_test
+
+import (
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/mimes"
+)
+
+func TestResolve(t *testing.T) {
+	cases := []struct {
+		container, path, want string
+		ok                    bool
+	}{
+		{"mkv", "/movie/a.mp4", "video/x-matroska", true},
+		{"MOV,MP4,M4A", "", "video/quicktime", true},
+		{"", "/movie/a.MP4?sign=xx#t", "video/mp4", true},
+		{"unknown", "/music/a.flac", "audio/flac", true},
+		{"", "/movie/a.unknown", "", false},
+	}
+	for _, c := range cases {
+		got, ok := mimes.Resolve(c.container, c.path)
+		if got != c.want || ok != c.ok {
+			t.Errorf("Resolve(%q, %q) = %q, %v, 期望: %q, %v", c.container, c.path, got, ok, c.want, c.ok)
+		}
+	}
+}
+
+func TestInaccurate(t *testing.T) {
+	for ct, want := range map[string]bool{
+		"":                         true,
+		"application/octet-stream": true,
+		"Binary/Octet-Stream":      true,
+		"video/mp4":                false,
+		"application/octet-stream; charset=utf-8": true,
+	} {
+		if got := mimes.Inaccurate(ct); got != want {
+			t.Errorf("Inaccurate(%q) = %v, 期望: %v", ct, got, want)
+		}
+	}
+}
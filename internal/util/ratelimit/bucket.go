@@ -0,0 +1,53 @@
+// 令牌桶限速
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Bucket 令牌桶, 一个令牌对应一个字节
+//
+// 桶容量为一秒的令牌数, 允许短时间内的突发流量
+type Bucket struct {
+	rate   float64   // 每秒产生的令牌数
+	tokens float64   // 当前可用的令牌数, 可以为负数, 表示已被预支
+	last   time.Time // 上一次补充令牌的时间
+	mu     sync.Mutex
+}
+
+// NewBucket 初始化一个令牌桶, rate 为每秒允许通过的字节数
+func NewBucket(rate int64) *Bucket {
+	return &Bucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// Wait 预支 n 个令牌, 令牌不足时阻塞等待, 直到令牌补足或 ctx 结束 (结束时归还令牌)
+func (b *Bucket) Wait(ctx context.Context, n int) error {
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens = min(b.rate, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.tokens -= float64(n)
+	var wait time.Duration
+	if b.tokens < 0 {
+		wait = time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	b.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		// 放弃等待, 归还预支的令牌
+		b.mu.Lock()
+		b.tokens += float64(n)
+		b.mu.Unlock()
+		return ctx.Err()
+	}
+}
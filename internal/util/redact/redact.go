@@ -0,0 +1,117 @@
+// 日志脱敏, 将日志中的 api_key, token 等敏感信息替换为掩码
+package redact
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+)
+
+// Mask 敏感信息替换后的掩码
+const Mask = "******"
+
+// SecretParams 需要脱敏的 query 参数和 json 字段名称
+//
+// Pw, Password 为 emby 登录接口 (/Users/AuthenticateByName) 提交的密码, AccessToken 为登录成功后返回的 token
+var SecretParams = []string{"api_key", "X-Emby-Token", "admin_token", "X-Admin-Token", "Pw", "Password", "AccessToken"}
+
+// SecretHeaders 需要脱敏的请求头名称
+var SecretHeaders = []string{"Authorization", "X-Emby-Authorization", "X-Emby-Token", "X-Admin-Token", "Cookie", "Set-Cookie"}
+
+var (
+	// paramRegex 匹配 url 中形如 api_key=xxx 的片段
+	paramRegex = regexp.MustCompile(`(?i)((?:` + strings.Join(quoteAll(SecretParams), "|") + `)=)[^&\s"'\\]+`)
+
+	// jsonRegex 匹配 json 中形如 "api_key":"xxx" 的片段
+	jsonRegex = regexp.MustCompile(`(?i)("(?:` + strings.Join(quoteAll(SecretParams), "|") + `)"\s*:\s*")(?:[^"\\]|\\.)+`)
+
+	// embyAuthRegex 匹配 emby 鉴权头中形如 Token="xxx" 的片段
+	embyAuthRegex = regexp.MustCompile(`(?i)(Token=")[^"]+`)
+)
+
+// String 将字符串中的敏感信息替换为掩码
+func String(s string) string {
+	s = paramRegex.ReplaceAllString(s, "${1}"+Mask)
+	s = jsonRegex.ReplaceAllString(s, "${1}"+Mask)
+	s = embyAuthRegex.ReplaceAllString(s, "${1}"+Mask)
+	for _, secret := range configSecrets() {
+		s = replaceSecret(s, secret)
+	}
+	return s
+}
+
+// Header 克隆请求头, 并将其中的敏感信息替换为掩码
+func Header(h http.Header) http.Header {
+	if h == nil {
+		return nil
+	}
+	res := h.Clone()
+	for _, key := range SecretHeaders {
+		if res.Get(key) != "" {
+			res.Set(key, Mask)
+		}
+	}
+	return res
+}
+
+// writer 写入前先进行脱敏的 io.Writer
+type writer struct {
+	w io.Writer
+}
+
+func (rw *writer) Write(p []byte) (int, error) {
+	if _, err := rw.w.Write([]byte(String(string(p)))); err != nil {
+		return 0, err
+	}
+	// 返回原始长度, 避免调用方认为写入不完整
+	return len(p), nil
+}
+
+// Writer 包装 w, 所有写入 w 的内容都会先进行脱敏
+func Writer(w io.Writer) io.Writer {
+	return &writer{w: w}
+}
+
+// minPlainSecretLen 直接替换的密钥最小长度, 过短的值容易误伤正常日志, 只在 key=value 等上下文中替换
+const minPlainSecretLen = 8
+
+// shortSecretRegexes 过短的密钥 => 匹配该密钥作为完整值出现的正则
+var shortSecretRegexes = sync.Map{}
+
+// configSecrets 获取配置文件中的密钥, 日志中出现这些值时替换为掩码
+//
+// 密钥来自 config 中统一的敏感配置项规则, 与管理接口展示配置时的脱敏规则一致,
+// 配置加载时已经计算好, 每次写入日志不再重复遍历配置
+func configSecrets() []string {
+	return config.Secrets()
+}
+
+// replaceSecret 将 s 中出现的 secret 替换为掩码
+//
+// 过短的 secret 只在作为完整值出现时替换, 如: token=abc, "token":"abc"
+func replaceSecret(s, secret string) string {
+	if len(secret) >= minPlainSecretLen {
+		return strings.ReplaceAll(s, secret, Mask)
+	}
+	if !strings.Contains(s, secret) {
+		return s
+	}
+	re, ok := shortSecretRegexes.Load(secret)
+	if !ok {
+		re, _ = shortSecretRegexes.LoadOrStore(secret, regexp.MustCompile(`([=:]\s*"?)`+regexp.QuoteMeta(secret)+`(["&\s,;}]|$)`))
+	}
+	return re.(*regexp.Regexp).ReplaceAllString(s, "${1}"+Mask+"${2}")
+}
+
+// quoteAll 对所有字符串进行正则转义
+func quoteAll(strs []string) []string {
+	res := make([]string, len(strs))
+	for i, s := range strs {
+		res[i] = regexp.QuoteMeta(s)
+	}
+	return res
+}
@@ -0,0 +1,63 @@
+package redact_test
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/redact"
+)
+
+func TestString(t *testing.T) {
+	cases := map[string]string{
+		"/videos/1/stream?api_key=abc123&Static=true":      "/videos/1/stream?api_key=******&Static=true",
+		"/Items?X-Emby-Token=abc123":                       "/Items?X-Emby-Token=******",
+		`{"api_key":"abc123","Name":"test"}`:               `{"api_key":"******","Name":"test"}`,
+		`MediaBrowser Client="Emby Web", Token="abc123"`:   `MediaBrowser Client="Emby Web", Token="******"`,
+		"/videos/proxy_ts?alist_path=%2Fa.mp4&idx=1":       "/videos/proxy_ts?alist_path=%2Fa.mp4&idx=1",
+		"/admin/metrics/latency?admin_token=secret-token1": "/admin/metrics/latency?admin_token=******",
+		`{"Username":"test","Pw":"p\"wd"}`:                 `{"Username":"test","Pw":"******"}`,
+		`{"User":{"Name":"test"},"AccessToken":"abc123"}`:  `{"User":{"Name":"test"},"AccessToken":"******"}`,
+	}
+	for raw, want := range cases {
+		if got := redact.String(raw); got != want {
+			t.Errorf("脱敏结果不符合预期, raw: %s, want: %s, got: %s", raw, want, got)
+		}
+	}
+}
+
+func TestConfigSecrets(t *testing.T) {
+	origin := config.C
+	defer func() { config.C = origin }()
+	config.C = &config.Config{
+		Webdav:  &config.Webdav{Password: "pw1"},
+		Cluster: &config.Cluster{Redis: &config.ClusterRedis{Password: "redis-password"}},
+	}
+
+	cases := map[string]string{
+		"connect redis with redis-password failed": "connect redis with ****** failed",
+		"webdav password=pw1&user=a":               "webdav password=******&user=a",
+		`{"password":"pw1"}`:                       `{"password":"******"}`,
+		"pw12 is not a secret":                     "pw12 is not a secret",
+	}
+	for raw, want := range cases {
+		if got := redact.String(raw); got != want {
+			t.Errorf("脱敏结果不符合预期, raw: %s, want: %s, got: %s", raw, want, got)
+		}
+	}
+}
+
+func TestHeader(t *testing.T) {
+	h := http.Header{}
+	h.Set("Cookie", "session=abc123")
+	h.Add("Set-Cookie", "a=1")
+	h.Add("Set-Cookie", "b=2")
+	h.Set("Content-Type", "application/json")
+	res := redact.Header(h)
+	if res.Get("Cookie") != redact.Mask || len(res.Values("Set-Cookie")) != 1 || res.Get("Set-Cookie") != redact.Mask {
+		t.Errorf("cookie 脱敏结果不符合预期: %v", res)
+	}
+	if res.Get("Content-Type") != "application/json" || h.Get("Cookie") != "session=abc123" {
+		t.Errorf("不应该修改其他请求头和原始请求头: %v, %v", res, h)
+	}
+}
@@ -0,0 +1,289 @@
+// 精简的 redis 客户端, 只实现 RESP2 协议中本程序需要的部分
+package redis
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// ErrNil 查询的 key 不存在
+var ErrNil = errors.New("redis: nil")
+
+// Error redis 服务端返回的错误
+type Error string
+
+func (e Error) Error() string {
+	return "redis: " + string(e)
+}
+
+// conn 一个带读缓冲的连接
+type conn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// Client redis 客户端, 内部维护一个连接池, 可以并发使用
+type Client struct {
+	addr     string
+	password string
+	db       int
+	timeout  time.Duration // 单个命令的默认超时时间
+	pool     chan *conn    // 空闲连接
+}
+
+// New 初始化一个客户端, 连接在首次执行命令时建立
+//
+// poolSize 为最多保留的空闲连接数
+func New(addr, password string, db int, timeout time.Duration, poolSize int) *Client {
+	return &Client{
+		addr:     addr,
+		password: password,
+		db:       db,
+		timeout:  timeout,
+		pool:     make(chan *conn, poolSize),
+	}
+}
+
+// Do 执行一条命令, 返回值的类型为: string, int64, []any, 不存在时返回 ErrNil
+func (c *Client) Do(ctx context.Context, args ...string) (any, error) {
+	cn, err := c.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+	res, err := c.do(ctx, cn, args...)
+	var redisErr Error
+	if err != nil && err != ErrNil && !errors.As(err, &redisErr) {
+		// 网络异常的连接不再复用
+		cn.Close()
+		return nil, err
+	}
+	c.put(cn)
+	return res, err
+}
+
+// Get 获取字符串类型的值
+func (c *Client) Get(ctx context.Context, key string) (string, error) {
+	res, err := c.Do(ctx, "GET", key)
+	if err != nil {
+		return "", err
+	}
+	return toString(res)
+}
+
+// Set 设置字符串类型的值, ttl 小于等于 0 时不过期
+func (c *Client) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := c.Do(ctx, args...)
+	return err
+}
+
+// Del 删除 key
+func (c *Client) Del(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := c.Do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+// HSet 设置哈希表中字段的值
+func (c *Client) HSet(ctx context.Context, key, field, value string) error {
+	_, err := c.Do(ctx, "HSET", key, field, value)
+	return err
+}
+
+// HDel 删除哈希表中的字段
+func (c *Client) HDel(ctx context.Context, key string, fields ...string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+	_, err := c.Do(ctx, append([]string{"HDEL", key}, fields...)...)
+	return err
+}
+
+// HGetAll 获取哈希表中所有的字段和值, key 不存在时返回空 map
+func (c *Client) HGetAll(ctx context.Context, key string) (map[string]string, error) {
+	res, err := c.Do(ctx, "HGETALL", key)
+	if err != nil {
+		return nil, err
+	}
+	arr, ok := res.([]any)
+	if !ok || len(arr)%2 != 0 {
+		return nil, fmt.Errorf("redis: HGETALL 响应格式错误: %v", res)
+	}
+	m := make(map[string]string, len(arr)/2)
+	for i := 0; i < len(arr); i += 2 {
+		field, err1 := toString(arr[i])
+		value, err2 := toString(arr[i+1])
+		if err1 != nil || err2 != nil {
+			return nil, fmt.Errorf("redis: HGETALL 响应格式错误: %v", res)
+		}
+		m[field] = value
+	}
+	return m, nil
+}
+
+// PExpire 设置 key 的过期时间
+func (c *Client) PExpire(ctx context.Context, key string, ttl time.Duration) error {
+	_, err := c.Do(ctx, "PEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10))
+	return err
+}
+
+// Ping 检查服务端是否可用
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.Do(ctx, "PING")
+	return err
+}
+
+// get 从连接池中获取空闲连接, 没有空闲连接时新建
+func (c *Client) get(ctx context.Context) (*conn, error) {
+	select {
+	case cn := <-c.pool:
+		return cn, nil
+	default:
+	}
+
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", c.addr)
+	if err != nil {
+		return nil, fmt.Errorf("redis: 连接失败: %v", err)
+	}
+	cn := &conn{Conn: nc, r: bufio.NewReader(nc)}
+	if c.password != "" {
+		if _, err := c.do(ctx, cn, "AUTH", c.password); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("redis: 认证失败: %v", err)
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.do(ctx, cn, "SELECT", strconv.Itoa(c.db)); err != nil {
+			cn.Close()
+			return nil, fmt.Errorf("redis: 切换数据库失败: %v", err)
+		}
+	}
+	return cn, nil
+}
+
+// put 将连接放回连接池, 连接池已满时关闭连接
+func (c *Client) put(cn *conn) {
+	select {
+	case c.pool <- cn:
+	default:
+		cn.Close()
+	}
+}
+
+// withTimeout ctx 没有设置截止时间时, 使用默认的超时时间
+func (c *Client) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if _, ok := ctx.Deadline(); ok || c.timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, c.timeout)
+}
+
+// do 在指定连接上发送命令并读取响应
+func (c *Client) do(ctx context.Context, cn *conn, args ...string) (any, error) {
+	ctx, cancel := c.withTimeout(ctx)
+	defer cancel()
+	deadline, _ := ctx.Deadline()
+	cn.SetDeadline(deadline)
+
+	buf := make([]byte, 0, 64)
+	buf = append(buf, '*')
+	buf = strconv.AppendInt(buf, int64(len(args)), 10)
+	buf = append(buf, '\r', '\n')
+	for _, arg := range args {
+		buf = append(buf, '$')
+		buf = strconv.AppendInt(buf, int64(len(arg)), 10)
+		buf = append(buf, '\r', '\n')
+		buf = append(buf, arg...)
+		buf = append(buf, '\r', '\n')
+	}
+	if _, err := cn.Write(buf); err != nil {
+		return nil, fmt.Errorf("redis: 发送命令失败: %v", err)
+	}
+	return readReply(cn.r)
+}
+
+// readReply 读取一个完整的响应
+func readReply(r *bufio.Reader) (any, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, fmt.Errorf("redis: 读取响应失败: %v", err)
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, fmt.Errorf("redis: 响应格式错误: %q", line)
+	}
+	kind, body := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return body, nil
+	case '-':
+		return nil, Error(body)
+	case ':':
+		n, err := strconv.ParseInt(body, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("redis: 响应格式错误: %q", line)
+		}
+		return n, nil
+	case '$':
+		size, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: 响应格式错误: %q", line)
+		}
+		if size < 0 {
+			return nil, ErrNil
+		}
+		data := make([]byte, size+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, fmt.Errorf("redis: 读取响应失败: %v", err)
+		}
+		return string(data[:size]), nil
+	case '*':
+		size, err := strconv.Atoi(body)
+		if err != nil {
+			return nil, fmt.Errorf("redis: 响应格式错误: %q", line)
+		}
+		if size < 0 {
+			return nil, ErrNil
+		}
+		arr := make([]any, 0, size)
+		for i := 0; i < size; i++ {
+			item, err := readReply(r)
+			// 数组中的元素为空或为错误时作为元素的值返回, 保证剩余元素被读取
+			var redisErr Error
+			if err == ErrNil {
+				item, err = nil, nil
+			} else if errors.As(err, &redisErr) {
+				item, err = redisErr, nil
+			}
+			if err != nil {
+				return nil, err
+			}
+			arr = append(arr, item)
+		}
+		return arr, nil
+	default:
+		return nil, fmt.Errorf("redis: 不支持的响应类型: %q", line)
+	}
+}
+
+// toString 将响应转换为字符串
+func toString(res any) (string, error) {
+	if s, ok := res.(string); ok {
+		return s, nil
+	}
+	return "", fmt.Errorf("redis: 响应不是字符串: %v", res)
+}
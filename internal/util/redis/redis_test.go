@@ -0,0 +1,119 @@
+package redis_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/redis"
+)
+
+// fakeServer 只支持测试用到的几个命令的内存 redis 服务
+func fakeServer(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	var mu sync.Mutex
+	strs, hashes := map[string]string{}, map[string]map[string]string{}
+	bulk := func(s string) string { return fmt.Sprintf("$%d\r\n%s\r\n", len(s), s) }
+	go func() {
+		for {
+			c, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				r := bufio.NewReader(c)
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					n, _ := strconv.Atoi(strings.TrimSpace(line[1:]))
+					args := make([]string, n)
+					for i := range args {
+						sizeLine, _ := r.ReadString('\n')
+						size, _ := strconv.Atoi(strings.TrimSpace(sizeLine[1:]))
+						arg := make([]byte, size+2)
+						io.ReadFull(r, arg)
+						args[i] = string(arg[:size])
+					}
+
+					mu.Lock()
+					var resp string
+					switch strings.ToUpper(args[0]) {
+					case "PING":
+						resp = "+PONG\r\n"
+					case "SET":
+						strs[args[1]] = args[2]
+						resp = "+OK\r\n"
+					case "GET":
+						if v, ok := strs[args[1]]; ok {
+							resp = bulk(v)
+						} else {
+							resp = "$-1\r\n"
+						}
+					case "DEL":
+						delete(strs, args[1])
+						resp = ":1\r\n"
+					case "HSET":
+						if hashes[args[1]] == nil {
+							hashes[args[1]] = map[string]string{}
+						}
+						hashes[args[1]][args[2]] = args[3]
+						resp = ":1\r\n"
+					case "HGETALL":
+						resp = fmt.Sprintf("*%d\r\n", len(hashes[args[1]])*2)
+						for k, v := range hashes[args[1]] {
+							resp += bulk(k) + bulk(v)
+						}
+					default:
+						resp = "-ERR unknown command\r\n"
+					}
+					mu.Unlock()
+					c.Write([]byte(resp))
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+func TestClient(t *testing.T) {
+	c := redis.New(fakeServer(t), "", 0, time.Second, 2)
+	ctx := context.Background()
+
+	if err := c.Ping(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.Get(ctx, "missing"); err != redis.ErrNil {
+		t.Fatalf("不存在的 key 应该返回 ErrNil: %v", err)
+	}
+	value := "line1\r\nline2"
+	if err := c.Set(ctx, "k", value, time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	if v, err := c.Get(ctx, "k"); err != nil || v != value {
+		t.Fatalf("读取的值不正确: %q, %v", v, err)
+	}
+	if _, err := c.Do(ctx, "UNKNOWN"); err == nil {
+		t.Fatal("服务端错误应该返回 error")
+	}
+
+	c.HSet(ctx, "h", "a", "1")
+	c.HSet(ctx, "h", "b", "2")
+	if m, err := c.HGetAll(ctx, "h"); err != nil || len(m) != 2 || m["b"] != "2" {
+		t.Fatalf("读取哈希表失败: %v, %v", m, err)
+	}
+}
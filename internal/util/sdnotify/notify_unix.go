@@ -0,0 +1,19 @@
+//go:build !windows
+
+package sdnotify
+
+import "net"
+
+// send 将通知内容写入 systemd 的 unix 数据报套接字
+//
+// 以 @ 开头的地址为 Linux 抽象命名空间套接字, 由标准库自动转换
+func send(socket, msg string) error {
+	addr := &net.UnixAddr{Name: socket, Net: "unixgram"}
+	conn, err := net.DialUnix("unixgram", nil, addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	_, err = conn.Write([]byte(msg))
+	return err
+}
@@ -0,0 +1,8 @@
+//go:build windows
+
+package sdnotify
+
+// send Windows 下不存在 systemd, 不做任何处理
+func send(socket, msg string) error {
+	return nil
+}
@@ -0,0 +1,63 @@
+// systemd 服务状态通知 (sd_notify)
+package sdnotify
+
+import (
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// Ready 服务启动完成
+	Ready = "READY=1"
+	// Reloading 服务正在重新加载, 完成后需要再次发送 Ready
+	Reloading = "RELOADING=1"
+	// Stopping 服务正在停止
+	Stopping = "STOPPING=1"
+	// Watchdog 看门狗心跳
+	Watchdog = "WATCHDOG=1"
+)
+
+// Status 生成在 systemctl status 中展示的状态描述
+func Status(msg string) string {
+	return "STATUS=" + strings.ReplaceAll(msg, "\n", " ")
+}
+
+// Notify 向 systemd 发送状态通知, 未由 systemd 启动时不做任何处理
+func Notify(states ...string) error {
+	socket := os.Getenv("NOTIFY_SOCKET")
+	if socket == "" || len(states) == 0 {
+		return nil
+	}
+	return send(socket, strings.Join(states, "\n"))
+}
+
+// WatchdogInterval 获取 systemd 要求的看门狗心跳间隔
+//
+// 未开启看门狗 (WatchdogSec) 或者看门狗不是针对当前进程时, ok 返回 false
+func WatchdogInterval() (interval time.Duration, ok bool) {
+	usec, err := strconv.ParseInt(os.Getenv("WATCHDOG_USEC"), 10, 64)
+	if err != nil || usec <= 0 {
+		return 0, false
+	}
+	if pid := os.Getenv("WATCHDOG_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return 0, false
+	}
+	return time.Duration(usec) * time.Microsecond, true
+}
+
+// StartWatchdog 开启看门狗时, 按照一半的超时时间定期发送心跳
+func StartWatchdog() {
+	interval, ok := WatchdogInterval()
+	if !ok {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(interval / 2)
+		defer ticker.Stop()
+		for range ticker.C {
+			Notify(Watchdog)
+		}
+	}()
+}
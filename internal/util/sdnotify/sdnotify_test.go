@@ -0,0 +1,69 @@
+//go:build !windows
+
+package sdnotify_test
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/sdnotify"
+)
+
+func TestNotify(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "notify.sock")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: socket, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	t.Setenv("NOTIFY_SOCKET", socket)
+	if err := sdnotify.Notify(sdnotify.Ready, sdnotify.Status("等待依赖\n服务就绪")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "READY=1\nSTATUS=等待依赖 服务就绪"
+	if got := string(buf[:n]); got != want {
+		t.Errorf("Notify() = %q, want %q", got, want)
+	}
+}
+
+func TestNotifyDisabled(t *testing.T) {
+	t.Setenv("NOTIFY_SOCKET", "")
+	if err := sdnotify.Notify(sdnotify.Ready); err != nil {
+		t.Errorf("Notify() error = %v, want nil", err)
+	}
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	pid := strconv.Itoa(os.Getpid())
+	tests := []struct {
+		usec, pid string
+		want      time.Duration
+		ok        bool
+	}{
+		{"", "", 0, false},
+		{"invalid", "", 0, false},
+		{"30000000", "", time.Second * 30, true},
+		{"30000000", pid, time.Second * 30, true},
+		{"30000000", "1", 0, false},
+	}
+	for _, tt := range tests {
+		t.Setenv("WATCHDOG_USEC", tt.usec)
+		t.Setenv("WATCHDOG_PID", tt.pid)
+		got, ok := sdnotify.WatchdogInterval()
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("WatchdogInterval(%q, %q) = %v, %v, want %v, %v", tt.usec, tt.pid, got, ok, tt.want, tt.ok)
+		}
+	}
+}
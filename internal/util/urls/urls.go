@@ -4,6 +4,7 @@ import (
 	"log"
 	"net/url"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
@@ -18,13 +19,25 @@ func IsRemote(path string) bool {
 	return u.Host != ""
 }
 
+// winDriveRegex 匹配 Windows 盘符路径, 如: D:\Media, d:/Media
+var winDriveRegex = regexp.MustCompile(`^[A-Za-z]:([\\/]|$)`)
+
+// IsWinDrivePath 判断路径是否以 Windows 盘符开头
+func IsWinDrivePath(p string) bool {
+	return winDriveRegex.MatchString(p)
+}
+
 // TransferSlash 将传递的路径的斜杠转换为正斜杠
 //
+// Windows 盘符路径同时将盘符转换为大写, 如: d:\Media\a.mkv => D:/Media/a.mkv;
 // 如果传递的参数不是一个路径, 不作任何处理
 func TransferSlash(p string) string {
 	if strs.AnyEmpty(p) {
 		return p
 	}
+	if IsWinDrivePath(p) {
+		return strings.ToUpper(p[:1]) + strings.ReplaceAll(p[1:], `\`, `/`)
+	}
 	_, err := url.Parse(p)
 	if err != nil {
 		return p
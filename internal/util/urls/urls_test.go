@@ -42,3 +42,19 @@ func TestIsRemote(t *testing.T) {
 		})
 	}
 }
+
+func TestTransferSlash(t *testing.T) {
+	tests := map[string]string{
+		`D:\Media\movie\a.mkv`: "D:/Media/movie/a.mkv",
+		`d:\Media\100%.mkv`:    "D:/Media/100%.mkv",
+		"e:/Media/a.mkv":       "E:/Media/a.mkv",
+		`D:`:                   "D:",
+		"/data/movie/a.mkv":    "/data/movie/a.mkv",
+		"":                     "",
+	}
+	for p, want := range tests {
+		if got := urls.TransferSlash(p); got != want {
+			t.Errorf("TransferSlash(%q) = %q, want %q", p, got, want)
+		}
+	}
+}
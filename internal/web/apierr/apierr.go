@@ -0,0 +1,125 @@
+// 统一的异常响应, 所有代理接口的异常均以相同结构的 json 返回,
+// 通过异常码区分异常类型, 便于客户端和监控面板按类型处理
+package apierr
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Code 异常码
+type Code string
+
+const (
+	InvalidRequest      Code = "INVALID_REQUEST"        // 请求参数错误
+	Unauthorized        Code = "UNAUTHORIZED"           // 鉴权失败
+	NotFound            Code = "NOT_FOUND"              // 资源不存在或功能未启用
+	MethodNotAllowed    Code = "METHOD_NOT_ALLOWED"     // 不支持的请求方法
+	BodyTooLarge        Code = "BODY_TOO_LARGE"         // 请求体大小超出限制
+	StreamLimited       Code = "STREAM_LIMITED"         // 超出并发串流数限制
+	ServiceStarting     Code = "SERVICE_STARTING"       // 服务启动中, 依赖尚未就绪
+	UpstreamEmbyDown    Code = "UPSTREAM_EMBY_DOWN"     // emby 源服务器不可用
+	UpstreamAlistDown   Code = "UPSTREAM_ALIST_DOWN"    // alist 不可用
+	MediaSourceNotFound Code = "MEDIA_SOURCE_NOT_FOUND" // 获取不到资源的 MediaSource
+	PathMapMiss         Code = "PATH_MAP_MISS"          // 路径映射之后在 alist 中找不到资源
+	AlistResolveFailed  Code = "ALIST_RESOLVE_FAILED"   // alist 直链解析失败
+	PlaybackCacheMiss   Code = "PLAYBACK_CACHE_MISS"    // 查找不到 PlaybackInfo 缓存
+	TranscodeFailed     Code = "TRANSCODE_FAILED"       // 转码播放列表、分片或字幕代理失败
+	ProxyFailed         Code = "PROXY_FAILED"           // 其他代理异常
+	Internal            Code = "INTERNAL_ERROR"         // 程序内部异常
+)
+
+const (
+	// HeaderErrorCode 异常码响应头, 重定向回源等非 json 响应也会携带
+	HeaderErrorCode = "X-Error-Code"
+
+	// GinKeyRequestId 记录当前请求 id 的 gin key
+	GinKeyRequestId = "request-id"
+)
+
+// Response 统一的异常响应结构
+type Response struct {
+	Code      int    `json:"code"`      // 响应码
+	Error     Code   `json:"error"`     // 异常码
+	Message   string `json:"message"`   // 异常信息
+	RequestId string `json:"requestId"` // 请求 id, 用于在日志中定位问题
+}
+
+// Respond 返回统一结构的异常响应, 并中断后续的处理
+func Respond(c *gin.Context, status int, code Code, message string) {
+	c.Header(HeaderErrorCode, string(code))
+	c.AbortWithStatusJSON(status, Response{
+		Code:      status,
+		Error:     code,
+		Message:   message,
+		RequestId: c.GetString(GinKeyRequestId),
+	})
+}
+
+// StatusOf 获取异常码对应的默认响应码
+func StatusOf(code Code) int {
+	switch code {
+	case InvalidRequest:
+		return http.StatusBadRequest
+	case Unauthorized:
+		return http.StatusUnauthorized
+	case NotFound, MediaSourceNotFound, PathMapMiss:
+		return http.StatusNotFound
+	case MethodNotAllowed:
+		return http.StatusMethodNotAllowed
+	case BodyTooLarge:
+		return http.StatusRequestEntityTooLarge
+	case StreamLimited:
+		return http.StatusTooManyRequests
+	case ServiceStarting:
+		return http.StatusServiceUnavailable
+	case UpstreamEmbyDown, UpstreamAlistDown, AlistResolveFailed:
+		return http.StatusBadGateway
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Respondf 返回统一结构的异常响应, 异常信息支持格式化
+func Respondf(c *gin.Context, status int, code Code, format string, args ...interface{}) {
+	Respond(c, status, code, fmt.Sprintf(format, args...))
+}
+
+// Error 携带异常码的 error
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New 创建携带异常码的 error
+func New(code Code, format string, args ...interface{}) error {
+	return &Error{Code: code, Err: fmt.Errorf(format, args...)}
+}
+
+// Wrap 为 err 附加异常码, err 为空时返回空
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Code: code, Err: err}
+}
+
+// CodeOf 获取 err 中的异常码, 没有携带异常码时返回 ProxyFailed
+func CodeOf(err error) Code {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Code
+	}
+	return ProxyFailed
+}
@@ -0,0 +1,60 @@
+package web
+
+import (
+	"log"
+	"net/http"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/admin"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/redact"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// OriginBypassHeaderKey 请求携带该请求头 (值为 1 或 true) 时, 跳过本程序的所有处理逻辑直接回源
+	OriginBypassHeaderKey = "X-Origin-Bypass"
+	// OriginBypassedHeaderKey 响应中标记请求已经直接回源
+	OriginBypassedHeaderKey = "X-Origin-Bypassed"
+)
+
+// originBypass 回源调试中间件
+//
+// 请求携带 X-Origin-Bypass 请求头以及正确的管理密钥时, 跳过所有的改写, 缓存和直链逻辑,
+// 将请求原样转发到源服务器, 便于对比本程序和源服务器的处理结果; 管理密钥不会转发到源服务器
+func originBypass() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.GetHeader(OriginBypassHeaderKey) {
+		case "":
+			return
+		case "1", "true":
+		default:
+			apierr.Respond(c, http.StatusBadRequest, apierr.InvalidRequest, OriginBypassHeaderKey+" 的值只能为 1 或 true")
+			return
+		}
+		if !admin.CheckToken(c) {
+			apierr.Respond(c, http.StatusForbidden, apierr.Unauthorized, "回源调试需要携带正确的管理密钥")
+			return
+		}
+
+		c.Request.Header.Del(OriginBypassHeaderKey)
+		c.Request.Header.Del(admin.HeaderTokenName)
+		if q := c.Request.URL.Query(); q.Has(admin.QueryTokenName) {
+			q.Del(admin.QueryTokenName)
+			c.Request.URL.RawQuery = q.Encode()
+		}
+		log.Printf(colors.ToYellow("回源调试, 请求原样转发到源服务器: %s %s"), c.Request.Method, redact.String(c.Request.URL.RequestURI()))
+
+		c.Abort()
+		c.Header(OriginBypassedHeaderKey, "1")
+		if err := https.ProxyRequest(c, config.C.Emby.Host, true); err != nil {
+			log.Printf(colors.ToRed("回源调试代理异常: %v"), err)
+			if !c.Writer.Written() {
+				apierr.Respond(c, http.StatusBadGateway, apierr.UpstreamEmbyDown, "源服务器不可用, 请检查日志")
+			}
+		}
+	}
+}
@@ -5,20 +5,29 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"net/http"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
 	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/encrypts"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/geoip"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/urls"
 
 	"github.com/gin-gonic/gin"
 )
 
+// GinKeyCacheStatus 记录当前请求缓存命中状态的 gin key
+//
+// 取值: HIT(命中缓存), MISS(未命中缓存), BYPASS(不参与缓存), REVALIDATED(条件请求校验后复用缓存)
+const GinKeyCacheStatus = "cache-status"
+
 // CacheKeyIgnoreParams 忽略的请求头或者参数
 //
 // 如果请求地址包含列表中的请求头或者参数, 则不参与 cacheKey 运算
@@ -53,9 +62,43 @@ func CacheableRouteMarker() gin.HandlerFunc {
 		regexp.MustCompile(constant.Reg_ResourceStream),
 		regexp.MustCompile(constant.Reg_ItemDownload),
 		regexp.MustCompile(constant.Reg_UserItemsRandomWithLimit),
+		regexp.MustCompile(constant.Reg_ChapterImages),
+		regexp.MustCompile(constant.Reg_Images),
+	}
+
+	// Infuse 同步媒体库时请求的接口, 使用单独的缓存时间
+	infusePatterns := []*regexp.Regexp{
+		regexp.MustCompile(constant.Reg_UserItems),
+		regexp.MustCompile(constant.Reg_UserItemsList),
+		regexp.MustCompile(constant.Reg_UserEpisodeItems),
+		regexp.MustCompile(constant.Reg_Images),
+	}
+
+	// 首页继续观看和下一集列表, 使用单独的缓存时间
+	homeListPatterns := []*regexp.Regexp{
+		regexp.MustCompile(constant.Reg_ShowsNextUp),
+		regexp.MustCompile(constant.Reg_UserItemsResume),
 	}
 
 	return func(c *gin.Context) {
+		if homeLists := config.C.Cache.HomeLists; homeLists.Enable {
+			for _, pattern := range homeListPatterns {
+				if pattern.MatchString(c.Request.RequestURI) {
+					c.Header(HeaderKeyExpired, Duration(homeLists.ExpiredDuration()))
+					return
+				}
+			}
+		}
+
+		if infuse := config.C.Cache.Infuse; infuse.Match(c.GetHeader("User-Agent")) {
+			for _, pattern := range infusePatterns {
+				if pattern.MatchString(c.Request.RequestURI) {
+					c.Header(HeaderKeyExpired, Duration(infuse.ExpiredDuration()))
+					return
+				}
+			}
+		}
+
 		for _, pattern := range cacheablePatterns {
 			if pattern.MatchString(c.Request.RequestURI) {
 				return
@@ -70,6 +113,7 @@ func RequestCacher() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// 1 判断请求是否需要缓存
 		if c.Writer.Header().Get(HeaderKeyExpired) == "-1" {
+			c.Set(GinKeyCacheStatus, "BYPASS")
 			return
 		}
 
@@ -83,30 +127,75 @@ func RequestCacher() gin.HandlerFunc {
 
 		// 3 尝试获取缓存
 		if rc, ok := getCache(cacheKey); ok {
-			if https.IsRedirectCode(rc.code) {
-				// 适配重定向请求
-				c.Redirect(rc.code, rc.header.header.Get("Location"))
-			} else {
-				c.Status(rc.code)
-				https.CloneHeader(c, rc.header.header)
-				c.Writer.Write(rc.body)
-			}
-			c.Abort()
+			c.Set(GinKeyCacheStatus, "HIT")
+			writeCache(c, rc)
 			return
 		}
 
+		// 相同的请求正在回源时, 等待并复用其响应, 避免缓存失效时集中回源
+		call, leader := joinInflight(cacheKey)
+		if !leader {
+			if rc, ok := call.wait(); ok {
+				c.Set(GinKeyCacheStatus, "HIT")
+				writeCache(c, rc)
+				return
+			}
+		} else {
+			defer call.finish()
+		}
+
 		// 4 使用自定义的响应器
-		customWriter := &respCacheWriter{body: bytes.NewBufferString(""), ResponseWriter: c.Writer}
+		c.Set(GinKeyCacheStatus, "MISS")
+		customWriter := &respCacheWriter{
+			body:           bytes.NewBufferString(""),
+			ResponseWriter: c.Writer,
+			maxBodySize:    config.C.Cache.MaxBodySizeBytes(),
+		}
 		c.Writer = customWriter
 
+		// 过期缓存携带校验信息时, 向上游发起条件请求, 客户端自身发起的条件请求不做处理
+		stale, ok := getRevalidatableCache(cacheKey)
+		if ok && c.Request.Method == http.MethodGet &&
+			c.GetHeader("If-None-Match") == "" && c.GetHeader("If-Modified-Since") == "" {
+			if etag := stale.Header("ETag"); etag != "" {
+				c.Request.Header.Set("If-None-Match", etag)
+			}
+			if lastModified := stale.Header("Last-Modified"); lastModified != "" {
+				c.Request.Header.Set("If-Modified-Since", lastModified)
+			}
+			customWriter.revalidating = true
+		}
+
 		// 5 执行请求处理器
 		c.Next()
 
+		// 上游响应 304, 复用过期缓存的响应体并刷新过期时间
+		if customWriter.notModified {
+			customWriter.revalidating, customWriter.notModified = false, false
+			c.Set(GinKeyCacheStatus, "REVALIDATED")
+			rc, cacheable := refreshCache(stale, c.Writer.Header())
+			writeCache(c, rc)
+			if cacheable {
+				if leader {
+					call.rc = rc
+				}
+				go putCache(rc)
+			}
+			return
+		}
+
 		// 6 不缓存错误请求
 		if https.IsErrorResponse(c) {
 			return
 		}
 
+		// 响应体超出大小限制, 不缓存
+		if customWriter.oversize {
+			c.Set(GinKeyCacheStatus, "BYPASS")
+			logs.Debugf("响应体超出缓存大小限制 [%s], 跳过缓存: %s", config.C.Cache.MaxBodySize, c.Request.RequestURI)
+			return
+		}
+
 		// 7 刷新缓存
 		header := c.Writer.Header()
 		respHeader := respHeader{
@@ -119,8 +208,48 @@ func RequestCacher() gin.HandlerFunc {
 		defer header.Del(HeaderKeySpace)
 		defer header.Del(HeaderKeySpaceKey)
 
-		go putCache(cacheKey, c, customWriter.body, respHeader)
+		rc, ok := newRespCache(cacheKey, c, customWriter.body, respHeader)
+		if !ok {
+			return
+		}
+		if leader {
+			call.rc = rc
+		}
+		go putCache(rc)
+	}
+}
+
+// refreshCache 基于过期缓存构造一个新的缓存对象, 过期时间按照当前请求处理器设置的响应头重新计算
+//
+// 请求处理器指定不缓存时, 第二个参数返回 false
+func refreshCache(stale *respCache, header http.Header) (*respCache, bool) {
+	expiredMillis, cacheable := calcExpired(header.Get(HeaderKeyExpired))
+	header.Del(HeaderKeyExpired)
+	header.Del(HeaderKeySpace)
+	header.Del(HeaderKeySpaceKey)
+
+	stale.mu.RLock()
+	defer stale.mu.RUnlock()
+	return &respCache{
+		code:     stale.code,
+		body:     stale.body,
+		cacheKey: stale.cacheKey,
+		expired:  expiredMillis,
+		header:   stale.header,
+	}, cacheable
+}
+
+// writeCache 将缓存的响应回写给客户端, 并终止后续的处理器
+func writeCache(c *gin.Context, rc *respCache) {
+	if https.IsRedirectCode(rc.code) {
+		// 适配重定向请求
+		c.Redirect(rc.code, rc.header.header.Get("Location"))
+	} else {
+		c.Status(rc.code)
+		https.CloneHeader(c, rc.header.header)
+		c.Writer.Write(rc.body)
 	}
+	c.Abort()
 }
 
 // Duration 将一个标准的时间转换成适用于缓存时间的字符串
@@ -181,6 +310,12 @@ func calcCacheKey(c *gin.Context) (string, error) {
 		c.Request.URL.RawQuery, "",
 	)
 
-	hash := encrypts.Md5Hash(method + uriNoArgs + preEnc)
+	// 启用 geo 时, 不同地区的客户端会被重定向到不同的链接, 需要分开缓存
+	geo := ""
+	if rule, _ := geoip.Rule(c.ClientIP()); rule != nil && rule.Action != config.GeoRedirect {
+		geo = string(rule.Action) + rule.CdnPrefix
+	}
+
+	hash := encrypts.Md5Hash(Version() + method + uriNoArgs + preEnc + geo)
 	return hash, nil
 }
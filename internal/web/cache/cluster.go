@@ -0,0 +1,131 @@
+package cache
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/cluster"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+)
+
+// versionSyncInterval 集群模式下同步缓存版本的间隔
+const versionSyncInterval = time.Second * 10
+
+// clusterSyncOnce 保证版本同步任务只启动一次
+var clusterSyncOnce sync.Once
+
+// sharedCache 共享到 redis 中的缓存结构
+type sharedCache struct {
+	Code     int
+	Body     []byte
+	Expired  int64 // 过期时间戳 UnixMilli
+	Space    string
+	SpaceKey string
+	Header   http.Header
+}
+
+// StartClusterSync 集群模式下启动缓存版本的同步任务, 使其他副本更新的版本在本副本生效
+func StartClusterSync() {
+	if !cluster.Enabled() {
+		return
+	}
+	clusterSyncOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(versionSyncInterval)
+			defer ticker.Stop()
+			for range ticker.C {
+				if v, ok := cluster.Get(cluster.Key("cache-version")); ok && v != Version() {
+					setVersion(v)
+				}
+			}
+		}()
+	})
+}
+
+// shareCache 将缓存写入 redis, 过期时间与本地缓存一致
+func shareCache(rc *respCache) {
+	rc.mu.RLock()
+	sc := sharedCache{
+		Code:     rc.code,
+		Body:     rc.body,
+		Expired:  rc.expired,
+		Space:    rc.header.space,
+		SpaceKey: rc.header.spaceKey,
+		Header:   rc.header.header,
+	}
+	bytes, err := json.Marshal(sc)
+	rc.mu.RUnlock()
+	if err != nil {
+		log.Printf(colors.ToRed("序列化共享缓存失败: %v"), err)
+		return
+	}
+
+	ttl := time.Until(time.UnixMilli(sc.Expired))
+	if rc.Revalidatable() {
+		ttl += RevalidateGrace
+	}
+	if ttl <= 0 {
+		return
+	}
+	cluster.Set(cluster.Key("cache", rc.cacheKey), string(bytes), ttl)
+	if strs.AllNotEmpty(sc.Space, sc.SpaceKey) {
+		cluster.Set(cluster.Key("space", sc.Space, sc.SpaceKey), rc.cacheKey, ttl)
+	}
+}
+
+// loadSharedCache 从 redis 中获取其他副本共享的未过期缓存, 获取到之后同时写入本地
+func loadSharedCache(cacheKey string) (*respCache, bool) {
+	value, ok := cluster.Get(cluster.Key("cache", cacheKey))
+	if !ok {
+		return nil, false
+	}
+	var sc sharedCache
+	if err := json.Unmarshal([]byte(value), &sc); err != nil {
+		log.Printf(colors.ToYellow("解析共享缓存失败: %v"), err)
+		return nil, false
+	}
+	if time.Now().UnixMilli() > sc.Expired {
+		return nil, false
+	}
+	if sc.Header == nil {
+		sc.Header = make(http.Header)
+	}
+
+	rc := &respCache{
+		code:     sc.Code,
+		body:     sc.Body,
+		cacheKey: cacheKey,
+		expired:  sc.Expired,
+		header: respHeader{
+			space:    sc.Space,
+			spaceKey: sc.SpaceKey,
+			header:   sc.Header,
+		},
+		fromCluster: true,
+	}
+	rc.touch()
+	go putCache(rc)
+	return rc, true
+}
+
+// loadSharedSpaceCache 从 redis 中获取其他副本共享的缓存空间缓存
+func loadSharedSpaceCache(space, spaceKey string) (*respCache, bool) {
+	cacheKey, ok := cluster.Get(cluster.Key("space", space, spaceKey))
+	if !ok {
+		return nil, false
+	}
+	return loadSharedCache(cacheKey)
+}
+
+// unshareCache 从 redis 中删除缓存
+func unshareCache(rc *respCache) {
+	keys := []string{cluster.Key("cache", rc.cacheKey)}
+	if space, spaceKey := rc.Space(), rc.SpaceKey(); strs.AllNotEmpty(space, spaceKey) {
+		keys = append(keys, cluster.Key("space", space, spaceKey))
+	}
+	cluster.Del(keys...)
+}
@@ -3,10 +3,13 @@ package cache
 import (
 	"bytes"
 	"log"
+	"math/rand"
 	"strconv"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/AmbitiousJun/go-emby2alist/internal/cluster"
 	"github.com/AmbitiousJun/go-emby2alist/internal/config"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
@@ -26,10 +29,14 @@ const (
 
 	// HeaderKeyExpired 缓存过期响应头, 用于覆盖默认的缓存过期时间
 	HeaderKeyExpired = "Expired"
+
+	// RevalidateGrace 携带 ETag/Last-Modified 的缓存过期后继续保留的时间,
+	// 期间再次请求时向上游发起条件请求, 上游响应 304 时复用缓存
+	RevalidateGrace = time.Hour * 24
 )
 
 // currentCacheSize 当前内存中的缓存大小 (Byte)
-var currentCacheSize int64 = 0
+var currentCacheSize atomic.Int64
 
 // DefaultExpired 默认的请求过期时间
 //
@@ -64,7 +71,12 @@ func loopMaintainCache() {
 
 		cacheMap.Range(func(key, value any) bool {
 			rc := value.(*respCache)
-			if nowMillis > rc.expired || validCnt == MaxCacheNum || currentCacheSize > MaxCacheSize {
+			deadline := rc.expired
+			if rc.Revalidatable() {
+				// 携带校验信息的缓存过期后再保留一段时间, 用于向上游发起条件请求
+				deadline += RevalidateGrace.Milliseconds()
+			}
+			if nowMillis > deadline || validCnt == MaxCacheNum || currentCacheSize.Load() > MaxCacheSize {
 				toDelete = append(toDelete, rc)
 			} else {
 				validCnt++
@@ -73,9 +85,7 @@ func loopMaintainCache() {
 		})
 
 		for _, rc := range toDelete {
-			cacheMap.Delete(rc.cacheKey)
-			currentCacheSize -= int64(len(rc.body))
-			delSpaceCache(rc.header.space, rc.header.spaceKey)
+			removeCache(rc)
 		}
 	}
 
@@ -83,12 +93,19 @@ func loopMaintainCache() {
 	//
 	// 同时淘汰掉过期缓存
 	putrespCache := func(rc *respCache) {
-		cacheMap.Store(rc.cacheKey, rc)
-		currentCacheSize += int64(len(rc.body))
+		if old, loaded := cacheMap.Swap(rc.cacheKey, rc); loaded {
+			// 覆盖同一个 key 的旧缓存时, 扣减旧缓存的大小
+			currentCacheSize.Add(-int64(len(old.(*respCache).body)))
+		}
+		currentCacheSize.Add(int64(len(rc.body)))
+		if cluster.Enabled() && !rc.fromCluster {
+			go shareCache(rc)
+		}
 		space, spaceKey := rc.header.space, rc.header.spaceKey
 		if strs.AllNotEmpty(space, spaceKey) {
 			putSpaceCache(space, spaceKey, rc)
 			log.Printf(colors.ToGreen("刷新缓存空间, space: %s, spaceKey: %s"), space, spaceKey)
+			limitSpace(space)
 		}
 	}
 
@@ -105,29 +122,69 @@ func loopMaintainCache() {
 	}
 }
 
-// getCache 根据 cacheKey 获取缓存
+// getCache 根据 cacheKey 获取未过期的缓存
+//
+// 过期缓存由清洗任务定期移除, 移除之前也不再返回; 集群模式下本地不存在时查询其他副本共享的缓存
 func getCache(cacheKey string) (*respCache, bool) {
-	if c, ok := cacheMap.Load(cacheKey); ok {
-		return c.(*respCache), true
+	c, ok := cacheMap.Load(cacheKey)
+	if !ok {
+		if cluster.Enabled() {
+			return loadSharedCache(cacheKey)
+		}
+		return nil, false
+	}
+	rc := c.(*respCache)
+	if time.Now().UnixMilli() > rc.expired {
+		return nil, false
 	}
-	return nil, false
+	rc.touch()
+	return rc, true
 }
 
-// putCache 设置缓存
-func putCache(cacheKey string, c *gin.Context, respBody *bytes.Buffer, respHeader respHeader) {
+// getRevalidatableCache 根据 cacheKey 获取已经过期, 但可以向上游校验是否仍然有效的缓存
+func getRevalidatableCache(cacheKey string) (*respCache, bool) {
+	c, ok := cacheMap.Load(cacheKey)
+	if !ok {
+		return nil, false
+	}
+	rc := c.(*respCache)
+	if time.Now().UnixMilli() <= rc.expired || !rc.Revalidatable() {
+		return nil, false
+	}
+	return rc, true
+}
+
+// newRespCache 根据响应信息构造缓存对象, 响应不需要缓存时返回 false
+func newRespCache(cacheKey string, c *gin.Context, respBody *bytes.Buffer, respHeader respHeader) (*respCache, bool) {
 	if cacheKey == "" || c == nil || respBody == nil {
-		return
+		return nil, false
+	}
+
+	expiredMillis, ok := calcExpired(respHeader.expired)
+	if !ok {
+		return nil, false
+	}
+	rc := &respCache{
+		code:     c.Writer.Status(),
+		body:     respBody.Bytes(),
+		cacheKey: cacheKey,
+		expired:  expiredMillis,
+		header:   respHeader,
 	}
+	rc.touch()
+	return rc, true
+}
 
-	// 计算缓存过期时间
+// calcExpired 根据 Expired 响应头计算缓存过期时间戳 (UnixMilli), 响应不需要缓存时返回 false
+func calcExpired(expired string) (int64, bool) {
 	nowMillis := time.Now().UnixMilli()
-	expiredMillis := int64(DefaultExpired()) + nowMillis
-	if expiredNum, err := strconv.Atoi(respHeader.expired); err == nil {
+	expiredMillis := DefaultExpired().Milliseconds() + nowMillis
+	if expiredNum, err := strconv.Atoi(expired); err == nil {
 		customMillis := int64(expiredNum)
 
 		// 特定接口不使用缓存
 		if customMillis < 0 {
-			return
+			return 0, false
 		}
 
 		if customMillis > nowMillis {
@@ -135,14 +192,16 @@ func putCache(cacheKey string, c *gin.Context, respBody *bytes.Buffer, respHeade
 		}
 	}
 
-	rc := &respCache{
-		code:     c.Writer.Status(),
-		body:     respBody.Bytes(),
-		cacheKey: cacheKey,
-		expired:  expiredMillis,
-		header:   respHeader,
+	// 过期时间随机提前, 只提前不延后, 避免超出特定接口 (如直链) 的有效期
+	if jitter := config.C.Cache.Jitter; jitter > 0 {
+		ttl := expiredMillis - nowMillis
+		expiredMillis -= int64(float64(ttl) * float64(jitter) / 100 * rand.Float64())
 	}
+	return expiredMillis, true
+}
 
+// putCache 设置缓存
+func putCache(rc *respCache) {
 	// 依据先进先淘汰原则, 将最新缓存放入预缓存通道中
 	cacheHandleWaitGroup.Add(1)
 	doneOnce := sync.OnceFunc(cacheHandleWaitGroup.Done)
@@ -157,3 +216,120 @@ func putCache(cacheKey string, c *gin.Context, respBody *bytes.Buffer, respHeade
 		}
 	}
 }
+
+// removeCache 移除缓存, 同时移除缓存空间中的引用
+//
+// 缓存可能被清洗任务和手动清除同时移除, 只有真正移除的一方扣减缓存大小
+func removeCache(rc *respCache) {
+	if _, loaded := cacheMap.LoadAndDelete(rc.cacheKey); loaded {
+		currentCacheSize.Add(-int64(len(rc.body)))
+	}
+	delSpaceCache(rc.header.space, rc.header.spaceKey)
+}
+
+// SweepStale 全量清洗已经过期的缓存, 返回清除的缓存个数
+//
+// 与定期的清洗任务不同, 携带校验信息的缓存过期后也会被清除, 不再保留用于条件请求
+func SweepStale() int {
+	nowMillis := time.Now().UnixMilli()
+	toDelete := make([]*respCache, 0)
+	cacheMap.Range(func(_, value any) bool {
+		if rc := value.(*respCache); nowMillis > rc.expired {
+			toDelete = append(toDelete, rc)
+		}
+		return true
+	})
+	for _, rc := range toDelete {
+		removeCache(rc)
+	}
+	return len(toDelete)
+}
+
+// Purge 手动清除缓存, 返回清除的缓存个数
+//
+// space 为空时清除所有缓存, 否则只清除指定缓存空间中的缓存;
+// 集群模式下同时删除这些缓存在 redis 中的共享副本
+func Purge(space string) int {
+	toDelete := make([]*respCache, 0)
+	if strs.AnyEmpty(space) {
+		cacheMap.Range(func(_, value any) bool {
+			toDelete = append(toDelete, value.(*respCache))
+			return true
+		})
+	} else {
+		getSpace(space).Range(func(_, value any) bool {
+			toDelete = append(toDelete, value.(*respCache))
+			return true
+		})
+	}
+
+	for _, rc := range toDelete {
+		removeCache(rc)
+		if cluster.Enabled() {
+			unshareCache(rc)
+		}
+	}
+	log.Printf(colors.ToYellow("手动清除缓存, space: %s, 个数: %d"), space, len(toDelete))
+	return len(toDelete)
+}
+
+// PurgeSpaceFunc 清除缓存空间中 spaceKey 满足条件的缓存, 返回清除的缓存个数
+//
+// 集群模式下同时删除这些缓存在 redis 中的共享副本
+func PurgeSpaceFunc(space string, match func(spaceKey string) bool) int {
+	if strs.AnyEmpty(space) {
+		return 0
+	}
+	toDelete := make([]*respCache, 0)
+	getSpace(space).Range(func(key, value any) bool {
+		if match(key.(string)) {
+			toDelete = append(toDelete, value.(*respCache))
+		}
+		return true
+	})
+
+	for _, rc := range toDelete {
+		removeCache(rc)
+		if cluster.Enabled() {
+			unshareCache(rc)
+		}
+	}
+	return len(toDelete)
+}
+
+// Stats 缓存统计信息
+type Stats struct {
+	Num        int              // 缓存个数
+	Size       int64            // 缓存响应体总大小 (Byte)
+	Spaces     map[string]int   // 各个缓存空间的缓存个数
+	SpaceSizes map[string]int64 // 各个缓存空间的响应体总大小 (Byte)
+	Version    string           // 当前的缓存版本
+}
+
+// GetStats 获取当前的缓存统计信息
+func GetStats() Stats {
+	stats := Stats{
+		Size:       currentCacheSize.Load(),
+		Spaces:     make(map[string]int),
+		SpaceSizes: make(map[string]int64),
+		Version:    Version(),
+	}
+	cacheMap.Range(func(_, _ any) bool {
+		stats.Num++
+		return true
+	})
+	spaceMap.Range(func(key, value any) bool {
+		cnt, size := 0, int64(0)
+		value.(*sync.Map).Range(func(_, v any) bool {
+			rc := v.(*respCache)
+			rc.mu.RLock()
+			cnt, size = cnt+1, size+int64(len(rc.body))
+			rc.mu.RUnlock()
+			return true
+		})
+		stats.Spaces[key.(string)] = cnt
+		stats.SpaceSizes[key.(string)] = size
+		return true
+	})
+	return stats
+}
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// InflightWaitTimeout 等待相同请求回源结果的最长时间, 超时后自行回源
+const InflightWaitTimeout = time.Second * 30
+
+// inflightCall 正在回源的请求
+type inflightCall struct {
+	key  string        // 请求的 cacheKey
+	done chan struct{} // 回源结束时关闭
+	rc   *respCache    // 回源得到的可缓存响应, 不可缓存时为空
+}
+
+// inflightCalls 正在回源的请求, key 为 cacheKey
+var inflightCalls sync.Map
+
+// joinInflight 登记一个回源请求
+//
+// 相同 cacheKey 的请求正在回源时, 返回该请求以及 false;
+// 否则登记当前请求, 返回 true, 调用方需要在回源结束后调用 finish
+func joinInflight(cacheKey string) (*inflightCall, bool) {
+	call := &inflightCall{key: cacheKey, done: make(chan struct{})}
+	if existing, loaded := inflightCalls.LoadOrStore(cacheKey, call); loaded {
+		return existing.(*inflightCall), false
+	}
+	return call, true
+}
+
+// wait 等待回源结束, 返回可复用的响应
+//
+// 回源的响应不可缓存或者等待超时时返回 false, 调用方需要自行回源
+func (ic *inflightCall) wait() (*respCache, bool) {
+	timer := time.NewTimer(InflightWaitTimeout)
+	defer timer.Stop()
+	select {
+	case <-ic.done:
+		return ic.rc, ic.rc != nil
+	case <-timer.C:
+		return nil, false
+	}
+}
+
+// finish 结束回源, 唤醒所有等待的请求
+func (ic *inflightCall) finish() {
+	inflightCalls.Delete(ic.key)
+	close(ic.done)
+}
@@ -3,8 +3,15 @@
 package cache
 
 import (
+	"net/http"
+	"sort"
 	"sync"
+	"time"
 
+	"github.com/AmbitiousJun/go-emby2alist/internal/cluster"
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/encrypts"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
 )
 
@@ -23,18 +30,57 @@ const (
 var spaceMap = sync.Map{}
 
 // GetSpaceCache 获取缓存空间的缓存对象
+//
+// 集群模式下本地不存在时查询其他副本共享的缓存
 func GetSpaceCache(space, spaceKey string) (RespCache, bool) {
 	if strs.AnyEmpty(space, spaceKey) {
 		return nil, false
 	}
 	s := getSpace(space)
 	rc, ok := getSpaceCache(s, spaceKey)
+	if !ok && cluster.Enabled() {
+		rc, ok = loadSharedSpaceCache(space, spaceKey)
+	}
 	if !ok {
 		return nil, false
 	}
 	return rc, true
 }
 
+// PutSpaceCache 将后台请求的响应直接写入缓存空间, 用于预取等不经过缓存中间件的场景
+func PutSpaceCache(space, spaceKey string, code int, header http.Header, body []byte, expired time.Duration) {
+	if strs.AnyEmpty(space, spaceKey) {
+		return
+	}
+	rc := &respCache{
+		code:     code,
+		body:     body,
+		cacheKey: encrypts.Md5Hash(Version() + space + spaceKey),
+		expired:  time.Now().Add(expired).UnixMilli(),
+		header: respHeader{
+			expired:  Duration(expired),
+			space:    space,
+			spaceKey: spaceKey,
+			header:   header.Clone(),
+		},
+	}
+	rc.touch()
+	putCache(rc)
+}
+
+// SpaceKeys 获取缓存空间中所有缓存的 key
+func SpaceKeys(space string) []string {
+	if strs.AnyEmpty(space) {
+		return nil
+	}
+	keys := make([]string, 0)
+	getSpace(space).Range(func(key, _ any) bool {
+		keys = append(keys, key.(string))
+		return true
+	})
+	return keys
+}
+
 // putSpaceCache 设置缓存到缓存空间中
 func putSpaceCache(space, spaceKey string, cache *respCache) {
 	if strs.AnyEmpty(space, spaceKey) {
@@ -50,6 +96,29 @@ func delSpaceCache(space, spaceKey string) {
 	getSpace(space).Delete(spaceKey)
 }
 
+// limitSpace 缓存空间的缓存个数超出 cache.spaces 配置的上限时, 淘汰最久未访问的缓存
+//
+// 避免单个缓存空间占满全局的缓存个数上限, 导致其他缓存被清洗任务淘汰
+func limitSpace(space string) {
+	limit := config.C.Cache.SpaceMaxEntries(space)
+	if limit <= 0 {
+		return
+	}
+	all := make([]*respCache, 0)
+	getSpace(space).Range(func(_, value any) bool {
+		all = append(all, value.(*respCache))
+		return true
+	})
+	if len(all) <= limit {
+		return
+	}
+	sort.Slice(all, func(i, j int) bool { return all[i].accessed.Load() < all[j].accessed.Load() })
+	for _, rc := range all[:len(all)-limit] {
+		removeCache(rc)
+	}
+	logs.Debugf("缓存空间 [%s] 超出个数上限 %d, 淘汰 %d 个最久未访问的缓存", space, limit, len(all)-limit)
+}
+
 // getSpace 获取缓存空间
 //
 // 不存在指定名称的空间时, 初始化一个新的空间
@@ -67,7 +136,9 @@ func getSpaceCache(space *sync.Map, spaceKey string) (*respCache, bool) {
 		return nil, false
 	}
 	if cache, ok := space.Load(spaceKey); ok {
-		return cache.(*respCache), true
+		rc := cache.(*respCache)
+		rc.touch()
+		return rc, true
 	}
 	return nil, false
 }
@@ -4,7 +4,10 @@ import (
 	"bytes"
 	"net/http"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/AmbitiousJun/go-emby2alist/internal/cluster"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/jsons"
 
 	"github.com/gin-gonic/gin"
@@ -14,10 +17,47 @@ import (
 type respCacheWriter struct {
 	gin.ResponseWriter               // gin 原始的响应器
 	body               *bytes.Buffer // gin 回写响应时, 同步缓存
+	revalidating       bool          // 当前请求是否携带了缓存的校验信息
+	notModified        bool          // 上游响应 304, 拦截响应等待复用缓存
+	maxBodySize        int64         // 允许缓存的最大响应体大小, 0 表示不限制
+	oversize           bool          // 响应体超出大小限制, 不再同步缓存
+}
+
+func (rcw *respCacheWriter) WriteHeader(code int) {
+	if rcw.revalidating && code == http.StatusNotModified {
+		rcw.notModified = true
+		return
+	}
+	rcw.ResponseWriter.WriteHeader(code)
+}
+
+func (rcw *respCacheWriter) WriteHeaderNow() {
+	if rcw.notModified {
+		return
+	}
+	rcw.ResponseWriter.WriteHeaderNow()
+}
+
+func (rcw *respCacheWriter) Flush() {
+	if rcw.notModified {
+		return
+	}
+	rcw.ResponseWriter.Flush()
 }
 
 func (rcw *respCacheWriter) Write(b []byte) (int, error) {
-	rcw.body.Write(b)
+	if rcw.notModified {
+		return len(b), nil
+	}
+	if !rcw.oversize {
+		if rcw.maxBodySize > 0 && int64(rcw.body.Len()+len(b)) > rcw.maxBodySize {
+			// 超出限制后释放已缓冲的数据, 剩余的响应直接透传
+			rcw.oversize = true
+			rcw.body = new(bytes.Buffer)
+		} else {
+			rcw.body.Write(b)
+		}
+	}
 	return rcw.ResponseWriter.Write(b)
 }
 
@@ -39,6 +79,12 @@ type respCache struct {
 	// header 响应头信息
 	header respHeader
 
+	// fromCluster 是否为从 redis 中获取的其他副本共享的缓存, 写入本地时无需再次共享
+	fromCluster bool
+
+	// accessed 最近一次写入或命中的时间戳 UnixMilli, 用于缓存空间内的 LRU 淘汰
+	accessed atomic.Int64
+
 	// mu 读写互斥控制
 	mu sync.RWMutex
 }
@@ -93,6 +139,18 @@ func (c *respCache) Headers() http.Header {
 	return c.header.header.Clone()
 }
 
+// Revalidatable 判断缓存是否携带了可以向上游校验的信息 (ETag/Last-Modified)
+func (c *respCache) Revalidatable() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.header.header.Get("ETag") != "" || c.header.header.Get("Last-Modified") != ""
+}
+
+// touch 记录缓存的访问时间
+func (c *respCache) touch() {
+	c.accessed.Store(time.Now().UnixMilli())
+}
+
 // Space 获取缓存空间名称
 func (c *respCache) Space() string {
 	c.mu.RLock()
@@ -121,8 +179,6 @@ func (c *respCache) Update(code int, body []byte, header http.Header) {
 		return
 	}
 	c.mu.Lock()
-	defer c.mu.Unlock()
-
 	if code != 0 {
 		c.code = code
 	}
@@ -135,4 +191,10 @@ func (c *respCache) Update(code int, body []byte, header http.Header) {
 	if header != nil {
 		c.header.header = header.Clone()
 	}
+	c.mu.Unlock()
+
+	// 集群模式下同步更新共享的缓存
+	if cluster.Enabled() {
+		go shareCache(c)
+	}
 }
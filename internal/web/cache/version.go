@@ -0,0 +1,41 @@
+package cache
+
+import (
+	"log"
+	"sync/atomic"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/cluster"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+)
+
+// version 缓存版本, 参与 cacheKey 运算, 版本变化后旧的缓存不再命中, 等待清洗任务淘汰
+var version atomic.Value
+
+// SetVersion 设置缓存版本, 集群模式下同步到其他副本
+//
+// 缓存空间通过 spaceKey 直接查找, 无法感知版本, 版本变化时一并清空
+func SetVersion(v string) {
+	setVersion(v)
+	if cluster.Enabled() {
+		cluster.Set(cluster.Key("cache-version"), v, 0)
+	}
+}
+
+// setVersion 设置本副本的缓存版本
+func setVersion(v string) {
+	old, _ := version.Swap(v).(string)
+	if old == v || old == "" {
+		return
+	}
+	spaceMap.Range(func(key, _ any) bool {
+		spaceMap.Delete(key)
+		return true
+	})
+	log.Printf(colors.ToYellow("缓存版本变更: %s => %s"), old, v)
+}
+
+// Version 获取当前的缓存版本
+func Version() string {
+	v, _ := version.Load().(string)
+	return v
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"log"
+	"runtime/debug"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/memstat"
+)
+
+// watchdogOnce 保证看门狗只启动一次
+var watchdogOnce sync.Once
+
+// StartWatchdog 按照 cache.watchdog 配置启动内存看门狗
+//
+// 内存占用超出阈值时从体积最大的缓存开始淘汰, 直到淘汰的大小足以回到阈值以下
+func StartWatchdog() {
+	cfg := config.C.Cache.Watchdog
+	if !cfg.Enable {
+		return
+	}
+	watchdogOnce.Do(func() {
+		go func() {
+			ticker := time.NewTicker(cfg.IntervalDuration())
+			defer ticker.Stop()
+			for range ticker.C {
+				usage, source := memstat.Usage()
+				threshold := cfg.ThresholdBytes()
+				if usage <= threshold {
+					continue
+				}
+				num, size := shrinkCache(usage - threshold)
+				// 将淘汰释放的内存立即归还给操作系统, 否则 RSS 不会下降
+				debug.FreeOSMemory()
+				after, _ := memstat.Usage()
+				log.Printf(colors.ToYellow("内存占用 (%s) %s 超出阈值 %s, 淘汰 %d 个缓存共 %s, 淘汰后: %s"),
+					source, mb(usage), mb(threshold), num, mb(size), mb(after))
+			}
+		}()
+	})
+}
+
+// shrinkCache 从体积最大的缓存开始淘汰, 直到淘汰的响应体大小达到 target, 返回淘汰的个数和大小
+func shrinkCache(target int64) (int, int64) {
+	all := make([]*respCache, 0)
+	cacheMap.Range(func(_, value any) bool {
+		all = append(all, value.(*respCache))
+		return true
+	})
+	sort.Slice(all, func(i, j int) bool { return len(all[i].body) > len(all[j].body) })
+
+	num, size := 0, int64(0)
+	for _, rc := range all {
+		if size >= target {
+			break
+		}
+		size += int64(len(rc.body))
+		removeCache(rc)
+		num++
+	}
+	return num, size
+}
+
+// mb 将字节数格式化为 MB
+func mb(size int64) string {
+	return strconv.FormatFloat(float64(size)/1024/1024, 'f', 1, 64) + "MB"
+}
@@ -0,0 +1,117 @@
+package web
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/capture"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/redact"
+
+	"github.com/gin-gonic/gin"
+)
+
+// captureWriter 回写响应时, 同步记录响应体的前 max 个字节
+type captureWriter struct {
+	gin.ResponseWriter
+	body      *bytes.Buffer
+	max       int64
+	size      int
+	truncated bool
+}
+
+func (cw *captureWriter) Write(b []byte) (int, error) {
+	cw.record(b)
+	return cw.ResponseWriter.Write(b)
+}
+
+func (cw *captureWriter) WriteString(s string) (int, error) {
+	cw.record([]byte(s))
+	return cw.ResponseWriter.WriteString(s)
+}
+
+// record 记录响应体, 超出大小限制的部分只统计大小
+func (cw *captureWriter) record(b []byte) {
+	cw.size += len(b)
+	remain := cw.max - int64(cw.body.Len())
+	if remain <= 0 {
+		cw.truncated = cw.truncated || len(b) > 0
+		return
+	}
+	if int64(len(b)) > remain {
+		b, cw.truncated = b[:remain], true
+	}
+	cw.body.Write(b)
+}
+
+// requestCapturer 录制请求和响应, 供管理接口导出排查
+//
+// 只录制 log.capture.routes 匹配的请求, 管理接口自身的请求不录制;
+// 被调试跟踪的请求在录制未开启时也会录制
+func requestCapturer() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		cfg := config.C.Log.Capture
+		traced := c.GetBool(emby.GinKeyDebugTrace)
+		if !traced && (!capture.Enabled() ||
+			strings.HasPrefix(strings.ToLower(c.Request.URL.Path), "/admin/") ||
+			!cfg.Match(c.Request.RequestURI)) {
+			return
+		}
+		max := cfg.MaxBodySizeBytes()
+
+		entry := capture.Entry{
+			RequestId: c.GetString(GinKeyRequestId),
+			Time:      time.Now(),
+			Method:    c.Request.Method,
+			Url:       redact.String(https.ClientRequestHost(c) + c.Request.URL.RequestURI()),
+			ReqHeader: captureHeader(c.Request.Header),
+		}
+
+		// 读取请求体之后重新放回, 不影响后续的处理
+		if c.Request.Body != nil && capture.IsText(c.GetHeader("Content-Type")) {
+			reqBody, err := io.ReadAll(io.LimitReader(c.Request.Body, max+1))
+			if err == nil {
+				c.Request.Body = struct {
+					io.Reader
+					io.Closer
+				}{io.MultiReader(bytes.NewReader(reqBody), c.Request.Body), c.Request.Body}
+				if int64(len(reqBody)) > max {
+					reqBody, entry.BodyTruncated = reqBody[:max], true
+				}
+				entry.ReqBody = redact.String(string(reqBody))
+			}
+		}
+
+		cw := &captureWriter{ResponseWriter: c.Writer, body: new(bytes.Buffer), max: max}
+		c.Writer = cw
+		c.Next()
+		c.Writer = cw.ResponseWriter
+
+		entry.Cost = time.Since(entry.Time).Milliseconds()
+		entry.Code = cw.Status()
+		entry.RespHeader = captureHeader(cw.Header())
+		entry.RespSize = cw.size
+		if capture.IsText(cw.Header().Get("Content-Type")) {
+			entry.RespBody = redact.String(cw.body.String())
+			entry.BodyTruncated = entry.BodyTruncated || cw.truncated
+		}
+		capture.Record(entry)
+	}
+}
+
+// captureHeader 克隆并脱敏请求头, 重定向地址等值中携带的密钥同样会被替换
+func captureHeader(h http.Header) http.Header {
+	res := redact.Header(h)
+	for key, values := range res {
+		for i, value := range values {
+			values[i] = redact.String(value)
+		}
+		res[key] = values
+	}
+	return res
+}
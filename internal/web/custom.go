@@ -0,0 +1,92 @@
+package web
+
+import (
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// routeVarRegex 匹配自定义路由模板中的变量
+var routeVarRegex = regexp.MustCompile(`\$\{(emby|alist|host|uri|path|(?:query|header)\.[\w-]+)\}`)
+
+// customRouter 按照 routes.rules 配置处理自定义路由
+//
+// 匹配成功的请求不再经过内置路由
+func customRouter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		uri := c.Request.RequestURI
+		for _, route := range config.C.Routes.Rules {
+			match, ok := route.Match(c.Request.Method, uri)
+			if !ok {
+				continue
+			}
+
+			log.Printf(colors.ToBlue("请求命中自定义路由 [%s], 处理方式: %s"), route.Name, route.Handler)
+			c.Header(cache.HeaderKeyExpired, "-1")
+			render := func(tmpl string) string {
+				return route.Expand(renderRouteVars(c, tmpl), uri, match)
+			}
+			for key, value := range route.Headers {
+				c.Header(key, render(value))
+			}
+
+			switch route.Handler {
+			case config.RouteRawProxy:
+				remote, withUri := config.C.Emby.Host, true
+				if route.Target != "" {
+					remote, withUri = render(route.Target), false
+				}
+				if err := https.ProxyRequest(c, remote, withUri); err != nil {
+					log.Printf(colors.ToRed("自定义路由 [%s] 代理失败: %v"), route.Name, err)
+					if !c.Writer.Written() {
+						apierr.Respondf(c, http.StatusBadGateway, apierr.ProxyFailed, "代理失败: %v", err)
+					}
+				}
+			case config.RouteRedirect:
+				c.Redirect(route.Status, render(route.Target))
+			case config.RouteStaticResponse:
+				c.Status(route.Status)
+				c.Writer.WriteString(render(route.Body))
+			}
+			c.Abort()
+			return
+		}
+	}
+}
+
+// renderRouteVars 填充模板中的变量
+//
+// 支持的变量: ${emby}, ${alist}, ${host} (客户端请求的本程序地址), ${uri}, ${path}, ${query.Xxx}, ${header.Xxx}
+func renderRouteVars(c *gin.Context, tmpl string) string {
+	return routeVarRegex.ReplaceAllStringFunc(tmpl, func(v string) string {
+		name := v[2 : len(v)-1]
+		var value string
+		switch {
+		case name == "emby":
+			value = config.C.Emby.Host
+		case name == "alist":
+			value = config.C.Alist.Host
+		case name == "host":
+			value = https.ClientRequestHost(c)
+		case name == "uri":
+			value = c.Request.URL.RequestURI()
+		case name == "path":
+			value = c.Request.URL.Path
+		case strings.HasPrefix(name, "query."):
+			value = c.Query(strings.TrimPrefix(name, "query."))
+		case strings.HasPrefix(name, "header."):
+			value = c.GetHeader(strings.TrimPrefix(name, "header."))
+		}
+		// 变量的值不参与正则分组的替换
+		return strings.ReplaceAll(value, "$", "$$")
+	})
+}
@@ -0,0 +1,73 @@
+package web
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/alist"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/memstat"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/redact"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+)
+
+// dumpDiagnostics 输出诊断信息, 配置了 log.dump-dir 时写入文件, 否则输出到日志中
+//
+// 只读取内存中的状态, 不请求 emby 和 alist, 保证程序卡住时也能正常输出
+func dumpDiagnostics() {
+	content := redact.String(string(buildDiagnostics()))
+
+	dir := config.C.Log.DumpPath()
+	if dir == "" {
+		log.Printf("诊断信息:\n%s", content)
+		return
+	}
+	if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+		log.Printf(colors.ToRed("创建诊断信息目录失败: %v"), err)
+		return
+	}
+	file := filepath.Join(dir, "dump-"+time.Now().Format("20060102-150405")+".txt")
+	if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+		log.Printf(colors.ToRed("写入诊断信息失败: %v"), err)
+		return
+	}
+	log.Printf(colors.ToGreen("诊断信息已写入: %s"), file)
+}
+
+// buildDiagnostics 生成诊断信息: 运行状态、缓存统计、活跃串流会话以及所有 goroutine 的调用栈
+func buildDiagnostics() []byte {
+	var buf bytes.Buffer
+	usage, source := memstat.Usage()
+	fmt.Fprintf(&buf, "==== 运行状态 ====\n")
+	fmt.Fprintf(&buf, "时间: %s\n", time.Now().Format(time.RFC3339))
+	fmt.Fprintf(&buf, "版本: %s (%s)\n", constant.CurrentVersion, runtime.Version())
+	fmt.Fprintf(&buf, "就绪: %v\n", ready.Load())
+	fmt.Fprintf(&buf, "goroutine 个数: %d\n", runtime.NumGoroutine())
+	fmt.Fprintf(&buf, "内存占用: %d Byte (%s)\n", usage, source)
+	fmt.Fprintf(&buf, "alist 熔断状态: %s\n", alist.BreakerState())
+
+	fmt.Fprintf(&buf, "\n==== 缓存统计 ====\n")
+	stats, _ := json.MarshalIndent(cache.GetStats(), "", "  ")
+	buf.Write(stats)
+	buf.WriteByte('\n')
+
+	sessions := emby.ActiveStreamSessions()
+	fmt.Fprintf(&buf, "\n==== 活跃串流会话 (%d) ====\n", len(sessions))
+	for _, s := range sessions {
+		fmt.Fprintf(&buf, "user: %s, device: %s, last seen: %s\n", s.User, s.Device, s.LastSeen.Format(time.RFC3339))
+	}
+
+	fmt.Fprintf(&buf, "\n==== goroutine 调用栈 ====\n")
+	pprof.Lookup("goroutine").WriteTo(&buf, 2)
+	return buf.Bytes()
+}
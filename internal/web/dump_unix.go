@@ -0,0 +1,20 @@
+//go:build !windows
+
+package web
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+// watchDumpSignal 收到 SIGUSR1 信号时输出诊断信息
+func watchDumpSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, syscall.SIGUSR1)
+	go func() {
+		for range ch {
+			dumpDiagnostics()
+		}
+	}()
+}
@@ -0,0 +1,6 @@
+//go:build windows
+
+package web
+
+// watchDumpSignal Windows 不支持 SIGUSR1 信号, 不做任何处理
+func watchDumpSignal() {}
@@ -0,0 +1,117 @@
+package web
+
+import (
+	"net"
+	"net/http"
+	"sync"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/netutil"
+)
+
+// newServer 按照 server 配置创建 http 服务, 设置读写超时和请求头大小限制
+func newServer(addr string, handler http.Handler) *http.Server {
+	cfg := config.C.Server
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeoutDuration(),
+		ReadTimeout:       cfg.ReadTimeoutDuration(),
+		WriteTimeout:      cfg.WriteTimeoutDuration(),
+		IdleTimeout:       cfg.IdleTimeoutDuration(),
+		MaxHeaderBytes:    int(cfg.MaxHeaderBytes()),
+	}
+}
+
+// listen 监听服务地址, 并按照 server 配置限制并发连接数
+func listen(srv *http.Server) (net.Listener, error) {
+	ln, err := net.Listen("tcp", srv.Addr)
+	if err != nil {
+		return nil, err
+	}
+	cfg := config.C.Server
+	if cfg.MaxConnsPerIp > 0 {
+		ln = &ipLimitListener{Listener: ln, max: cfg.MaxConnsPerIp, conns: map[string]int{}}
+	}
+	if cfg.MaxConns > 0 {
+		ln = netutil.LimitListener(ln, cfg.MaxConns)
+	}
+	return ln, nil
+}
+
+// bodyLimiter 限制请求体大小
+//
+// 请求声明的 Content-Length 超出限制时直接响应 413, 未声明长度的请求在读取超出限制时中断
+func bodyLimiter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		limit := config.C.Server.MaxBodyBytes()
+		if limit <= 0 || c.Request.Body == nil {
+			return
+		}
+		if c.Request.ContentLength > limit {
+			apierr.Respondf(c, http.StatusRequestEntityTooLarge, apierr.BodyTooLarge, "请求体大小超出限制: %d > %d", c.Request.ContentLength, limit)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	}
+}
+
+// ipLimitListener 限制单个 ip 并发连接数的监听器, 超出限制的新连接会被直接关闭
+type ipLimitListener struct {
+	net.Listener
+	max   int
+	mu    sync.Mutex
+	conns map[string]int
+}
+
+// Accept 接收一个未超出限制的连接
+func (l *ipLimitListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		ip, _, err := net.SplitHostPort(conn.RemoteAddr().String())
+		if err != nil {
+			ip = conn.RemoteAddr().String()
+		}
+
+		l.mu.Lock()
+		if l.conns[ip] >= l.max {
+			l.mu.Unlock()
+			conn.Close()
+			logs.Debugf(colors.ToYellow("ip [%s] 的并发连接数超出限制: %d, 关闭新连接"), ip, l.max)
+			continue
+		}
+		l.conns[ip]++
+		l.mu.Unlock()
+		return &ipLimitConn{Conn: conn, release: sync.OnceFunc(func() { l.release(ip) })}, nil
+	}
+}
+
+// release 释放 ip 的一个连接
+func (l *ipLimitListener) release(ip string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.conns[ip]--; l.conns[ip] <= 0 {
+		delete(l.conns, ip)
+	}
+}
+
+// ipLimitConn 关闭时释放 ip 连接数的连接
+type ipLimitConn struct {
+	net.Conn
+	release func()
+}
+
+// Close 关闭连接
+func (c *ipLimitConn) Close() error {
+	err := c.Conn.Close()
+	c.release()
+	return err
+}
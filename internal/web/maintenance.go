@@ -0,0 +1,47 @@
+package web
+
+import (
+	"log"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/store"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/diskcache"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+)
+
+// startMaintenance 按照 cache.cleanup-cron 配置定时执行集中维护, 未配置时不启动
+//
+// 将耗时的清理任务集中在低峰期执行, 避免影响高峰期的播放
+func startMaintenance() {
+	schedule := config.C.Cache.CleanupSchedule()
+	if schedule == nil {
+		return
+	}
+
+	go func() {
+		for {
+			next := schedule.Next(time.Now())
+			if next.IsZero() {
+				log.Printf(colors.ToYellow("cache.cleanup-cron 无法触发, 停止集中维护: %s"), schedule)
+				return
+			}
+			logs.Debugf(colors.ToBlue("下一次集中维护的时间: %s"), next.Format(time.DateTime))
+			time.Sleep(time.Until(next))
+			runMaintenance()
+		}
+	}()
+}
+
+// runMaintenance 执行一次集中维护: 全量清洗过期的内存缓存, 清理磁盘缓存, 压缩持久化存储
+func runMaintenance() {
+	start := time.Now()
+	purged := cache.SweepStale()
+	diskcache.Sweep(config.C.DiskCache.MinFreeBytes())
+	if err := store.Default().Compact(); err != nil {
+		log.Printf(colors.ToRed("压缩存储失败: %v"), err)
+	}
+	log.Printf(colors.ToGreen("集中维护完成, 清除过期内存缓存 %d 个, 耗时: %v"), purged, time.Since(start))
+}
@@ -0,0 +1,44 @@
+package web
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/sentry"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// panicRecovery panic 恢复
+//
+// 捕获到 panic 后输出堆栈并上报到 sentry, 响应还未开始回写时返回统一结构的 json 异常信息,
+// 避免客户端收到空响应后表现不一致
+func panicRecovery() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			r := recover()
+			if r == nil {
+				return
+			}
+			if r == http.ErrAbortHandler {
+				// 由 net/http 中断连接, 不属于程序异常
+				panic(r)
+			}
+
+			stack := debug.Stack()
+			requestId := c.GetString(GinKeyRequestId)
+			log.Printf(colors.ToRed("请求处理异常, requestId: %s, uri: %s, panic: %v\n%s"), requestId, c.Request.URL.Path, r, stack)
+			sentry.CapturePanic(c, r, stack)
+
+			if !c.Writer.Written() {
+				apierr.Respond(c, http.StatusInternalServerError, apierr.Internal, "服务器内部错误, 请检查日志")
+				return
+			}
+			c.Abort()
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,126 @@
+// 编译期注册的插件, 下游分支可以在不修改核心处理器的前提下扩展功能,
+// 如自定义鉴权、新增资源提供方等
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Plugin 插件, 需要按需实现 RouteProvider, MiddlewareProvider, ResponseMutator 中的一个或多个接口
+type Plugin interface {
+	// Name 插件名称, 全局唯一
+	Name() string
+}
+
+// Route 插件提供的路由
+type Route struct {
+	Pattern string          // 匹配请求 RequestURI 的正则表达式
+	Handler gin.HandlerFunc // 请求处理器
+}
+
+// RouteProvider 提供路由的插件, 插件路由优先于内置路由匹配
+type RouteProvider interface {
+	Routes() []Route
+}
+
+// MiddlewareProvider 提供中间件的插件
+//
+// 插件中间件在内置的鉴权、限速中间件之后, 响应缓存之前执行
+type MiddlewareProvider interface {
+	Middlewares() []gin.HandlerFunc
+}
+
+// ResponseMutator 改写回源响应的插件
+//
+// 对直接代理到 emby 的请求生效, 在响应回写到客户端之前调用
+type ResponseMutator interface {
+	MutateResponse(c *gin.Context, resp *http.Response) error
+}
+
+var (
+	// plugins 已注册的插件, 按照注册顺序排列
+	plugins []Plugin
+	// pluginsMu 并发控制
+	pluginsMu sync.RWMutex
+)
+
+// Register 注册插件, 名称重复时 panic
+//
+// 一般在自定义包的 init 函数中调用, 并在 main 包中匿名导入该自定义包
+func Register(p Plugin) {
+	if p == nil {
+		panic("plugin: 插件不能为空")
+	}
+	pluginsMu.Lock()
+	defer pluginsMu.Unlock()
+	for _, exist := range plugins {
+		if exist.Name() == p.Name() {
+			panic(fmt.Sprintf("plugin: 插件重复注册: %s", p.Name()))
+		}
+	}
+	plugins = append(plugins, p)
+}
+
+// All 获取所有已注册的插件
+func All() []Plugin {
+	pluginsMu.RLock()
+	defer pluginsMu.RUnlock()
+	return append([]Plugin(nil), plugins...)
+}
+
+// Routes 获取所有插件提供的路由
+func Routes() []Route {
+	routes := make([]Route, 0)
+	for _, p := range All() {
+		if rp, ok := p.(RouteProvider); ok {
+			routes = append(routes, rp.Routes()...)
+		}
+	}
+	return routes
+}
+
+// Middlewares 获取所有插件提供的中间件
+func Middlewares() []gin.HandlerFunc {
+	mws := make([]gin.HandlerFunc, 0)
+	for _, p := range All() {
+		if mp, ok := p.(MiddlewareProvider); ok {
+			mws = append(mws, mp.Middlewares()...)
+		}
+	}
+	return mws
+}
+
+// ResponseHook 将所有插件的响应改写器组合为一个钩子, 依次执行
+//
+// next 为调用方原有的钩子, 先于插件执行; 没有插件改写响应时直接返回 next
+func ResponseHook(c *gin.Context, next https.ResponseHook) https.ResponseHook {
+	mutators := make([]ResponseMutator, 0)
+	for _, p := range All() {
+		if rm, ok := p.(ResponseMutator); ok {
+			mutators = append(mutators, rm)
+		}
+	}
+	if len(mutators) == 0 {
+		return next
+	}
+
+	return func(resp *http.Response) error {
+		if next != nil {
+			if err := next(resp); err != nil {
+				return err
+			}
+		}
+		for _, m := range mutators {
+			if err := m.MutateResponse(c, resp); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
@@ -0,0 +1,33 @@
+//go:build !minimal
+
+package web
+
+import (
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/admin"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/m3u8"
+)
+
+// previewRules 转码资源 (视频预览) 相关的路由规则
+func previewRules() [][2]interface{} {
+	return [][2]interface{}{
+		// m3u8 转码播放列表
+		{constant.Reg_ProxyPlaylist, m3u8.ProxyPlaylist},
+		// ts 重定向到直链
+		{constant.Reg_ProxyTs, m3u8.ProxyTsLink},
+		// m3u8 字幕
+		{constant.Reg_ProxySubtitle, m3u8.ProxySubtitle},
+
+		// 管理接口
+		{constant.Reg_AdminPreview, admin.Auth(admin.Preview)},
+		{constant.Reg_AdminPreviewPin, admin.Auth(admin.PreviewPin)},
+	}
+}
+
+// playlistPusher 预热时将转码播放列表推送到 m3u8 代理中维护
+func playlistPusher() emby.PlaylistPusher {
+	return func(account, alistPath, templateId string) {
+		m3u8.PushPlaylistAsync(m3u8.Info{AlistPath: alistPath, TemplateId: templateId, Account: account})
+	}
+}
@@ -0,0 +1,15 @@
+//go:build minimal
+
+package web
+
+import "github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
+
+// previewRules 精简构建不包含转码资源相关的路由
+func previewRules() [][2]interface{} {
+	return nil
+}
+
+// playlistPusher 精简构建不预热转码播放列表
+func playlistPusher() emby.PlaylistPusher {
+	return nil
+}
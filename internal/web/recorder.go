@@ -0,0 +1,39 @@
+package web
+
+import (
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/metrics"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/redact"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestRecorder 记录最近的请求, 供管理面板展示
+//
+// 管理接口自身的请求不记录, 避免面板刷新时刷掉真实的请求记录
+func requestRecorder() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.HasPrefix(strings.ToLower(c.Request.URL.Path), "/admin/") {
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+		cacheStatus := c.GetString(cache.GinKeyCacheStatus)
+		if cacheStatus == "" {
+			cacheStatus = "NONE"
+		}
+		metrics.RecordRequest(metrics.RequestRecord{
+			RequestId:   c.GetString(GinKeyRequestId),
+			Time:        start.Format(time.DateTime),
+			Method:      c.Request.Method,
+			Uri:         redact.String(c.Request.URL.String()),
+			Code:        c.Writer.Status(),
+			Cost:        time.Since(start).Milliseconds(),
+			CacheStatus: cacheStatus,
+		})
+	}
+}
@@ -0,0 +1,30 @@
+package web
+
+import (
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/randoms"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/strs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// HeaderRequestId 请求 id 的请求头/响应头名称
+	HeaderRequestId = "X-Request-Id"
+	// GinKeyRequestId 记录当前请求 id 的 gin key
+	GinKeyRequestId = apierr.GinKeyRequestId
+)
+
+// requestIdentifier 为每个请求分配请求 id, 并通过响应头返回给客户端
+//
+// 客户端或者前置代理已经携带请求 id 时沿用原始的值, 便于串联日志
+func requestIdentifier() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(HeaderRequestId)
+		if strs.AnyEmpty(id) || len(id) > 64 {
+			id = randoms.RandomHex(16)
+		}
+		c.Set(GinKeyRequestId, id)
+		c.Header(HeaderRequestId, id)
+	}
+}
@@ -0,0 +1,77 @@
+package web
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/sdnotify"
+)
+
+// shutdownTimeout 重启时等待进行中的请求完成的最长时间
+const shutdownTimeout = time.Second * 30
+
+var (
+	// servers 正在监听的所有服务
+	servers []*http.Server
+	// serversMu 并发控制
+	serversMu sync.Mutex
+	// restartOnce 保证只重启一次
+	restartOnce sync.Once
+
+	// executable 启动时的程序路径
+	//
+	// Linux 下程序文件被重命名后 os.Executable 会返回重命名后的路径, 需要在替换之前获取
+	executable, executableErr = os.Executable()
+)
+
+// trackServer 记录正在监听的服务, 重启时统一关闭
+func trackServer(srv *http.Server) {
+	serversMu.Lock()
+	defer serversMu.Unlock()
+	servers = append(servers, srv)
+}
+
+// Restart 平滑重启: 停止接收新的请求, 等待进行中的请求完成后, 使用当前的程序文件重新启动
+//
+// 用于替换程序之后加载新版本, 进行中的请求超过 shutdownTimeout 仍未完成时直接中断
+func Restart() {
+	restartOnce.Do(func() {
+		ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+
+		serversMu.Lock()
+		all := append([]*http.Server(nil), servers...)
+		serversMu.Unlock()
+		if len(all) == 0 {
+			log.Println(colors.ToYellow("嵌入到其他服务中运行时无法自动重启, 请手动重启以加载新版本"))
+			return
+		}
+		// 重启后进程号不变, 新进程依赖就绪后会重新通知 systemd 启动完成
+		sdnotify.Notify(sdnotify.Reloading, sdnotify.Status("正在重启以加载新版本"))
+		var wg sync.WaitGroup
+		for _, srv := range all {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if err := srv.Shutdown(ctx); err != nil {
+					log.Printf(colors.ToYellow("等待请求完成超时, 中断剩余的请求: %v"), err)
+					srv.Close()
+				}
+			}()
+		}
+		wg.Wait()
+
+		flushStore()
+		if executableErr != nil {
+			log.Fatalf(colors.ToRed("重启失败, 获取当前程序路径失败: %v"), executableErr)
+		}
+		if err := execSelf(executable); err != nil {
+			log.Fatalf(colors.ToRed("重启失败: %v"), err)
+		}
+	})
+}
@@ -0,0 +1,13 @@
+//go:build !windows
+
+package web
+
+import (
+	"os"
+	"syscall"
+)
+
+// execSelf 使用新的程序替换当前进程, 进程 id 保持不变
+func execSelf(exe string) error {
+	return syscall.Exec(exe, os.Args, os.Environ())
+}
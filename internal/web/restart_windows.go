@@ -0,0 +1,20 @@
+//go:build windows
+
+package web
+
+import (
+	"os"
+	"os/exec"
+)
+
+// execSelf Windows 不支持替换当前进程, 启动新的进程之后退出
+func execSelf(exe string) error {
+	cmd := exec.Command(exe, os.Args[1:]...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+	cmd.Env = os.Environ()
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	os.Exit(0)
+	return nil
+}
@@ -0,0 +1,61 @@
+package web
+
+import (
+	"log"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+
+	"github.com/gin-gonic/gin"
+)
+
+// requestRewriter 按照 rewrite.rules 配置改写请求
+//
+// 规则的处理方式为 origin 时, 跳过后续的代理逻辑, 直接回源
+func requestRewriter() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		rules := config.C.Rewrite.Rules
+		if len(rules) == 0 {
+			return
+		}
+
+		vars := emby.RequestVars(c)
+		for _, rule := range rules {
+			if !rule.Match(vars) {
+				continue
+			}
+
+			for key, value := range rule.SetHeader {
+				c.Request.Header.Set(key, value)
+			}
+			for _, key := range rule.DelHeader {
+				c.Request.Header.Del(key)
+			}
+
+			u := c.Request.URL
+			q := u.Query()
+			for key, value := range rule.SetQuery {
+				q.Set(key, value)
+			}
+			for _, key := range rule.DelQuery {
+				q.Del(key)
+			}
+			if len(rule.SetQuery) > 0 || len(rule.DelQuery) > 0 {
+				u.RawQuery = q.Encode()
+			}
+			if newPath := rule.RewritePath(u.Path); newPath != u.Path {
+				u.Path, u.RawPath = newPath, ""
+			}
+			// 路由规则依据 RequestURI 进行匹配, 需要同步更新
+			c.Request.RequestURI = u.RequestURI()
+
+			log.Printf(colors.ToYellow("请求命中重写规则 [%s], 重写后的地址: %s, 处理方式: %s"), rule.Name, c.Request.RequestURI, rule.Action)
+			if rule.Action == config.RewriteOrigin {
+				emby.ProxyOrigin(c)
+				c.Abort()
+				return
+			}
+		}
+	}
+}
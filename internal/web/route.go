@@ -4,8 +4,10 @@ import (
 	"log"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/admin"
 	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
-	"github.com/AmbitiousJun/go-emby2alist/internal/service/m3u8"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/plugin"
 
 	"github.com/gin-gonic/gin"
 )
@@ -17,7 +19,19 @@ var rules [][2]interface{}
 
 func initRulePatterns() {
 	log.Println("正在初始化路由规则...")
-	rules = compileRules([][2]interface{}{
+	// 插件路由优先匹配
+	pluginRules := make([][2]interface{}, 0)
+	for _, p := range plugin.All() {
+		log.Printf(colors.ToBlue("已加载插件: %s"), p.Name())
+	}
+	for _, route := range plugin.Routes() {
+		pluginRules = append(pluginRules, [2]interface{}{route.Pattern, (func(*gin.Context))(route.Handler)})
+	}
+
+	routes := append(pluginRules, [][2]interface{}{
+		// 只读的 WebDAV 服务, 路径可能包含任意媒体名称, 优先匹配
+		{constant.Reg_Webdav, emby.ServeWebdav},
+
 		// websocket
 		{constant.Reg_Socket, emby.ProxySocket()},
 
@@ -32,9 +46,16 @@ func initRulePatterns() {
 		{constant.Reg_UserItemsRandomResort, emby.ResortRandomItems},
 		// 代理原始的随机列表接口, 去除 limit 限制, 并进行缓存
 		{constant.Reg_UserItemsRandomWithLimit, emby.RandomItemsWithLimit},
+		// 其余的 Items 列表接口, Kodi 客户端走兼容处理
+		{constant.Reg_UserItemsList, emby.ProxyUserItems},
+		// Emby for Kodi 的同步接口, 原样透传, 避免被其他规则 (如图片) 误匹配
+		{constant.Reg_KodiSyncQueue, emby.ProxyOrigin},
 
 		// 重排序剧集
 		{constant.Reg_ShowEpisodes, emby.ResortEpisodes},
+		// 首页继续观看和下一集列表, 按用户缓存
+		{constant.Reg_ShowsNextUp, emby.ProxyHomeList},
+		{constant.Reg_UserItemsResume, emby.ProxyHomeList},
 
 		// 字幕长时间缓存
 		{constant.Reg_VideoSubtitles, emby.ProxySubtitles},
@@ -45,25 +66,84 @@ func initRulePatterns() {
 		{constant.Reg_ResourceMaster, emby.Redirect2Transcode},
 		// main 路由到直链接口
 		{constant.Reg_ResourceMain, emby.Redirect2AlistLink},
-		// m3u8 转码播放列表
-		{constant.Reg_ProxyPlaylist, m3u8.ProxyPlaylist},
-		// ts 重定向到直链
-		{constant.Reg_ProxyTs, m3u8.ProxyTsLink},
-		// m3u8 字幕
-		{constant.Reg_ProxySubtitle, m3u8.ProxySubtitle},
+		// 多分段资源的附加分段, 改写为直链
+		{constant.Reg_AdditionalParts, emby.TransferAdditionalParts},
+		// 进度条预览图, 磁盘缓存
+		{constant.Reg_Trickplay, emby.ProxyTrickplay},
+		// 结束转码和关闭直播流, 转发到源服务器并清理串流会话
+		{constant.Reg_ActiveEncodings, emby.CloseTranscode},
+		{constant.Reg_LiveStreamClose, emby.CloseTranscode},
+		// 播放状态上报, 维护串流会话
+		{constant.Reg_PlayingSessions, emby.TrackPlaybackSession},
+		// DLNA 接口, 改写媒体资源地址
+		{constant.Reg_Dlna, emby.ProxyDlna},
 		// 资源下载, 重定向到直链
-		{constant.Reg_ItemDownload, emby.Redirect2AlistLink},
+		{constant.Reg_ItemDownload, emby.DownloadItem},
 
+		// 照片原图, 重定向到直链
+		{constant.Reg_PhotoOriginal, emby.RedirectPhotoOriginal},
+		// 章节图片长时间缓存
+		{constant.Reg_ChapterImages, emby.HandleChapterImages},
+		// 远程图片提供商的图片列表, 改写图片地址; 代理并缓存远程图片
+		{constant.Reg_ItemRemoteImages, emby.ProxyItemRemoteImages},
+		{constant.Reg_RemoteImage, emby.ProxyRemoteImage},
 		// 处理图片请求
 		{constant.Reg_Images, emby.HandleImages},
 
-		// 其余资源走重定向回源
-		{constant.Reg_All, emby.ProxyOrigin},
-	})
+		// 唤起外部播放器
+		{constant.Reg_PlayHandoff, emby.PlayHandoff},
+
+		// 客户端带宽测速
+		{constant.Reg_Probe, emby.Probe},
+
+		// 最近添加的媒体订阅源
+		{constant.Reg_FeedRecent, emby.RecentFeed},
+		{constant.Reg_FeedLink, emby.FeedLink},
+		{constant.Reg_FeedPoster, emby.FeedPoster},
+		// 导出媒体库、合集、播放列表为 strm 压缩包或 m3u 播放列表
+		{constant.Reg_FeedExport, emby.ExportItems},
+
+		// 管理接口
+		{constant.Reg_AdminLatency, admin.Auth(admin.Latency)},
+		{constant.Reg_AdminDecisions, admin.Auth(admin.Decisions)},
+		{constant.Reg_AdminDebugSnapshot, admin.Auth(admin.DebugSnapshot)},
+		{constant.Reg_AdminDebugTrace, admin.Auth(admin.DebugTrace)},
+		{constant.Reg_AdminStats, admin.Auth(admin.Stats)},
+		{constant.Reg_AdminStatsReset, admin.Auth(admin.ResetStats)},
+		{constant.Reg_AdminSessions, admin.Auth(admin.Sessions)},
+		{constant.Reg_AdminSessionStop, admin.Auth(admin.StopSession)},
+		{constant.Reg_AdminSessionMessage, admin.Auth(admin.SendSessionMessage)},
+		{constant.Reg_AdminSessionBroadcast, admin.Auth(admin.BroadcastMessage)},
+		{constant.Reg_AdminRequests, admin.Auth(admin.Requests)},
+		{constant.Reg_AdminHealth, admin.Auth(admin.Health)},
+		{constant.Reg_AdminCache, admin.Auth(admin.Cache)},
+		{constant.Reg_AdminCachePurge, admin.Auth(admin.PurgeCache)},
+		{constant.Reg_AdminUi, admin.Auth(admin.Dashboard)},
+		{constant.Reg_AdminResolve, admin.Auth(admin.Resolve)},
+		{constant.Reg_AdminSimulate, admin.Auth(admin.Simulate)},
+		{constant.Reg_AdminPathMap, admin.Auth(admin.PathMap)},
+		{constant.Reg_AdminPathMapOverride, admin.Auth(admin.PathMapOverride)},
+		{constant.Reg_AdminLogLevel, admin.Auth(admin.LogLevel)},
+		{constant.Reg_AdminFeatures, admin.Auth(admin.Features)},
+		{constant.Reg_AdminLibraryChanged, admin.Auth(admin.LibraryChanged)},
+		{constant.Reg_AdminConfig, admin.Auth(admin.Config)},
+		{constant.Reg_AdminOpenApi, admin.Auth(admin.OpenApi)},
+		{constant.Reg_AdminCapture, admin.Auth(admin.Capture)},
+		{constant.Reg_AdminCaptureExport, admin.Auth(admin.ExportCapture)},
+		{constant.Reg_AdminCaptureClear, admin.Auth(admin.ClearCapture)},
+		{constant.Reg_AdminVersion, admin.Auth(admin.Version)},
+		{constant.Reg_AdminVersionUpdate, admin.Auth(admin.UpdateVersion)},
+	}...)
+	// 转码资源相关的路由, 精简构建中不包含
+	routes = append(routes, previewRules()...)
+	// 其余资源走重定向回源
+	routes = append(routes, [2]interface{}{constant.Reg_All, emby.ProxyOrigin})
+	rules = compileRules(routes)
 	log.Println("路由规则初始化完成")
 }
 
 // initRoutes 初始化路由
 func initRoutes(r *gin.Engine) {
 	r.Any("/*vars", globalDftHandler)
+	r.Handle(emby.MethodPropfind, "/*vars", globalDftHandler)
 }
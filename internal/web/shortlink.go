@@ -0,0 +1,55 @@
+package web
+
+import (
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/shortlink"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shortLinkExpander 将旧设备请求的短链接 (/s/{token}) 还原为完整的请求地址, 再交由后续的中间件和路由处理
+//
+// 短链接请求中携带的 query 参数会追加到还原后的地址中, 如客户端续播时追加的 StartTimeTicks
+func shortLinkExpander() gin.HandlerFunc {
+	shortReg := regexp.MustCompile(`(?i)^(?:/emby)?` + shortlink.PathPrefix + `([0-9a-f]+)/?$`)
+
+	return func(c *gin.Context) {
+		if !config.C.LegacyClient.Enable {
+			return
+		}
+		matches := shortReg.FindStringSubmatch(c.Request.URL.Path)
+		if len(matches) < 2 {
+			return
+		}
+		target, ok := shortlink.Expand(strings.ToLower(matches[1]))
+		if !ok {
+			apierr.Respond(c, http.StatusNotFound, apierr.NotFound, "短链接不存在或已过期")
+			return
+		}
+		u, err := url.Parse(target)
+		if err != nil {
+			apierr.Respond(c, http.StatusInternalServerError, apierr.Internal, "短链接地址解析失败")
+			return
+		}
+
+		if extra := c.Request.URL.Query(); len(extra) > 0 {
+			q := u.Query()
+			for key, values := range extra {
+				q[key] = values
+			}
+			u.RawQuery = q.Encode()
+		}
+		c.Request.URL.Path, c.Request.URL.RawPath, c.Request.URL.RawQuery = u.Path, u.RawPath, u.RawQuery
+		// 路由规则依据 RequestURI 进行匹配, 需要同步更新
+		c.Request.RequestURI = c.Request.URL.RequestURI()
+		logs.Debugf(colors.ToBlue("短链接 [%s] 还原为: %s"), matches[1], c.Request.URL.Path)
+	}
+}
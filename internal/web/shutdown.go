@@ -0,0 +1,34 @@
+package web
+
+import (
+	"log"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/store"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/sdnotify"
+)
+
+// watchStopSignal 收到停止信号 (Ctrl+C, docker stop, systemctl stop 等) 时先写入存储再退出
+//
+// 只在独立运行时监听, 嵌入到其他服务中运行时由宿主程序负责退出
+func watchStopSignal() {
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		sig := <-ch
+		log.Printf(colors.ToYellow("收到信号 %v, 正在退出..."), sig)
+		sdnotify.Notify(sdnotify.Stopping)
+		flushStore()
+		os.Exit(0)
+	}()
+}
+
+// flushStore 退出或重启前将缓冲中的数据 (如播放统计) 和存储写入磁盘
+func flushStore() {
+	if err := store.Default().Flush(); err != nil {
+		log.Printf(colors.ToRed("写入存储失败: %v"), err)
+	}
+}
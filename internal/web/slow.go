@@ -0,0 +1,48 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+
+	"github.com/gin-gonic/gin"
+)
+
+// slowRequestLogger 慢请求日志
+//
+// 请求处理耗时超过 log.slow-threshold 时, 输出请求路径, 上游耗时以及缓存状态
+func slowRequestLogger() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		threshold := config.C.Log.SlowThresholdDuration()
+		if threshold <= 0 {
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+		cost := time.Since(start)
+		if cost < threshold {
+			return
+		}
+
+		timings := strings.Builder{}
+		for _, t := range https.UpstreamTimings(c) {
+			timings.WriteString(fmt.Sprintf("%s=%v;", t.Name, t.Duration))
+		}
+		cacheStatus := c.GetString(cache.GinKeyCacheStatus)
+		if cacheStatus == "" {
+			cacheStatus = "NONE"
+		}
+
+		log.Printf(
+			colors.ToYellow("[WARN] 慢请求, 耗时: %v, 阈值: %v, method: %s, uri: %s, code: %d, 上游耗时: [%s], 缓存状态: %s"),
+			cost, threshold, c.Request.Method, c.Request.URL.String(), c.Writer.Status(), timings.String(), cacheStatus,
+		)
+	}
+}
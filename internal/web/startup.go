@@ -0,0 +1,126 @@
+package web
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/sdnotify"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/apierr"
+
+	"github.com/gin-gonic/gin"
+)
+
+// HealthzPath 就绪探测地址, 不需要鉴权
+const HealthzPath = "/healthz"
+
+var (
+	// ready 服务是否已经就绪
+	ready atomic.Bool
+
+	// standalone 是否以独立进程的方式运行, 只有独立运行时才向 systemd 发送状态通知
+	standalone atomic.Bool
+)
+
+// markReady 标记服务已经就绪, 并通知 systemd 启动完成
+func markReady(status string) {
+	ready.Store(true)
+	if standalone.Load() {
+		sdnotify.Notify(sdnotify.Ready, sdnotify.Status(status))
+	}
+}
+
+// notifyStatus 向 systemd 更新服务的状态描述
+func notifyStatus(status string) {
+	if standalone.Load() {
+		sdnotify.Notify(sdnotify.Status(status))
+	}
+}
+
+// readinessGate 就绪检查中间件
+//
+// 响应 /healthz 探测请求, 服务未就绪时拒绝其余请求
+func readinessGate() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if strings.EqualFold(c.Request.URL.Path, HealthzPath) {
+			if !ready.Load() {
+				c.JSON(http.StatusServiceUnavailable, map[string]bool{"Ready": false})
+			} else {
+				c.JSON(http.StatusOK, map[string]bool{"Ready": true})
+			}
+			c.Abort()
+			return
+		}
+
+		if !ready.Load() {
+			c.Header("Retry-After", "5")
+			apierr.Respond(c, http.StatusServiceUnavailable, apierr.ServiceStarting, "服务启动中, 正在等待 emby 和 alist 就绪")
+		}
+	}
+}
+
+// waitDependencies 等待 emby 和 alist 就绪, 按照 startup 配置进行退避重试
+//
+// 依赖服务未就绪期间不会通知 systemd 启动完成
+func waitDependencies() {
+	cfg := config.C.Startup
+	if !cfg.Wait {
+		markReady("服务运行中")
+		return
+	}
+
+	probes := map[string]string{
+		"emby":  config.C.Emby.Host + "/emby/System/Info/Public",
+		"alist": config.C.Alist.Host + "/ping",
+	}
+	deadline := time.Now().Add(cfg.TimeoutDuration())
+	interval := cfg.IntervalDuration()
+	for {
+		pending := make([]string, 0, len(probes))
+		for name, u := range probes {
+			if err := probeDependency(u); err != nil {
+				log.Printf(colors.ToYellow("等待 %s 就绪: %v"), name, err)
+				pending = append(pending, name)
+				continue
+			}
+			delete(probes, name)
+		}
+		if len(pending) == 0 {
+			log.Println(colors.ToGreen("依赖服务已全部就绪, 开始处理请求"))
+			markReady("服务运行中")
+			return
+		}
+
+		if time.Now().Add(interval).After(deadline) {
+			if cfg.OnTimeout == config.StartupExit {
+				log.Fatalf(colors.ToRed("等待依赖服务就绪超时: %v, 程序退出"), pending)
+			}
+			log.Printf(colors.ToRed("等待依赖服务就绪超时: %v, 开始处理请求"), pending)
+			markReady(fmt.Sprintf("服务运行中, 等待依赖服务就绪超时: %s", strings.Join(pending, ", ")))
+			return
+		}
+
+		notifyStatus(fmt.Sprintf("等待依赖服务就绪: %s", strings.Join(pending, ", ")))
+		time.Sleep(interval)
+		interval = min(interval*2, cfg.MaxIntervalDuration())
+	}
+}
+
+// probeDependency 请求依赖服务的探测地址, 响应码小于 500 即视为可用
+func probeDependency(u string) error {
+	resp, err := https.Request(http.MethodGet, u, nil, nil)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return fmt.Errorf("响应异常: %d", resp.StatusCode)
+	}
+	return nil
+}
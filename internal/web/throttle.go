@@ -0,0 +1,88 @@
+package web
+
+import (
+	"regexp"
+	"sync"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/ratelimit"
+
+	"github.com/gin-gonic/gin"
+)
+
+// throttleChunkSize 限速时单次写入的最大字节数, 避免大块写入造成突发流量
+const throttleChunkSize = 32 * 1024
+
+// throttleWriter 限速响应写入器
+type throttleWriter struct {
+	gin.ResponseWriter
+	c       *gin.Context
+	buckets []*ratelimit.Bucket
+}
+
+// Write 分块写入响应体, 每一块都需要先从所有令牌桶中获取令牌
+func (tw *throttleWriter) Write(data []byte) (int, error) {
+	written := 0
+	for written < len(data) {
+		chunk := data[written:min(written+throttleChunkSize, len(data))]
+		for _, bucket := range tw.buckets {
+			if err := bucket.Wait(tw.c.Request.Context(), len(chunk)); err != nil {
+				return written, err
+			}
+		}
+		n, err := tw.ResponseWriter.Write(chunk)
+		written += n
+		if err != nil {
+			return written, err
+		}
+	}
+	return written, nil
+}
+
+// streamThrottler 串流带宽限制
+//
+// 对串流和下载接口的响应体限速, 重定向响应没有响应体, 不受影响
+func streamThrottler() gin.HandlerFunc {
+	patterns := []*regexp.Regexp{
+		regexp.MustCompile(constant.Reg_ResourceStream),
+		regexp.MustCompile(constant.Reg_ItemDownload),
+	}
+
+	var globalBucket *ratelimit.Bucket
+	initGlobal := sync.OnceFunc(func() {
+		if rate := config.C.Throttle.GlobalRate(); rate > 0 {
+			globalBucket = ratelimit.NewBucket(rate)
+		}
+	})
+
+	return func(c *gin.Context) {
+		cfg := config.C.Throttle
+		if !cfg.Enable {
+			return
+		}
+		matched := false
+		for _, pattern := range patterns {
+			if pattern.MatchString(c.Request.RequestURI) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return
+		}
+
+		initGlobal()
+		buckets := make([]*ratelimit.Bucket, 0, 2)
+		if rate := cfg.StreamRate(); rate > 0 {
+			buckets = append(buckets, ratelimit.NewBucket(rate))
+		}
+		if globalBucket != nil {
+			buckets = append(buckets, globalBucket)
+		}
+		if len(buckets) == 0 {
+			return
+		}
+		c.Writer = &throttleWriter{ResponseWriter: c.Writer, c: c, buckets: buckets}
+	}
+}
@@ -2,21 +2,39 @@ package web
 
 import (
 	"crypto/tls"
+	"errors"
 	"log"
 	"net/http"
+	"sync"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/ffprobe"
 	"github.com/AmbitiousJun/go-emby2alist/internal/service/emby"
+	"github.com/AmbitiousJun/go-emby2alist/internal/service/stats"
+	"github.com/AmbitiousJun/go-emby2alist/internal/updater"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/diskcache"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/https"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/sdnotify"
 	"github.com/AmbitiousJun/go-emby2alist/internal/web/cache"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web/plugin"
 	"github.com/AmbitiousJun/go-emby2alist/internal/web/webport"
 
 	"github.com/gin-gonic/gin"
 )
 
+var (
+	// rulesOnce 保证路由规则只初始化一次
+	rulesOnce sync.Once
+
+	// backgroundOnce 保证后台任务只启动一次
+	backgroundOnce sync.Once
+)
+
 // Listen 监听指定端口
 func Listen() error {
-	initRulePatterns()
+	rulesOnce.Do(initRulePatterns)
 
 	errChanHTTP, errChanHTTPS := make(chan error, 1), make(chan error, 1)
 	if !config.C.Ssl.Enable {
@@ -27,38 +45,133 @@ func Listen() error {
 		go listenHTTP(errChanHTTP)
 		go listenHTTPS(errChanHTTPS)
 	}
+	standalone.Store(true)
+	sdnotify.StartWatchdog()
+	watchDumpSignal()
+	watchStopSignal()
+	StartBackground()
 
 	select {
 	case err := <-errChanHTTP:
+		sdnotify.Notify(sdnotify.Stopping)
 		log.Fatal("http 服务异常: ", err)
 	case err := <-errChanHTTPS:
+		sdnotify.Notify(sdnotify.Stopping)
 		log.Fatal("https 服务异常: ", err)
 	}
 	return nil
 }
 
+// NewHandler 创建不监听端口的请求处理器, 用于挂载到其他服务中
+//
+// 调用前需要先完成配置的加载
+func NewHandler() http.Handler {
+	rulesOnce.Do(initRulePatterns)
+	return newEngine(webport.Embedded)
+}
+
+// StartBackground 启动依赖等待、磁盘缓存清理、集中维护、内存看门狗、媒体库监听、播放记录同步、版本检查、ffprobe 查找等后台任务, 多次调用只会启动一次
+func StartBackground() {
+	backgroundOnce.Do(func() {
+		go waitDependencies()
+		startDiskCacheCleaner()
+		startMaintenance()
+		cache.StartWatchdog()
+		cache.StartClusterSync()
+		emby.WatchLibrary()
+		emby.StartWatchedSync()
+		updater.Start(Restart)
+		emby.StartWarmup(playlistPusher())
+		go prepareFfprobe()
+	})
+}
+
+// prepareFfprobe 后台查找或下载 ffprobe, 失败时记录日志, 之后使用 ffprobe 时会再次尝试
+func prepareFfprobe() {
+	err := ffprobe.Prepare()
+	switch {
+	case err == nil:
+	case errors.Is(err, ffprobe.ErrUnavailable):
+		logs.Debugln(err.Error())
+	default:
+		log.Printf(colors.ToYellow("准备 ffprobe 失败: %v"), err)
+	}
+}
+
+// startDiskCacheCleaner 注册所有启用的磁盘缓存目录, 并启动定期清理任务
+//
+// 配置了 cache.cleanup-cron 时, 磁盘缓存只在集中维护时清理
+func startDiskCacheCleaner() {
+	if config.C.Trickplay.Enable {
+		diskcache.Register(config.C.Trickplay.Dir(), config.C.Trickplay.ExpiredDuration())
+	}
+	if config.C.Cache.CleanupSchedule() != nil {
+		return
+	}
+	cfg := config.C.DiskCache
+	diskcache.Start(cfg.IntervalDuration(), cfg.MinFreeBytes())
+}
+
 // initRouter 初始化路由引擎
 func initRouter(r *gin.Engine) {
+	r.Use(requestIdentifier())
+	r.Use(panicRecovery())
+	r.Use(originBypass())
+	r.Use(bodyLimiter())
+	r.Use(readinessGate())
+	r.Use(shortLinkExpander())
+	r.Use(emby.DebugTracer())
+	r.Use(slowRequestLogger())
+	r.Use(requestRecorder())
+	r.Use(requestCapturer())
+	r.Use(requestRewriter())
+	r.Use(emby.ClientPassthrough())
+	// 从上游读取的流量计入播放统计
+	https.SetTrafficRecorder(stats.RecordTraffic)
+	r.Use(emby.TrafficTagger())
+	r.Use(emby.ImagesRewriter())
+	r.Use(emby.ImagesPrefetcher())
 	r.Use(referrerPolicySetter())
 	r.Use(emby.ApiKeyChecker())
+	r.Use(emby.RequestShadower())
+	r.Use(streamThrottler())
+	r.Use(plugin.Middlewares()...)
+	r.Use(customRouter())
 	if config.C.Cache.Enable {
 		r.Use(cache.CacheableRouteMarker())
 		r.Use(cache.RequestCacher())
 	}
+	// 在响应缓存之后执行, 命中缓存的请求不需要等待源服务器唤醒
+	r.Use(emby.OriginWaker())
 	initRoutes(r)
 }
 
-// listenHTTP 在指定端口上监听 http 服务
-//
-// 出现错误时, 会写入 errChan 中
-func listenHTTP(errChan chan error) {
+// newEngine 创建路由引擎, port 记录在请求上下文中, 用于区分请求来源
+func newEngine(port string) *gin.Engine {
 	r := gin.Default()
 	r.Use(func(c *gin.Context) {
-		c.Set(webport.GinKey, webport.HTTP)
+		c.Set(webport.GinKey, port)
 	})
 	initRouter(r)
+	return r
+}
+
+// listenHTTP 在指定端口上监听 http 服务
+//
+// 出现错误时, 会写入 errChan 中
+func listenHTTP(errChan chan error) {
+	r := newEngine(webport.HTTP)
 	log.Printf(colors.ToBlue("在端口【%s】上启动 HTTP 服务"), webport.HTTP)
-	err := r.Run("0.0.0.0:" + webport.HTTP)
+	srv := newServer("0.0.0.0:"+webport.HTTP, r)
+	trackServer(srv)
+	ln, err := listen(srv)
+	if err == nil {
+		err = srv.Serve(ln)
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		// 重启时主动关闭的服务不视为异常
+		return
+	}
 	errChan <- err
 	close(errChan)
 }
@@ -67,22 +180,22 @@ func listenHTTP(errChan chan error) {
 //
 // 出现错误时, 会写入 errChan 中
 func listenHTTPS(errChan chan error) {
-	r := gin.Default()
-	r.Use(func(c *gin.Context) {
-		c.Set(webport.GinKey, webport.HTTPS)
-	})
-	initRouter(r)
+	r := newEngine(webport.HTTPS)
 	log.Printf(colors.ToBlue("在端口【%s】上启动 HTTPS 服务"), webport.HTTPS)
 	ssl := config.C.Ssl
 
-	srv := &http.Server{
-		Addr:    "0.0.0.0:" + webport.HTTPS,
-		Handler: r,
-	}
+	srv := newServer("0.0.0.0:"+webport.HTTPS, r)
 	// 禁用 HTTP/2
 	srv.TLSNextProto = map[string]func(*http.Server, *tls.Conn, http.Handler){}
+	trackServer(srv)
 
-	err := srv.ListenAndServeTLS(ssl.CrtPath(), ssl.KeyPath())
+	ln, err := listen(srv)
+	if err == nil {
+		err = srv.ServeTLS(ln, ssl.CrtPath(), ssl.KeyPath())
+	}
+	if errors.Is(err, http.ErrServerClosed) {
+		return
+	}
 	errChan <- err
 	close(errChan)
 }
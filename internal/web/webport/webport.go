@@ -4,4 +4,7 @@ const (
 	HTTPS  = "8094"
 	HTTP   = "8095"
 	GinKey = "port"
+
+	// Embedded 以库的形式嵌入到其他服务中, 不监听端口
+	Embedded = "embedded"
 )
@@ -1,23 +1,56 @@
 package main
 
 import (
+	"flag"
+	"fmt"
 	"log"
+	"os"
 
 	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/constant"
+	"github.com/AmbitiousJun/go-emby2alist/internal/mock"
+	"github.com/AmbitiousJun/go-emby2alist/internal/selftest"
 	"github.com/AmbitiousJun/go-emby2alist/internal/util/colors"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/redact"
 	"github.com/AmbitiousJun/go-emby2alist/internal/web"
+
+	"github.com/gin-gonic/gin"
 )
 
-const CurrentVersion = "v1.3.0-beta-v3"
-const RepoAddr = "https://github.com/AmbitiousJun/go-emby2alist"
+// mockMode 是否使用模拟的 emby 和 alist 服务器启动, 用于本地测试
+var mockMode = flag.Bool("mock", false, "使用模拟的 emby 和 alist 服务器启动, 忽略 config.yml")
+
+// pathProfile 使用的路径配置组名称
+var pathProfile = flag.String("path-profile", "", "使用的路径配置组 (path.profiles) 名称, 优先于环境变量 "+config.PathProfileEnv+" 和 path.profile")
 
 func main() {
+	flag.Parse()
 	printBanner()
 
 	log.Println("正在加载配置...")
-	if err := config.ReadFromFile("config.yml"); err != nil {
+	config.PathProfileName = *pathProfile
+	if err := loadConfig(); err != nil {
 		log.Fatal(err)
 	}
+	if profile := config.C.Path.Profile; profile != "" {
+		log.Printf(colors.ToBlue("使用路径配置组: %s"), profile)
+	}
+
+	// 日志脱敏, 避免密钥泄露到日志中
+	log.SetOutput(redact.Writer(os.Stderr))
+	// gin 的访问日志较多, 只在调试级别下输出
+	logs.SetLevel(config.C.Log.LogLevel())
+	gin.DefaultWriter = logs.DebugWriter(redact.Writer(os.Stdout))
+	gin.DefaultErrorWriter = redact.Writer(os.Stderr)
+
+	// selftest 子命令: 执行端到端自检后退出, 可以通过第二个参数指定样本 itemId
+	if flag.Arg(0) == "selftest" {
+		if !selftest.Run(flag.Arg(1)) {
+			os.Exit(1)
+		}
+		return
+	}
 
 	log.Println(colors.ToBlue("正在启动服务..."))
 	if err := web.Listen(); err != nil {
@@ -25,6 +58,24 @@ func main() {
 	}
 }
 
+// loadConfig 加载配置, 模拟模式下使用指向模拟服务器的配置
+func loadConfig() error {
+	if !*mockMode {
+		return config.ReadFromFile("config.yml")
+	}
+
+	servers, err := mock.Start()
+	if err != nil {
+		return err
+	}
+	dir, err := os.MkdirTemp("", "go-emby2alist-mock")
+	if err != nil {
+		return fmt.Errorf("创建临时目录失败: %v", err)
+	}
+	log.Printf(colors.ToYellow("模拟模式已开启, api_key: %s, 数据目录: %s"), mock.ApiKey, dir)
+	return config.ReadFromBytes(servers.Config(), dir)
+}
+
 func printBanner() {
 	log.Printf(colors.ToYellow(`
                                   _           ____       _ _     _   
@@ -36,5 +87,5 @@ func printBanner() {
  
  Repository: %s
     Version: %s
-	`), RepoAddr, CurrentVersion)
+	`), constant.RepoAddr, constant.CurrentVersion)
 }
@@ -0,0 +1,78 @@
+// Package emby2alist 以库的形式提供代理服务, 可以挂载到已有的 Go 网关中, 无需单独运行程序
+//
+// 程序内部使用全局配置, 一个进程中只能创建一个 Server
+package emby2alist
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/AmbitiousJun/go-emby2alist/internal/config"
+	"github.com/AmbitiousJun/go-emby2alist/internal/util/logs"
+	"github.com/AmbitiousJun/go-emby2alist/internal/web"
+)
+
+// Config 创建 Server 所需的配置
+type Config struct {
+	// File 配置文件路径, 与 Yaml 二选一
+	File string
+
+	// Yaml yaml 格式的配置内容, 格式与 config.yml 一致
+	Yaml []byte
+
+	// BasePath 使用 Yaml 时缓存等数据文件的存放目录, 为空时使用当前工作目录
+	BasePath string
+}
+
+// Server 可嵌入的代理服务
+type Server struct {
+	handler http.Handler
+}
+
+// created 是否已经创建过 Server
+var created atomic.Bool
+
+// New 加载配置并创建代理服务
+//
+// 创建之后需要调用 Start 启动后台任务, 服务在 emby 和 alist 就绪之前会拒绝请求
+func New(cfg Config) (*Server, error) {
+	if (cfg.File == "") == (len(cfg.Yaml) == 0) {
+		return nil, errors.New("File 和 Yaml 需要且只能指定一个")
+	}
+	if !created.CompareAndSwap(false, true) {
+		return nil, errors.New("一个进程中只能创建一个 Server")
+	}
+
+	var err error
+	if cfg.File != "" {
+		err = config.ReadFromFile(cfg.File)
+	} else {
+		err = config.ReadFromBytes(cfg.Yaml, cfg.BasePath)
+	}
+	if err != nil {
+		created.Store(false)
+		return nil, fmt.Errorf("加载配置失败: %v", err)
+	}
+	logs.SetLevel(config.C.Log.LogLevel())
+
+	return &Server{handler: web.NewHandler()}, nil
+}
+
+// Handler 获取代理服务的请求处理器
+//
+// 路由规则按照请求的 RequestURI 进行匹配, 处理器需要挂载在根路径上, 可以按 Host 分发到本处理器
+func (s *Server) Handler() http.Handler {
+	return s.handler
+}
+
+// ServeHTTP 实现 http.Handler 接口
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Start 启动依赖等待、磁盘缓存清理、媒体库监听等后台任务, 多次调用只会启动一次
+func (s *Server) Start() {
+	web.StartBackground()
+}
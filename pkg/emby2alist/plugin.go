@@ -0,0 +1,25 @@
+package emby2alist
+
+import "github.com/AmbitiousJun/go-emby2alist/internal/web/plugin"
+
+type (
+	// Plugin 插件, 需要按需实现 RouteProvider, MiddlewareProvider, ResponseMutator 中的一个或多个接口
+	Plugin = plugin.Plugin
+
+	// Route 插件提供的路由
+	Route = plugin.Route
+
+	// RouteProvider 提供路由的插件, 插件路由优先于内置路由匹配
+	RouteProvider = plugin.RouteProvider
+
+	// MiddlewareProvider 提供中间件的插件
+	MiddlewareProvider = plugin.MiddlewareProvider
+
+	// ResponseMutator 改写回源响应的插件
+	ResponseMutator = plugin.ResponseMutator
+)
+
+// RegisterPlugin 注册插件, 需要在调用 New 之前完成注册, 名称重复时 panic
+func RegisterPlugin(p Plugin) {
+	plugin.Register(p)
+}